@@ -44,7 +44,7 @@ type Aggregate interface {
 	HandleCommand(context.Context, Command) error
 
 	// NewEvent creates a new event with the aggregate set as type and ID.
-	NewEvent(EventType, EventData) Event
+	NewEvent(EventType, EventData, ...EventOption) Event
 	// ApplyEvent applies an event to the aggregate by setting its values and
 	// increments the aggregate version.
 	ApplyEvent(context.Context, Event)
@@ -56,6 +56,19 @@ type Aggregate interface {
 	ClearUncommittedEvents()
 }
 
+// SnapshotAggregate is an optional interface for aggregates that can be saved
+// as, and restored from, a snapshot of its state.
+type SnapshotAggregate interface {
+	Aggregate
+
+	// SnapshotState returns the current state of the aggregate to be saved in
+	// a snapshot. It should not share any data with the aggregate.
+	SnapshotState() interface{}
+	// ApplySnapshot restores the aggregate from a snapshot state and sets the
+	// aggregate version to that of the snapshot.
+	ApplySnapshot(ctx context.Context, version int, state interface{})
+}
+
 var aggregates = make(map[AggregateType]func(UUID) Aggregate)
 var registerAggregateLock sync.RWMutex
 
@@ -89,6 +102,69 @@ func RegisterAggregate(factory func(UUID) Aggregate) {
 	aggregates[aggregateType] = factory
 }
 
+var aggregateTypeAliases = make(map[AggregateType]AggregateType)
+var aggregateTypeAliasesLock sync.RWMutex
+
+// AliasAggregateType registers an old name of an aggregate type, for example
+// after renaming it. Event stores return the events saved with the old name
+// as events of the new type, without rewriting the stored events.
+//
+// An example would be:
+//     AliasAggregateType(AggregateType("Invitation"), InvitationAggregateType)
+func AliasAggregateType(oldType, newType AggregateType) {
+	if oldType == AggregateType("") || newType == AggregateType("") {
+		panic("eventhorizon: attempt to alias empty aggregate type")
+	}
+	if oldType == newType {
+		panic(fmt.Sprintf("eventhorizon: attempt to alias %q to itself", oldType))
+	}
+
+	aggregateTypeAliasesLock.Lock()
+	defer aggregateTypeAliasesLock.Unlock()
+	if _, ok := aggregateTypeAliases[oldType]; ok {
+		panic(fmt.Sprintf("eventhorizon: registering duplicate aliases for %q", oldType))
+	}
+	aggregateTypeAliases[oldType] = newType
+}
+
+// ResolveAggregateType returns the current name of an aggregate type, by
+// following the aliases registered with AliasAggregateType. Types without an
+// alias are returned as is.
+func ResolveAggregateType(aggregateType AggregateType) AggregateType {
+	aggregateTypeAliasesLock.RLock()
+	defer aggregateTypeAliasesLock.RUnlock()
+
+	// Follow renames in several steps, but not aliases in a loop.
+	for i := 0; i < len(aggregateTypeAliases); i++ {
+		newType, ok := aggregateTypeAliases[aggregateType]
+		if !ok {
+			break
+		}
+		aggregateType = newType
+	}
+	return aggregateType
+}
+
+// AggregateTypeAliases returns the old names registered with
+// AliasAggregateType that resolve to an aggregate type, for event stores that
+// filter on the stored names.
+func AggregateTypeAliases(aggregateType AggregateType) []AggregateType {
+	aggregateTypeAliasesLock.RLock()
+	oldTypes := make([]AggregateType, 0, len(aggregateTypeAliases))
+	for oldType := range aggregateTypeAliases {
+		oldTypes = append(oldTypes, oldType)
+	}
+	aggregateTypeAliasesLock.RUnlock()
+
+	var aliases []AggregateType
+	for _, oldType := range oldTypes {
+		if ResolveAggregateType(oldType) == aggregateType {
+			aliases = append(aliases, oldType)
+		}
+	}
+	return aliases
+}
+
 // CreateAggregate creates an aggregate of a type with an ID using the factory
 // registered with RegisterAggregate.
 func CreateAggregate(aggregateType AggregateType, id UUID) (Aggregate, error) {
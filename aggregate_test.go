@@ -79,6 +79,44 @@ func TestRegisterAggregateTwice(t *testing.T) {
 	})
 }
 
+func TestAliasAggregateType(t *testing.T) {
+	if aggregateType := ResolveAggregateType("TestAggregateAliasV1"); aggregateType != "TestAggregateAliasV1" {
+		t.Error("the aggregate type should not be resolved:", aggregateType)
+	}
+
+	AliasAggregateType("TestAggregateAliasV1", "TestAggregateAliasV2")
+	if aggregateType := ResolveAggregateType("TestAggregateAliasV1"); aggregateType != "TestAggregateAliasV2" {
+		t.Error("the aggregate type should be resolved:", aggregateType)
+	}
+
+	AliasAggregateType("TestAggregateAliasV2", "TestAggregateAliasV3")
+	if aggregateType := ResolveAggregateType("TestAggregateAliasV1"); aggregateType != "TestAggregateAliasV3" {
+		t.Error("the aggregate type should be resolved in several steps:", aggregateType)
+	}
+	if aggregateType := ResolveAggregateType("TestAggregateAliasV3"); aggregateType != "TestAggregateAliasV3" {
+		t.Error("the new aggregate type should not be resolved:", aggregateType)
+	}
+}
+
+func TestAliasAggregateTypeEmptyName(t *testing.T) {
+	defer func() {
+		if r := recover(); r == nil || r != "eventhorizon: attempt to alias empty aggregate type" {
+			t.Error("there should have been a panic:", r)
+		}
+	}()
+	AliasAggregateType("", TestAggregateType)
+}
+
+func TestAliasAggregateTypeTwice(t *testing.T) {
+	defer func() {
+		if r := recover(); r == nil || r != "eventhorizon: registering duplicate aliases for \"TestAggregateAliasTwice\"" {
+			t.Error("there should have been a panic:", r)
+		}
+	}()
+	AliasAggregateType("TestAggregateAliasTwice", TestAggregateType)
+	AliasAggregateType("TestAggregateAliasTwice", TestAggregateType)
+}
+
 const (
 	TestAggregateRegisterType      AggregateType = "TestAggregateRegister"
 	TestAggregateRegisterEmptyType AggregateType = ""
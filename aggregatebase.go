@@ -88,17 +88,24 @@ func (a *AggregateBase) IncrementVersion() {
 	a.version++
 }
 
+// SetVersion sets the version of the aggregate and should only be called when
+// restoring the aggregate from a snapshot in ApplySnapshot.
+func (a *AggregateBase) SetVersion(version int) {
+	a.version = version
+}
+
 // NewEvent implements the NewEvent method of the Aggregate interface.
 // The created event is only valid for the current version of the aggregate.
 // If there are uncommitted events it will mean that all the uncommitted events
 // could possibly have the same versions as they haven't been applied yet!
 // The result is that the aggregate base only supports one uncommitted event in.
-func (a *AggregateBase) NewEvent(eventType EventType, data EventData) Event {
-	e := NewEvent(eventType, data)
-	if e, ok := e.(event); ok {
+func (a *AggregateBase) NewEvent(eventType EventType, data EventData, opts ...EventOption) Event {
+	e := NewEvent(eventType, data, opts...)
+	if e, ok := e.(*event); ok {
 		e.aggregateType = a.aggregateType
 		e.aggregateID = a.id
 		e.version = a.Version() + 1
+		e.setID()
 		return e
 	}
 	return e
@@ -109,6 +116,23 @@ func (a *AggregateBase) StoreEvent(event Event) {
 	a.uncommittedEvents = append(a.uncommittedEvents, event)
 }
 
+// AppendEvent creates a new event and stores it as uncommitted, to be used in
+// HandleCommand instead of NewEvent and StoreEvent. The event is versioned
+// after the uncommitted events that are already stored, so that a command can
+// create several events. The events are applied and the version of the
+// aggregate incremented when they are saved by the repository.
+func (a *AggregateBase) AppendEvent(eventType EventType, data EventData, opts ...EventOption) Event {
+	e := NewEvent(eventType, data, opts...)
+	if e, ok := e.(*event); ok {
+		e.aggregateType = a.aggregateType
+		e.aggregateID = a.id
+		e.version = a.Version() + len(a.uncommittedEvents) + 1
+		e.setID()
+	}
+	a.StoreEvent(e)
+	return e
+}
+
 // UncommittedEvents implements the UncommittedEvents method of the Aggregate interface.
 func (a *AggregateBase) UncommittedEvents() []Event {
 	return a.uncommittedEvents
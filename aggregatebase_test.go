@@ -15,6 +15,7 @@
 package eventhorizon
 
 import (
+	"context"
 	"reflect"
 	"testing"
 )
@@ -75,6 +76,19 @@ func TestAggregateIncrementVersion(t *testing.T) {
 	}
 }
 
+func TestAggregateSetVersion(t *testing.T) {
+	agg := NewAggregateBase(TestAggregateType, NewUUID())
+	agg.SetVersion(5)
+	if agg.Version() != 5 {
+		t.Error("the version should be 5:", agg.Version())
+	}
+
+	agg.IncrementVersion()
+	if agg.Version() != 6 {
+		t.Error("the version should be 6:", agg.Version())
+	}
+}
+
 func TestAggregateStoreEvent(t *testing.T) {
 	agg := NewTestAggregate(NewUUID())
 	event1 := agg.NewEvent(TestEventType, &TestEventData{"event1"})
@@ -104,6 +118,51 @@ func TestAggregateStoreEvent(t *testing.T) {
 	}
 }
 
+func TestAggregateAppendEvent(t *testing.T) {
+	id := NewUUID()
+	agg := NewTestAggregate(id)
+	agg.SetVersion(2)
+
+	t.Log("append several events")
+	event1 := agg.AppendEvent(TestEventType, &TestEventData{"event1"})
+	event2 := agg.AppendEvent(TestEventType, &TestEventData{"event2"})
+	events := agg.UncommittedEvents()
+	if len(events) != 2 || events[0] != event1 || events[1] != event2 {
+		t.Fatal("the events should be stored in order:", events)
+	}
+	for i, e := range events {
+		if e.Version() != 3+i {
+			t.Error("the version should be correct:", e.Version())
+		}
+		if e.AggregateType() != TestAggregateType || e.AggregateID() != id {
+			t.Error("the aggregate should be set:", e.AggregateType(), e.AggregateID())
+		}
+	}
+	if agg.Version() != 2 {
+		t.Error("the version should not change before saving:", agg.Version())
+	}
+
+	t.Log("save the events with a repository")
+	repo, store, _ := createRepoAndStore(t)
+	if err := repo.Save(context.Background(), agg); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	if len(store.Events) != 2 || store.Events[1].Version() != 4 {
+		t.Error("the events should be saved:", store.Events)
+	}
+	if agg.Version() != 4 {
+		t.Error("the version should be 4:", agg.Version())
+	}
+	if len(agg.UncommittedEvents()) != 0 {
+		t.Error("there should be no uncommitted events:", agg.UncommittedEvents())
+	}
+
+	t.Log("append after saving")
+	if event := agg.AppendEvent(TestEventType, nil); event.Version() != 5 {
+		t.Error("the version should be 5:", event.Version())
+	}
+}
+
 func TestAggregateClearUncommittedEvents(t *testing.T) {
 	agg := NewTestAggregate(NewUUID())
 	event1 := agg.NewEvent(TestEventType, &TestEventData{"event1"})
@@ -35,6 +35,25 @@ func TestCreateCommand(t *testing.T) {
 	}
 }
 
+func TestCreateCommandNewInstance(t *testing.T) {
+	RegisterCommand(func() Command { return &TestCommandRegisterInstance{} })
+
+	command1, err := CreateCommand(TestCommandRegisterInstanceType)
+	if err != nil {
+		t.Error("there should be no error:", err)
+	}
+	command2, err := CreateCommand(TestCommandRegisterInstanceType)
+	if err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if command1 == command2 {
+		t.Error("each created command should be a new instance")
+	}
+	if _, ok := command1.(*TestCommandRegisterInstance); !ok {
+		t.Error("the command should have the registered concrete type:", command1)
+	}
+}
+
 func TestRegisterCommandEmptyName(t *testing.T) {
 	defer func() {
 		if r := recover(); r == nil || r != "eventhorizon: attempt to register empty command type" {
@@ -67,6 +86,8 @@ const (
 	TestCommandRegisterType      CommandType = "TestCommandRegister"
 	TestCommandRegisterEmptyType CommandType = ""
 	TestCommandRegisterTwiceType CommandType = "TestCommandRegisterTwice"
+
+	TestCommandRegisterInstanceType CommandType = "TestCommandRegisterInstance"
 )
 
 type TestCommandRegister struct{}
@@ -86,3 +107,11 @@ type TestCommandRegisterTwice struct{}
 func (a TestCommandRegisterTwice) AggregateID() UUID            { return UUID("") }
 func (a TestCommandRegisterTwice) AggregateType() AggregateType { return TestAggregateType }
 func (a TestCommandRegisterTwice) CommandType() CommandType     { return TestCommandRegisterTwiceType }
+
+type TestCommandRegisterInstance struct{ Content string }
+
+func (a *TestCommandRegisterInstance) AggregateID() UUID            { return UUID("") }
+func (a *TestCommandRegisterInstance) AggregateType() AggregateType { return TestAggregateType }
+func (a *TestCommandRegisterInstance) CommandType() CommandType {
+	return TestCommandRegisterInstanceType
+}
@@ -30,6 +30,28 @@ type CommandHandler interface {
 	HandleCommand(context.Context, Command) error
 }
 
+// CommandHandlerFunc is a function that can be used as a command handler.
+type CommandHandlerFunc func(context.Context, Command) error
+
+// HandleCommand implements the HandleCommand method of the CommandHandler.
+func (h CommandHandlerFunc) HandleCommand(ctx context.Context, cmd Command) error {
+	return h(ctx, cmd)
+}
+
+// CommandHandlerMiddleware is a function that middlewares can implement to be
+// able to chain.
+type CommandHandlerMiddleware func(CommandHandler) CommandHandler
+
+// UseCommandHandlerMiddleware wraps a CommandHandler in one or more middleware.
+// The first middleware is the outermost, handling the command first.
+func UseCommandHandlerMiddleware(h CommandHandler, middleware ...CommandHandlerMiddleware) CommandHandler {
+	// Apply in reverse order.
+	for i := len(middleware) - 1; i >= 0; i-- {
+		h = middleware[i](h)
+	}
+	return h
+}
+
 // CommandBus is an interface defining an event bus for distributing events.
 type CommandBus interface {
 	// HandleCommand handles a command on the event bus.
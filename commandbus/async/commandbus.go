@@ -0,0 +1,140 @@
+// Copyright (c) 2016 - Max Ekman <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package async
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	eh "github.com/looplab/eventhorizon"
+)
+
+// ErrBusClosed is when a command is handled after the bus is closed.
+var ErrBusClosed = errors.New("command bus is closed")
+
+// CommandBus is a command bus that handles commands asynchronously with a
+// pool of workers, using a wrapped handler such as a local command bus.
+// Commands are queued and HandleCommand returns as soon as the command is in
+// the queue, blocking only when the queue is full.
+type CommandBus struct {
+	handler   eh.CommandHandler
+	onFailure func(context.Context, eh.Command, error)
+
+	queue    chan queuedCommand
+	queueWg  sync.WaitGroup
+	closed   bool
+	closedMu sync.RWMutex
+}
+
+// Option is an option setter used to configure a CommandBus.
+type Option func(*CommandBus)
+
+// WithCommandFailureHandler sets a callback that is called for every command
+// that the handler returned an error for.
+func WithCommandFailureHandler(f func(context.Context, eh.Command, error)) Option {
+	return func(b *CommandBus) {
+		b.onFailure = f
+	}
+}
+
+// queuedCommand is a command with its context in the command queue, and the
+// channel to send the result on.
+type queuedCommand struct {
+	ctx     context.Context
+	command eh.Command
+	result  chan error
+}
+
+// NewCommandBus creates a CommandBus that handles commands with a number of
+// workers, from a queue with a size.
+func NewCommandBus(handler eh.CommandHandler, workers, queueSize int, opts ...Option) *CommandBus {
+	b := &CommandBus{
+		handler: handler,
+		queue:   make(chan queuedCommand, queueSize),
+	}
+
+	for _, opt := range opts {
+		opt(b)
+	}
+
+	if workers < 1 {
+		workers = 1
+	}
+	for i := 0; i < workers; i++ {
+		b.queueWg.Add(1)
+		go func() {
+			defer b.queueWg.Done()
+			for c := range b.queue {
+				b.handle(c)
+			}
+		}()
+	}
+
+	return b
+}
+
+// HandleCommand implements the HandleCommand method of the
+// eventhorizon.CommandHandler interface. The command is only queued, errors
+// from handling it are passed to the handler set with WithCommandFailureHandler.
+// It blocks while the queue is full, and returns the context error if it is
+// done before the command could be queued. The context is passed to the
+// wrapped handler and should not be cancelled before the command is handled.
+func (b *CommandBus) HandleCommand(ctx context.Context, cmd eh.Command) error {
+	_, err := b.Dispatch(ctx, cmd)
+	return err
+}
+
+// Dispatch queues a command like HandleCommand, and returns a channel that
+// receives the result of handling the command.
+func (b *CommandBus) Dispatch(ctx context.Context, cmd eh.Command) (<-chan error, error) {
+	b.closedMu.RLock()
+	defer b.closedMu.RUnlock()
+
+	if b.closed {
+		return nil, ErrBusClosed
+	}
+
+	// Buffered to not block the worker if the result is not received.
+	result := make(chan error, 1)
+	select {
+	case b.queue <- queuedCommand{ctx, cmd, result}:
+		return result, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// Close stops accepting commands and waits for the queued commands to be
+// handled.
+func (b *CommandBus) Close() {
+	b.closedMu.Lock()
+	if !b.closed {
+		b.closed = true
+		close(b.queue)
+	}
+	b.closedMu.Unlock()
+
+	b.queueWg.Wait()
+}
+
+// handle handles a queued command and sends the result.
+func (b *CommandBus) handle(c queuedCommand) {
+	err := b.handler.HandleCommand(c.ctx, c.command)
+	if err != nil && b.onFailure != nil {
+		b.onFailure(c.ctx, c.command, err)
+	}
+	c.result <- err
+}
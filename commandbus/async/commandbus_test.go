@@ -0,0 +1,192 @@
+// Copyright (c) 2016 - Max Ekman <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package async
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	eh "github.com/looplab/eventhorizon"
+	"github.com/looplab/eventhorizon/mocks"
+)
+
+func TestCommandBus(t *testing.T) {
+	handler := &mocks.CommandHandler{}
+	bus := NewCommandBus(handler, 1, 1)
+	defer bus.Close()
+
+	ctx := mocks.WithContextOne(context.Background(), "testval")
+
+	t.Log("dispatch command")
+	cmd := mocks.Command{eh.NewUUID(), "cmd"}
+	result, err := bus.Dispatch(ctx, cmd)
+	if err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	if err := <-result; err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if handler.Command != cmd {
+		t.Error("the command should be handled:", handler.Command)
+	}
+	if val, ok := mocks.ContextOne(handler.Context); !ok || val != "testval" {
+		t.Error("the context should be correct:", handler.Context)
+	}
+
+	t.Log("handle command after close")
+	bus.Close()
+	if err := bus.HandleCommand(ctx, cmd); err != ErrBusClosed {
+		t.Error("there should be a ErrBusClosed error:", err)
+	}
+}
+
+func TestCommandBusWorkers(t *testing.T) {
+	handler := &blockingHandler{release: make(chan struct{})}
+	bus := NewCommandBus(handler, 2, 5)
+
+	t.Log("handle commands with two workers")
+	for i := 0; i < 5; i++ {
+		if err := bus.HandleCommand(context.Background(), mocks.Command{eh.NewUUID(), "cmd"}); err != nil {
+			t.Error("there should be no error:", err)
+		}
+	}
+	handler.waitForActive(t, 2)
+	close(handler.release)
+	bus.Close()
+
+	handler.mu.Lock()
+	defer handler.mu.Unlock()
+	if handler.maxActive != 2 {
+		t.Error("there should be at most two commands handled at once:", handler.maxActive)
+	}
+	if handler.handled != 5 {
+		t.Error("all commands should be handled:", handler.handled)
+	}
+}
+
+func TestCommandBusBackpressure(t *testing.T) {
+	handler := &blockingHandler{release: make(chan struct{})}
+	bus := NewCommandBus(handler, 1, 1)
+
+	t.Log("fill the worker and the queue")
+	if err := bus.HandleCommand(context.Background(), mocks.Command{eh.NewUUID(), "cmd1"}); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	handler.waitForActive(t, 1)
+	if err := bus.HandleCommand(context.Background(), mocks.Command{eh.NewUUID(), "cmd2"}); err != nil {
+		t.Error("there should be no error:", err)
+	}
+
+	t.Log("block while the queue is full")
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := bus.HandleCommand(ctx, mocks.Command{eh.NewUUID(), "cmd3"}); err != context.DeadlineExceeded {
+		t.Error("there should be a context.DeadlineExceeded error:", err)
+	}
+
+	t.Log("queue again when the queue is not full")
+	done := make(chan error)
+	go func() {
+		done <- bus.HandleCommand(context.Background(), mocks.Command{eh.NewUUID(), "cmd3"})
+	}()
+	close(handler.release)
+	if err := <-done; err != nil {
+		t.Error("there should be no error:", err)
+	}
+	bus.Close()
+
+	handler.mu.Lock()
+	defer handler.mu.Unlock()
+	if handler.handled != 3 {
+		t.Error("all queued commands should be handled:", handler.handled)
+	}
+}
+
+func TestCommandBusError(t *testing.T) {
+	handlerErr := errors.New("handler error")
+	handler := eh.CommandHandlerFunc(func(ctx context.Context, cmd eh.Command) error {
+		return handlerErr
+	})
+	var failedCmd eh.Command
+	var failedErr error
+	bus := NewCommandBus(handler, 1, 1, WithCommandFailureHandler(func(ctx context.Context, cmd eh.Command, err error) {
+		failedCmd = cmd
+		failedErr = err
+	}))
+
+	t.Log("dispatch failing command")
+	cmd := mocks.Command{eh.NewUUID(), "cmd"}
+	result, err := bus.Dispatch(context.Background(), cmd)
+	if err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	if err := <-result; err != handlerErr {
+		t.Error("the result should be the handler error:", err)
+	}
+
+	t.Log("handle failing command")
+	cmd2 := mocks.Command{eh.NewUUID(), "cmd2"}
+	if err := bus.HandleCommand(context.Background(), cmd2); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	bus.Close()
+	if failedCmd != cmd2 || failedErr != handlerErr {
+		t.Error("the failure handler should be called:", failedCmd, failedErr)
+	}
+}
+
+// blockingHandler is a handler that blocks until released, and records the
+// number of concurrently handled commands.
+type blockingHandler struct {
+	release   chan struct{}
+	mu        sync.Mutex
+	active    int
+	maxActive int
+	handled   int
+}
+
+func (h *blockingHandler) HandleCommand(ctx context.Context, cmd eh.Command) error {
+	h.mu.Lock()
+	h.active++
+	if h.active > h.maxActive {
+		h.maxActive = h.active
+	}
+	h.mu.Unlock()
+
+	<-h.release
+
+	h.mu.Lock()
+	h.active--
+	h.handled++
+	h.mu.Unlock()
+	return nil
+}
+
+// waitForActive waits until a number of commands are handled at once.
+func (h *blockingHandler) waitForActive(t *testing.T, n int) {
+	for i := 0; i < 100; i++ {
+		h.mu.Lock()
+		active := h.active
+		h.mu.Unlock()
+		if active == n {
+			return
+		}
+		time.Sleep(time.Millisecond)
+	}
+	t.Error("there should be active commands:", n)
+}
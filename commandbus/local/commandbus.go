@@ -22,33 +22,73 @@ import (
 )
 
 // CommandBus is a command bus that handles commands with the
-// registered CommandHandlers
+// registered CommandHandlers. It routes each command by its type to the one
+// handler set for that type, and is itself an eventhorizon.CommandHandler, so
+// that it can be wrapped in middleware or used as the handler of other buses.
 type CommandBus struct {
 	handlers   map[eh.CommandType]eh.CommandHandler
 	handlersMu sync.RWMutex
+	logger     eh.Logger
+}
+
+// Option is an option setter used to configure creation.
+type Option func(*CommandBus)
+
+// WithLogger logs the handling of commands and the handler errors with a
+// logger.
+func WithLogger(logger eh.Logger) Option {
+	return func(b *CommandBus) {
+		if logger == nil {
+			logger = eh.NopLogger{}
+		}
+		b.logger = logger
+	}
 }
 
 // NewCommandBus creates a CommandBus.
-func NewCommandBus() *CommandBus {
+func NewCommandBus(opts ...Option) *CommandBus {
 	b := &CommandBus{
 		handlers: make(map[eh.CommandType]eh.CommandHandler),
+		logger:   eh.NopLogger{},
+	}
+
+	for _, opt := range opts {
+		opt(b)
 	}
+
 	return b
 }
 
 // HandleCommand handles a command with a handler capable of handling it.
+// Returns ErrHandlerNotFound if no handler is set for the command type.
 func (b *CommandBus) HandleCommand(ctx context.Context, command eh.Command) error {
 	b.handlersMu.RLock()
 	defer b.handlersMu.RUnlock()
 
-	if handler, ok := b.handlers[command.CommandType()]; ok {
-		return handler.HandleCommand(ctx, command)
+	handler, ok := b.handlers[command.CommandType()]
+	if !ok {
+		b.logger.Error("command bus: no handler for command",
+			"command_type", command.CommandType(),
+		)
+		return eh.ErrHandlerNotFound
 	}
 
-	return eh.ErrHandlerNotFound
+	b.logger.Debug("command bus: handling command",
+		"command_type", command.CommandType(),
+	)
+	if err := handler.HandleCommand(ctx, command); err != nil {
+		b.logger.Error("command bus: handler failed",
+			"command_type", command.CommandType(),
+			"error", err,
+		)
+		return err
+	}
+
+	return nil
 }
 
-// SetHandler adds a handler for a specific command.
+// SetHandler adds a handler for a specific command. Returns
+// ErrHandlerAlreadySet if there already is a handler for the command type.
 func (b *CommandBus) SetHandler(handler eh.CommandHandler, commandType eh.CommandType) error {
 	b.handlersMu.Lock()
 	defer b.handlersMu.Unlock()
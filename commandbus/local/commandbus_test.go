@@ -16,6 +16,8 @@ package local
 
 import (
 	"context"
+	"errors"
+	"reflect"
 	"testing"
 
 	eh "github.com/looplab/eventhorizon"
@@ -61,3 +63,95 @@ func TestCommandBus(t *testing.T) {
 		t.Error("there should be a ErrHandlerAlreadySet error:", err)
 	}
 }
+
+func TestCommandBusRouting(t *testing.T) {
+	var bus eh.CommandHandler = NewCommandBus()
+	router := bus.(*CommandBus)
+
+	handler1 := &mocks.CommandHandler{}
+	if err := router.SetHandler(handler1, mocks.CommandType); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	handler2 := &mocks.CommandHandler{}
+	if err := router.SetHandler(handler2, mocks.CommandOtherType); err != nil {
+		t.Error("there should be no error:", err)
+	}
+
+	ctx := context.Background()
+
+	t.Log("route commands to the handler for their type")
+	command1 := &mocks.Command{eh.NewUUID(), "command1"}
+	if err := bus.HandleCommand(ctx, command1); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	command2 := &mocks.CommandOther{eh.NewUUID(), "command2"}
+	if err := bus.HandleCommand(ctx, command2); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if handler1.Command != command1 {
+		t.Error("the first handler should handle the first command:", handler1.Command)
+	}
+	if handler2.Command != command2 {
+		t.Error("the second handler should handle the second command:", handler2.Command)
+	}
+
+	t.Log("handle a command without a handler for its type")
+	command3 := &mocks.CommandOther2{eh.NewUUID(), "command3"}
+	if err := bus.HandleCommand(ctx, command3); err != eh.ErrHandlerNotFound {
+		t.Error("there should be a ErrHandlerNotFound error:", err)
+	}
+
+	t.Log("set a second handler for a command type")
+	handler3 := &mocks.CommandHandler{}
+	if err := router.SetHandler(handler3, mocks.CommandOtherType); err != eh.ErrHandlerAlreadySet {
+		t.Error("there should be a ErrHandlerAlreadySet error:", err)
+	}
+	if err := bus.HandleCommand(ctx, command2); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if handler3.Command != nil {
+		t.Error("the first handler should be kept:", handler3.Command)
+	}
+}
+
+func TestCommandBusLogger(t *testing.T) {
+	logger := &mocks.Logger{}
+	bus := NewCommandBus(WithLogger(logger))
+	if bus == nil {
+		t.Fatal("there should be a bus")
+	}
+
+	handlerErr := errors.New("handler error")
+	handler := eh.CommandHandlerFunc(func(ctx context.Context, cmd eh.Command) error {
+		return handlerErr
+	})
+	if err := bus.SetHandler(handler, mocks.CommandType); err != nil {
+		t.Error("there should be no error:", err)
+	}
+
+	t.Log("log a failing handler with the command type")
+	command := &mocks.Command{eh.NewUUID(), "command1"}
+	if err := bus.HandleCommand(context.Background(), command); err != handlerErr {
+		t.Error("there should be a handler error:", err)
+	}
+	entries := logger.Find("error", "command bus: handler failed")
+	if len(entries) != 1 {
+		t.Fatal("the handler error should be logged:", logger.Entries)
+	}
+	expected := map[string]interface{}{
+		"command_type": mocks.CommandType,
+		"error":        handlerErr,
+	}
+	if !reflect.DeepEqual(entries[0].Fields, expected) {
+		t.Error("the fields should be correct:", entries[0].Fields)
+	}
+
+	t.Log("log a command without a handler")
+	if err := bus.HandleCommand(context.Background(), &mocks.CommandOther{eh.NewUUID(), "command2"}); err != eh.ErrHandlerNotFound {
+		t.Error("there should be a ErrHandlerNotFound error:", err)
+	}
+	entries = logger.Find("error", "command bus: no handler for command")
+	if len(entries) != 1 || entries[0].Fields["command_type"] != mocks.CommandOtherType {
+		t.Error("the missing handler should be logged:", logger.Entries)
+	}
+}
@@ -0,0 +1,45 @@
+// Copyright (c) 2016 - Max Ekman <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package eventhorizon
+
+import (
+	"context"
+	"reflect"
+	"testing"
+)
+
+func TestUseCommandHandlerMiddleware(t *testing.T) {
+	order := []string{}
+	middleware := func(name string) CommandHandlerMiddleware {
+		return func(h CommandHandler) CommandHandler {
+			return CommandHandlerFunc(func(ctx context.Context, cmd Command) error {
+				order = append(order, name)
+				return h.HandleCommand(ctx, cmd)
+			})
+		}
+	}
+	handler := CommandHandlerFunc(func(ctx context.Context, cmd Command) error {
+		order = append(order, "handler")
+		return nil
+	})
+
+	h := UseCommandHandlerMiddleware(handler, middleware("first"), middleware("second"))
+	if err := h.HandleCommand(context.Background(), &TestCommand{NewUUID(), "command"}); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if !reflect.DeepEqual(order, []string{"first", "second", "handler"}) {
+		t.Error("the middleware should be called in order:", order)
+	}
+}
@@ -48,6 +48,9 @@ func (c CommandFieldError) Error() string {
 // 4. The aggregate stores events in response to the command
 // 5. The new events are stored in the event store by the repository
 // 6. The events are published to the event bus when stored by the event store
+//
+// Commands handled with a context from WithDryRun stop after step 4, the
+// events are kept in the context instead of being saved and published.
 type AggregateCommandHandler struct {
 	repository Repository
 	aggregates map[CommandType]AggregateType
@@ -103,6 +106,13 @@ func (h *AggregateCommandHandler) HandleCommand(ctx context.Context, command Com
 		return err
 	}
 
+	// Keep the events of a dry run instead of saving and publishing them.
+	if run, ok := ctx.Value(dryRunKey).(*dryRun); ok {
+		run.add(aggregate.UncommittedEvents())
+		aggregate.ClearUncommittedEvents()
+		return nil
+	}
+
 	if err = h.repository.Save(ctx, aggregate); err != nil {
 		return err
 	}
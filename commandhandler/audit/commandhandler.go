@@ -0,0 +1,165 @@
+// Copyright (c) 2016 - Max Ekman <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package audit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	eh "github.com/looplab/eventhorizon"
+)
+
+// ErrCouldNotWriteEntry is when the audit entry of an attempted command could
+// not be written, and the command was therefore not handled.
+var ErrCouldNotWriteEntry = errors.New("could not write audit entry")
+
+// Stage is the stage of the command handling that an entry is written at.
+type Stage string
+
+const (
+	// StageAttempted is the stage before the command is handled.
+	StageAttempted Stage = "attempted"
+	// StageCompleted is the stage after the command has been handled, with
+	// the outcome and latency.
+	StageCompleted Stage = "completed"
+)
+
+// Entry is an audit entry for a command.
+type Entry struct {
+	// Stage is the stage the entry was written at.
+	Stage Stage
+	// Time is when the command was attempted.
+	Time time.Time
+	// Identity is who sent the command, from the context.
+	Identity string
+	// Namespace is the namespace of the context.
+	Namespace string
+	// CommandType is the type of the command.
+	CommandType eh.CommandType
+	// AggregateType is the aggregate type of the command.
+	AggregateType eh.AggregateType
+	// AggregateID is the aggregate ID of the command.
+	AggregateID eh.UUID
+	// Command is the command with the payload.
+	Command eh.Command
+	// Err is the error from handling the command, only for StageCompleted.
+	Err error
+	// Latency is the time it took to handle the command, only for
+	// StageCompleted.
+	Latency time.Duration
+}
+
+// AuditSink writes audit entries, for example to a log or a DB.
+type AuditSink interface {
+	// WriteEntry writes an audit entry.
+	WriteEntry(context.Context, Entry) error
+}
+
+// IdentityFunc returns the identity that sent a command, set in the context
+// by upstream authentication.
+type IdentityFunc func(context.Context) string
+
+// Option is an option setter used to configure the middleware.
+type Option func(*CommandHandler)
+
+// WithIdentity sets the identity of the entries with the identity func.
+func WithIdentity(identity IdentityFunc) Option {
+	return func(h *CommandHandler) {
+		h.identity = identity
+	}
+}
+
+// WithLogger logs the entries that could not be written after the commands
+// were handled with a logger.
+func WithLogger(logger eh.Logger) Option {
+	return func(h *CommandHandler) {
+		if logger == nil {
+			logger = eh.NopLogger{}
+		}
+		h.logger = logger
+	}
+}
+
+// NewMiddleware returns a middleware that writes audit entries for all
+// commands to the sink.
+func NewMiddleware(sink AuditSink, opts ...Option) eh.CommandHandlerMiddleware {
+	return func(h eh.CommandHandler) eh.CommandHandler {
+		return NewCommandHandler(h, sink, opts...)
+	}
+}
+
+// CommandHandler is a middleware that writes an audit entry before and after
+// each command is handled.
+type CommandHandler struct {
+	eh.CommandHandler
+	sink     AuditSink
+	identity IdentityFunc
+	logger   eh.Logger
+}
+
+// NewCommandHandler creates a new CommandHandler.
+func NewCommandHandler(handler eh.CommandHandler, sink AuditSink, opts ...Option) *CommandHandler {
+	h := &CommandHandler{
+		CommandHandler: handler,
+		sink:           sink,
+		logger:         eh.NopLogger{},
+	}
+
+	for _, opt := range opts {
+		opt(h)
+	}
+
+	return h
+}
+
+// HandleCommand implements the HandleCommand method of the
+// eventhorizon.CommandHandler interface. Commands are not handled if the entry
+// before handling them could not be written, returning ErrCouldNotWriteEntry
+// wrapping the error of the sink. The error from the handler is returned as is, an
+// entry that could not be written after handling is only logged.
+func (h *CommandHandler) HandleCommand(ctx context.Context, cmd eh.Command) error {
+	entry := Entry{
+		Stage:         StageAttempted,
+		Time:          time.Now(),
+		Namespace:     eh.Namespace(ctx),
+		CommandType:   cmd.CommandType(),
+		AggregateType: cmd.AggregateType(),
+		AggregateID:   cmd.AggregateID(),
+		Command:       cmd,
+	}
+	if h.identity != nil {
+		entry.Identity = h.identity(ctx)
+	}
+
+	if err := h.sink.WriteEntry(ctx, entry); err != nil {
+		return fmt.Errorf("%w: %w", ErrCouldNotWriteEntry, err)
+	}
+
+	err := h.CommandHandler.HandleCommand(ctx, cmd)
+
+	entry.Stage = StageCompleted
+	entry.Err = err
+	entry.Latency = time.Since(entry.Time)
+	if sinkErr := h.sink.WriteEntry(ctx, entry); sinkErr != nil {
+		h.logger.Error("audit: could not write entry",
+			"command_type", cmd.CommandType(),
+			"error", sinkErr,
+		)
+	}
+
+	return err
+}
@@ -0,0 +1,139 @@
+// Copyright (c) 2016 - Max Ekman <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package audit
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	eh "github.com/looplab/eventhorizon"
+	"github.com/looplab/eventhorizon/mocks"
+)
+
+func TestCommandHandler(t *testing.T) {
+	sink := &recordingSink{}
+	identity := func(ctx context.Context) string {
+		user, _ := mocks.ContextOne(ctx)
+		return user
+	}
+	handler := &mocks.CommandHandler{}
+	h := eh.UseCommandHandlerMiddleware(handler, NewMiddleware(sink, WithIdentity(identity)))
+	ctx := mocks.WithContextOne(context.Background(), "admin")
+
+	t.Log("write entries for a successful command")
+	cmd := mocks.Command{eh.NewUUID(), "cmd"}
+	if err := h.HandleCommand(ctx, cmd); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if handler.Command != cmd {
+		t.Error("the command should be handled:", handler.Command)
+	}
+	if len(sink.entries) != 2 {
+		t.Fatal("there should be two entries:", sink.entries)
+	}
+	for i, stage := range []Stage{StageAttempted, StageCompleted} {
+		entry := sink.entries[i]
+		if entry.Stage != stage {
+			t.Error("the stage should be correct:", entry.Stage)
+		}
+		if entry.Identity != "admin" || entry.Namespace != "default" {
+			t.Error("the identity and namespace should be correct:", entry.Identity, entry.Namespace)
+		}
+		if entry.CommandType != mocks.CommandType || entry.AggregateID != cmd.ID || entry.Command != cmd {
+			t.Error("the command should be correct:", entry)
+		}
+		if entry.Time.IsZero() || entry.Err != nil {
+			t.Error("the time and error should be correct:", entry.Time, entry.Err)
+		}
+	}
+	if sink.entries[1].Latency < 0 {
+		t.Error("the latency should be set:", sink.entries[1].Latency)
+	}
+
+	t.Log("write entries for a failed command")
+	sink.entries = nil
+	handlerErr := errors.New("handler error")
+	h = NewCommandHandler(&failingHandler{handlerErr}, sink, WithIdentity(identity))
+	if err := h.HandleCommand(ctx, cmd); err != handlerErr {
+		t.Error("there should be a handler error:", err)
+	}
+	if len(sink.entries) != 2 {
+		t.Fatal("there should be two entries:", sink.entries)
+	}
+	if entry := sink.entries[0]; entry.Stage != StageAttempted || entry.Err != nil {
+		t.Error("the attempted entry should be correct:", entry)
+	}
+	if entry := sink.entries[1]; entry.Stage != StageCompleted || entry.Err != handlerErr {
+		t.Error("the completed entry should have the error:", entry)
+	}
+}
+
+func TestCommandHandlerSinkError(t *testing.T) {
+	sinkErr := errors.New("sink error")
+	sink := &recordingSink{err: sinkErr}
+	handler := &mocks.CommandHandler{}
+	h := NewCommandHandler(handler, sink)
+
+	t.Log("skip handling of command when the entry could not be written")
+	cmd := mocks.Command{eh.NewUUID(), "cmd"}
+	err := h.HandleCommand(context.Background(), cmd)
+	if !errors.Is(err, ErrCouldNotWriteEntry) || !errors.Is(err, sinkErr) {
+		t.Error("there should be a ErrCouldNotWriteEntry error:", err)
+	}
+	if err.Error() != "could not write audit entry: sink error" {
+		t.Error("the error string should be correct:", err.Error())
+	}
+	if handler.Command != nil {
+		t.Error("the command should not be handled:", handler.Command)
+	}
+
+	t.Log("return the handler result when the completed entry could not be written")
+	sink.err = nil
+	sink.failCompleted = true
+	if err := h.HandleCommand(context.Background(), cmd); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if handler.Command != cmd {
+		t.Error("the command should be handled:", handler.Command)
+	}
+}
+
+// recordingSink records the written entries.
+type recordingSink struct {
+	entries       []Entry
+	err           error
+	failCompleted bool
+}
+
+func (s *recordingSink) WriteEntry(ctx context.Context, entry Entry) error {
+	if s.err != nil {
+		return s.err
+	}
+	if s.failCompleted && entry.Stage == StageCompleted {
+		return errors.New("sink error")
+	}
+	s.entries = append(s.entries, entry)
+	return nil
+}
+
+// failingHandler fails to handle all commands.
+type failingHandler struct {
+	err error
+}
+
+func (h *failingHandler) HandleCommand(ctx context.Context, cmd eh.Command) error {
+	return h.err
+}
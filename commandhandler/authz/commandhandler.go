@@ -0,0 +1,65 @@
+// Copyright (c) 2016 - Max Ekman <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package authz
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	eh "github.com/looplab/eventhorizon"
+)
+
+// ErrUnauthorized is when a command is not authorized to be handled.
+var ErrUnauthorized = errors.New("unauthorized command")
+
+// AuthorizeFunc authorizes a command before it is handled, returning an error
+// if it is not allowed to be handled. The context can be used to get the
+// identity set by upstream authentication.
+type AuthorizeFunc func(context.Context, eh.Command) error
+
+// NewMiddleware returns a middleware that authorizes commands with the
+// authorize func before they are handled.
+func NewMiddleware(authorize AuthorizeFunc) eh.CommandHandlerMiddleware {
+	return func(h eh.CommandHandler) eh.CommandHandler {
+		return NewCommandHandler(h, authorize)
+	}
+}
+
+// CommandHandler is a middleware that authorizes all commands, without
+// handling the ones that are not authorized.
+type CommandHandler struct {
+	eh.CommandHandler
+	authorize AuthorizeFunc
+}
+
+// NewCommandHandler creates a new CommandHandler.
+func NewCommandHandler(handler eh.CommandHandler, authorize AuthorizeFunc) *CommandHandler {
+	return &CommandHandler{
+		CommandHandler: handler,
+		authorize:      authorize,
+	}
+}
+
+// HandleCommand implements the HandleCommand method of the
+// eventhorizon.CommandHandler interface. It returns ErrUnauthorized wrapping
+// the error of the authorize func if the command is not authorized.
+func (h *CommandHandler) HandleCommand(ctx context.Context, cmd eh.Command) error {
+	if err := h.authorize(ctx, cmd); err != nil {
+		return fmt.Errorf("%w: %w", ErrUnauthorized, err)
+	}
+
+	return h.CommandHandler.HandleCommand(ctx, cmd)
+}
@@ -0,0 +1,74 @@
+// Copyright (c) 2016 - Max Ekman <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package authz
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	eh "github.com/looplab/eventhorizon"
+	"github.com/looplab/eventhorizon/mocks"
+)
+
+func TestCommandHandler(t *testing.T) {
+	errDenied := errors.New("denied")
+	authorize := func(ctx context.Context, cmd eh.Command) error {
+		if user, ok := mocks.ContextOne(ctx); !ok || user != "admin" {
+			return errDenied
+		}
+		if cmd.CommandType() != mocks.CommandType {
+			return errDenied
+		}
+		return nil
+	}
+	handler := &mocks.CommandHandler{}
+	h := eh.UseCommandHandlerMiddleware(handler, NewMiddleware(authorize))
+	ctx := mocks.WithContextOne(context.Background(), "admin")
+
+	t.Log("handle authorized command")
+	cmd := mocks.Command{eh.NewUUID(), "cmd"}
+	if err := h.HandleCommand(ctx, cmd); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if handler.Command != cmd {
+		t.Error("the command should be handled:", handler.Command)
+	}
+	if val, ok := mocks.ContextOne(handler.Context); !ok || val != "admin" {
+		t.Error("the context should be correct:", handler.Context)
+	}
+
+	t.Log("skip handling of unauthorized command type")
+	otherCmd := mocks.CommandOther{eh.NewUUID(), "cmd"}
+	err := h.HandleCommand(ctx, otherCmd)
+	if !errors.Is(err, ErrUnauthorized) || !errors.Is(err, errDenied) {
+		t.Error("the error should match ErrUnauthorized and the base error:", err)
+	}
+	if err.Error() != "unauthorized command: denied" {
+		t.Error("the error string should be correct:", err.Error())
+	}
+	if handler.Command != cmd {
+		t.Error("the command should not be handled:", handler.Command)
+	}
+
+	t.Log("skip handling of command without identity")
+	cmd2 := mocks.Command{eh.NewUUID(), "cmd"}
+	if err := h.HandleCommand(context.Background(), cmd2); !errors.Is(err, ErrUnauthorized) {
+		t.Error("there should be a ErrUnauthorized error:", err)
+	}
+	if handler.Command != cmd {
+		t.Error("the command should not be handled:", handler.Command)
+	}
+}
@@ -0,0 +1,73 @@
+// Copyright (c) 2016 - Max Ekman <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package correlation contains a command handler middleware that sets the
+// correlation and causation IDs of the commands in the context.
+package correlation
+
+import (
+	"context"
+
+	eh "github.com/looplab/eventhorizon"
+)
+
+// IdentifiedCommand is a command with an ID, used as the causation ID of the
+// events that it causes.
+type IdentifiedCommand interface {
+	eh.Command
+
+	// CommandID returns the ID of the command.
+	CommandID() eh.UUID
+}
+
+// NewMiddleware returns a middleware that sets the correlation and causation
+// IDs of the commands in the context.
+func NewMiddleware() eh.CommandHandlerMiddleware {
+	return func(h eh.CommandHandler) eh.CommandHandler {
+		return NewCommandHandler(h)
+	}
+}
+
+// CommandHandler is a middleware that sets the ID of each command as the
+// causation ID in the context, with a new ID for commands that are not
+// IdentifiedCommands. A correlation ID already set in the context is kept,
+// otherwise the causation ID is also used as correlation ID, starting a new
+// chain of commands and events. Aggregates set the IDs in the metadata of the
+// events they create with eventhorizon.WithEventCorrelation.
+type CommandHandler struct {
+	eh.CommandHandler
+}
+
+// NewCommandHandler creates a new CommandHandler.
+func NewCommandHandler(handler eh.CommandHandler) *CommandHandler {
+	return &CommandHandler{
+		CommandHandler: handler,
+	}
+}
+
+// HandleCommand implements the HandleCommand method of the
+// eventhorizon.CommandHandler interface.
+func (h *CommandHandler) HandleCommand(ctx context.Context, cmd eh.Command) error {
+	causationID := eh.NewUUID()
+	if c, ok := cmd.(IdentifiedCommand); ok && c.CommandID() != eh.UUID("") {
+		causationID = c.CommandID()
+	}
+
+	ctx = eh.WithCausationID(ctx, causationID.String())
+	if eh.CorrelationID(ctx) == "" {
+		ctx = eh.WithCorrelationID(ctx, causationID.String())
+	}
+
+	return h.CommandHandler.HandleCommand(ctx, cmd)
+}
@@ -0,0 +1,89 @@
+// Copyright (c) 2016 - Max Ekman <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package correlation
+
+import (
+	"context"
+	"testing"
+
+	eh "github.com/looplab/eventhorizon"
+	"github.com/looplab/eventhorizon/mocks"
+)
+
+func TestCommandHandler(t *testing.T) {
+	var events []eh.Event
+	handler := eh.CommandHandlerFunc(func(ctx context.Context, cmd eh.Command) error {
+		agg := mocks.NewAggregate(cmd.AggregateID())
+		events = append(events, agg.NewEvent(mocks.EventType, &mocks.EventData{Content: "event"},
+			eh.WithEventCorrelation(ctx)))
+		return nil
+	})
+	h := eh.UseCommandHandlerMiddleware(handler, NewMiddleware())
+
+	t.Log("command without a correlation ID")
+	if err := h.HandleCommand(context.Background(), mocks.Command{ID: eh.NewUUID(), Content: "cmd"}); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if len(events) != 1 {
+		t.Fatal("there should be an event:", events)
+	}
+	correlationID, _ := events[0].Metadata()[eh.CorrelationIDKey].(string)
+	if correlationID == "" {
+		t.Error("the event should have a correlation ID:", events[0].Metadata())
+	}
+	causationID, _ := events[0].Metadata()[eh.CausationIDKey].(string)
+	if causationID != correlationID {
+		t.Error("the causation ID should be the correlation ID:", causationID)
+	}
+
+	t.Log("new IDs for each command")
+	if err := h.HandleCommand(context.Background(), mocks.Command{ID: eh.NewUUID(), Content: "cmd"}); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if len(events) != 2 {
+		t.Fatal("there should be two events:", events)
+	}
+	if id := events[1].Metadata()[eh.CorrelationIDKey]; id == "" || id == correlationID {
+		t.Error("the event should have a new correlation ID:", id)
+	}
+
+	t.Log("keep the correlation ID of the context")
+	ctx := eh.WithCorrelationID(context.Background(), "correlation")
+	cmd := identifiedCommand{
+		Command: mocks.Command{ID: eh.NewUUID(), Content: "cmd"},
+		id:      eh.NewUUID(),
+	}
+	if err := h.HandleCommand(ctx, cmd); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if len(events) != 3 {
+		t.Fatal("there should be three events:", events)
+	}
+	if id := events[2].Metadata()[eh.CorrelationIDKey]; id != "correlation" {
+		t.Error("the event should inherit the correlation ID:", id)
+	}
+	if id := events[2].Metadata()[eh.CausationIDKey]; id != cmd.id.String() {
+		t.Error("the causation ID should be the command ID:", id)
+	}
+}
+
+type identifiedCommand struct {
+	mocks.Command
+	id eh.UUID
+}
+
+func (c identifiedCommand) CommandID() eh.UUID {
+	return c.id
+}
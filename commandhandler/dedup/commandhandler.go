@@ -0,0 +1,192 @@
+// Copyright (c) 2016 - Max Ekman <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dedup
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	eh "github.com/looplab/eventhorizon"
+)
+
+// ErrCommandInProgress is when a command with the same idempotency key is
+// being handled by another process.
+var ErrCommandInProgress = errors.New("command in progress")
+
+// ErrCouldNotReserveKey is when the idempotency key of a command could not be
+// reserved in the store, and the command was therefore not handled.
+var ErrCouldNotReserveKey = errors.New("could not reserve idempotency key")
+
+// IdempotentCommand is a command with an idempotency key, set by the client
+// and kept when the command is retried. Commands with an empty key are not
+// deduplicated.
+type IdempotentCommand interface {
+	eh.Command
+
+	// IdempotencyKey returns the idempotency key of the command.
+	IdempotencyKey() string
+}
+
+// Store records the idempotency keys of commands, shared by all processes
+// that handle the commands.
+type Store interface {
+	// Reserve records the key of a command that is about to be handled and
+	// returns true, if the key is not already recorded. Otherwise it returns
+	// false, with done set if the command has been handled. The reservation
+	// expires after the TTL.
+	Reserve(ctx context.Context, key string, ttl time.Duration) (reserved, done bool, err error)
+
+	// Complete marks the key of a command that has been handled as done, until
+	// the TTL expires.
+	Complete(ctx context.Context, key string, ttl time.Duration) error
+
+	// Release removes the key of a command that could not be handled, to let
+	// it be retried.
+	Release(ctx context.Context, key string) error
+}
+
+// Option is an option setter used to configure the middleware.
+type Option func(*CommandHandler)
+
+// WithLogger logs the keys that could not be completed or released in the
+// store after the commands were handled with a logger.
+func WithLogger(logger eh.Logger) Option {
+	return func(h *CommandHandler) {
+		if logger == nil {
+			logger = eh.NopLogger{}
+		}
+		h.logger = logger
+	}
+}
+
+// NewMiddleware returns a middleware that only handles the first command with
+// each idempotency key within the TTL.
+func NewMiddleware(store Store, ttl time.Duration, opts ...Option) eh.CommandHandlerMiddleware {
+	return func(h eh.CommandHandler) eh.CommandHandler {
+		return NewCommandHandler(h, store, ttl, opts...)
+	}
+}
+
+// CommandHandler is a middleware that deduplicates commands by their
+// idempotency key, for clients that retry commands. A command is only handled
+// once within the TTL, later commands with the same key return without being
+// handled. Keys of commands that fail are released, so that they can be
+// retried. Commands that are not IdempotentCommands are always handled.
+type CommandHandler struct {
+	eh.CommandHandler
+	store  Store
+	ttl    time.Duration
+	logger eh.Logger
+
+	// inFlight has the commands being handled by this handler, for
+	// duplicates to wait for.
+	inFlight   map[string]*call
+	inFlightMu sync.Mutex
+}
+
+// call is a command being handled, done is closed with the result in err.
+type call struct {
+	done chan struct{}
+	err  error
+}
+
+// NewCommandHandler creates a new CommandHandler.
+func NewCommandHandler(handler eh.CommandHandler, store Store, ttl time.Duration, opts ...Option) *CommandHandler {
+	h := &CommandHandler{
+		CommandHandler: handler,
+		store:          store,
+		ttl:            ttl,
+		logger:         eh.NopLogger{},
+		inFlight:       map[string]*call{},
+	}
+
+	for _, opt := range opts {
+		opt(h)
+	}
+
+	return h
+}
+
+// HandleCommand implements the HandleCommand method of the
+// eventhorizon.CommandHandler interface. A duplicate of a command being
+// handled by this handler waits for it and returns its result. A duplicate of
+// a handled command returns nil, and a duplicate of a command being handled by
+// another process returns ErrCommandInProgress.
+func (h *CommandHandler) HandleCommand(ctx context.Context, cmd eh.Command) error {
+	c, ok := cmd.(IdempotentCommand)
+	if !ok || c.IdempotencyKey() == "" {
+		return h.CommandHandler.HandleCommand(ctx, cmd)
+	}
+	key := eh.Namespace(ctx) + ":" + c.IdempotencyKey()
+
+	h.inFlightMu.Lock()
+	if inFlight, ok := h.inFlight[key]; ok {
+		h.inFlightMu.Unlock()
+		select {
+		case <-inFlight.done:
+			return inFlight.err
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	current := &call{done: make(chan struct{})}
+	h.inFlight[key] = current
+	h.inFlightMu.Unlock()
+
+	current.err = h.handle(ctx, cmd, key)
+
+	h.inFlightMu.Lock()
+	delete(h.inFlight, key)
+	h.inFlightMu.Unlock()
+	close(current.done)
+
+	return current.err
+}
+
+// handle handles a command if its key could be reserved.
+func (h *CommandHandler) handle(ctx context.Context, cmd eh.Command, key string) error {
+	reserved, done, err := h.store.Reserve(ctx, key, h.ttl)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrCouldNotReserveKey, err)
+	}
+	if !reserved {
+		if done {
+			return nil
+		}
+		return ErrCommandInProgress
+	}
+
+	if err := h.CommandHandler.HandleCommand(ctx, cmd); err != nil {
+		if storeErr := h.store.Release(ctx, key); storeErr != nil {
+			h.logger.Error("dedup: could not release key",
+				"command_type", cmd.CommandType(),
+				"error", storeErr,
+			)
+		}
+		return err
+	}
+
+	if err := h.store.Complete(ctx, key, h.ttl); err != nil {
+		h.logger.Error("dedup: could not complete key",
+			"command_type", cmd.CommandType(),
+			"error", err,
+		)
+	}
+
+	return nil
+}
@@ -0,0 +1,212 @@
+// Copyright (c) 2016 - Max Ekman <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dedup
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	eh "github.com/looplab/eventhorizon"
+	"github.com/looplab/eventhorizon/mocks"
+)
+
+func TestCommandHandler(t *testing.T) {
+	store := NewMemoryStore()
+	handler := &countingHandler{}
+	h := eh.UseCommandHandlerMiddleware(handler, NewMiddleware(store, time.Minute))
+	ctx := context.Background()
+
+	t.Log("handle a command")
+	cmd := idempotentCommand{mocks.Command{ID: eh.NewUUID(), Content: "cmd"}, "key"}
+	if err := h.HandleCommand(ctx, cmd); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if handler.count() != 1 {
+		t.Error("the command should be handled:", handler.count())
+	}
+
+	t.Log("handle a duplicate command")
+	if err := h.HandleCommand(ctx, cmd); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if handler.count() != 1 {
+		t.Error("the duplicate should not be handled:", handler.count())
+	}
+
+	t.Log("handle a command with the same key in another namespace")
+	if err := h.HandleCommand(eh.WithNamespace(ctx, "ns"), cmd); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if handler.count() != 2 {
+		t.Error("the command should be handled:", handler.count())
+	}
+
+	t.Log("handle commands without keys")
+	for _, c := range []eh.Command{cmd.Command, idempotentCommand{cmd.Command, ""}} {
+		if err := h.HandleCommand(ctx, c); err != nil {
+			t.Error("there should be no error:", err)
+		}
+	}
+	if handler.count() != 4 {
+		t.Error("the commands should always be handled:", handler.count())
+	}
+
+	t.Log("handle a duplicate after the TTL")
+	store.now = func() time.Time { return time.Now().Add(2 * time.Minute) }
+	if err := h.HandleCommand(ctx, cmd); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if handler.count() != 5 {
+		t.Error("the command should be handled again:", handler.count())
+	}
+	store.now = time.Now
+
+	t.Log("retry a failed command")
+	handlerErr := errors.New("handler error")
+	handler.err = handlerErr
+	failed := idempotentCommand{mocks.Command{ID: eh.NewUUID(), Content: "cmd"}, "failed"}
+	if err := h.HandleCommand(ctx, failed); err != handlerErr {
+		t.Error("there should be a handler error:", err)
+	}
+	handler.err = nil
+	if err := h.HandleCommand(ctx, failed); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if handler.count() != 7 {
+		t.Error("the failed command should be handled again:", handler.count())
+	}
+}
+
+func TestCommandHandlerConcurrentDuplicates(t *testing.T) {
+	handler := &countingHandler{block: make(chan struct{})}
+	h := NewCommandHandler(handler, NewMemoryStore(), time.Minute)
+	cmd := idempotentCommand{mocks.Command{ID: eh.NewUUID(), Content: "cmd"}, "key"}
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 10)
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs <- h.HandleCommand(context.Background(), cmd)
+		}()
+	}
+	time.Sleep(10 * time.Millisecond)
+	close(handler.block)
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		if err != nil {
+			t.Error("there should be no error:", err)
+		}
+	}
+	if handler.count() != 1 {
+		t.Error("the command should be handled once:", handler.count())
+	}
+
+	t.Log("handle a duplicate while handled by another process")
+	store := NewMemoryStore()
+	blocking := &countingHandler{block: make(chan struct{}), started: make(chan struct{})}
+	h1 := NewCommandHandler(blocking, store, time.Minute)
+	h2 := NewCommandHandler(&countingHandler{}, store, time.Minute)
+	done := make(chan error)
+	go func() { done <- h1.HandleCommand(context.Background(), cmd) }()
+	<-blocking.started
+	err := h2.HandleCommand(context.Background(), cmd)
+	if !errors.Is(err, ErrCommandInProgress) {
+		t.Error("there should be a command in progress error:", err)
+	}
+	close(blocking.block)
+	if err := <-done; err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if err := h2.HandleCommand(context.Background(), cmd); err != nil {
+		t.Error("there should be no error:", err)
+	}
+}
+
+func TestCommandHandlerStoreError(t *testing.T) {
+	storeErr := errors.New("store error")
+	handler := &countingHandler{}
+	h := NewCommandHandler(handler, &failingStore{storeErr}, time.Minute)
+	cmd := idempotentCommand{mocks.Command{ID: eh.NewUUID(), Content: "cmd"}, "key"}
+
+	err := h.HandleCommand(context.Background(), cmd)
+	if !errors.Is(err, ErrCouldNotReserveKey) || !errors.Is(err, storeErr) {
+		t.Error("there should be a could not reserve key error:", err)
+	}
+	if handler.count() != 0 {
+		t.Error("the command should not be handled:", handler.count())
+	}
+}
+
+type idempotentCommand struct {
+	mocks.Command
+	key string
+}
+
+func (c idempotentCommand) IdempotencyKey() string {
+	return c.key
+}
+
+// countingHandler counts the handled commands, optionally closing started
+// and waiting for block to be closed before handling them.
+type countingHandler struct {
+	mu      sync.Mutex
+	n       int
+	err     error
+	started chan struct{}
+	block   chan struct{}
+}
+
+func (h *countingHandler) HandleCommand(ctx context.Context, cmd eh.Command) error {
+	if h.started != nil {
+		close(h.started)
+	}
+	if h.block != nil {
+		<-h.block
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.n++
+	return h.err
+}
+
+func (h *countingHandler) count() int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.n
+}
+
+type failingStore struct {
+	err error
+}
+
+func (s *failingStore) Reserve(ctx context.Context, key string, ttl time.Duration) (bool, bool, error) {
+	return false, false, s.err
+}
+
+func (s *failingStore) Complete(ctx context.Context, key string, ttl time.Duration) error {
+	return s.err
+}
+
+func (s *failingStore) Release(ctx context.Context, key string) error {
+	return s.err
+}
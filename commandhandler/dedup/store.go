@@ -0,0 +1,83 @@
+// Copyright (c) 2016 - Max Ekman <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dedup
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// MemoryStore is a Store that keeps the keys in memory, for commands that are
+// handled by a single process.
+type MemoryStore struct {
+	keys map[string]memoryKey
+	mu   sync.Mutex
+	now  func() time.Time
+}
+
+type memoryKey struct {
+	done    bool
+	expires time.Time
+}
+
+// NewMemoryStore creates a new MemoryStore.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		keys: map[string]memoryKey{},
+		now:  time.Now,
+	}
+}
+
+// Reserve implements the Reserve method of the Store interface. Expired keys
+// are removed when reserving.
+func (s *MemoryStore) Reserve(ctx context.Context, key string, ttl time.Duration) (bool, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	for k, r := range s.keys {
+		if !now.Before(r.expires) {
+			delete(s.keys, k)
+		}
+	}
+
+	if r, ok := s.keys[key]; ok {
+		return false, r.done, nil
+	}
+	s.keys[key] = memoryKey{expires: now.Add(ttl)}
+
+	return true, false, nil
+}
+
+// Complete implements the Complete method of the Store interface.
+func (s *MemoryStore) Complete(ctx context.Context, key string, ttl time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.keys[key] = memoryKey{done: true, expires: s.now().Add(ttl)}
+
+	return nil
+}
+
+// Release implements the Release method of the Store interface.
+func (s *MemoryStore) Release(ctx context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.keys, key)
+
+	return nil
+}
@@ -0,0 +1,79 @@
+// Copyright (c) 2016 - Max Ekman <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package grpc
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+
+	eh "github.com/looplab/eventhorizon"
+)
+
+// CommandHandler is a client that sends commands to a Server, implementing
+// the eventhorizon.CommandHandler interface.
+type CommandHandler struct {
+	conn grpc.ClientConnInterface
+}
+
+// NewCommandHandler creates a new CommandHandler that sends the commands on a
+// gRPC connection to the server.
+func NewCommandHandler(conn grpc.ClientConnInterface) *CommandHandler {
+	return &CommandHandler{
+		conn: conn,
+	}
+}
+
+// HandleCommand implements the HandleCommand method of the
+// eventhorizon.CommandHandler interface. It returns when the server has
+// handled the command, with the values of the context that have registered
+// marshalers. Errors from the server handler are returned as the registered
+// error that they match, or ErrCommandFailed, wrapping the gRPC status error
+// with the code and message of the error from the server.
+func (h *CommandHandler) HandleCommand(ctx context.Context, cmd eh.Command) error {
+	data, err := json.Marshal(cmd)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrCouldNotMarshalCommand, err)
+	}
+
+	req := &commandRequest{
+		CommandType: cmd.CommandType(),
+		Command:     data,
+		Context:     eh.MarshalContext(ctx),
+	}
+
+	var trailer metadata.MD
+	if err := h.conn.Invoke(ctx, handleCommandMethod, req, &commandResponse{},
+		grpc.CallContentSubtype(codecName),
+		grpc.Trailer(&trailer),
+	); err != nil {
+		return fmt.Errorf("%w: %w", remoteError(trailer), err)
+	}
+
+	return nil
+}
+
+// remoteError returns the registered error sent by the server, if any.
+func remoteError(trailer metadata.MD) error {
+	if vals := trailer.Get(errorTrailer); len(vals) > 0 {
+		if err := clientError(vals[0]); err != nil {
+			return err
+		}
+	}
+	return ErrCommandFailed
+}
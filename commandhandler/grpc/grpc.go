@@ -0,0 +1,155 @@
+// Copyright (c) 2016 - Max Ekman <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package grpc dispatches commands to a command handler in another service
+// over gRPC. The commands are sent as their type and JSON payload and created
+// on the server with the factories registered with
+// eventhorizon.RegisterCommand, which must be done in both services.
+package grpc
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sync"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/encoding"
+
+	eh "github.com/looplab/eventhorizon"
+)
+
+// ErrUnknownCommandType is when the command type is not registered on the
+// server.
+var ErrUnknownCommandType = errors.New("unknown command type")
+
+// ErrCouldNotMarshalCommand is when a command could not be marshaled into JSON.
+var ErrCouldNotMarshalCommand = errors.New("could not marshal command")
+
+// ErrCouldNotUnmarshalCommand is when a command could not be unmarshaled into
+// its concrete type.
+var ErrCouldNotUnmarshalCommand = errors.New("could not unmarshal command")
+
+// ErrCommandFailed is when a command failed with an error that is not
+// registered with RegisterError, or could not be sent to the server.
+var ErrCommandFailed = errors.New("command failed")
+
+var registeredErrors = []registeredError{
+	{ErrUnknownCommandType, codes.InvalidArgument},
+	{ErrCouldNotUnmarshalCommand, codes.InvalidArgument},
+	{eh.ErrHandlerNotFound, codes.Unimplemented},
+	{eh.ErrAggregateNotFound, codes.NotFound},
+	{eh.ErrIncorrectEventVersion, codes.Aborted},
+	{context.Canceled, codes.Canceled},
+	{context.DeadlineExceeded, codes.DeadlineExceeded},
+}
+var registeredErrorsMu sync.RWMutex
+
+// registeredError is an error that is sent with its own status code.
+type registeredError struct {
+	err  error
+	code codes.Code
+}
+
+// RegisterError registers an error that is returned from the server handler,
+// with the gRPC status code to use for it. The client returns the registered
+// error for errors matching it on the server, found with errors.Is, so that
+// it can be matched in the same way with the client. The errors are matched
+// by their message, which should be unique, and must be registered in both
+// services. The registered errors are matched in order, if the server handler
+// returns an error that matches more than one of them.
+//
+// An example would be:
+//
+//	RegisterError(validate.ErrCommandValidation, codes.InvalidArgument)
+func RegisterError(err error, code codes.Code) {
+	registeredErrorsMu.Lock()
+	defer registeredErrorsMu.Unlock()
+	registeredErrors = append(registeredErrors, registeredError{err, code})
+}
+
+// errorTrailer is the trailer with the message of the registered error that
+// the error returned by the server handler matches.
+const errorTrailer = "eventhorizon-error"
+
+// serverError returns the registered error matching an error from the server
+// handler, and its status code.
+func serverError(err error) (error, codes.Code) {
+	registeredErrorsMu.RLock()
+	defer registeredErrorsMu.RUnlock()
+
+	for _, r := range registeredErrors {
+		if errors.Is(err, r.err) {
+			return r.err, r.code
+		}
+	}
+
+	return nil, codes.Unknown
+}
+
+// clientError returns the registered error with a message from the server,
+// if there is one.
+func clientError(msg string) error {
+	registeredErrorsMu.RLock()
+	defer registeredErrorsMu.RUnlock()
+
+	for _, r := range registeredErrors {
+		if r.err.Error() == msg {
+			return r.err
+		}
+	}
+
+	return nil
+}
+
+const (
+	serviceName         = "eventhorizon.CommandHandler"
+	handleCommandMethod = "/" + serviceName + "/HandleCommand"
+)
+
+// commandRequest is the request to handle a command.
+type commandRequest struct {
+	CommandType eh.CommandType         `json:"command_type"`
+	Command     json.RawMessage        `json:"command"`
+	Context     map[string]interface{} `json:"context,omitempty"`
+}
+
+// commandResponse is the response to a handled command.
+type commandResponse struct{}
+
+// codecName is the name of the JSON codec, used as the content subtype of the
+// requests to not replace the protobuf codec of the server.
+const codecName = "eventhorizon-json"
+
+func init() {
+	encoding.RegisterCodec(codec{})
+}
+
+// codec is a gRPC codec for the messages of the command handler service.
+type codec struct{}
+
+// Marshal implements the Marshal method of the encoding.Codec interface.
+func (codec) Marshal(v interface{}) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+// Unmarshal implements the Unmarshal method of the encoding.Codec interface.
+func (codec) Unmarshal(data []byte, v interface{}) error {
+	return json.Unmarshal(data, v)
+}
+
+// Name implements the Name method of the encoding.Codec interface.
+func (codec) Name() string {
+	return codecName
+}
@@ -0,0 +1,187 @@
+// Copyright (c) 2016 - Max Ekman <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package grpc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+
+	eh "github.com/looplab/eventhorizon"
+	"github.com/looplab/eventhorizon/mocks"
+)
+
+func init() {
+	eh.RegisterCommand(func() eh.Command { return &mocks.Command{} })
+	RegisterError(errCustom, codes.FailedPrecondition)
+}
+
+func TestCommandHandler(t *testing.T) {
+	handler := &commandHandler{}
+	conn, shutdown := runServer(t, handler)
+	defer shutdown()
+	client := NewCommandHandler(conn)
+
+	t.Log("handle a command on the server")
+	ctx := eh.WithNamespace(context.Background(), "ns")
+	cmd := &mocks.Command{
+		ID:      eh.NewUUID(),
+		Content: "command1",
+	}
+	if err := client.HandleCommand(ctx, cmd); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	if !reflect.DeepEqual(handler.command, cmd) {
+		t.Error("the handled command should be correct:", handler.command)
+	}
+	if ns := eh.Namespace(handler.ctx); ns != "ns" {
+		t.Error("the namespace should be sent to the server:", ns)
+	}
+
+	t.Log("unknown command type")
+	err := client.HandleCommand(ctx, &mocks.CommandOther{ID: eh.NewUUID()})
+	if !errors.Is(err, ErrUnknownCommandType) {
+		t.Error("there should be a ErrUnknownCommandType error:", err)
+	}
+	if code := statusCode(err); code != codes.InvalidArgument {
+		t.Error("the status code should be correct:", code)
+	}
+
+	t.Log("registered error from the handler")
+	handler.err = eh.ErrAggregateNotFound
+	err = client.HandleCommand(ctx, cmd)
+	if !errors.Is(err, eh.ErrAggregateNotFound) {
+		t.Error("there should be a ErrAggregateNotFound error:", err)
+	}
+	if code := statusCode(err); code != codes.NotFound {
+		t.Error("the status code should be correct:", code)
+	}
+
+	t.Log("wrapped custom error from the handler")
+	handler.err = fmt.Errorf("could not handle: %w", errCustom)
+	err = client.HandleCommand(ctx, cmd)
+	if !errors.Is(err, errCustom) {
+		t.Error("there should be a custom error:", err)
+	}
+	if code := statusCode(err); code != codes.FailedPrecondition {
+		t.Error("the status code should be correct:", code)
+	}
+
+	t.Log("unregistered error from the handler")
+	handler.err = errors.New("handler error")
+	err = client.HandleCommand(ctx, cmd)
+	if !errors.Is(err, ErrCommandFailed) {
+		t.Error("there should be a ErrCommandFailed error:", err)
+	}
+	if code := statusCode(err); code != codes.Unknown {
+		t.Error("the status code should be correct:", code)
+	}
+	var statusErr interface{ GRPCStatus() *status.Status }
+	if !errors.As(err, &statusErr) || statusErr.GRPCStatus().Message() != "handler error" {
+		t.Error("the error should have the message from the server:", err)
+	}
+}
+
+func TestCommandHandlerUnmarshalError(t *testing.T) {
+	conn, shutdown := runServer(t, &commandHandler{})
+	defer shutdown()
+
+	req := &commandRequest{
+		CommandType: mocks.CommandType,
+		Command:     []byte(`"not a command"`),
+	}
+	err := conn.Invoke(context.Background(), handleCommandMethod, req, &commandResponse{},
+		grpc.CallContentSubtype(codecName))
+	if code := status.Code(err); code != codes.InvalidArgument {
+		t.Error("the status code should be correct:", code, err)
+	}
+}
+
+func TestCommandHandlerDeadline(t *testing.T) {
+	handler := &commandHandler{}
+	conn, shutdown := runServer(t, handler)
+	defer shutdown()
+	client := NewCommandHandler(conn)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	if err := client.HandleCommand(ctx, &mocks.Command{ID: eh.NewUUID()}); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	if _, ok := handler.ctx.Deadline(); !ok {
+		t.Error("the deadline should be sent to the server")
+	}
+}
+
+var errCustom = errors.New("custom error")
+
+// statusCode returns the status code of the wrapped gRPC status error.
+func statusCode(err error) codes.Code {
+	var statusErr interface{ GRPCStatus() *status.Status }
+	if !errors.As(err, &statusErr) {
+		return codes.OK
+	}
+	return statusErr.GRPCStatus().Code()
+}
+
+// commandHandler is a command handler that records the handled command.
+type commandHandler struct {
+	mu      sync.Mutex
+	command eh.Command
+	ctx     context.Context
+	err     error
+}
+
+func (h *commandHandler) HandleCommand(ctx context.Context, cmd eh.Command) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.command = cmd
+	h.ctx = ctx
+	return h.err
+}
+
+// runServer runs a server with a handler on an in memory connection.
+func runServer(t *testing.T, handler eh.CommandHandler) (*grpc.ClientConn, func()) {
+	lis := bufconn.Listen(1024 * 1024)
+	srv := grpc.NewServer()
+	NewServer(handler).Register(srv)
+	go srv.Serve(lis)
+
+	conn, err := grpc.DialContext(context.Background(), "bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return lis.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	if err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+
+	return conn, func() {
+		conn.Close()
+		srv.Stop()
+	}
+}
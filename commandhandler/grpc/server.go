@@ -0,0 +1,116 @@
+// Copyright (c) 2016 - Max Ekman <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package grpc
+
+import (
+	"context"
+	"encoding/json"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	eh "github.com/looplab/eventhorizon"
+)
+
+// Server is a gRPC service that handles the commands from a CommandHandler
+// client with a command handler, for example a command bus.
+type Server struct {
+	handler eh.CommandHandler
+}
+
+// NewServer creates a new Server.
+func NewServer(handler eh.CommandHandler) *Server {
+	return &Server{
+		handler: handler,
+	}
+}
+
+// Register registers the command handler service with a gRPC server.
+func (s *Server) Register(srv *grpc.Server) {
+	srv.RegisterService(&serviceDesc, s)
+}
+
+// handleCommand creates the command from the request and handles it, with the
+// context values sent by the client. Errors are returned with the status code
+// of the registered error they match, which is also sent in a trailer.
+func (s *Server) handleCommand(ctx context.Context, req *commandRequest) (*commandResponse, error) {
+	cmd, err := eh.CreateCommand(req.CommandType)
+	if err != nil {
+		return nil, s.error(ctx, ErrUnknownCommandType)
+	}
+
+	if len(req.Command) > 0 {
+		if err := json.Unmarshal(req.Command, cmd); err != nil {
+			return nil, s.error(ctx, ErrCouldNotUnmarshalCommand)
+		}
+	}
+
+	ctx = eh.UnmarshalContextWithParent(ctx, req.Context)
+	if err := s.handler.HandleCommand(ctx, cmd); err != nil {
+		return nil, s.error(ctx, err)
+	}
+
+	return &commandResponse{}, nil
+}
+
+// error returns a status error for an error from the server handler.
+func (s *Server) error(ctx context.Context, err error) error {
+	registered, code := serverError(err)
+	if registered != nil {
+		// Ignore the error, the client uses ErrCommandFailed without it.
+		_ = grpc.SetTrailer(ctx, metadata.Pairs(errorTrailer, registered.Error()))
+	}
+
+	return status.Error(code, err.Error())
+}
+
+// commandHandlerServer is the interface of the service implementation.
+type commandHandlerServer interface {
+	handleCommand(context.Context, *commandRequest) (*commandResponse, error)
+}
+
+var serviceDesc = grpc.ServiceDesc{
+	ServiceName: serviceName,
+	HandlerType: (*commandHandlerServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "HandleCommand",
+			Handler:    handleCommandHandler,
+		},
+	},
+	Streams: []grpc.StreamDesc{},
+}
+
+func handleCommandHandler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	req := &commandRequest{}
+	if err := dec(req); err != nil {
+		return nil, err
+	}
+
+	if interceptor == nil {
+		return srv.(commandHandlerServer).handleCommand(ctx, req)
+	}
+
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: handleCommandMethod,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(commandHandlerServer).handleCommand(ctx, req.(*commandRequest))
+	}
+
+	return interceptor(ctx, req, info, handler)
+}
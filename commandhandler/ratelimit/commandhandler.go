@@ -0,0 +1,191 @@
+// Copyright (c) 2016 - Max Ekman <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	eh "github.com/looplab/eventhorizon"
+)
+
+// ErrRateLimited is when a command is not handled because the rate limit has
+// been reached.
+var ErrRateLimited = errors.New("rate limited")
+
+// KeyFunc returns the key that a command is limited by, for example the
+// tenant of the command. Commands with the same key share a limit.
+type KeyFunc func(context.Context, eh.Command) string
+
+// NamespaceKey limits the commands of each namespace separately.
+func NamespaceKey(ctx context.Context, cmd eh.Command) string {
+	return eh.Namespace(ctx)
+}
+
+// Option is an option setter used to configure the middleware.
+type Option func(*CommandHandler)
+
+// WithKey limits the commands by a key instead of sharing one limit for all
+// commands.
+func WithKey(key KeyFunc) Option {
+	return func(h *CommandHandler) {
+		h.key = key
+	}
+}
+
+// WithClock uses a clock to refill the limits, instead of time.Now.
+func WithClock(clock eh.Clock) Option {
+	return func(h *CommandHandler) {
+		if clock == nil {
+			clock = time.Now
+		}
+		h.now = clock
+	}
+}
+
+// NewMiddleware returns a middleware that limits the rate of commands, with a
+// number of commands per second and a burst of commands above the rate.
+func NewMiddleware(perSecond float64, burst int, opts ...Option) eh.CommandHandlerMiddleware {
+	return func(h eh.CommandHandler) eh.CommandHandler {
+		return NewCommandHandler(h, perSecond, burst, opts...)
+	}
+}
+
+// CommandHandler is a middleware that limits the rate of commands with a token
+// bucket for each key. A bucket holds up to burst tokens and is refilled with
+// the rate per second; every command takes a token, and is rejected without
+// being handled when the bucket is empty. Rejected commands do not take any
+// tokens. The buckets of keys that have not been used until they are full are
+// removed.
+type CommandHandler struct {
+	eh.CommandHandler
+	rate  float64
+	burst float64
+	key   KeyFunc
+	now   eh.Clock
+
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	lastPrune time.Time
+}
+
+// bucket is the tokens of a key at the last time it was updated.
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// NewCommandHandler creates a new CommandHandler. A burst of 1 or less allows
+// one command at a time, and a rate of 0 or less does not refill the buckets.
+func NewCommandHandler(handler eh.CommandHandler, perSecond float64, burst int, opts ...Option) *CommandHandler {
+	if burst < 1 {
+		burst = 1
+	}
+	if perSecond < 0 {
+		perSecond = 0
+	}
+
+	h := &CommandHandler{
+		CommandHandler: handler,
+		rate:           perSecond,
+		burst:          float64(burst),
+		now:            time.Now,
+		buckets:        map[string]*bucket{},
+	}
+
+	for _, opt := range opts {
+		opt(h)
+	}
+
+	return h
+}
+
+// HandleCommand implements the HandleCommand method of the
+// eventhorizon.CommandHandler interface. It returns ErrRateLimited, with
+// the key of the limit, if the limit of the command has been reached.
+func (h *CommandHandler) HandleCommand(ctx context.Context, cmd eh.Command) error {
+	key := ""
+	if h.key != nil {
+		key = h.key(ctx, cmd)
+	}
+
+	if !h.take(key) {
+		if key == "" {
+			return ErrRateLimited
+		}
+		return fmt.Errorf("%w: %s", ErrRateLimited, key)
+	}
+
+	return h.CommandHandler.HandleCommand(ctx, cmd)
+}
+
+// take takes a token from the bucket of the key, returning false if it is
+// empty.
+func (h *CommandHandler) take(key string) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	now := h.now()
+	h.prune(now)
+
+	b, ok := h.buckets[key]
+	if !ok {
+		b = &bucket{tokens: h.burst, last: now}
+		h.buckets[key] = b
+	}
+	b.tokens = h.refill(b, now)
+	b.last = now
+
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+
+	return true
+}
+
+// refill returns the tokens of a bucket refilled until now.
+func (h *CommandHandler) refill(b *bucket, now time.Time) float64 {
+	tokens := b.tokens
+	if elapsed := now.Sub(b.last); elapsed > 0 {
+		tokens += elapsed.Seconds() * h.rate
+	}
+	if tokens > h.burst {
+		tokens = h.burst
+	}
+	return tokens
+}
+
+// prune removes the buckets that are full, as they are the same as new
+// buckets. It runs at most once for the time it takes to fill a bucket.
+func (h *CommandHandler) prune(now time.Time) {
+	if h.rate == 0 {
+		return
+	}
+	fill := time.Duration(h.burst / h.rate * float64(time.Second))
+	if now.Sub(h.lastPrune) < fill {
+		return
+	}
+	h.lastPrune = now
+
+	for key, b := range h.buckets {
+		if h.refill(b, now) >= h.burst {
+			delete(h.buckets, key)
+		}
+	}
+}
@@ -0,0 +1,141 @@
+// Copyright (c) 2016 - Max Ekman <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	eh "github.com/looplab/eventhorizon"
+	"github.com/looplab/eventhorizon/mocks"
+)
+
+func TestCommandHandler(t *testing.T) {
+	handler := &mocks.CommandHandler{}
+	now := time.Date(2020, time.January, 1, 12, 0, 0, 0, time.UTC)
+	h := eh.UseCommandHandlerMiddleware(handler, NewMiddleware(2, 3,
+		WithClock(func() time.Time { return now }),
+	))
+	ctx := context.Background()
+	cmd := mocks.Command{eh.NewUUID(), "cmd"}
+
+	t.Log("handle a burst of commands")
+	for i := 0; i < 3; i++ {
+		handler.Command = nil
+		if err := h.HandleCommand(ctx, cmd); err != nil {
+			t.Error("there should be no error:", err)
+		}
+		if handler.Command != cmd {
+			t.Error("the command should be handled:", handler.Command)
+		}
+	}
+
+	t.Log("reject commands over the rate")
+	handler.Command = nil
+	err := h.HandleCommand(ctx, cmd)
+	if !errors.Is(err, ErrRateLimited) {
+		t.Error("there should be a ErrRateLimited error:", err)
+	}
+	if err.Error() != "rate limited" {
+		t.Error("the error message should be correct:", err.Error())
+	}
+	if handler.Command != nil {
+		t.Error("the command should not be handled:", handler.Command)
+	}
+
+	t.Log("handle commands when the bucket is refilled")
+	now = now.Add(500 * time.Millisecond)
+	if err := h.HandleCommand(ctx, cmd); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if err := h.HandleCommand(ctx, cmd); !errors.Is(err, ErrRateLimited) {
+		t.Error("there should be a ErrRateLimited error:", err)
+	}
+
+	t.Log("refill the bucket up to the burst")
+	now = now.Add(time.Minute)
+	for i := 0; i < 3; i++ {
+		if err := h.HandleCommand(ctx, cmd); err != nil {
+			t.Error("there should be no error:", err)
+		}
+	}
+	if err := h.HandleCommand(ctx, cmd); !errors.Is(err, ErrRateLimited) {
+		t.Error("there should be a ErrRateLimited error:", err)
+	}
+}
+
+func TestCommandHandlerKey(t *testing.T) {
+	handler := &mocks.CommandHandler{}
+	now := time.Date(2020, time.January, 1, 12, 0, 0, 0, time.UTC)
+	h := NewCommandHandler(handler, 1, 1,
+		WithKey(NamespaceKey),
+		WithClock(func() time.Time { return now }),
+	)
+	ctx1 := eh.WithNamespace(context.Background(), "tenant1")
+	ctx2 := eh.WithNamespace(context.Background(), "tenant2")
+	cmd := mocks.Command{eh.NewUUID(), "cmd"}
+
+	t.Log("limit the commands of each key separately")
+	if err := h.HandleCommand(ctx1, cmd); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	err := h.HandleCommand(ctx1, cmd)
+	if !errors.Is(err, ErrRateLimited) {
+		t.Error("there should be a ErrRateLimited error:", err)
+	}
+	if err.Error() != "rate limited: tenant1" {
+		t.Error("the error message should be correct:", err.Error())
+	}
+	if err := h.HandleCommand(ctx2, cmd); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if len(h.buckets) != 2 {
+		t.Error("there should be a bucket for each key:", h.buckets)
+	}
+
+	t.Log("remove the buckets that are full")
+	now = now.Add(time.Second)
+	if err := h.HandleCommand(ctx1, cmd); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if _, ok := h.buckets["tenant2"]; ok || len(h.buckets) != 1 {
+		t.Error("the full bucket should be removed:", h.buckets)
+	}
+	if err := h.HandleCommand(ctx2, cmd); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if err := h.HandleCommand(ctx2, cmd); !errors.Is(err, ErrRateLimited) {
+		t.Error("there should be a ErrRateLimited error:", err)
+	}
+}
+
+func TestCommandHandlerNoRate(t *testing.T) {
+	handler := &mocks.CommandHandler{}
+	now := time.Date(2020, time.January, 1, 12, 0, 0, 0, time.UTC)
+	h := NewCommandHandler(handler, 0, 0, WithClock(func() time.Time { return now }))
+	ctx := context.Background()
+	cmd := mocks.Command{eh.NewUUID(), "cmd"}
+
+	t.Log("handle one command without refilling")
+	if err := h.HandleCommand(ctx, cmd); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	now = now.Add(time.Hour)
+	if err := h.HandleCommand(ctx, cmd); !errors.Is(err, ErrRateLimited) {
+		t.Error("there should be a ErrRateLimited error:", err)
+	}
+}
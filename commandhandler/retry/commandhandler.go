@@ -0,0 +1,128 @@
+// Copyright (c) 2016 - Max Ekman <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package retry
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/jpillora/backoff"
+	eh "github.com/looplab/eventhorizon"
+)
+
+// Option is an option setter used to configure the middleware.
+type Option func(*CommandHandler)
+
+// WithBackoff waits between the attempts, starting with min and increasing
+// exponentially up to max.
+func WithBackoff(min, max time.Duration) Option {
+	return func(h *CommandHandler) {
+		h.minBackoff = min
+		h.maxBackoff = max
+	}
+}
+
+// WithLogger logs the retried commands with a logger.
+func WithLogger(logger eh.Logger) Option {
+	return func(h *CommandHandler) {
+		if logger == nil {
+			logger = eh.NopLogger{}
+		}
+		h.logger = logger
+	}
+}
+
+// NewMiddleware returns a middleware that retries commands that fail because
+// the aggregate was changed concurrently, up to a number of attempts in total.
+func NewMiddleware(attempts int, opts ...Option) eh.CommandHandlerMiddleware {
+	return func(h eh.CommandHandler) eh.CommandHandler {
+		return NewCommandHandler(h, attempts, opts...)
+	}
+}
+
+// CommandHandler is a middleware that retries commands that fail with an
+// eventhorizon.ErrIncorrectEventVersion from the event store. As the wrapped
+// handler loads the aggregate for every command the retried command is
+// handled with the latest version of the aggregate.
+type CommandHandler struct {
+	eh.CommandHandler
+	attempts   int
+	minBackoff time.Duration
+	maxBackoff time.Duration
+	logger     eh.Logger
+}
+
+// NewCommandHandler creates a new CommandHandler.
+func NewCommandHandler(handler eh.CommandHandler, attempts int, opts ...Option) *CommandHandler {
+	if attempts < 1 {
+		attempts = 1
+	}
+
+	h := &CommandHandler{
+		CommandHandler: handler,
+		attempts:       attempts,
+		logger:         eh.NopLogger{},
+	}
+
+	for _, opt := range opts {
+		opt(h)
+	}
+
+	return h
+}
+
+// HandleCommand implements the HandleCommand method of the
+// eventhorizon.CommandHandler interface. The error from the last attempt is
+// returned if all attempts fail.
+func (h *CommandHandler) HandleCommand(ctx context.Context, cmd eh.Command) error {
+	delay := &backoff.Backoff{
+		Min: h.minBackoff,
+		Max: h.maxBackoff,
+	}
+
+	var err error
+	for i := 0; i < h.attempts; i++ {
+		// Wait before retrying, if there is a backoff.
+		if i > 0 && h.maxBackoff > 0 {
+			select {
+			case <-time.After(delay.Duration()):
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+
+		err = h.CommandHandler.HandleCommand(ctx, cmd)
+		if !isConcurrencyError(err) {
+			return err
+		}
+
+		if i < h.attempts-1 {
+			h.logger.Info("retry: retrying command",
+				"command_type", cmd.CommandType(),
+				"attempt", i+2,
+				"error", err,
+			)
+		}
+	}
+
+	return err
+}
+
+// isConcurrencyError checks if the error is from a concurrent change of the
+// aggregate.
+func isConcurrencyError(err error) bool {
+	return errors.Is(err, eh.ErrIncorrectEventVersion)
+}
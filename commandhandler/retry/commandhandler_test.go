@@ -0,0 +1,181 @@
+// Copyright (c) 2016 - Max Ekman <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package retry
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	eh "github.com/looplab/eventhorizon"
+	"github.com/looplab/eventhorizon/mocks"
+)
+
+func TestCommandHandler(t *testing.T) {
+	t.Log("succeed after failing saves")
+	store := &failingEventStore{failures: 2}
+	handler, calls := newHandler(store)
+	h := eh.UseCommandHandlerMiddleware(handler, NewMiddleware(3))
+	if err := h.HandleCommand(context.Background(), mocks.Command{eh.NewUUID(), "cmd"}); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if *calls != 3 {
+		t.Error("the command should be handled 3 times:", *calls)
+	}
+	if len(store.Events) != 1 {
+		t.Error("the event should be saved:", store.Events)
+	}
+
+	t.Log("give up after all attempts")
+	store = &failingEventStore{failures: 5}
+	handler, calls = newHandler(store)
+	h = eh.UseCommandHandlerMiddleware(handler, NewMiddleware(3))
+	err := h.HandleCommand(context.Background(), mocks.Command{eh.NewUUID(), "cmd"})
+	if esErr, ok := err.(eh.EventStoreError); !ok || esErr.Err != eh.ErrIncorrectEventVersion {
+		t.Error("there should be a ErrIncorrectEventVersion error:", err)
+	}
+	if *calls != 3 {
+		t.Error("the command should be handled 3 times:", *calls)
+	}
+	if len(store.Events) != 0 {
+		t.Error("there should be no saved events:", store.Events)
+	}
+
+	t.Log("retry wrapped version conflicts")
+	store = &failingEventStore{failures: 1}
+	handler, calls = newHandler(store)
+	wrapped := eh.CommandHandlerFunc(func(ctx context.Context, cmd eh.Command) error {
+		if err := handler.HandleCommand(ctx, cmd); err != nil {
+			return fmt.Errorf("could not handle command: %w", err)
+		}
+		return nil
+	})
+	h = eh.UseCommandHandlerMiddleware(wrapped, NewMiddleware(3))
+	if err := h.HandleCommand(context.Background(), mocks.Command{eh.NewUUID(), "cmd"}); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if *calls != 2 {
+		t.Error("the command should be handled 2 times:", *calls)
+	}
+
+	t.Log("don't retry other errors")
+	otherErr := errors.New("other error")
+	store = &failingEventStore{EventStore: mocks.EventStore{Err: otherErr}}
+	handler, calls = newHandler(store)
+	h = eh.UseCommandHandlerMiddleware(handler, NewMiddleware(3))
+	if err := h.HandleCommand(context.Background(), mocks.Command{eh.NewUUID(), "cmd"}); err != otherErr {
+		t.Error("there should be an other error:", err)
+	}
+	if *calls != 1 {
+		t.Error("the command should be handled once:", *calls)
+	}
+
+	t.Log("at least one attempt")
+	store = &failingEventStore{}
+	handler, calls = newHandler(store)
+	h = eh.UseCommandHandlerMiddleware(handler, NewMiddleware(0))
+	if err := h.HandleCommand(context.Background(), mocks.Command{eh.NewUUID(), "cmd"}); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if *calls != 1 {
+		t.Error("the command should be handled once:", *calls)
+	}
+}
+
+func TestCommandHandlerLogger(t *testing.T) {
+	logger := &mocks.Logger{}
+	store := &failingEventStore{failures: 2}
+	handler, _ := newHandler(store)
+	h := eh.UseCommandHandlerMiddleware(handler, NewMiddleware(3, WithLogger(logger)))
+	if err := h.HandleCommand(context.Background(), mocks.Command{eh.NewUUID(), "cmd"}); err != nil {
+		t.Error("there should be no error:", err)
+	}
+
+	entries := logger.Find("info", "retry: retrying command")
+	if len(entries) != 2 {
+		t.Fatal("the retries should be logged:", logger.Entries)
+	}
+	for i, e := range entries {
+		if e.Fields["command_type"] != mocks.CommandType || e.Fields["attempt"] != i+2 {
+			t.Error("the fields should be correct:", e.Fields)
+		}
+	}
+}
+
+func TestCommandHandlerBackoff(t *testing.T) {
+	t.Log("wait between attempts")
+	store := &failingEventStore{failures: 2}
+	handler, calls := newHandler(store)
+	h := eh.UseCommandHandlerMiddleware(handler,
+		NewMiddleware(3, WithBackoff(10*time.Millisecond, 10*time.Millisecond)),
+	)
+	start := time.Now()
+	if err := h.HandleCommand(context.Background(), mocks.Command{eh.NewUUID(), "cmd"}); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if *calls != 3 {
+		t.Error("the command should be handled 3 times:", *calls)
+	}
+	if elapsed := time.Since(start); elapsed < 20*time.Millisecond {
+		t.Error("there should be a backoff between attempts:", elapsed)
+	}
+
+	t.Log("stop waiting when the context is done")
+	store = &failingEventStore{failures: 5}
+	handler, calls = newHandler(store)
+	h = eh.UseCommandHandlerMiddleware(handler,
+		NewMiddleware(3, WithBackoff(time.Second, time.Second)),
+	)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := h.HandleCommand(ctx, mocks.Command{eh.NewUUID(), "cmd"}); err != context.DeadlineExceeded {
+		t.Error("there should be a DeadlineExceeded error:", err)
+	}
+	if *calls != 1 {
+		t.Error("the command should be handled once:", *calls)
+	}
+}
+
+// newHandler creates a command handler that saves an event for every command,
+// and a counter for the handled commands.
+func newHandler(store eh.EventStore) (eh.CommandHandler, *int) {
+	calls := 0
+	return eh.CommandHandlerFunc(func(ctx context.Context, cmd eh.Command) error {
+		calls++
+		agg := mocks.NewAggregate(cmd.AggregateID())
+		event := agg.NewEvent(mocks.EventType, &mocks.EventData{"event"})
+		return store.Save(ctx, []eh.Event{event}, 0)
+	}), &calls
+}
+
+// failingEventStore is an event store that fails the first saves with a
+// version conflict.
+type failingEventStore struct {
+	mocks.EventStore
+	failures int
+}
+
+func (s *failingEventStore) Save(ctx context.Context, events []eh.Event, originalVersion int) error {
+	if s.failures > 0 {
+		s.failures--
+		return eh.EventStoreError{
+			Err:       eh.ErrIncorrectEventVersion,
+			Namespace: eh.Namespace(ctx),
+		}
+	}
+	return s.EventStore.Save(ctx, events, originalVersion)
+}
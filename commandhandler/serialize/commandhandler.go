@@ -0,0 +1,141 @@
+// Copyright (c) 2016 - Max Ekman <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package serialize
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	eh "github.com/looplab/eventhorizon"
+)
+
+// ErrCouldNotLock is when the distributed lock for an aggregate could not be
+// acquired.
+var ErrCouldNotLock = errors.New("could not lock aggregate")
+
+// DistributedLocker is a lock shared by many processes, used to serialize the
+// commands for an aggregate across all of them.
+type DistributedLocker interface {
+	// Lock acquires the lock for a key, waiting until it is free or the
+	// context is done. The returned func releases the lock. Locks should
+	// expire if they are not released, to not block the other processes
+	// forever if the process holding the lock crashes.
+	Lock(ctx context.Context, key string) (unlock func(), err error)
+}
+
+// Option is an option setter used to configure the middleware.
+type Option func(*CommandHandler)
+
+// WithDistributedLocker also locks each aggregate with a distributed lock, to
+// serialize the commands for the aggregate across processes. The key of the
+// lock is the namespace, the aggregate type and the aggregate ID.
+func WithDistributedLocker(locker DistributedLocker) Option {
+	return func(h *CommandHandler) {
+		h.locker = locker
+	}
+}
+
+// NewMiddleware returns a middleware that handles one command at a time for
+// each aggregate.
+func NewMiddleware(opts ...Option) eh.CommandHandlerMiddleware {
+	return func(h eh.CommandHandler) eh.CommandHandler {
+		return NewCommandHandler(h, opts...)
+	}
+}
+
+// CommandHandler is a middleware that serializes the commands for the same
+// aggregate ID, to avoid version conflicts when they are handled concurrently.
+// Commands for different aggregates are still handled in parallel. The locks
+// are local to the handler, so commands handled by other processes can still
+// conflict unless a DistributedLocker is used.
+type CommandHandler struct {
+	eh.CommandHandler
+	locks   map[eh.UUID]*aggregateLock
+	locksMu sync.Mutex
+	locker  DistributedLocker
+}
+
+// aggregateLock is the lock for an aggregate, with the number of commands that
+// hold or wait for it.
+type aggregateLock struct {
+	sync.Mutex
+	refs int
+}
+
+// NewCommandHandler creates a new CommandHandler.
+func NewCommandHandler(handler eh.CommandHandler, opts ...Option) *CommandHandler {
+	h := &CommandHandler{
+		CommandHandler: handler,
+		locks:          map[eh.UUID]*aggregateLock{},
+	}
+
+	for _, opt := range opts {
+		opt(h)
+	}
+
+	return h
+}
+
+// HandleCommand implements the HandleCommand method of the
+// eventhorizon.CommandHandler interface. It waits for the commands for the
+// same aggregate to be handled first. The locks are released also if the
+// wrapped handler fails or panics.
+func (h *CommandHandler) HandleCommand(ctx context.Context, cmd eh.Command) error {
+	id := cmd.AggregateID()
+	h.lock(id)
+	defer h.unlock(id)
+
+	// Take the distributed lock after the local one, to only have one command
+	// per process waiting for it.
+	if h.locker != nil {
+		key := eh.Namespace(ctx) + ":" + string(cmd.AggregateType()) + ":" + id.String()
+		unlock, err := h.locker.Lock(ctx, key)
+		if err != nil {
+			return fmt.Errorf("%w: %w", ErrCouldNotLock, err)
+		}
+		defer unlock()
+	}
+
+	return h.CommandHandler.HandleCommand(ctx, cmd)
+}
+
+func (h *CommandHandler) lock(id eh.UUID) {
+	h.locksMu.Lock()
+	l, ok := h.locks[id]
+	if !ok {
+		l = &aggregateLock{}
+		h.locks[id] = l
+	}
+	l.refs++
+	h.locksMu.Unlock()
+
+	l.Lock()
+}
+
+// unlock releases the lock for an aggregate, and removes it if no other
+// command is waiting for it.
+func (h *CommandHandler) unlock(id eh.UUID) {
+	h.locksMu.Lock()
+	defer h.locksMu.Unlock()
+
+	l := h.locks[id]
+	l.Unlock()
+	l.refs--
+	if l.refs == 0 {
+		delete(h.locks, id)
+	}
+}
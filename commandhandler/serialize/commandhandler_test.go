@@ -0,0 +1,239 @@
+// Copyright (c) 2016 - Max Ekman <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package serialize
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	eh "github.com/looplab/eventhorizon"
+	"github.com/looplab/eventhorizon/eventstore/memory"
+	"github.com/looplab/eventhorizon/mocks"
+)
+
+func TestCommandHandler(t *testing.T) {
+	store := memory.NewEventStore()
+	h := eh.UseCommandHandlerMiddleware(newHandler(store), NewMiddleware())
+
+	t.Log("handle concurrent commands for the same aggregate")
+	id := eh.NewUUID()
+	const n = 50
+	errs := make(chan error, n)
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs <- h.HandleCommand(context.Background(), mocks.Command{id, "cmd"})
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Error("there should be no version conflict:", err)
+		}
+	}
+
+	events, err := store.Load(context.Background(), mocks.AggregateType, id)
+	if err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if len(events) != n {
+		t.Error("there should be an event for every command:", len(events))
+	}
+	for i, event := range events {
+		if event.Version() != i+1 {
+			t.Error("the event version should be correct:", event.Version())
+		}
+	}
+
+	if len(h.(*CommandHandler).locks) != 0 {
+		t.Error("there should be no locks left:", h.(*CommandHandler).locks)
+	}
+}
+
+func TestCommandHandlerOtherAggregates(t *testing.T) {
+	blocked := eh.NewUUID()
+	release := make(chan struct{})
+	started := make(chan struct{})
+	h := NewCommandHandler(eh.CommandHandlerFunc(func(ctx context.Context, cmd eh.Command) error {
+		if cmd.AggregateID() == blocked {
+			close(started)
+			<-release
+		}
+		return nil
+	}))
+
+	done := make(chan error, 1)
+	go func() {
+		done <- h.HandleCommand(context.Background(), mocks.Command{blocked, "cmd"})
+	}()
+	<-started
+
+	t.Log("handle a command for another aggregate in parallel")
+	if err := handleWithTimeout(h, mocks.Command{eh.NewUUID(), "cmd"}); err != nil {
+		t.Error("there should be no error:", err)
+	}
+
+	close(release)
+	if err := <-done; err != nil {
+		t.Error("there should be no error:", err)
+	}
+}
+
+func TestCommandHandlerPanic(t *testing.T) {
+	id := eh.NewUUID()
+	panicking := true
+	h := NewCommandHandler(eh.CommandHandlerFunc(func(ctx context.Context, cmd eh.Command) error {
+		if panicking {
+			panic("handler panic")
+		}
+		return nil
+	}))
+
+	t.Log("release the lock when the handler panics")
+	func() {
+		defer func() {
+			if r := recover(); r != "handler panic" {
+				t.Error("the panic should be passed on:", r)
+			}
+		}()
+		h.HandleCommand(context.Background(), mocks.Command{id, "cmd"})
+	}()
+
+	panicking = false
+	if err := handleWithTimeout(h, mocks.Command{id, "cmd"}); err != nil {
+		t.Error("there should be no error:", err)
+	}
+}
+
+func TestCommandHandlerDistributedLocker(t *testing.T) {
+	locker := &fakeLocker{}
+	var lockedWhenHandled bool
+	handlerErr := errors.New("handler error")
+	h := NewCommandHandler(eh.CommandHandlerFunc(func(ctx context.Context, cmd eh.Command) error {
+		lockedWhenHandled = locker.held
+		if cmd.(mocks.Command).Content == "fail" {
+			return handlerErr
+		}
+		return nil
+	}), WithDistributedLocker(locker))
+
+	ctx := eh.WithNamespace(context.Background(), "ns")
+	id := eh.NewUUID()
+
+	t.Log("lock the aggregate around the command")
+	if err := h.HandleCommand(ctx, mocks.Command{id, "cmd"}); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if !lockedWhenHandled {
+		t.Error("the lock should be held when handling the command")
+	}
+	if !reflect.DeepEqual(locker.keys, []string{"ns:Aggregate:" + id.String()}) {
+		t.Error("the lock key should be correct:", locker.keys)
+	}
+	if locker.held || locker.unlocks != 1 {
+		t.Error("the lock should be released:", locker.unlocks)
+	}
+
+	t.Log("release the lock when the command fails")
+	if err := h.HandleCommand(ctx, mocks.Command{id, "fail"}); err != handlerErr {
+		t.Error("there should be a handler error:", err)
+	}
+	if locker.held || locker.unlocks != 2 {
+		t.Error("the lock should be released:", locker.unlocks)
+	}
+
+	t.Log("don't handle the command if the lock fails")
+	lockedWhenHandled = false
+	locker.err = errors.New("lock error")
+	err := h.HandleCommand(ctx, mocks.Command{id, "cmd"})
+	if !errors.Is(err, ErrCouldNotLock) || !errors.Is(err, locker.err) {
+		t.Error("there should be a ErrCouldNotLock error:", err)
+	}
+	if err == nil || err.Error() != "could not lock aggregate: lock error" {
+		t.Error("the error message should be correct:", err)
+	}
+	if lockedWhenHandled {
+		t.Error("the command should not be handled")
+	}
+	if len(h.locks) != 0 {
+		t.Error("there should be no local locks left:", h.locks)
+	}
+}
+
+// fakeLocker is a DistributedLocker that records the locks.
+type fakeLocker struct {
+	keys    []string
+	held    bool
+	unlocks int
+	err     error
+}
+
+func (l *fakeLocker) Lock(ctx context.Context, key string) (func(), error) {
+	if l.err != nil {
+		return nil, l.err
+	}
+	l.keys = append(l.keys, key)
+	l.held = true
+	return func() {
+		l.held = false
+		l.unlocks++
+	}, nil
+}
+
+// handleWithTimeout handles a command, failing with a DeadlineExceeded error
+// if it is not handled within a second.
+func handleWithTimeout(h eh.CommandHandler, cmd eh.Command) error {
+	done := make(chan error, 1)
+	go func() {
+		done <- h.HandleCommand(context.Background(), cmd)
+	}()
+
+	select {
+	case err := <-done:
+		return err
+	case <-time.After(time.Second):
+		return context.DeadlineExceeded
+	}
+}
+
+// newHandler creates a command handler that loads the events of the aggregate
+// and saves a new event at the next version, which conflicts with commands
+// handled concurrently.
+func newHandler(store eh.EventStore) eh.CommandHandler {
+	return eh.CommandHandlerFunc(func(ctx context.Context, cmd eh.Command) error {
+		events, err := store.Load(ctx, mocks.AggregateType, cmd.AggregateID())
+		if err != nil {
+			return err
+		}
+
+		agg := mocks.NewAggregate(cmd.AggregateID())
+		for _, event := range events {
+			agg.ApplyEvent(ctx, event)
+		}
+
+		// Give other commands time to load the same version.
+		time.Sleep(time.Millisecond)
+
+		event := agg.NewEvent(mocks.EventType, &mocks.EventData{"event"})
+		return store.Save(ctx, []eh.Event{event}, len(events))
+	})
+}
@@ -0,0 +1,210 @@
+// Copyright (c) 2016 - Max Ekman <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package redis contains a distributed lock using Redis, to serialize the
+// commands for aggregates across processes.
+package redis
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/garyburd/redigo/redis"
+
+	eh "github.com/looplab/eventhorizon"
+)
+
+// DefaultTTL is the default time after which a lock expires if it is not
+// refreshed by the process holding it.
+const DefaultTTL = 30 * time.Second
+
+// DefaultRetryInterval is the default time to wait between attempts to take
+// a lock that is held by another process.
+const DefaultRetryInterval = 50 * time.Millisecond
+
+// The scripts only refresh or release a lock if it is still held with the
+// token, as it could have expired and been taken by another process.
+var (
+	refreshScript = redis.NewScript(1, `
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("PEXPIRE", KEYS[1], ARGV[2])
+end
+return 0`)
+	releaseScript = redis.NewScript(1, `
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("DEL", KEYS[1])
+end
+return 0`)
+)
+
+// Locker is a serialize.DistributedLocker using Redis. The locks expire after
+// a TTL, which is refreshed while the lock is held, so that locks held by a
+// crashed process are released.
+type Locker struct {
+	pool          *redis.Pool
+	prefix        string
+	ttl           time.Duration
+	retryInterval time.Duration
+}
+
+// Option is an option setter used to configure creation.
+type Option func(*Locker) error
+
+// WithTTL sets the time after which a lock expires if it is not refreshed.
+func WithTTL(ttl time.Duration) Option {
+	return func(l *Locker) error {
+		l.ttl = ttl
+		return nil
+	}
+}
+
+// WithRetryInterval sets the time to wait between attempts to take a lock.
+func WithRetryInterval(interval time.Duration) Option {
+	return func(l *Locker) error {
+		l.retryInterval = interval
+		return nil
+	}
+}
+
+// WithPrefix sets a prefix for the keys of the locks, the default is "lock:".
+func WithPrefix(prefix string) Option {
+	return func(l *Locker) error {
+		l.prefix = prefix
+		return nil
+	}
+}
+
+// NewLocker creates a new Locker.
+func NewLocker(server, password string, opts ...Option) (*Locker, error) {
+	pool := &redis.Pool{
+		MaxIdle:     3,
+		IdleTimeout: 240 * time.Second,
+		Dial: func() (redis.Conn, error) {
+			c, err := redis.Dial("tcp", server)
+			if err != nil {
+				return nil, err
+			}
+			if password != "" {
+				if _, err := c.Do("AUTH", password); err != nil {
+					c.Close()
+					return nil, err
+				}
+			}
+			return c, err
+		},
+		TestOnBorrow: func(c redis.Conn, t time.Time) error {
+			_, err := c.Do("PING")
+			return err
+		},
+	}
+
+	return NewLockerWithPool(pool, opts...)
+}
+
+// NewLockerWithPool creates a new Locker with a pool.
+func NewLockerWithPool(pool *redis.Pool, opts ...Option) (*Locker, error) {
+	l := &Locker{
+		pool:          pool,
+		prefix:        "lock:",
+		ttl:           DefaultTTL,
+		retryInterval: DefaultRetryInterval,
+	}
+
+	for _, opt := range opts {
+		if err := opt(l); err != nil {
+			return nil, err
+		}
+	}
+
+	return l, nil
+}
+
+// Lock implements the Lock method of the serialize.DistributedLocker
+// interface. The lock is refreshed at half of the TTL until it is released.
+func (l *Locker) Lock(ctx context.Context, key string) (func(), error) {
+	key = l.prefix + key
+	token := eh.NewUUID().String()
+
+	for {
+		ok, err := l.acquire(key, token)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			break
+		}
+
+		select {
+		case <-time.After(l.retryInterval):
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+
+	done := make(chan struct{})
+	go l.refresh(key, token, done)
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			close(done)
+			conn := l.pool.Get()
+			defer conn.Close()
+			releaseScript.Do(conn, key, token)
+		})
+	}, nil
+}
+
+// Close closes the pool of connections.
+func (l *Locker) Close() error {
+	return l.pool.Close()
+}
+
+// acquire tries to take a lock once, returning false if it is held by another
+// process.
+func (l *Locker) acquire(key, token string) (bool, error) {
+	conn := l.pool.Get()
+	defer conn.Close()
+
+	_, err := redis.String(conn.Do("SET", key, token, "NX", "PX", l.ttl.Milliseconds()))
+	if err == redis.ErrNil {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// refresh keeps extending the TTL of a lock until it is released, or until it
+// has been lost.
+func (l *Locker) refresh(key, token string, done <-chan struct{}) {
+	ticker := time.NewTicker(l.ttl / 2)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			conn := l.pool.Get()
+			refreshed, err := redis.Int(refreshScript.Do(conn, key, token, l.ttl.Milliseconds()))
+			conn.Close()
+			// Keep trying after errors, until the lock has expired.
+			if err == nil && refreshed == 0 {
+				return
+			}
+		case <-done:
+			return
+		}
+	}
+}
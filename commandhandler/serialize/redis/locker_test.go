@@ -0,0 +1,121 @@
+// Copyright (c) 2016 - Max Ekman <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package redis
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+)
+
+func TestLocker(t *testing.T) {
+	s, err := miniredis.Run()
+	if err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	defer s.Close()
+
+	locker, err := NewLocker(s.Addr(), "", WithRetryInterval(time.Millisecond))
+	if err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	if locker == nil {
+		t.Fatal("there should be a locker")
+	}
+	defer locker.Close()
+
+	t.Log("take a free lock")
+	unlock, err := locker.Lock(context.Background(), "key")
+	if err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	if !s.Exists("lock:key") {
+		t.Error("the lock should be stored")
+	}
+	if ttl := s.TTL("lock:key"); ttl != DefaultTTL {
+		t.Error("the lock should expire:", ttl)
+	}
+
+	t.Log("wait for a held lock")
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, err := locker.Lock(ctx, "key"); err != context.DeadlineExceeded {
+		t.Error("there should be a DeadlineExceeded error:", err)
+	}
+
+	t.Log("take a lock when it is released")
+	locked := make(chan func())
+	go func() {
+		unlock, err := locker.Lock(context.Background(), "key")
+		if err != nil {
+			t.Error("there should be no error:", err)
+		}
+		locked <- unlock
+	}()
+	unlock()
+	unlock() // Releasing twice should be ignored.
+	select {
+	case unlock = <-locked:
+	case <-time.After(time.Second):
+		t.Fatal("the lock should be taken")
+	}
+	unlock()
+	if s.Exists("lock:key") {
+		t.Error("the lock should be released")
+	}
+}
+
+func TestLockerExpiry(t *testing.T) {
+	s, err := miniredis.Run()
+	if err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	defer s.Close()
+
+	locker, err := NewLocker(s.Addr(), "",
+		WithTTL(time.Minute),
+		WithRetryInterval(time.Millisecond),
+		WithPrefix("test:"),
+	)
+	if err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	defer locker.Close()
+
+	t.Log("take an expired lock")
+	unlock1, err := locker.Lock(context.Background(), "key")
+	if err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	s.FastForward(2 * time.Minute)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	unlock2, err := locker.Lock(ctx, "key")
+	if err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+
+	t.Log("don't release a lock taken by another holder")
+	unlock1()
+	if !s.Exists("test:key") {
+		t.Error("the lock of the other holder should be kept")
+	}
+	unlock2()
+	if s.Exists("test:key") {
+		t.Error("the lock should be released")
+	}
+}
@@ -0,0 +1,77 @@
+// Copyright (c) 2016 - Max Ekman <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package timeout
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	eh "github.com/looplab/eventhorizon"
+)
+
+// ErrCommandTimeout is when a command was not handled before the timeout.
+var ErrCommandTimeout = errors.New("command timeout")
+
+// NewMiddleware returns a middleware that gives commands a timeout to be
+// handled within.
+func NewMiddleware(timeout time.Duration) eh.CommandHandlerMiddleware {
+	return func(h eh.CommandHandler) eh.CommandHandler {
+		return NewCommandHandler(h, timeout)
+	}
+}
+
+// CommandHandler is a middleware that handles commands with a timeout. The
+// context passed to the wrapped handler is cancelled when the timeout is
+// reached, an earlier deadline of the incoming context is kept.
+type CommandHandler struct {
+	eh.CommandHandler
+	timeout time.Duration
+}
+
+// NewCommandHandler creates a new CommandHandler.
+func NewCommandHandler(handler eh.CommandHandler, timeout time.Duration) *CommandHandler {
+	return &CommandHandler{
+		CommandHandler: handler,
+		timeout:        timeout,
+	}
+}
+
+// HandleCommand implements the HandleCommand method of the
+// eventhorizon.CommandHandler interface. It returns ErrCommandTimeout without
+// waiting for the wrapped handler if the deadline is reached.
+func (h *CommandHandler) HandleCommand(ctx context.Context, cmd eh.Command) error {
+	ctx, cancel := context.WithTimeout(ctx, h.timeout)
+	defer cancel()
+
+	// Buffered to not block the handler if the timeout is reached first.
+	done := make(chan error, 1)
+	go func() {
+		done <- h.CommandHandler.HandleCommand(ctx, cmd)
+	}()
+
+	select {
+	case err := <-done:
+		if err != nil && ctx.Err() == context.DeadlineExceeded {
+			return ErrCommandTimeout
+		}
+		return err
+	case <-ctx.Done():
+		if ctx.Err() == context.DeadlineExceeded {
+			return ErrCommandTimeout
+		}
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,87 @@
+// Copyright (c) 2016 - Max Ekman <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package timeout
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	eh "github.com/looplab/eventhorizon"
+	"github.com/looplab/eventhorizon/mocks"
+)
+
+func TestCommandHandler(t *testing.T) {
+	t.Log("handle command in time")
+	handler := newHandler(10 * time.Millisecond)
+	h := eh.UseCommandHandlerMiddleware(handler, NewMiddleware(time.Second))
+	if err := h.HandleCommand(context.Background(), mocks.Command{eh.NewUUID(), "cmd"}); err != nil {
+		t.Error("there should be no error:", err)
+	}
+
+	t.Log("return errors from the handler")
+	otherErr := errors.New("other error")
+	h = eh.UseCommandHandlerMiddleware(eh.CommandHandlerFunc(func(ctx context.Context, cmd eh.Command) error {
+		return otherErr
+	}), NewMiddleware(time.Second))
+	if err := h.HandleCommand(context.Background(), mocks.Command{eh.NewUUID(), "cmd"}); err != otherErr {
+		t.Error("there should be an other error:", err)
+	}
+
+	t.Log("time out slow handler")
+	handler = newHandler(time.Second)
+	h = eh.UseCommandHandlerMiddleware(handler, NewMiddleware(10*time.Millisecond))
+	start := time.Now()
+	if err := h.HandleCommand(context.Background(), mocks.Command{eh.NewUUID(), "cmd"}); err != ErrCommandTimeout {
+		t.Error("there should be a ErrCommandTimeout error:", err)
+	}
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Error("the command should time out:", elapsed)
+	}
+
+	t.Log("keep a shorter deadline of the context")
+	h = eh.UseCommandHandlerMiddleware(handler, NewMiddleware(time.Minute))
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	start = time.Now()
+	if err := h.HandleCommand(ctx, mocks.Command{eh.NewUUID(), "cmd"}); err != ErrCommandTimeout {
+		t.Error("there should be a ErrCommandTimeout error:", err)
+	}
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Error("the command should time out with the context deadline:", elapsed)
+	}
+
+	t.Log("return the error of a cancelled context")
+	h = eh.UseCommandHandlerMiddleware(handler, NewMiddleware(time.Minute))
+	ctx, cancel = context.WithCancel(context.Background())
+	time.AfterFunc(10*time.Millisecond, cancel)
+	if err := h.HandleCommand(ctx, mocks.Command{eh.NewUUID(), "cmd"}); err != context.Canceled {
+		t.Error("there should be a Canceled error:", err)
+	}
+}
+
+// newHandler creates a command handler that takes some time to handle
+// commands, or until the context is done.
+func newHandler(delay time.Duration) eh.CommandHandler {
+	return eh.CommandHandlerFunc(func(ctx context.Context, cmd eh.Command) error {
+		select {
+		case <-time.After(delay):
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	})
+}
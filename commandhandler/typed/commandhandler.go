@@ -0,0 +1,49 @@
+// Copyright (c) 2016 - Max Ekman <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package typed has command handlers for commands of a concrete type, without
+// type switches or assertions in the handlers.
+package typed
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+
+	eh "github.com/looplab/eventhorizon"
+)
+
+// ErrWrongCommandType is when a command is not of the type of the handler.
+var ErrWrongCommandType = errors.New("wrong command type")
+
+// HandleTyped returns a command handler that handles commands of the type C
+// with a typed func. Commands of other types return an error with
+// ErrWrongCommandType, without calling the func.
+//
+// An example would be:
+//
+//	handler := typed.HandleTyped(func(ctx context.Context, cmd *MyCommand) error {
+//	    ...
+//	})
+func HandleTyped[C eh.Command](h func(context.Context, C) error) eh.CommandHandler {
+	return eh.CommandHandlerFunc(func(ctx context.Context, cmd eh.Command) error {
+		c, ok := cmd.(C)
+		if !ok {
+			return fmt.Errorf("%w: %T is not %s", ErrWrongCommandType, cmd, reflect.TypeOf((*C)(nil)).Elem())
+		}
+
+		return h(ctx, c)
+	})
+}
@@ -0,0 +1,74 @@
+// Copyright (c) 2016 - Max Ekman <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package typed
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	eh "github.com/looplab/eventhorizon"
+	"github.com/looplab/eventhorizon/mocks"
+)
+
+func TestHandleTyped(t *testing.T) {
+	var handled *mocks.Command
+	handler := HandleTyped(func(ctx context.Context, cmd *mocks.Command) error {
+		handled = cmd
+		return nil
+	})
+
+	t.Log("handle a command of the type")
+	cmd := &mocks.Command{ID: eh.NewUUID(), Content: "command1"}
+	if err := handler.HandleCommand(context.Background(), cmd); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if handled != cmd {
+		t.Error("the command should be handled:", handled)
+	}
+
+	t.Log("handle a command of another type")
+	handled = nil
+	ctx := eh.WithNamespace(context.Background(), "ns")
+	other := &mocks.CommandOther{ID: eh.NewUUID(), Content: "command2"}
+	err := handler.HandleCommand(ctx, other)
+	if !errors.Is(err, ErrWrongCommandType) {
+		t.Error("there should be a wrong command type error:", err)
+	}
+	if err == nil || err.Error() != "wrong command type: *mocks.CommandOther is not *mocks.Command" {
+		t.Error("the error should be correct:", err)
+	}
+	if handled != nil {
+		t.Error("the command should not be handled:", handled)
+	}
+
+	t.Log("handle a command of the type by value")
+	err = handler.HandleCommand(context.Background(), mocks.Command{ID: eh.NewUUID()})
+	if !errors.Is(err, ErrWrongCommandType) {
+		t.Error("there should be a wrong command type error:", err)
+	}
+}
+
+func TestHandleTypedError(t *testing.T) {
+	handlerErr := errors.New("handler error")
+	handler := HandleTyped(func(ctx context.Context, cmd *mocks.Command) error {
+		return handlerErr
+	})
+
+	err := handler.HandleCommand(context.Background(), &mocks.Command{ID: eh.NewUUID()})
+	if err != handlerErr {
+		t.Error("the error of the handler should be returned:", err)
+	}
+}
@@ -0,0 +1,69 @@
+// Copyright (c) 2016 - Max Ekman <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package validate
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	eh "github.com/looplab/eventhorizon"
+)
+
+// ErrCommandValidation is when a command failed to be validated.
+var ErrCommandValidation = errors.New("command validation failed")
+
+// Validator is an optional interface for commands that can validate their
+// fields before being handled.
+type Validator interface {
+	// Validate validates the command, returning an error describing the
+	// invalid fields, for example an eventhorizon.CommandFieldError.
+	Validate() error
+}
+
+// NewMiddleware returns a middleware that validates commands before they are
+// handled.
+func NewMiddleware() eh.CommandHandlerMiddleware {
+	return func(h eh.CommandHandler) eh.CommandHandler {
+		return NewCommandHandler(h)
+	}
+}
+
+// CommandHandler is a middleware that validates commands implementing the
+// Validator interface, without handling them if they are invalid. Commands
+// that do not implement it are handled as usual.
+type CommandHandler struct {
+	eh.CommandHandler
+}
+
+// NewCommandHandler creates a new CommandHandler.
+func NewCommandHandler(handler eh.CommandHandler) *CommandHandler {
+	return &CommandHandler{
+		CommandHandler: handler,
+	}
+}
+
+// HandleCommand implements the HandleCommand method of the
+// eventhorizon.CommandHandler interface. It returns ErrCommandValidation
+// wrapping the error of Validate if the command is invalid.
+func (h *CommandHandler) HandleCommand(ctx context.Context, cmd eh.Command) error {
+	if v, ok := cmd.(Validator); ok {
+		if err := v.Validate(); err != nil {
+			return fmt.Errorf("%w: %w", ErrCommandValidation, err)
+		}
+	}
+
+	return h.CommandHandler.HandleCommand(ctx, cmd)
+}
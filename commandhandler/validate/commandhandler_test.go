@@ -0,0 +1,82 @@
+// Copyright (c) 2016 - Max Ekman <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package validate
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	eh "github.com/looplab/eventhorizon"
+	"github.com/looplab/eventhorizon/mocks"
+)
+
+func TestCommandHandler(t *testing.T) {
+	handler := &mocks.CommandHandler{}
+	h := eh.UseCommandHandlerMiddleware(handler, NewMiddleware())
+	ctx := context.Background()
+
+	t.Log("handle command without validation")
+	cmd := mocks.Command{eh.NewUUID(), "cmd"}
+	if err := h.HandleCommand(ctx, cmd); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if handler.Command != cmd {
+		t.Error("the command should be handled:", handler.Command)
+	}
+
+	t.Log("handle valid command")
+	validCmd := &ValidatedCommand{eh.NewUUID(), "cmd"}
+	if err := h.HandleCommand(ctx, validCmd); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if handler.Command != validCmd {
+		t.Error("the command should be handled:", handler.Command)
+	}
+
+	t.Log("skip handling of invalid command")
+	invalidCmd := &ValidatedCommand{eh.NewUUID(), ""}
+	err := h.HandleCommand(ctx, invalidCmd)
+	if !errors.Is(err, ErrCommandValidation) {
+		t.Error("there should be a ErrCommandValidation error:", err)
+	}
+	var fieldErr eh.CommandFieldError
+	if !errors.As(err, &fieldErr) || fieldErr.Field != "Content" {
+		t.Error("the error should have the field error:", err)
+	}
+	if err.Error() != "command validation failed: missing field: Content" {
+		t.Error("the error string should be correct:", err.Error())
+	}
+	if handler.Command != validCmd {
+		t.Error("the command should not be handled:", handler.Command)
+	}
+}
+
+// ValidatedCommand is a command that validates its content.
+type ValidatedCommand struct {
+	ID      eh.UUID
+	Content string
+}
+
+func (c *ValidatedCommand) AggregateID() eh.UUID            { return c.ID }
+func (c *ValidatedCommand) AggregateType() eh.AggregateType { return mocks.AggregateType }
+func (c *ValidatedCommand) CommandType() eh.CommandType     { return "ValidatedCommand" }
+
+func (c *ValidatedCommand) Validate() error {
+	if c.Content == "" {
+		return eh.CommandFieldError{"Content"}
+	}
+	return nil
+}
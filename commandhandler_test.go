@@ -16,6 +16,7 @@ package eventhorizon
 
 import (
 	"context"
+	"reflect"
 	"testing"
 	"time"
 )
@@ -72,6 +73,65 @@ func TestCommandHandlerErrorInHandler(t *testing.T) {
 	}
 }
 
+func TestCommandHandlerDryRun(t *testing.T) {
+	repo, store, bus := createRepoAndStore(t)
+	handler, err := NewAggregateCommandHandler(repo)
+	if err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	if err := handler.SetAggregate(TestAggregateType, TestCommandType); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+
+	t.Log("handle a command as a dry run")
+	id := NewUUID()
+	ctx := WithDryRun(context.Background())
+	if !IsDryRun(ctx) {
+		t.Error("the context should be a dry run")
+	}
+	if err := handler.HandleCommand(ctx, &TestCommand{id, "command1"}); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if len(store.Events) != 0 {
+		t.Error("there should be no stored events:", store.Events)
+	}
+	if len(bus.Events) != 0 {
+		t.Error("there should be no published events:", bus.Events)
+	}
+	dryRunEvents := DryRunEvents(ctx)
+	if len(dryRunEvents) != 1 {
+		t.Fatal("there should be one dry run event:", dryRunEvents)
+	}
+
+	t.Log("handle the same command for real")
+	ctx = context.Background()
+	if IsDryRun(ctx) {
+		t.Error("the context should not be a dry run")
+	}
+	if err := handler.HandleCommand(ctx, &TestCommand{id, "command1"}); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if DryRunEvents(ctx) != nil {
+		t.Error("there should be no dry run events:", DryRunEvents(ctx))
+	}
+	if len(store.Events) != 1 {
+		t.Fatal("there should be one stored event:", store.Events)
+	}
+	event, dryRunEvent := store.Events[0], dryRunEvents[0]
+	if dryRunEvent.EventType() != event.EventType() {
+		t.Error("the event type should be correct:", dryRunEvent.EventType())
+	}
+	if dryRunEvent.AggregateID() != event.AggregateID() {
+		t.Error("the aggregate ID should be correct:", dryRunEvent.AggregateID())
+	}
+	if dryRunEvent.Version() != event.Version() {
+		t.Error("the version should be correct:", dryRunEvent.Version())
+	}
+	if !reflect.DeepEqual(dryRunEvent.Data(), event.Data()) {
+		t.Error("the event data should be correct:", dryRunEvent.Data())
+	}
+}
+
 func TestCommandHandlerNoHandlers(t *testing.T) {
 	_, handler := createAggregateAndHandler(t)
 
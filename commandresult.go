@@ -0,0 +1,70 @@
+// Copyright (c) 2016 - Max Ekman <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package eventhorizon
+
+import (
+	"context"
+	"sync"
+)
+
+// WithCommandResult returns a context for handling a command that produces a
+// result the caller needs, for example an allocated id. The handler sets the
+// result with SetCommandResult, and the caller reads it with CommandResult
+// after the command has been handled. Handlers that don't set a result work
+// as before.
+func WithCommandResult(ctx context.Context) context.Context {
+	return context.WithValue(ctx, commandResultKey, &commandResult{})
+}
+
+// SetCommandResult sets the result of the command handled with the context,
+// replacing any earlier result. Returns false if the caller has not asked for
+// a result with WithCommandResult, in which case the result is dropped.
+func SetCommandResult(ctx context.Context, result interface{}) bool {
+	r, ok := ctx.Value(commandResultKey).(*commandResult)
+	if !ok {
+		return false
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.result = result
+	r.set = true
+
+	return true
+}
+
+// CommandResult returns the result set by the handler of a command handled
+// with the context, and if a result has been set. Commands handled
+// asynchronously, for example by a command bus, may set the result after the
+// command has been dispatched.
+func CommandResult(ctx context.Context) (interface{}, bool) {
+	r, ok := ctx.Value(commandResultKey).(*commandResult)
+	if !ok {
+		return nil, false
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.result, r.set
+}
+
+// commandResult has the result of a command, set by its handler.
+type commandResult struct {
+	mu     sync.Mutex
+	result interface{}
+	set    bool
+}
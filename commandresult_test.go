@@ -0,0 +1,61 @@
+// Copyright (c) 2016 - Max Ekman <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package eventhorizon
+
+import (
+	"context"
+	"testing"
+)
+
+func TestCommandResult(t *testing.T) {
+	id := NewUUID()
+	var handler CommandHandler = CommandHandlerFunc(func(ctx context.Context, cmd Command) error {
+		SetCommandResult(ctx, id)
+		return nil
+	})
+	// The result should pass through middleware that keeps the context.
+	handler = UseCommandHandlerMiddleware(handler, func(h CommandHandler) CommandHandler {
+		return CommandHandlerFunc(func(ctx context.Context, cmd Command) error {
+			return h.HandleCommand(context.WithValue(ctx, "testkey", "testval"), cmd)
+		})
+	})
+
+	t.Log("handle a command with a result")
+	ctx := WithCommandResult(context.Background())
+	if result, ok := CommandResult(ctx); ok || result != nil {
+		t.Error("there should be no result before handling:", result)
+	}
+	if err := handler.HandleCommand(ctx, &TestCommand{NewUUID(), "command1"}); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	result, ok := CommandResult(ctx)
+	if !ok {
+		t.Fatal("there should be a result")
+	}
+	if result != id {
+		t.Error("the result should be correct:", result)
+	}
+
+	t.Log("handle a command without a result")
+	if err := handler.HandleCommand(context.Background(), &TestCommand{NewUUID(), "command2"}); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	if result, ok := CommandResult(context.Background()); ok || result != nil {
+		t.Error("there should be no result:", result)
+	}
+	if SetCommandResult(context.Background(), id) {
+		t.Error("the result should not be set without WithCommandResult")
+	}
+}
@@ -0,0 +1,140 @@
+// Copyright (c) 2016 - Max Ekman <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package commandscheduler
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	eh "github.com/looplab/eventhorizon"
+)
+
+// MemoryStore is a Store that keeps the scheduled commands in memory, for
+// tests and commands that don't need to survive a restart. The commands are
+// saved as JSON, so that loaded commands never share memory with the saved
+// commands, the same way as with a DB.
+type MemoryStore struct {
+	cmds map[eh.UUID]memoryCommand
+	mu   sync.RWMutex
+}
+
+type memoryCommand struct {
+	commandType eh.CommandType
+	data        []byte
+	executeAt   time.Time
+	namespace   string
+}
+
+// NewMemoryStore creates a new MemoryStore.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		cmds: map[eh.UUID]memoryCommand{},
+	}
+}
+
+// Save implements the Save method of the Store interface.
+func (s *MemoryStore) Save(ctx context.Context, cmd ScheduledCommand) error {
+	data, err := json.Marshal(cmd.Command)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrCouldNotSaveSchedule, err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.cmds[cmd.ID] = memoryCommand{
+		commandType: cmd.Command.CommandType(),
+		data:        data,
+		executeAt:   cmd.ExecuteAt,
+		namespace:   cmd.Namespace,
+	}
+
+	return nil
+}
+
+// Remove implements the Remove method of the Store interface.
+func (s *MemoryStore) Remove(ctx context.Context, id eh.UUID) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.cmds[id]; !ok {
+		return ErrScheduleNotFound
+	}
+	delete(s.cmds, id)
+
+	return nil
+}
+
+// Postpone implements the Postpone method of the Store interface.
+func (s *MemoryStore) Postpone(ctx context.Context, id eh.UUID, executeAt time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	c, ok := s.cmds[id]
+	if !ok {
+		return ErrScheduleNotFound
+	}
+	c.executeAt = executeAt
+	s.cmds[id] = c
+
+	return nil
+}
+
+// Due implements the Due method of the Store interface.
+func (s *MemoryStore) Due(ctx context.Context, now time.Time, limit int) ([]ScheduledCommand, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var ids []eh.UUID
+	for id, c := range s.cmds {
+		if !c.executeAt.After(now) {
+			ids = append(ids, id)
+		}
+	}
+	sort.Slice(ids, func(i, j int) bool {
+		a, b := s.cmds[ids[i]], s.cmds[ids[j]]
+		if !a.executeAt.Equal(b.executeAt) {
+			return a.executeAt.Before(b.executeAt)
+		}
+		return ids[i] < ids[j]
+	})
+	if len(ids) > limit {
+		ids = ids[:limit]
+	}
+
+	cmds := make([]ScheduledCommand, 0, len(ids))
+	for _, id := range ids {
+		c := s.cmds[id]
+		cmd, err := eh.CreateCommand(c.commandType)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrCouldNotLoadSchedule, err)
+		}
+		if err := json.Unmarshal(c.data, cmd); err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrCouldNotLoadSchedule, err)
+		}
+		cmds = append(cmds, ScheduledCommand{
+			ID:        id,
+			Command:   cmd,
+			ExecuteAt: c.executeAt,
+			Namespace: c.namespace,
+		})
+	}
+
+	return cmds, nil
+}
@@ -0,0 +1,106 @@
+// Copyright (c) 2016 - Max Ekman <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package commandscheduler
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	eh "github.com/looplab/eventhorizon"
+	"github.com/looplab/eventhorizon/mocks"
+)
+
+func TestMemoryStore(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryStore()
+	now := time.Date(2026, 10, 14, 12, 0, 0, 0, time.UTC)
+
+	sc1 := ScheduledCommand{
+		ID:        eh.NewUUID(),
+		Command:   &mocks.Command{ID: eh.NewUUID(), Content: "cmd1"},
+		ExecuteAt: now.Add(2 * time.Minute),
+		Namespace: "ns",
+	}
+	sc2 := ScheduledCommand{
+		ID:        eh.NewUUID(),
+		Command:   &mocks.Command{ID: eh.NewUUID(), Content: "cmd2"},
+		ExecuteAt: now.Add(time.Minute),
+	}
+	sc3 := ScheduledCommand{
+		ID:        eh.NewUUID(),
+		Command:   &mocks.Command{ID: eh.NewUUID(), Content: "cmd3"},
+		ExecuteAt: now.Add(time.Hour),
+	}
+	for _, sc := range []ScheduledCommand{sc1, sc2, sc3} {
+		if err := store.Save(ctx, sc); err != nil {
+			t.Fatal("there should be no error:", err)
+		}
+	}
+
+	t.Log("due commands, the earliest first")
+	due, err := store.Due(ctx, now.Add(2*time.Minute), 10)
+	if err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	if !reflect.DeepEqual(due, []ScheduledCommand{sc2, sc1}) {
+		t.Error("the due commands should be correct:", due)
+	}
+
+	t.Log("due commands with a limit")
+	due, err = store.Due(ctx, now.Add(time.Hour), 1)
+	if err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	if !reflect.DeepEqual(due, []ScheduledCommand{sc2}) {
+		t.Error("the due commands should be correct:", due)
+	}
+
+	t.Log("loaded commands should not change the saved commands")
+	due[0].Command.(*mocks.Command).Content = "changed"
+	due, err = store.Due(ctx, now.Add(time.Minute), 10)
+	if err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	if !reflect.DeepEqual(due, []ScheduledCommand{sc2}) {
+		t.Error("the due commands should be correct:", due)
+	}
+
+	t.Log("postpone a command")
+	if err := store.Postpone(ctx, sc1.ID, now.Add(30*time.Minute)); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	sc1.ExecuteAt = now.Add(30 * time.Minute)
+	if err := store.Postpone(ctx, eh.NewUUID(), now); !errors.Is(err, ErrScheduleNotFound) {
+		t.Error("there should be a schedule not found error:", err)
+	}
+
+	t.Log("remove a command")
+	if err := store.Remove(ctx, sc2.ID); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if err := store.Remove(ctx, sc2.ID); !errors.Is(err, ErrScheduleNotFound) {
+		t.Error("there should be a schedule not found error:", err)
+	}
+	due, err = store.Due(ctx, now.Add(time.Hour), 10)
+	if err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	if !reflect.DeepEqual(due, []ScheduledCommand{sc1, sc3}) {
+		t.Error("the due commands should be correct:", due)
+	}
+}
@@ -0,0 +1,183 @@
+// Copyright (c) 2016 - Max Ekman <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mongodb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+
+	eh "github.com/looplab/eventhorizon"
+	"github.com/looplab/eventhorizon/commandscheduler"
+)
+
+// ErrCouldNotDialDB is when the database could not be dialed.
+var ErrCouldNotDialDB = errors.New("could not dial database")
+
+// ErrNoDBSession is when no database session is set.
+var ErrNoDBSession = errors.New("no database session")
+
+// ErrCouldNotClearDB is when the database could not be cleared.
+var ErrCouldNotClearDB = errors.New("could not clear database")
+
+// Store implements a MongoDB store of scheduled commands, with one document
+// per command. The commands of all namespaces are kept in one collection.
+type Store struct {
+	session    *mgo.Session
+	db         string
+	collection string
+}
+
+// NewStore creates a new Store.
+func NewStore(url, db, collection string) (*Store, error) {
+	session, err := mgo.Dial(url)
+	if err != nil {
+		return nil, ErrCouldNotDialDB
+	}
+
+	session.SetMode(mgo.Strong, true)
+	session.SetSafe(&mgo.Safe{W: 1})
+
+	return NewStoreWithSession(session, db, collection)
+}
+
+// NewStoreWithSession creates a new Store with a session.
+func NewStoreWithSession(session *mgo.Session, db, collection string) (*Store, error) {
+	if session == nil {
+		return nil, ErrNoDBSession
+	}
+
+	s := &Store{
+		session:    session,
+		db:         db,
+		collection: collection,
+	}
+
+	if err := session.DB(db).C(collection).EnsureIndexKey("execute_at"); err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// dbCommand is the document of a scheduled command.
+type dbCommand struct {
+	ID          eh.UUID        `bson:"_id"`
+	CommandType eh.CommandType `bson:"command_type"`
+	Command     bson.Raw       `bson:"command"`
+	ExecuteAt   time.Time      `bson:"execute_at"`
+	Namespace   string         `bson:"namespace"`
+}
+
+// Save implements the Save method of the commandscheduler.Store interface.
+func (s *Store) Save(ctx context.Context, cmd commandscheduler.ScheduledCommand) error {
+	sess := s.session.Copy()
+	defer sess.Close()
+
+	doc := bson.M{
+		"_id":          cmd.ID,
+		"command_type": cmd.Command.CommandType(),
+		"command":      cmd.Command,
+		"execute_at":   cmd.ExecuteAt,
+		"namespace":    cmd.Namespace,
+	}
+	if _, err := sess.DB(s.db).C(s.collection).UpsertId(cmd.ID, doc); err != nil {
+		return fmt.Errorf("%w: %w", commandscheduler.ErrCouldNotSaveSchedule, err)
+	}
+
+	return nil
+}
+
+// Remove implements the Remove method of the commandscheduler.Store interface.
+func (s *Store) Remove(ctx context.Context, id eh.UUID) error {
+	sess := s.session.Copy()
+	defer sess.Close()
+
+	if err := sess.DB(s.db).C(s.collection).RemoveId(id); err == mgo.ErrNotFound {
+		return commandscheduler.ErrScheduleNotFound
+	} else if err != nil {
+		return fmt.Errorf("%w: %w", commandscheduler.ErrCouldNotRemoveSchedule, err)
+	}
+
+	return nil
+}
+
+// Postpone implements the Postpone method of the commandscheduler.Store
+// interface. The command is only updated if it still exists.
+func (s *Store) Postpone(ctx context.Context, id eh.UUID, executeAt time.Time) error {
+	sess := s.session.Copy()
+	defer sess.Close()
+
+	if err := sess.DB(s.db).C(s.collection).UpdateId(id,
+		bson.M{"$set": bson.M{"execute_at": executeAt}},
+	); err == mgo.ErrNotFound {
+		return commandscheduler.ErrScheduleNotFound
+	} else if err != nil {
+		return fmt.Errorf("%w: %w", commandscheduler.ErrCouldNotSaveSchedule, err)
+	}
+
+	return nil
+}
+
+// Due implements the Due method of the commandscheduler.Store interface.
+func (s *Store) Due(ctx context.Context, now time.Time, limit int) ([]commandscheduler.ScheduledCommand, error) {
+	sess := s.session.Copy()
+	defer sess.Close()
+
+	var docs []dbCommand
+	if err := sess.DB(s.db).C(s.collection).
+		Find(bson.M{"execute_at": bson.M{"$lte": now}}).
+		Sort("execute_at", "_id").
+		Limit(limit).
+		All(&docs); err != nil {
+		return nil, fmt.Errorf("%w: %w", commandscheduler.ErrCouldNotLoadSchedule, err)
+	}
+
+	cmds := make([]commandscheduler.ScheduledCommand, 0, len(docs))
+	for _, doc := range docs {
+		cmd, err := eh.CreateCommand(doc.CommandType)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %w", commandscheduler.ErrCouldNotLoadSchedule, err)
+		}
+		if err := doc.Command.Unmarshal(cmd); err != nil {
+			return nil, fmt.Errorf("%w: %w", commandscheduler.ErrCouldNotLoadSchedule, err)
+		}
+		cmds = append(cmds, commandscheduler.ScheduledCommand{
+			ID:        doc.ID,
+			Command:   cmd,
+			ExecuteAt: doc.ExecuteAt,
+			Namespace: doc.Namespace,
+		})
+	}
+
+	return cmds, nil
+}
+
+// Clear clears the scheduled commands.
+func (s *Store) Clear(ctx context.Context) error {
+	if err := s.session.DB(s.db).C(s.collection).DropCollection(); err != nil {
+		return fmt.Errorf("%w: %w", ErrCouldNotClearDB, err)
+	}
+	return nil
+}
+
+// Close closes a database session.
+func (s *Store) Close() {
+	s.session.Close()
+}
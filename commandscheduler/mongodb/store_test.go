@@ -0,0 +1,137 @@
+// Copyright (c) 2016 - Max Ekman <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mongodb
+
+import (
+	"context"
+	"errors"
+	"os"
+	"reflect"
+	"testing"
+	"time"
+
+	eh "github.com/looplab/eventhorizon"
+	"github.com/looplab/eventhorizon/commandscheduler"
+	"github.com/looplab/eventhorizon/mocks"
+)
+
+func init() {
+	eh.RegisterCommand(func() eh.Command { return &mocks.Command{} })
+}
+
+func TestStore(t *testing.T) {
+	// Support Wercker testing with MongoDB.
+	host := os.Getenv("MONGO_PORT_27017_TCP_ADDR")
+	port := os.Getenv("MONGO_PORT_27017_TCP_PORT")
+
+	url := "localhost"
+	if host != "" && port != "" {
+		url = host + ":" + port
+	}
+
+	store, err := NewStore(url, "test", "scheduled_commands")
+	if err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	if store == nil {
+		t.Fatal("there should be a store")
+	}
+	defer store.Close()
+
+	ctx := context.Background()
+	defer func() {
+		t.Log("clearing db")
+		if err = store.Clear(ctx); err != nil {
+			t.Fatal("there should be no error:", err)
+		}
+	}()
+
+	// Times are truncated to the millisecond precision of MongoDB.
+	now := time.Now().Truncate(time.Millisecond)
+	clock := func() time.Time { return now }
+
+	t.Log("schedule commands")
+	handler := &commandHandler{}
+	s := commandscheduler.NewScheduler(store, handler, commandscheduler.WithClock(clock))
+	nsCtx := eh.WithNamespace(ctx, "ns")
+	cmd1 := &mocks.Command{ID: eh.NewUUID(), Content: "cmd1"}
+	if _, err := s.ScheduleAfter(nsCtx, cmd1, time.Minute); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	cmd2 := &mocks.Command{ID: eh.NewUUID(), Content: "cmd2"}
+	id2, err := s.ScheduleAfter(ctx, cmd2, 2*time.Minute)
+	if err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+
+	t.Log("due commands")
+	due, err := store.Due(ctx, now.Add(time.Hour), 10)
+	if err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	if len(due) != 2 ||
+		!reflect.DeepEqual(due[0].Command, cmd1) || due[0].Namespace != "ns" ||
+		!reflect.DeepEqual(due[1].Command, cmd2) || due[1].ID != id2 {
+		t.Error("the due commands should be correct:", due)
+	}
+
+	t.Log("cancel a command")
+	if err := s.Cancel(ctx, id2); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	if err := s.Cancel(ctx, id2); !errors.Is(err, commandscheduler.ErrScheduleNotFound) {
+		t.Error("there should be a schedule not found error:", err)
+	}
+	if err := store.Postpone(ctx, id2, now); !errors.Is(err, commandscheduler.ErrScheduleNotFound) {
+		t.Error("a cancelled command should not be postponed:", err)
+	}
+
+	t.Log("postpone a command")
+	if err := store.Postpone(ctx, due[0].ID, now.Add(2*time.Hour)); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	if due, err := store.Due(ctx, now.Add(time.Hour), 10); err != nil || len(due) != 0 {
+		t.Error("the postponed command should not be due:", due, err)
+	}
+
+	t.Log("dispatch with a new scheduler")
+	s = commandscheduler.NewScheduler(store, handler, commandscheduler.WithClock(clock))
+	now = now.Add(2 * time.Hour)
+	if n, err := s.DispatchOnce(ctx); err != nil || n != 1 {
+		t.Fatal("there should be one dispatched command:", n, err)
+	}
+	if !reflect.DeepEqual(handler.commands, []eh.Command{cmd1}) {
+		t.Error("the command should be handled:", handler.commands)
+	}
+}
+
+func TestNewStoreWithSession(t *testing.T) {
+	store, err := NewStoreWithSession(nil, "test", "scheduled_commands")
+	if err != ErrNoDBSession {
+		t.Error("there should be a ErrNoDBSession error:", err)
+	}
+	if store != nil {
+		t.Error("there should be no store:", store)
+	}
+}
+
+type commandHandler struct {
+	commands []eh.Command
+}
+
+func (h *commandHandler) HandleCommand(ctx context.Context, cmd eh.Command) error {
+	h.commands = append(h.commands, cmd)
+	return nil
+}
@@ -0,0 +1,251 @@
+// Copyright (c) 2016 - Max Ekman <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package commandscheduler dispatches commands at a later time, for example
+// a timeout that a saga should act on if nothing has happened before it.
+package commandscheduler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	eh "github.com/looplab/eventhorizon"
+)
+
+// ErrScheduleNotFound is when there is no scheduled command with an id, for
+// example when it has already been dispatched or cancelled.
+var ErrScheduleNotFound = errors.New("could not find scheduled command")
+
+// ErrCouldNotSaveSchedule is when a scheduled command could not be saved.
+var ErrCouldNotSaveSchedule = errors.New("could not save scheduled command")
+
+// ErrCouldNotLoadSchedule is when the scheduled commands could not be loaded.
+var ErrCouldNotLoadSchedule = errors.New("could not load scheduled commands")
+
+// ErrCouldNotRemoveSchedule is when a scheduled command could not be removed.
+var ErrCouldNotRemoveSchedule = errors.New("could not remove scheduled command")
+
+// ScheduledCommand is a command that should be dispatched at a time.
+type ScheduledCommand struct {
+	// ID is the id of the schedule, used to cancel it.
+	ID eh.UUID
+	// Command is the command to dispatch. It is recreated with the factory
+	// registered with eventhorizon.RegisterCommand when loaded, so it must
+	// be registered and serializable by the store.
+	Command eh.Command
+	// ExecuteAt is when the command should be dispatched.
+	ExecuteAt time.Time
+	// Namespace is the namespace that the command is dispatched in, which is
+	// the namespace of the context that it was scheduled with.
+	Namespace string
+}
+
+// Store is a store of scheduled commands. The commands of all namespaces are
+// kept together, so that one scheduler can dispatch all of them.
+type Store interface {
+	// Save saves a scheduled command, replacing any command with the same id.
+	Save(ctx context.Context, cmd ScheduledCommand) error
+
+	// Remove removes a scheduled command. Returns ErrScheduleNotFound if
+	// there is no command with the id.
+	Remove(ctx context.Context, id eh.UUID) error
+
+	// Postpone changes when a scheduled command should be dispatched. Returns
+	// ErrScheduleNotFound if there is no command with the id, so that a
+	// command is not scheduled again after it has been cancelled.
+	Postpone(ctx context.Context, id eh.UUID, executeAt time.Time) error
+
+	// Due returns at most limit commands that should be dispatched at or
+	// before now, the earliest first.
+	Due(ctx context.Context, now time.Time, limit int) ([]ScheduledCommand, error)
+}
+
+// Scheduler persists commands in a store and dispatches them to a command
+// handler when they are due. The commands survive restarts as long as the
+// store does. Commands are dispatched at least once, as they are only removed
+// after they have been handled, and should be dispatched by a single running
+// scheduler per store.
+type Scheduler struct {
+	store      Store
+	handler    eh.CommandHandler
+	now        eh.Clock
+	batchSize  int
+	interval   time.Duration
+	retryDelay time.Duration
+	logger     eh.Logger
+}
+
+// Option is an option setter used to configure creation.
+type Option func(*Scheduler)
+
+// WithClock uses a clock to schedule and find the due commands, instead of
+// time.Now.
+func WithClock(clock eh.Clock) Option {
+	return func(s *Scheduler) {
+		if clock == nil {
+			clock = time.Now
+		}
+		s.now = clock
+	}
+}
+
+// WithBatchSize sets the max number of due commands to dispatch at a time,
+// the default is 100.
+func WithBatchSize(n int) Option {
+	return func(s *Scheduler) {
+		s.batchSize = n
+	}
+}
+
+// WithPollInterval sets how long to wait before looking for due commands
+// again when there were none or an error occurred, the default is 1s.
+func WithPollInterval(d time.Duration) Option {
+	return func(s *Scheduler) {
+		s.interval = d
+	}
+}
+
+// WithRetryDelay sets how long to postpone a command that could not be
+// handled before it is dispatched again, the default is 30s.
+func WithRetryDelay(d time.Duration) Option {
+	return func(s *Scheduler) {
+		s.retryDelay = d
+	}
+}
+
+// WithLogger sets the logger used to log errors when running.
+func WithLogger(logger eh.Logger) Option {
+	return func(s *Scheduler) {
+		s.logger = logger
+	}
+}
+
+// NewScheduler creates a scheduler that keeps the commands in a store and
+// dispatches them to a command handler.
+func NewScheduler(store Store, handler eh.CommandHandler, opts ...Option) *Scheduler {
+	s := &Scheduler{
+		store:      store,
+		handler:    handler,
+		now:        time.Now,
+		batchSize:  100,
+		interval:   time.Second,
+		retryDelay: 30 * time.Second,
+	}
+
+	for _, opt := range opts {
+		opt(s)
+	}
+
+	if s.logger == nil {
+		s.logger = eh.NopLogger{}
+	}
+
+	return s
+}
+
+// ScheduleAt schedules a command to be dispatched at a time, returning the id
+// of the schedule. A time that has already passed dispatches the command the
+// next time the due commands are dispatched.
+func (s *Scheduler) ScheduleAt(ctx context.Context, cmd eh.Command, t time.Time) (eh.UUID, error) {
+	// Fail early for commands that could not be recreated when loaded.
+	if _, err := eh.CreateCommand(cmd.CommandType()); err != nil {
+		return "", fmt.Errorf("%w: %w", ErrCouldNotSaveSchedule, err)
+	}
+
+	sc := ScheduledCommand{
+		ID:        eh.NewUUID(),
+		Command:   cmd,
+		ExecuteAt: t,
+		Namespace: eh.Namespace(ctx),
+	}
+	if err := s.store.Save(ctx, sc); err != nil {
+		return "", err
+	}
+
+	return sc.ID, nil
+}
+
+// ScheduleAfter schedules a command to be dispatched after a duration,
+// returning the id of the schedule.
+func (s *Scheduler) ScheduleAfter(ctx context.Context, cmd eh.Command, d time.Duration) (eh.UUID, error) {
+	return s.ScheduleAt(ctx, cmd, s.now().Add(d))
+}
+
+// Cancel cancels a scheduled command. Returns ErrScheduleNotFound if the
+// command has already been dispatched or cancelled.
+func (s *Scheduler) Cancel(ctx context.Context, id eh.UUID) error {
+	return s.store.Remove(ctx, id)
+}
+
+// DispatchOnce dispatches a batch of due commands, returning the number of
+// handled commands. A command that could not be handled is postponed by the
+// retry delay, unless it was cancelled while it was handled, and the first
+// such error is returned, after the rest of the batch has been dispatched.
+func (s *Scheduler) DispatchOnce(ctx context.Context) (int, error) {
+	now := s.now()
+	due, err := s.store.Due(ctx, now, s.batchSize)
+	if err != nil {
+		return 0, err
+	}
+
+	var n int
+	var dispatchErr error
+	for _, sc := range due {
+		cmdCtx := eh.WithNamespace(ctx, sc.Namespace)
+		if err := s.handler.HandleCommand(cmdCtx, sc.Command); err != nil {
+			if dispatchErr == nil {
+				dispatchErr = err
+			}
+			err := s.store.Postpone(ctx, sc.ID, now.Add(s.retryDelay))
+			if err != nil && !errors.Is(err, ErrScheduleNotFound) {
+				return n, err
+			}
+			continue
+		}
+
+		// The command may have been cancelled while it was handled.
+		if err := s.store.Remove(ctx, sc.ID); err != nil && !errors.Is(err, ErrScheduleNotFound) {
+			return n, err
+		}
+		n++
+	}
+
+	return n, dispatchErr
+}
+
+// Run dispatches the due commands until the context is cancelled, waiting the
+// poll interval when there are none. Errors are logged and retried after the
+// poll interval. Returns the error of the context when done.
+func (s *Scheduler) Run(ctx context.Context) error {
+	for {
+		n, err := s.DispatchOnce(ctx)
+		if err != nil {
+			s.logger.Error("commandscheduler: could not dispatch commands",
+				"error", err,
+			)
+		}
+
+		if n < s.batchSize || err != nil {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(s.interval):
+			}
+		} else if ctx.Err() != nil {
+			return ctx.Err()
+		}
+	}
+}
@@ -0,0 +1,277 @@
+// Copyright (c) 2016 - Max Ekman <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package commandscheduler
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	eh "github.com/looplab/eventhorizon"
+	"github.com/looplab/eventhorizon/mocks"
+)
+
+func init() {
+	eh.RegisterCommand(func() eh.Command { return &mocks.Command{} })
+}
+
+func TestScheduler(t *testing.T) {
+	now := time.Date(2026, 10, 14, 12, 0, 0, 0, time.UTC)
+	clock := func() time.Time { return now }
+	store := NewMemoryStore()
+	handler := &commandHandler{}
+	s := NewScheduler(store, handler, WithClock(clock))
+
+	ctx := eh.WithNamespace(context.Background(), "ns")
+	cmd := &mocks.Command{ID: eh.NewUUID(), Content: "timeout"}
+	id, err := s.ScheduleAfter(ctx, cmd, 30*time.Minute)
+	if err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	if id == "" {
+		t.Fatal("there should be a schedule id")
+	}
+
+	t.Log("dispatch before the command is due")
+	now = now.Add(29 * time.Minute)
+	if n, err := s.DispatchOnce(context.Background()); err != nil || n != 0 {
+		t.Fatal("there should be no dispatched commands:", n, err)
+	}
+	if len(handler.commands) != 0 {
+		t.Error("there should be no handled commands:", handler.commands)
+	}
+
+	t.Log("dispatch when the command is due")
+	now = now.Add(time.Minute)
+	if n, err := s.DispatchOnce(context.Background()); err != nil || n != 1 {
+		t.Fatal("there should be one dispatched command:", n, err)
+	}
+	if !reflect.DeepEqual(handler.commands, []eh.Command{cmd}) {
+		t.Error("the command should be handled:", handler.commands)
+	}
+	if ns := eh.Namespace(handler.ctx); ns != "ns" {
+		t.Error("the command should be handled in the namespace:", ns)
+	}
+
+	t.Log("dispatch again")
+	now = now.Add(time.Hour)
+	if n, err := s.DispatchOnce(context.Background()); err != nil || n != 0 {
+		t.Fatal("there should be no dispatched commands:", n, err)
+	}
+	if err := s.Cancel(ctx, id); !errors.Is(err, ErrScheduleNotFound) {
+		t.Error("there should be a schedule not found error:", err)
+	}
+}
+
+func TestSchedulerCancel(t *testing.T) {
+	now := time.Date(2026, 10, 14, 12, 0, 0, 0, time.UTC)
+	clock := func() time.Time { return now }
+	handler := &commandHandler{}
+	s := NewScheduler(NewMemoryStore(), handler, WithClock(clock))
+
+	ctx := context.Background()
+	cmd1 := &mocks.Command{ID: eh.NewUUID(), Content: "cmd1"}
+	id1, err := s.ScheduleAt(ctx, cmd1, now.Add(time.Minute))
+	if err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	cmd2 := &mocks.Command{ID: eh.NewUUID(), Content: "cmd2"}
+	if _, err := s.ScheduleAt(ctx, cmd2, now.Add(2*time.Minute)); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+
+	if err := s.Cancel(ctx, id1); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	if err := s.Cancel(ctx, id1); !errors.Is(err, ErrScheduleNotFound) {
+		t.Error("there should be a schedule not found error:", err)
+	}
+
+	now = now.Add(time.Hour)
+	if n, err := s.DispatchOnce(ctx); err != nil || n != 1 {
+		t.Fatal("there should be one dispatched command:", n, err)
+	}
+	if !reflect.DeepEqual(handler.commands, []eh.Command{cmd2}) {
+		t.Error("only the command that is not cancelled should be handled:", handler.commands)
+	}
+}
+
+func TestSchedulerRestart(t *testing.T) {
+	now := time.Date(2026, 10, 14, 12, 0, 0, 0, time.UTC)
+	clock := func() time.Time { return now }
+	store := NewMemoryStore()
+
+	ctx := context.Background()
+	cmd := &mocks.Command{ID: eh.NewUUID(), Content: "timeout"}
+	s := NewScheduler(store, &commandHandler{}, WithClock(clock))
+	if _, err := s.ScheduleAfter(ctx, cmd, time.Minute); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+
+	t.Log("dispatch with a new scheduler for the same store")
+	handler := &commandHandler{}
+	s = NewScheduler(store, handler, WithClock(clock))
+	now = now.Add(time.Minute)
+	if n, err := s.DispatchOnce(ctx); err != nil || n != 1 {
+		t.Fatal("there should be one dispatched command:", n, err)
+	}
+	if !reflect.DeepEqual(handler.commands, []eh.Command{cmd}) {
+		t.Error("the command should be handled:", handler.commands)
+	}
+}
+
+func TestSchedulerRetry(t *testing.T) {
+	now := time.Date(2026, 10, 14, 12, 0, 0, 0, time.UTC)
+	clock := func() time.Time { return now }
+	handlerErr := errors.New("handler error")
+	handler := &commandHandler{err: handlerErr}
+	s := NewScheduler(NewMemoryStore(), handler,
+		WithClock(clock),
+		WithRetryDelay(time.Minute),
+	)
+
+	ctx := context.Background()
+	cmd := &mocks.Command{ID: eh.NewUUID(), Content: "timeout"}
+	if _, err := s.ScheduleAt(ctx, cmd, now); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+
+	t.Log("dispatch with a failing handler")
+	if n, err := s.DispatchOnce(ctx); !errors.Is(err, handlerErr) || n != 0 {
+		t.Fatal("there should be a handler error:", n, err)
+	}
+	handler.err = nil
+	if n, err := s.DispatchOnce(ctx); err != nil || n != 0 {
+		t.Fatal("the command should be postponed:", n, err)
+	}
+
+	t.Log("dispatch after the retry delay")
+	now = now.Add(time.Minute)
+	if n, err := s.DispatchOnce(ctx); err != nil || n != 1 {
+		t.Fatal("there should be one dispatched command:", n, err)
+	}
+	if len(handler.commands) != 2 {
+		t.Error("the command should be handled twice:", handler.commands)
+	}
+}
+
+func TestSchedulerCancelDuringRetry(t *testing.T) {
+	now := time.Date(2026, 10, 14, 12, 0, 0, 0, time.UTC)
+	clock := func() time.Time { return now }
+	store := NewMemoryStore()
+	handlerErr := errors.New("handler error")
+	handler := &commandHandler{err: handlerErr}
+	s := NewScheduler(store, handler,
+		WithClock(clock),
+		WithRetryDelay(time.Minute),
+	)
+
+	ctx := context.Background()
+	cmd := &mocks.Command{ID: eh.NewUUID(), Content: "timeout"}
+	id, err := s.ScheduleAt(ctx, cmd, now)
+	if err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+
+	t.Log("cancel the command while a failing handler handles it")
+	handler.handle = func() {
+		if err := s.Cancel(ctx, id); err != nil {
+			t.Error("there should be no error:", err)
+		}
+	}
+	if n, err := s.DispatchOnce(ctx); !errors.Is(err, handlerErr) || n != 0 {
+		t.Fatal("there should be a handler error:", n, err)
+	}
+
+	t.Log("dispatch after the retry delay")
+	handler.handle = nil
+	handler.err = nil
+	now = now.Add(time.Minute)
+	if n, err := s.DispatchOnce(ctx); err != nil || n != 0 {
+		t.Fatal("the cancelled command should not be dispatched:", n, err)
+	}
+	if len(handler.commands) != 1 {
+		t.Error("the command should be handled once:", handler.commands)
+	}
+}
+
+func TestSchedulerUnregisteredCommand(t *testing.T) {
+	s := NewScheduler(NewMemoryStore(), &commandHandler{})
+
+	cmd := &mocks.CommandOther{ID: eh.NewUUID(), Content: "cmd"}
+	_, err := s.ScheduleAfter(context.Background(), cmd, time.Minute)
+	if !errors.Is(err, ErrCouldNotSaveSchedule) || !errors.Is(err, eh.ErrCommandNotRegistered) {
+		t.Error("there should be a command not registered error:", err)
+	}
+}
+
+func TestSchedulerRun(t *testing.T) {
+	handler := &commandHandler{}
+	s := NewScheduler(NewMemoryStore(), handler, WithPollInterval(time.Millisecond))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	cmd := &mocks.Command{ID: eh.NewUUID(), Content: "cmd"}
+	if _, err := s.ScheduleAfter(ctx, cmd, 10*time.Millisecond); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+
+	errCh := make(chan error, 1)
+	go func() { errCh <- s.Run(ctx) }()
+
+	deadline := time.Now().Add(time.Second)
+	for len(handler.handled()) == 0 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	if !reflect.DeepEqual(handler.handled(), []eh.Command{cmd}) {
+		t.Error("the command should be handled:", handler.handled())
+	}
+
+	cancel()
+	if err := <-errCh; !errors.Is(err, context.Canceled) {
+		t.Error("there should be a context canceled error:", err)
+	}
+}
+
+type commandHandler struct {
+	commands []eh.Command
+	ctx      context.Context
+	err      error
+	handle   func()
+	mu       sync.Mutex
+}
+
+func (h *commandHandler) HandleCommand(ctx context.Context, cmd eh.Command) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.commands = append(h.commands, cmd)
+	h.ctx = ctx
+	if h.handle != nil {
+		h.handle()
+	}
+	return h.err
+}
+
+func (h *commandHandler) handled() []eh.Command {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	return append([]eh.Command(nil), h.commands...)
+}
@@ -73,10 +73,15 @@ func RegisterContextUnmarshaler(f ContextUnmarshalFunc) {
 
 // UnmarshalContext unmarshals a context from a map.
 func UnmarshalContext(vals map[string]interface{}) context.Context {
+	return UnmarshalContextWithParent(context.Background(), vals)
+}
+
+// UnmarshalContextWithParent unmarshals a context from a map, adding the values
+// to a parent context, for example to keep the deadline of a request.
+func UnmarshalContextWithParent(ctx context.Context, vals map[string]interface{}) context.Context {
 	contextUnmarshalFuncsMu.RLock()
 	defer contextUnmarshalFuncsMu.RUnlock()
 
-	ctx := context.Background()
 	if vals == nil {
 		return ctx
 	}
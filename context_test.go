@@ -69,6 +69,16 @@ func TestContextUnmarshaler(t *testing.T) {
 	if val, ok := ContextTestOne(ctx); !ok || val != "testval" {
 		t.Error("the unmarshaled context should be correct:", val)
 	}
+
+	parent, cancel := context.WithCancel(context.Background())
+	ctx = UnmarshalContextWithParent(parent, vals)
+	if val, ok := ContextTestOne(ctx); !ok || val != "testval" {
+		t.Error("the unmarshaled context should be correct:", val)
+	}
+	cancel()
+	if ctx.Err() != context.Canceled {
+		t.Error("the unmarshaled context should have the parent:", ctx.Err())
+	}
 }
 
 type contextTestKey int
@@ -0,0 +1,61 @@
+// Copyright (c) 2016 - Max Ekman <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package eventhorizon
+
+import "context"
+
+// CausationIDKey is the metadata key for the causation ID of an event, the ID
+// of the command or event that caused it.
+const CausationIDKey = "causation_id"
+
+// WithCorrelationID sets the correlation ID in the context, shared by all
+// commands and events that are caused by the same request.
+func WithCorrelationID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, correlationIDKey, id)
+}
+
+// CorrelationID returns the correlation ID from the context, or an empty ID if
+// none is set.
+func CorrelationID(ctx context.Context) string {
+	id, _ := ctx.Value(correlationIDKey).(string)
+	return id
+}
+
+// WithCausationID sets the causation ID in the context, the ID of the command
+// or event that is being handled.
+func WithCausationID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, causationIDKey, id)
+}
+
+// CausationID returns the causation ID from the context, or an empty ID if
+// none is set.
+func CausationID(ctx context.Context) string {
+	id, _ := ctx.Value(causationIDKey).(string)
+	return id
+}
+
+// WithEventCorrelation sets the correlation and causation IDs from the context
+// in the metadata of an event, for the CorrelationIDKey and CausationIDKey.
+// IDs that are not set in the context are not set in the metadata.
+func WithEventCorrelation(ctx context.Context) EventOption {
+	metadata := map[string]interface{}{}
+	if id := CorrelationID(ctx); id != "" {
+		metadata[CorrelationIDKey] = id
+	}
+	if id := CausationID(ctx); id != "" {
+		metadata[CausationIDKey] = id
+	}
+	return WithMetadata(metadata)
+}
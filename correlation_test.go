@@ -0,0 +1,59 @@
+// Copyright (c) 2016 - Max Ekman <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package eventhorizon
+
+import (
+	"context"
+	"testing"
+)
+
+func TestCorrelationIDs(t *testing.T) {
+	ctx := context.Background()
+	if id := CorrelationID(ctx); id != "" {
+		t.Error("there should be no correlation ID:", id)
+	}
+	if id := CausationID(ctx); id != "" {
+		t.Error("there should be no causation ID:", id)
+	}
+	e := NewEvent(TestEventType, nil, WithEventCorrelation(ctx))
+	if len(e.Metadata()) != 0 {
+		t.Error("there should be no metadata:", e.Metadata())
+	}
+
+	ctx = WithCorrelationID(ctx, "correlation")
+	ctx = WithCausationID(ctx, "causation")
+	if id := CorrelationID(ctx); id != "correlation" {
+		t.Error("the correlation ID should be correct:", id)
+	}
+	if id := CausationID(ctx); id != "causation" {
+		t.Error("the causation ID should be correct:", id)
+	}
+	e = NewEvent(TestEventType, nil, WithEventCorrelation(ctx))
+	if id := e.Metadata()[CorrelationIDKey]; id != "correlation" {
+		t.Error("the event should have the correlation ID:", id)
+	}
+	if id := e.Metadata()[CausationIDKey]; id != "causation" {
+		t.Error("the event should have the causation ID:", id)
+	}
+
+	t.Log("marshal the IDs")
+	ctx = UnmarshalContext(MarshalContext(ctx))
+	if id := CorrelationID(ctx); id != "correlation" {
+		t.Error("the correlation ID should be unmarshaled:", id)
+	}
+	if id := CausationID(ctx); id != "causation" {
+		t.Error("the causation ID should be unmarshaled:", id)
+	}
+}
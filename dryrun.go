@@ -0,0 +1,62 @@
+// Copyright (c) 2016 - Max Ekman <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package eventhorizon
+
+import (
+	"context"
+	"sync"
+)
+
+// WithDryRun returns a context for handling commands as a dry run, to see
+// what a command would do. The AggregateCommandHandler loads the aggregate and
+// handles the command, but does not save or publish the events. The events
+// can be read with DryRunEvents instead.
+func WithDryRun(ctx context.Context) context.Context {
+	return context.WithValue(ctx, dryRunKey, &dryRun{})
+}
+
+// IsDryRun returns if the context is for a dry run.
+func IsDryRun(ctx context.Context) bool {
+	_, ok := ctx.Value(dryRunKey).(*dryRun)
+	return ok
+}
+
+// DryRunEvents returns the events that the commands handled with a dry run
+// context would have saved, in the order they were created. Returns nil if
+// the context is not for a dry run.
+func DryRunEvents(ctx context.Context) []Event {
+	run, ok := ctx.Value(dryRunKey).(*dryRun)
+	if !ok {
+		return nil
+	}
+
+	run.mu.Lock()
+	defer run.mu.Unlock()
+
+	return append([]Event{}, run.events...)
+}
+
+// dryRun has the events of the commands handled in a dry run.
+type dryRun struct {
+	mu     sync.Mutex
+	events []Event
+}
+
+func (r *dryRun) add(events []Event) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.events = append(r.events, events...)
+}
@@ -18,6 +18,9 @@ package eventhorizon
 import (
 	"errors"
 	"fmt"
+	"sort"
+	"strconv"
+	"strings"
 	"sync"
 	"time"
 )
@@ -51,18 +54,82 @@ type Event interface {
 	AggregateID() UUID
 	// Version of the aggregate for this event (after it has been applied).
 	Version() int
+	// Metadata is optional data about the event, for example correlation IDs.
+	// It is nil if no metadata has been set.
+	Metadata() map[string]interface{}
 
 	// A string representation of the event.
 	String() string
 }
 
+// EventOption is an option to use when creating events.
+type EventOption func(*event)
+
+// WithMetadata adds metadata to an event, merged with any metadata already
+// set by previous options. Empty metadata is not set.
+func WithMetadata(metadata map[string]interface{}) EventOption {
+	return func(e *event) {
+		if len(metadata) == 0 {
+			return
+		}
+		if e.metadata == nil {
+			e.metadata = make(map[string]interface{}, len(metadata))
+		}
+		for k, v := range metadata {
+			e.metadata[k] = v
+		}
+	}
+}
+
+// EventIDKey is the metadata key for the id of an event set with WithEventID.
+const EventIDKey = "event_id"
+
+// EventIDGenerator derives the id of an event from the aggregate id and the
+// version of the event.
+type EventIDGenerator func(aggregateID UUID, version int) UUID
+
+// NamedEventIDs returns a generator of event ids that are UUIDs of type v5 in
+// a namespace, created by NewNamedUUID from the aggregate id and version. The
+// same event always gets the same id, so that an import can be run again
+// without creating new ids.
+func NamedEventIDs(namespace UUID) EventIDGenerator {
+	return func(aggregateID UUID, version int) UUID {
+		return NewNamedUUID(namespace, aggregateID.String()+":"+strconv.Itoa(version))
+	}
+}
+
+// WithEventID sets the id of an event in the metadata, for the EventIDKey,
+// derived by a generator. Events created by an aggregate get the id from the
+// aggregate id and the version of the event. Use EventID to get the id.
+func WithEventID(generator EventIDGenerator) EventOption {
+	return func(e *event) {
+		e.idGenerator = generator
+	}
+}
+
+// EventID returns the id of an event set with WithEventID, or an empty UUID if
+// the event has no id.
+func EventID(e Event) UUID {
+	if id, ok := e.Metadata()[EventIDKey].(string); ok {
+		return UUID(id)
+	}
+	return UUID("")
+}
+
 // NewEvent creates a new event with a type and data, setting its timestamp.
-func NewEvent(eventType EventType, data EventData) Event {
-	return event{
+func NewEvent(eventType EventType, data EventData, opts ...EventOption) Event {
+	e := &event{
 		eventType: eventType,
 		data:      data,
 		timestamp: time.Now(),
 	}
+
+	for _, opt := range opts {
+		opt(e)
+	}
+	e.setID()
+
+	return e
 }
 
 // event is an internal representation of an event, returned when the aggregate
@@ -75,6 +142,20 @@ type event struct {
 	aggregateType AggregateType
 	aggregateID   UUID
 	version       int
+	metadata      map[string]interface{}
+	idGenerator   EventIDGenerator
+}
+
+// setID sets the id of the event in the metadata if it has an id generator,
+// it must be called again when the aggregate id or version is changed.
+func (e *event) setID() {
+	if e.idGenerator == nil {
+		return
+	}
+	if e.metadata == nil {
+		e.metadata = map[string]interface{}{}
+	}
+	e.metadata[EventIDKey] = e.idGenerator(e.aggregateID, e.version).String()
 }
 
 // EventType implements the EventType method of the Event interface.
@@ -107,45 +188,366 @@ func (e event) Version() int {
 	return e.version
 }
 
+// Metadata implements the Metadata method of the Event interface.
+func (e event) Metadata() map[string]interface{} {
+	return e.metadata
+}
+
 // String implements the String method of the Event interface.
 func (e event) String() string {
 	return fmt.Sprintf("%s@%d", e.eventType, e.version)
 }
 
-var eventDataFactories = make(map[EventType]func() EventData)
+// eventDataKey is the key for the event data registry, with the event type
+// and the schema version of the event data.
+type eventDataKey struct {
+	eventType EventType
+	version   int
+}
+
+var eventDataFactories = make(map[eventDataKey]func() EventData)
+var eventDataVersions = make(map[EventType]int)
+var eventDataUpcasters = make(map[eventDataKey]Upcaster)
+var eventDataDowncasters = make(map[eventDataKey]Downcaster)
+var eventDataPublishVersions = make(map[EventType]int)
 var registerEventDataMu sync.RWMutex
 
 // ErrEventDataNotRegistered is when no event data factory was registered.
 var ErrEventDataNotRegistered = errors.New("event data not registered")
 
+// ErrUpcasterNotRegistered is when no upcaster was registered for an older
+// version of event data.
+var ErrUpcasterNotRegistered = errors.New("upcaster not registered")
+
+// Upcaster transforms event data of one schema version into the next version.
+type Upcaster func(EventData) (EventData, error)
+
 // RegisterEventData registers an event data factory for a type. The factory is
 // used to create concrete event data structs when loading from the database.
+// The event data is registered as schema version 1.
 //
 // An example would be:
 //     RegisterEventData(MyEventType, func() Event { return &MyEventData{} })
 func RegisterEventData(eventType EventType, factory func() EventData) {
+	RegisterVersionedEventData(eventType, 1, factory)
+}
+
+// RegisterVersionedEventData registers an event data factory for a type and a
+// schema version. The highest registered version is the current one, which
+// is used for new events. Older versions are created when loading events saved
+// with them, and are then upcasted to the current version.
+//
+// An example would be:
+//     RegisterVersionedEventData(MyEventType, 2, func() Event { return &MyEventDataV2{} })
+//     RegisterUpcaster(MyEventType, 1, upcastMyEventDataV1)
+func RegisterVersionedEventData(eventType EventType, version int, factory func() EventData) {
 	// TODO: Explore the use of reflect/gob for creating concrete types without
 	// a factory func.
 
 	if eventType == EventType("") {
 		panic("eventhorizon: attempt to register empty event type")
 	}
+	if version < 1 {
+		panic(fmt.Sprintf("eventhorizon: attempt to register invalid version %d for %q", version, eventType))
+	}
 
 	registerEventDataMu.Lock()
 	defer registerEventDataMu.Unlock()
-	if _, ok := eventDataFactories[eventType]; ok {
-		panic(fmt.Sprintf("eventhorizon: registering duplicate types for %q", eventType))
+	key := eventDataKey{eventType, version}
+	if _, ok := eventDataFactories[key]; ok {
+		if version == 1 {
+			panic(fmt.Sprintf("eventhorizon: registering duplicate types for %q", eventType))
+		}
+		panic(fmt.Sprintf("eventhorizon: registering duplicate types for %q version %d", eventType, version))
+	}
+	eventDataFactories[key] = factory
+	if version > eventDataVersions[eventType] {
+		eventDataVersions[eventType] = version
 	}
-	eventDataFactories[eventType] = factory
+}
+
+// RegisterUpcaster registers an upcaster that transforms event data of a type
+// from a schema version to the next version.
+func RegisterUpcaster(eventType EventType, fromVersion int, upcaster Upcaster) {
+	if eventType == EventType("") {
+		panic("eventhorizon: attempt to register empty event type")
+	}
+	if fromVersion < 1 {
+		panic(fmt.Sprintf("eventhorizon: attempt to register invalid version %d for %q", fromVersion, eventType))
+	}
+
+	registerEventDataMu.Lock()
+	defer registerEventDataMu.Unlock()
+	key := eventDataKey{eventType, fromVersion}
+	if _, ok := eventDataUpcasters[key]; ok {
+		panic(fmt.Sprintf("eventhorizon: registering duplicate upcasters for %q version %d", eventType, fromVersion))
+	}
+	eventDataUpcasters[key] = upcaster
 }
 
 // CreateEventData creates an event data of a type using the factory registered
-// with RegisterEventData.
+// with RegisterEventData, for the current schema version.
 func CreateEventData(eventType EventType) (EventData, error) {
+	return CreateVersionedEventData(eventType, EventDataVersion(eventType))
+}
+
+// CreateVersionedEventData creates an event data of a type and schema version
+// using the factory registered with RegisterVersionedEventData.
+func CreateVersionedEventData(eventType EventType, version int) (EventData, error) {
 	registerEventDataMu.RLock()
 	defer registerEventDataMu.RUnlock()
-	if factory, ok := eventDataFactories[eventType]; ok {
+	if factory, ok := eventDataFactories[eventDataKey{eventType, version}]; ok {
 		return factory(), nil
 	}
 	return nil, ErrEventDataNotRegistered
 }
+
+// EventDataVersion returns the current schema version of the event data for a
+// type, which is the highest registered version. Event data that has not been
+// registered is always version 1.
+func EventDataVersion(eventType EventType) int {
+	registerEventDataMu.RLock()
+	defer registerEventDataMu.RUnlock()
+	if version, ok := eventDataVersions[eventType]; ok {
+		return version
+	}
+	return 1
+}
+
+// UpcastEventData transforms event data of a type from a schema version to the
+// current version, by running the registered upcasters in sequence.
+func UpcastEventData(eventType EventType, version int, data EventData) (EventData, error) {
+	for v := version; v < EventDataVersion(eventType); v++ {
+		registerEventDataMu.RLock()
+		upcaster, ok := eventDataUpcasters[eventDataKey{eventType, v}]
+		registerEventDataMu.RUnlock()
+		if !ok {
+			return nil, ErrUpcasterNotRegistered
+		}
+
+		var err error
+		if data, err = upcaster(data); err != nil {
+			return nil, err
+		}
+	}
+	return data, nil
+}
+
+// ErrDowncasterNotRegistered is when no downcaster was registered for a newer
+// version of event data.
+var ErrDowncasterNotRegistered = errors.New("downcaster not registered")
+
+// Downcaster transforms event data of one schema version into the previous
+// version.
+type Downcaster func(EventData) (EventData, error)
+
+// RegisterDowncaster registers a downcaster that transforms event data of a
+// type from a schema version to the previous version. Downcasters are used by
+// the event buses to publish events with an older version, for services that
+// have not been upgraded yet.
+//
+// An example would be:
+//     RegisterDowncaster(MyEventType, 2, downcastMyEventDataV2)
+//     SetEventDataPublishVersion(MyEventType, 1)
+func RegisterDowncaster(eventType EventType, fromVersion int, downcaster Downcaster) {
+	if eventType == EventType("") {
+		panic("eventhorizon: attempt to register empty event type")
+	}
+	if fromVersion < 2 {
+		panic(fmt.Sprintf("eventhorizon: attempt to register invalid version %d for %q", fromVersion, eventType))
+	}
+
+	registerEventDataMu.Lock()
+	defer registerEventDataMu.Unlock()
+	key := eventDataKey{eventType, fromVersion}
+	if _, ok := eventDataDowncasters[key]; ok {
+		panic(fmt.Sprintf("eventhorizon: registering duplicate downcasters for %q version %d", eventType, fromVersion))
+	}
+	eventDataDowncasters[key] = downcaster
+}
+
+// DowncastEventData transforms event data of a type from a schema version to an
+// older version, by running the registered downcasters in sequence.
+func DowncastEventData(eventType EventType, version, toVersion int, data EventData) (EventData, error) {
+	for v := version; v > toVersion; v-- {
+		registerEventDataMu.RLock()
+		downcaster, ok := eventDataDowncasters[eventDataKey{eventType, v}]
+		registerEventDataMu.RUnlock()
+		if !ok {
+			return nil, ErrDowncasterNotRegistered
+		}
+
+		var err error
+		if data, err = downcaster(data); err != nil {
+			return nil, err
+		}
+	}
+	return data, nil
+}
+
+// SetEventDataPublishVersion sets the schema version of the event data of a
+// type that is published by the event buses, to be used during rolling deploys
+// while some consumers only know older versions. The event data is downcasted
+// to the version when published. Setting version 0 publishes the current
+// version again.
+func SetEventDataPublishVersion(eventType EventType, version int) {
+	if version < 0 {
+		panic(fmt.Sprintf("eventhorizon: attempt to set invalid publish version %d for %q", version, eventType))
+	}
+
+	registerEventDataMu.Lock()
+	defer registerEventDataMu.Unlock()
+	if version == 0 {
+		delete(eventDataPublishVersions, eventType)
+		return
+	}
+	eventDataPublishVersions[eventType] = version
+}
+
+// EventDataPublishVersion returns the schema version of the event data of a
+// type that is published by the event buses, which is the current version
+// unless another version has been set with SetEventDataPublishVersion.
+func EventDataPublishVersion(eventType EventType) int {
+	registerEventDataMu.RLock()
+	version, ok := eventDataPublishVersions[eventType]
+	registerEventDataMu.RUnlock()
+	if current := EventDataVersion(eventType); !ok || version > current {
+		return current
+	}
+	return version
+}
+
+// EventDataVersionKey is the key for the schema version of the event data in
+// the metadata of events sent by the event buses.
+const EventDataVersionKey = "data_version"
+
+// EncodeEventData prepares the event data of an event for publishing, to be
+// used by event buses before marshaling events. The data is downcasted to the
+// publish version of the event type, which is added to the returned metadata
+// for EventDataVersionKey. The metadata of the event is not modified.
+func EncodeEventData(event Event) (EventData, map[string]interface{}, error) {
+	data := event.Data()
+	if data == nil {
+		return nil, event.Metadata(), nil
+	}
+
+	version := EventDataPublishVersion(event.EventType())
+	if current := EventDataVersion(event.EventType()); version < current {
+		var err error
+		if data, err = DowncastEventData(event.EventType(), current, version, data); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	metadata := make(map[string]interface{}, len(event.Metadata())+1)
+	for k, v := range event.Metadata() {
+		metadata[k] = v
+	}
+	metadata[EventDataVersionKey] = version
+
+	return data, metadata, nil
+}
+
+// DecodeEventData creates the event data of a received event, to be used by
+// event buses after unmarshaling events. The event data is created for the
+// schema version in the metadata, or the current version if there is none,
+// unmarshaled with the unmarshal func and upcasted to the current version.
+// The version is removed from the returned metadata. Returns
+// ErrEventDataNotRegistered if there is no event data for the version.
+func DecodeEventData(eventType EventType, metadata map[string]interface{}, unmarshal func(EventData) error) (EventData, map[string]interface{}, error) {
+	version := EventDataVersion(eventType)
+	if v, ok := metadata[EventDataVersionKey]; ok {
+		switch v := v.(type) {
+		case int:
+			version = v
+		case int32:
+			version = int(v)
+		case int64:
+			version = int(v)
+		case float64:
+			version = int(v)
+		}
+	}
+
+	data, err := CreateVersionedEventData(eventType, version)
+	if err != nil {
+		return nil, metadata, err
+	}
+	if err := unmarshal(data); err != nil {
+		return nil, metadata, err
+	}
+	if data, err = UpcastEventData(eventType, version, data); err != nil {
+		return nil, metadata, err
+	}
+
+	if _, ok := metadata[EventDataVersionKey]; ok {
+		delete(metadata, EventDataVersionKey)
+		if len(metadata) == 0 {
+			metadata = nil
+		}
+	}
+
+	return data, metadata, nil
+}
+
+// RegistrationError is returned by ValidateRegistrations, with a description
+// of every problem that was found.
+type RegistrationError struct {
+	Problems []string
+}
+
+// Error implements the Error method of the errors.Error interface.
+func (e RegistrationError) Error() string {
+	return "invalid event registrations: " + strings.Join(e.Problems, ", ")
+}
+
+// ValidateRegistrations checks the registered event data, to be called at
+// startup after all event data has been registered. Each of the event types
+// must be registered, and every registered type must have event data for all
+// versions up to the current one, with upcasters between them, and downcasters
+// down to the publish version if one has been set. Returns a
+// RegistrationError describing all problems, or nil if there are none.
+func ValidateRegistrations(eventTypes ...EventType) error {
+	registerEventDataMu.RLock()
+	defer registerEventDataMu.RUnlock()
+
+	var problems []string
+	for _, eventType := range eventTypes {
+		if _, ok := eventDataVersions[eventType]; !ok {
+			problems = append(problems, fmt.Sprintf("%q is not registered", eventType))
+		}
+	}
+
+	for eventType, current := range eventDataVersions {
+		for v := 1; v <= current; v++ {
+			factory, ok := eventDataFactories[eventDataKey{eventType, v}]
+			if !ok {
+				problems = append(problems, fmt.Sprintf("%q has no event data for version %d", eventType, v))
+			} else if factory() == nil {
+				problems = append(problems, fmt.Sprintf("%q creates nil event data for version %d", eventType, v))
+			}
+			if _, ok := eventDataUpcasters[eventDataKey{eventType, v}]; v < current && !ok {
+				problems = append(problems, fmt.Sprintf("%q has no upcaster from version %d", eventType, v))
+			}
+		}
+		if publish, ok := eventDataPublishVersions[eventType]; ok {
+			for v := current; v > publish; v-- {
+				if _, ok := eventDataDowncasters[eventDataKey{eventType, v}]; !ok {
+					problems = append(problems, fmt.Sprintf("%q has no downcaster from version %d", eventType, v))
+				}
+			}
+		}
+	}
+
+	for key := range eventDataUpcasters {
+		if key.version >= eventDataVersions[key.eventType] {
+			problems = append(problems, fmt.Sprintf("%q has an upcaster from version %d without a later version", key.eventType, key.version))
+		}
+	}
+
+	if len(problems) == 0 {
+		return nil
+	}
+	sort.Strings(problems)
+	return RegistrationError{Problems: problems}
+}
@@ -16,6 +16,8 @@ package eventhorizon
 
 import (
 	"reflect"
+	"sort"
+	"strings"
 	"testing"
 )
 
@@ -37,6 +39,88 @@ func TestNewEvent(t *testing.T) {
 	if event.String() != "TestEvent@0" {
 		t.Error("the string representation should be correct:", event.String())
 	}
+	if event.Metadata() != nil {
+		t.Error("there should be no metadata:", event.Metadata())
+	}
+}
+
+func TestNewEventWithMetadata(t *testing.T) {
+	event := NewEvent(TestEventType, &TestEventData{"event1"},
+		WithMetadata(map[string]interface{}{"correlation_id": "correlation1"}),
+		WithMetadata(map[string]interface{}{"causation_id": "causation1"}),
+	)
+	expected := map[string]interface{}{
+		"correlation_id": "correlation1",
+		"causation_id":   "causation1",
+	}
+	if !reflect.DeepEqual(event.Metadata(), expected) {
+		t.Error("the metadata should be correct:", event.Metadata())
+	}
+
+	event = NewEvent(TestEventType, &TestEventData{"event1"},
+		WithMetadata(map[string]interface{}{}),
+	)
+	if event.Metadata() != nil {
+		t.Error("there should be no metadata:", event.Metadata())
+	}
+}
+
+func TestNewEventWithEventID(t *testing.T) {
+	ns := NewUUID()
+	id := NewUUID()
+	agg := NewTestAggregate(id)
+
+	t.Log("derive the same id for the same aggregate id and version")
+	event1 := agg.NewEvent(TestEventType, &TestEventData{"event1"},
+		WithMetadata(map[string]interface{}{"correlation_id": "correlation1"}),
+		WithEventID(NamedEventIDs(ns)),
+	)
+	event2 := agg.NewEvent(TestEventType, &TestEventData{"event2"},
+		WithEventID(NamedEventIDs(ns)),
+	)
+	if EventID(event1) == UUID("") {
+		t.Error("the event should have an id")
+	}
+	if EventID(event1) != EventID(event2) {
+		t.Error("the event ids should be the same:", EventID(event1), EventID(event2))
+	}
+	if EventID(event1) != NewNamedUUID(ns, id.String()+":1") {
+		t.Error("the event id should be correct:", EventID(event1))
+	}
+	if event1.Metadata()["correlation_id"] != "correlation1" {
+		t.Error("the other metadata should be kept:", event1.Metadata())
+	}
+
+	t.Log("derive another id for another version")
+	event3 := agg.AppendEvent(TestEventType, &TestEventData{"event1"},
+		WithEventID(NamedEventIDs(ns)),
+	)
+	event4 := agg.AppendEvent(TestEventType, &TestEventData{"event2"},
+		WithEventID(NamedEventIDs(ns)),
+	)
+	if EventID(event3) != EventID(event1) {
+		t.Error("the event ids should be the same:", EventID(event3))
+	}
+	if EventID(event4) == EventID(event3) {
+		t.Error("the event ids should not be the same:", EventID(event4))
+	}
+
+	t.Log("derive another id for another aggregate")
+	event5 := NewTestAggregate(NewUUID()).NewEvent(TestEventType, &TestEventData{"event1"},
+		WithEventID(NamedEventIDs(ns)),
+	)
+	if EventID(event5) == EventID(event1) {
+		t.Error("the event ids should not be the same:", EventID(event5))
+	}
+
+	t.Log("have no id without the option")
+	event6 := agg.NewEvent(TestEventType, &TestEventData{"event1"})
+	if EventID(event6) != UUID("") {
+		t.Error("the event should have no id:", EventID(event6))
+	}
+	if event6.Metadata() != nil {
+		t.Error("there should be no metadata:", event6.Metadata())
+	}
 }
 
 func TestCreateEventData(t *testing.T) {
@@ -83,10 +167,352 @@ func TestRegisterEventTwice(t *testing.T) {
 	})
 }
 
+func TestCreateVersionedEventData(t *testing.T) {
+	RegisterEventData(TestEventRegisterVersionedType, func() EventData {
+		return &TestEventRegisterVersioned{}
+	})
+	if v := EventDataVersion(TestEventRegisterVersionedType); v != 1 {
+		t.Error("the version should be 1:", v)
+	}
+
+	RegisterVersionedEventData(TestEventRegisterVersionedType, 2, func() EventData {
+		return &TestEventRegisterVersionedV2{}
+	})
+	if v := EventDataVersion(TestEventRegisterVersionedType); v != 2 {
+		t.Error("the version should be 2:", v)
+	}
+
+	data, err := CreateEventData(TestEventRegisterVersionedType)
+	if err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if _, ok := data.(*TestEventRegisterVersionedV2); !ok {
+		t.Errorf("the event type should be correct: %T", data)
+	}
+
+	data, err = CreateVersionedEventData(TestEventRegisterVersionedType, 1)
+	if err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if _, ok := data.(*TestEventRegisterVersioned); !ok {
+		t.Errorf("the event type should be correct: %T", data)
+	}
+
+	data, err = CreateVersionedEventData(TestEventRegisterVersionedType, 3)
+	if err != ErrEventDataNotRegistered {
+		t.Error("there should be a event not registered error:", err)
+	}
+}
+
+func TestUpcastEventData(t *testing.T) {
+	RegisterEventData(TestEventUpcastType, func() EventData {
+		return &TestEventUpcast{}
+	})
+	RegisterVersionedEventData(TestEventUpcastType, 2, func() EventData {
+		return &TestEventUpcast{}
+	})
+	RegisterVersionedEventData(TestEventUpcastType, 3, func() EventData {
+		return &TestEventUpcast{}
+	})
+
+	data, err := UpcastEventData(TestEventUpcastType, 1, &TestEventUpcast{})
+	if err != ErrUpcasterNotRegistered {
+		t.Error("there should be a upcaster not registered error:", err)
+	}
+	if data != nil {
+		t.Error("there should be no data:", data)
+	}
+
+	upcaster := func(data EventData) (EventData, error) {
+		d := data.(*TestEventUpcast)
+		return &TestEventUpcast{Upcasts: append(d.Upcasts, len(d.Upcasts)+1)}, nil
+	}
+	RegisterUpcaster(TestEventUpcastType, 1, upcaster)
+	RegisterUpcaster(TestEventUpcastType, 2, upcaster)
+
+	data, err = UpcastEventData(TestEventUpcastType, 1, &TestEventUpcast{})
+	if err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if !reflect.DeepEqual(data, &TestEventUpcast{Upcasts: []int{1, 2}}) {
+		t.Error("the data should be upcasted in sequence:", data)
+	}
+
+	data, err = UpcastEventData(TestEventUpcastType, 3, &TestEventUpcast{})
+	if err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if !reflect.DeepEqual(data, &TestEventUpcast{}) {
+		t.Error("the data should not be upcasted:", data)
+	}
+}
+
+func TestRegisterEventInvalidVersion(t *testing.T) {
+	defer func() {
+		if r := recover(); r == nil || r != "eventhorizon: attempt to register invalid version 0 for \"TestEventRegisterInvalidVersion\"" {
+			t.Error("there should have been a panic:", r)
+		}
+	}()
+	RegisterVersionedEventData(TestEventRegisterInvalidVersionType, 0, func() EventData {
+		return &TestEventRegister{}
+	})
+}
+
+func TestDowncastEventData(t *testing.T) {
+	RegisterEventData(TestEventDowncastType, func() EventData {
+		return &TestEventDowncast{}
+	})
+	RegisterVersionedEventData(TestEventDowncastType, 2, func() EventData {
+		return &TestEventDowncast{}
+	})
+	RegisterVersionedEventData(TestEventDowncastType, 3, func() EventData {
+		return &TestEventDowncast{}
+	})
+
+	data, err := DowncastEventData(TestEventDowncastType, 3, 1, &TestEventDowncast{})
+	if err != ErrDowncasterNotRegistered {
+		t.Error("there should be a downcaster not registered error:", err)
+	}
+	if data != nil {
+		t.Error("there should be no data:", data)
+	}
+
+	downcaster := func(data EventData) (EventData, error) {
+		d := data.(*TestEventDowncast)
+		return &TestEventDowncast{Downcasts: append(d.Downcasts, len(d.Downcasts)+1)}, nil
+	}
+	RegisterDowncaster(TestEventDowncastType, 3, downcaster)
+	RegisterDowncaster(TestEventDowncastType, 2, downcaster)
+
+	data, err = DowncastEventData(TestEventDowncastType, 3, 1, &TestEventDowncast{})
+	if err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if !reflect.DeepEqual(data, &TestEventDowncast{Downcasts: []int{1, 2}}) {
+		t.Error("the data should be downcasted in sequence:", data)
+	}
+
+	data, err = DowncastEventData(TestEventDowncastType, 3, 3, &TestEventDowncast{})
+	if err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if !reflect.DeepEqual(data, &TestEventDowncast{}) {
+		t.Error("the data should not be downcasted:", data)
+	}
+}
+
+func TestRegisterDowncasterInvalidVersion(t *testing.T) {
+	defer func() {
+		if r := recover(); r == nil || r != "eventhorizon: attempt to register invalid version 1 for \"TestEventDowncastInvalidVersion\"" {
+			t.Error("there should have been a panic:", r)
+		}
+	}()
+	RegisterDowncaster(TestEventDowncastInvalidVersionType, 1, func(data EventData) (EventData, error) {
+		return data, nil
+	})
+}
+
+func TestEventDataPublishVersion(t *testing.T) {
+	RegisterEventData(TestEventPublishVersionType, func() EventData {
+		return &TestEventRegister{}
+	})
+	RegisterVersionedEventData(TestEventPublishVersionType, 2, func() EventData {
+		return &TestEventRegister{}
+	})
+	if v := EventDataPublishVersion(TestEventPublishVersionType); v != 2 {
+		t.Error("the publish version should be the current version:", v)
+	}
+
+	SetEventDataPublishVersion(TestEventPublishVersionType, 1)
+	if v := EventDataPublishVersion(TestEventPublishVersionType); v != 1 {
+		t.Error("the publish version should be set:", v)
+	}
+
+	SetEventDataPublishVersion(TestEventPublishVersionType, 3)
+	if v := EventDataPublishVersion(TestEventPublishVersionType); v != 2 {
+		t.Error("the publish version should not be newer than the current version:", v)
+	}
+
+	SetEventDataPublishVersion(TestEventPublishVersionType, 0)
+	if v := EventDataPublishVersion(TestEventPublishVersionType); v != 2 {
+		t.Error("the publish version should be reset:", v)
+	}
+}
+
+func TestEncodeDecodeEventData(t *testing.T) {
+	RegisterEventData(TestEventCodecType, func() EventData {
+		return &TestEventCodec{}
+	})
+	RegisterVersionedEventData(TestEventCodecType, 2, func() EventData {
+		return &TestEventCodecV2{}
+	})
+	RegisterUpcaster(TestEventCodecType, 1, func(data EventData) (EventData, error) {
+		d := data.(*TestEventCodec)
+		parts := strings.SplitN(d.Name, " ", 2)
+		return &TestEventCodecV2{FirstName: parts[0], LastName: parts[len(parts)-1]}, nil
+	})
+	RegisterDowncaster(TestEventCodecType, 2, func(data EventData) (EventData, error) {
+		d := data.(*TestEventCodecV2)
+		return &TestEventCodec{Name: d.FirstName + " " + d.LastName}, nil
+	})
+	defer SetEventDataPublishVersion(TestEventCodecType, 0)
+
+	event := NewEvent(TestEventCodecType, &TestEventCodecV2{"John", "Doe"},
+		WithMetadata(map[string]interface{}{"num": 42}),
+	)
+
+	t.Log("encode with the current version")
+	data, metadata, err := EncodeEventData(event)
+	if err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if !reflect.DeepEqual(data, &TestEventCodecV2{"John", "Doe"}) {
+		t.Error("the data should not be downcasted:", data)
+	}
+	if !reflect.DeepEqual(metadata, map[string]interface{}{"num": 42, EventDataVersionKey: 2}) {
+		t.Error("the metadata should have the data version:", metadata)
+	}
+	if _, ok := event.Metadata()[EventDataVersionKey]; ok {
+		t.Error("the metadata of the event should not be modified:", event.Metadata())
+	}
+
+	t.Log("encode with an old version for old consumers")
+	SetEventDataPublishVersion(TestEventCodecType, 1)
+	data, metadata, err = EncodeEventData(event)
+	if err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if !reflect.DeepEqual(data, &TestEventCodec{"John Doe"}) {
+		t.Error("the data should be downcasted:", data)
+	}
+	if metadata[EventDataVersionKey] != 1 {
+		t.Error("the metadata should have the old data version:", metadata)
+	}
+
+	t.Log("decode an old version on new consumers")
+	unmarshal := func(d EventData) error {
+		d.(*TestEventCodec).Name = "John Doe"
+		return nil
+	}
+	data, metadata, err = DecodeEventData(TestEventCodecType,
+		map[string]interface{}{EventDataVersionKey: float64(1)}, unmarshal)
+	if err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if !reflect.DeepEqual(data, &TestEventCodecV2{"John", "Doe"}) {
+		t.Error("the data should be upcasted:", data)
+	}
+	if metadata != nil {
+		t.Error("the data version should be removed from the metadata:", metadata)
+	}
+
+	t.Log("decode the current version without a data version")
+	unmarshal = func(d EventData) error {
+		*d.(*TestEventCodecV2) = TestEventCodecV2{"Jane", "Doe"}
+		return nil
+	}
+	data, metadata, err = DecodeEventData(TestEventCodecType,
+		map[string]interface{}{"num": 42}, unmarshal)
+	if err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if !reflect.DeepEqual(data, &TestEventCodecV2{"Jane", "Doe"}) {
+		t.Error("the data should be decoded:", data)
+	}
+	if !reflect.DeepEqual(metadata, map[string]interface{}{"num": 42}) {
+		t.Error("the metadata should be kept:", metadata)
+	}
+
+	t.Log("decode an unknown version")
+	data, _, err = DecodeEventData(TestEventCodecType,
+		map[string]interface{}{EventDataVersionKey: 3}, unmarshal)
+	if err != ErrEventDataNotRegistered {
+		t.Error("there should be a event data not registered error:", err)
+	}
+	if data != nil {
+		t.Error("there should be no data:", data)
+	}
+}
+
+func TestValidateRegistrations(t *testing.T) {
+	RegisterVersionedEventData(TestEventValidateType, 2, func() EventData {
+		return &TestEventRegister{}
+	})
+	RegisterEventData(TestEventValidateNilType, func() EventData {
+		return nil
+	})
+	RegisterEventData(TestEventValidateUpcastType, func() EventData {
+		return &TestEventRegister{}
+	})
+	RegisterUpcaster(TestEventValidateUpcastType, 1, func(data EventData) (EventData, error) {
+		return data, nil
+	})
+	RegisterEventData(TestEventValidateDowncastType, func() EventData {
+		return &TestEventRegister{}
+	})
+	RegisterVersionedEventData(TestEventValidateDowncastType, 2, func() EventData {
+		return &TestEventRegister{}
+	})
+	RegisterUpcaster(TestEventValidateDowncastType, 1, func(data EventData) (EventData, error) {
+		return data, nil
+	})
+	SetEventDataPublishVersion(TestEventValidateDowncastType, 1)
+
+	err := ValidateRegistrations(TestEventValidateType, TestEventValidateMissingType)
+	regErr, ok := err.(RegistrationError)
+	if !ok {
+		t.Fatal("there should be a registration error:", err)
+	}
+	for _, problem := range []string{
+		`"TestEventValidate" has no event data for version 1`,
+		`"TestEventValidate" has no upcaster from version 1`,
+		`"TestEventValidateDowncast" has no downcaster from version 2`,
+		`"TestEventValidateMissing" is not registered`,
+		`"TestEventValidateNil" creates nil event data for version 1`,
+		`"TestEventValidateUpcast" has an upcaster from version 1 without a later version`,
+	} {
+		found := false
+		for _, p := range regErr.Problems {
+			if p == problem {
+				found = true
+			}
+		}
+		if !found {
+			t.Error("the problem should be reported:", problem, regErr.Problems)
+		}
+	}
+	for _, p := range regErr.Problems {
+		if strings.Contains(p, `"TestEventRegister"`) {
+			t.Error("there should be no problem for a valid registration:", p)
+		}
+	}
+	if !strings.HasPrefix(err.Error(), "invalid event registrations: ") {
+		t.Error("the error message should be correct:", err)
+	}
+	if !sort.StringsAreSorted(regErr.Problems) {
+		t.Error("the problems should be sorted:", regErr.Problems)
+	}
+}
+
 const (
 	TestEventRegisterType      EventType = "TestEventRegister"
 	TestEventRegisterEmptyType EventType = ""
 	TestEventRegisterTwiceType EventType = "TestEventRegisterTwice"
+
+	TestEventRegisterVersionedType      EventType = "TestEventRegisterVersioned"
+	TestEventRegisterInvalidVersionType EventType = "TestEventRegisterInvalidVersion"
+	TestEventUpcastType                 EventType = "TestEventUpcast"
+	TestEventDowncastType               EventType = "TestEventDowncast"
+	TestEventDowncastInvalidVersionType EventType = "TestEventDowncastInvalidVersion"
+	TestEventPublishVersionType         EventType = "TestEventPublishVersion"
+	TestEventCodecType                  EventType = "TestEventCodec"
+
+	TestEventValidateType        EventType = "TestEventValidate"
+	TestEventValidateMissingType EventType = "TestEventValidateMissing"
+	TestEventValidateNilType     EventType = "TestEventValidateNil"
+	TestEventValidateUpcastType  EventType = "TestEventValidateUpcast"
+
+	TestEventValidateDowncastType EventType = "TestEventValidateDowncast"
 )
 
 type TestEventRegister struct{}
@@ -94,3 +520,24 @@ type TestEventRegister struct{}
 type TestEventRegisterEmpty struct{}
 
 type TestEventRegisterTwice struct{}
+
+type TestEventRegisterVersioned struct{}
+
+type TestEventRegisterVersionedV2 struct{}
+
+type TestEventUpcast struct {
+	Upcasts []int
+}
+
+type TestEventDowncast struct {
+	Downcasts []int
+}
+
+type TestEventCodec struct {
+	Name string
+}
+
+type TestEventCodecV2 struct {
+	FirstName string
+	LastName  string
+}
@@ -14,7 +14,29 @@
 
 package eventhorizon
 
-import "context"
+import (
+	"context"
+	"errors"
+)
+
+// EventPublisher is a publisher of events, for example an event bus.
+type EventPublisher interface {
+	// PublishEvent publishes an event, returning an error if it could not be
+	// published.
+	PublishEvent(context.Context, Event) error
+}
+
+// EventCodec is a codec for marshaling events, with the values of the context
+// that have registered marshalers, for example by the event buses that send
+// events to other services. The codecs decide the format of the events in one
+// place, and can be replaced to use another format.
+type EventCodec interface {
+	// MarshalEvent marshals an event and the context.
+	MarshalEvent(context.Context, Event) ([]byte, error)
+	// UnmarshalEvent unmarshals an event and the context, with concrete event
+	// data if the event type is registered.
+	UnmarshalEvent([]byte) (context.Context, Event, error)
+}
 
 // EventBus is an interface defining an event bus for distributing events.
 type EventBus interface {
@@ -22,7 +44,7 @@ type EventBus interface {
 	// Only one handler of each handler type that is registered for the event
 	// will receive it.
 	// All the observers will receive the event.
-	PublishEvent(context.Context, Event)
+	EventPublisher
 
 	// AddHandler adds a handler for an event.
 	// TODO: Use a pattern instead of event for what to handle.
@@ -35,16 +57,91 @@ type EventBus interface {
 	SetHandlingStrategy(EventHandlingStrategy)
 }
 
+// ErrInvalidPosition is when a position is not valid for the event bus.
+var ErrInvalidPosition = errors.New("invalid position")
+
+// EventSubscriber is an event bus that can subscribe handlers from a position
+// in the published events, for durable consumers in other services that
+// resume after downtime. The positions are specific to each event bus.
+type EventSubscriber interface {
+	// SubscribeFrom subscribes the handler to the events matching the matcher,
+	// or to all events for a nil matcher, that are published after the
+	// position, or to all published events for an empty position. The events are handled in order, a failed event is
+	// retried until it is handled. If the bus has a CheckpointStore the
+	// position of every handled event is committed for the handler type, and
+	// a handler type with a committed position resumes after it instead of
+	// the position. The subscription stops when the context is canceled or
+	// the bus is closed.
+	SubscribeFrom(ctx context.Context, position string, matcher EventMatcher, handler EventHandler) error
+}
+
+// CheckpointStore stores the positions that the consumers of an event bus
+// have committed, to resume after them when restarted.
+type CheckpointStore interface {
+	// LoadCheckpoint loads the position committed by a consumer, or an empty
+	// position if it has not committed any.
+	LoadCheckpoint(ctx context.Context, consumer string) (string, error)
+	// SaveCheckpoint commits the position of the last event that a consumer
+	// has handled.
+	SaveCheckpoint(ctx context.Context, consumer, position string) error
+}
+
+// EventMatcher is a func that matches events, for example by event type, to
+// select which events a handler should receive.
+type EventMatcher func(Event) bool
+
+// MatchAny matches any event.
+func MatchAny() EventMatcher {
+	return func(e Event) bool {
+		return true
+	}
+}
+
+// MatchEvent matches events of any of the event types.
+func MatchEvent(types ...EventType) EventMatcher {
+	return func(e Event) bool {
+		for _, t := range types {
+			if e.EventType() == t {
+				return true
+			}
+		}
+		return false
+	}
+}
+
 // EventHandler is a handler of events.
 // Only one handler of the same type will receive an event.
 type EventHandler interface {
 	// HandleEvent handles an event.
-	HandleEvent(context.Context, Event)
+	HandleEvent(context.Context, Event) error
 
 	// HandlerType returns the type of the handler.
 	HandlerType() EventHandlerType
 }
 
+// DeadLetterHandler is a handler of events that an event handler failed to
+// handle, for example to store them for later reprocessing.
+type DeadLetterHandler interface {
+	// HandleDeadLetter handles an event that the handler failed to handle
+	// with the error.
+	HandleDeadLetter(ctx context.Context, event Event, handler EventHandler, err error) error
+}
+
+// EventHandlerMiddleware is a function that middlewares can implement to be
+// able to chain. The returned handler should keep the handler type of the
+// wrapped handler, for example by embedding it.
+type EventHandlerMiddleware func(EventHandler) EventHandler
+
+// UseEventHandlerMiddleware wraps a EventHandler in one or more middleware.
+// The first middleware is the outermost, handling the event first.
+func UseEventHandlerMiddleware(h EventHandler, middleware ...EventHandlerMiddleware) EventHandler {
+	// Apply in reverse order.
+	for i := len(middleware) - 1; i >= 0; i-- {
+		h = middleware[i](h)
+	}
+	return h
+}
+
 // EventHandlerType is the type of an event handler. Used to serve only handle
 // an event by one handler of each type.
 type EventHandlerType string
@@ -0,0 +1,53 @@
+// Copyright (c) 2016 - Max Ekman <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package checkpoint
+
+import (
+	"context"
+	"sync"
+)
+
+// MemoryStore is a CheckpointStore that keeps the positions in memory, for
+// tests and consumers that only need to resume within the same process.
+type MemoryStore struct {
+	positions map[string]string
+	mu        sync.RWMutex
+}
+
+// NewMemoryStore creates a new MemoryStore.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		positions: map[string]string{},
+	}
+}
+
+// LoadCheckpoint implements the LoadCheckpoint method of the
+// eventhorizon.CheckpointStore interface.
+func (s *MemoryStore) LoadCheckpoint(ctx context.Context, consumer string) (string, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.positions[consumer], nil
+}
+
+// SaveCheckpoint implements the SaveCheckpoint method of the
+// eventhorizon.CheckpointStore interface.
+func (s *MemoryStore) SaveCheckpoint(ctx context.Context, consumer, position string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.positions[consumer] = position
+	return nil
+}
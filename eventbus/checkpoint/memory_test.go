@@ -0,0 +1,53 @@
+// Copyright (c) 2016 - Max Ekman <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package checkpoint
+
+import (
+	"context"
+	"testing"
+
+	eh "github.com/looplab/eventhorizon"
+)
+
+func TestMemoryStore(t *testing.T) {
+	var store eh.CheckpointStore = NewMemoryStore()
+	ctx := context.Background()
+
+	t.Log("load a checkpoint that is not committed")
+	position, err := store.LoadCheckpoint(ctx, "consumer1")
+	if err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if position != "" {
+		t.Error("the position should be empty:", position)
+	}
+
+	t.Log("commit and load checkpoints")
+	if err := store.SaveCheckpoint(ctx, "consumer1", "1"); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if err := store.SaveCheckpoint(ctx, "consumer1", "2"); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if err := store.SaveCheckpoint(ctx, "consumer2", "5"); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if position, err := store.LoadCheckpoint(ctx, "consumer1"); err != nil || position != "2" {
+		t.Error("the last committed position should be loaded:", position, err)
+	}
+	if position, err := store.LoadCheckpoint(ctx, "consumer2"); err != nil || position != "5" {
+		t.Error("the committed position should be loaded:", position, err)
+	}
+}
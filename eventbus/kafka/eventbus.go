@@ -0,0 +1,510 @@
+// Copyright (c) 2016 - Max Ekman <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kafka
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+
+	eh "github.com/looplab/eventhorizon"
+	"github.com/looplab/eventhorizon/eventstore/codec"
+)
+
+// ErrNoBrokers is when an event bus is created without brokers.
+var ErrNoBrokers = errors.New("no brokers")
+
+// ErrCouldNotMarshalEvent is when an event could not be marshaled with the codec.
+var ErrCouldNotMarshalEvent = errors.New("could not marshal event")
+
+// ErrCouldNotUnmarshalEvent is when an event could not be unmarshaled into a concrete type.
+var ErrCouldNotUnmarshalEvent = errors.New("could not unmarshal event")
+
+// EventBus is an event bus that publishes events on a Kafka topic per app ID,
+// keyed by the aggregate ID. All events of an aggregate are therefore on the
+// same partition, and handled in the order they were published. Handlers are
+// subscribed with a consumer group per handler type, shared by all buses with
+// the same app ID, and the offsets are only committed when an event has been
+// handled. Observers receive all events published after the bus was created.
+// Consumers subscribed with SubscribeFrom use the offsets of the events in
+// each partition as position. It will use the SimpleEventHandlingStrategy by
+// default, the
+// AsyncEventHandlingStrategy is only used for observers to keep the order of
+// events for the handlers.
+type EventBus struct {
+	handlers  map[eh.EventHandlerType]map[eh.EventType]eh.EventHandler
+	observers map[eh.EventObserver]bool
+
+	// handlerMu guards all maps at once for concurrent writes. No need for
+	// separate mutexes per map for this as AddHandler/AddObserver is often
+	// called at program init and not at run time.
+	handlerMu sync.RWMutex
+
+	// handlingStrategy is the strategy to use when handling event, for example
+	// to handle the asynchronously.
+	handlingStrategy eh.EventHandlingStrategy
+
+	appID       string
+	brokers     []string
+	topic       string
+	writer      *kafka.Writer
+	codec       eh.EventCodec
+	checkpoints eh.CheckpointStore
+
+	// retryDelay is the time to wait before handling an event again if the
+	// handler failed to handle it.
+	retryDelay time.Duration
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// Option is an option setter used to configure creation.
+type Option func(*EventBus)
+
+// WithCodec uses a codec to marshal the events, instead of the default
+// codec.JSONEventCodec. All buses with the same app ID must use the same codec.
+func WithCodec(c eh.EventCodec) Option {
+	return func(b *EventBus) {
+		b.codec = c
+	}
+}
+
+// WithCheckpointStore commits the positions of the consumers subscribed with
+// SubscribeFrom to the store, to resume after them when restarted.
+func WithCheckpointStore(s eh.CheckpointStore) Option {
+	return func(b *EventBus) {
+		b.checkpoints = s
+	}
+}
+
+// NewEventBus creates a EventBus for remote events, using the Kafka brokers.
+// The topic is created by the brokers when first used, if they allow it.
+func NewEventBus(appID string, brokers []string, opts ...Option) (*EventBus, error) {
+	if len(brokers) == 0 {
+		return nil, ErrNoBrokers
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	b := &EventBus{
+		handlers:   make(map[eh.EventHandlerType]map[eh.EventType]eh.EventHandler),
+		observers:  make(map[eh.EventObserver]bool),
+		appID:      appID,
+		brokers:    brokers,
+		topic:      appID + "_events",
+		codec:      codec.JSONEventCodec{},
+		retryDelay: time.Second,
+		ctx:        ctx,
+		cancel:     cancel,
+	}
+
+	for _, opt := range opts {
+		opt(b)
+	}
+
+	b.writer = &kafka.Writer{
+		Addr:                   kafka.TCP(brokers...),
+		Topic:                  b.topic,
+		Balancer:               &kafka.Hash{},
+		RequiredAcks:           kafka.RequireAll,
+		AllowAutoTopicCreation: true,
+	}
+
+	// Observers receive all events, from a group of their own that only
+	// starts with new events. The group is not reused after the bus is closed.
+	reader := kafka.NewReader(kafka.ReaderConfig{
+		Brokers:     brokers,
+		Topic:       b.topic,
+		GroupID:     appID + "_observer_" + eh.NewUUID().String(),
+		StartOffset: kafka.LastOffset,
+	})
+	b.wg.Add(1)
+	go b.observe(reader)
+
+	return b, nil
+}
+
+// SetHandlingStrategy implements the SetHandlingStrategy method of the
+// eventhorizon.EventBus interface.
+func (b *EventBus) SetHandlingStrategy(strategy eh.EventHandlingStrategy) {
+	b.handlingStrategy = strategy
+}
+
+// PublishEvent publishes an event on the topic, keyed by the aggregate ID.
+// The event is written to all in sync replicas before returning.
+func (b *EventBus) PublishEvent(ctx context.Context, event eh.Event) error {
+	data, err := b.marshalEvent(ctx, event)
+	if err != nil {
+		return err
+	}
+
+	if err := b.writer.WriteMessages(ctx, kafka.Message{
+		Key:   []byte(event.AggregateID().String()),
+		Value: data,
+	}); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// AddHandler implements the AddHandler method of the eventhorizon.EventBus
+// interface. The first time a handler type is added a consumer for its group
+// is started.
+func (b *EventBus) AddHandler(handler eh.EventHandler, eventType eh.EventType) {
+	b.handlerMu.Lock()
+	defer b.handlerMu.Unlock()
+
+	handlerType := handler.HandlerType()
+	if _, ok := b.handlers[handlerType]; ok {
+		b.handlers[handlerType][eventType] = handler
+		return
+	}
+	b.handlers[handlerType] = map[eh.EventType]eh.EventHandler{
+		eventType: handler,
+	}
+
+	// Let all buses with handlers of the same type share the group, new
+	// groups start with the first event in the topic.
+	reader := kafka.NewReader(kafka.ReaderConfig{
+		Brokers:     b.brokers,
+		Topic:       b.topic,
+		GroupID:     b.appID + "_" + string(handlerType),
+		StartOffset: kafka.FirstOffset,
+	})
+	b.wg.Add(1)
+	go b.handle(handlerType, reader)
+}
+
+// AddObserver implements the AddObserver method of the eventhorizon.EventBus interface.
+func (b *EventBus) AddObserver(observer eh.EventObserver) {
+	b.handlerMu.Lock()
+	defer b.handlerMu.Unlock()
+
+	b.observers[observer] = true
+}
+
+// SubscribeFrom implements the SubscribeFrom method of the
+// eventhorizon.EventSubscriber interface. The position has the offsets of the
+// last events in the partitions of the topic, as "partition:offset" separated
+// by commas, and the handler receives the events after them from a reader of
+// its own for each partition. Partitions without an offset are read from the
+// first event.
+func (b *EventBus) SubscribeFrom(ctx context.Context, position string, matcher eh.EventMatcher, handler eh.EventHandler) error {
+	if matcher == nil {
+		matcher = eh.MatchAny()
+	}
+
+	consumer := string(handler.HandlerType())
+	if b.checkpoints != nil {
+		committed, err := b.checkpoints.LoadCheckpoint(ctx, consumer)
+		if err != nil {
+			return err
+		}
+		if committed != "" {
+			position = committed
+		}
+	}
+
+	offsets, err := parsePosition(position)
+	if err != nil {
+		return err
+	}
+
+	conn, err := kafka.DialContext(ctx, "tcp", b.brokers[0])
+	if err != nil {
+		return err
+	}
+	partitions, err := conn.ReadPartitions(b.topic)
+	conn.Close()
+	if err != nil {
+		return err
+	}
+
+	c := &partitionConsumer{
+		name:    consumer,
+		matcher: matcher,
+		handler: handler,
+		offsets: offsets,
+	}
+	for _, p := range partitions {
+		reader := kafka.NewReader(kafka.ReaderConfig{
+			Brokers:   b.brokers,
+			Topic:     b.topic,
+			Partition: p.ID,
+		})
+		if offset, ok := offsets[p.ID]; ok {
+			if err := reader.SetOffset(offset + 1); err != nil {
+				reader.Close()
+				return err
+			}
+		}
+		b.wg.Add(1)
+		go b.consume(ctx, c, reader)
+	}
+
+	return nil
+}
+
+// Close stops the consumers and closes the connections. The offsets of the
+// handler groups are kept, to receive the events published while closed.
+func (b *EventBus) Close() error {
+	b.cancel()
+	b.wg.Wait()
+	return b.writer.Close()
+}
+
+// handle handles the events from the consumer group of a handler type, in
+// order. An event that fails to be handled is retried until it succeeds or
+// the bus is closed, and the offset is committed after it has been handled.
+func (b *EventBus) handle(handlerType eh.EventHandlerType, reader *kafka.Reader) {
+	defer b.wg.Done()
+	defer reader.Close()
+
+	for {
+		msg, err := reader.FetchMessage(b.ctx)
+		if err != nil {
+			if b.ctx.Err() == nil {
+				log.Println("error: event bus receive:", err)
+			}
+			return
+		}
+
+		ctx, event, err := b.unmarshalEvent(msg.Value)
+		if err != nil {
+			// Skip events that can't be decoded.
+			log.Println("error: event bus receive:", err)
+		} else if !b.handleEvent(ctx, handlerType, event) {
+			// Closed before the event was handled.
+			return
+		}
+
+		if err := reader.CommitMessages(b.ctx, msg); err != nil {
+			if b.ctx.Err() == nil {
+				log.Println("error: event bus receive:", err)
+			}
+			return
+		}
+	}
+}
+
+// handleEvent handles an event with the handler of the type, retrying until
+// it succeeds. Returns false if the bus was closed before it was handled.
+func (b *EventBus) handleEvent(ctx context.Context, handlerType eh.EventHandlerType, event eh.Event) bool {
+	b.handlerMu.RLock()
+	handler, ok := b.handlers[handlerType][event.EventType()]
+	b.handlerMu.RUnlock()
+
+	// Commit events that the handler type does not handle.
+	if !ok {
+		return true
+	}
+
+	for {
+		err := handler.HandleEvent(ctx, event)
+		if err == nil {
+			return true
+		}
+		log.Printf("error: event bus handler %s: %s", handlerType, err)
+
+		select {
+		case <-time.After(b.retryDelay):
+		case <-b.ctx.Done():
+			return false
+		}
+	}
+}
+
+// partitionConsumer is a consumer subscribed with SubscribeFrom, with the
+// offsets of the last handled events in each partition.
+type partitionConsumer struct {
+	name    string
+	matcher eh.EventMatcher
+	handler eh.EventHandler
+
+	offsets   map[int]int64
+	offsetsMu sync.Mutex
+}
+
+// consume handles the events from a partition for a consumer subscribed with
+// SubscribeFrom, in order, until the context is canceled or the bus is closed.
+// An event that fails to be handled is retried until it succeeds, and the
+// position is committed after it has been handled.
+func (b *EventBus) consume(ctx context.Context, c *partitionConsumer, reader *kafka.Reader) {
+	defer b.wg.Done()
+	defer reader.Close()
+
+	// Stop when either the subscription or the bus is done.
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go func() {
+		select {
+		case <-b.ctx.Done():
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	for {
+		msg, err := reader.ReadMessage(ctx)
+		if err != nil {
+			if ctx.Err() == nil {
+				log.Println("error: event bus receive:", err)
+			}
+			return
+		}
+
+		eventCtx, event, err := b.unmarshalEvent(msg.Value)
+		if err != nil {
+			// Skip events that can't be decoded.
+			log.Println("error: event bus receive:", err)
+		} else if c.matcher(event) && !b.retryEvent(ctx, eventCtx, c.handler, event) {
+			// Stopped before the event was handled.
+			return
+		}
+
+		if b.checkpoints != nil {
+			c.offsetsMu.Lock()
+			c.offsets[msg.Partition] = msg.Offset
+			position := formatPosition(c.offsets)
+			c.offsetsMu.Unlock()
+			if err := b.checkpoints.SaveCheckpoint(ctx, c.name, position); err != nil {
+				log.Println("error: event bus save checkpoint:", err)
+			}
+		}
+	}
+}
+
+// retryEvent handles an event with the handler, retrying until it succeeds.
+// Returns false if the context was done before it was handled.
+func (b *EventBus) retryEvent(ctx, eventCtx context.Context, handler eh.EventHandler, event eh.Event) bool {
+	for {
+		err := handler.HandleEvent(eventCtx, event)
+		if err == nil {
+			return true
+		}
+		log.Printf("error: event bus handler %s: %s", handler.HandlerType(), err)
+
+		select {
+		case <-time.After(b.retryDelay):
+		case <-ctx.Done():
+			return false
+		}
+	}
+}
+
+// parsePosition parses the offsets of the partitions in a position.
+func parsePosition(position string) (map[int]int64, error) {
+	offsets := map[int]int64{}
+	if position == "" {
+		return offsets, nil
+	}
+
+	for _, p := range strings.Split(position, ",") {
+		parts := strings.SplitN(p, ":", 2)
+		if len(parts) != 2 {
+			return nil, eh.ErrInvalidPosition
+		}
+		partition, err := strconv.Atoi(parts[0])
+		if err != nil {
+			return nil, eh.ErrInvalidPosition
+		}
+		offset, err := strconv.ParseInt(parts[1], 10, 64)
+		if err != nil {
+			return nil, eh.ErrInvalidPosition
+		}
+		offsets[partition] = offset
+	}
+
+	return offsets, nil
+}
+
+// formatPosition formats the offsets of the partitions as a position, ordered
+// by partition.
+func formatPosition(offsets map[int]int64) string {
+	partitions := make([]int, 0, len(offsets))
+	for partition := range offsets {
+		partitions = append(partitions, partition)
+	}
+	sort.Ints(partitions)
+
+	parts := make([]string, len(partitions))
+	for i, partition := range partitions {
+		parts[i] = fmt.Sprintf("%d:%d", partition, offsets[partition])
+	}
+	return strings.Join(parts, ",")
+}
+
+// observe notifies all observers about the events from the bus' own group.
+func (b *EventBus) observe(reader *kafka.Reader) {
+	defer b.wg.Done()
+	defer reader.Close()
+
+	for {
+		msg, err := reader.ReadMessage(b.ctx)
+		if err != nil {
+			if b.ctx.Err() == nil {
+				log.Println("error: event bus receive:", err)
+			}
+			return
+		}
+
+		ctx, event, err := b.unmarshalEvent(msg.Value)
+		if err != nil {
+			log.Println("error: event bus receive:", err)
+			continue
+		}
+
+		b.handlerMu.RLock()
+		for o := range b.observers {
+			if b.handlingStrategy == eh.AsyncEventHandlingStrategy {
+				go o.Notify(ctx, event)
+			} else {
+				o.Notify(ctx, event)
+			}
+		}
+		b.handlerMu.RUnlock()
+	}
+}
+
+// marshalEvent marshals an event and the context with the codec.
+func (b *EventBus) marshalEvent(ctx context.Context, event eh.Event) ([]byte, error) {
+	data, err := b.codec.MarshalEvent(ctx, event)
+	if err != nil {
+		return nil, ErrCouldNotMarshalEvent
+	}
+
+	return data, nil
+}
+
+// unmarshalEvent unmarshals an event and the context with the codec, with
+// concrete event data if the event type is registered.
+func (b *EventBus) unmarshalEvent(data []byte) (context.Context, eh.Event, error) {
+	ctx, event, err := b.codec.UnmarshalEvent(data)
+	if err != nil {
+		return nil, nil, ErrCouldNotUnmarshalEvent
+	}
+
+	return ctx, event, nil
+}
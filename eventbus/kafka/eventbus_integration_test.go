@@ -0,0 +1,141 @@
+// Copyright (c) 2016 - Max Ekman <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build integration
+// +build integration
+
+package kafka
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	eh "github.com/looplab/eventhorizon"
+	"github.com/looplab/eventhorizon/mocks"
+)
+
+// Run with a local Kafka broker, for example in Docker.
+
+func TestEventBusOrdering(t *testing.T) {
+	appID := "test_" + eh.NewUUID().String()
+	bus, err := NewEventBus(appID, brokers())
+	if err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	defer bus.Close()
+
+	handler := mocks.NewEventHandler("orderedHandler")
+	handler.Recv = make(chan eh.Event, 100)
+	bus.AddHandler(handler, mocks.EventType)
+
+	t.Log("publish events for two aggregates")
+	ctx := context.Background()
+	agg1 := mocks.NewAggregate(eh.NewUUID())
+	agg2 := mocks.NewAggregate(eh.NewUUID())
+	for i := 0; i < 10; i++ {
+		for _, agg := range []*mocks.Aggregate{agg1, agg2} {
+			event := agg.NewEvent(mocks.EventType, &mocks.EventData{"event"})
+			agg.ApplyEvent(ctx, event)
+			if err := bus.PublishEvent(ctx, event); err != nil {
+				t.Fatal("there should be no error:", err)
+			}
+		}
+	}
+
+	t.Log("receive the events in order for each aggregate")
+	versions := map[eh.UUID]int{}
+	for i := 0; i < 20; i++ {
+		select {
+		case event := <-handler.Recv:
+			id := event.AggregateID()
+			if event.Version() != versions[id]+1 {
+				t.Errorf("the event should be version %d: %s", versions[id]+1, event)
+			}
+			versions[id] = event.Version()
+		case <-time.After(30 * time.Second):
+			t.Fatal("there should be 20 events:", i)
+		}
+	}
+}
+
+func TestEventBusDurable(t *testing.T) {
+	appID := "test_" + eh.NewUUID().String()
+	publisher, err := NewEventBus(appID, brokers())
+	if err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	defer publisher.Close()
+
+	t.Log("publish event before the handler is added")
+	ctx := context.Background()
+	agg := mocks.NewAggregate(eh.NewUUID())
+	event1 := agg.NewEvent(mocks.EventType, &mocks.EventData{"event1"})
+	agg.ApplyEvent(ctx, event1)
+	if err := publisher.PublishEvent(ctx, event1); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+
+	bus, err := NewEventBus(appID, brokers())
+	if err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	handler := mocks.NewEventHandler("durableHandler")
+	bus.AddHandler(handler, mocks.EventType)
+	waitForEvent(t, handler, event1)
+
+	t.Log("receive events published while the handler was gone")
+	if err := bus.Close(); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	event2 := agg.NewEvent(mocks.EventType, &mocks.EventData{"event2"})
+	agg.ApplyEvent(ctx, event2)
+	if err := publisher.PublishEvent(ctx, event2); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+
+	bus, err = NewEventBus(appID, brokers())
+	if err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	defer bus.Close()
+	handler = mocks.NewEventHandler("durableHandler")
+	bus.AddHandler(handler, mocks.EventType)
+	waitForEvent(t, handler, event2)
+}
+
+// waitForEvent waits for a handler to receive an event, allowing for the
+// time it takes to join a consumer group.
+func waitForEvent(t *testing.T, handler *mocks.EventHandler, expected eh.Event) {
+	select {
+	case event := <-handler.Recv:
+		if err := mocks.CompareEvents(event, expected); err != nil {
+			t.Error("the event was incorrect:", err)
+		}
+		if event.Version() != expected.Version() {
+			t.Error("the event version should be correct:", event)
+		}
+	case <-time.After(30 * time.Second):
+		t.Fatal("there should be an event")
+	}
+}
+
+// brokers returns the address of the local Kafka broker.
+func brokers() []string {
+	if addr := os.Getenv("KAFKA_ADDR"); addr != "" {
+		return []string{addr}
+	}
+	return []string{"localhost:9092"}
+}
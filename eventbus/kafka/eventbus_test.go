@@ -0,0 +1,147 @@
+// Copyright (c) 2016 - Max Ekman <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kafka
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	eh "github.com/looplab/eventhorizon"
+	"github.com/looplab/eventhorizon/eventbus/checkpoint"
+	"github.com/looplab/eventhorizon/eventstore/codec"
+	"github.com/looplab/eventhorizon/mocks"
+)
+
+func TestNewEventBus(t *testing.T) {
+	bus, err := NewEventBus("test", nil)
+	if err != ErrNoBrokers {
+		t.Error("there should be a ErrNoBrokers error:", err)
+	}
+	if bus != nil {
+		t.Error("there should be no bus:", bus)
+	}
+}
+
+func TestMarshalEvent(t *testing.T) {
+	ctx := eh.WithNamespace(context.Background(), "ns")
+	id := eh.NewUUID()
+	agg := mocks.NewAggregate(id)
+	event1 := agg.NewEvent(mocks.EventType, &mocks.EventData{"event1"},
+		eh.WithMetadata(map[string]interface{}{"num": "1"}),
+	)
+	agg.ApplyEvent(ctx, event1)
+
+	b := &EventBus{codec: codec.JSONEventCodec{}}
+	data, err := b.marshalEvent(ctx, event1)
+	if err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	ctx2, event2, err := b.unmarshalEvent(data)
+	if err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	if err := mocks.CompareEvents(event2, event1); err != nil {
+		t.Error("the event was incorrect:", err)
+	}
+	if event2.AggregateID() != id || event2.Version() != 1 {
+		t.Error("the event aggregate ID and version should be correct:", event2)
+	}
+	if !event2.Timestamp().Equal(event1.Timestamp()) {
+		t.Error("the timestamp should be correct:", event2.Timestamp())
+	}
+	if eh.Namespace(ctx2) != "ns" {
+		t.Error("the context should be correct:", ctx2)
+	}
+
+	t.Log("unmarshal invalid event")
+	if _, _, err := b.unmarshalEvent([]byte("invalid")); err != ErrCouldNotUnmarshalEvent {
+		t.Error("there should be a ErrCouldNotUnmarshalEvent error:", err)
+	}
+
+	t.Log("marshal with another codec")
+	b2 := &EventBus{codec: codec.BSONEventCodec{}}
+	data2, err := b2.marshalEvent(ctx, event1)
+	if err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	if _, event2, err = b2.unmarshalEvent(data2); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	if err := mocks.CompareEvents(event2, event1); err != nil {
+		t.Error("the event was incorrect:", err)
+	}
+
+	t.Log("unmarshal an event marshaled with another codec")
+	if _, _, err := b.unmarshalEvent(data2); err != ErrCouldNotUnmarshalEvent {
+		t.Error("there should be a ErrCouldNotUnmarshalEvent error:", err)
+	}
+	if _, _, err := b2.unmarshalEvent(data); err != ErrCouldNotUnmarshalEvent {
+		t.Error("there should be a ErrCouldNotUnmarshalEvent error:", err)
+	}
+}
+
+func TestNewEventBusWithCodec(t *testing.T) {
+	bus, err := NewEventBus("test", []string{"localhost:9092"}, WithCodec(codec.BSONEventCodec{}))
+	if err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	defer bus.Close()
+	if _, ok := bus.codec.(codec.BSONEventCodec); !ok {
+		t.Error("the codec should be set:", bus.codec)
+	}
+}
+
+func TestPosition(t *testing.T) {
+	t.Log("parse an empty position")
+	offsets, err := parsePosition("")
+	if err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if len(offsets) != 0 {
+		t.Error("there should be no offsets:", offsets)
+	}
+
+	t.Log("parse and format the offsets of partitions")
+	offsets, err = parsePosition("1:7,0:42")
+	if err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if !reflect.DeepEqual(offsets, map[int]int64{0: 42, 1: 7}) {
+		t.Error("the offsets should be correct:", offsets)
+	}
+	if position := formatPosition(offsets); position != "0:42,1:7" {
+		t.Error("the position should be ordered by partition:", position)
+	}
+
+	t.Log("parse invalid positions")
+	for _, position := range []string{"42", "0:", "a:1", "0:1,b"} {
+		if _, err := parsePosition(position); err != eh.ErrInvalidPosition {
+			t.Error("there should be a ErrInvalidPosition error:", position, err)
+		}
+	}
+}
+
+func TestNewEventBusWithCheckpointStore(t *testing.T) {
+	store := checkpoint.NewMemoryStore()
+	bus, err := NewEventBus("test", []string{"localhost:9092"}, WithCheckpointStore(store))
+	if err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	defer bus.Close()
+	if bus.checkpoints != store {
+		t.Error("the checkpoint store should be set:", bus.checkpoints)
+	}
+}
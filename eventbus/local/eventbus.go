@@ -16,16 +16,33 @@ package local
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"runtime"
 	"sync"
 
 	eh "github.com/looplab/eventhorizon"
 )
 
+// ErrBusClosed is when an event is published on a closed bus.
+var ErrBusClosed = errors.New("bus closed")
+
 // EventBus is an event bus that notifies registered EventHandlers of
 // published events. It will use the SimpleEventHandlingStrategy by default.
 type EventBus struct {
-	handlers  map[eh.EventType]map[eh.EventHandler]bool
-	observers map[eh.EventObserver]bool
+	handlers   map[eh.EventType]map[eh.EventHandler]bool
+	matchers   []matcherHandler
+	observers  map[eh.EventObserver]bool
+	middleware []eh.EventHandlerMiddleware
+
+	// wrapped has the handlers wrapped in the middleware, created once for
+	// each handler so that middleware can keep state between events.
+	wrapped map[eh.EventHandler]eh.EventHandler
+
+	// deadLetterHandler is an optional handler of events that handlers failed
+	// to handle.
+	deadLetterHandler eh.DeadLetterHandler
 
 	// handlerMu guards all maps at once for concurrent writes. No need for
 	// separate mutexes per map for this as AddHandler/AddObserven is often
@@ -35,14 +52,74 @@ type EventBus struct {
 	// handlingStrategy is the strategy to use when handling event, for example
 	// to handle the asynchronously.
 	handlingStrategy eh.EventHandlingStrategy
+
+	// closed is set by Close, guarded by handlerMu. The wait group tracks the
+	// async handlers and observers that are still running.
+	closed  bool
+	running sync.WaitGroup
+
+	// workers handle the async events of each aggregate in order, if set.
+	workers []*worker
+
+	// replayWindow is the number of positions before the position of
+	// AddHandlerWithReplay that are replayed again.
+	replayWindow int64
+
+	logger eh.Logger
+}
+
+// Option is an option setter used to configure creation.
+type Option func(*EventBus)
+
+// WithLogger logs the handling of events and the handler errors with a logger.
+func WithLogger(logger eh.Logger) Option {
+	return func(b *EventBus) {
+		if logger == nil {
+			logger = eh.NopLogger{}
+		}
+		b.logger = logger
+	}
+}
+
+// WithPerAggregateOrdering handles the events of each aggregate in the order
+// they were published when using the AsyncEventHandlingStrategy. The events of
+// an aggregate are handled by the same worker, with one worker per CPU, while
+// events of aggregates on other workers are handled in parallel.
+func WithPerAggregateOrdering() Option {
+	return func(b *EventBus) {
+		b.workers = make([]*worker, runtime.NumCPU())
+	}
+}
+
+// WithReplayWindow replays the events of a window of positions before the
+// position of AddHandlerWithReplay again, as events saved concurrently can
+// become visible out of position order, see eventhorizon.PositionedEvent. The
+// events in the window that were already handled are handled again, so the
+// handlers must be idempotent, for example with the eventhandler/idempotent
+// middleware.
+func WithReplayWindow(window int64) Option {
+	return func(b *EventBus) {
+		b.replayWindow = window
+	}
 }
 
 // NewEventBus creates a EventBus.
-func NewEventBus() *EventBus {
+func NewEventBus(opts ...Option) *EventBus {
 	b := &EventBus{
 		handlers:  make(map[eh.EventType]map[eh.EventHandler]bool),
 		observers: make(map[eh.EventObserver]bool),
+		wrapped:   make(map[eh.EventHandler]eh.EventHandler),
+		logger:    eh.NopLogger{},
+	}
+
+	for _, opt := range opts {
+		opt(b)
+	}
+
+	for i := range b.workers {
+		b.workers[i] = newWorker()
 	}
+
 	return b
 }
 
@@ -55,29 +132,78 @@ func (b *EventBus) SetHandlingStrategy(strategy eh.EventHandlingStrategy) {
 // PublishEvent publishes an event to all handlers capable of handling it.
 // TODO: Put the event in a buffered channel consumed by another goroutine
 // to simulate a distributed bus.
-func (b *EventBus) PublishEvent(ctx context.Context, event eh.Event) {
+func (b *EventBus) PublishEvent(ctx context.Context, event eh.Event) error {
 	b.handlerMu.RLock()
 	defer b.handlerMu.RUnlock()
 
+	if b.closed {
+		return ErrBusClosed
+	}
+
 	// Handle the event if there is a handler registered.
 	if handlers, ok := b.handlers[event.EventType()]; ok {
 		for h := range handlers {
-			if b.handlingStrategy == eh.AsyncEventHandlingStrategy {
-				go h.HandleEvent(ctx, event)
-			} else {
-				h.HandleEvent(ctx, event)
-			}
+			b.handle(ctx, event, h)
+		}
+	}
+
+	// Handle the event by the handlers with a matching matcher.
+	for _, m := range b.matchers {
+		if m.matcher(event) && !m.replay.buffer(ctx, event) {
+			b.handle(ctx, event, m.handler)
 		}
 	}
 
 	// Notify all observers about the event.
 	for o := range b.observers {
-		if b.handlingStrategy == eh.AsyncEventHandlingStrategy {
-			go o.Notify(ctx, event)
-		} else {
-			o.Notify(ctx, event)
+		o := o
+		b.run(event, func() { o.Notify(ctx, event) })
+	}
+
+	return nil
+}
+
+// HandleEventSync handles an event with all handlers registered for its type
+// and the handlers with a matching matcher, and returns when all of them have
+// finished, regardless of the handling strategy. The handlers run concurrently
+// with the middleware and dead letter handler of the bus; observers are not
+// notified. Returns the errors of the handlers that failed joined with
+// errors.Join, each prefixed with the handler type, or ErrBusClosed if the bus
+// has been closed.
+func (b *EventBus) HandleEventSync(ctx context.Context, event eh.Event) error {
+	b.handlerMu.RLock()
+	defer b.handlerMu.RUnlock()
+
+	if b.closed {
+		return ErrBusClosed
+	}
+
+	var handlers []eh.EventHandler
+	for h := range b.handlers[event.EventType()] {
+		handlers = append(handlers, h)
+	}
+	for _, m := range b.matchers {
+		if m.matcher(event) && !m.replay.buffer(ctx, event) {
+			handlers = append(handlers, m.handler)
 		}
 	}
+
+	// The errors are kept in the order of the handlers, each handler only
+	// sets its own.
+	var wg sync.WaitGroup
+	errs := make([]error, len(handlers))
+	for i, h := range handlers {
+		wg.Add(1)
+		go func(i int, h, wrapped eh.EventHandler) {
+			defer wg.Done()
+			if err := handleEvent(ctx, event, h, wrapped, b.deadLetterHandler, b.logger); err != nil {
+				errs[i] = fmt.Errorf("%s: %w", h.HandlerType(), err)
+			}
+		}(i, h, b.wrapped[h])
+	}
+	wg.Wait()
+
+	return errors.Join(errs...)
 }
 
 // AddHandler implements the AddHandler method of the eventhorizon.EventBus interface.
@@ -92,6 +218,22 @@ func (b *EventBus) AddHandler(handler eh.EventHandler, eventType eh.EventType) {
 
 	// Add the handler for the event type.
 	b.handlers[eventType][handler] = true
+	b.wrap(handler)
+}
+
+// AddHandlerWithMatcher adds a handler that receives all events that the
+// matcher matches, for example eventhorizon.MatchEvent for a set of event
+// types or eventhorizon.MatchAny for all events. The matcher is evaluated
+// before the handler is called.
+func (b *EventBus) AddHandlerWithMatcher(handler eh.EventHandler, matcher eh.EventMatcher) {
+	b.handlerMu.Lock()
+	defer b.handlerMu.Unlock()
+
+	if matcher == nil {
+		matcher = eh.MatchAny()
+	}
+	b.matchers = append(b.matchers, matcherHandler{matcher: matcher, handler: handler})
+	b.wrap(handler)
 }
 
 // AddObserver implements the AddObserver method of the eventhorizon.EventBus interface.
@@ -101,3 +243,221 @@ func (b *EventBus) AddObserver(observer eh.EventObserver) {
 
 	b.observers[observer] = true
 }
+
+// UseMiddleware adds middleware that wraps all handlers when handling events.
+// The first middleware is the outermost, handling the event first. Each
+// handler is wrapped once, so that middleware can keep state between events,
+// for example the circuit breaker and batch middleware. Adding middleware
+// wraps the handlers again, with new state, after closing the earlier wrapped
+// handlers that can be closed.
+func (b *EventBus) UseMiddleware(middleware ...eh.EventHandlerMiddleware) {
+	b.handlerMu.Lock()
+	b.middleware = append(b.middleware, middleware...)
+	old := b.wrapped
+	b.wrapped = make(map[eh.EventHandler]eh.EventHandler, len(old))
+	for h := range old {
+		b.wrap(h)
+	}
+	b.handlerMu.Unlock()
+
+	closeHandlers(old, b.logger)
+}
+
+// SetDeadLetterHandler sets a handler that receives the events that handlers
+// failed to handle, together with the failed handler and its error.
+func (b *EventBus) SetDeadLetterHandler(handler eh.DeadLetterHandler) {
+	b.handlerMu.Lock()
+	defer b.handlerMu.Unlock()
+
+	b.deadLetterHandler = handler
+}
+
+// Close stops the bus from accepting new events and waits for the running
+// async handlers and observers to finish. The context error is returned if
+// they have not finished when the context is done. Publishing events after
+// Close returns ErrBusClosed.
+func (b *EventBus) Close(ctx context.Context) error {
+	// Wait for events that are being published before closing.
+	b.handlerMu.Lock()
+	if !b.closed {
+		b.closed = true
+		for _, w := range b.workers {
+			w.close()
+		}
+	}
+	b.handlerMu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		b.running.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	b.handlerMu.RLock()
+	wrapped := b.wrapped
+	b.handlerMu.RUnlock()
+
+	closeHandlers(wrapped, b.logger)
+
+	return nil
+}
+
+// wrap wraps a handler in the middleware, unless it has already been wrapped.
+// The handlerMu must be held.
+func (b *EventBus) wrap(h eh.EventHandler) {
+	if _, ok := b.wrapped[h]; !ok {
+		b.wrapped[h] = eh.UseEventHandlerMiddleware(h, b.middleware...)
+	}
+}
+
+// closeHandlers closes the wrapped handlers that can be closed, for example
+// to flush the events buffered by the batch middleware. Only the outermost
+// middleware can be closed.
+func closeHandlers(wrapped map[eh.EventHandler]eh.EventHandler, logger eh.Logger) {
+	for h, w := range wrapped {
+		closer, ok := w.(interface{ Close() error })
+		if !ok {
+			continue
+		}
+		if err := closer.Close(); err != nil {
+			logger.Error("event bus: could not close handler",
+				"handler_type", h.HandlerType(),
+				"error", err,
+			)
+		}
+	}
+}
+
+// handle handles an event with a handler using the handling strategy.
+func (b *EventBus) handle(ctx context.Context, event eh.Event, h eh.EventHandler) {
+	wrapped := b.wrapped[h]
+	deadLetterHandler, logger := b.deadLetterHandler, b.logger
+	b.run(event, func() {
+		handleEvent(ctx, event, h, wrapped, deadLetterHandler, logger)
+	})
+}
+
+// run runs the handling of an event using the handling strategy, on the worker
+// for the aggregate if the events are ordered per aggregate.
+func (b *EventBus) run(event eh.Event, task func()) {
+	if b.handlingStrategy != eh.AsyncEventHandlingStrategy {
+		task()
+		return
+	}
+
+	b.running.Add(1)
+	run := func() {
+		defer b.running.Done()
+		task()
+	}
+
+	if len(b.workers) == 0 {
+		go run()
+		return
+	}
+
+	hash := fnv.New32a()
+	hash.Write([]byte(event.AggregateID()))
+	b.workers[hash.Sum32()%uint32(len(b.workers))].add(run)
+}
+
+// worker runs tasks one at a time in the order they were added. Adding tasks
+// never blocks, the queue grows while the worker is busy.
+type worker struct {
+	tasks  []func()
+	closed bool
+	mu     sync.Mutex
+	cond   *sync.Cond
+}
+
+// newWorker creates a worker and starts running its tasks.
+func newWorker() *worker {
+	w := &worker{}
+	w.cond = sync.NewCond(&w.mu)
+	go w.run()
+
+	return w
+}
+
+// add queues a task to run after the already queued tasks.
+func (w *worker) add(task func()) {
+	w.mu.Lock()
+	w.tasks = append(w.tasks, task)
+	w.mu.Unlock()
+	w.cond.Signal()
+}
+
+// close stops the worker after the queued tasks have been run.
+func (w *worker) close() {
+	w.mu.Lock()
+	w.closed = true
+	w.mu.Unlock()
+	w.cond.Signal()
+}
+
+func (w *worker) run() {
+	for {
+		w.mu.Lock()
+		for len(w.tasks) == 0 && !w.closed {
+			w.cond.Wait()
+		}
+		if len(w.tasks) == 0 {
+			w.mu.Unlock()
+			return
+		}
+		task := w.tasks[0]
+		w.tasks[0] = nil
+		w.tasks = w.tasks[1:]
+		w.mu.Unlock()
+
+		task()
+	}
+}
+
+// matcherHandler is a handler that handles the events that the matcher matches.
+type matcherHandler struct {
+	matcher eh.EventMatcher
+	handler eh.EventHandler
+	// replay is set for handlers added with AddHandlerWithReplay.
+	replay *replayState
+}
+
+// handleEvent handles an event with the handler wrapped in middleware. Errors
+// are logged and passed to the dead letter handler, if there is one, with the
+// unwrapped handler, and returned. The other handlers still handle the event.
+func handleEvent(ctx context.Context, event eh.Event, h, wrapped eh.EventHandler, deadLetterHandler eh.DeadLetterHandler, logger eh.Logger) error {
+	logger.Debug("event bus: handling event",
+		"event_type", event.EventType(),
+		"handler_type", h.HandlerType(),
+	)
+
+	err := wrapped.HandleEvent(ctx, event)
+	if err == nil {
+		return nil
+	}
+
+	logger.Error("event bus: handler failed",
+		"event_type", event.EventType(),
+		"handler_type", h.HandlerType(),
+		"error", err,
+	)
+	if deadLetterHandler == nil {
+		return err
+	}
+
+	if err := deadLetterHandler.HandleDeadLetter(ctx, event, h, err); err != nil {
+		logger.Error("event bus: dead letter handler failed",
+			"event_type", event.EventType(),
+			"handler_type", h.HandlerType(),
+			"error", err,
+		)
+	}
+
+	return err
+}
@@ -15,10 +15,17 @@
 package local
 
 import (
+	"context"
+	"errors"
+	"reflect"
+	"sync"
 	"testing"
+	"time"
 
 	eh "github.com/looplab/eventhorizon"
 	"github.com/looplab/eventhorizon/eventbus/testutil"
+	"github.com/looplab/eventhorizon/eventstore/memory"
+	"github.com/looplab/eventhorizon/mocks"
 )
 
 func TestEventBus(t *testing.T) {
@@ -28,6 +35,10 @@ func TestEventBus(t *testing.T) {
 	}
 
 	testutil.EventBusCommonTests(t, bus, bus)
+
+	ctx := context.Background()
+	testutil.EventBusHandlerErrorCommonTests(t, ctx, NewEventBus())
+	testutil.EventBusOrderingCommonTests(t, ctx, NewEventBus())
 }
 
 func TestEventBusAsync(t *testing.T) {
@@ -38,4 +49,723 @@ func TestEventBusAsync(t *testing.T) {
 	bus.SetHandlingStrategy(eh.AsyncEventHandlingStrategy)
 
 	testutil.EventBusCommonTests(t, bus, bus)
+
+	bus = NewEventBus()
+	bus.SetHandlingStrategy(eh.AsyncEventHandlingStrategy)
+	testutil.EventBusHandlerErrorCommonTests(t, context.Background(), bus)
+}
+
+func TestEventBusMiddleware(t *testing.T) {
+	bus := NewEventBus()
+	if bus == nil {
+		t.Fatal("there should be a bus")
+	}
+
+	order := []string{}
+	bus.UseMiddleware(
+		newOrderMiddleware("first", &order),
+		newOrderMiddleware("second", &order),
+	)
+	handler := mocks.NewEventHandler("testHandler")
+	bus.AddHandler(handler, mocks.EventType)
+
+	t.Log("publish event through middleware")
+	ctx := mocks.WithContextOne(context.Background(), "testval")
+	agg := mocks.NewAggregate(eh.NewUUID())
+	event1 := agg.NewEvent(mocks.EventType, &mocks.EventData{"event1"})
+	bus.PublishEvent(ctx, event1)
+	expectedOrder := []string{
+		"first before testHandler",
+		"second before testHandler",
+		"second after testHandler",
+		"first after testHandler",
+	}
+	if !reflect.DeepEqual(order, expectedOrder) {
+		t.Error("the middleware should be run in order:", order)
+	}
+	if len(handler.Events) != 1 || handler.Events[0] != event1 {
+		t.Error("the handler should receive the event:", handler.Events)
+	}
+	if val, ok := mocks.ContextOne(handler.Context); !ok || val != "testval" {
+		t.Error("the context should be correct:", handler.Context)
+	}
+}
+
+func TestEventBusStatefulMiddleware(t *testing.T) {
+	bus := NewEventBus()
+
+	var middleware []*countingMiddleware
+	bus.UseMiddleware(func(h eh.EventHandler) eh.EventHandler {
+		m := &countingMiddleware{EventHandler: h}
+		middleware = append(middleware, m)
+		return m
+	})
+	handler := mocks.NewEventHandler("testHandler")
+	bus.AddHandler(handler, mocks.EventType)
+	matcherHandler := mocks.NewEventHandler("matcherHandler")
+	bus.AddHandlerWithMatcher(matcherHandler, eh.MatchAny())
+
+	t.Log("handle events with the same middleware")
+	ctx := context.Background()
+	agg := mocks.NewAggregate(eh.NewUUID())
+	for i := 0; i < 5; i++ {
+		event := agg.NewEvent(mocks.EventType, &mocks.EventData{"event"})
+		if err := bus.PublishEvent(ctx, event); err != nil {
+			t.Error("there should be no error:", err)
+		}
+	}
+	event := agg.NewEvent(mocks.EventType, &mocks.EventData{"event"})
+	if err := bus.HandleEventSync(ctx, event); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if len(middleware) != 2 {
+		t.Fatal("each handler should be wrapped once:", len(middleware))
+	}
+	for _, m := range middleware {
+		if m.count() != 6 {
+			t.Error("the middleware should count all events:", m.count())
+		}
+	}
+
+	t.Log("close the wrapped handlers")
+	if err := bus.Close(ctx); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	for _, m := range middleware {
+		if !m.closed {
+			t.Error("the middleware should be closed")
+		}
+	}
+}
+
+func TestEventBusMiddlewareShortCircuit(t *testing.T) {
+	bus := NewEventBus()
+	if bus == nil {
+		t.Fatal("there should be a bus")
+	}
+
+	errBlocked := errors.New("blocked")
+	bus.UseMiddleware(func(h eh.EventHandler) eh.EventHandler {
+		return &blockingMiddleware{h, "blockedHandler", errBlocked}
+	})
+	blockedHandler := mocks.NewEventHandler("blockedHandler")
+	bus.AddHandler(blockedHandler, mocks.EventType)
+	handler := mocks.NewEventHandler("testHandler")
+	bus.AddHandler(handler, mocks.EventType)
+
+	t.Log("publish event with a short-circuited handler")
+	agg := mocks.NewAggregate(eh.NewUUID())
+	event1 := agg.NewEvent(mocks.EventType, &mocks.EventData{"event1"})
+	bus.PublishEvent(context.Background(), event1)
+	if len(blockedHandler.Events) != 0 {
+		t.Error("the blocked handler should not receive the event:", blockedHandler.Events)
+	}
+	if len(handler.Events) != 1 || handler.Events[0] != event1 {
+		t.Error("the handler should receive the event:", handler.Events)
+	}
+}
+
+func TestEventBusHandlerError(t *testing.T) {
+	bus := NewEventBus()
+	if bus == nil {
+		t.Fatal("there should be a bus")
+	}
+
+	failingHandler := mocks.NewEventHandler("failingHandler")
+	failingHandler.Err = errors.New("handler error")
+	bus.AddHandler(failingHandler, mocks.EventType)
+	handler := mocks.NewEventHandler("testHandler")
+	bus.AddHandler(handler, mocks.EventType)
+	observer := mocks.NewEventObserver()
+	bus.AddObserver(observer)
+
+	t.Log("publish event with a failing handler")
+	agg := mocks.NewAggregate(eh.NewUUID())
+	event1 := agg.NewEvent(mocks.EventType, &mocks.EventData{"event1"})
+	bus.PublishEvent(context.Background(), event1)
+	if len(handler.Events) != 1 || handler.Events[0] != event1 {
+		t.Error("the handler should receive the event:", handler.Events)
+	}
+	if len(observer.Events) != 1 || observer.Events[0] != event1 {
+		t.Error("the observer should receive the event:", observer.Events)
+	}
+}
+
+func TestEventBusLogger(t *testing.T) {
+	logger := &mocks.Logger{}
+	bus := NewEventBus(WithLogger(logger))
+	if bus == nil {
+		t.Fatal("there should be a bus")
+	}
+
+	failingHandler := mocks.NewEventHandler("failingHandler")
+	failingHandler.Err = errors.New("handler error")
+	bus.AddHandler(failingHandler, mocks.EventType)
+
+	t.Log("log a failing handler with the event type")
+	agg := mocks.NewAggregate(eh.NewUUID())
+	event1 := agg.NewEvent(mocks.EventType, &mocks.EventData{"event1"})
+	bus.PublishEvent(context.Background(), event1)
+	entries := logger.Find("error", "event bus: handler failed")
+	if len(entries) != 1 {
+		t.Fatal("the handler error should be logged:", logger.Entries)
+	}
+	expected := map[string]interface{}{
+		"event_type":   mocks.EventType,
+		"handler_type": eh.EventHandlerType("failingHandler"),
+		"error":        failingHandler.Err,
+	}
+	if !reflect.DeepEqual(entries[0].Fields, expected) {
+		t.Error("the fields should be correct:", entries[0].Fields)
+	}
+	if len(logger.Find("debug", "event bus: handling event")) != 1 {
+		t.Error("the dispatch should be logged:", logger.Entries)
+	}
+}
+
+func TestEventBusMatcher(t *testing.T) {
+	bus := NewEventBus()
+	if bus == nil {
+		t.Fatal("there should be a bus")
+	}
+
+	handler := mocks.NewEventHandler("testHandler")
+	bus.AddHandlerWithMatcher(handler, eh.MatchEvent(mocks.EventType))
+	otherHandler := mocks.NewEventHandler("otherHandler")
+	bus.AddHandlerWithMatcher(otherHandler, eh.MatchEvent(mocks.EventOtherType))
+	anyHandler := mocks.NewEventHandler("anyHandler")
+	bus.AddHandlerWithMatcher(anyHandler, eh.MatchAny())
+
+	t.Log("publish events of different types")
+	agg := mocks.NewAggregate(eh.NewUUID())
+	event1 := agg.NewEvent(mocks.EventType, &mocks.EventData{"event1"})
+	bus.PublishEvent(context.Background(), event1)
+	event2 := agg.NewEvent(mocks.EventOtherType, &mocks.EventData{"event2"})
+	bus.PublishEvent(context.Background(), event2)
+	if len(handler.Events) != 1 || handler.Events[0] != event1 {
+		t.Error("the handler should only receive its event type:", handler.Events)
+	}
+	if len(otherHandler.Events) != 1 || otherHandler.Events[0] != event2 {
+		t.Error("the other handler should only receive its event type:", otherHandler.Events)
+	}
+	if len(anyHandler.Events) != 2 {
+		t.Error("the any handler should receive all events:", anyHandler.Events)
+	}
+}
+
+// orderMiddleware records when it is run, before and after the handler.
+func TestEventBusClose(t *testing.T) {
+	bus := NewEventBus()
+	bus.SetHandlingStrategy(eh.AsyncEventHandlingStrategy)
+	handler := &slowHandler{delay: 50 * time.Millisecond}
+	bus.AddHandler(handler, mocks.EventType)
+
+	t.Log("publish events and close the bus")
+	ctx := context.Background()
+	agg := mocks.NewAggregate(eh.NewUUID())
+	for i := 0; i < 3; i++ {
+		event := agg.NewEvent(mocks.EventType, &mocks.EventData{"event"})
+		if err := bus.PublishEvent(ctx, event); err != nil {
+			t.Error("there should be no error:", err)
+		}
+	}
+	closeCtx, cancel := context.WithTimeout(ctx, time.Second)
+	defer cancel()
+	if err := bus.Close(closeCtx); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if handled := handler.Handled(); handled != 3 {
+		t.Error("all handlers should have completed:", handled)
+	}
+
+	t.Log("publish an event on the closed bus")
+	event := agg.NewEvent(mocks.EventType, &mocks.EventData{"event"})
+	if err := bus.PublishEvent(ctx, event); err != ErrBusClosed {
+		t.Error("there should be a ErrBusClosed error:", err)
+	}
+
+	t.Log("close before the handlers have finished")
+	bus = NewEventBus()
+	bus.SetHandlingStrategy(eh.AsyncEventHandlingStrategy)
+	handler = &slowHandler{delay: time.Second}
+	bus.AddHandler(handler, mocks.EventType)
+	if err := bus.PublishEvent(ctx, event); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	closeCtx, cancel = context.WithTimeout(ctx, 10*time.Millisecond)
+	defer cancel()
+	if err := bus.Close(closeCtx); err != context.DeadlineExceeded {
+		t.Error("there should be a deadline exceeded error:", err)
+	}
+}
+
+func TestEventBusHandleEventSync(t *testing.T) {
+	bus := NewEventBus()
+	bus.SetHandlingStrategy(eh.AsyncEventHandlingStrategy)
+	blocking := &blockingHandler{release: make(chan struct{})}
+	bus.AddHandler(blocking, mocks.EventType)
+	matched := mocks.NewEventHandler("matchedHandler")
+	bus.AddHandlerWithMatcher(matched, eh.MatchEvent(mocks.EventType))
+	other := mocks.NewEventHandler("otherHandler")
+	bus.AddHandlerWithMatcher(other, eh.MatchEvent(mocks.EventOtherType))
+
+	t.Log("block until all handlers have finished")
+	ctx := context.Background()
+	agg := mocks.NewAggregate(eh.NewUUID())
+	event := agg.NewEvent(mocks.EventType, &mocks.EventData{"event"})
+	done := make(chan error, 1)
+	go func() {
+		done <- bus.HandleEventSync(ctx, event)
+	}()
+	select {
+	case err := <-done:
+		t.Fatal("the call should block until the handlers have finished:", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+	close(blocking.release)
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Error("there should be no error:", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("the call should return when the handlers have finished")
+	}
+	if handled := blocking.Handled(); handled != 1 {
+		t.Error("the blocking handler should have handled the event:", handled)
+	}
+	if len(matched.Events) != 1 || matched.Events[0] != event {
+		t.Error("the matched handler should have handled the event:", matched.Events)
+	}
+	if len(other.Events) != 0 {
+		t.Error("the other handler should not handle the event:", other.Events)
+	}
+
+	t.Log("combine the errors of the failing handlers")
+	handlerErr := errors.New("handler error")
+	failing1 := mocks.NewEventHandler("failingHandler1")
+	failing1.Err = handlerErr
+	bus.AddHandler(failing1, mocks.EventType)
+	failing2 := mocks.NewEventHandler("failingHandler2")
+	failing2.Err = errors.New("other error")
+	bus.AddHandlerWithMatcher(failing2, eh.MatchAny())
+	err := bus.HandleEventSync(ctx, event)
+	joined, ok := err.(interface{ Unwrap() []error })
+	if !ok {
+		t.Fatal("there should be joined handler errors:", err)
+	}
+	if len(joined.Unwrap()) != 2 {
+		t.Error("there should be an error for each failing handler:", joined.Unwrap())
+	}
+	if !errors.Is(err, handlerErr) {
+		t.Error("the handler error should be found:", err)
+	}
+	if err.Error() != "failingHandler1: handler error\nfailingHandler2: other error" {
+		t.Error("the error message should be correct:", err.Error())
+	}
+	if len(matched.Events) != 2 {
+		t.Error("the other handlers should still handle the event:", matched.Events)
+	}
+
+	t.Log("handle an event on the closed bus")
+	if err := bus.Close(ctx); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if err := bus.HandleEventSync(ctx, event); err != ErrBusClosed {
+		t.Error("there should be a ErrBusClosed error:", err)
+	}
+}
+
+// blockingHandler blocks handling events until it is released.
+type blockingHandler struct {
+	release chan struct{}
+	handled int
+	mu      sync.Mutex
+}
+
+func (h *blockingHandler) HandlerType() eh.EventHandlerType {
+	return "blockingHandler"
+}
+
+func (h *blockingHandler) HandleEvent(ctx context.Context, event eh.Event) error {
+	<-h.release
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.handled++
+	return nil
+}
+
+func (h *blockingHandler) Handled() int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.handled
+}
+
+func TestEventBusPerAggregateOrdering(t *testing.T) {
+	bus := NewEventBus(WithPerAggregateOrdering())
+	if bus == nil {
+		t.Fatal("there should be a bus")
+	}
+	bus.SetHandlingStrategy(eh.AsyncEventHandlingStrategy)
+
+	testutil.EventBusCommonTests(t, bus, bus)
+
+	bus = NewEventBus(WithPerAggregateOrdering())
+	bus.SetHandlingStrategy(eh.AsyncEventHandlingStrategy)
+	testutil.EventBusOrderingCommonTests(t, context.Background(), bus)
+
+	t.Log("publish interleaved events for two aggregates")
+	bus = NewEventBus(WithPerAggregateOrdering())
+	bus.SetHandlingStrategy(eh.AsyncEventHandlingStrategy)
+	handler := &orderHandler{versions: map[eh.UUID][]int{}}
+	bus.AddHandler(handler, mocks.EventType)
+	ctx := context.Background()
+	id1, id2 := eh.NewUUID(), eh.NewUUID()
+	agg1, agg2 := mocks.NewAggregate(id1), mocks.NewAggregate(id2)
+	expected := []int{}
+	for i := 1; i <= 20; i++ {
+		for _, agg := range []*mocks.Aggregate{agg1, agg2} {
+			event := agg.NewEvent(mocks.EventType, &mocks.EventData{"event"})
+			agg.ApplyEvent(ctx, event) // Apply event to increment the aggregate version.
+			if err := bus.PublishEvent(ctx, event); err != nil {
+				t.Error("there should be no error:", err)
+			}
+		}
+		expected = append(expected, i)
+	}
+	closeCtx, cancel := context.WithTimeout(ctx, time.Second)
+	defer cancel()
+	if err := bus.Close(closeCtx); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	for _, id := range []eh.UUID{id1, id2} {
+		if versions := handler.versions[id]; !reflect.DeepEqual(versions, expected) {
+			t.Error("the events should be handled in order:", versions)
+		}
+	}
+}
+
+// orderHandler records the versions of the events for each aggregate, with
+// a varying delay to reorder unordered events.
+type orderHandler struct {
+	versions map[eh.UUID][]int
+	mu       sync.Mutex
+}
+
+func (h *orderHandler) HandlerType() eh.EventHandlerType {
+	return "orderHandler"
+}
+
+func (h *orderHandler) HandleEvent(ctx context.Context, event eh.Event) error {
+	time.Sleep(time.Duration(event.Version()%3) * time.Millisecond)
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.versions[event.AggregateID()] = append(h.versions[event.AggregateID()], event.Version())
+	return nil
+}
+
+// slowHandler counts the events it has handled, after a delay.
+type slowHandler struct {
+	delay   time.Duration
+	handled int
+	mu      sync.Mutex
+}
+
+func (h *slowHandler) HandlerType() eh.EventHandlerType {
+	return "slowHandler"
+}
+
+func (h *slowHandler) HandleEvent(ctx context.Context, event eh.Event) error {
+	time.Sleep(h.delay)
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.handled++
+	return nil
+}
+
+func (h *slowHandler) Handled() int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.handled
+}
+
+type orderMiddleware struct {
+	eh.EventHandler
+	name  string
+	order *[]string
+}
+
+func newOrderMiddleware(name string, order *[]string) eh.EventHandlerMiddleware {
+	return func(h eh.EventHandler) eh.EventHandler {
+		return &orderMiddleware{h, name, order}
+	}
+}
+
+func (m *orderMiddleware) HandleEvent(ctx context.Context, event eh.Event) error {
+	*m.order = append(*m.order, m.name+" before "+string(m.HandlerType()))
+	err := m.EventHandler.HandleEvent(ctx, event)
+	*m.order = append(*m.order, m.name+" after "+string(m.HandlerType()))
+	return err
+}
+
+// blockingMiddleware returns an error without running handlers of a type.
+type blockingMiddleware struct {
+	eh.EventHandler
+	blocked eh.EventHandlerType
+	err     error
+}
+
+func (m *blockingMiddleware) HandleEvent(ctx context.Context, event eh.Event) error {
+	if m.HandlerType() == m.blocked {
+		return m.err
+	}
+	return m.EventHandler.HandleEvent(ctx, event)
+}
+
+func TestEventBusDeadLetterHandler(t *testing.T) {
+	bus := NewEventBus()
+	if bus == nil {
+		t.Fatal("there should be a bus")
+	}
+
+	deadLetterHandler := &deadLetterHandler{}
+	bus.SetDeadLetterHandler(deadLetterHandler)
+	handlerErr := errors.New("handler error")
+	failingHandler := mocks.NewEventHandler("failingHandler")
+	failingHandler.Err = handlerErr
+	bus.AddHandler(failingHandler, mocks.EventType)
+	handler := mocks.NewEventHandler("testHandler")
+	bus.AddHandler(handler, mocks.EventType)
+
+	t.Log("publish event with a failing handler")
+	ctx := mocks.WithContextOne(context.Background(), "testval")
+	agg := mocks.NewAggregate(eh.NewUUID())
+	event1 := agg.NewEvent(mocks.EventType, &mocks.EventData{"event1"})
+	bus.PublishEvent(ctx, event1)
+	if len(deadLetterHandler.letters) != 1 {
+		t.Fatal("there should be one dead letter:", deadLetterHandler.letters)
+	}
+	letter := deadLetterHandler.letters[0]
+	if letter.event != event1 {
+		t.Error("the dead letter event should be correct:", letter.event)
+	}
+	if letter.handler != failingHandler {
+		t.Error("the dead letter handler should be correct:", letter.handler)
+	}
+	if letter.err != handlerErr {
+		t.Error("the dead letter error should be correct:", letter.err)
+	}
+	if val, ok := mocks.ContextOne(letter.ctx); !ok || val != "testval" {
+		t.Error("the context should be correct:", letter.ctx)
+	}
+	if len(handler.Events) != 1 || handler.Events[0] != event1 {
+		t.Error("the handler should receive the event:", handler.Events)
+	}
+
+	t.Log("publish event with a failing dead letter handler")
+	deadLetterHandler.err = errors.New("dead letter error")
+	event2 := agg.NewEvent(mocks.EventType, &mocks.EventData{"event2"})
+	bus.PublishEvent(ctx, event2)
+	if len(deadLetterHandler.letters) != 2 {
+		t.Fatal("there should be two dead letters:", deadLetterHandler.letters)
+	}
+	if len(handler.Events) != 2 || handler.Events[1] != event2 {
+		t.Error("the handler should receive the event:", handler.Events)
+	}
+}
+
+// deadLetterHandler records the dead letters.
+type deadLetterHandler struct {
+	letters []deadLetter
+	err     error
+}
+
+type deadLetter struct {
+	ctx     context.Context
+	event   eh.Event
+	handler eh.EventHandler
+	err     error
+}
+
+func (h *deadLetterHandler) HandleDeadLetter(ctx context.Context, event eh.Event, handler eh.EventHandler, err error) error {
+	h.letters = append(h.letters, deadLetter{ctx, event, handler, err})
+	return h.err
+}
+
+func TestEventBusReplay(t *testing.T) {
+	ctx := context.Background()
+	store := memory.NewEventStore()
+	bus := NewEventBus()
+
+	t.Log("save and publish events before the handler is added")
+	agg := mocks.NewAggregate(eh.NewUUID())
+	event1 := agg.NewEvent(mocks.EventType, &mocks.EventData{"event1"})
+	agg.ApplyEvent(ctx, event1)
+	event2 := agg.NewEvent(mocks.EventType, &mocks.EventData{"event2"})
+	agg.ApplyEvent(ctx, event2)
+	if err := store.Save(ctx, []eh.Event{event1, event2}, 0); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	bus.PublishEvent(ctx, event1)
+	bus.PublishEvent(ctx, event2)
+
+	t.Log("add a handler while more events are published")
+	event3 := agg.NewEvent(mocks.EventType, &mocks.EventData{"event3"})
+	agg.ApplyEvent(ctx, event3)
+	otherAgg := mocks.NewAggregate(eh.NewUUID())
+	otherEvent := otherAgg.NewEvent(mocks.EventType, &mocks.EventData{"other"})
+	streamer := publishingStreamer{store, func() {
+		if err := store.Save(ctx, []eh.Event{event3}, 2); err != nil {
+			t.Fatal("there should be no error:", err)
+		}
+		bus.PublishEvent(ctx, event3)
+		bus.PublishEvent(ctx, otherEvent)
+	}}
+	handler := mocks.NewEventHandler("replayHandler")
+	if err := bus.AddHandlerWithReplay(ctx, handler, eh.MatchAny(), streamer, 0); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+
+	t.Log("publish an event after the replay")
+	event4 := agg.NewEvent(mocks.EventType, &mocks.EventData{"event4"})
+	agg.ApplyEvent(ctx, event4)
+	if err := store.Save(ctx, []eh.Event{event4}, 3); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	bus.PublishEvent(ctx, event4)
+
+	expected := []eh.Event{event1, event2, event3, otherEvent, event4}
+	if len(handler.Events) != len(expected) {
+		t.Fatal("all events should be handled once:", handler.Events)
+	}
+	for i, e := range expected {
+		h := handler.Events[i]
+		if h.AggregateID() != e.AggregateID() || h.Version() != e.Version() ||
+			!reflect.DeepEqual(h.Data(), e.Data()) {
+			t.Error("the event should be correct:", i, h)
+		}
+	}
+
+	t.Log("add a handler from a position")
+	events, err := store.Load(ctx, mocks.AggregateType, agg.AggregateID())
+	if err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	position := events[1].(eh.PositionedEvent).GlobalPosition()
+	positionHandler := mocks.NewEventHandler("positionHandler")
+	if err := bus.AddHandlerWithReplay(ctx, positionHandler, eh.MatchAny(), store, position); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	if len(positionHandler.Events) != 2 ||
+		positionHandler.Events[0].Version() != 3 || positionHandler.Events[1].Version() != 4 {
+		t.Error("only the events after the position should be handled:", positionHandler.Events)
+	}
+}
+
+func TestEventBusReplayWindow(t *testing.T) {
+	ctx := context.Background()
+	store := memory.NewEventStore()
+	bus := NewEventBus(WithReplayWindow(2))
+
+	agg := mocks.NewAggregate(eh.NewUUID())
+	var events []eh.Event
+	for i := 0; i < 3; i++ {
+		event := agg.NewEvent(mocks.EventType, &mocks.EventData{"event"})
+		agg.ApplyEvent(ctx, event)
+		events = append(events, event)
+	}
+	if err := store.Save(ctx, events, 0); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	saved, err := store.Load(ctx, mocks.AggregateType, agg.AggregateID())
+	if err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	position := saved[2].(eh.PositionedEvent).GlobalPosition()
+
+	t.Log("replay the window before the position again")
+	handler := mocks.NewEventHandler("replayHandler")
+	if err := bus.AddHandlerWithReplay(ctx, handler, eh.MatchAny(), store, position); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	if len(handler.Events) != 2 {
+		t.Fatal("the events in the window should be handled:", handler.Events)
+	}
+	for i, event := range handler.Events {
+		if err := mocks.CompareEvents(event, events[i+1]); err != nil {
+			t.Error("the event should be correct:", err)
+		}
+	}
+}
+
+func TestEventBusReplayError(t *testing.T) {
+	ctx := context.Background()
+	bus := NewEventBus()
+
+	replayErr := errors.New("replay error")
+	handler := mocks.NewEventHandler("replayHandler")
+	err := bus.AddHandlerWithReplay(ctx, handler, eh.MatchAny(), failingStreamer{replayErr}, 0)
+	if !errors.Is(err, replayErr) {
+		t.Error("there should be a replay error:", err)
+	}
+
+	t.Log("the handler should be removed")
+	agg := mocks.NewAggregate(eh.NewUUID())
+	bus.PublishEvent(ctx, agg.NewEvent(mocks.EventType, &mocks.EventData{"event1"}))
+	if len(handler.Events) != 0 {
+		t.Error("the handler should not handle events:", handler.Events)
+	}
+}
+
+// publishingStreamer calls publish before replaying, to publish events while
+// a handler is replaying.
+type publishingStreamer struct {
+	eh.FilteredEventStreamer
+	publish func()
+}
+
+func (s publishingStreamer) Replay(ctx context.Context, filter eh.ReplayFilter) (<-chan eh.Event, <-chan error) {
+	s.publish()
+	return s.FilteredEventStreamer.Replay(ctx, filter)
+}
+
+// failingStreamer fails to replay with an error.
+type failingStreamer struct {
+	err error
+}
+
+func (s failingStreamer) Replay(ctx context.Context, filter eh.ReplayFilter) (<-chan eh.Event, <-chan error) {
+	events := make(chan eh.Event)
+	errs := make(chan error, 1)
+	close(events)
+	errs <- s.err
+	close(errs)
+	return events, errs
+}
+
+// countingMiddleware counts the events that it handles, to test that the
+// state of middleware is kept between events.
+type countingMiddleware struct {
+	eh.EventHandler
+	events int
+	closed bool
+	mu     sync.Mutex
+}
+
+func (m *countingMiddleware) HandleEvent(ctx context.Context, event eh.Event) error {
+	m.mu.Lock()
+	m.events++
+	m.mu.Unlock()
+	return m.EventHandler.HandleEvent(ctx, event)
+}
+
+func (m *countingMiddleware) count() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.events
+}
+
+func (m *countingMiddleware) Close() error {
+	m.closed = true
+	return nil
 }
@@ -0,0 +1,178 @@
+// Copyright (c) 2016 - Max Ekman <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package local
+
+import (
+	"context"
+	"sync"
+
+	eh "github.com/looplab/eventhorizon"
+)
+
+// AddHandlerWithReplay adds a handler like AddHandlerWithMatcher, which first
+// handles the events of an event store with a global position after position,
+// for handlers that are added after some events have already been published.
+// A position of 0 replays all events in the namespace of the context. Events
+// published while replaying are kept until the replay is done, and are only
+// handled if they were not already replayed, by their aggregate version. The
+// replayed and kept events are handled in order before returning, regardless
+// of the handling strategy. If the replay fails the handler is removed and the
+// error is returned. Use WithReplayWindow to also replay the events before the
+// position that may have become visible after it.
+func (b *EventBus) AddHandlerWithReplay(ctx context.Context, handler eh.EventHandler, matcher eh.EventMatcher, store eh.FilteredEventStreamer, position int64) error {
+	if matcher == nil {
+		matcher = eh.MatchAny()
+	}
+	state := &replayState{
+		versions: map[eh.UUID]int{},
+	}
+
+	b.handlerMu.Lock()
+	if b.closed {
+		b.handlerMu.Unlock()
+		return ErrBusClosed
+	}
+	b.matchers = append(b.matchers, matcherHandler{matcher, handler, state})
+	b.wrap(handler)
+	b.handlerMu.Unlock()
+
+	if err := b.replay(ctx, handler, matcher, store, position, state); err != nil {
+		b.removeReplayHandler(state)
+		return err
+	}
+
+	// Handle the events that were published while replaying until there are
+	// no more, then let the bus handle the events.
+	for {
+		state.mu.Lock()
+		if len(state.buffered) == 0 {
+			state.live = true
+			state.versions = nil
+			state.mu.Unlock()
+			return nil
+		}
+		buffered := state.buffered
+		state.buffered = nil
+		state.mu.Unlock()
+
+		for _, e := range buffered {
+			if v, ok := state.versions[e.event.AggregateID()]; ok && e.event.Version() <= v {
+				continue
+			}
+			b.handleNow(e.ctx, e.event, handler)
+		}
+	}
+}
+
+// replay handles the events of the store after the position that the matcher
+// matches, and records the last version of each replayed aggregate.
+func (b *EventBus) replay(ctx context.Context, handler eh.EventHandler, matcher eh.EventMatcher, store eh.FilteredEventStreamer, position int64, state *replayState) error {
+	if position -= b.replayWindow; position < 0 {
+		position = 0
+	}
+	events, errs := store.Replay(ctx, eh.ReplayFilter{AfterPosition: position})
+	for event := range events {
+		if !matcher(event) {
+			continue
+		}
+		b.handleNow(ctx, event, handler)
+		if v, ok := state.versions[event.AggregateID()]; !ok || event.Version() > v {
+			state.versions[event.AggregateID()] = event.Version()
+		}
+	}
+	if err := <-errs; err != nil {
+		return err
+	}
+
+	return ctx.Err()
+}
+
+// handleNow handles an event with a handler in the current goroutine, with
+// the middleware and dead letter handler of the bus.
+func (b *EventBus) handleNow(ctx context.Context, event eh.Event, h eh.EventHandler) {
+	b.handlerMu.RLock()
+	wrapped := b.wrapped[h]
+	deadLetterHandler, logger := b.deadLetterHandler, b.logger
+	b.handlerMu.RUnlock()
+
+	handleEvent(ctx, event, h, wrapped, deadLetterHandler, logger)
+}
+
+// removeReplayHandler removes the handler added with a replay state.
+func (b *EventBus) removeReplayHandler(state *replayState) {
+	b.handlerMu.Lock()
+	defer b.handlerMu.Unlock()
+
+	for i, m := range b.matchers {
+		if m.replay == state {
+			b.matchers = append(b.matchers[:i], b.matchers[i+1:]...)
+			if !b.isRegistered(m.handler) {
+				delete(b.wrapped, m.handler)
+			}
+			return
+		}
+	}
+}
+
+// isRegistered returns true if a handler is still added for an event type or
+// with a matcher. The handlerMu must be held.
+func (b *EventBus) isRegistered(h eh.EventHandler) bool {
+	for _, handlers := range b.handlers {
+		if handlers[h] {
+			return true
+		}
+	}
+	for _, m := range b.matchers {
+		if m.handler == h {
+			return true
+		}
+	}
+	return false
+}
+
+// replayState keeps the events published for a handler while it is replaying,
+// and the last replayed version of the aggregates to skip the kept events that
+// were also replayed.
+type replayState struct {
+	live     bool
+	buffered []bufferedEvent
+	mu       sync.Mutex
+
+	// versions is only used by the replaying goroutine.
+	versions map[eh.UUID]int
+}
+
+type bufferedEvent struct {
+	ctx   context.Context
+	event eh.Event
+}
+
+// buffer keeps an event until the replay is done, returning false if the
+// handler should handle it directly.
+func (r *replayState) buffer(ctx context.Context, event eh.Event) bool {
+	if r == nil {
+		return false
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.live {
+		return false
+	}
+	r.buffered = append(r.buffered, bufferedEvent{ctx, event})
+
+	return true
+}
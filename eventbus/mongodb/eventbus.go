@@ -0,0 +1,615 @@
+// Copyright (c) 2016 - Max Ekman <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mongodb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+
+	eh "github.com/looplab/eventhorizon"
+)
+
+// ErrCouldNotDialDB is when the database could not be dialed.
+var ErrCouldNotDialDB = errors.New("could not dial database")
+
+// ErrNoDBSession is when no database session is set.
+var ErrNoDBSession = errors.New("no database session")
+
+// ErrNoSubscriberID is when no subscriber ID is set.
+var ErrNoSubscriberID = errors.New("no subscriber ID")
+
+// ErrCouldNotMarshalEvent is when an event could not be marshaled into BSON.
+var ErrCouldNotMarshalEvent = errors.New("could not marshal event")
+
+// ErrCouldNotUnmarshalEvent is when an event could not be unmarshaled into a concrete type.
+var ErrCouldNotUnmarshalEvent = errors.New("could not unmarshal event")
+
+// DefaultCappedSize is the default size in bytes of the capped collection of
+// published events.
+const DefaultCappedSize = 64 << 20
+
+// tailTimeout is how long to wait for new events before checking if the bus
+// is closed, and to wait before tailing an empty collection again.
+const tailTimeout = time.Second
+
+// EventBus is an event bus that publishes events to a capped collection in
+// MongoDB, which is tailed by all buses using the same database. All buses
+// notify their own handlers and observers about all events. The position of
+// the last received event is stored for the subscriber ID of the bus, which
+// is used to resume after a restart. Consumers subscribed with SubscribeFrom
+// use the IDs of the events in hex as position. The events are received in the
+// order they were inserted in on the server, which is not the order of their
+// IDs with several publishers. It will use the
+// SimpleEventHandlingStrategy by default.
+type EventBus struct {
+	handlers  map[eh.EventType]map[eh.EventHandler]bool
+	observers map[eh.EventObserver]bool
+
+	// handlerMu guards all maps at once for concurrent writes. No need for
+	// separate mutexes per map for this as AddHandler/AddObserver is often
+	// called at program init and not at run time.
+	handlerMu sync.RWMutex
+
+	// handlingStrategy is the strategy to use when handling event, for example
+	// to handle the asynchronously.
+	handlingStrategy eh.EventHandlingStrategy
+
+	session      *mgo.Session
+	dbName       string
+	subscriberID string
+	cappedSize   int
+	checkpoints  eh.CheckpointStore
+	exit         chan struct{}
+	done         chan struct{}
+
+	// retryDelay is the time to wait before handling an event again if the
+	// handler of a consumer failed to handle it.
+	retryDelay time.Duration
+
+	// wg is for the consumers subscribed with SubscribeFrom.
+	wg sync.WaitGroup
+}
+
+// Option is an option setter used to configure creation.
+type Option func(*EventBus) error
+
+// WithCappedSize sets the size in bytes of the capped collection of published
+// events, when it is created. The oldest events are removed when it is full.
+func WithCappedSize(size int) Option {
+	return func(b *EventBus) error {
+		b.cappedSize = size
+		return nil
+	}
+}
+
+// WithCheckpointStore commits the positions of the consumers subscribed with
+// SubscribeFrom to the store, to resume after them when restarted.
+func WithCheckpointStore(s eh.CheckpointStore) Option {
+	return func(b *EventBus) error {
+		b.checkpoints = s
+		return nil
+	}
+}
+
+// NewEventBus creates a EventBus for remote events. The subscriber ID should
+// be unique and stable for each bus, to resume from the last received event
+// after a restart.
+func NewEventBus(url, dbName, subscriberID string, opts ...Option) (*EventBus, error) {
+	session, err := mgo.Dial(url)
+	if err != nil {
+		return nil, ErrCouldNotDialDB
+	}
+
+	session.SetMode(mgo.Strong, true)
+	session.SetSafe(&mgo.Safe{W: 1})
+
+	return NewEventBusWithSession(session, dbName, subscriberID, opts...)
+}
+
+// NewEventBusWithSession creates a EventBus for remote events with a session.
+// The capped collection of events is created if it does not exist. A bus
+// without a stored position starts with the events published after it was
+// created.
+func NewEventBusWithSession(session *mgo.Session, dbName, subscriberID string, opts ...Option) (*EventBus, error) {
+	if session == nil {
+		return nil, ErrNoDBSession
+	}
+
+	if subscriberID == "" {
+		return nil, ErrNoSubscriberID
+	}
+
+	b := &EventBus{
+		handlers:     make(map[eh.EventType]map[eh.EventHandler]bool),
+		observers:    make(map[eh.EventObserver]bool),
+		session:      session,
+		dbName:       dbName,
+		subscriberID: subscriberID,
+		cappedSize:   DefaultCappedSize,
+		exit:         make(chan struct{}),
+		done:         make(chan struct{}),
+		retryDelay:   time.Second,
+	}
+
+	for _, opt := range opts {
+		if err := opt(b); err != nil {
+			return nil, err
+		}
+	}
+
+	// Create the capped collection, which is required for tailing.
+	if err := session.DB(b.dbName).C("eventbus").Create(&mgo.CollectionInfo{
+		Capped:   true,
+		MaxBytes: b.cappedSize,
+	}); err != nil && !isCollectionExists(err) {
+		return nil, err
+	}
+
+	position, err := b.position()
+	if err != nil {
+		return nil, err
+	}
+
+	go b.recv(position)
+
+	return b, nil
+}
+
+// SetHandlingStrategy implements the SetHandlingStrategy method of the
+// eventhorizon.EventBus interface.
+func (b *EventBus) SetHandlingStrategy(strategy eh.EventHandlingStrategy) {
+	b.handlingStrategy = strategy
+}
+
+// PublishEvent publishes an event to the capped collection. The handlers and
+// observers of all buses, including this one, receive the event when it is
+// read from the collection.
+func (b *EventBus) PublishEvent(ctx context.Context, event eh.Event) error {
+	// Downcast the event data to the version to publish.
+	eventData, metadata, err := eh.EncodeEventData(event)
+	if err != nil {
+		return ErrCouldNotMarshalEvent
+	}
+
+	mongoEvent := mongoEvent{
+		ID:            bson.NewObjectId(),
+		AggregateID:   event.AggregateID(),
+		AggregateType: event.AggregateType(),
+		EventType:     event.EventType(),
+		Version:       event.Version(),
+		Metadata:      metadata,
+		Timestamp:     event.Timestamp(),
+		Context:       eh.MarshalContext(ctx),
+	}
+
+	// Marshal event data if there is any.
+	if eventData != nil {
+		rawData, err := bson.Marshal(eventData)
+		if err != nil {
+			return ErrCouldNotMarshalEvent
+		}
+		mongoEvent.RawData = bson.Raw{Kind: 3, Data: rawData}
+	}
+
+	sess := b.session.Copy()
+	defer sess.Close()
+
+	return sess.DB(b.dbName).C("eventbus").Insert(mongoEvent)
+}
+
+// AddHandler implements the AddHandler method of the eventhorizon.EventBus interface.
+func (b *EventBus) AddHandler(handler eh.EventHandler, eventType eh.EventType) {
+	b.handlerMu.Lock()
+	defer b.handlerMu.Unlock()
+
+	// Create handler list for new event types.
+	if _, ok := b.handlers[eventType]; !ok {
+		b.handlers[eventType] = make(map[eh.EventHandler]bool)
+	}
+
+	// Add handler to event type.
+	b.handlers[eventType][handler] = true
+}
+
+// AddObserver implements the AddObserver method of the eventhorizon.EventBus interface.
+func (b *EventBus) AddObserver(observer eh.EventObserver) {
+	b.handlerMu.Lock()
+	defer b.handlerMu.Unlock()
+
+	b.observers[observer] = true
+}
+
+// Clear removes the published events and all stored positions.
+func (b *EventBus) Clear() error {
+	db := b.session.DB(b.dbName)
+	if err := db.C("eventbus").DropCollection(); err != nil {
+		return err
+	}
+	if err := db.C("eventbus_positions").DropCollection(); err != nil {
+		return err
+	}
+	return nil
+}
+
+// SubscribeFrom implements the SubscribeFrom method of the
+// eventhorizon.EventSubscriber interface. The position is the ID of an event in
+// hex, the handler receives the events inserted after it from a tailing cursor
+// of its own. The events must still be in the capped collection to be received.
+func (b *EventBus) SubscribeFrom(ctx context.Context, position string, matcher eh.EventMatcher, handler eh.EventHandler) error {
+	if matcher == nil {
+		matcher = eh.MatchAny()
+	}
+
+	consumer := string(handler.HandlerType())
+	if b.checkpoints != nil {
+		committed, err := b.checkpoints.LoadCheckpoint(ctx, consumer)
+		if err != nil {
+			return err
+		}
+		if committed != "" {
+			position = committed
+		}
+	}
+
+	var id bson.ObjectId
+	if position != "" {
+		if !bson.IsObjectIdHex(position) {
+			return eh.ErrInvalidPosition
+		}
+		id = bson.ObjectIdHex(position)
+	}
+
+	b.wg.Add(1)
+	go b.consume(ctx, id, consumer, matcher, handler)
+
+	return nil
+}
+
+// Close stops receiving events and closes the database session. The position
+// of the last received event is kept to resume from.
+func (b *EventBus) Close() {
+	close(b.exit)
+	<-b.done
+	b.wg.Wait()
+	b.session.Close()
+}
+
+// position returns the position of the last received event for the subscriber
+// ID. Without a stored position the last published event is used, which is
+// stored to not miss any events published before a restart.
+func (b *EventBus) position() (bson.ObjectId, error) {
+	sess := b.session.Copy()
+	defer sess.Close()
+
+	var p struct {
+		Position bson.ObjectId `bson:"position"`
+	}
+	err := sess.DB(b.dbName).C("eventbus_positions").FindId(b.subscriberID).One(&p)
+	if err == nil {
+		return p.Position, nil
+	} else if err != mgo.ErrNotFound {
+		return "", err
+	}
+
+	var last mongoEvent
+	if err := sess.DB(b.dbName).C("eventbus").Find(nil).Sort("-$natural").One(&last); err == mgo.ErrNotFound {
+		return "", nil
+	} else if err != nil {
+		return "", err
+	}
+
+	if err := b.savePosition(sess, last.ID); err != nil {
+		return "", err
+	}
+
+	return last.ID, nil
+}
+
+// savePosition stores the position of the last received event.
+func (b *EventBus) savePosition(sess *mgo.Session, position bson.ObjectId) error {
+	_, err := sess.DB(b.dbName).C("eventbus_positions").UpsertId(b.subscriberID,
+		bson.M{"$set": bson.M{"position": position}},
+	)
+	return err
+}
+
+// recv tails the capped collection after the position until the bus is closed.
+func (b *EventBus) recv(position bson.ObjectId) {
+	defer close(b.done)
+
+	log.Println("eventbus: start receiving")
+	defer log.Println("eventbus: stop receiving")
+
+	sess := b.session.Copy()
+	defer sess.Close()
+
+	b.tail(sess, b.exit, position, func(e mongoEvent) bool {
+		b.handle(e)
+
+		if err := b.savePosition(sess, e.ID); err != nil {
+			log.Println("error: event bus save position:", err)
+		}
+		return true
+	})
+}
+
+// consume handles the events of a consumer subscribed with SubscribeFrom, in
+// order, until the context is canceled or the bus is closed. An event that
+// fails to be handled is retried until it succeeds, and the position is
+// committed after it has been handled.
+func (b *EventBus) consume(ctx context.Context, position bson.ObjectId, consumer string, matcher eh.EventMatcher, handler eh.EventHandler) {
+	defer b.wg.Done()
+
+	// Stop when either the subscription or the bus is done.
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go func() {
+		select {
+		case <-b.exit:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	sess := b.session.Copy()
+	defer sess.Close()
+
+	b.tail(sess, ctx.Done(), position, func(e mongoEvent) bool {
+		eventCtx, event, err := b.decodeEvent(e)
+		if err != nil {
+			// Skip events that can't be decoded.
+			log.Println("error: event bus receive:", err)
+		} else if matcher(event) && !b.retryEvent(ctx, eventCtx, handler, event) {
+			// Stopped before the event was handled.
+			return false
+		}
+
+		if b.checkpoints != nil {
+			if err := b.checkpoints.SaveCheckpoint(ctx, consumer, e.ID.Hex()); err != nil {
+				log.Println("error: event bus save checkpoint:", err)
+			}
+		}
+		return true
+	})
+}
+
+// retryEvent handles an event with the handler, retrying until it succeeds.
+// Returns false if the context was done before it was handled.
+func (b *EventBus) retryEvent(ctx, eventCtx context.Context, handler eh.EventHandler, event eh.Event) bool {
+	for {
+		err := handler.HandleEvent(eventCtx, event)
+		if err == nil {
+			return true
+		}
+		log.Printf("error: event bus handler %s: %s", handler.HandlerType(), err)
+
+		select {
+		case <-time.After(b.retryDelay):
+		case <-ctx.Done():
+			return false
+		}
+	}
+}
+
+// tail tails the capped collection after the position in natural order,
+// calling fn with every event until exit is closed or fn returns false.
+func (b *EventBus) tail(sess *mgo.Session, exit <-chan struct{}, position bson.ObjectId, fn func(mongoEvent) bool) {
+	c := sess.DB(b.dbName).C("eventbus")
+
+	var iter *mgo.Iter
+	defer func() {
+		if iter != nil {
+			iter.Close()
+		}
+	}()
+	skip := false
+	for {
+		select {
+		case <-exit:
+			return
+		default:
+		}
+
+		if iter == nil {
+			// The IDs are created by the publishers and are not ordered
+			// between them, the events are instead tailed in natural order,
+			// which is the order they were inserted in. The events up to
+			// the position are skipped. If the event at the position has been
+			// removed from the capped collection all events are after it.
+			skip = false
+			if position != "" {
+				n, err := c.FindId(position).Count()
+				if err != nil {
+					log.Println("error: event bus receive:", err)
+					select {
+					case <-exit:
+						return
+					case <-time.After(tailTimeout):
+					}
+					continue
+				}
+				skip = n > 0
+			}
+			iter = c.Find(nil).Sort("$natural").Tail(tailTimeout)
+		}
+
+		var e mongoEvent
+		for iter.Next(&e) {
+			if skip {
+				skip = e.ID != position
+				e = mongoEvent{}
+				continue
+			}
+			if !fn(e) {
+				return
+			}
+			position = e.ID
+
+			e = mongoEvent{}
+		}
+
+		// Keep tailing with the same cursor if it is still alive.
+		if iter.Timeout() {
+			continue
+		}
+
+		// Tail again after the position if the cursor died, for example when
+		// the collection is empty.
+		if err := iter.Close(); err != nil {
+			log.Println("error: event bus receive:", err)
+		}
+		iter = nil
+
+		select {
+		case <-exit:
+			return
+		case <-time.After(tailTimeout):
+		}
+	}
+}
+
+// handle notifies the handlers and observers about an event.
+func (b *EventBus) handle(mongoEvent mongoEvent) {
+	ctx, event, err := b.decodeEvent(mongoEvent)
+	if err != nil {
+		log.Println("error: event bus receive:", err)
+		return
+	}
+
+	b.handlerMu.RLock()
+	defer b.handlerMu.RUnlock()
+
+	for h := range b.handlers[event.EventType()] {
+		if b.handlingStrategy == eh.AsyncEventHandlingStrategy {
+			go handleEvent(ctx, h, event)
+		} else {
+			handleEvent(ctx, h, event)
+		}
+	}
+
+	for o := range b.observers {
+		if b.handlingStrategy == eh.AsyncEventHandlingStrategy {
+			go o.Notify(ctx, event)
+		} else {
+			o.Notify(ctx, event)
+		}
+	}
+}
+
+// decodeEvent creates an event with the context from a received event. The
+// event data is of the correct type if it is registered, upcasted to the
+// current version.
+func (b *EventBus) decodeEvent(mongoEvent mongoEvent) (context.Context, eh.Event, error) {
+	// Create an event of the correct type, upcasted to the current version,
+	// and manually decode the raw BSON event.
+	data, metadata, err := eh.DecodeEventData(mongoEvent.EventType, mongoEvent.Metadata, func(data eh.EventData) error {
+		return mongoEvent.RawData.Unmarshal(data)
+	})
+	if err != nil && err != eh.ErrEventDataNotRegistered {
+		return nil, nil, ErrCouldNotUnmarshalEvent
+	}
+	if err == nil {
+		// Set concrete event and zero out the decoded event.
+		mongoEvent.data = data
+		mongoEvent.Metadata = metadata
+		mongoEvent.RawData = bson.Raw{}
+	}
+
+	return eh.UnmarshalContext(mongoEvent.Context), event{mongoEvent: mongoEvent}, nil
+}
+
+// handleEvent handles an event and logs any error, the handlers of other types
+// still handle the event.
+func handleEvent(ctx context.Context, h eh.EventHandler, event eh.Event) {
+	if err := h.HandleEvent(ctx, event); err != nil {
+		log.Printf("error: event bus handler %s: %s", h.HandlerType(), err)
+	}
+}
+
+// isCollectionExists returns true if the error is because the collection
+// already exists.
+func isCollectionExists(err error) bool {
+	if err, ok := err.(*mgo.QueryError); ok {
+		return err.Code == 48
+	}
+	return false
+}
+
+// mongoEvent is the internal event used with the MongoDB event bus.
+type mongoEvent struct {
+	ID            bson.ObjectId          `bson:"_id"`
+	EventType     eh.EventType           `bson:"event_type"`
+	RawData       bson.Raw               `bson:"data,omitempty"`
+	data          eh.EventData           `bson:"-"`
+	Timestamp     time.Time              `bson:"timestamp"`
+	AggregateType eh.AggregateType       `bson:"aggregate_type"`
+	AggregateID   eh.UUID                `bson:"aggregate_id"`
+	Version       int                    `bson:"version"`
+	Metadata      map[string]interface{} `bson:"metadata,omitempty"`
+	Context       map[string]interface{} `bson:"context"`
+}
+
+// event is the private implementation of the eventhorizon.Event interface
+// for a MongoDB event bus.
+type event struct {
+	mongoEvent
+}
+
+// EventType implements the EventType method of the eventhorizon.Event interface.
+func (e event) EventType() eh.EventType {
+	return e.mongoEvent.EventType
+}
+
+// Data implements the Data method of the eventhorizon.Event interface.
+func (e event) Data() eh.EventData {
+	return e.mongoEvent.data
+}
+
+// Timestamp implements the Timestamp method of the eventhorizon.Event interface.
+func (e event) Timestamp() time.Time {
+	return e.mongoEvent.Timestamp
+}
+
+// AggregateType implements the AggregateType method of the eventhorizon.Event interface.
+func (e event) AggregateType() eh.AggregateType {
+	return e.mongoEvent.AggregateType
+}
+
+// AggrgateID implements the AggrgateID method of the eventhorizon.Event interface.
+func (e event) AggregateID() eh.UUID {
+	return e.mongoEvent.AggregateID
+}
+
+// Version implements the Version method of the eventhorizon.Event interface.
+func (e event) Version() int {
+	return e.mongoEvent.Version
+}
+
+// Metadata implements the Metadata method of the eventhorizon.Event interface.
+func (e event) Metadata() map[string]interface{} {
+	return e.mongoEvent.Metadata
+}
+
+// String implements the String method of the eventhorizon.Event interface.
+func (e event) String() string {
+	return fmt.Sprintf("%s@%d", e.mongoEvent.EventType, e.mongoEvent.Version)
+}
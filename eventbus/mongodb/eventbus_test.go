@@ -0,0 +1,230 @@
+// Copyright (c) 2016 - Max Ekman <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mongodb
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	eh "github.com/looplab/eventhorizon"
+	"github.com/looplab/eventhorizon/eventbus/testutil"
+	"github.com/looplab/eventhorizon/mocks"
+	"gopkg.in/mgo.v2/bson"
+)
+
+func TestEventBus(t *testing.T) {
+	bus, err := NewEventBus(testURL(), "test", "bus1")
+	if err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	if bus == nil {
+		t.Fatal("there should be a bus")
+	}
+	defer bus.Close()
+	defer bus.Clear()
+
+	// Another bus to test the observer.
+	bus2, err := NewEventBus(testURL(), "test", "bus2")
+	if err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	defer bus2.Close()
+
+	testutil.EventBusCommonTests(t, bus, bus2)
+}
+
+func TestEventBusAsync(t *testing.T) {
+	bus, err := NewEventBus(testURL(), "test", "bus1")
+	if err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	if bus == nil {
+		t.Fatal("there should be a bus")
+	}
+	defer bus.Close()
+	defer bus.Clear()
+	bus.SetHandlingStrategy(eh.AsyncEventHandlingStrategy)
+
+	// Another bus to test the observer.
+	bus2, err := NewEventBus(testURL(), "test", "bus2")
+	if err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	defer bus2.Close()
+	bus2.SetHandlingStrategy(eh.AsyncEventHandlingStrategy)
+
+	testutil.EventBusCommonTests(t, bus, bus2)
+}
+
+func TestEventBusResume(t *testing.T) {
+	publisher, err := NewEventBus(testURL(), "test", "publisher")
+	if err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	defer publisher.Close()
+	defer publisher.Clear()
+
+	bus, err := NewEventBus(testURL(), "test", "subscriber")
+	if err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	handler := mocks.NewEventHandler("testHandler")
+	bus.AddHandler(handler, mocks.EventType)
+
+	t.Log("publish event to a handler on another bus")
+	id := eh.NewUUID()
+	agg := mocks.NewAggregate(id)
+	event1 := agg.NewEvent(mocks.EventType, &mocks.EventData{"event1"})
+	agg.ApplyEvent(context.Background(), event1)
+	if err := publisher.PublishEvent(context.Background(), event1); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	handler.WaitForEvent(t)
+	if len(handler.Events) != 1 {
+		t.Fatal("there should be one event:", handler.Events)
+	}
+	if err := mocks.CompareEvents(handler.Events[0], event1); err != nil {
+		t.Error("the event was incorrect:", err)
+	}
+	if handler.Events[0].AggregateID() != id || handler.Events[0].Version() != 1 {
+		t.Error("the event aggregate ID and version should be correct:", handler.Events[0])
+	}
+
+	t.Log("resume with events published while the bus was closed")
+	bus.Close()
+	event2 := agg.NewEvent(mocks.EventType, &mocks.EventData{"event2"})
+	agg.ApplyEvent(context.Background(), event2)
+	if err := publisher.PublishEvent(context.Background(), event2); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+
+	bus, err = NewEventBus(testURL(), "test", "subscriber")
+	if err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	defer bus.Close()
+	handler = mocks.NewEventHandler("testHandler")
+	bus.AddHandler(handler, mocks.EventType)
+	handler.WaitForEvent(t)
+	if len(handler.Events) != 1 {
+		t.Fatal("there should be one event:", handler.Events)
+	}
+	if err := mocks.CompareEvents(handler.Events[0], event2); err != nil {
+		t.Error("the event was incorrect:", err)
+	}
+	if handler.Events[0].AggregateID() != id || handler.Events[0].Version() != 2 {
+		t.Error("the event aggregate ID and version should be correct:", handler.Events[0])
+	}
+}
+
+func TestEventBusCheckpoint(t *testing.T) {
+	publisher, err := NewEventBus(testURL(), "test", "publisher")
+	if err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	defer publisher.Close()
+	defer publisher.Clear()
+
+	testutil.EventBusCheckpointCommonTests(t, context.Background(), func(store eh.CheckpointStore) (eh.EventBus, func()) {
+		bus, err := NewEventBus(testURL(), "test", "consumer", WithCheckpointStore(store))
+		if err != nil {
+			t.Fatal("there should be no error:", err)
+		}
+		return bus, bus.Close
+	})
+}
+
+func TestEventBusSubscribeFromInsertionOrder(t *testing.T) {
+	bus, err := NewEventBus(testURL(), "test", "bus")
+	if err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	defer bus.Close()
+	defer bus.Clear()
+
+	ctx := context.Background()
+	agg := mocks.NewAggregate(eh.NewUUID())
+	event1 := agg.NewEvent(mocks.EventType, &mocks.EventData{"event1"})
+	agg.ApplyEvent(ctx, event1)
+	if err := bus.PublishEvent(ctx, event1); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	var last mongoEvent
+	if err := bus.session.DB("test").C("eventbus").Find(nil).Sort("-$natural").One(&last); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+
+	t.Log("receive an event inserted after the position with an older ID")
+	event2 := agg.NewEvent(mocks.EventType, nil)
+	agg.ApplyEvent(ctx, event2)
+	if err := bus.session.DB("test").C("eventbus").Insert(mongoEvent{
+		ID:            bson.NewObjectIdWithTime(time.Now().Add(-time.Hour)),
+		AggregateID:   event2.AggregateID(),
+		AggregateType: event2.AggregateType(),
+		EventType:     event2.EventType(),
+		Version:       event2.Version(),
+		Timestamp:     event2.Timestamp(),
+		Context:       map[string]interface{}{},
+	}); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+
+	handler := mocks.NewEventHandler("orderHandler")
+	if err := bus.SubscribeFrom(ctx, last.ID.Hex(), eh.MatchAny(), handler); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	handler.WaitForEvent(t)
+	if len(handler.Events) != 1 || handler.Events[0].Version() != 2 {
+		t.Error("the inserted event should be received:", handler.Events)
+	}
+}
+
+func TestEventBusSubscribeFromInvalidPosition(t *testing.T) {
+	bus, err := NewEventBus(testURL(), "test", "bus")
+	if err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	defer bus.Close()
+
+	handler := mocks.NewEventHandler("positionHandler")
+	if err := bus.SubscribeFrom(context.Background(), "invalid", eh.MatchAny(), handler); err != eh.ErrInvalidPosition {
+		t.Error("there should be a ErrInvalidPosition error:", err)
+	}
+}
+
+func TestNewEventBus(t *testing.T) {
+	bus, err := NewEventBusWithSession(nil, "test", "bus")
+	if err != ErrNoDBSession {
+		t.Error("there should be a ErrNoDBSession error:", err)
+	}
+	if bus != nil {
+		t.Error("there should be no bus:", bus)
+	}
+}
+
+// testURL returns the URL of the MongoDB server to test with.
+func testURL() string {
+	// Support Wercker testing with MongoDB.
+	host := os.Getenv("MONGO_PORT_27017_TCP_ADDR")
+	port := os.Getenv("MONGO_PORT_27017_TCP_PORT")
+
+	url := "localhost"
+	if host != "" && port != "" {
+		url = host + ":" + port
+	}
+	return url
+}
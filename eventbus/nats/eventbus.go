@@ -0,0 +1,471 @@
+// Copyright (c) 2016 - Max Ekman <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package nats
+
+import (
+	"context"
+	"errors"
+	"log"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/nats-io/nats.go"
+
+	eh "github.com/looplab/eventhorizon"
+	"github.com/looplab/eventhorizon/eventstore/codec"
+)
+
+// ErrCouldNotMarshalEvent is when an event could not be marshaled with the codec.
+var ErrCouldNotMarshalEvent = errors.New("could not marshal event")
+
+// ErrCouldNotUnmarshalEvent is when an event could not be unmarshaled into a concrete type.
+var ErrCouldNotUnmarshalEvent = errors.New("could not unmarshal event")
+
+// EventBus is an event bus that publishes events on NATS JetStream, with one
+// subject per aggregate type. Handlers are subscribed with a durable consumer
+// per handler type, shared by all buses with the same app ID, which gives
+// at-least-once delivery to one handler of each type. Observers receive all
+// events published by any of the buses. Consumers subscribed with
+// SubscribeFrom use the sequence of the events in the stream as position. It
+// will use the SimpleEventHandlingStrategy by default.
+type EventBus struct {
+	handlers  map[eh.EventHandlerType]map[eh.EventType]eh.EventHandler
+	observers map[eh.EventObserver]bool
+
+	// handlerMu guards all maps at once for concurrent writes. No need for
+	// separate mutexes per map for this as AddHandler/AddObserver is often
+	// called at program init and not at run time.
+	handlerMu sync.RWMutex
+
+	// handlingStrategy is the strategy to use when handling event, for example
+	// to handle the asynchronously.
+	handlingStrategy eh.EventHandlingStrategy
+
+	prefix      string
+	conn        *nats.Conn
+	js          nats.JetStreamContext
+	codec       eh.EventCodec
+	checkpoints eh.CheckpointStore
+	natsOpts    []nats.Option
+
+	// subscribeErr is the first error of subscribing a handler type, which is
+	// guarded by handlerMu.
+	subscribeErr error
+
+	// retryDelay is the time to wait before handling an event again if its
+	// handler failed to handle it.
+	retryDelay time.Duration
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// Option is an option setter used to configure creation.
+type Option func(*EventBus)
+
+// WithCodec uses a codec to marshal the events, instead of the default
+// codec.JSONEventCodec. All buses with the same app ID must use the same codec.
+func WithCodec(c eh.EventCodec) Option {
+	return func(b *EventBus) {
+		b.codec = c
+	}
+}
+
+// WithCheckpointStore commits the positions of the consumers subscribed with
+// SubscribeFrom to the store, to resume after them when restarted.
+func WithCheckpointStore(s eh.CheckpointStore) Option {
+	return func(b *EventBus) {
+		b.checkpoints = s
+	}
+}
+
+// WithNATSOptions sets options for the connection created by NewEventBus, after
+// the defaults which keep reconnecting forever.
+func WithNATSOptions(opts ...nats.Option) Option {
+	return func(b *EventBus) {
+		b.natsOpts = append(b.natsOpts, opts...)
+	}
+}
+
+// NewEventBus creates a EventBus for remote events. The stream for the app ID
+// is created if it does not exist.
+func NewEventBus(appID, url string, opts ...Option) (*EventBus, error) {
+	config := &EventBus{}
+	for _, opt := range opts {
+		opt(config)
+	}
+
+	// Keep reconnecting forever by default, subscriptions are restored by
+	// the client after reconnects.
+	natsOpts := append([]nats.Option{
+		nats.MaxReconnects(-1),
+		nats.ReconnectWait(time.Second),
+		nats.DisconnectErrHandler(func(_ *nats.Conn, err error) {
+			log.Println("eventbus: disconnected:", err)
+		}),
+		nats.ReconnectHandler(func(c *nats.Conn) {
+			log.Println("eventbus: reconnected to:", c.ConnectedUrl())
+		}),
+	}, config.natsOpts...)
+
+	conn, err := nats.Connect(url, natsOpts...)
+	if err != nil {
+		return nil, err
+	}
+
+	b, err := NewEventBusWithConn(appID, conn, opts...)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	return b, nil
+}
+
+// NewEventBusWithConn creates a EventBus for remote events using a NATS
+// connection, configured with the options. The connection is not closed if it
+// fails.
+func NewEventBusWithConn(appID string, conn *nats.Conn, opts ...Option) (*EventBus, error) {
+	js, err := conn.JetStream()
+	if err != nil {
+		return nil, err
+	}
+
+	// Create the stream for the app if it does not exist.
+	if _, err := js.StreamInfo(appID); err == nats.ErrStreamNotFound {
+		if _, err := js.AddStream(&nats.StreamConfig{
+			Name:     appID,
+			Subjects: []string{appID + ".>"},
+			Storage:  nats.FileStorage,
+		}); err != nil {
+			return nil, err
+		}
+	} else if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	b := &EventBus{
+		handlers:   make(map[eh.EventHandlerType]map[eh.EventType]eh.EventHandler),
+		observers:  make(map[eh.EventObserver]bool),
+		prefix:     appID + ".",
+		conn:       conn,
+		js:         js,
+		codec:      codec.JSONEventCodec{},
+		retryDelay: time.Second,
+		ctx:        ctx,
+		cancel:     cancel,
+	}
+
+	for _, opt := range opts {
+		opt(b)
+	}
+
+	// Observers receive all events, without any delivery guarantees.
+	if _, err := conn.Subscribe(b.prefix+">", b.observe); err != nil {
+		return nil, err
+	}
+
+	// Make sure that the subscription is registered by the server before
+	// returning.
+	if err := conn.Flush(); err != nil {
+		return nil, err
+	}
+
+	return b, nil
+}
+
+// SetHandlingStrategy implements the SetHandlingStrategy method of the
+// eventhorizon.EventBus interface.
+func (b *EventBus) SetHandlingStrategy(strategy eh.EventHandlingStrategy) {
+	b.handlingStrategy = strategy
+}
+
+// PublishEvent publishes an event on the subject for its aggregate type, the
+// event is stored in the stream before returning.
+func (b *EventBus) PublishEvent(ctx context.Context, event eh.Event) error {
+	data, err := b.marshalEvent(ctx, event)
+	if err != nil {
+		return err
+	}
+
+	if _, err := b.js.Publish(b.prefix+string(event.AggregateType()), data); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// AddHandler implements the AddHandler method of the eventhorizon.EventBus
+// interface. The first time a handler type is added a durable subscription
+// is started for it. An error subscribing is returned by HealthCheck and Close.
+func (b *EventBus) AddHandler(handler eh.EventHandler, eventType eh.EventType) {
+	b.handlerMu.Lock()
+	defer b.handlerMu.Unlock()
+
+	handlerType := handler.HandlerType()
+	if _, ok := b.handlers[handlerType]; ok {
+		b.handlers[handlerType][eventType] = handler
+		return
+	}
+	b.handlers[handlerType] = map[eh.EventType]eh.EventHandler{
+		eventType: handler,
+	}
+
+	// Let all buses with handlers of the same type share the consumer, and
+	// only acknowledge events when they have been handled.
+	if _, err := b.js.QueueSubscribe(b.prefix+">", string(handlerType),
+		func(msg *nats.Msg) { b.handle(handlerType, msg) },
+		nats.Durable(string(handlerType)),
+		nats.ManualAck(),
+		nats.AckExplicit(),
+		nats.DeliverNew(),
+	); err != nil {
+		log.Println("error: event bus subscribe:", err)
+		if b.subscribeErr == nil {
+			b.subscribeErr = err
+		}
+	}
+}
+
+// AddObserver implements the AddObserver method of the eventhorizon.EventBus interface.
+func (b *EventBus) AddObserver(observer eh.EventObserver) {
+	b.handlerMu.Lock()
+	defer b.handlerMu.Unlock()
+
+	b.observers[observer] = true
+}
+
+// SubscribeFrom implements the SubscribeFrom method of the
+// eventhorizon.EventSubscriber interface. The position is the sequence of an
+// event in the stream, the handler receives the events after it from an
+// ephemeral consumer of its own.
+func (b *EventBus) SubscribeFrom(ctx context.Context, position string, matcher eh.EventMatcher, handler eh.EventHandler) error {
+	if matcher == nil {
+		matcher = eh.MatchAny()
+	}
+
+	consumer := string(handler.HandlerType())
+	if b.checkpoints != nil {
+		committed, err := b.checkpoints.LoadCheckpoint(ctx, consumer)
+		if err != nil {
+			return err
+		}
+		if committed != "" {
+			position = committed
+		}
+	}
+
+	deliver := nats.DeliverAll()
+	if position != "" {
+		sequence, err := strconv.ParseUint(position, 10, 64)
+		if err != nil {
+			return eh.ErrInvalidPosition
+		}
+		deliver = nats.DeliverByStartSequence(sequence + 1)
+	}
+
+	sub, err := b.js.SubscribeSync(b.prefix+">", deliver, nats.AckNone())
+	if err != nil {
+		return err
+	}
+
+	b.wg.Add(1)
+	go b.consume(ctx, sub, consumer, matcher, handler)
+
+	return nil
+}
+
+// HealthCheck implements the HealthCheck method of the
+// eventhorizon.HealthChecker interface. It returns the error of a handler type
+// that could not be subscribed.
+func (b *EventBus) HealthCheck(ctx context.Context) error {
+	b.handlerMu.RLock()
+	defer b.handlerMu.RUnlock()
+
+	return b.subscribeErr
+}
+
+// Close stops the consumers, drains the subscriptions and closes the
+// connection. The durable consumers are not unsubscribed, to receive the
+// events published while closed. The error of a handler type that could not
+// be subscribed is returned if draining succeeds.
+func (b *EventBus) Close() error {
+	b.cancel()
+	b.wg.Wait()
+	if err := b.conn.Drain(); err != nil {
+		return err
+	}
+
+	return b.HealthCheck(context.Background())
+}
+
+// consume handles the events of a consumer subscribed with SubscribeFrom, in
+// order, until the context is canceled or the bus is closed. An event that
+// fails to be handled is retried until it succeeds, and the position is
+// committed after it has been handled.
+func (b *EventBus) consume(ctx context.Context, sub *nats.Subscription, consumer string, matcher eh.EventMatcher, handler eh.EventHandler) {
+	defer b.wg.Done()
+	defer sub.Unsubscribe()
+
+	// Stop when either the subscription or the bus is done.
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go func() {
+		select {
+		case <-b.ctx.Done():
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	for {
+		msg, err := sub.NextMsgWithContext(ctx)
+		if err != nil {
+			if ctx.Err() == nil {
+				log.Println("error: event bus receive:", err)
+			}
+			return
+		}
+
+		meta, err := msg.Metadata()
+		if err != nil {
+			log.Println("error: event bus receive:", err)
+			continue
+		}
+
+		eventCtx, event, err := b.unmarshalEvent(msg.Data)
+		if err != nil {
+			// Skip events that can't be decoded.
+			log.Println("error: event bus receive:", err)
+		} else if matcher(event) && !b.retryEvent(ctx, eventCtx, handler, event) {
+			// Stopped before the event was handled.
+			return
+		}
+
+		if b.checkpoints != nil {
+			position := strconv.FormatUint(meta.Sequence.Stream, 10)
+			if err := b.checkpoints.SaveCheckpoint(ctx, consumer, position); err != nil {
+				log.Println("error: event bus save checkpoint:", err)
+			}
+		}
+	}
+}
+
+// retryEvent handles an event with the handler, retrying until it succeeds.
+// Returns false if the context was done before it was handled.
+func (b *EventBus) retryEvent(ctx, eventCtx context.Context, handler eh.EventHandler, event eh.Event) bool {
+	for {
+		err := handler.HandleEvent(eventCtx, event)
+		if err == nil {
+			return true
+		}
+		log.Printf("error: event bus handler %s: %s", handler.HandlerType(), err)
+
+		select {
+		case <-time.After(b.retryDelay):
+		case <-ctx.Done():
+			return false
+		}
+	}
+}
+
+// handle handles an event from the durable subscription of a handler type.
+func (b *EventBus) handle(handlerType eh.EventHandlerType, msg *nats.Msg) {
+	ctx, event, err := b.unmarshalEvent(msg.Data)
+	if err != nil {
+		log.Println("error: event bus receive:", err)
+		// Don't redeliver events that can't be decoded.
+		if err := msg.Term(); err != nil {
+			log.Println("error: event bus receive:", err)
+		}
+		return
+	}
+
+	b.handlerMu.RLock()
+	handler, ok := b.handlers[handlerType][event.EventType()]
+	b.handlerMu.RUnlock()
+
+	if !ok {
+		// Ack events that the handler type does not handle.
+		if err := msg.Ack(); err != nil {
+			log.Println("error: event bus receive:", err)
+		}
+		return
+	}
+
+	// Redeliver the event after the retry delay if it could not be handled.
+	handle := func() {
+		if err := handler.HandleEvent(ctx, event); err != nil {
+			log.Printf("error: event bus handler %s: %s", handlerType, err)
+			if err := msg.NakWithDelay(b.retryDelay); err != nil {
+				log.Println("error: event bus receive:", err)
+			}
+			return
+		}
+		if err := msg.Ack(); err != nil {
+			log.Println("error: event bus receive:", err)
+		}
+	}
+
+	if b.handlingStrategy == eh.AsyncEventHandlingStrategy {
+		go handle()
+	} else {
+		handle()
+	}
+}
+
+// observe notifies all observers about an event.
+func (b *EventBus) observe(msg *nats.Msg) {
+	ctx, event, err := b.unmarshalEvent(msg.Data)
+	if err != nil {
+		log.Println("error: event bus receive:", err)
+		return
+	}
+
+	b.handlerMu.RLock()
+	defer b.handlerMu.RUnlock()
+
+	for o := range b.observers {
+		if b.handlingStrategy == eh.AsyncEventHandlingStrategy {
+			go o.Notify(ctx, event)
+		} else {
+			o.Notify(ctx, event)
+		}
+	}
+}
+
+// marshalEvent marshals an event and the context with the codec.
+func (b *EventBus) marshalEvent(ctx context.Context, event eh.Event) ([]byte, error) {
+	data, err := b.codec.MarshalEvent(ctx, event)
+	if err != nil {
+		return nil, ErrCouldNotMarshalEvent
+	}
+
+	return data, nil
+}
+
+// unmarshalEvent unmarshals an event and the context with the codec, with
+// concrete event data if the event type is registered.
+func (b *EventBus) unmarshalEvent(data []byte) (context.Context, eh.Event, error) {
+	ctx, event, err := b.codec.UnmarshalEvent(data)
+	if err != nil {
+		return nil, nil, ErrCouldNotUnmarshalEvent
+	}
+
+	return ctx, event, nil
+}
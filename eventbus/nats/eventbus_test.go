@@ -0,0 +1,346 @@
+// Copyright (c) 2016 - Max Ekman <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package nats
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/nats-io/nats-server/v2/server"
+	"github.com/nats-io/nats.go"
+
+	eh "github.com/looplab/eventhorizon"
+	"github.com/looplab/eventhorizon/eventbus/testutil"
+	"github.com/looplab/eventhorizon/eventstore/codec"
+	"github.com/looplab/eventhorizon/mocks"
+)
+
+func TestEventBus(t *testing.T) {
+	url, shutdown := runServer(t)
+	defer shutdown()
+
+	bus, err := NewEventBus("test", url)
+	if err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	if bus == nil {
+		t.Fatal("there should be a bus")
+	}
+	defer bus.Close()
+
+	// Another bus to test the observer.
+	bus2, err := NewEventBus("test", url)
+	if err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	defer bus2.Close()
+
+	testutil.EventBusCommonTests(t, bus, bus2)
+}
+
+func TestEventBusAsync(t *testing.T) {
+	url, shutdown := runServer(t)
+	defer shutdown()
+
+	bus, err := NewEventBus("test", url)
+	if err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	if bus == nil {
+		t.Fatal("there should be a bus")
+	}
+	defer bus.Close()
+	bus.SetHandlingStrategy(eh.AsyncEventHandlingStrategy)
+
+	// Another bus to test the observer.
+	bus2, err := NewEventBus("test", url)
+	if err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	defer bus2.Close()
+	bus2.SetHandlingStrategy(eh.AsyncEventHandlingStrategy)
+
+	testutil.EventBusCommonTests(t, bus, bus2)
+}
+
+func TestEventBusWithCodec(t *testing.T) {
+	url, shutdown := runServer(t)
+	defer shutdown()
+
+	newBus := func() *EventBus {
+		conn, err := nats.Connect(url)
+		if err != nil {
+			t.Fatal("there should be no error:", err)
+		}
+		bus, err := NewEventBusWithConn("test", conn, WithCodec(codec.BSONEventCodec{}))
+		if err != nil {
+			t.Fatal("there should be no error:", err)
+		}
+		return bus
+	}
+	bus := newBus()
+	defer bus.Close()
+
+	// Another bus to test the observer.
+	bus2 := newBus()
+	defer bus2.Close()
+
+	testutil.EventBusCommonTests(t, bus, bus2)
+}
+
+func TestEventBusDurable(t *testing.T) {
+	url, shutdown := runServer(t)
+	defer shutdown()
+
+	bus, err := NewEventBus("test", url)
+	if err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	handler := mocks.NewEventHandler("durableHandler")
+	bus.AddHandler(handler, mocks.EventType)
+
+	t.Log("publish event to a handler from another bus")
+	publisher, err := NewEventBus("test", url)
+	if err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	defer publisher.Close()
+	id := eh.NewUUID()
+	agg := mocks.NewAggregate(id)
+	event1 := agg.NewEvent(mocks.EventType, &mocks.EventData{"event1"})
+	agg.ApplyEvent(context.Background(), event1)
+	publisher.PublishEvent(context.Background(), event1)
+	handler.WaitForEvent(t)
+	if len(handler.Events) != 1 {
+		t.Fatal("there should be one event:", handler.Events)
+	}
+	if err := mocks.CompareEvents(handler.Events[0], event1); err != nil {
+		t.Error("the event was incorrect:", err)
+	}
+	if handler.Events[0].AggregateID() != id || handler.Events[0].Version() != 1 {
+		t.Error("the event aggregate ID and version should be correct:", handler.Events[0])
+	}
+
+	t.Log("receive events published while the handler was gone")
+	if err := bus.Close(); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	event2 := agg.NewEvent(mocks.EventType, &mocks.EventData{"event2"})
+	agg.ApplyEvent(context.Background(), event2)
+	publisher.PublishEvent(context.Background(), event2)
+
+	bus, err = NewEventBus("test", url)
+	if err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	defer bus.Close()
+	handler = mocks.NewEventHandler("durableHandler")
+	bus.AddHandler(handler, mocks.EventType)
+	handler.WaitForEvent(t)
+	if len(handler.Events) != 1 {
+		t.Fatal("there should be one event:", handler.Events)
+	}
+	if err := mocks.CompareEvents(handler.Events[0], event2); err != nil {
+		t.Error("the event was incorrect:", err)
+	}
+	if handler.Events[0].AggregateID() != id || handler.Events[0].Version() != 2 {
+		t.Error("the event aggregate ID and version should be correct:", handler.Events[0])
+	}
+}
+
+func TestEventBusCheckpoint(t *testing.T) {
+	url, shutdown := runServer(t)
+	defer shutdown()
+
+	testutil.EventBusCheckpointCommonTests(t, context.Background(), func(store eh.CheckpointStore) (eh.EventBus, func()) {
+		conn, err := nats.Connect(url)
+		if err != nil {
+			t.Fatal("there should be no error:", err)
+		}
+		bus, err := NewEventBusWithConn("test", conn, WithCheckpointStore(store))
+		if err != nil {
+			t.Fatal("there should be no error:", err)
+		}
+		return bus, func() { bus.Close() }
+	})
+}
+
+func TestEventBusSubscribeFromInvalidPosition(t *testing.T) {
+	url, shutdown := runServer(t)
+	defer shutdown()
+
+	bus, err := NewEventBus("test", url)
+	if err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	defer bus.Close()
+
+	handler := mocks.NewEventHandler("positionHandler")
+	if err := bus.SubscribeFrom(context.Background(), "invalid", eh.MatchAny(), handler); err != eh.ErrInvalidPosition {
+		t.Error("there should be a ErrInvalidPosition error:", err)
+	}
+}
+
+func TestNewEventBusWithOptions(t *testing.T) {
+	url, shutdown := runServer(t)
+	defer shutdown()
+
+	bus, err := NewEventBus("test", url,
+		WithCodec(codec.BSONEventCodec{}),
+		WithNATSOptions(nats.Name("test")),
+	)
+	if err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	defer bus.Close()
+	if _, ok := bus.codec.(codec.BSONEventCodec); !ok {
+		t.Error("the codec should be set:", bus.codec)
+	}
+}
+
+func TestEventBusSubscribeError(t *testing.T) {
+	url, shutdown := runServer(t)
+	defer shutdown()
+
+	bus, err := NewEventBus("test", url)
+	if err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+
+	// Durable names can't contain dots.
+	bus.AddHandler(mocks.NewEventHandler("invalid.handler"), mocks.EventType)
+	if err := bus.HealthCheck(context.Background()); err == nil {
+		t.Error("there should be an error")
+	}
+	if err := bus.Close(); err == nil {
+		t.Error("there should be an error")
+	}
+}
+
+func TestEventBusEventDataVersions(t *testing.T) {
+	eh.RegisterEventData(versionedEventType, func() eh.EventData {
+		return &versionedEventData{}
+	})
+	eh.RegisterVersionedEventData(versionedEventType, 2, func() eh.EventData {
+		return &versionedEventDataV2{}
+	})
+	eh.RegisterUpcaster(versionedEventType, 1, func(data eh.EventData) (eh.EventData, error) {
+		d := data.(*versionedEventData)
+		return &versionedEventDataV2{Content: d.Content, Count: 1}, nil
+	})
+	eh.RegisterDowncaster(versionedEventType, 2, func(data eh.EventData) (eh.EventData, error) {
+		d := data.(*versionedEventDataV2)
+		return &versionedEventData{Content: d.Content}, nil
+	})
+	defer eh.SetEventDataPublishVersion(versionedEventType, 0)
+
+	ctx := context.Background()
+	b := &EventBus{codec: codec.JSONEventCodec{}}
+	agg := mocks.NewAggregate(eh.NewUUID())
+	event := agg.NewEvent(versionedEventType, &versionedEventDataV2{"event", 2})
+
+	t.Log("downcast a v2 event to v1 for an old consumer")
+	eh.SetEventDataPublishVersion(versionedEventType, 1)
+	data, err := b.marshalEvent(ctx, event)
+	if err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	var oldEvent struct {
+		RawData  json.RawMessage        `json:"data"`
+		Metadata map[string]interface{} `json:"metadata"`
+	}
+	if err := json.Unmarshal(data, &oldEvent); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	var oldData map[string]interface{}
+	if err := json.Unmarshal(oldEvent.RawData, &oldData); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	if !reflect.DeepEqual(oldData, map[string]interface{}{"Content": "event"}) {
+		t.Error("the event data should be version 1:", oldData)
+	}
+	if oldEvent.Metadata[eh.EventDataVersionKey] != float64(1) {
+		t.Error("the data version should be 1:", oldEvent.Metadata)
+	}
+
+	t.Log("upcast a v1 event on a new consumer")
+	_, received, err := b.unmarshalEvent(data)
+	if err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	if !reflect.DeepEqual(received.Data(), &versionedEventDataV2{"event", 1}) {
+		t.Error("the event data should be upcasted:", received.Data())
+	}
+	if received.Metadata() != nil {
+		t.Error("the data version should not be in the metadata:", received.Metadata())
+	}
+
+	t.Log("receive a v2 event on a new consumer")
+	eh.SetEventDataPublishVersion(versionedEventType, 0)
+	if data, err = b.marshalEvent(ctx, event); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	if _, received, err = b.unmarshalEvent(data); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	if err := mocks.CompareEvents(received, event); err != nil {
+		t.Error("the event was incorrect:", err)
+	}
+}
+
+const versionedEventType eh.EventType = "VersionedEvent"
+
+type versionedEventData struct {
+	Content string
+}
+
+type versionedEventDataV2 struct {
+	Content string
+	Count   int
+}
+
+// runServer runs an embedded NATS server with JetStream enabled.
+func runServer(t *testing.T) (string, func()) {
+	dir, err := ioutil.TempDir("", "eventhorizon-nats")
+	if err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+
+	s, err := server.NewServer(&server.Options{
+		Host:      "127.0.0.1",
+		Port:      -1, // Random port.
+		JetStream: true,
+		StoreDir:  dir,
+		NoLog:     true,
+		NoSigs:    true,
+	})
+	if err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	go s.Start()
+	if !s.ReadyForConnections(5 * time.Second) {
+		t.Fatal("the server should be ready")
+	}
+
+	return s.ClientURL(), func() {
+		s.Shutdown()
+		os.RemoveAll(dir)
+	}
+}
@@ -17,7 +17,6 @@ package redis
 import (
 	"context"
 	"errors"
-	"fmt"
 	"log"
 	"strings"
 	"sync"
@@ -25,12 +24,12 @@ import (
 
 	"github.com/garyburd/redigo/redis"
 	"github.com/jpillora/backoff"
-	"gopkg.in/mgo.v2/bson"
 
 	eh "github.com/looplab/eventhorizon"
+	"github.com/looplab/eventhorizon/eventstore/codec"
 )
 
-// ErrCouldNotMarshalEvent is when an event could not be marshaled into BSON.
+// ErrCouldNotMarshalEvent is when an event could not be marshaled with the codec.
 var ErrCouldNotMarshalEvent = errors.New("could not marshal event")
 
 // ErrCouldNotUnmarshalEvent is when an event could not be unmarshaled into a concrete type.
@@ -53,13 +52,25 @@ type EventBus struct {
 
 	prefix string
 	pool   *redis.Pool
+	codec  eh.EventCodec
 	conn   *redis.PubSubConn
 	ready  chan bool // NOTE: Used for testing only
 	exit   chan bool
 }
 
+// Option is an option setter used to configure creation.
+type Option func(*EventBus)
+
+// WithCodec uses a codec to marshal the events, instead of the default
+// codec.BSONEventCodec. All buses with the same app ID must use the same codec.
+func WithCodec(c eh.EventCodec) Option {
+	return func(b *EventBus) {
+		b.codec = c
+	}
+}
+
 // NewEventBus creates a EventBus for remote events.
-func NewEventBus(appID, server, password string) (*EventBus, error) {
+func NewEventBus(appID, server, password string, opts ...Option) (*EventBus, error) {
 	pool := &redis.Pool{
 		MaxIdle:     3,
 		IdleTimeout: 240 * time.Second,
@@ -82,20 +93,25 @@ func NewEventBus(appID, server, password string) (*EventBus, error) {
 		},
 	}
 
-	return NewEventBusWithPool(appID, pool)
+	return NewEventBusWithPool(appID, pool, opts...)
 }
 
 // NewEventBusWithPool creates a EventBus for remote events.
-func NewEventBusWithPool(appID string, pool *redis.Pool) (*EventBus, error) {
+func NewEventBusWithPool(appID string, pool *redis.Pool, opts ...Option) (*EventBus, error) {
 	b := &EventBus{
 		handlers:  make(map[eh.EventType]map[eh.EventHandler]bool),
 		observers: make(map[eh.EventObserver]bool),
 		prefix:    appID + ":events:",
 		pool:      pool,
+		codec:     codec.BSONEventCodec{},
 		ready:     make(chan bool, 1), // Buffered to not block receive loop.
 		exit:      make(chan bool),
 	}
 
+	for _, opt := range opts {
+		opt(b)
+	}
+
 	go func() {
 		log.Println("eventbus: start receiving")
 		defer log.Println("eventbus: stop receiving")
@@ -127,7 +143,7 @@ func (b *EventBus) SetHandlingStrategy(strategy eh.EventHandlingStrategy) {
 }
 
 // PublishEvent publishes an event to all handlers capable of handling it.
-func (b *EventBus) PublishEvent(ctx context.Context, event eh.Event) {
+func (b *EventBus) PublishEvent(ctx context.Context, event eh.Event) error {
 	b.handlerMu.RLock()
 	defer b.handlerMu.RUnlock()
 
@@ -135,17 +151,15 @@ func (b *EventBus) PublishEvent(ctx context.Context, event eh.Event) {
 	if handlers, ok := b.handlers[event.EventType()]; ok {
 		for h := range handlers {
 			if b.handlingStrategy == eh.AsyncEventHandlingStrategy {
-				go h.HandleEvent(ctx, event)
+				go handleEvent(ctx, h, event)
 			} else {
-				h.HandleEvent(ctx, event)
+				handleEvent(ctx, h, event)
 			}
 		}
 	}
 
 	// Notify all observers about the event.
-	if err := b.notify(ctx, event); err != nil {
-		log.Println("error: event bus publish:", err)
-	}
+	return b.notify(ctx, event)
 }
 
 // AddHandler implements the AddHandler method of the eventhorizon.EventBus interface.
@@ -181,6 +195,14 @@ func (b *EventBus) Close() error {
 	return b.pool.Close()
 }
 
+// handleEvent handles an event and logs any error, the handlers of other types
+// still handle the event.
+func handleEvent(ctx context.Context, h eh.EventHandler, event eh.Event) {
+	if err := h.HandleEvent(ctx, event); err != nil {
+		log.Printf("error: event bus handler %s: %s", h.HandlerType(), err)
+	}
+}
+
 func (b *EventBus) notify(ctx context.Context, event eh.Event) error {
 	conn := b.pool.Get()
 	defer conn.Close()
@@ -189,29 +211,8 @@ func (b *EventBus) notify(ctx context.Context, event eh.Event) error {
 		return err
 	}
 
-	// Create the Redis event.
-	redisEvent := redisEvent{
-		AggregateID:   event.AggregateID(),
-		AggregateType: event.AggregateType(),
-		EventType:     event.EventType(),
-		Version:       event.Version(),
-		Timestamp:     event.Timestamp(),
-		Context:       eh.MarshalContext(ctx),
-	}
-
-	// Marshal event data if there is any.
-	if event.Data() != nil {
-		rawData, err := bson.Marshal(event.Data())
-		if err != nil {
-			return ErrCouldNotMarshalEvent
-		}
-		redisEvent.RawData = bson.Raw{Kind: 3, Data: rawData}
-	}
-
-	// Marshal the Redis event (using BSON for now).
-	var data []byte
-	var err error
-	if data, err = bson.Marshal(redisEvent); err != nil {
+	data, err := b.codec.MarshalEvent(ctx, event)
+	if err != nil {
 		return ErrCouldNotMarshalEvent
 	}
 
@@ -246,40 +247,19 @@ func (b *EventBus) recv(delay *backoff.Backoff) error {
 	for {
 		switch v := pubSubConn.Receive().(type) {
 		case redis.PMessage:
-			// Manually decode the raw BSON event.
-			data := bson.Raw{
-				Kind: 3,
-				Data: v.Data,
-			}
-			var redisEvent redisEvent
-			if err := data.Unmarshal(&redisEvent); err != nil {
+			ctx, event, err := b.codec.UnmarshalEvent(v.Data)
+			if err != nil {
 				log.Println("error: event bus receive:", ErrCouldNotUnmarshalEvent)
 				continue
 			}
 
 			// Extract the event type from the channel name.
 			eventType := eh.EventType(strings.TrimPrefix(v.Channel, b.prefix))
-			if redisEvent.EventType != eventType {
+			if event.EventType() != eventType {
 				log.Println("error: event bus receive: event type mismatch")
 				continue
 			}
 
-			// Create an event of the correct type.
-			if data, err := eh.CreateEventData(redisEvent.EventType); err == nil {
-				// Manually decode the raw BSON event.
-				if err := redisEvent.RawData.Unmarshal(data); err != nil {
-					log.Println("error: event bus receive:", ErrCouldNotUnmarshalEvent)
-					continue
-				}
-
-				// Set concrete event and zero out the decoded event.
-				redisEvent.data = data
-				redisEvent.RawData = bson.Raw{}
-			}
-
-			event := event{redisEvent: redisEvent}
-			ctx := eh.UnmarshalContext(redisEvent.Context)
-
 			b.handlerMu.RLock()
 			for o := range b.observers {
 				if b.handlingStrategy == eh.AsyncEventHandlingStrategy {
@@ -312,56 +292,3 @@ func (b *EventBus) recv(delay *backoff.Backoff) error {
 		}
 	}
 }
-
-// redisEvent is the internal event used with the Redis event bus.
-type redisEvent struct {
-	EventType     eh.EventType           `bson:"event_type"`
-	RawData       bson.Raw               `bson:"data,omitempty"`
-	data          eh.EventData           `bson:"-"`
-	Timestamp     time.Time              `bson:"timestamp"`
-	AggregateType eh.AggregateType       `bson:"aggregate_type"`
-	AggregateID   eh.UUID                `bson:"_id"`
-	Version       int                    `bson:"version"`
-	Context       map[string]interface{} `bson:"context"`
-}
-
-// event is the private implementation of the eventhorizon.Event interface
-// for a MongoDB event store.
-type event struct {
-	redisEvent
-}
-
-// EventType implements the EventType method of the eventhorizon.Event interface.
-func (e event) EventType() eh.EventType {
-	return e.redisEvent.EventType
-}
-
-// Data implements the Data method of the eventhorizon.Event interface.
-func (e event) Data() eh.EventData {
-	return e.redisEvent.data
-}
-
-// Timestamp implements the Timestamp method of the eventhorizon.Event interface.
-func (e event) Timestamp() time.Time {
-	return e.redisEvent.Timestamp
-}
-
-// AggregateType implements the AggregateType method of the eventhorizon.Event interface.
-func (e event) AggregateType() eh.AggregateType {
-	return e.redisEvent.AggregateType
-}
-
-// AggrgateID implements the AggrgateID method of the eventhorizon.Event interface.
-func (e event) AggregateID() eh.UUID {
-	return e.redisEvent.AggregateID
-}
-
-// Version implements the Version method of the eventhorizon.Event interface.
-func (e event) Version() int {
-	return e.redisEvent.Version
-}
-
-// String implements the String method of the eventhorizon.Event interface.
-func (e event) String() string {
-	return fmt.Sprintf("%s@%d", e.redisEvent.EventType, e.redisEvent.Version)
-}
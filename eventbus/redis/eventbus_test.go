@@ -20,6 +20,7 @@ import (
 
 	eh "github.com/looplab/eventhorizon"
 	"github.com/looplab/eventhorizon/eventbus/testutil"
+	"github.com/looplab/eventhorizon/eventstore/codec"
 )
 
 func TestEventBus(t *testing.T) {
@@ -89,3 +90,33 @@ func TestEventBusAsync(t *testing.T) {
 
 	testutil.EventBusCommonTests(t, bus, bus2)
 }
+
+func TestEventBusWithCodec(t *testing.T) {
+	// Support Wercker testing with MongoDB.
+	host := os.Getenv("REDIS_PORT_6379_TCP_ADDR")
+	port := os.Getenv("REDIS_PORT_6379_TCP_PORT")
+
+	url := ":6379"
+	if host != "" && port != "" {
+		url = host + ":" + port
+	}
+
+	bus, err := NewEventBus("test", url, "", WithCodec(codec.JSONEventCodec{}))
+	if err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	defer bus.Close()
+
+	// Another bus to test the observer.
+	bus2, err := NewEventBus("test", url, "", WithCodec(codec.JSONEventCodec{}))
+	if err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	defer bus2.Close()
+
+	// Wait for subscriptions to be ready.
+	<-bus.ready
+	<-bus2.ready
+
+	testutil.EventBusCommonTests(t, bus, bus2)
+}
@@ -16,9 +16,12 @@ package testutil
 
 import (
 	"context"
+	"errors"
 	"testing"
+	"time"
 
 	eh "github.com/looplab/eventhorizon"
+	"github.com/looplab/eventhorizon/eventbus/checkpoint"
 	"github.com/looplab/eventhorizon/mocks"
 )
 
@@ -36,7 +39,9 @@ func EventBusCommonTests(t *testing.T, bus1, bus2 eh.EventBus) {
 	t.Log("publish event without handler")
 	id, _ := eh.ParseUUID("c1138e5f-f6fb-4dd0-8e79-255c6c8d3756")
 	agg := mocks.NewAggregate(id)
-	event1 := agg.NewEvent(mocks.EventType, &mocks.EventData{"event1"})
+	event1 := agg.NewEvent(mocks.EventType, &mocks.EventData{"event1"},
+		eh.WithMetadata(map[string]interface{}{"correlation_id": "correlation1"}),
+	)
 	bus1.PublishEvent(ctx, event1)
 	expectedEvents := []eh.Event{event1}
 	observer1.WaitForEvent(t)
@@ -126,3 +131,240 @@ func EventBusCommonTests(t *testing.T, bus1, bus2 eh.EventBus) {
 		t.Error("the context should be correct:", observer2.Context)
 	}
 }
+
+// EventBusHandlerErrorCommonTests are test cases that are common to all
+// implementations of event busses, checking that a failing handler does not
+// stop other handlers from handling the event. It should be run with a new
+// bus, as the handlers can not be removed.
+func EventBusHandlerErrorCommonTests(t *testing.T, ctx context.Context, bus eh.EventBus) {
+	failing := newRecordingHandler("failingHandler", errors.New("handler error"))
+	bus.AddHandler(failing, mocks.EventType)
+	handler := newRecordingHandler("otherHandler", nil)
+	bus.AddHandler(handler, mocks.EventType)
+
+	t.Log("publish event to a failing and a succeeding handler")
+	agg := mocks.NewAggregate(eh.NewUUID())
+	event1 := agg.NewEvent(mocks.EventType, &mocks.EventData{"event1"})
+	if err := bus.PublishEvent(ctx, event1); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if event, ok := failing.wait(); !ok {
+		t.Error("the failing handler should receive the event")
+	} else if err := mocks.CompareEvents(event, event1); err != nil {
+		t.Error("the event was incorrect:", err)
+	}
+	if event, ok := handler.wait(); !ok {
+		t.Error("the other handler should receive the event")
+	} else if err := mocks.CompareEvents(event, event1); err != nil {
+		t.Error("the event was incorrect:", err)
+	}
+
+	t.Log("publish another event after the handler failed")
+	event2 := agg.NewEvent(mocks.EventType, &mocks.EventData{"event2"})
+	if err := bus.PublishEvent(ctx, event2); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	for {
+		event, ok := handler.wait()
+		if !ok {
+			t.Fatal("the other handler should receive the event")
+		}
+		// Skip redelivered events, for buses that retry failed events.
+		if event.Version() == event2.Version() {
+			if err := mocks.CompareEvents(event, event2); err != nil {
+				t.Error("the event was incorrect:", err)
+			}
+			break
+		}
+	}
+}
+
+// EventBusOrderingCommonTests are test cases that are common to all
+// implementations of event busses that handle the events of an aggregate in
+// the order they were published. It should be run with a new bus, as the
+// handlers can not be removed.
+func EventBusOrderingCommonTests(t *testing.T, ctx context.Context, bus eh.EventBus) {
+	handler := newRecordingHandler("orderedHandler", nil)
+	bus.AddHandler(handler, mocks.EventType)
+
+	t.Log("publish events for two aggregates, interleaved")
+	agg1 := mocks.NewAggregate(eh.NewUUID())
+	agg2 := mocks.NewAggregate(eh.NewUUID())
+	const numEvents = 20
+	for i := 0; i < numEvents; i++ {
+		for _, agg := range []*mocks.Aggregate{agg1, agg2} {
+			event := agg.NewEvent(mocks.EventType, &mocks.EventData{"event"})
+			agg.ApplyEvent(ctx, event) // Apply event to increment the aggregate version.
+			if err := bus.PublishEvent(ctx, event); err != nil {
+				t.Error("there should be no error:", err)
+			}
+		}
+	}
+
+	versions := map[eh.UUID]int{}
+	for i := 0; i < 2*numEvents; i++ {
+		event, ok := handler.wait()
+		if !ok {
+			t.Fatal("all events should be handled:", versions)
+		}
+		if event.Version() != versions[event.AggregateID()]+1 {
+			t.Error("the events of an aggregate should be handled in order:", event.AggregateID(), event.Version())
+		}
+		versions[event.AggregateID()] = event.Version()
+	}
+}
+
+// EventBusCheckpointCommonTests are test cases that are common to all
+// implementations of event busses that can subscribe from a position, checking
+// that a restarted consumer resumes after its committed position. The buses
+// are created with newBus using the checkpoint store, and closed with the
+// returned func.
+func EventBusCheckpointCommonTests(t *testing.T, ctx context.Context, newBus func(eh.CheckpointStore) (eh.EventBus, func())) {
+	store := checkpoint.NewMemoryStore()
+	bus1, closeBus1 := newBus(store)
+	subscriber, ok := bus1.(eh.EventSubscriber)
+	if !ok {
+		t.Fatal("the bus should be an event subscriber")
+	}
+
+	t.Log("publish events")
+	agg := mocks.NewAggregate(eh.NewUUID())
+	var events []eh.Event
+	for _, content := range []string{"event1", "event2", "event3"} {
+		event := agg.NewEvent(mocks.EventType, &mocks.EventData{content})
+		agg.ApplyEvent(ctx, event) // Apply event to increment the aggregate version.
+		if err := bus1.PublishEvent(ctx, event); err != nil {
+			t.Error("there should be no error:", err)
+		}
+		events = append(events, event)
+	}
+
+	// Only match the events of this test, the bus might have older events.
+	matcher := func(e eh.Event) bool {
+		return e.AggregateID() == agg.AggregateID()
+	}
+
+	t.Log("subscribe a consumer that fails to handle the last event")
+	handler1 := &failingVersionHandler{
+		recordingHandler: newRecordingHandler("checkpointHandler", nil),
+		version:          3,
+	}
+	if err := subscriber.SubscribeFrom(ctx, "", matcher, handler1); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	for i, expected := range events {
+		event, ok := handler1.wait()
+		if !ok {
+			t.Fatal("the consumer should handle the event:", expected)
+		}
+		if err := mocks.CompareEvents(event, expected); err != nil {
+			t.Error("the event was incorrect:", i, err)
+		}
+	}
+
+	t.Log("restart the consumer after it failed")
+	closeBus1()
+	position, err := store.LoadCheckpoint(ctx, "checkpointHandler")
+	if err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if position == "" {
+		t.Error("the position of the handled events should be committed")
+	}
+	bus2, closeBus2 := newBus(store)
+	defer closeBus2()
+	handler2 := newRecordingHandler("checkpointHandler", nil)
+	if err := bus2.(eh.EventSubscriber).SubscribeFrom(ctx, "", matcher, handler2); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	event4 := agg.NewEvent(mocks.EventType, &mocks.EventData{"event4"})
+	agg.ApplyEvent(ctx, event4) // Apply event to increment the aggregate version.
+	if err := bus2.PublishEvent(ctx, event4); err != nil {
+		t.Error("there should be no error:", err)
+	}
+
+	t.Log("the uncommitted event and new events should be handled once")
+	for _, expected := range []eh.Event{events[2], event4} {
+		event, ok := handler2.wait()
+		if !ok {
+			t.Fatal("the consumer should handle the event:", expected)
+		}
+		if err := mocks.CompareEvents(event, expected); err != nil {
+			t.Error("the event was incorrect:", err)
+		}
+		if event.Version() != expected.Version() {
+			t.Error("the committed events should not be handled again:", event.Version())
+		}
+	}
+	if event, ok := handler2.wait(); ok {
+		t.Error("there should be no more events:", event)
+	}
+
+	t.Log("subscribe a consumer without a matcher")
+	handler3 := newRecordingHandler("nilMatcherHandler", nil)
+	if err := bus2.(eh.EventSubscriber).SubscribeFrom(ctx, "", nil, handler3); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	for {
+		event, ok := handler3.wait()
+		if !ok {
+			t.Fatal("the consumer should handle all events:", event4)
+		}
+		if event.AggregateID() == agg.AggregateID() && event.Version() == event4.Version() {
+			break
+		}
+	}
+}
+
+// recordingHandler is a handler that sends the handled events on a channel, to
+// wait for them without depending on timing.
+type recordingHandler struct {
+	handlerType eh.EventHandlerType
+	err         error
+	events      chan eh.Event
+}
+
+func newRecordingHandler(handlerType eh.EventHandlerType, err error) *recordingHandler {
+	return &recordingHandler{
+		handlerType: handlerType,
+		err:         err,
+		events:      make(chan eh.Event, 100),
+	}
+}
+
+// HandlerType implements the HandlerType method of the eventhorizon.EventHandler interface.
+func (h *recordingHandler) HandlerType() eh.EventHandlerType {
+	return h.handlerType
+}
+
+// HandleEvent implements the HandleEvent method of the eventhorizon.EventHandler interface.
+func (h *recordingHandler) HandleEvent(ctx context.Context, event eh.Event) error {
+	h.events <- event
+	return h.err
+}
+
+// wait waits for the next handled event, returning false after a timeout.
+func (h *recordingHandler) wait() (eh.Event, bool) {
+	select {
+	case event := <-h.events:
+		return event, true
+	case <-time.After(time.Second):
+		return nil, false
+	}
+}
+
+// failingVersionHandler is a recording handler that fails to handle the events
+// with a version.
+type failingVersionHandler struct {
+	*recordingHandler
+	version int
+}
+
+// HandleEvent implements the HandleEvent method of the eventhorizon.EventHandler interface.
+func (h *failingVersionHandler) HandleEvent(ctx context.Context, event eh.Event) error {
+	h.events <- event
+	if event.Version() == h.version {
+		return errors.New("handler error")
+	}
+	return nil
+}
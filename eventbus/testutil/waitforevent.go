@@ -0,0 +1,128 @@
+// Copyright (c) 2016 - Max Ekman <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package testutil
+
+import (
+	"context"
+	"sync"
+
+	eh "github.com/looplab/eventhorizon"
+)
+
+// waitObservers are the observers added to buses by WaitForEvent, one per bus
+// as observers can not be removed from a bus.
+var waitObservers = make(map[eh.EventBus]*waitObserver)
+var waitObserversMu sync.Mutex
+
+// WaitForEvent waits for an event published on the bus that the matcher
+// matches, or until the context is done. It is safe to use concurrently, for
+// example to wait for events handled asynchronously. Only events published
+// after the call are matched, so it should be started before publishing.
+//
+// An example would be:
+//
+//	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+//	defer cancel()
+//	event, err := testutil.WaitForEvent(ctx, bus, eh.MatchEvent(InviteAcceptedEvent))
+func WaitForEvent(ctx context.Context, bus eh.EventBus, matcher eh.EventMatcher) (eh.Event, error) {
+	if matcher == nil {
+		matcher = eh.MatchAny()
+	}
+
+	w := &waiter{
+		matcher: matcher,
+		events:  make(chan eh.Event, 1),
+	}
+	o := waitObserverFor(bus)
+	o.add(w)
+	defer o.remove(w)
+
+	select {
+	case event := <-w.events:
+		return event, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// waitObserverFor returns the observer for a bus, adding it to the bus the
+// first time.
+func waitObserverFor(bus eh.EventBus) *waitObserver {
+	waitObserversMu.Lock()
+	defer waitObserversMu.Unlock()
+
+	if o, ok := waitObservers[bus]; ok {
+		return o
+	}
+
+	o := &waitObserver{
+		waiters: make(map[*waiter]bool),
+	}
+	waitObservers[bus] = o
+	bus.AddObserver(o)
+	return o
+}
+
+// waitObserver is an observer that notifies the current waiters of a bus.
+type waitObserver struct {
+	waiters map[*waiter]bool
+	mu      sync.RWMutex
+}
+
+// Notify implements the Notify method of the eventhorizon.EventObserver interface.
+func (o *waitObserver) Notify(ctx context.Context, event eh.Event) {
+	o.mu.RLock()
+	defer o.mu.RUnlock()
+
+	for w := range o.waiters {
+		if !w.matcher(event) {
+			continue
+		}
+
+		// Only the first matching event is used by a waiter.
+		select {
+		case w.events <- event:
+		default:
+		}
+	}
+}
+
+func (o *waitObserver) add(w *waiter) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	o.waiters[w] = true
+}
+
+func (o *waitObserver) remove(w *waiter) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	delete(o.waiters, w)
+}
+
+// numWaiters returns the number of current waiters, used in testing.
+func (o *waitObserver) numWaiters() int {
+	o.mu.RLock()
+	defer o.mu.RUnlock()
+
+	return len(o.waiters)
+}
+
+// waiter is a call to WaitForEvent waiting for a matching event.
+type waiter struct {
+	matcher eh.EventMatcher
+	events  chan eh.Event
+}
@@ -0,0 +1,119 @@
+// Copyright (c) 2016 - Max Ekman <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package testutil
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	eh "github.com/looplab/eventhorizon"
+	"github.com/looplab/eventhorizon/eventbus/local"
+	"github.com/looplab/eventhorizon/mocks"
+)
+
+func TestWaitForEvent(t *testing.T) {
+	bus := local.NewEventBus()
+	bus.SetHandlingStrategy(eh.AsyncEventHandlingStrategy)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	agg := mocks.NewAggregate(eh.NewUUID())
+	event1 := agg.NewEvent(mocks.EventType, &mocks.EventData{"event1"})
+	event2 := agg.NewEvent(mocks.EventOtherType, &mocks.EventData{"event2"})
+	go func() {
+		waitForWaiters(t, bus, 1)
+		bus.PublishEvent(context.Background(), event1)
+		bus.PublishEvent(context.Background(), event2)
+	}()
+
+	event, err := WaitForEvent(ctx, bus, eh.MatchEvent(mocks.EventOtherType))
+	if err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	if event != event2 {
+		t.Error("the event should be correct:", event)
+	}
+	if n := waitObserverFor(bus).numWaiters(); n != 0 {
+		t.Error("the waiter should be removed:", n)
+	}
+}
+
+func TestWaitForEventTimeout(t *testing.T) {
+	bus := local.NewEventBus()
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	agg := mocks.NewAggregate(eh.NewUUID())
+	event1 := agg.NewEvent(mocks.EventType, &mocks.EventData{"event1"})
+	go func() {
+		waitForWaiters(t, bus, 1)
+		bus.PublishEvent(context.Background(), event1)
+	}()
+
+	event, err := WaitForEvent(ctx, bus, eh.MatchEvent(mocks.EventOtherType))
+	if err != context.DeadlineExceeded {
+		t.Error("there should be a context.DeadlineExceeded error:", err)
+	}
+	if event != nil {
+		t.Error("there should be no event:", event)
+	}
+	if n := waitObserverFor(bus).numWaiters(); n != 0 {
+		t.Error("the waiter should be removed:", n)
+	}
+}
+
+func TestWaitForEventConcurrent(t *testing.T) {
+	bus := local.NewEventBus()
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	var wg sync.WaitGroup
+	events := make([]eh.Event, 5)
+	for i := range events {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			event, err := WaitForEvent(ctx, bus, nil)
+			if err != nil {
+				t.Error("there should be no error:", err)
+			}
+			events[i] = event
+		}(i)
+	}
+
+	agg := mocks.NewAggregate(eh.NewUUID())
+	event1 := agg.NewEvent(mocks.EventType, &mocks.EventData{"event1"})
+	waitForWaiters(t, bus, len(events))
+	bus.PublishEvent(context.Background(), event1)
+	wg.Wait()
+	for _, event := range events {
+		if event != event1 {
+			t.Error("the event should be correct:", event)
+		}
+	}
+}
+
+// waitForWaiters waits until there are a number of waiters for the bus.
+func waitForWaiters(t *testing.T, bus eh.EventBus, n int) {
+	for i := 0; i < 100; i++ {
+		if waitObserverFor(bus).numWaiters() == n {
+			return
+		}
+		time.Sleep(time.Millisecond)
+	}
+	t.Error("there should be waiters:", n)
+}
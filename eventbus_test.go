@@ -0,0 +1,49 @@
+// Copyright (c) 2016 - Max Ekman <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package eventhorizon
+
+import (
+	"testing"
+)
+
+func TestMatchAny(t *testing.T) {
+	m := MatchAny()
+	if !m(NewEvent(TestEventType, nil)) {
+		t.Error("the event should match")
+	}
+	if !m(NewEvent(TestEvent2Type, nil)) {
+		t.Error("the other event should match")
+	}
+}
+
+func TestMatchEvent(t *testing.T) {
+	m := MatchEvent(TestEventType)
+	if !m(NewEvent(TestEventType, nil)) {
+		t.Error("the event should match")
+	}
+	if m(NewEvent(TestEvent2Type, nil)) {
+		t.Error("the other event should not match")
+	}
+
+	m = MatchEvent(TestEventType, TestEvent2Type)
+	if !m(NewEvent(TestEventType, nil)) || !m(NewEvent(TestEvent2Type, nil)) {
+		t.Error("both events should match")
+	}
+
+	m = MatchEvent()
+	if m(NewEvent(TestEventType, nil)) {
+		t.Error("no event should match")
+	}
+}
@@ -0,0 +1,196 @@
+// Copyright (c) 2016 - Max Ekman <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package batch
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	eh "github.com/looplab/eventhorizon"
+)
+
+// ErrHandlerClosed is when an event is handled after the handler was closed.
+var ErrHandlerClosed = errors.New("batch handler closed")
+
+// BatchEventHandler is an event handler that can handle several events at
+// once, for example a projector that saves its read models once per batch.
+type BatchEventHandler interface {
+	eh.EventHandler
+
+	// HandleEvents handles a batch of events, in the order they were received.
+	HandleEvents(context.Context, []eh.Event) error
+}
+
+// Option is an option setter used to configure the middleware.
+type Option func(*EventHandler)
+
+// WithLogger logs the errors of the batches flushed by the interval with a
+// logger.
+func WithLogger(logger eh.Logger) Option {
+	return func(h *EventHandler) {
+		if logger == nil {
+			logger = eh.NopLogger{}
+		}
+		h.logger = logger
+	}
+}
+
+// NewMiddleware returns a middleware that handles events in batches of a size,
+// or the events received within an interval.
+func NewMiddleware(size int, interval time.Duration, opts ...Option) eh.EventHandlerMiddleware {
+	return func(h eh.EventHandler) eh.EventHandler {
+		return NewEventHandler(h, size, interval, opts...)
+	}
+}
+
+// EventHandler is a middleware that buffers events and flushes them to the
+// wrapped handler in batches, when the batch is full or when the interval has
+// passed since the first event of the batch. Handlers that implement
+// BatchEventHandler receive each batch at once, other handlers receive the
+// events of the batch one at a time. The events are flushed in the order they
+// were received, and a batch only has events from one namespace.
+//
+// Events are not handled when HandleEvent returns, so the wrapped handler's
+// error is only returned for the event that filled the batch. Errors of
+// batches flushed by the interval are logged. The events of a failed batch
+// are not retried. Close must be called on shutdown to flush the remaining
+// events.
+type EventHandler struct {
+	eh.EventHandler
+	size     int
+	interval time.Duration
+	logger   eh.Logger
+
+	// mu is held while flushing, to handle the batches in order.
+	mu     sync.Mutex
+	events []eh.Event
+	ctx    context.Context
+	timer  *time.Timer
+	// flushes counts the flushed batches, to skip the interval of a batch
+	// that was already flushed.
+	flushes int
+	closed  bool
+}
+
+// NewEventHandler creates a new EventHandler. A size of 1 or less flushes
+// every event, an interval of 0 or less only flushes full batches.
+func NewEventHandler(handler eh.EventHandler, size int, interval time.Duration, opts ...Option) *EventHandler {
+	if size < 1 {
+		size = 1
+	}
+
+	h := &EventHandler{
+		EventHandler: handler,
+		size:         size,
+		interval:     interval,
+		logger:       eh.NopLogger{},
+	}
+
+	for _, opt := range opts {
+		opt(h)
+	}
+
+	return h
+}
+
+// HandleEvent implements the HandleEvent method of the
+// eventhorizon.EventHandler interface. It returns ErrHandlerClosed after the
+// handler has been closed.
+func (h *EventHandler) HandleEvent(ctx context.Context, event eh.Event) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.closed {
+		return ErrHandlerClosed
+	}
+
+	// Flush the events of another namespace first, as the batch is handled
+	// with one context.
+	if len(h.events) > 0 && eh.Namespace(ctx) != eh.Namespace(h.ctx) {
+		if err := h.flush(); err != nil {
+			return err
+		}
+	}
+
+	h.events = append(h.events, event)
+	h.ctx = ctx
+	if len(h.events) >= h.size {
+		return h.flush()
+	}
+
+	// Start the interval with the first event of the batch.
+	if len(h.events) == 1 && h.interval > 0 {
+		flushes := h.flushes
+		h.timer = time.AfterFunc(h.interval, func() { h.flushInterval(flushes) })
+	}
+
+	return nil
+}
+
+// Close flushes the remaining events and stops the handler from receiving
+// more events. The error from the last batch is returned.
+func (h *EventHandler) Close() error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.closed = true
+	return h.flush()
+}
+
+// flushInterval flushes the batch when the interval has passed, unless it has
+// already been flushed.
+func (h *EventHandler) flushInterval(flushes int) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if flushes != h.flushes {
+		return
+	}
+	if err := h.flush(); err != nil {
+		h.logger.Error("batch: handler failed",
+			"handler_type", h.HandlerType(),
+			"error", err,
+		)
+	}
+}
+
+// flush handles the buffered events with the wrapped handler, must be called
+// with mu locked.
+func (h *EventHandler) flush() error {
+	if h.timer != nil {
+		h.timer.Stop()
+		h.timer = nil
+	}
+	if len(h.events) == 0 {
+		return nil
+	}
+
+	events, ctx := h.events, h.ctx
+	h.events, h.ctx = nil, nil
+	h.flushes++
+
+	if handler, ok := h.EventHandler.(BatchEventHandler); ok {
+		return handler.HandleEvents(ctx, events)
+	}
+	for _, event := range events {
+		if err := h.EventHandler.HandleEvent(ctx, event); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,193 @@
+// Copyright (c) 2016 - Max Ekman <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package batch
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	eh "github.com/looplab/eventhorizon"
+	"github.com/looplab/eventhorizon/mocks"
+)
+
+func TestEventHandler(t *testing.T) {
+	inner := newBatchHandler()
+	h := eh.UseEventHandlerMiddleware(inner, NewMiddleware(4, 0))
+	if h.HandlerType() != inner.HandlerType() {
+		t.Error("the handler type should be kept:", h.HandlerType())
+	}
+
+	t.Log("handle events in full batches")
+	ctx := context.Background()
+	agg := mocks.NewAggregate(eh.NewUUID())
+	events := []eh.Event{}
+	for i := 0; i < 10; i++ {
+		event := agg.NewEvent(mocks.EventType, &mocks.EventData{"event"})
+		agg.ApplyEvent(ctx, event) // Apply event to increment the aggregate version.
+		events = append(events, event)
+		if err := h.HandleEvent(ctx, event); err != nil {
+			t.Error("there should be no error:", err)
+		}
+	}
+	if batches := inner.Batches(); !reflect.DeepEqual(batches, [][]eh.Event{events[0:4], events[4:8]}) {
+		t.Error("the events should be handled in full batches:", batches)
+	}
+
+	t.Log("flush the remaining events when closing")
+	if err := h.(*EventHandler).Close(); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	expected := [][]eh.Event{events[0:4], events[4:8], events[8:10]}
+	if batches := inner.Batches(); !reflect.DeepEqual(batches, expected) {
+		t.Error("the remaining events should be handled:", batches)
+	}
+
+	t.Log("handle event after closing")
+	if err := h.HandleEvent(ctx, events[0]); err != ErrHandlerClosed {
+		t.Error("there should be a ErrHandlerClosed error:", err)
+	}
+}
+
+func TestEventHandlerInterval(t *testing.T) {
+	inner := newBatchHandler()
+	h := NewEventHandler(inner, 100, 20*time.Millisecond)
+
+	t.Log("flush the events after the interval")
+	ctx := context.Background()
+	agg := mocks.NewAggregate(eh.NewUUID())
+	events := []eh.Event{}
+	for i := 0; i < 3; i++ {
+		event := agg.NewEvent(mocks.EventType, &mocks.EventData{"event"})
+		agg.ApplyEvent(ctx, event) // Apply event to increment the aggregate version.
+		events = append(events, event)
+		if err := h.HandleEvent(ctx, event); err != nil {
+			t.Error("there should be no error:", err)
+		}
+	}
+	if batches := inner.Batches(); len(batches) != 0 {
+		t.Error("the events should not be handled before the interval:", batches)
+	}
+	select {
+	case <-inner.flushed:
+	case <-time.After(time.Second):
+		t.Fatal("the events should be flushed")
+	}
+	if batches := inner.Batches(); !reflect.DeepEqual(batches, [][]eh.Event{events}) {
+		t.Error("the events should be handled in one batch:", batches)
+	}
+}
+
+func TestEventHandlerNamespaces(t *testing.T) {
+	inner := newBatchHandler()
+	h := NewEventHandler(inner, 10, 0)
+
+	t.Log("flush the batch when the namespace changes")
+	ctx := context.Background()
+	otherCtx := eh.WithNamespace(ctx, "other")
+	agg := mocks.NewAggregate(eh.NewUUID())
+	event1 := agg.NewEvent(mocks.EventType, &mocks.EventData{"event1"})
+	event2 := agg.NewEvent(mocks.EventType, &mocks.EventData{"event2"})
+	event3 := agg.NewEvent(mocks.EventType, &mocks.EventData{"event3"})
+	h.HandleEvent(ctx, event1)
+	h.HandleEvent(ctx, event2)
+	h.HandleEvent(otherCtx, event3)
+	h.Close()
+	expected := [][]eh.Event{{event1, event2}, {event3}}
+	if batches := inner.Batches(); !reflect.DeepEqual(batches, expected) {
+		t.Error("the batches should be split by namespace:", batches)
+	}
+	if inner.namespaces[0] != "default" || inner.namespaces[1] != "other" {
+		t.Error("the batches should be handled in their namespace:", inner.namespaces)
+	}
+}
+
+func TestEventHandlerErrors(t *testing.T) {
+	inner := newBatchHandler()
+	inner.err = errors.New("handler error")
+	h := NewEventHandler(inner, 2, 0)
+
+	t.Log("return the error for the event that filled the batch")
+	ctx := context.Background()
+	agg := mocks.NewAggregate(eh.NewUUID())
+	event1 := agg.NewEvent(mocks.EventType, &mocks.EventData{"event1"})
+	event2 := agg.NewEvent(mocks.EventType, &mocks.EventData{"event2"})
+	if err := h.HandleEvent(ctx, event1); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if err := h.HandleEvent(ctx, event2); err != inner.err {
+		t.Error("there should be a handler error:", err)
+	}
+}
+
+func TestEventHandlerNonBatch(t *testing.T) {
+	inner := mocks.NewEventHandler("testHandler")
+	h := NewEventHandler(inner, 2, 0)
+
+	t.Log("handle the events of a batch one at a time")
+	ctx := context.Background()
+	agg := mocks.NewAggregate(eh.NewUUID())
+	event1 := agg.NewEvent(mocks.EventType, &mocks.EventData{"event1"})
+	event2 := agg.NewEvent(mocks.EventType, &mocks.EventData{"event2"})
+	h.HandleEvent(ctx, event1)
+	if len(inner.Events) != 0 {
+		t.Error("the event should be buffered:", inner.Events)
+	}
+	h.HandleEvent(ctx, event2)
+	if !reflect.DeepEqual(inner.Events, []eh.Event{event1, event2}) {
+		t.Error("the events should be handled in order:", inner.Events)
+	}
+}
+
+// batchHandler records the batches it handles.
+type batchHandler struct {
+	batches    [][]eh.Event
+	namespaces []string
+	err        error
+	flushed    chan struct{}
+	mu         sync.Mutex
+}
+
+func newBatchHandler() *batchHandler {
+	return &batchHandler{
+		flushed: make(chan struct{}, 10),
+	}
+}
+
+func (h *batchHandler) HandlerType() eh.EventHandlerType {
+	return "batchHandler"
+}
+
+func (h *batchHandler) HandleEvent(ctx context.Context, event eh.Event) error {
+	return h.HandleEvents(ctx, []eh.Event{event})
+}
+
+func (h *batchHandler) HandleEvents(ctx context.Context, events []eh.Event) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.batches = append(h.batches, events)
+	h.namespaces = append(h.namespaces, eh.Namespace(ctx))
+	h.flushed <- struct{}{}
+	return h.err
+}
+
+func (h *batchHandler) Batches() [][]eh.Event {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return append([][]eh.Event{}, h.batches...)
+}
@@ -0,0 +1,225 @@
+// Copyright (c) 2016 - Max Ekman <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package circuitbreaker
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	eh "github.com/looplab/eventhorizon"
+)
+
+// ErrCircuitOpen is when an event is not handled because the circuit is open.
+var ErrCircuitOpen = errors.New("circuit open")
+
+// State is the state of a circuit breaker.
+type State int
+
+const (
+	// StateClosed is when events are handled.
+	StateClosed State = iota
+	// StateOpen is when events fail fast with ErrCircuitOpen.
+	StateOpen
+	// StateHalfOpen is when the cooldown has passed and one event is handled
+	// to test if the handler has recovered.
+	StateHalfOpen
+)
+
+// String returns the name of the state.
+func (s State) String() string {
+	switch s {
+	case StateClosed:
+		return "closed"
+	case StateOpen:
+		return "open"
+	case StateHalfOpen:
+		return "half-open"
+	default:
+		return "unknown"
+	}
+}
+
+// Option is an option setter used to configure the middleware.
+type Option func(*EventHandler)
+
+// WithThreshold sets the number of consecutive failures that opens the
+// circuit, the default is 5. A threshold of 1 or less opens the circuit on the
+// first failure.
+func WithThreshold(n int) Option {
+	return func(h *EventHandler) {
+		if n < 1 {
+			n = 1
+		}
+		h.threshold = n
+	}
+}
+
+// WithCooldown sets the time that the circuit is open before an event is let
+// through to test if the handler has recovered, the default is 30 seconds.
+func WithCooldown(d time.Duration) Option {
+	return func(h *EventHandler) {
+		h.cooldown = d
+	}
+}
+
+// WithClock uses a clock for the cooldown, instead of time.Now.
+func WithClock(clock eh.Clock) Option {
+	return func(h *EventHandler) {
+		if clock == nil {
+			clock = time.Now
+		}
+		h.now = clock
+	}
+}
+
+// WithLogger logs the state changes of the circuit with a logger.
+func WithLogger(logger eh.Logger) Option {
+	return func(h *EventHandler) {
+		if logger == nil {
+			logger = eh.NopLogger{}
+		}
+		h.logger = logger
+	}
+}
+
+// NewMiddleware returns a middleware that stops handling events with a
+// circuit breaker when the handlers fail, each handler has its own circuit.
+func NewMiddleware(opts ...Option) eh.EventHandlerMiddleware {
+	return func(h eh.EventHandler) eh.EventHandler {
+		return NewEventHandler(h, opts...)
+	}
+}
+
+// EventHandler is a middleware with a circuit breaker, for handlers that call
+// external services. The circuit opens after a threshold of consecutive
+// failures, and events then fail fast with ErrCircuitOpen instead of being
+// handled. After the cooldown the circuit is half-open and the next event is
+// handled to test if the handler has recovered; the circuit closes if it is
+// handled and opens again for another cooldown if it fails. Other events fail
+// with ErrCircuitOpen while the test event is handled.
+type EventHandler struct {
+	eh.EventHandler
+	threshold int
+	cooldown  time.Duration
+	now       eh.Clock
+	logger    eh.Logger
+
+	mu       sync.Mutex
+	state    State
+	failures int
+	openedAt time.Time
+	testing  bool
+}
+
+// NewEventHandler creates a new EventHandler.
+func NewEventHandler(handler eh.EventHandler, opts ...Option) *EventHandler {
+	h := &EventHandler{
+		EventHandler: handler,
+		threshold:    5,
+		cooldown:     30 * time.Second,
+		now:          time.Now,
+		logger:       eh.NopLogger{},
+	}
+
+	for _, opt := range opts {
+		opt(h)
+	}
+
+	return h
+}
+
+// State returns the current state of the circuit. An open circuit is reported
+// as half-open when the cooldown has passed.
+func (h *EventHandler) State() State {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.state == StateOpen && !h.now().Before(h.openedAt.Add(h.cooldown)) {
+		return StateHalfOpen
+	}
+	return h.state
+}
+
+// HandleEvent implements the HandleEvent method of the
+// eventhorizon.EventHandler interface. It returns ErrCircuitOpen without
+// handling the event when the circuit is open.
+func (h *EventHandler) HandleEvent(ctx context.Context, event eh.Event) error {
+	if err := h.allow(); err != nil {
+		return err
+	}
+
+	err := h.EventHandler.HandleEvent(ctx, event)
+	h.done(err)
+
+	return err
+}
+
+// allow returns ErrCircuitOpen if an event can not be handled.
+func (h *EventHandler) allow() error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.state == StateOpen {
+		if h.now().Before(h.openedAt.Add(h.cooldown)) {
+			return ErrCircuitOpen
+		}
+		h.setState(StateHalfOpen)
+	}
+
+	if h.state == StateHalfOpen {
+		if h.testing {
+			return ErrCircuitOpen
+		}
+		h.testing = true
+	}
+
+	return nil
+}
+
+// done updates the circuit with the result of handling an event.
+func (h *EventHandler) done(err error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.state == StateHalfOpen {
+		h.testing = false
+	}
+
+	if err == nil {
+		h.failures = 0
+		if h.state != StateClosed {
+			h.setState(StateClosed)
+		}
+		return
+	}
+
+	h.failures++
+	if h.state == StateHalfOpen || (h.state == StateClosed && h.failures >= h.threshold) {
+		h.openedAt = h.now()
+		h.setState(StateOpen)
+	}
+}
+
+// setState changes the state of the circuit and logs the change.
+func (h *EventHandler) setState(state State) {
+	h.logger.Info("circuitbreaker: circuit state changed",
+		"handler", h.HandlerType(),
+		"from", h.state.String(),
+		"to", state.String(),
+	)
+	h.state = state
+}
@@ -0,0 +1,218 @@
+// Copyright (c) 2016 - Max Ekman <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package circuitbreaker
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	eh "github.com/looplab/eventhorizon"
+	"github.com/looplab/eventhorizon/mocks"
+)
+
+func TestEventHandler(t *testing.T) {
+	inner := mocks.NewEventHandler("testHandler")
+	clock := &testClock{t: time.Date(2020, time.January, 1, 12, 0, 0, 0, time.UTC)}
+	h := eh.UseEventHandlerMiddleware(inner, NewMiddleware(
+		WithThreshold(3),
+		WithCooldown(time.Minute),
+		WithClock(clock.Now),
+	))
+	if h.HandlerType() != inner.HandlerType() {
+		t.Error("the handler type should be kept:", h.HandlerType())
+	}
+	breaker := h.(*EventHandler)
+
+	ctx := context.Background()
+	event := mocks.NewAggregate(eh.NewUUID()).NewEvent(mocks.EventType, &mocks.EventData{"event"})
+	handlerErr := errors.New("handler error")
+
+	t.Log("handle events with a closed circuit")
+	if err := h.HandleEvent(ctx, event); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	inner.WaitForEvent(t)
+	if breaker.State() != StateClosed {
+		t.Error("the circuit should be closed:", breaker.State())
+	}
+
+	t.Log("keep the circuit closed below the threshold")
+	inner.Err = handlerErr
+	for i := 0; i < 2; i++ {
+		if err := h.HandleEvent(ctx, event); err != handlerErr {
+			t.Error("there should be a handler error:", err)
+		}
+	}
+	if breaker.State() != StateClosed {
+		t.Error("the circuit should be closed:", breaker.State())
+	}
+
+	t.Log("open the circuit at the threshold")
+	if err := h.HandleEvent(ctx, event); err != handlerErr {
+		t.Error("there should be a handler error:", err)
+	}
+	if breaker.State() != StateOpen {
+		t.Error("the circuit should be open:", breaker.State())
+	}
+
+	t.Log("fail fast while the circuit is open")
+	inner.Err = nil
+	if err := h.HandleEvent(ctx, event); err != ErrCircuitOpen {
+		t.Error("there should be a ErrCircuitOpen error:", err)
+	}
+	clock.Add(time.Minute - time.Second)
+	if err := h.HandleEvent(ctx, event); err != ErrCircuitOpen {
+		t.Error("there should be a ErrCircuitOpen error:", err)
+	}
+	if len(inner.Events) != 1 {
+		t.Error("there should be no handled events:", inner.Events)
+	}
+
+	t.Log("open the circuit again if the test event fails")
+	clock.Add(time.Second)
+	if breaker.State() != StateHalfOpen {
+		t.Error("the circuit should be half-open:", breaker.State())
+	}
+	inner.Err = handlerErr
+	if err := h.HandleEvent(ctx, event); err != handlerErr {
+		t.Error("there should be a handler error:", err)
+	}
+	if breaker.State() != StateOpen {
+		t.Error("the circuit should be open:", breaker.State())
+	}
+	if err := h.HandleEvent(ctx, event); err != ErrCircuitOpen {
+		t.Error("there should be a ErrCircuitOpen error:", err)
+	}
+
+	t.Log("close the circuit if the test event is handled")
+	clock.Add(time.Minute)
+	inner.Err = nil
+	if err := h.HandleEvent(ctx, event); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	inner.WaitForEvent(t)
+	if breaker.State() != StateClosed {
+		t.Error("the circuit should be closed:", breaker.State())
+	}
+	if len(inner.Events) != 2 {
+		t.Error("the test event should be handled:", inner.Events)
+	}
+
+	t.Log("count the failures again after closing")
+	inner.Err = handlerErr
+	for i := 0; i < 2; i++ {
+		if err := h.HandleEvent(ctx, event); err != handlerErr {
+			t.Error("there should be a handler error:", err)
+		}
+	}
+	if breaker.State() != StateClosed {
+		t.Error("the circuit should be closed:", breaker.State())
+	}
+}
+
+func TestEventHandlerHalfOpen(t *testing.T) {
+	inner := &blockingHandler{
+		started: make(chan struct{}, 1),
+		release: make(chan struct{}),
+	}
+	clock := &testClock{t: time.Date(2020, time.January, 1, 12, 0, 0, 0, time.UTC)}
+	h := NewEventHandler(inner, WithThreshold(1), WithCooldown(time.Minute), WithClock(clock.Now))
+
+	ctx := context.Background()
+	event := mocks.NewAggregate(eh.NewUUID()).NewEvent(mocks.EventType, &mocks.EventData{"event"})
+
+	t.Log("open the circuit on the first failure")
+	inner.err = errors.New("handler error")
+	close(inner.release)
+	if err := h.HandleEvent(ctx, event); err == nil {
+		t.Error("there should be a handler error")
+	}
+	<-inner.started
+	if h.State() != StateOpen {
+		t.Error("the circuit should be open:", h.State())
+	}
+
+	t.Log("only handle one test event when half-open")
+	clock.Add(time.Minute)
+	inner.err = nil
+	inner.release = make(chan struct{})
+	errs := make(chan error, 1)
+	go func() {
+		errs <- h.HandleEvent(ctx, event)
+	}()
+	<-inner.started
+	if err := h.HandleEvent(ctx, event); err != ErrCircuitOpen {
+		t.Error("there should be a ErrCircuitOpen error:", err)
+	}
+	close(inner.release)
+	if err := <-errs; err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if h.State() != StateClosed {
+		t.Error("the circuit should be closed:", h.State())
+	}
+}
+
+func TestStateString(t *testing.T) {
+	for state, name := range map[State]string{
+		StateClosed:   "closed",
+		StateOpen:     "open",
+		StateHalfOpen: "half-open",
+		State(-1):     "unknown",
+	} {
+		if state.String() != name {
+			t.Error("the state name should be correct:", state.String())
+		}
+	}
+}
+
+// testClock is a clock that is moved manually.
+type testClock struct {
+	mu sync.Mutex
+	t  time.Time
+}
+
+func (c *testClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.t
+}
+
+func (c *testClock) Add(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.t = c.t.Add(d)
+}
+
+// blockingHandler is a handler that signals when it starts handling an event
+// and waits to be released before returning its error.
+type blockingHandler struct {
+	started chan struct{}
+	release chan struct{}
+	err     error
+}
+
+func (h *blockingHandler) HandlerType() eh.EventHandlerType {
+	return "blockingHandler"
+}
+
+func (h *blockingHandler) HandleEvent(ctx context.Context, event eh.Event) error {
+	h.started <- struct{}{}
+	<-h.release
+	return h.err
+}
@@ -0,0 +1,85 @@
+// Copyright (c) 2016 - Max Ekman <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package idempotent
+
+import (
+	"context"
+	"strconv"
+
+	eh "github.com/looplab/eventhorizon"
+)
+
+// ProcessedStore is a store of the events that have been processed by each
+// event handler type.
+type ProcessedStore interface {
+	// MarkProcessed marks an event as processed by a handler type.
+	MarkProcessed(ctx context.Context, handlerType eh.EventHandlerType, eventID string) error
+
+	// IsProcessed returns if an event has been processed by a handler type.
+	IsProcessed(ctx context.Context, handlerType eh.EventHandlerType, eventID string) (bool, error)
+}
+
+// EventID returns the ID used to identify an event in the store, which is the
+// aggregate ID and the version of the event as they are unique for an event.
+func EventID(event eh.Event) string {
+	return event.AggregateID().String() + ":" + strconv.Itoa(event.Version())
+}
+
+// NewMiddleware returns a middleware that only lets the handlers handle each
+// event once.
+func NewMiddleware(store ProcessedStore) eh.EventHandlerMiddleware {
+	return func(h eh.EventHandler) eh.EventHandler {
+		return NewEventHandler(h, store)
+	}
+}
+
+// EventHandler is a middleware that skips events that have already been
+// processed by the handler type, for example events that are redelivered by
+// an event bus. Events are marked as processed after they have been handled
+// without an error, events delivered again while being handled for the first
+// time are not skipped.
+type EventHandler struct {
+	eh.EventHandler
+	store ProcessedStore
+}
+
+// NewEventHandler creates a new EventHandler.
+func NewEventHandler(handler eh.EventHandler, store ProcessedStore) *EventHandler {
+	return &EventHandler{
+		EventHandler: handler,
+		store:        store,
+	}
+}
+
+// HandleEvent implements the HandleEvent method of the
+// eventhorizon.EventHandler interface.
+func (h *EventHandler) HandleEvent(ctx context.Context, event eh.Event) error {
+	handlerType := h.HandlerType()
+	id := EventID(event)
+
+	processed, err := h.store.IsProcessed(ctx, handlerType, id)
+	if err != nil {
+		return err
+	}
+	if processed {
+		return nil
+	}
+
+	if err := h.EventHandler.HandleEvent(ctx, event); err != nil {
+		return err
+	}
+
+	return h.store.MarkProcessed(ctx, handlerType, id)
+}
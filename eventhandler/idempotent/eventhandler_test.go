@@ -0,0 +1,91 @@
+// Copyright (c) 2016 - Max Ekman <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package idempotent
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	eh "github.com/looplab/eventhorizon"
+	"github.com/looplab/eventhorizon/eventhandler/idempotent/memory"
+	"github.com/looplab/eventhorizon/mocks"
+)
+
+func TestEventHandler(t *testing.T) {
+	store := memory.NewProcessedStore()
+	handler := mocks.NewEventHandler("testHandler")
+	h := eh.UseEventHandlerMiddleware(handler, NewMiddleware(store))
+	if h.HandlerType() != "testHandler" {
+		t.Error("the handler type should be kept:", h.HandlerType())
+	}
+
+	ctx := context.Background()
+	id := eh.NewUUID()
+	agg := mocks.NewAggregate(id)
+	event1 := agg.NewEvent(mocks.EventType, &mocks.EventData{"event1"})
+	agg.ApplyEvent(ctx, event1)
+
+	t.Log("handle event")
+	if err := h.HandleEvent(ctx, event1); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if len(handler.Events) != 1 {
+		t.Error("the event should be handled:", handler.Events)
+	}
+
+	t.Log("skip redelivered event")
+	if err := h.HandleEvent(ctx, event1); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if len(handler.Events) != 1 {
+		t.Error("the event should only be handled once:", handler.Events)
+	}
+
+	t.Log("handle event with another handler type")
+	otherHandler := mocks.NewEventHandler("otherHandler")
+	otherH := eh.UseEventHandlerMiddleware(otherHandler, NewMiddleware(store))
+	if err := otherH.HandleEvent(ctx, event1); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if len(otherHandler.Events) != 1 {
+		t.Error("the event should be handled by the other handler type:", otherHandler.Events)
+	}
+
+	t.Log("handle failed event again")
+	event2 := agg.NewEvent(mocks.EventType, &mocks.EventData{"event2"})
+	agg.ApplyEvent(ctx, event2)
+	handler.Err = errors.New("handler error")
+	if err := h.HandleEvent(ctx, event2); err != handler.Err {
+		t.Error("there should be a handler error:", err)
+	}
+	handler.Err = nil
+	if err := h.HandleEvent(ctx, event2); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if len(handler.Events) != 2 {
+		t.Error("the failed event should be handled again:", handler.Events)
+	}
+}
+
+func TestEventID(t *testing.T) {
+	id, _ := eh.ParseUUID("c1138e5f-f6fb-4dd0-8e79-255c6c8d3756")
+	agg := mocks.NewAggregate(id)
+	event := agg.NewEvent(mocks.EventType, nil)
+	agg.ApplyEvent(context.Background(), event)
+	if eventID := EventID(event); eventID != "c1138e5f-f6fb-4dd0-8e79-255c6c8d3756:1" {
+		t.Error("the event ID should be correct:", eventID)
+	}
+}
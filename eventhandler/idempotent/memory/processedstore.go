@@ -0,0 +1,70 @@
+// Copyright (c) 2016 - Max Ekman <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package memory
+
+import (
+	"context"
+	"sync"
+
+	eh "github.com/looplab/eventhorizon"
+)
+
+// ProcessedStore implements a ProcessedStore as an in memory structure.
+type ProcessedStore struct {
+	// The outer map is with namespace as key, the inner with the handler type
+	// and event ID.
+	db   map[string]map[processedKey]bool
+	dbMu sync.RWMutex
+}
+
+// NewProcessedStore creates a new ProcessedStore.
+func NewProcessedStore() *ProcessedStore {
+	return &ProcessedStore{
+		db: map[string]map[processedKey]bool{},
+	}
+}
+
+// MarkProcessed implements the MarkProcessed method of the
+// idempotent.ProcessedStore interface.
+func (s *ProcessedStore) MarkProcessed(ctx context.Context, handlerType eh.EventHandlerType, eventID string) error {
+	ns := eh.Namespace(ctx)
+
+	s.dbMu.Lock()
+	defer s.dbMu.Unlock()
+
+	if _, ok := s.db[ns]; !ok {
+		s.db[ns] = map[processedKey]bool{}
+	}
+	s.db[ns][processedKey{handlerType, eventID}] = true
+
+	return nil
+}
+
+// IsProcessed implements the IsProcessed method of the
+// idempotent.ProcessedStore interface.
+func (s *ProcessedStore) IsProcessed(ctx context.Context, handlerType eh.EventHandlerType, eventID string) (bool, error) {
+	ns := eh.Namespace(ctx)
+
+	s.dbMu.RLock()
+	defer s.dbMu.RUnlock()
+
+	return s.db[ns][processedKey{handlerType, eventID}], nil
+}
+
+// processedKey is the key of a processed event, per handler type.
+type processedKey struct {
+	handlerType eh.EventHandlerType
+	eventID     string
+}
@@ -0,0 +1,134 @@
+// Copyright (c) 2016 - Max Ekman <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mongodb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+
+	eh "github.com/looplab/eventhorizon"
+)
+
+// ErrCouldNotDialDB is when the database could not be dialed.
+var ErrCouldNotDialDB = errors.New("could not dial database")
+
+// ErrNoDBSession is when no database session is set.
+var ErrNoDBSession = errors.New("no database session")
+
+// ErrCouldNotClearDB is when the database could not be cleared.
+var ErrCouldNotClearDB = errors.New("could not clear database")
+
+// ErrCouldNotMarkProcessed is when an event could not be marked as processed.
+var ErrCouldNotMarkProcessed = errors.New("could not mark event as processed")
+
+// ErrCouldNotCheckProcessed is when it could not be checked if an event has
+// been processed.
+var ErrCouldNotCheckProcessed = errors.New("could not check if event is processed")
+
+// ProcessedStore implements a ProcessedStore for MongoDB, with one document
+// per handler type and event.
+type ProcessedStore struct {
+	session  *mgo.Session
+	dbPrefix string
+}
+
+// NewProcessedStore creates a new ProcessedStore.
+func NewProcessedStore(url, dbPrefix string) (*ProcessedStore, error) {
+	session, err := mgo.Dial(url)
+	if err != nil {
+		return nil, ErrCouldNotDialDB
+	}
+
+	session.SetMode(mgo.Strong, true)
+	session.SetSafe(&mgo.Safe{W: 1})
+
+	return NewProcessedStoreWithSession(session, dbPrefix)
+}
+
+// NewProcessedStoreWithSession creates a new ProcessedStore with a session.
+func NewProcessedStoreWithSession(session *mgo.Session, dbPrefix string) (*ProcessedStore, error) {
+	if session == nil {
+		return nil, ErrNoDBSession
+	}
+
+	s := &ProcessedStore{
+		session:  session,
+		dbPrefix: dbPrefix,
+	}
+
+	return s, nil
+}
+
+// MarkProcessed implements the MarkProcessed method of the
+// idempotent.ProcessedStore interface.
+func (s *ProcessedStore) MarkProcessed(ctx context.Context, handlerType eh.EventHandlerType, eventID string) error {
+	sess := s.session.Copy()
+	defer sess.Close()
+
+	if _, err := sess.DB(s.dbName(ctx)).C("processed").UpsertId(
+		processedID(handlerType, eventID),
+		bson.M{
+			"handler_type": handlerType,
+			"event_id":     eventID,
+		},
+	); err != nil {
+		return fmt.Errorf("%w: %w", ErrCouldNotMarkProcessed, err)
+	}
+
+	return nil
+}
+
+// IsProcessed implements the IsProcessed method of the
+// idempotent.ProcessedStore interface.
+func (s *ProcessedStore) IsProcessed(ctx context.Context, handlerType eh.EventHandlerType, eventID string) (bool, error) {
+	sess := s.session.Copy()
+	defer sess.Close()
+
+	n, err := sess.DB(s.dbName(ctx)).C("processed").FindId(processedID(handlerType, eventID)).Count()
+	if err != nil {
+		return false, fmt.Errorf("%w: %w", ErrCouldNotCheckProcessed, err)
+	}
+
+	return n > 0, nil
+}
+
+// Clear clears the processed events.
+func (s *ProcessedStore) Clear(ctx context.Context) error {
+	if err := s.session.DB(s.dbName(ctx)).C("processed").DropCollection(); err != nil {
+		return fmt.Errorf("%w: %w", ErrCouldNotClearDB, err)
+	}
+	return nil
+}
+
+// Close closes a database session.
+func (s *ProcessedStore) Close() {
+	s.session.Close()
+}
+
+// dbName appends the namespace, if one is set, to the DB prefix to
+// get the name of the DB to use.
+func (s *ProcessedStore) dbName(ctx context.Context) string {
+	ns := eh.Namespace(ctx)
+	return s.dbPrefix + "_" + ns
+}
+
+// processedID is the document ID of a processed event for a handler type.
+func processedID(handlerType eh.EventHandlerType, eventID string) string {
+	return string(handlerType) + "/" + eventID
+}
@@ -0,0 +1,70 @@
+// Copyright (c) 2016 - Max Ekman <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package testutil
+
+import (
+	"context"
+	"testing"
+
+	"github.com/looplab/eventhorizon/eventhandler/idempotent"
+)
+
+// ProcessedStoreCommonTests are test cases that are common to all
+// implementations of processed stores.
+func ProcessedStoreCommonTests(t *testing.T, ctx context.Context, store idempotent.ProcessedStore) {
+	t.Log("check event that is not processed")
+	processed, err := store.IsProcessed(ctx, "handler1", "event1")
+	if err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if processed {
+		t.Error("the event should not be processed")
+	}
+
+	t.Log("mark event as processed")
+	if err := store.MarkProcessed(ctx, "handler1", "event1"); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	processed, err = store.IsProcessed(ctx, "handler1", "event1")
+	if err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if !processed {
+		t.Error("the event should be processed")
+	}
+
+	t.Log("mark event as processed again")
+	if err := store.MarkProcessed(ctx, "handler1", "event1"); err != nil {
+		t.Error("there should be no error:", err)
+	}
+
+	t.Log("check event for another handler type")
+	processed, err = store.IsProcessed(ctx, "handler2", "event1")
+	if err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if processed {
+		t.Error("the event should not be processed by another handler type")
+	}
+
+	t.Log("check other event")
+	processed, err = store.IsProcessed(ctx, "handler1", "event2")
+	if err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if processed {
+		t.Error("the other event should not be processed")
+	}
+}
@@ -0,0 +1,247 @@
+// Copyright (c) 2016 - Max Ekman <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"time"
+
+	"github.com/jpillora/backoff"
+	eh "github.com/looplab/eventhorizon"
+)
+
+// ErrCouldNotMarshalEvent is when an event could not be marshaled into JSON.
+var ErrCouldNotMarshalEvent = errors.New("could not marshal event")
+
+// ErrCouldNotSendEvent is when an event could not be sent to the webhook.
+var ErrCouldNotSendEvent = errors.New("could not send event")
+
+// ErrUnexpectedStatus is when the webhook responds with a status that is not
+// 2xx, the status code is in the base error.
+var ErrUnexpectedStatus = errors.New("unexpected status")
+
+// SignatureHeader is the header with the signature of the payload, when sent
+// with a secret. The signature is the hex encoded HMAC-SHA256 of the body,
+// prefixed with "sha256=".
+const SignatureHeader = "X-Eventhorizon-Signature"
+
+// Option is an option setter used to configure creation.
+type Option func(*EventHandler)
+
+// WithSecret signs the payload of every request with the secret, in the
+// SignatureHeader header.
+func WithSecret(secret []byte) Option {
+	return func(h *EventHandler) {
+		h.secret = secret
+	}
+}
+
+// WithClient sets the HTTP client to use, the default is http.DefaultClient.
+func WithClient(client *http.Client) Option {
+	return func(h *EventHandler) {
+		h.client = client
+	}
+}
+
+// WithTimeout sets the timeout of each attempt, the default is 10s.
+func WithTimeout(timeout time.Duration) Option {
+	return func(h *EventHandler) {
+		h.timeout = timeout
+	}
+}
+
+// WithAttempts sets the number of attempts in total for events that fail with
+// a 5xx or 429 status or could not be sent, the default is 3.
+func WithAttempts(attempts int) Option {
+	return func(h *EventHandler) {
+		if attempts < 1 {
+			attempts = 1
+		}
+		h.attempts = attempts
+	}
+}
+
+// WithBackoff waits between the attempts, starting with min and increasing
+// exponentially up to max. The default is from 100ms up to 10s, a max of 0
+// retries without waiting.
+func WithBackoff(min, max time.Duration) Option {
+	return func(h *EventHandler) {
+		h.minBackoff = min
+		h.maxBackoff = max
+	}
+}
+
+// WithLogger logs the retried events with a logger.
+func WithLogger(logger eh.Logger) Option {
+	return func(h *EventHandler) {
+		if logger == nil {
+			logger = eh.NopLogger{}
+		}
+		h.logger = logger
+	}
+}
+
+// EventHandler is an event handler that POSTs the events as JSON to a webhook,
+// for integrating with external systems. Events that fail with a 5xx or 429
+// status, or that could not be sent, are retried. Other statuses that are
+// not 2xx are returned as errors with ErrUnexpectedStatus without retrying.
+type EventHandler struct {
+	handlerType eh.EventHandlerType
+	url         string
+	client      *http.Client
+	secret      []byte
+	timeout     time.Duration
+	attempts    int
+	minBackoff  time.Duration
+	maxBackoff  time.Duration
+	logger      eh.Logger
+}
+
+// NewEventHandler creates a new EventHandler that sends the events to a URL.
+func NewEventHandler(handlerType eh.EventHandlerType, url string, opts ...Option) *EventHandler {
+	h := &EventHandler{
+		handlerType: handlerType,
+		url:         url,
+		client:      http.DefaultClient,
+		timeout:     10 * time.Second,
+		attempts:    3,
+		minBackoff:  100 * time.Millisecond,
+		maxBackoff:  10 * time.Second,
+		logger:      eh.NopLogger{},
+	}
+
+	for _, opt := range opts {
+		opt(h)
+	}
+
+	return h
+}
+
+// HandlerType implements the HandlerType method of the
+// eventhorizon.EventHandler interface.
+func (h *EventHandler) HandlerType() eh.EventHandlerType {
+	return h.handlerType
+}
+
+// HandleEvent implements the HandleEvent method of the
+// eventhorizon.EventHandler interface. The error from the last attempt is
+// returned if all attempts fail.
+func (h *EventHandler) HandleEvent(ctx context.Context, event eh.Event) error {
+	body, err := json.Marshal(Payload{
+		EventType:     event.EventType(),
+		Data:          event.Data(),
+		Timestamp:     event.Timestamp(),
+		AggregateType: event.AggregateType(),
+		AggregateID:   event.AggregateID(),
+		Version:       event.Version(),
+		Metadata:      event.Metadata(),
+		Context:       eh.MarshalContext(ctx),
+	})
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrCouldNotMarshalEvent, err)
+	}
+
+	delay := &backoff.Backoff{
+		Min: h.minBackoff,
+		Max: h.maxBackoff,
+	}
+
+	for i := 0; ; i++ {
+		// Wait before retrying, if there is a backoff.
+		if i > 0 && h.maxBackoff > 0 {
+			select {
+			case <-time.After(delay.Duration()):
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+
+		retry, err := h.send(ctx, body)
+		if err == nil || !retry || i == h.attempts-1 {
+			return err
+		}
+
+		h.logger.Info("webhook: retrying event",
+			"event_type", event.EventType(),
+			"attempt", i+2,
+			"error", err,
+		)
+	}
+}
+
+// send sends the body to the webhook once, returning if a failed request can
+// be retried.
+func (h *EventHandler) send(ctx context.Context, body []byte) (bool, error) {
+	if h.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, h.timeout)
+		defer cancel()
+	}
+
+	req, err := http.NewRequest(http.MethodPost, h.url, bytes.NewReader(body))
+	if err != nil {
+		return false, fmt.Errorf("%w: %w", ErrCouldNotSendEvent, err)
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", "application/json")
+	if h.secret != nil {
+		req.Header.Set(SignatureHeader, Sign(h.secret, body))
+	}
+
+	resp, err := h.client.Do(req)
+	if err != nil {
+		return true, fmt.Errorf("%w: %w", ErrCouldNotSendEvent, err)
+	}
+	defer resp.Body.Close()
+	// Read the body to reuse the connection.
+	io.Copy(ioutil.Discard, resp.Body)
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		retry := resp.StatusCode >= 500 || resp.StatusCode == http.StatusTooManyRequests
+		return retry, fmt.Errorf("%w: status %d", ErrUnexpectedStatus, resp.StatusCode)
+	}
+
+	return false, nil
+}
+
+// Sign returns the signature of a body signed with a secret, as sent in the
+// SignatureHeader header, for verifying the requests in the receiver.
+func Sign(secret, body []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Payload is the JSON body sent to the webhook for each event.
+type Payload struct {
+	EventType     eh.EventType           `json:"event_type"`
+	Data          eh.EventData           `json:"data,omitempty"`
+	Timestamp     time.Time              `json:"timestamp"`
+	AggregateType eh.AggregateType       `json:"aggregate_type"`
+	AggregateID   eh.UUID                `json:"aggregate_id"`
+	Version       int                    `json:"version"`
+	Metadata      map[string]interface{} `json:"metadata,omitempty"`
+	Context       map[string]interface{} `json:"context"`
+}
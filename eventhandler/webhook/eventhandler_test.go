@@ -0,0 +1,240 @@
+// Copyright (c) 2016 - Max Ekman <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	eh "github.com/looplab/eventhorizon"
+	"github.com/looplab/eventhorizon/mocks"
+)
+
+func TestEventHandler(t *testing.T) {
+	secret := []byte("secret")
+	server := newServer(t, http.StatusOK)
+	defer server.Close()
+
+	h := NewEventHandler("webhook", server.URL, WithSecret(secret))
+	if h.HandlerType() != "webhook" {
+		t.Error("the handler type should be correct:", h.HandlerType())
+	}
+
+	ctx := eh.WithNamespace(context.Background(), "ns")
+	id := eh.NewUUID()
+	agg := mocks.NewAggregate(id)
+	event := agg.NewEvent(mocks.EventType, &mocks.EventData{"event1"})
+	agg.ApplyEvent(ctx, event) // Apply event to increment the aggregate version.
+
+	t.Log("send an event")
+	if err := h.HandleEvent(ctx, event); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	reqs := server.requests()
+	if len(reqs) != 1 {
+		t.Fatal("there should be one request:", len(reqs))
+	}
+	req := reqs[0]
+	if req.method != http.MethodPost {
+		t.Error("the method should be POST:", req.method)
+	}
+	if req.header.Get("Content-Type") != "application/json" {
+		t.Error("the content type should be JSON:", req.header.Get("Content-Type"))
+	}
+	if sig := req.header.Get(SignatureHeader); sig != Sign(secret, req.body) {
+		t.Error("the signature should be correct:", sig)
+	}
+
+	var payload struct {
+		EventType     string                 `json:"event_type"`
+		Data          map[string]interface{} `json:"data"`
+		Timestamp     time.Time              `json:"timestamp"`
+		AggregateType string                 `json:"aggregate_type"`
+		AggregateID   string                 `json:"aggregate_id"`
+		Version       int                    `json:"version"`
+		Context       map[string]interface{} `json:"context"`
+	}
+	if err := json.Unmarshal(req.body, &payload); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	if payload.EventType != string(mocks.EventType) ||
+		payload.AggregateType != string(mocks.AggregateType) ||
+		payload.AggregateID != id.String() ||
+		payload.Version != 1 ||
+		!payload.Timestamp.Equal(event.Timestamp()) {
+		t.Error("the payload should be correct:", string(req.body))
+	}
+	if payload.Data["Content"] != "event1" {
+		t.Error("the payload data should be correct:", payload.Data)
+	}
+	if payload.Context["eh_namespace"] != "ns" {
+		t.Error("the payload context should have the namespace:", payload.Context)
+	}
+}
+
+func TestEventHandlerRetry(t *testing.T) {
+	server := newServer(t, http.StatusInternalServerError, http.StatusBadGateway, http.StatusOK)
+	defer server.Close()
+
+	ctx := context.Background()
+	event := eh.NewEvent(mocks.EventType, &mocks.EventData{"event1"})
+
+	t.Log("retry on 5xx responses")
+	h := NewEventHandler("webhook", server.URL, WithBackoff(time.Millisecond, time.Millisecond))
+	if err := h.HandleEvent(ctx, event); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	reqs := server.requests()
+	if len(reqs) != 3 {
+		t.Fatal("there should be three requests:", len(reqs))
+	}
+	if string(reqs[0].body) != string(reqs[2].body) {
+		t.Error("the retried payload should be the same:", string(reqs[2].body))
+	}
+
+	t.Log("fail after all attempts")
+	server.setStatuses(http.StatusServiceUnavailable)
+	h = NewEventHandler("webhook", server.URL, WithAttempts(2))
+	err := h.HandleEvent(ctx, event)
+	if !errors.Is(err, ErrUnexpectedStatus) {
+		t.Error("there should be a ErrUnexpectedStatus error:", err)
+	}
+	if err == nil || err.Error() != "unexpected status: status 503" {
+		t.Error("the error should have the status:", err)
+	}
+	if len(server.requests()) != 5 {
+		t.Error("there should be two more requests:", len(server.requests()))
+	}
+
+	t.Log("don't retry on 4xx responses")
+	server.setStatuses(http.StatusBadRequest)
+	if err := h.HandleEvent(ctx, event); !errors.Is(err, ErrUnexpectedStatus) {
+		t.Error("there should be a ErrUnexpectedStatus error:", err)
+	}
+	if len(server.requests()) != 6 {
+		t.Error("there should be one more request:", len(server.requests()))
+	}
+}
+
+func TestEventHandlerBackoff(t *testing.T) {
+	server := newServer(t, http.StatusInternalServerError, http.StatusInternalServerError, http.StatusOK)
+	defer server.Close()
+
+	ctx := context.Background()
+	event := eh.NewEvent(mocks.EventType, &mocks.EventData{"event1"})
+
+	t.Log("wait between the attempts by default")
+	h := NewEventHandler("webhook", server.URL)
+	if err := h.HandleEvent(ctx, event); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	reqs := server.requests()
+	if len(reqs) != 3 {
+		t.Fatal("there should be three requests:", len(reqs))
+	}
+	if d := reqs[1].time.Sub(reqs[0].time); d < 100*time.Millisecond {
+		t.Error("the second attempt should wait for the min backoff:", d)
+	}
+	if d := reqs[2].time.Sub(reqs[1].time); d < 200*time.Millisecond {
+		t.Error("the third attempt should wait for a longer backoff:", d)
+	}
+
+	t.Log("retry without waiting for a max backoff of 0")
+	server.setStatuses(http.StatusInternalServerError, http.StatusOK)
+	h = NewEventHandler("webhook", server.URL, WithBackoff(0, 0))
+	if err := h.HandleEvent(ctx, event); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	reqs = server.requests()
+	if len(reqs) != 5 {
+		t.Fatal("there should be two more requests:", len(reqs))
+	}
+	if d := reqs[4].time.Sub(reqs[3].time); d >= 100*time.Millisecond {
+		t.Error("the attempt should not wait:", d)
+	}
+}
+
+func TestEventHandlerTimeout(t *testing.T) {
+	done := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-done:
+		case <-r.Context().Done():
+		}
+	}))
+	defer server.Close()
+	defer close(done)
+
+	h := NewEventHandler("webhook", server.URL, WithTimeout(10*time.Millisecond), WithAttempts(1))
+	event := eh.NewEvent(mocks.EventType, &mocks.EventData{"event1"})
+	if err := h.HandleEvent(context.Background(), event); !errors.Is(err, ErrCouldNotSendEvent) {
+		t.Error("there should be a ErrCouldNotSendEvent error:", err)
+	}
+}
+
+// server is a test server that records the requests and responds with the
+// statuses in order, repeating the last one.
+type server struct {
+	*httptest.Server
+	mu       sync.Mutex
+	statuses []int
+	reqs     []request
+}
+
+type request struct {
+	method string
+	header http.Header
+	body   []byte
+	time   time.Time
+}
+
+func newServer(t *testing.T, statuses ...int) *server {
+	s := &server{statuses: statuses}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			t.Error("there should be no error:", err)
+		}
+
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		s.reqs = append(s.reqs, request{method: r.Method, header: r.Header, body: body, time: time.Now()})
+		status := s.statuses[0]
+		if len(s.statuses) > 1 {
+			s.statuses = s.statuses[1:]
+		}
+		w.WriteHeader(status)
+	}))
+	return s
+}
+
+func (s *server) requests() []request {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]request{}, s.reqs...)
+}
+
+func (s *server) setStatuses(statuses ...int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.statuses = statuses
+}
@@ -26,14 +26,18 @@ func init() {
 	RegisterAggregate(func(id UUID) Aggregate {
 		return NewTestAggregate2(id)
 	})
+	RegisterAggregate(func(id UUID) Aggregate {
+		return NewTestSnapshotAggregate(id)
+	})
 
 	RegisterEventData(TestEventType, func() EventData { return &TestEventData{} })
 	RegisterEventData(TestEvent2Type, func() EventData { return &TestEvent2Data{} })
 }
 
 const (
-	TestAggregateType  AggregateType = "TestAggregate"
-	TestAggregate2Type AggregateType = "TestAggregate2"
+	TestAggregateType         AggregateType = "TestAggregate"
+	TestAggregate2Type        AggregateType = "TestAggregate2"
+	TestSnapshotAggregateType AggregateType = "TestSnapshotAggregate"
 
 	TestEventType  EventType = "TestEvent"
 	TestEvent2Type EventType = "TestEvent2"
@@ -116,6 +120,41 @@ func (a *TestAggregate2) ApplyEvent(ctx context.Context, event Event) {
 	a.context = ctx
 }
 
+type TestSnapshotAggregate struct {
+	*AggregateBase
+
+	appliedEvents []Event
+	state         string
+}
+
+func NewTestSnapshotAggregate(id UUID) *TestSnapshotAggregate {
+	return &TestSnapshotAggregate{
+		AggregateBase: NewAggregateBase(TestSnapshotAggregateType, id),
+	}
+}
+
+func (a *TestSnapshotAggregate) HandleCommand(ctx context.Context, command Command) error {
+	return nil
+}
+
+func (a *TestSnapshotAggregate) ApplyEvent(ctx context.Context, event Event) {
+	defer a.IncrementVersion()
+
+	a.appliedEvents = append(a.appliedEvents, event)
+	if data, ok := event.Data().(*TestEventData); ok {
+		a.state = data.Content
+	}
+}
+
+func (a *TestSnapshotAggregate) SnapshotState() interface{} {
+	return a.state
+}
+
+func (a *TestSnapshotAggregate) ApplySnapshot(ctx context.Context, version int, state interface{}) {
+	a.SetVersion(version)
+	a.state, _ = state.(string)
+}
+
 type TestCommand struct {
 	TestID  UUID
 	Content string
@@ -159,11 +198,19 @@ func (m *MockRepository) Save(ctx context.Context, aggregate Aggregate) error {
 }
 
 type MockEventStore struct {
-	Events  []Event
-	Loaded  UUID
-	Context context.Context
+	Events     []Event
+	Loaded     UUID
+	LoadedFrom int
+	Context    context.Context
 	// Used to simulate errors in the store.
 	err error
+
+	Snapshot        interface{}
+	SnapshotVersion int
+	// Versions of all saved snapshots.
+	SavedSnapshots []int
+	// Used to simulate errors of only the snapshots.
+	snapshotErr error
 }
 
 func (m *MockEventStore) Save(ctx context.Context, events []Event, originalVersion int) error {
@@ -177,23 +224,88 @@ func (m *MockEventStore) Save(ctx context.Context, events []Event, originalVersi
 	return nil
 }
 
-func (m *MockEventStore) Load(ctx context.Context, aggregateType AggregateType, id UUID) ([]Event, error) {
+func (m *MockEventStore) Load(ctx context.Context, aggregateType AggregateType, id UUID, opts ...LoadOption) ([]Event, error) {
 	if m.err != nil {
 		return nil, m.err
 	}
 	m.Loaded = id
 	m.Context = ctx
+	if max := NewLoadOptions(opts...).MaxEvents; max > 0 && max < len(m.Events) {
+		return m.Events[:max], nil
+	}
 	return m.Events, nil
 }
 
+func (m *MockEventStore) LoadFrom(ctx context.Context, aggregateType AggregateType, id UUID, fromVersion int) ([]Event, error) {
+	if m.err != nil {
+		return nil, m.err
+	}
+	m.Loaded = id
+	m.LoadedFrom = fromVersion
+	m.Context = ctx
+	events := []Event{}
+	for _, event := range m.Events {
+		if event.Version() >= fromVersion {
+			events = append(events, event)
+		}
+	}
+	return events, nil
+}
+
+func (m *MockEventStore) ReplayAll(ctx context.Context) (<-chan Event, <-chan error) {
+	events := make(chan Event, len(m.Events))
+	errs := make(chan error, 1)
+	if m.err != nil {
+		errs <- m.err
+	} else {
+		for _, event := range m.Events {
+			events <- event
+		}
+	}
+	close(events)
+	close(errs)
+	return events, errs
+}
+
+func (m *MockEventStore) SaveSnapshot(ctx context.Context, aggregateType AggregateType, id UUID, version int, state interface{}) error {
+	if m.err != nil {
+		return m.err
+	}
+	if m.snapshotErr != nil {
+		return m.snapshotErr
+	}
+	m.Snapshot = state
+	m.SnapshotVersion = version
+	m.SavedSnapshots = append(m.SavedSnapshots, version)
+	m.Context = ctx
+	return nil
+}
+
+func (m *MockEventStore) LoadSnapshot(ctx context.Context, aggregateType AggregateType, id UUID) (interface{}, int, error) {
+	if m.err != nil {
+		return nil, 0, m.err
+	}
+	if m.snapshotErr != nil {
+		return nil, 0, m.snapshotErr
+	}
+	m.Context = ctx
+	return m.Snapshot, m.SnapshotVersion, nil
+}
+
 type MockEventBus struct {
 	Events  []Event
 	Context context.Context
+	// Used to simulate errors when publishing.
+	err error
 }
 
-func (m *MockEventBus) PublishEvent(ctx context.Context, event Event) {
+func (m *MockEventBus) PublishEvent(ctx context.Context, event Event) error {
+	if m.err != nil {
+		return m.err
+	}
 	m.Events = append(m.Events, event)
 	m.Context = ctx
+	return nil
 }
 
 func (m *MockEventBus) AddHandler(handler EventHandler, eventType EventType) {}
@@ -214,3 +326,69 @@ func (m *MockCommandBus) HandleCommand(ctx context.Context, command Command) err
 func (m *MockCommandBus) SetHandler(handler CommandHandler, commandType CommandType) error {
 	return nil
 }
+
+type TestBaseError struct {
+	Content string
+}
+
+func (e TestBaseError) Error() string {
+	return e.Content + " error"
+}
+
+type MockReadRepository struct {
+	Models map[UUID]interface{}
+	Err    error
+}
+
+func (m *MockReadRepository) Parent() ReadRepository {
+	return nil
+}
+
+func (m *MockReadRepository) Save(ctx context.Context, id UUID, model interface{}) error {
+	if m.Err != nil {
+		return m.Err
+	}
+	m.Models[id] = model
+	return nil
+}
+
+func (m *MockReadRepository) Find(ctx context.Context, id UUID) (interface{}, error) {
+	if m.Err != nil {
+		return nil, m.Err
+	}
+	model, ok := m.Models[id]
+	if !ok {
+		return nil, ReadRepositoryError{Err: ErrModelNotFound}
+	}
+	return model, nil
+}
+
+func (m *MockReadRepository) FindAll(ctx context.Context) ([]interface{}, error) {
+	if m.Err != nil {
+		return nil, m.Err
+	}
+	models := []interface{}{}
+	for _, model := range m.Models {
+		models = append(models, model)
+	}
+	return models, nil
+}
+
+func (m *MockReadRepository) Clear(ctx context.Context) error {
+	if m.Err != nil {
+		return m.Err
+	}
+	m.Models = map[UUID]interface{}{}
+	return nil
+}
+
+func (m *MockReadRepository) Remove(ctx context.Context, id UUID) error {
+	if m.Err != nil {
+		return m.Err
+	}
+	if _, ok := m.Models[id]; !ok {
+		return ReadRepositoryError{Err: ErrModelNotFound}
+	}
+	delete(m.Models, id)
+	return nil
+}
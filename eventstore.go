@@ -17,6 +17,8 @@ package eventhorizon
 import (
 	"context"
 	"errors"
+	"fmt"
+	"time"
 )
 
 // EventStoreError is an error in the event store, with the namespace.
@@ -27,6 +29,13 @@ type EventStoreError struct {
 	BaseErr error
 	// Namespace is the namespace for the error.
 	Namespace string
+	// ExpectedVersion is the version of the aggregate that the save expected,
+	// set when it fails with ErrIncorrectEventVersion because of another
+	// version in the store.
+	ExpectedVersion int
+	// ActualVersion is the version of the aggregate in the store when the save
+	// failed with ErrIncorrectEventVersion, set with ExpectedVersion.
+	ActualVersion int
 }
 
 // Error implements the Error method of the errors.Error interface.
@@ -38,6 +47,23 @@ func (e EventStoreError) Error() string {
 	return errStr + " (" + e.Namespace + ")"
 }
 
+// Unwrap returns the error, so that it can be matched with errors.Is and
+// errors.As.
+func (e EventStoreError) Unwrap() error {
+	return e.Err
+}
+
+// Is reports whether the base error matches the target, as errors.Is only
+// follows the error returned by Unwrap.
+func (e EventStoreError) Is(target error) bool {
+	return e.BaseErr != nil && errors.Is(e.BaseErr, target)
+}
+
+// As finds the first error in the base error that matches the target.
+func (e EventStoreError) As(target interface{}) bool {
+	return e.BaseErr != nil && errors.As(e.BaseErr, target)
+}
+
 // ErrNoEventsToAppend is when no events are available to append.
 var ErrNoEventsToAppend = errors.New("no events to append")
 
@@ -47,11 +73,467 @@ var ErrInvalidEvent = errors.New("invalid event")
 // ErrIncorrectEventVersion is when an event is for an other version of the aggregate.
 var ErrIncorrectEventVersion = errors.New("mismatching event version")
 
+// ErrReplayNotSupported is when an event store can not replay all events.
+var ErrReplayNotSupported = errors.New("replay not supported")
+
+// ErrHeadPositionNotSupported is when an event store can not return the global
+// position of the last saved event.
+var ErrHeadPositionNotSupported = errors.New("head position not supported")
+
+// ErrDeleteNotSupported is when an event store can not delete aggregates.
+var ErrDeleteNotSupported = errors.New("delete not supported")
+
+// ErrSnapshotsNotSupported is when an event store does not support snapshots.
+var ErrSnapshotsNotSupported = errors.New("snapshots not supported")
+
+// ErrBatchSaveNotSupported is when an event store can not save batches of
+// events for many aggregates.
+var ErrBatchSaveNotSupported = errors.New("batch save not supported")
+
+// ErrIncorrectSnapshotVersion is when a snapshot is for a version that the
+// aggregate does not have.
+var ErrIncorrectSnapshotVersion = errors.New("incorrect snapshot version")
+
+// ErrUnregisteredEventType is when an event with data is loaded by a strict
+// event store, but no event data has been registered for its type.
+var ErrUnregisteredEventType = errors.New("unregistered event type")
+
+// ErrTooManyEvents is when more events than the limit of the event store are
+// saved at once.
+var ErrTooManyEvents = errors.New("too many events")
+
+// ErrStreamAlreadyExists is when events are saved with ExpectedVersionNoStream
+// for an aggregate that already has events.
+var ErrStreamAlreadyExists = errors.New("stream already exists")
+
+// ErrDuplicateEvent is when an event is saved with the id of an event that is
+// already in the stream of the aggregate, see EventID.
+var ErrDuplicateEvent = errors.New("duplicate event")
+
+// ErrCompactNotSupported is when an event store can not compact aggregates.
+var ErrCompactNotSupported = errors.New("compact not supported")
+
+// ErrOutboxNotSupported is when an event store does not record the saved
+// events in an outbox.
+var ErrOutboxNotSupported = errors.New("outbox not supported")
+
+// ErrCorrelationLoadNotSupported is when an event store can not load events
+// by their correlation ID.
+var ErrCorrelationLoadNotSupported = errors.New("correlation load not supported")
+
+// ErrTransactionsNotSupported is when an event store can not save the events
+// of many aggregates atomically.
+var ErrTransactionsNotSupported = errors.New("transactions not supported")
+
+// ErrIncorrectCompactVersion is when events are compacted up to a version that
+// the aggregate does not have.
+var ErrIncorrectCompactVersion = errors.New("incorrect compact version")
+
+// Clock returns the current time. Event stores can use a clock to set the
+// timestamps of events when they are saved, instead of keeping the time when
+// the events were created.
+type Clock func() time.Time
+
+const (
+	// ExpectedVersionAny is used as the original version in Save to append the
+	// events regardless of the current version of the aggregate. The events
+	// must have consecutive versions, and are stored with the versions after
+	// the current version.
+	ExpectedVersionAny = -1
+
+	// ExpectedVersionNoStream is used as the original version in Save to only
+	// save the events if the aggregate has no events yet, returning
+	// ErrStreamAlreadyExists otherwise.
+	ExpectedVersionNoStream = -2
+)
+
+// DuplicateEvents is how an event store saves events with the id of an event
+// that is already in the stream of the aggregate, for example when an import
+// with at-least-once delivery saves an event again. Events without an id, see
+// EventID, are never duplicates. Unless duplicates are allowed, a save with
+// many events with the same id fails with ErrDuplicateEvent.
+type DuplicateEvents int
+
+const (
+	// DuplicateEventsAllowed saves events regardless of their ids, which is
+	// the default.
+	DuplicateEventsAllowed DuplicateEvents = iota
+
+	// DuplicateEventsRejected fails a save with ErrDuplicateEvent, without
+	// saving any of the events, if any event is a duplicate.
+	DuplicateEventsRejected
+
+	// DuplicateEventsSkipped skips the duplicates at the start of a save and
+	// advances the original version of the save past them. A duplicate after
+	// an event that is not one fails the save with ErrIncorrectEventVersion,
+	// as the events were created from an outdated version of the aggregate.
+	// A save of only duplicates succeeds without saving anything.
+	DuplicateEventsSkipped
+)
+
+// SkipDuplicateEvents returns the number of events at the start of a save to
+// skip as duplicates, for event stores that handle duplicates as set by d. The
+// ids are the event ids of the events to save, empty for events without an
+// id, and stored is the set of ids of the events in the stream. Returns
+// ErrDuplicateEvent if duplicates are rejected or for many events with the
+// same id, and ErrIncorrectEventVersion for a duplicate after the first event
+// that is not one.
+func SkipDuplicateEvents(ctx context.Context, d DuplicateEvents, stored map[string]bool, ids []string) (int, error) {
+	if d == DuplicateEventsAllowed {
+		return 0, nil
+	}
+
+	skipped := 0
+	saved := map[string]bool{}
+	for i, id := range ids {
+		if id == "" {
+			continue
+		}
+		if saved[id] || (stored[id] && d == DuplicateEventsRejected) {
+			return 0, EventStoreError{
+				Err:       ErrDuplicateEvent,
+				BaseErr:   fmt.Errorf("event %s", id),
+				Namespace: Namespace(ctx),
+			}
+		}
+		saved[id] = true
+		if !stored[id] {
+			continue
+		}
+		if skipped != i {
+			return 0, EventStoreError{
+				Err:       ErrIncorrectEventVersion,
+				BaseErr:   fmt.Errorf("duplicate event %s after new events", id),
+				Namespace: Namespace(ctx),
+			}
+		}
+		skipped++
+	}
+
+	return skipped, nil
+}
+
 // EventStore is an interface for an event sourcing event store.
 type EventStore interface {
-	// Save appends all events in the event stream to the store.
+	// Save appends all events in the event stream to the store. The original
+	// version is the version of the aggregate that the events apply to, or
+	// ExpectedVersionAny or ExpectedVersionNoStream.
 	Save(ctx context.Context, events []Event, originalVersion int) error
 
-	// Load loads all events for the aggregate id from the store.
-	Load(context.Context, AggregateType, UUID) ([]Event, error)
+	// Load loads all events for the aggregate id from the store, in version
+	// order. Options such as WithMaxEvents can be used to load only some of
+	// the events.
+	Load(ctx context.Context, aggregateType AggregateType, id UUID, opts ...LoadOption) ([]Event, error)
+}
+
+// LoadOption is an option for loading events with Load.
+type LoadOption func(*LoadOptions)
+
+// LoadOptions are the options for loading events, read by event store
+// implementations with NewLoadOptions.
+type LoadOptions struct {
+	// MaxEvents is the max number of events to load, 0 loads all events.
+	MaxEvents int
+}
+
+// NewLoadOptions returns the load options set by the options.
+func NewLoadOptions(opts ...LoadOption) LoadOptions {
+	o := LoadOptions{}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	if o.MaxEvents < 0 {
+		o.MaxEvents = 0
+	}
+
+	return o
+}
+
+// WithMaxEvents loads at most n events, the first events of the aggregate in
+// version order, for example when only an early state of the aggregate is
+// needed. A max of 0 or less loads all events.
+func WithMaxEvents(n int) LoadOption {
+	return func(o *LoadOptions) {
+		o.MaxEvents = n
+	}
+}
+
+// EventStoreVersionLoader is an optional interface for event stores that can
+// load only the later part of an event stream, starting at a version.
+type EventStoreVersionLoader interface {
+	// LoadFrom loads all events with a version of at least fromVersion for
+	// the aggregate id from the store.
+	LoadFrom(ctx context.Context, aggregateType AggregateType, id UUID, fromVersion int) ([]Event, error)
+}
+
+// EventStoreReverseLoader is an optional interface for event stores that can
+// load the latest events of an event stream, without loading all of it.
+type EventStoreReverseLoader interface {
+	// LoadReverse loads up to limit events for the aggregate id from the
+	// store, newest first. A limit of 0 or less loads all events.
+	LoadReverse(ctx context.Context, aggregateType AggregateType, id UUID, limit int) ([]Event, error)
+}
+
+// EventStoreTimeLoader is an optional interface for event stores that can load
+// the events of an aggregate within a time range, for example for audit
+// queries of an aggregate.
+type EventStoreTimeLoader interface {
+	// LoadBetween loads the events for the aggregate id with a timestamp at or
+	// after from and before to, in version order. A zero from or to leaves the
+	// range open at that end, as for the ReplayFilter.
+	LoadBetween(ctx context.Context, aggregateType AggregateType, id UUID, from, to time.Time) ([]Event, error)
+}
+
+// CorrelationIDKey is the metadata key for the correlation ID of an event,
+// which is shared by the events of a workflow across aggregates.
+const CorrelationIDKey = "correlation_id"
+
+// EventStoreCorrelationLoader is an optional interface for event stores that
+// can load the events of all aggregates with the same correlation ID in the
+// metadata, for example to debug a workflow.
+type EventStoreCorrelationLoader interface {
+	// LoadByCorrelation loads the events with the correlation ID set for the
+	// CorrelationIDKey in the metadata, ordered by timestamp.
+	LoadByCorrelation(ctx context.Context, correlationID string) ([]Event, error)
+}
+
+// EventStoreDeleter is an optional interface for event stores that can remove
+// the entire event stream of an aggregate, for example to erase personal data.
+type EventStoreDeleter interface {
+	// Delete deletes all events for the aggregate id from the store. Returns
+	// ErrAggregateNotFound if there are no events for the aggregate.
+	Delete(context.Context, AggregateType, UUID) error
+}
+
+// EventStoreCompacter is an optional interface for event stores that can remove
+// the older part of the event stream of an aggregate, for example when the
+// aggregate state is kept in a snapshot.
+type EventStoreCompacter interface {
+	// Compact removes all events with a version lower than upToVersion for the
+	// aggregate id from the store. The remaining events keep their versions.
+	// Returns ErrAggregateNotFound if there are no events for the aggregate and
+	// ErrIncorrectCompactVersion if upToVersion is past the latest version.
+	Compact(ctx context.Context, aggregateType AggregateType, id UUID, upToVersion int) error
+}
+
+// EventStoreBatchSaver is an optional interface for event stores that can save
+// the events of many aggregates at once, for example when importing events.
+type EventStoreBatchSaver interface {
+	// SaveBatch saves the events for each aggregate id, where the aggregates
+	// must be at the versions in expectedVersions. Aggregates without an
+	// expected version must be new. Either all events are saved, or none of
+	// them and ErrIncorrectEventVersion is returned if any aggregate was at
+	// another version. Stores without transactions, like the MongoDB store,
+	// may instead revert the aggregates that were written, see the store for
+	// the details; use a TransactionalEventStore if the events must not be
+	// visible before they have all been saved.
+	SaveBatch(ctx context.Context, events map[UUID][]Event, expectedVersions map[UUID]int) error
+}
+
+// EventStoreTx is a transaction for saving the events of many aggregates at
+// once, used in TransactionalEventStore.SaveInTransaction.
+type EventStoreTx interface {
+	// Save adds events for an aggregate to the transaction, as the Save of an
+	// event store. The version is checked when the transaction is committed.
+	// Events for an aggregate that is already in the transaction must follow
+	// its previous events.
+	Save(events []Event, originalVersion int) error
+}
+
+// TransactionalEventStore is an optional interface for event stores that can
+// save the events of many aggregates atomically, for example for commands
+// that create events for two aggregates that must be saved together.
+type TransactionalEventStore interface {
+	// SaveInTransaction calls the function with a transaction and saves the
+	// events of all aggregates saved in it if the function returns without an
+	// error. Either all events are saved, or none of them and
+	// ErrIncorrectEventVersion is returned if any aggregate was at another
+	// version than its original version. No events are saved if the function
+	// returns an error, which is returned.
+	SaveInTransaction(ctx context.Context, fn func(tx EventStoreTx) error) error
+}
+
+// BatchTransaction implements SaveInTransaction for event stores that can save
+// batches atomically, by saving the events of the transaction as one batch.
+func BatchTransaction(ctx context.Context, saver EventStoreBatchSaver, fn func(tx EventStoreTx) error) error {
+	tx := &batchTx{
+		events:           map[UUID][]Event{},
+		expectedVersions: map[UUID]int{},
+	}
+	if err := fn(tx); err != nil {
+		return err
+	}
+	if len(tx.events) == 0 {
+		return nil
+	}
+
+	return saver.SaveBatch(ctx, tx.events, tx.expectedVersions)
+}
+
+// batchTx is a transaction that collects the events of a batch.
+type batchTx struct {
+	events           map[UUID][]Event
+	expectedVersions map[UUID]int
+}
+
+// Save implements the Save method of the EventStoreTx interface.
+func (tx *batchTx) Save(events []Event, originalVersion int) error {
+	if len(events) == 0 {
+		return ErrNoEventsToAppend
+	}
+
+	id := events[0].AggregateID()
+	if saved, ok := tx.events[id]; ok {
+		if originalVersion != tx.expectedVersions[id]+len(saved) {
+			return ErrIncorrectEventVersion
+		}
+		tx.events[id] = append(saved, events...)
+		return nil
+	}
+
+	tx.events[id] = append([]Event{}, events...)
+	tx.expectedVersions[id] = originalVersion
+
+	return nil
+}
+
+// EventStreamer is an optional interface for event stores that can replay all
+// events, across all aggregates, for example to build new read models.
+type EventStreamer interface {
+	// ReplayAll streams all events in the namespace of the context, ordered by
+	// timestamp. The event channel is closed when all events have been sent,
+	// or when the context is done. An error is sent on the error channel, which
+	// is closed after the event channel.
+	ReplayAll(context.Context) (<-chan Event, <-chan error)
+}
+
+// ReplayFilter selects the events to replay with a FilteredEventStreamer. The
+// zero value matches all events.
+type ReplayFilter struct {
+	// AggregateType matches only the events of the aggregate type, if set.
+	// Events saved with an alias of the type also match.
+	AggregateType AggregateType
+	// EventTypes matches only the events of the types, if set.
+	EventTypes []EventType
+	// From matches only the events with a timestamp at or after it, if set.
+	From time.Time
+	// To matches only the events with a timestamp before it, if set.
+	To time.Time
+	// AfterPosition matches only the events with a global position after it,
+	// if set, for example to resume from the last event that was handled.
+	// Events without a global position, see PositionedEvent, never match. As
+	// events saved concurrently can become visible out of position order,
+	// consumers that resume should use a position a window behind the last
+	// handled event, and handle the events in the window again idempotently.
+	AfterPosition int64
+}
+
+// Match returns true if the event is selected by the filter.
+func (f ReplayFilter) Match(event Event) bool {
+	if f.AggregateType != AggregateType("") &&
+		ResolveAggregateType(event.AggregateType()) != f.AggregateType {
+		return false
+	}
+	if len(f.EventTypes) > 0 {
+		found := false
+		for _, eventType := range f.EventTypes {
+			if event.EventType() == eventType {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	if !f.From.IsZero() && event.Timestamp().Before(f.From) {
+		return false
+	}
+	if !f.To.IsZero() && !event.Timestamp().Before(f.To) {
+		return false
+	}
+	if f.AfterPosition > 0 {
+		positioned, ok := event.(PositionedEvent)
+		if !ok || positioned.GlobalPosition() <= f.AfterPosition {
+			return false
+		}
+	}
+	return true
+}
+
+// PositionedEvent is an event loaded from an event store that assigns a global
+// position to the events when they are saved, for example for consumers that
+// track their progress across all aggregates.
+type PositionedEvent interface {
+	Event
+
+	// GlobalPosition returns the position of the event among all events in
+	// the namespace. Positions are strictly increasing for events saved after
+	// each other, but can have gaps. Events saved concurrently may become
+	// visible out of position order.
+	GlobalPosition() int64
+}
+
+// FilteredEventStreamer is an optional interface for event stores that can
+// replay the events matching a filter, for example to rebuild a projection
+// that only uses some of the events. The store can apply the filter in the DB
+// instead of sending all events.
+type FilteredEventStreamer interface {
+	// Replay streams the events matching the filter in the namespace of the
+	// context, ordered by timestamp. The channels work the same way as for
+	// EventStreamer.ReplayAll.
+	Replay(ctx context.Context, filter ReplayFilter) (<-chan Event, <-chan error)
+}
+
+// HeadPositioner is an optional interface for event stores that assign global
+// positions, to find the position of the last saved event without replaying
+// the events.
+type HeadPositioner interface {
+	// HeadPosition returns the global position of the last saved event in the
+	// namespace of the context, or 0 if there are no events.
+	HeadPosition(ctx context.Context) (int64, error)
+}
+
+// OutboxEntry is a saved event in the outbox of an event store, that has not
+// been published yet.
+type OutboxEntry struct {
+	// ID is the ID of the entry, used to mark it as published.
+	ID string
+	// Event is the saved event.
+	Event Event
+}
+
+// EventStoreOutbox is an optional interface for event stores that record the
+// saved events in an outbox in the same write as the events, so that the
+// events can be published by a relay also if the process saving them exits
+// before publishing them. The outbox of the namespace of the context is used.
+type EventStoreOutbox interface {
+	// ClaimOutbox claims up to limit entries that are not published, in the
+	// order that they were saved. Claimed entries are not claimed again until
+	// the lease has expired, to let many relays share the outbox.
+	ClaimOutbox(ctx context.Context, limit int, lease time.Duration) ([]OutboxEntry, error)
+
+	// MarkPublished removes the entries with the IDs from the outbox.
+	MarkPublished(ctx context.Context, ids []string) error
+}
+
+// SnapshotStore is an optional interface for event stores that can save and
+// load snapshots of aggregates, used to avoid loading long event streams.
+type SnapshotStore interface {
+	// SaveSnapshot saves a snapshot of the aggregate state at a version.
+	SaveSnapshot(ctx context.Context, aggregateType AggregateType, id UUID, version int, state interface{}) error
+
+	// LoadSnapshot loads the latest snapshot for the aggregate id, returning
+	// the state and the version it was taken at. The state is nil if there is
+	// no snapshot.
+	LoadSnapshot(context.Context, AggregateType, UUID) (interface{}, int, error)
+}
+
+// HealthChecker is an optional interface for event stores, and other backends,
+// that can check that they are reachable, for example for the readiness probe
+// of a service.
+type HealthChecker interface {
+	// HealthCheck returns an error if the backend could not be reached before
+	// the context is done.
+	HealthCheck(ctx context.Context) error
 }
@@ -0,0 +1,54 @@
+// Copyright (c) 2016 - Max Ekman <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package codec contains codecs that event stores can use to marshal the
+// event data, and codecs that event buses can use to marshal whole events.
+// The protobuf codec is in the proto subpackage.
+package codec
+
+import (
+	"encoding/json"
+
+	eh "github.com/looplab/eventhorizon"
+)
+
+// Codec is a codec for marshaling and unmarshaling event data.
+type Codec interface {
+	// Name returns the name of the format, which event stores save with the
+	// marshaled data to detect data marshaled with another codec.
+	Name() string
+	// Marshal marshals the event data.
+	Marshal(eh.EventData) ([]byte, error)
+	// Unmarshal unmarshals the event data into a concrete type, as created
+	// by eventhorizon.CreateEventData.
+	Unmarshal([]byte, eh.EventData) error
+}
+
+// JSONCodec is a codec that marshals event data as JSON.
+type JSONCodec struct{}
+
+// Name implements the Name method of the Codec interface.
+func (JSONCodec) Name() string {
+	return "json"
+}
+
+// Marshal implements the Marshal method of the Codec interface.
+func (JSONCodec) Marshal(data eh.EventData) ([]byte, error) {
+	return json.Marshal(data)
+}
+
+// Unmarshal implements the Unmarshal method of the Codec interface.
+func (JSONCodec) Unmarshal(b []byte, data eh.EventData) error {
+	return json.Unmarshal(b, data)
+}
@@ -0,0 +1,50 @@
+// Copyright (c) 2016 - Max Ekman <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package codec
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	eh "github.com/looplab/eventhorizon"
+	"github.com/looplab/eventhorizon/mocks"
+)
+
+func TestJSONCodec(t *testing.T) {
+	c := JSONCodec{}
+	if c.Name() != "json" {
+		t.Error("the name should be correct:", c.Name())
+	}
+
+	original := &mocks.EventData{"event1"}
+	b, err := c.Marshal(original)
+	if err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	expected, _ := json.Marshal(original)
+	if !bytes.Equal(b, expected) {
+		t.Error("the data should be JSON:", string(b))
+	}
+
+	data, _ := eh.CreateEventData(mocks.EventType)
+	if err := c.Unmarshal(b, data); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	if !reflect.DeepEqual(data, original) {
+		t.Error("the data should be correct:", data)
+	}
+}
@@ -0,0 +1,260 @@
+// Copyright (c) 2016 - Max Ekman <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package codec
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"gopkg.in/mgo.v2/bson"
+
+	eh "github.com/looplab/eventhorizon"
+)
+
+// ErrCouldNotMarshalEvent is when an event could not be marshaled.
+var ErrCouldNotMarshalEvent = errors.New("could not marshal event")
+
+// ErrCouldNotUnmarshalEvent is when an event could not be unmarshaled into a
+// concrete type, for example when it was marshaled with another codec.
+var ErrCouldNotUnmarshalEvent = errors.New("could not unmarshal event")
+
+// JSONEventCodec is an event codec that marshals events as JSON, with the
+// event data as a JSON document. It is used by the Kafka and NATS event
+// buses by default.
+type JSONEventCodec struct{}
+
+// MarshalEvent implements the MarshalEvent method of the
+// eventhorizon.EventCodec interface.
+func (JSONEventCodec) MarshalEvent(ctx context.Context, event eh.Event) ([]byte, error) {
+	// Downcast the event data to the version to publish.
+	eventData, metadata, err := eh.EncodeEventData(event)
+	if err != nil {
+		return nil, ErrCouldNotMarshalEvent
+	}
+
+	jsonEvent := jsonEvent{
+		AggregateID:   event.AggregateID(),
+		AggregateType: event.AggregateType(),
+		EventType:     event.EventType(),
+		Version:       event.Version(),
+		Metadata:      metadata,
+		Timestamp:     event.Timestamp(),
+		Context:       eh.MarshalContext(ctx),
+	}
+
+	// Marshal event data if there is any.
+	if eventData != nil {
+		rawData, err := json.Marshal(eventData)
+		if err != nil {
+			return nil, ErrCouldNotMarshalEvent
+		}
+		jsonEvent.RawData = rawData
+	}
+
+	data, err := json.Marshal(jsonEvent)
+	if err != nil {
+		return nil, ErrCouldNotMarshalEvent
+	}
+
+	return data, nil
+}
+
+// UnmarshalEvent implements the UnmarshalEvent method of the
+// eventhorizon.EventCodec interface.
+func (JSONEventCodec) UnmarshalEvent(b []byte) (context.Context, eh.Event, error) {
+	var jsonEvent jsonEvent
+	if err := json.Unmarshal(b, &jsonEvent); err != nil {
+		return nil, nil, ErrCouldNotUnmarshalEvent
+	}
+
+	e := event{
+		eventType:     jsonEvent.EventType,
+		timestamp:     jsonEvent.Timestamp,
+		aggregateType: jsonEvent.AggregateType,
+		aggregateID:   jsonEvent.AggregateID,
+		version:       jsonEvent.Version,
+		metadata:      jsonEvent.Metadata,
+	}
+
+	// Create an event of the correct type, upcasted to the current version.
+	if jsonEvent.RawData != nil {
+		data, metadata, err := eh.DecodeEventData(jsonEvent.EventType, jsonEvent.Metadata, func(data eh.EventData) error {
+			return json.Unmarshal(jsonEvent.RawData, data)
+		})
+		if err != nil && err != eh.ErrEventDataNotRegistered {
+			return nil, nil, ErrCouldNotUnmarshalEvent
+		}
+		if err == nil {
+			e.data = data
+			e.metadata = metadata
+		}
+	}
+
+	return eh.UnmarshalContext(jsonEvent.Context), e, nil
+}
+
+// jsonEvent is the event marshaled by the JSONEventCodec.
+type jsonEvent struct {
+	EventType     eh.EventType           `json:"event_type"`
+	RawData       json.RawMessage        `json:"data,omitempty"`
+	Timestamp     time.Time              `json:"timestamp"`
+	AggregateType eh.AggregateType       `json:"aggregate_type"`
+	AggregateID   eh.UUID                `json:"id"`
+	Version       int                    `json:"version"`
+	Metadata      map[string]interface{} `json:"metadata,omitempty"`
+	Context       map[string]interface{} `json:"context"`
+}
+
+// BSONEventCodec is an event codec that marshals events as BSON, with the
+// event data as a BSON document. It is used by the Redis event bus by default.
+type BSONEventCodec struct{}
+
+// MarshalEvent implements the MarshalEvent method of the
+// eventhorizon.EventCodec interface.
+func (BSONEventCodec) MarshalEvent(ctx context.Context, event eh.Event) ([]byte, error) {
+	// Downcast the event data to the version to publish.
+	eventData, metadata, err := eh.EncodeEventData(event)
+	if err != nil {
+		return nil, ErrCouldNotMarshalEvent
+	}
+
+	bsonEvent := bsonEvent{
+		AggregateID:   event.AggregateID(),
+		AggregateType: event.AggregateType(),
+		EventType:     event.EventType(),
+		Version:       event.Version(),
+		Metadata:      metadata,
+		Timestamp:     event.Timestamp(),
+		Context:       eh.MarshalContext(ctx),
+	}
+
+	// Marshal event data if there is any.
+	if eventData != nil {
+		rawData, err := bson.Marshal(eventData)
+		if err != nil {
+			return nil, ErrCouldNotMarshalEvent
+		}
+		bsonEvent.RawData = bson.Raw{Kind: 3, Data: rawData}
+	}
+
+	data, err := bson.Marshal(bsonEvent)
+	if err != nil {
+		return nil, ErrCouldNotMarshalEvent
+	}
+
+	return data, nil
+}
+
+// UnmarshalEvent implements the UnmarshalEvent method of the
+// eventhorizon.EventCodec interface.
+func (BSONEventCodec) UnmarshalEvent(b []byte) (context.Context, eh.Event, error) {
+	// Manually decode the raw BSON event.
+	var bsonEvent bsonEvent
+	if err := (bson.Raw{Kind: 3, Data: b}).Unmarshal(&bsonEvent); err != nil {
+		return nil, nil, ErrCouldNotUnmarshalEvent
+	}
+
+	e := event{
+		eventType:     bsonEvent.EventType,
+		timestamp:     bsonEvent.Timestamp,
+		aggregateType: bsonEvent.AggregateType,
+		aggregateID:   bsonEvent.AggregateID,
+		version:       bsonEvent.Version,
+		metadata:      bsonEvent.Metadata,
+	}
+
+	// Create an event of the correct type, upcasted to the current version.
+	if bsonEvent.RawData.Kind != 0 {
+		data, metadata, err := eh.DecodeEventData(bsonEvent.EventType, bsonEvent.Metadata, func(data eh.EventData) error {
+			return bsonEvent.RawData.Unmarshal(data)
+		})
+		if err != nil && err != eh.ErrEventDataNotRegistered {
+			return nil, nil, ErrCouldNotUnmarshalEvent
+		}
+		if err == nil {
+			e.data = data
+			e.metadata = metadata
+		}
+	}
+
+	return eh.UnmarshalContext(bsonEvent.Context), e, nil
+}
+
+// bsonEvent is the event marshaled by the BSONEventCodec.
+type bsonEvent struct {
+	EventType     eh.EventType           `bson:"event_type"`
+	RawData       bson.Raw               `bson:"data,omitempty"`
+	Timestamp     time.Time              `bson:"timestamp"`
+	AggregateType eh.AggregateType       `bson:"aggregate_type"`
+	AggregateID   eh.UUID                `bson:"_id"`
+	Version       int                    `bson:"version"`
+	Metadata      map[string]interface{} `bson:"metadata,omitempty"`
+	Context       map[string]interface{} `bson:"context"`
+}
+
+// event is the private implementation of the eventhorizon.Event interface
+// for events unmarshaled by the codecs.
+type event struct {
+	eventType     eh.EventType
+	data          eh.EventData
+	timestamp     time.Time
+	aggregateType eh.AggregateType
+	aggregateID   eh.UUID
+	version       int
+	metadata      map[string]interface{}
+}
+
+// EventType implements the EventType method of the eventhorizon.Event interface.
+func (e event) EventType() eh.EventType {
+	return e.eventType
+}
+
+// Data implements the Data method of the eventhorizon.Event interface.
+func (e event) Data() eh.EventData {
+	return e.data
+}
+
+// Timestamp implements the Timestamp method of the eventhorizon.Event interface.
+func (e event) Timestamp() time.Time {
+	return e.timestamp
+}
+
+// AggregateType implements the AggregateType method of the eventhorizon.Event interface.
+func (e event) AggregateType() eh.AggregateType {
+	return e.aggregateType
+}
+
+// AggregateID implements the AggregateID method of the eventhorizon.Event interface.
+func (e event) AggregateID() eh.UUID {
+	return e.aggregateID
+}
+
+// Version implements the Version method of the eventhorizon.Event interface.
+func (e event) Version() int {
+	return e.version
+}
+
+// Metadata implements the Metadata method of the eventhorizon.Event interface.
+func (e event) Metadata() map[string]interface{} {
+	return e.metadata
+}
+
+// String implements the String method of the eventhorizon.Event interface.
+func (e event) String() string {
+	return fmt.Sprintf("%s@%d", e.eventType, e.version)
+}
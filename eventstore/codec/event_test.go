@@ -0,0 +1,103 @@
+// Copyright (c) 2016 - Max Ekman <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package codec
+
+import (
+	"context"
+	"testing"
+
+	eh "github.com/looplab/eventhorizon"
+	"github.com/looplab/eventhorizon/mocks"
+)
+
+func TestEventCodecs(t *testing.T) {
+	codecs := map[string]eh.EventCodec{
+		"json": JSONEventCodec{},
+		"bson": BSONEventCodec{},
+	}
+	for name, c := range codecs {
+		t.Run(name, func(t *testing.T) {
+			ctx := eh.WithNamespace(context.Background(), "ns")
+			id := eh.NewUUID()
+			agg := mocks.NewAggregate(id)
+			event1 := agg.NewEvent(mocks.EventType, &mocks.EventData{"event1"},
+				eh.WithMetadata(map[string]interface{}{"num": "1"}),
+			)
+			agg.ApplyEvent(ctx, event1)
+
+			t.Log("round-trip an event")
+			b, err := c.MarshalEvent(ctx, event1)
+			if err != nil {
+				t.Fatal("there should be no error:", err)
+			}
+			ctx2, event2, err := c.UnmarshalEvent(b)
+			if err != nil {
+				t.Fatal("there should be no error:", err)
+			}
+			if err := mocks.CompareEvents(event2, event1); err != nil {
+				t.Error("the event was incorrect:", err)
+			}
+			if event2.AggregateID() != id || event2.Version() != 1 {
+				t.Error("the event aggregate ID and version should be correct:", event2)
+			}
+			if !event2.Timestamp().Equal(event1.Timestamp()) {
+				t.Error("the timestamp should be correct:", event2.Timestamp())
+			}
+			if eh.Namespace(ctx2) != "ns" {
+				t.Error("the context should be correct:", ctx2)
+			}
+			if event2.String() != "Event@1" {
+				t.Error("the string representation should be correct:", event2.String())
+			}
+
+			t.Log("round-trip an event without data")
+			event3 := agg.NewEvent(mocks.EventOtherType, nil)
+			if b, err = c.MarshalEvent(ctx, event3); err != nil {
+				t.Fatal("there should be no error:", err)
+			}
+			if _, event2, err = c.UnmarshalEvent(b); err != nil {
+				t.Fatal("there should be no error:", err)
+			}
+			if err := mocks.CompareEvents(event2, event3); err != nil {
+				t.Error("the event was incorrect:", err)
+			}
+
+			t.Log("unmarshal invalid event")
+			if _, _, err := c.UnmarshalEvent([]byte("invalid")); err != ErrCouldNotUnmarshalEvent {
+				t.Error("there should be a ErrCouldNotUnmarshalEvent error:", err)
+			}
+
+			t.Log("unmarshal events marshaled with the other codecs")
+			for otherName, other := range codecs {
+				if otherName == name {
+					continue
+				}
+				b, err := other.MarshalEvent(ctx, event1)
+				if err != nil {
+					t.Fatal("there should be no error:", err)
+				}
+				if _, _, err := c.UnmarshalEvent(b); err != ErrCouldNotUnmarshalEvent {
+					t.Error("there should be a ErrCouldNotUnmarshalEvent error:", otherName, err)
+				}
+			}
+
+			t.Log("marshal invalid event data")
+			event4 := agg.NewEvent(mocks.EventType, func() {})
+			if _, err := c.MarshalEvent(ctx, event4); err != ErrCouldNotMarshalEvent {
+				t.Error("there should be a ErrCouldNotMarshalEvent error:", err)
+			}
+		})
+	}
+}
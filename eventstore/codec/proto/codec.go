@@ -0,0 +1,53 @@
+// Copyright (c) 2016 - Max Ekman <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package proto contains a codec that event stores can use to marshal the
+// event data as protobuf, in its own package to keep the protobuf dependency
+// out of the other codecs.
+package proto
+
+import (
+	"encoding/json"
+
+	"google.golang.org/protobuf/proto"
+
+	eh "github.com/looplab/eventhorizon"
+)
+
+// Codec is a codec that marshals event data using protobuf when the event
+// data implements proto.Message, as generated by protoc-gen-go, and as JSON
+// otherwise. As the format is decided by the type, the same event data type
+// must be registered when unmarshaling.
+type Codec struct{}
+
+// Name implements the Name method of the codec.Codec interface.
+func (Codec) Name() string {
+	return "proto"
+}
+
+// Marshal implements the Marshal method of the codec.Codec interface.
+func (Codec) Marshal(data eh.EventData) ([]byte, error) {
+	if msg, ok := data.(proto.Message); ok {
+		return proto.Marshal(msg)
+	}
+	return json.Marshal(data)
+}
+
+// Unmarshal implements the Unmarshal method of the codec.Codec interface.
+func (Codec) Unmarshal(b []byte, data eh.EventData) error {
+	if msg, ok := data.(proto.Message); ok {
+		return proto.Unmarshal(b, msg)
+	}
+	return json.Unmarshal(b, data)
+}
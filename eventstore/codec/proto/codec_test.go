@@ -0,0 +1,86 @@
+// Copyright (c) 2016 - Max Ekman <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package proto
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+
+	eh "github.com/looplab/eventhorizon"
+	"github.com/looplab/eventhorizon/mocks"
+)
+
+func init() {
+	eh.RegisterEventData(ProtoEventType, func() eh.EventData { return &wrapperspb.StringValue{} })
+}
+
+func TestCodec(t *testing.T) {
+	c := Codec{}
+	if c.Name() != "proto" {
+		t.Error("the name should be correct:", c.Name())
+	}
+
+	t.Log("round-trip proto event data")
+	original := wrapperspb.String("event1")
+	b, err := c.Marshal(original)
+	if err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	expected, _ := proto.Marshal(original)
+	if !bytes.Equal(b, expected) {
+		t.Error("the data should be protobuf:", b)
+	}
+	data, _ := eh.CreateEventData(ProtoEventType)
+	if err := c.Unmarshal(b, data); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	if !proto.Equal(data.(proto.Message), original) {
+		t.Error("the data should be correct:", data)
+	}
+	b2, err := c.Marshal(data)
+	if err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	if !bytes.Equal(b, b2) {
+		t.Error("the data should be byte-identical:", b, b2)
+	}
+
+	t.Log("round-trip other event data")
+	otherOriginal := &mocks.EventData{"event2"}
+	b, err = c.Marshal(otherOriginal)
+	if err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	expected, _ = json.Marshal(otherOriginal)
+	if !bytes.Equal(b, expected) {
+		t.Error("the data should be JSON:", string(b))
+	}
+	data, _ = eh.CreateEventData(mocks.EventType)
+	if err := c.Unmarshal(b, data); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	if !reflect.DeepEqual(data, otherOriginal) {
+		t.Error("the data should be correct:", data)
+	}
+}
+
+// ProtoEventType is the event type for the protobuf event data, a generated
+// message of the well-known types.
+const ProtoEventType eh.EventType = "ProtoEvent"
@@ -19,6 +19,7 @@ import (
 	"errors"
 	"fmt"
 	"reflect"
+	"sort"
 	"time"
 
 	"github.com/aws/aws-sdk-go/aws"
@@ -45,6 +46,10 @@ var ErrCouldNotLoadAggregate = errors.New("could not load aggregate")
 // ErrCouldNotSaveAggregate is when an aggregate could not be saved.
 var ErrCouldNotSaveAggregate = errors.New("could not save aggregate")
 
+// aggregateTypeIndex is the name of the global secondary index on aggregate
+// type and timestamp.
+const aggregateTypeIndex = "AggregateTypeTimestamp"
+
 // EventStoreConfig is a config for the DynamoDB event store.
 type EventStoreConfig struct {
 	TablePrefix string
@@ -61,7 +66,9 @@ func (c *EventStoreConfig) provideDefaults() {
 	}
 }
 
-// EventStore implements an EventStore for MongoDB.
+// EventStore implements an EventStore for DynamoDB. Events are stored with the
+// aggregate ID as partition key and the version as sort key, which makes saves
+// of already taken versions fail with ErrIncorrectEventVersion.
 type EventStore struct {
 	service *dynamodb.DynamoDB
 	config  *EventStoreConfig
@@ -95,10 +102,17 @@ func (s *EventStore) Save(ctx context.Context, events []eh.Event, originalVersio
 	}
 
 	// Build all event records, with incrementing versions starting from the
-	// original aggregate version.
+	// original aggregate version. Events saved with any version only need
+	// consecutive versions, they are renumbered after the current version.
 	dbEvents := make([]dbEvent, len(events))
 	aggregateID := events[0].AggregateID()
 	version := originalVersion
+	switch originalVersion {
+	case eh.ExpectedVersionAny:
+		version = events[0].Version() - 1
+	case eh.ExpectedVersionNoStream:
+		version = 0
+	}
 	for i, event := range events {
 		// Only accept events belonging to the same aggregate.
 		if event.AggregateID() != aggregateID {
@@ -119,10 +133,12 @@ func (s *EventStore) Save(ctx context.Context, events []eh.Event, originalVersio
 		// Create the event record with current version and timestamp.
 		dbEvents[i] = dbEvent{
 			EventType:     event.EventType(),
-			Timestamp:     event.Timestamp(),
+			DataVersion:   eh.EventDataVersion(event.EventType()),
+			Timestamp:     event.Timestamp().UnixNano(),
 			AggregateType: event.AggregateType(),
 			AggregateID:   event.AggregateID().String(),
 			Version:       event.Version(),
+			Metadata:      event.Metadata(),
 		}
 
 		// Marshal event data if there is any.
@@ -140,44 +156,157 @@ func (s *EventStore) Save(ctx context.Context, events []eh.Event, originalVersio
 		version++
 	}
 
-	// TODO: Implement atomic version counter for the aggregate.
-	// TODO: Batch write all events.
-	for _, dbEvent := range dbEvents {
-		// Marshal and store the event record.
-		item, err := dynamodbattribute.MarshalMap(dbEvent)
+	if originalVersion == eh.ExpectedVersionAny {
+		currentVersion, err := s.currentVersion(ctx, aggregateID)
+		if err != nil {
+			return err
+		}
+		for i := range dbEvents {
+			dbEvents[i].Version = currentVersion + i + 1
+		}
+	}
+
+	// The first version is already taken if the aggregate exists.
+	conflictErr := eh.ErrIncorrectEventVersion
+	if originalVersion == eh.ExpectedVersionNoStream {
+		conflictErr = eh.ErrStreamAlreadyExists
+	}
+
+	// Store a single event with a conditional write, and multiple events in a
+	// transaction to append them atomically. Both fail if any of the
+	// versions are already taken by another save.
+	if len(dbEvents) == 1 {
+		item, err := dynamodbattribute.MarshalMap(dbEvents[0])
 		if err != nil {
-			// TODO: Support translating not found to not be an error but an
-			// empty list.
 			return eh.EventStoreError{
-				Err:       err,
+				Err:       ErrCouldNotMarshalEvent,
+				BaseErr:   err,
 				Namespace: eh.Namespace(ctx),
 			}
 		}
 		putParams := &dynamodb.PutItemInput{
 			TableName:           aws.String(s.tableName(ctx)),
-			ConditionExpression: aws.String("attribute_not_exists(AggregateID) AND attribute_not_exists(Version)"),
+			ConditionExpression: aws.String("attribute_not_exists(AggregateID)"),
 			Item:                item,
 		}
 		if _, err = s.service.PutItem(putParams); err != nil {
-			if err, ok := err.(awserr.RequestFailure); ok && err.Code() == "ConditionalCheckFailedException" {
-				return eh.EventStoreError{
-					Err:       ErrCouldNotSaveAggregate,
-					Namespace: eh.Namespace(ctx),
-				}
+			if err, ok := err.(awserr.RequestFailure); ok && err.Code() == dynamodb.ErrCodeConditionalCheckFailedException {
+				return s.conflictError(ctx, conflictErr, aggregateID, dbEvents[0].Version-1)
 			}
 			return eh.EventStoreError{
-				Err:       err,
+				Err:       ErrCouldNotSaveAggregate,
+				BaseErr:   err,
+				Namespace: eh.Namespace(ctx),
+			}
+		}
+
+		return nil
+	}
+
+	items := make([]*dynamodb.TransactWriteItem, len(dbEvents))
+	for i, dbEvent := range dbEvents {
+		item, err := dynamodbattribute.MarshalMap(dbEvent)
+		if err != nil {
+			return eh.EventStoreError{
+				Err:       ErrCouldNotMarshalEvent,
+				BaseErr:   err,
 				Namespace: eh.Namespace(ctx),
 			}
 		}
+		items[i] = &dynamodb.TransactWriteItem{
+			Put: &dynamodb.Put{
+				TableName:           aws.String(s.tableName(ctx)),
+				ConditionExpression: aws.String("attribute_not_exists(AggregateID)"),
+				Item:                item,
+			},
+		}
+	}
+	transactParams := &dynamodb.TransactWriteItemsInput{
+		TransactItems: items,
+	}
+	if _, err := s.service.TransactWriteItems(transactParams); err != nil {
+		if err, ok := err.(*dynamodb.TransactionCanceledException); ok {
+			for _, reason := range err.CancellationReasons {
+				if aws.StringValue(reason.Code) == "ConditionalCheckFailed" {
+					return s.conflictError(ctx, conflictErr, aggregateID, dbEvents[0].Version-1)
+				}
+			}
+		}
+		return eh.EventStoreError{
+			Err:       ErrCouldNotSaveAggregate,
+			BaseErr:   err,
+			Namespace: eh.Namespace(ctx),
+		}
 	}
 
 	return nil
 }
 
+// conflictError creates the error for a save that conflicted with the
+// aggregate in the store, with the expected and actual version of the
+// aggregate for ErrIncorrectEventVersion.
+func (s *EventStore) conflictError(ctx context.Context, conflictErr error, id eh.UUID, expectedVersion int) error {
+	if conflictErr != eh.ErrIncorrectEventVersion {
+		return eh.EventStoreError{
+			Err:       conflictErr,
+			Namespace: eh.Namespace(ctx),
+		}
+	}
+
+	actualVersion, err := s.currentVersion(ctx, id)
+	if err != nil {
+		return err
+	}
+	return eh.EventStoreError{
+		Err:             conflictErr,
+		Namespace:       eh.Namespace(ctx),
+		ExpectedVersion: expectedVersion,
+		ActualVersion:   actualVersion,
+	}
+}
+
+// currentVersion returns the latest version of an aggregate, or 0 if it has no
+// events.
+func (s *EventStore) currentVersion(ctx context.Context, id eh.UUID) (int, error) {
+	params := &dynamodb.QueryInput{
+		TableName:              aws.String(s.tableName(ctx)),
+		KeyConditionExpression: aws.String("AggregateID = :id"),
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+			":id": {S: aws.String(id.String())},
+		},
+		ProjectionExpression: aws.String("Version"),
+		ScanIndexForward:     aws.Bool(false),
+		Limit:                aws.Int64(1),
+		ConsistentRead:       aws.Bool(true),
+	}
+	resp, err := s.service.Query(params)
+	if err != nil {
+		return 0, eh.EventStoreError{
+			Err:       ErrCouldNotSaveAggregate,
+			BaseErr:   err,
+			Namespace: eh.Namespace(ctx),
+		}
+	}
+	if len(resp.Items) == 0 {
+		return 0, nil
+	}
+
+	var e dbEvent
+	if err := dynamodbattribute.UnmarshalMap(resp.Items[0], &e); err != nil {
+		return 0, eh.EventStoreError{
+			Err:       ErrCouldNotUnmarshalEvent,
+			BaseErr:   err,
+			Namespace: eh.Namespace(ctx),
+		}
+	}
+
+	return e.Version, nil
+}
+
 // Load loads all events for the aggregate id from the database.
-// Returns ErrNoEventsFound if no events can be found.
-func (s *EventStore) Load(ctx context.Context, aggregateType eh.AggregateType, id eh.UUID) ([]eh.Event, error) {
+// Returns ErrNoEventsFound if no events can be found. The query is limited if
+// loaded with a max number of events.
+func (s *EventStore) Load(ctx context.Context, aggregateType eh.AggregateType, id eh.UUID, opts ...eh.LoadOption) ([]eh.Event, error) {
 	params := &dynamodb.QueryInput{
 		TableName:              aws.String(s.tableName(ctx)),
 		KeyConditionExpression: aws.String("AggregateID = :id"),
@@ -186,60 +315,211 @@ func (s *EventStore) Load(ctx context.Context, aggregateType eh.AggregateType, i
 		},
 		ConsistentRead: aws.Bool(true),
 	}
-	resp, err := s.service.Query(params)
+	max := eh.NewLoadOptions(opts...).MaxEvents
+	if max > 0 {
+		params.Limit = aws.Int64(int64(max))
+	}
+
+	// Events are sorted by version, the range key.
+	events := []eh.Event{}
+	var buildErr error
+	err := s.service.QueryPages(params, func(resp *dynamodb.QueryOutput, lastPage bool) bool {
+		for _, item := range resp.Items {
+			event, err := s.buildEvent(ctx, item)
+			if err != nil {
+				buildErr = err
+				return false
+			}
+			events = append(events, event)
+			if max > 0 && len(events) == max {
+				return false
+			}
+		}
+		return true
+	})
+	if buildErr != nil {
+		return nil, buildErr
+	}
 	if err != nil {
 		return nil, eh.EventStoreError{
-			Err:       err,
+			Err:       ErrCouldNotLoadAggregate,
+			BaseErr:   err,
 			Namespace: eh.Namespace(ctx),
 		}
 	}
 
-	if len(resp.Items) == 0 {
-		return []eh.Event{}, nil
-	}
+	return events, nil
+}
 
-	dbEvents := make([]dbEvent, len(resp.Items))
-	for i, item := range resp.Items {
-		dbEvent := dbEvent{}
-		if err := dynamodbattribute.UnmarshalMap(item, &dbEvent); err != nil {
-			return nil, eh.EventStoreError{
+// ReplayAll implements the ReplayAll method of the eventhorizon.EventStreamer
+// interface. DynamoDB has no order across partitions, so all events are
+// scanned and sorted before they are streamed. Use ReplayAggregateType to
+// stream the events of one aggregate type in order from the index.
+func (s *EventStore) ReplayAll(ctx context.Context) (<-chan eh.Event, <-chan error) {
+	events := make(chan eh.Event)
+	errs := make(chan error, 1)
+
+	go func() {
+		defer close(errs)
+		defer close(events)
+
+		params := &dynamodb.ScanInput{
+			TableName:      aws.String(s.tableName(ctx)),
+			ConsistentRead: aws.Bool(true),
+		}
+		all := []eh.Event{}
+		var buildErr error
+		err := s.service.ScanPages(params, func(resp *dynamodb.ScanOutput, lastPage bool) bool {
+			for _, item := range resp.Items {
+				event, err := s.buildEvent(ctx, item)
+				if err != nil {
+					buildErr = err
+					return false
+				}
+				all = append(all, event)
+			}
+			return ctx.Err() == nil
+		})
+		if buildErr != nil {
+			errs <- buildErr
+			return
+		}
+		if err != nil {
+			errs <- eh.EventStoreError{
 				Err:       err,
 				Namespace: eh.Namespace(ctx),
 			}
+			return
 		}
-		dbEvents[i] = dbEvent
-	}
 
-	events := make([]eh.Event, len(dbEvents))
-	for i, dbEvent := range dbEvents {
-		// The UUID is currently stored as a full text representation in the DB.
-		id, err := eh.ParseUUID(dbEvent.AggregateID)
+		sort.Slice(all, func(i, j int) bool {
+			if !all[i].Timestamp().Equal(all[j].Timestamp()) {
+				return all[i].Timestamp().Before(all[j].Timestamp())
+			}
+			if all[i].AggregateID() != all[j].AggregateID() {
+				return all[i].AggregateID() < all[j].AggregateID()
+			}
+			return all[i].Version() < all[j].Version()
+		})
+
+		for _, event := range all {
+			select {
+			case events <- event:
+			case <-ctx.Done():
+				errs <- ctx.Err()
+				return
+			}
+		}
+	}()
+
+	return events, errs
+}
+
+// ReplayAggregateType streams all events of an aggregate type in the namespace
+// of the context, ordered by timestamp, using the aggregate type index. The
+// channels work the same way as for ReplayAll. Events saved at the same time
+// are not ordered by version, as the index has no such order.
+func (s *EventStore) ReplayAggregateType(ctx context.Context, aggregateType eh.AggregateType) (<-chan eh.Event, <-chan error) {
+	events := make(chan eh.Event)
+	errs := make(chan error, 1)
+
+	go func() {
+		defer close(errs)
+		defer close(events)
+
+		params := &dynamodb.QueryInput{
+			TableName:              aws.String(s.tableName(ctx)),
+			IndexName:              aws.String(aggregateTypeIndex),
+			KeyConditionExpression: aws.String("AggregateType = :type"),
+			ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+				":type": {S: aws.String(string(aggregateType))},
+			},
+		}
+		var streamErr error
+		err := s.service.QueryPages(params, func(resp *dynamodb.QueryOutput, lastPage bool) bool {
+			for _, item := range resp.Items {
+				event, err := s.buildEvent(ctx, item)
+				if err != nil {
+					streamErr = err
+					return false
+				}
+
+				select {
+				case events <- event:
+				case <-ctx.Done():
+					streamErr = ctx.Err()
+					return false
+				}
+			}
+			return true
+		})
+		if streamErr != nil {
+			errs <- streamErr
+			return
+		}
 		if err != nil {
-			return nil, eh.EventStoreError{
+			errs <- eh.EventStoreError{
 				Err:       err,
 				Namespace: eh.Namespace(ctx),
 			}
 		}
-		dbEvent.AggregateID = string(id)
+	}()
 
-		// Create an event of the correct type.
-		if data, err := eh.CreateEventData(dbEvent.EventType); err == nil {
-			if err := dynamodbattribute.UnmarshalMap(dbEvent.RawData, data); err != nil {
-				return nil, eh.EventStoreError{
-					Err:       ErrCouldNotUnmarshalEvent,
-					Namespace: eh.Namespace(ctx),
-				}
+	return events, errs
+}
+
+// buildEvent creates an event from an item in the DB, with concrete event
+// data if the event type is registered.
+func (s *EventStore) buildEvent(ctx context.Context, item map[string]*dynamodb.AttributeValue) (eh.Event, error) {
+	dbEvent := dbEvent{}
+	if err := dynamodbattribute.UnmarshalMap(item, &dbEvent); err != nil {
+		return nil, eh.EventStoreError{
+			Err:       ErrCouldNotUnmarshalEvent,
+			BaseErr:   err,
+			Namespace: eh.Namespace(ctx),
+		}
+	}
+
+	// The UUID is currently stored as a full text representation in the DB.
+	id, err := eh.ParseUUID(dbEvent.AggregateID)
+	if err != nil {
+		return nil, eh.EventStoreError{
+			Err:       err,
+			Namespace: eh.Namespace(ctx),
+		}
+	}
+	dbEvent.AggregateID = string(id)
+
+	// Events saved before schema versions were stored are version 1.
+	if dbEvent.DataVersion == 0 {
+		dbEvent.DataVersion = 1
+	}
+
+	// Create an event of the correct type and version.
+	if data, err := eh.CreateVersionedEventData(dbEvent.EventType, dbEvent.DataVersion); err == nil {
+		if err := dynamodbattribute.UnmarshalMap(dbEvent.RawData, data); err != nil {
+			return nil, eh.EventStoreError{
+				Err:       ErrCouldNotUnmarshalEvent,
+				Namespace: eh.Namespace(ctx),
 			}
+		}
 
-			// Set conrcete event and zero out the decoded event.
-			dbEvent.data = data
-			dbEvent.RawData = nil
+		// Upcast the event data to the current version.
+		if data, err = eh.UpcastEventData(dbEvent.EventType, dbEvent.DataVersion, data); err != nil {
+			return nil, eh.EventStoreError{
+				Err:       ErrCouldNotUnmarshalEvent,
+				BaseErr:   err,
+				Namespace: eh.Namespace(ctx),
+			}
 		}
 
-		events[i] = event{dbEvent: dbEvent}
+		// Set conrcete event and zero out the decoded event.
+		dbEvent.data = data
+		dbEvent.DataVersion = eh.EventDataVersion(dbEvent.EventType)
+		dbEvent.RawData = nil
 	}
 
-	return events, nil
+	return event{dbEvent: dbEvent}, nil
 }
 
 // CreateTable creates the table if it is not allready existing and correct.
@@ -250,6 +530,12 @@ func (s *EventStore) CreateTable(ctx context.Context) error {
 	}, {
 		AttributeName: aws.String("Version"),
 		AttributeType: aws.String("N"),
+	}, {
+		AttributeName: aws.String("AggregateType"),
+		AttributeType: aws.String("S"),
+	}, {
+		AttributeName: aws.String("Timestamp"),
+		AttributeType: aws.String("N"),
 	}}
 
 	keySchema := []*dynamodb.KeySchemaElement{{
@@ -260,6 +546,15 @@ func (s *EventStore) CreateTable(ctx context.Context) error {
 		KeyType:       aws.String("RANGE"),
 	}}
 
+	// The index of all events by aggregate type and time, used for replays.
+	indexKeySchema := []*dynamodb.KeySchemaElement{{
+		AttributeName: aws.String("AggregateType"),
+		KeyType:       aws.String("HASH"),
+	}, {
+		AttributeName: aws.String("Timestamp"),
+		KeyType:       aws.String("RANGE"),
+	}}
+
 	describeParams := &dynamodb.DescribeTableInput{
 		TableName: aws.String(s.tableName(ctx)),
 	}
@@ -278,6 +573,16 @@ func (s *EventStore) CreateTable(ctx context.Context) error {
 		if !reflect.DeepEqual(resp.Table.KeySchema, keySchema) {
 			return errors.New("incorrect key schema")
 		}
+		hasIndex := false
+		for _, index := range resp.Table.GlobalSecondaryIndexes {
+			if aws.StringValue(index.IndexName) == aggregateTypeIndex &&
+				reflect.DeepEqual(index.KeySchema, indexKeySchema) {
+				hasIndex = true
+			}
+		}
+		if !hasIndex {
+			return errors.New("incorrect global secondary index")
+		}
 		// Table exists and is correct.
 		return nil
 	}
@@ -290,6 +595,17 @@ func (s *EventStore) CreateTable(ctx context.Context) error {
 			ReadCapacityUnits:  aws.Int64(1),
 			WriteCapacityUnits: aws.Int64(1),
 		},
+		GlobalSecondaryIndexes: []*dynamodb.GlobalSecondaryIndex{{
+			IndexName: aws.String(aggregateTypeIndex),
+			KeySchema: indexKeySchema,
+			Projection: &dynamodb.Projection{
+				ProjectionType: aws.String(dynamodb.ProjectionTypeAll),
+			},
+			ProvisionedThroughput: &dynamodb.ProvisionedThroughput{
+				ReadCapacityUnits:  aws.Int64(1),
+				WriteCapacityUnits: aws.Int64(1),
+			},
+		}},
 	}
 	if _, err := s.service.CreateTable(createParams); err != nil {
 		return err
@@ -333,27 +649,18 @@ func (s *EventStore) tableName(ctx context.Context) string {
 	return s.config.TablePrefix + "_" + ns
 }
 
-// aggregateRecord is the DB representation of an aggregate.
-// TODO: Implement as atomic counter.
-// NOTE: Currently not used.
-type aggregateRecord struct {
-	AggregateID string
-	Version     int
-	Events      []dbEvent
-	// AggregateType        string
-	// Snapshot    bson.Raw
-}
-
 // dbEvent is the internal event record for the DynamoDB event store used
 // to save and load events from the DB.
 type dbEvent struct {
 	EventType     eh.EventType
 	RawData       map[string]*dynamodb.AttributeValue
 	data          eh.EventData
-	Timestamp     time.Time
+	DataVersion   int
+	Timestamp     int64 // Unix nanoseconds, to be sortable in the index.
 	AggregateType eh.AggregateType
 	AggregateID   string
 	Version       int
+	Metadata      map[string]interface{}
 }
 
 // event is the private implementation of the eventhorizon.Event
@@ -374,7 +681,7 @@ func (e event) Data() eh.EventData {
 
 // Timestamp implements the Timestamp method of the eventhorizon.Event interface.
 func (e event) Timestamp() time.Time {
-	return e.dbEvent.Timestamp
+	return time.Unix(0, e.dbEvent.Timestamp)
 }
 
 // AggregateType implements the AggregateType method of the eventhorizon.Event interface.
@@ -392,6 +699,11 @@ func (e event) Version() int {
 	return e.dbEvent.Version
 }
 
+// Metadata implements the Metadata method of the eventhorizon.Event interface.
+func (e event) Metadata() map[string]interface{} {
+	return e.dbEvent.Metadata
+}
+
 // String implements the String method of the eventhorizon.Event interface.
 func (e event) String() string {
 	return fmt.Sprintf("%s@%d", e.dbEvent.EventType, e.dbEvent.Version)
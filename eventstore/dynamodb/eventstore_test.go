@@ -17,9 +17,11 @@ package dynamodb
 import (
 	"context"
 	"testing"
+	"time"
 
 	eh "github.com/looplab/eventhorizon"
 	"github.com/looplab/eventhorizon/eventstore/testutil"
+	"github.com/looplab/eventhorizon/mocks"
 )
 
 func DoTestEventStore(t *testing.T, url string) {
@@ -63,4 +65,43 @@ func DoTestEventStore(t *testing.T, url string) {
 
 	t.Log("event store with other namespace")
 	testutil.EventStoreCommonTests(t, ctx, store)
+
+	t.Log("event streamer with default namespace")
+	testutil.EventStreamerCommonTests(t, context.Background(), store)
+
+	t.Log("event streamer with other namespace")
+	testutil.EventStreamerCommonTests(t, ctx, store)
+
+	t.Log("expected versions with default namespace")
+	testutil.ExpectedVersionCommonTests(t, context.Background(), store)
+
+	t.Log("expected versions with other namespace")
+	testutil.ExpectedVersionCommonTests(t, ctx, store)
+
+	t.Log("loading with max events with default namespace")
+	testutil.MaxEventsCommonTests(t, context.Background(), store)
+
+	t.Log("loading with max events with other namespace")
+	testutil.MaxEventsCommonTests(t, ctx, store)
+
+	t.Log("replay events of one aggregate type")
+	events, errs := store.ReplayAggregateType(ctx, mocks.AggregateType)
+	var last time.Time
+	count := 0
+	for event := range events {
+		if event.AggregateType() != mocks.AggregateType {
+			t.Error("the event should have the correct aggregate type:", event)
+		}
+		if event.Timestamp().Before(last) {
+			t.Error("the events should be ordered by timestamp:", event)
+		}
+		last = event.Timestamp()
+		count++
+	}
+	if err := <-errs; err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if count == 0 {
+		t.Error("there should be events replayed")
+	}
 }
@@ -0,0 +1,470 @@
+// Copyright (c) 2016 - Max Ekman <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package encryption contains an event store that encrypts the event data.
+package encryption
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"io"
+	"strconv"
+	"sync"
+	"time"
+
+	eh "github.com/looplab/eventhorizon"
+)
+
+// ErrNoEventStoreDefined is if no event store has been defined.
+var ErrNoEventStoreDefined = errors.New("no event store defined")
+
+// ErrNoKeyProvider is if no key provider has been defined.
+var ErrNoKeyProvider = errors.New("no key provider defined")
+
+// ErrKeyNotFound is when a key could not be found by the key provider.
+var ErrKeyNotFound = errors.New("could not find key")
+
+// ErrInvalidKey is when a key is not a valid AES-128, AES-192 or AES-256 key.
+var ErrInvalidKey = errors.New("invalid key")
+
+// ErrCouldNotEncryptEvent is when the event data could not be encrypted.
+var ErrCouldNotEncryptEvent = errors.New("could not encrypt event")
+
+// ErrCouldNotDecryptEvent is when the event data could not be decrypted.
+var ErrCouldNotDecryptEvent = errors.New("could not decrypt event")
+
+// The metadata keys used for the encrypted event data and the id of the key
+// that it was encrypted with.
+const (
+	dataMetadataKey  = "encrypted_data"
+	keyIDMetadataKey = "encryption_key_id"
+)
+
+// KeyProvider provides the keys used to encrypt and decrypt event data.
+type KeyProvider interface {
+	// CurrentKey returns the id and the key to encrypt new events with.
+	CurrentKey(context.Context) (string, []byte, error)
+
+	// Key returns the key with an id, used to decrypt events. Returns
+	// ErrKeyNotFound if there is no key with the id.
+	Key(ctx context.Context, keyID string) ([]byte, error)
+}
+
+// EventStore wraps an EventStore and encrypts the event data with AES-GCM
+// before it is saved, and decrypts it when the events are loaded. The
+// aggregate ID, type and version of the events are kept in plaintext. The data
+// is stored in the event metadata, tagged with the id of the key, and the event
+// data types must be registered to be decrypted.
+type EventStore struct {
+	eventStore eh.EventStore
+	keys       KeyProvider
+}
+
+// NewEventStore creates a new EventStore.
+func NewEventStore(eventStore eh.EventStore, keys KeyProvider) (*EventStore, error) {
+	if eventStore == nil {
+		return nil, ErrNoEventStoreDefined
+	}
+	if keys == nil {
+		return nil, ErrNoKeyProvider
+	}
+
+	s := &EventStore{
+		eventStore: eventStore,
+		keys:       keys,
+	}
+	return s, nil
+}
+
+// Save encrypts the data of the events with the current key and saves them
+// in the base store.
+func (s *EventStore) Save(ctx context.Context, events []eh.Event, originalVersion int) error {
+	keyID, key, err := s.keys.CurrentKey(ctx)
+	if err != nil {
+		return eh.EventStoreError{
+			Err:       ErrCouldNotEncryptEvent,
+			BaseErr:   err,
+			Namespace: eh.Namespace(ctx),
+		}
+	}
+
+	encrypted := make([]eh.Event, len(events))
+	for i, e := range events {
+		if encrypted[i], err = encryptEvent(e, keyID, key); err != nil {
+			return eh.EventStoreError{
+				Err:       ErrCouldNotEncryptEvent,
+				BaseErr:   err,
+				Namespace: eh.Namespace(ctx),
+			}
+		}
+	}
+
+	return s.eventStore.Save(ctx, encrypted, originalVersion)
+}
+
+// Load loads all events for the aggregate id from the base store and decrypts
+// their data.
+func (s *EventStore) Load(ctx context.Context, aggregateType eh.AggregateType, id eh.UUID, opts ...eh.LoadOption) ([]eh.Event, error) {
+	events, err := s.eventStore.Load(ctx, aggregateType, id, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.decryptEvents(ctx, events)
+}
+
+// LoadFrom loads the events from a version for the aggregate id from the base
+// store and decrypts their data. If the base store can not load from a version
+// all events are loaded and filtered instead.
+func (s *EventStore) LoadFrom(ctx context.Context, aggregateType eh.AggregateType, id eh.UUID, fromVersion int) ([]eh.Event, error) {
+	var events []eh.Event
+	if loader, ok := s.eventStore.(eh.EventStoreVersionLoader); ok {
+		var err error
+		if events, err = loader.LoadFrom(ctx, aggregateType, id, fromVersion); err != nil {
+			return nil, err
+		}
+	} else {
+		all, err := s.eventStore.Load(ctx, aggregateType, id)
+		if err != nil {
+			return nil, err
+		}
+		for _, event := range all {
+			if event.Version() >= fromVersion {
+				events = append(events, event)
+			}
+		}
+	}
+
+	return s.decryptEvents(ctx, events)
+}
+
+// LoadReverse loads up to limit events for the aggregate id from the base
+// store, newest first, and decrypts their data. If the base store can not load
+// events in reverse all events are loaded and reversed instead.
+func (s *EventStore) LoadReverse(ctx context.Context, aggregateType eh.AggregateType, id eh.UUID, limit int) ([]eh.Event, error) {
+	var events []eh.Event
+	if loader, ok := s.eventStore.(eh.EventStoreReverseLoader); ok {
+		var err error
+		if events, err = loader.LoadReverse(ctx, aggregateType, id, limit); err != nil {
+			return nil, err
+		}
+	} else {
+		all, err := s.eventStore.Load(ctx, aggregateType, id)
+		if err != nil {
+			return nil, err
+		}
+		for i := len(all) - 1; i >= 0 && (limit <= 0 || len(events) < limit); i-- {
+			events = append(events, all[i])
+		}
+	}
+
+	return s.decryptEvents(ctx, events)
+}
+
+// LoadBetween loads the events within a time range for the aggregate id from
+// the base store and decrypts their data. If the base store can not load a
+// time range all events are loaded and filtered instead.
+func (s *EventStore) LoadBetween(ctx context.Context, aggregateType eh.AggregateType, id eh.UUID, from, to time.Time) ([]eh.Event, error) {
+	var events []eh.Event
+	if loader, ok := s.eventStore.(eh.EventStoreTimeLoader); ok {
+		var err error
+		if events, err = loader.LoadBetween(ctx, aggregateType, id, from, to); err != nil {
+			return nil, err
+		}
+	} else {
+		all, err := s.eventStore.Load(ctx, aggregateType, id)
+		if err != nil {
+			return nil, err
+		}
+		filter := eh.ReplayFilter{From: from, To: to}
+		for _, e := range all {
+			if filter.Match(e) {
+				events = append(events, e)
+			}
+		}
+	}
+
+	return s.decryptEvents(ctx, events)
+}
+
+// LoadByCorrelation implements the LoadByCorrelation method of the
+// eventhorizon.EventStoreCorrelationLoader interface, decrypting the loaded
+// events. The correlation ID in the metadata is not encrypted.
+func (s *EventStore) LoadByCorrelation(ctx context.Context, correlationID string) ([]eh.Event, error) {
+	loader, ok := s.eventStore.(eh.EventStoreCorrelationLoader)
+	if !ok {
+		return nil, eh.ErrCorrelationLoadNotSupported
+	}
+
+	events, err := loader.LoadByCorrelation(ctx, correlationID)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.decryptEvents(ctx, events)
+}
+
+// ClaimOutbox implements the ClaimOutbox method of the
+// eventhorizon.EventStoreOutbox interface, decrypting the claimed events.
+func (s *EventStore) ClaimOutbox(ctx context.Context, limit int, lease time.Duration) ([]eh.OutboxEntry, error) {
+	outbox, ok := s.eventStore.(eh.EventStoreOutbox)
+	if !ok {
+		return nil, eh.ErrOutboxNotSupported
+	}
+
+	entries, err := outbox.ClaimOutbox(ctx, limit, lease)
+	if err != nil {
+		return nil, err
+	}
+	events := make([]eh.Event, len(entries))
+	for i, e := range entries {
+		events[i] = e.Event
+	}
+	if events, err = s.decryptEvents(ctx, events); err != nil {
+		return nil, err
+	}
+	for i := range entries {
+		entries[i].Event = events[i]
+	}
+
+	return entries, nil
+}
+
+// MarkPublished implements the MarkPublished method of the
+// eventhorizon.EventStoreOutbox interface.
+func (s *EventStore) MarkPublished(ctx context.Context, ids []string) error {
+	outbox, ok := s.eventStore.(eh.EventStoreOutbox)
+	if !ok {
+		return eh.ErrOutboxNotSupported
+	}
+
+	return outbox.MarkPublished(ctx, ids)
+}
+
+// decryptEvents decrypts the data of events, with the key that each event was
+// encrypted with. Events without encrypted data are returned as they are.
+func (s *EventStore) decryptEvents(ctx context.Context, events []eh.Event) ([]eh.Event, error) {
+	decrypted := make([]eh.Event, len(events))
+	for i, e := range events {
+		keyID, ok := e.Metadata()[keyIDMetadataKey].(string)
+		if !ok {
+			decrypted[i] = e
+			continue
+		}
+
+		key, err := s.keys.Key(ctx, keyID)
+		if err == nil {
+			decrypted[i], err = decryptEvent(e, key)
+		}
+		if err != nil {
+			return nil, eh.EventStoreError{
+				Err:       ErrCouldNotDecryptEvent,
+				BaseErr:   err,
+				Namespace: eh.Namespace(ctx),
+			}
+		}
+	}
+
+	return decrypted, nil
+}
+
+// payload is the encrypted part of an event, with the schema version of the
+// data to be able to upcast it after decrypting.
+type payload struct {
+	DataVersion int             `json:"data_version"`
+	Data        json.RawMessage `json:"data"`
+}
+
+// encryptEvent returns an event where the data has been encrypted and moved to
+// the metadata.
+func encryptEvent(e eh.Event, keyID string, key []byte) (eh.Event, error) {
+	if e.Data() == nil {
+		return e, nil
+	}
+
+	data, err := json.Marshal(e.Data())
+	if err != nil {
+		return nil, err
+	}
+	plaintext, err := json.Marshal(payload{
+		DataVersion: eh.EventDataVersion(e.EventType()),
+		Data:        data,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, err
+	}
+	ciphertext := gcm.Seal(nonce, nonce, plaintext, additionalData(e))
+
+	metadata := make(map[string]interface{}, len(e.Metadata())+2)
+	for k, v := range e.Metadata() {
+		metadata[k] = v
+	}
+	metadata[dataMetadataKey] = base64.StdEncoding.EncodeToString(ciphertext)
+	metadata[keyIDMetadataKey] = keyID
+
+	return event{Event: e, metadata: metadata}, nil
+}
+
+// decryptEvent returns an event with the decrypted data and the metadata that
+// it was saved with.
+func decryptEvent(e eh.Event, key []byte) (eh.Event, error) {
+	encoded, _ := e.Metadata()[dataMetadataKey].(string)
+	ciphertext, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, err
+	}
+
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(ciphertext) < gcm.NonceSize() {
+		return nil, errors.New("invalid encrypted data")
+	}
+	nonce, ciphertext := ciphertext[:gcm.NonceSize()], ciphertext[gcm.NonceSize():]
+	plaintext, err := gcm.Open(nil, nonce, ciphertext, additionalData(e))
+	if err != nil {
+		return nil, err
+	}
+
+	var p payload
+	if err := json.Unmarshal(plaintext, &p); err != nil {
+		return nil, err
+	}
+	data, err := eh.CreateVersionedEventData(e.EventType(), p.DataVersion)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(p.Data, data); err != nil {
+		return nil, err
+	}
+	if data, err = eh.UpcastEventData(e.EventType(), p.DataVersion, data); err != nil {
+		return nil, err
+	}
+
+	var metadata map[string]interface{}
+	for k, v := range e.Metadata() {
+		if k == dataMetadataKey || k == keyIDMetadataKey {
+			continue
+		}
+		if metadata == nil {
+			metadata = map[string]interface{}{}
+		}
+		metadata[k] = v
+	}
+
+	return event{Event: e, data: data, metadata: metadata}, nil
+}
+
+// additionalData binds the encrypted data to the event that it belongs to, so
+// that it can not be moved to another event.
+func additionalData(e eh.Event) []byte {
+	return []byte(string(e.AggregateID()) + ":" + string(e.EventType()) + ":" + strconv.Itoa(e.Version()))
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, ErrInvalidKey
+	}
+	return cipher.NewGCM(block)
+}
+
+// event is an event with the data or metadata replaced, used both for the
+// encrypted events that are saved and the decrypted events that are loaded.
+type event struct {
+	eh.Event
+	data     eh.EventData
+	metadata map[string]interface{}
+}
+
+// Data implements the Data method of the eventhorizon.Event interface.
+func (e event) Data() eh.EventData {
+	return e.data
+}
+
+// Metadata implements the Metadata method of the eventhorizon.Event interface.
+func (e event) Metadata() map[string]interface{} {
+	return e.metadata
+}
+
+// KeyRing is a KeyProvider that keeps the keys in memory. The last added key
+// is used to encrypt new events, while the older keys are kept to decrypt the
+// events that were encrypted with them.
+type KeyRing struct {
+	keys    map[string][]byte
+	current string
+	keysMu  sync.RWMutex
+}
+
+// NewKeyRing creates a new KeyRing.
+func NewKeyRing() *KeyRing {
+	return &KeyRing{
+		keys: map[string][]byte{},
+	}
+}
+
+// AddKey adds a key with an id and makes it the current key, for example when
+// rotating keys. The key must be 16, 24 or 32 bytes long.
+func (r *KeyRing) AddKey(keyID string, key []byte) error {
+	if _, err := aes.NewCipher(key); err != nil {
+		return ErrInvalidKey
+	}
+
+	r.keysMu.Lock()
+	defer r.keysMu.Unlock()
+
+	r.keys[keyID] = key
+	r.current = keyID
+
+	return nil
+}
+
+// CurrentKey implements the CurrentKey method of the KeyProvider interface.
+func (r *KeyRing) CurrentKey(ctx context.Context) (string, []byte, error) {
+	r.keysMu.RLock()
+	defer r.keysMu.RUnlock()
+
+	key, ok := r.keys[r.current]
+	if !ok {
+		return "", nil, ErrKeyNotFound
+	}
+	return r.current, key, nil
+}
+
+// Key implements the Key method of the KeyProvider interface.
+func (r *KeyRing) Key(ctx context.Context, keyID string) ([]byte, error) {
+	r.keysMu.RLock()
+	defer r.keysMu.RUnlock()
+
+	key, ok := r.keys[keyID]
+	if !ok {
+		return nil, ErrKeyNotFound
+	}
+	return key, nil
+}
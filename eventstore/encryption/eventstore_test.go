@@ -0,0 +1,224 @@
+// Copyright (c) 2016 - Max Ekman <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package encryption
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	eh "github.com/looplab/eventhorizon"
+	"github.com/looplab/eventhorizon/eventstore/memory"
+	"github.com/looplab/eventhorizon/eventstore/testutil"
+	"github.com/looplab/eventhorizon/mocks"
+)
+
+func TestEventStore(t *testing.T) {
+	keys := NewKeyRing()
+	if err := keys.AddKey("key1", []byte("0123456789abcdef0123456789abcdef")); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	store, err := NewEventStore(memory.NewEventStore(), keys)
+	if err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	if store == nil {
+		t.Fatal("there should be a store")
+	}
+
+	// Run the actual test suite.
+
+	t.Log("event store with default namespace")
+	testutil.EventStoreCommonTests(t, context.Background(), store)
+
+	t.Log("event store with other namespace")
+	ctx := eh.WithNamespace(context.Background(), "ns")
+	testutil.EventStoreCommonTests(t, ctx, store)
+
+	t.Log("loading by correlation ID with decrypted events")
+	testutil.CorrelationLoaderCommonTests(t, context.Background(), store)
+}
+
+func TestEventStoreOutbox(t *testing.T) {
+	keys := NewKeyRing()
+	if err := keys.AddKey("key1", []byte("0123456789abcdef0123456789abcdef")); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	store, err := NewEventStore(memory.NewEventStore(memory.WithOutbox()), keys)
+	if err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+
+	t.Log("outbox with decrypted events")
+	testutil.OutboxCommonTests(t, context.Background(), store)
+}
+
+func TestEventStoreEncryption(t *testing.T) {
+	keys := NewKeyRing()
+	if err := keys.AddKey("key1", []byte("0123456789abcdef")); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	baseStore := memory.NewEventStore()
+	store, err := NewEventStore(baseStore, keys)
+	if err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+
+	ctx := context.Background()
+
+	t.Log("save encrypted events")
+	id := eh.NewUUID()
+	agg := mocks.NewAggregate(id)
+	event1 := agg.NewEvent(mocks.EventType, &mocks.EventData{"secret1"},
+		eh.WithMetadata(map[string]interface{}{"num": 42}))
+	agg.ApplyEvent(ctx, event1) // Apply event to increment the aggregate version.
+	event2 := agg.NewEvent(mocks.EventOtherType, nil)
+	agg.ApplyEvent(ctx, event2) // Apply event to increment the aggregate version.
+	if err := store.Save(ctx, []eh.Event{event1, event2}, 0); err != nil {
+		t.Error("there should be no error:", err)
+	}
+
+	t.Log("the data should be encrypted in the base store")
+	raw, err := baseStore.Load(ctx, mocks.AggregateType, id)
+	if err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if len(raw) != 2 {
+		t.Fatal("there should be two events:", raw)
+	}
+	if raw[0].Data() != nil {
+		t.Error("there should be no plaintext data:", raw[0].Data())
+	}
+	if raw[0].AggregateID() != id || raw[0].AggregateType() != mocks.AggregateType || raw[0].Version() != 1 {
+		t.Error("the aggregate ID, type and version should be in plaintext:", raw[0])
+	}
+	if raw[0].Metadata()[keyIDMetadataKey] != "key1" {
+		t.Error("the event should be tagged with the key id:", raw[0].Metadata())
+	}
+	if encrypted, _ := raw[0].Metadata()[dataMetadataKey].(string); encrypted == "" || strings.Contains(encrypted, "secret1") {
+		t.Error("the data should be encrypted:", raw[0].Metadata())
+	}
+
+	t.Log("load decrypted events")
+	events, err := store.Load(ctx, mocks.AggregateType, id)
+	if err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if len(events) != 2 {
+		t.Fatal("there should be two events:", events)
+	}
+	for i, event := range []eh.Event{event1, event2} {
+		if err := mocks.CompareEvents(events[i], event); err != nil {
+			t.Error("the event was incorrect:", err)
+		}
+	}
+	if !reflect.DeepEqual(events[0].Metadata(), map[string]interface{}{"num": 42}) {
+		t.Error("the metadata should be correct:", events[0].Metadata())
+	}
+	if events[1].Metadata() != nil {
+		t.Error("there should be no metadata:", events[1].Metadata())
+	}
+
+	t.Log("load decrypted events after a key rotation")
+	if err := keys.AddKey("key2", []byte("abcdef0123456789abcdef0123456789")); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	event3 := agg.NewEvent(mocks.EventType, &mocks.EventData{"secret3"})
+	agg.ApplyEvent(ctx, event3) // Apply event to increment the aggregate version.
+	if err := store.Save(ctx, []eh.Event{event3}, 2); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	raw, err = baseStore.Load(ctx, mocks.AggregateType, id)
+	if err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if len(raw) != 3 || raw[2].Metadata()[keyIDMetadataKey] != "key2" {
+		t.Error("the new event should be tagged with the new key id:", raw)
+	}
+	events, err = store.LoadFrom(ctx, mocks.AggregateType, id, 1)
+	if err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if len(events) != 3 {
+		t.Fatal("there should be three events:", events)
+	}
+	for i, event := range []eh.Event{event1, event2, event3} {
+		if err := mocks.CompareEvents(events[i], event); err != nil {
+			t.Error("the event was incorrect:", err)
+		}
+	}
+
+	t.Log("fail to load events with a missing key")
+	otherKeys := NewKeyRing()
+	if err := otherKeys.AddKey("key2", []byte("abcdef0123456789abcdef0123456789")); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	otherStore, err := NewEventStore(baseStore, otherKeys)
+	if err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	_, err = otherStore.Load(ctx, mocks.AggregateType, id)
+	if !errors.Is(err, ErrCouldNotDecryptEvent) || !errors.Is(err, ErrKeyNotFound) {
+		t.Error("there should be a ErrCouldNotDecryptEvent error:", err)
+	}
+	events, err = otherStore.LoadFrom(ctx, mocks.AggregateType, id, 3)
+	if err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if len(events) != 1 || mocks.CompareEvents(events[0], event3) != nil {
+		t.Error("the event encrypted with the available key should be loaded:", events)
+	}
+
+	t.Log("fail to load events with an incorrect key")
+	if err := otherKeys.AddKey("key1", []byte("fedcba9876543210")); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	_, err = otherStore.Load(ctx, mocks.AggregateType, id)
+	if !errors.Is(err, ErrCouldNotDecryptEvent) {
+		t.Error("there should be a ErrCouldNotDecryptEvent error:", err)
+	}
+}
+
+func TestEventStoreErrors(t *testing.T) {
+	keys := NewKeyRing()
+
+	t.Log("create without an event store or key provider")
+	if _, err := NewEventStore(nil, keys); err != ErrNoEventStoreDefined {
+		t.Error("there should be a ErrNoEventStoreDefined error:", err)
+	}
+	if _, err := NewEventStore(memory.NewEventStore(), nil); err != ErrNoKeyProvider {
+		t.Error("there should be a ErrNoKeyProvider error:", err)
+	}
+
+	t.Log("add an invalid key")
+	if err := keys.AddKey("key1", []byte("too short")); err != ErrInvalidKey {
+		t.Error("there should be a ErrInvalidKey error:", err)
+	}
+
+	t.Log("save without a current key")
+	store, err := NewEventStore(memory.NewEventStore(), keys)
+	if err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	agg := mocks.NewAggregate(eh.NewUUID())
+	event := agg.NewEvent(mocks.EventType, &mocks.EventData{"event1"})
+	agg.ApplyEvent(context.Background(), event)
+	err = store.Save(context.Background(), []eh.Event{event}, 0)
+	if !errors.Is(err, ErrCouldNotEncryptEvent) || !errors.Is(err, ErrKeyNotFound) {
+		t.Error("there should be a ErrCouldNotEncryptEvent error:", err)
+	}
+}
@@ -18,6 +18,8 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"sort"
+	"strconv"
 	"sync"
 	"time"
 
@@ -27,18 +29,126 @@ import (
 // ErrCouldNotSaveAggregate is when an aggregate could not be saved.
 var ErrCouldNotSaveAggregate = errors.New("could not save aggregate")
 
+// ErrCouldNotUpcastEvent is when the event data could not be upcasted to the
+// current schema version.
+var ErrCouldNotUpcastEvent = errors.New("could not upcast event")
+
 // EventStore implements EventStore as an in memory structure.
 type EventStore struct {
 	// The outer map is with namespace as key, the inner with aggregate ID.
 	db   map[string]map[eh.UUID]aggregateRecord
 	dbMu sync.RWMutex
+
+	// position is the global position of the last saved event, guarded by
+	// dbMu.
+	position int64
+
+	// heads has the global position of the last saved event by namespace,
+	// guarded by dbMu.
+	heads map[string]int64
+
+	// clock sets the timestamps of saved events if set.
+	clock eh.Clock
+
+	// strict fails to load events with unregistered event data.
+	strict bool
+
+	// maxEvents is the max number of events per save, if set.
+	maxEvents int
+
+	// duplicates is how events with ids that are already saved are saved.
+	duplicates eh.DuplicateEvents
+
+	// outbox has the saved events that are not published by namespace, if
+	// enabled, guarded by dbMu.
+	outbox map[string][]outboxRecord
+
+	// ttl is the time after the last save that aggregates are evicted, if
+	// set, using the time of now. nextExpiry is the earliest time that an
+	// aggregate expires, guarded by dbMu.
+	ttl        time.Duration
+	now        eh.Clock
+	nextExpiry time.Time
+}
+
+// Option is an option setter used to configure creation.
+type Option func(*EventStore)
+
+// WithStoreTimestamps sets the timestamps of events to the time of the clock
+// when they are saved, instead of the time when they were created, to keep the
+// order of the events consistent when they are created on different machines.
+// A nil clock uses time.Now.
+func WithStoreTimestamps(clock eh.Clock) Option {
+	return func(s *EventStore) {
+		if clock == nil {
+			clock = time.Now
+		}
+		s.clock = clock
+	}
+}
+
+// WithStrictLoad returns ErrUnregisteredEventType when loading events with data
+// that has not been registered for their type and version, to find missing
+// registrations early. The memory store keeps the event data as it is, so the
+// registrations are not needed to load events otherwise.
+func WithStrictLoad() Option {
+	return func(s *EventStore) {
+		s.strict = true
+	}
+}
+
+// WithMaxEventsPerSave limits the number of events that can be saved at once,
+// returning ErrTooManyEvents for more events without saving any of them. The
+// limit is for the events of each aggregate in SaveBatch. A limit of 0 or less
+// is unlimited, which is the default.
+func WithMaxEventsPerSave(n int) Option {
+	return func(s *EventStore) {
+		s.maxEvents = n
+	}
+}
+
+// WithDuplicateEvents sets how Save handles events with the id of an event
+// that is already in the stream of the aggregate, by rejecting or skipping
+// them. The default is to save them.
+func WithDuplicateEvents(d eh.DuplicateEvents) Option {
+	return func(s *EventStore) {
+		s.duplicates = d
+	}
+}
+
+// WithOutbox records all saved events in an outbox, with the events, to be
+// published by a relay using the eventhorizon.EventStoreOutbox interface.
+func WithOutbox() Option {
+	return func(s *EventStore) {
+		s.outbox = map[string][]outboxRecord{}
+	}
+}
+
+// WithTTL evicts the events and snapshots of aggregates that have not been
+// saved to for the TTL, to free memory in long test runs. Expired aggregates
+// are evicted lazily, when the store is used next, and never while being read.
+// The time is read from the clock, where a nil clock uses time.Now.
+func WithTTL(ttl time.Duration, clock eh.Clock) Option {
+	return func(s *EventStore) {
+		if clock == nil {
+			clock = time.Now
+		}
+		s.ttl = ttl
+		s.now = clock
+	}
 }
 
 // NewEventStore creates a new EventStore.
-func NewEventStore() *EventStore {
+func NewEventStore(opts ...Option) *EventStore {
 	s := &EventStore{
-		db: map[string]map[eh.UUID]aggregateRecord{},
+		db:    map[string]map[eh.UUID]aggregateRecord{},
+		heads: map[string]int64{},
+	}
+
+	for _, opt := range opts {
+		opt(s)
 	}
+
 	return s
 }
 
@@ -50,81 +160,208 @@ func (s *EventStore) Save(ctx context.Context, events []eh.Event, originalVersio
 			Namespace: eh.Namespace(ctx),
 		}
 	}
+	if s.maxEvents > 0 && len(events) > s.maxEvents {
+		return eh.EventStoreError{
+			Err:       eh.ErrTooManyEvents,
+			BaseErr:   fmt.Errorf("%d events, the limit is %d", len(events), s.maxEvents),
+			Namespace: eh.Namespace(ctx),
+		}
+	}
 
-	// Build all event records, with incrementing versions starting from the
-	// original aggregate version.
-	dbEvents := make([]dbEvent, len(events))
+	// Events saved with any version only need consecutive versions, they are
+	// renumbered after the current version below.
+	buildVersion := originalVersion
+	switch originalVersion {
+	case eh.ExpectedVersionAny:
+		buildVersion = events[0].Version() - 1
+	case eh.ExpectedVersionNoStream:
+		buildVersion = 0
+	}
+
+	dbEvents, err := s.buildDBEvents(ctx, events, buildVersion)
+	if err != nil {
+		return err
+	}
 	aggregateID := events[0].AggregateID()
-	version := originalVersion
-	for i, event := range events {
-		// Only accept events belonging to the same aggregate.
-		if event.AggregateID() != aggregateID {
-			return eh.EventStoreError{
-				Err:       eh.ErrInvalidEvent,
-				Namespace: eh.Namespace(ctx),
-			}
+
+	ns := s.namespace(ctx)
+
+	s.dbMu.Lock()
+	defer s.dbMu.Unlock()
+
+	// Remove the duplicates before checking the version, as the saved events
+	// have advanced the version of the aggregate.
+	if s.duplicates != eh.DuplicateEventsAllowed {
+		skipped, err := s.skipDuplicates(ctx, s.db[ns][aggregateID], dbEvents)
+		if err != nil {
+			return err
+		}
+		if dbEvents = dbEvents[skipped:]; len(dbEvents) == 0 {
+			return nil
+		}
+		if originalVersion >= 0 {
+			originalVersion += skipped
 		}
+	}
 
-		// Only accept events that apply to the correct aggregate version.
-		if event.Version() != version+1 {
+	switch originalVersion {
+	case eh.ExpectedVersionAny:
+		originalVersion = s.db[ns][aggregateID].Version
+		for i := range dbEvents {
+			dbEvents[i].Version = originalVersion + i + 1
+		}
+	case eh.ExpectedVersionNoStream:
+		if _, ok := s.db[ns][aggregateID]; ok {
 			return eh.EventStoreError{
-				Err:       eh.ErrIncorrectEventVersion,
+				Err:       eh.ErrStreamAlreadyExists,
 				Namespace: eh.Namespace(ctx),
 			}
 		}
+		originalVersion = 0
+	}
 
-		// Create the event record with timestamp.
-		dbEvents[i] = dbEvent{
-			EventType:     event.EventType(),
-			Data:          event.Data(),
-			Timestamp:     event.Timestamp(),
-			AggregateType: event.AggregateType(),
-			AggregateID:   event.AggregateID(),
-			Version:       event.Version(),
+	// Only save if the version of the aggregate is matching (ie not changed
+	// since loading the aggregate).
+	aggregate := s.db[ns][aggregateID]
+	if aggregate.Version != originalVersion {
+		return eh.EventStoreError{
+			Err:             eh.ErrIncorrectEventVersion,
+			Namespace:       eh.Namespace(ctx),
+			ExpectedVersion: originalVersion,
+			ActualVersion:   aggregate.Version,
 		}
-
-		version++
 	}
 
-	ns := s.namespace(ctx)
-
-	s.dbMu.Lock()
-	defer s.dbMu.Unlock()
-
 	// Either insert a new aggregate or append to an existing.
+	s.setPositions(ns, dbEvents)
+	s.recordOutbox(ns, dbEvents)
 	if originalVersion == 0 {
-		aggregate := aggregateRecord{
+		aggregate = aggregateRecord{
 			AggregateID: aggregateID,
 			Version:     len(dbEvents),
 			Events:      dbEvents,
 		}
-
-		s.db[ns][aggregateID] = aggregate
 	} else {
-		// Increment aggregate version on insert of new event record, and
-		// only insert if version of aggregate is matching (ie not changed
-		// since loading the aggregate).
-		if aggregate, ok := s.db[ns][aggregateID]; ok {
-			if aggregate.Version != originalVersion {
-				return eh.EventStoreError{
-					Err:       ErrCouldNotSaveAggregate,
-					Namespace: eh.Namespace(ctx),
-				}
+		aggregate.Version += len(dbEvents)
+		aggregate.Events = append(aggregate.Events, dbEvents...)
+	}
+	s.touch(&aggregate)
+
+	s.db[ns][aggregateID] = aggregate
+
+	return nil
+}
+
+// skipDuplicates returns the number of duplicates at the start of the events,
+// which are in the stream of the aggregate, see eh.SkipDuplicateEvents.
+func (s *EventStore) skipDuplicates(ctx context.Context, aggregate aggregateRecord, dbEvents []dbEvent) (int, error) {
+	stored := map[string]bool{}
+	for _, e := range aggregate.Events {
+		if id, ok := e.Metadata[eh.EventIDKey].(string); ok {
+			stored[id] = true
+		}
+	}
+
+	ids := make([]string, len(dbEvents))
+	for i, e := range dbEvents {
+		ids[i], _ = e.Metadata[eh.EventIDKey].(string)
+	}
+
+	return eh.SkipDuplicateEvents(ctx, s.duplicates, stored, ids)
+}
+
+// SaveInTransaction implements the SaveInTransaction method of the
+// eventhorizon.TransactionalEventStore interface. The events of the
+// transaction are saved as one batch, under the lock of the store.
+func (s *EventStore) SaveInTransaction(ctx context.Context, fn func(tx eh.EventStoreTx) error) error {
+	return eh.BatchTransaction(ctx, s, fn)
+}
+
+// SaveBatch implements the SaveBatch method of the
+// eventhorizon.EventStoreBatchSaver interface. All versions are checked before
+// any events are saved.
+func (s *EventStore) SaveBatch(ctx context.Context, events map[eh.UUID][]eh.Event, expectedVersions map[eh.UUID]int) error {
+	if len(events) == 0 {
+		return eh.EventStoreError{
+			Err:       eh.ErrNoEventsToAppend,
+			Namespace: eh.Namespace(ctx),
+		}
+	}
+
+	records := make(map[eh.UUID][]dbEvent, len(events))
+	for id, aggregateEvents := range events {
+		if len(aggregateEvents) == 0 {
+			return eh.EventStoreError{
+				Err:       eh.ErrNoEventsToAppend,
+				Namespace: eh.Namespace(ctx),
+			}
+		}
+		if s.maxEvents > 0 && len(aggregateEvents) > s.maxEvents {
+			return eh.EventStoreError{
+				Err:       eh.ErrTooManyEvents,
+				BaseErr:   fmt.Errorf("%d events for %s, the limit is %d", len(aggregateEvents), id, s.maxEvents),
+				Namespace: eh.Namespace(ctx),
+			}
+		}
+		if aggregateEvents[0].AggregateID() != id {
+			return eh.EventStoreError{
+				Err:       eh.ErrInvalidEvent,
+				Namespace: eh.Namespace(ctx),
 			}
+		}
+
+		dbEvents, err := s.buildDBEvents(ctx, aggregateEvents, expectedVersions[id])
+		if err != nil {
+			return err
+		}
+		records[id] = dbEvents
+	}
 
-			aggregate.Version += len(dbEvents)
-			aggregate.Events = append(aggregate.Events, dbEvents...)
+	ns := s.namespace(ctx)
 
-			s.db[ns][aggregateID] = aggregate
+	s.dbMu.Lock()
+	defer s.dbMu.Unlock()
+
+	// Check the versions of all aggregates before saving any of them.
+	for id := range records {
+		if aggregate := s.db[ns][id]; aggregate.Version != expectedVersions[id] {
+			return eh.EventStoreError{
+				Err:             eh.ErrIncorrectEventVersion,
+				Namespace:       eh.Namespace(ctx),
+				ExpectedVersion: expectedVersions[id],
+				ActualVersion:   aggregate.Version,
+			}
 		}
 	}
 
+	for id, dbEvents := range records {
+		s.setPositions(ns, dbEvents)
+		s.recordOutbox(ns, dbEvents)
+		aggregate := s.db[ns][id]
+		aggregate.AggregateID = id
+		aggregate.Version += len(dbEvents)
+		aggregate.Events = append(aggregate.Events, dbEvents...)
+		s.touch(&aggregate)
+		s.db[ns][id] = aggregate
+	}
+
 	return nil
 }
 
 // Load loads all events for the aggregate id from the memory store.
 // Returns ErrNoEventsFound if no events can be found.
-func (s *EventStore) Load(ctx context.Context, aggregateType eh.AggregateType, id eh.UUID) ([]eh.Event, error) {
+func (s *EventStore) Load(ctx context.Context, aggregateType eh.AggregateType, id eh.UUID, opts ...eh.LoadOption) ([]eh.Event, error) {
+	return s.loadFrom(ctx, id, 1, eh.NewLoadOptions(opts...).MaxEvents)
+}
+
+// LoadFrom implements the LoadFrom method of the
+// eventhorizon.EventStoreVersionLoader interface.
+func (s *EventStore) LoadFrom(ctx context.Context, aggregateType eh.AggregateType, id eh.UUID, fromVersion int) ([]eh.Event, error) {
+	return s.loadFrom(ctx, id, fromVersion, 0)
+}
+
+// loadFrom loads up to max events from a version, a max of 0 loads all.
+func (s *EventStore) loadFrom(ctx context.Context, id eh.UUID, fromVersion, max int) ([]eh.Event, error) {
 	s.dbMu.RLock()
 	defer s.dbMu.RUnlock()
 
@@ -138,18 +375,344 @@ func (s *EventStore) Load(ctx context.Context, aggregateType eh.AggregateType, i
 		return []eh.Event{}, nil
 	}
 
-	events := make([]eh.Event, len(aggregate.Events))
-	for i, dbEvent := range aggregate.Events {
-		events[i] = event{dbEvent: dbEvent}
+	events := []eh.Event{}
+	for _, dbEvent := range aggregate.Events {
+		if max > 0 && len(events) == max {
+			break
+		}
+		if dbEvent.Version >= fromVersion {
+			e, err := s.upcastEvent(ctx, dbEvent)
+			if err != nil {
+				return nil, err
+			}
+			events = append(events, e)
+		}
+	}
+
+	return events, nil
+}
+
+// LoadReverse implements the LoadReverse method of the
+// eventhorizon.EventStoreReverseLoader interface.
+func (s *EventStore) LoadReverse(ctx context.Context, aggregateType eh.AggregateType, id eh.UUID, limit int) ([]eh.Event, error) {
+	// Ensure that the namespace exists.
+	ns := s.namespace(ctx)
+
+	s.dbMu.RLock()
+	defer s.dbMu.RUnlock()
+
+	aggregate, ok := s.db[ns][id]
+	if !ok {
+		return []eh.Event{}, nil
+	}
+
+	n := len(aggregate.Events)
+	if limit > 0 && limit < n {
+		n = limit
+	}
+
+	events := make([]eh.Event, n)
+	for i := range events {
+		e, err := s.upcastEvent(ctx, aggregate.Events[len(aggregate.Events)-1-i])
+		if err != nil {
+			return nil, err
+		}
+		events[i] = e
+	}
+
+	return events, nil
+}
+
+// LoadBetween implements the LoadBetween method of the
+// eventhorizon.EventStoreTimeLoader interface.
+func (s *EventStore) LoadBetween(ctx context.Context, aggregateType eh.AggregateType, id eh.UUID, from, to time.Time) ([]eh.Event, error) {
+	// Ensure that the namespace exists.
+	ns := s.namespace(ctx)
+
+	s.dbMu.RLock()
+	defer s.dbMu.RUnlock()
+
+	filter := eh.ReplayFilter{From: from, To: to}
+	events := []eh.Event{}
+	for _, dbEvent := range s.db[ns][id].Events {
+		if !filter.Match(event{dbEvent: dbEvent}) {
+			continue
+		}
+		e, err := s.upcastEvent(ctx, dbEvent)
+		if err != nil {
+			return nil, err
+		}
+		events = append(events, e)
 	}
 
 	return events, nil
 }
 
-// Helper to get the namespace and ensure that its data exists.
+// LoadByCorrelation implements the LoadByCorrelation method of the
+// eventhorizon.EventStoreCorrelationLoader interface. The events of all
+// aggregates in the namespace are searched.
+func (s *EventStore) LoadByCorrelation(ctx context.Context, correlationID string) ([]eh.Event, error) {
+	ns := s.namespace(ctx)
+
+	s.dbMu.RLock()
+	dbEvents := []dbEvent{}
+	for _, aggregate := range s.db[ns] {
+		for _, dbEvent := range aggregate.Events {
+			if id, ok := dbEvent.Metadata[eh.CorrelationIDKey].(string); ok && id == correlationID {
+				dbEvents = append(dbEvents, dbEvent)
+			}
+		}
+	}
+	s.dbMu.RUnlock()
+
+	sort.Stable(byTimestamp(dbEvents))
+
+	events := make([]eh.Event, len(dbEvents))
+	for i, dbEvent := range dbEvents {
+		e, err := s.upcastEvent(ctx, dbEvent)
+		if err != nil {
+			return nil, err
+		}
+		events[i] = e
+	}
+
+	return events, nil
+}
+
+// Delete implements the Delete method of the
+// eventhorizon.EventStoreDeleter interface.
+func (s *EventStore) Delete(ctx context.Context, aggregateType eh.AggregateType, id eh.UUID) error {
+	ns := s.namespace(ctx)
+
+	s.dbMu.Lock()
+	defer s.dbMu.Unlock()
+
+	if _, ok := s.db[ns][id]; !ok {
+		return eh.EventStoreError{
+			Err:       eh.ErrAggregateNotFound,
+			Namespace: eh.Namespace(ctx),
+		}
+	}
+
+	delete(s.db[ns], id)
+
+	return nil
+}
+
+// Compact implements the Compact method of the
+// eventhorizon.EventStoreCompacter interface.
+func (s *EventStore) Compact(ctx context.Context, aggregateType eh.AggregateType, id eh.UUID, upToVersion int) error {
+	ns := s.namespace(ctx)
+
+	s.dbMu.Lock()
+	defer s.dbMu.Unlock()
+
+	aggregate, ok := s.db[ns][id]
+	if !ok {
+		return eh.EventStoreError{
+			Err:       eh.ErrAggregateNotFound,
+			Namespace: eh.Namespace(ctx),
+		}
+	}
+
+	// Only compact up to the latest version, which is always kept.
+	if upToVersion < 1 || upToVersion > aggregate.Version {
+		return eh.EventStoreError{
+			Err:       eh.ErrIncorrectCompactVersion,
+			Namespace: eh.Namespace(ctx),
+		}
+	}
+
+	// Keep the aggregate version so that new events are numbered after the
+	// removed ones.
+	events := []dbEvent{}
+	for _, dbEvent := range aggregate.Events {
+		if dbEvent.Version >= upToVersion {
+			events = append(events, dbEvent)
+		}
+	}
+	aggregate.Events = events
+	s.db[ns][id] = aggregate
+
+	return nil
+}
+
+// HeadPosition implements the HeadPosition method of the
+// eventhorizon.HeadPositioner interface.
+func (s *EventStore) HeadPosition(ctx context.Context) (int64, error) {
+	s.dbMu.RLock()
+	defer s.dbMu.RUnlock()
+
+	return s.heads[eh.Namespace(ctx)], nil
+}
+
+// ReplayAll implements the ReplayAll method of the eventhorizon.EventStreamer
+// interface. The events are buffered and sorted by timestamp before they are
+// sent.
+func (s *EventStore) ReplayAll(ctx context.Context) (<-chan eh.Event, <-chan error) {
+	return s.Replay(ctx, eh.ReplayFilter{})
+}
+
+// Replay implements the Replay method of the eventhorizon.FilteredEventStreamer
+// interface. The stored events are scanned with the filter, and the matching
+// events are buffered and sorted by timestamp before they are sent.
+func (s *EventStore) Replay(ctx context.Context, filter eh.ReplayFilter) (<-chan eh.Event, <-chan error) {
+	ns := s.namespace(ctx)
+
+	s.dbMu.RLock()
+	dbEvents := []dbEvent{}
+	for _, aggregate := range s.db[ns] {
+		for _, dbEvent := range aggregate.Events {
+			if filter.Match(event{dbEvent: dbEvent}) {
+				dbEvents = append(dbEvents, dbEvent)
+			}
+		}
+	}
+	s.dbMu.RUnlock()
+
+	sort.Stable(byTimestamp(dbEvents))
+
+	events := make(chan eh.Event)
+	errs := make(chan error, 1)
+	go func() {
+		defer close(errs)
+		defer close(events)
+
+		for _, dbEvent := range dbEvents {
+			e, err := s.upcastEvent(ctx, dbEvent)
+			if err != nil {
+				errs <- err
+				return
+			}
+
+			select {
+			case events <- e:
+			case <-ctx.Done():
+				errs <- ctx.Err()
+				return
+			}
+		}
+	}()
+
+	return events, errs
+}
+
+// SaveSnapshot implements the SaveSnapshot method of the
+// eventhorizon.SnapshotStore interface.
+func (s *EventStore) SaveSnapshot(ctx context.Context, aggregateType eh.AggregateType, id eh.UUID, version int, state interface{}) error {
+	ns := s.namespace(ctx)
+
+	s.dbMu.Lock()
+	defer s.dbMu.Unlock()
+
+	// Only accept snapshots for versions that the aggregate has reached.
+	aggregate, ok := s.db[ns][id]
+	if !ok || version < 1 || version > aggregate.Version {
+		return eh.EventStoreError{
+			Err:       eh.ErrIncorrectSnapshotVersion,
+			Namespace: eh.Namespace(ctx),
+		}
+	}
+
+	aggregate.Snapshot = state
+	aggregate.SnapshotVersion = version
+	s.db[ns][id] = aggregate
+
+	return nil
+}
+
+// LoadSnapshot implements the LoadSnapshot method of the
+// eventhorizon.SnapshotStore interface.
+func (s *EventStore) LoadSnapshot(ctx context.Context, aggregateType eh.AggregateType, id eh.UUID) (interface{}, int, error) {
+	ns := s.namespace(ctx)
+
+	s.dbMu.RLock()
+	defer s.dbMu.RUnlock()
+
+	aggregate, ok := s.db[ns][id]
+	if !ok || aggregate.Snapshot == nil {
+		return nil, 0, nil
+	}
+
+	return aggregate.Snapshot, aggregate.SnapshotVersion, nil
+}
+
+// HealthCheck implements the HealthCheck method of the
+// eventhorizon.HealthChecker interface. The store is always reachable, so an
+// error is only returned if the context is already done.
+func (s *EventStore) HealthCheck(ctx context.Context) error {
+	return ctx.Err()
+}
+
+// ClaimOutbox implements the ClaimOutbox method of the
+// eventhorizon.EventStoreOutbox interface. Returns ErrOutboxNotSupported if
+// the store was not created with WithOutbox.
+func (s *EventStore) ClaimOutbox(ctx context.Context, limit int, lease time.Duration) ([]eh.OutboxEntry, error) {
+	if s.outbox == nil {
+		return nil, eh.ErrOutboxNotSupported
+	}
+
+	ns := s.namespace(ctx)
+
+	s.dbMu.Lock()
+	defer s.dbMu.Unlock()
+
+	now := time.Now()
+	entries := []eh.OutboxEntry{}
+	records := s.outbox[ns]
+	for i := range records {
+		if len(entries) == limit {
+			break
+		}
+		if now.Before(records[i].claimedUntil) {
+			continue
+		}
+
+		e, err := s.upcastEvent(ctx, records[i].Event)
+		if err != nil {
+			return nil, err
+		}
+		records[i].claimedUntil = now.Add(lease)
+		entries = append(entries, eh.OutboxEntry{ID: records[i].ID, Event: e})
+	}
+
+	return entries, nil
+}
+
+// MarkPublished implements the MarkPublished method of the
+// eventhorizon.EventStoreOutbox interface. Returns ErrOutboxNotSupported if
+// the store was not created with WithOutbox.
+func (s *EventStore) MarkPublished(ctx context.Context, ids []string) error {
+	if s.outbox == nil {
+		return eh.ErrOutboxNotSupported
+	}
+
+	ns := s.namespace(ctx)
+
+	s.dbMu.Lock()
+	defer s.dbMu.Unlock()
+
+	published := make(map[string]bool, len(ids))
+	for _, id := range ids {
+		published[id] = true
+	}
+	records := s.outbox[ns][:0]
+	for _, r := range s.outbox[ns] {
+		if !published[r.ID] {
+			records = append(records, r)
+		}
+	}
+	s.outbox[ns] = records
+
+	return nil
+}
+
+// Helper to get the namespace and ensure that its data exists. Expired
+// aggregates are evicted first, as the lock is held and no reads are ongoing.
 func (s *EventStore) namespace(ctx context.Context) string {
 	s.dbMu.Lock()
 	defer s.dbMu.Unlock()
+	s.evictExpired()
 	ns := eh.Namespace(ctx)
 	if _, ok := s.db[ns]; !ok {
 		s.db[ns] = map[eh.UUID]aggregateRecord{}
@@ -157,21 +720,191 @@ func (s *EventStore) namespace(ctx context.Context) string {
 	return ns
 }
 
+// upcastEvent creates an event from the record, with the event data upcasted
+// to the current schema version if it was saved with an older version. Old
+// aggregate types are resolved to their current name.
+func (s *EventStore) upcastEvent(ctx context.Context, dbEvent dbEvent) (eh.Event, error) {
+	if s.strict && dbEvent.Data != nil {
+		if _, err := eh.CreateVersionedEventData(dbEvent.EventType, dbEvent.DataVersion); err != nil {
+			return nil, eh.EventStoreError{
+				Err:       eh.ErrUnregisteredEventType,
+				BaseErr:   fmt.Errorf("%s version %d", dbEvent.EventType, dbEvent.DataVersion),
+				Namespace: eh.Namespace(ctx),
+			}
+		}
+	}
+
+	if dbEvent.Data != nil && dbEvent.DataVersion < eh.EventDataVersion(dbEvent.EventType) {
+		data, err := eh.UpcastEventData(dbEvent.EventType, dbEvent.DataVersion, dbEvent.Data)
+		if err != nil {
+			return nil, eh.EventStoreError{
+				Err:       ErrCouldNotUpcastEvent,
+				BaseErr:   err,
+				Namespace: eh.Namespace(ctx),
+			}
+		}
+		dbEvent.Data = data
+		dbEvent.DataVersion = eh.EventDataVersion(dbEvent.EventType)
+	}
+
+	// Use the current name for events saved with an old aggregate type.
+	dbEvent.AggregateType = eh.ResolveAggregateType(dbEvent.AggregateType)
+
+	return event{dbEvent: dbEvent}, nil
+}
+
+// buildDBEvents creates the records for the events of an aggregate, with
+// incrementing versions starting from the original aggregate version.
+func (s *EventStore) buildDBEvents(ctx context.Context, events []eh.Event, originalVersion int) ([]dbEvent, error) {
+	dbEvents := make([]dbEvent, len(events))
+	aggregateID := events[0].AggregateID()
+	version := originalVersion
+	for i, event := range events {
+		// Only accept events belonging to the same aggregate.
+		if event.AggregateID() != aggregateID {
+			return nil, eh.EventStoreError{
+				Err:       eh.ErrInvalidEvent,
+				Namespace: eh.Namespace(ctx),
+			}
+		}
+
+		// Only accept events that apply to the correct aggregate version.
+		if event.Version() != version+1 {
+			return nil, eh.EventStoreError{
+				Err:       eh.ErrIncorrectEventVersion,
+				Namespace: eh.Namespace(ctx),
+			}
+		}
+
+		// Create the event record with timestamp.
+		dbEvents[i] = dbEvent{
+			EventType:     event.EventType(),
+			Data:          event.Data(),
+			DataVersion:   eh.EventDataVersion(event.EventType()),
+			Timestamp:     event.Timestamp(),
+			AggregateType: event.AggregateType(),
+			AggregateID:   event.AggregateID(),
+			Version:       event.Version(),
+			Metadata:      event.Metadata(),
+		}
+
+		// Use the time of the store if set.
+		if s.clock != nil {
+			dbEvents[i].Timestamp = s.clock()
+		}
+
+		version++
+	}
+
+	return dbEvents, nil
+}
+
+// setPositions sets the global positions of events that are saved, must be
+// called with dbMu locked.
+func (s *EventStore) setPositions(ns string, dbEvents []dbEvent) {
+	for i := range dbEvents {
+		s.position++
+		dbEvents[i].Position = s.position
+	}
+	s.heads[ns] = s.position
+}
+
+// touch sets the expiry time of a saved aggregate if a TTL is used. The lock
+// must be held.
+func (s *EventStore) touch(aggregate *aggregateRecord) {
+	if s.ttl <= 0 {
+		return
+	}
+	aggregate.expires = s.now().Add(s.ttl)
+	if s.nextExpiry.IsZero() || aggregate.expires.Before(s.nextExpiry) {
+		s.nextExpiry = aggregate.expires
+	}
+}
+
+// evictExpired removes the aggregates that have expired, only scanning them
+// when the earliest expiry time has passed. The lock must be held.
+func (s *EventStore) evictExpired() {
+	if s.ttl <= 0 || s.nextExpiry.IsZero() {
+		return
+	}
+	now := s.now()
+	if now.Before(s.nextExpiry) {
+		return
+	}
+
+	s.nextExpiry = time.Time{}
+	for _, aggregates := range s.db {
+		for id, aggregate := range aggregates {
+			if !now.Before(aggregate.expires) {
+				delete(aggregates, id)
+				continue
+			}
+			if s.nextExpiry.IsZero() || aggregate.expires.Before(s.nextExpiry) {
+				s.nextExpiry = aggregate.expires
+			}
+		}
+	}
+}
+
+// recordOutbox records saved events in the outbox if it is enabled, with the
+// global positions as IDs. The lock must be held.
+func (s *EventStore) recordOutbox(ns string, dbEvents []dbEvent) {
+	if s.outbox == nil {
+		return
+	}
+	for _, e := range dbEvents {
+		s.outbox[ns] = append(s.outbox[ns], outboxRecord{
+			ID:    strconv.FormatInt(e.Position, 10),
+			Event: e,
+		})
+	}
+}
+
+// outboxRecord is an event in the outbox, claimed by a relay until
+// claimedUntil.
+type outboxRecord struct {
+	ID           string
+	Event        dbEvent
+	claimedUntil time.Time
+}
+
 type aggregateRecord struct {
 	AggregateID eh.UUID
 	Version     int
 	Events      []dbEvent
-	// Snapshot    eh.Aggregate
+
+	// Snapshot is the latest snapshot state, taken at SnapshotVersion.
+	Snapshot        interface{}
+	SnapshotVersion int
+
+	// expires is when the aggregate is evicted, if a TTL is used.
+	expires time.Time
 }
 
 // dbEvent is the internal event record for the memory event store.
 type dbEvent struct {
 	EventType     eh.EventType
 	Data          eh.EventData
+	DataVersion   int
 	Timestamp     time.Time
 	AggregateType eh.AggregateType
 	AggregateID   eh.UUID
 	Version       int
+	Metadata      map[string]interface{}
+	Position      int64
+}
+
+// byTimestamp sorts event records by timestamp, with the version as a tie
+// breaker for events in the same aggregate.
+type byTimestamp []dbEvent
+
+func (e byTimestamp) Len() int      { return len(e) }
+func (e byTimestamp) Swap(i, j int) { e[i], e[j] = e[j], e[i] }
+func (e byTimestamp) Less(i, j int) bool {
+	if e[i].Timestamp.Equal(e[j].Timestamp) && e[i].AggregateID == e[j].AggregateID {
+		return e[i].Version < e[j].Version
+	}
+	return e[i].Timestamp.Before(e[j].Timestamp)
 }
 
 // event is the private implementation of the eventhorizon.Event interface
@@ -210,6 +943,17 @@ func (e event) Version() int {
 	return e.dbEvent.Version
 }
 
+// Metadata implements the Metadata method of the eventhorizon.Event interface.
+func (e event) Metadata() map[string]interface{} {
+	return e.dbEvent.Metadata
+}
+
+// GlobalPosition implements the GlobalPosition method of the
+// eventhorizon.PositionedEvent interface.
+func (e event) GlobalPosition() int64 {
+	return e.dbEvent.Position
+}
+
 // String implements the String method of the eventhorizon.Event interface.
 func (e event) String() string {
 	return fmt.Sprintf("%s@%d", e.dbEvent.EventType, e.dbEvent.Version)
@@ -16,10 +16,13 @@ package memory
 
 import (
 	"context"
+	"errors"
 	"testing"
+	"time"
 
 	eh "github.com/looplab/eventhorizon"
 	"github.com/looplab/eventhorizon/eventstore/testutil"
+	"github.com/looplab/eventhorizon/mocks"
 )
 
 func TestEventStore(t *testing.T) {
@@ -37,3 +40,424 @@ func TestEventStore(t *testing.T) {
 	ctx := eh.WithNamespace(context.Background(), "ns")
 	testutil.EventStoreCommonTests(t, ctx, store)
 }
+
+func TestEventStoreNamespaces(t *testing.T) {
+	store := NewEventStore()
+
+	t.Log("events of different tenants")
+	tenant1 := eh.WithNamespace(context.Background(), "tenant1")
+	tenant2 := eh.WithNamespace(context.Background(), "tenant2")
+	testutil.NamespaceCommonTests(t, tenant1, tenant2, store)
+
+	t.Log("events of a tenant and the default namespace")
+	testutil.NamespaceCommonTests(t, context.Background(), tenant1, store)
+}
+
+func TestEventStoreOrderedUUID(t *testing.T) {
+	eh.SetUUIDGenerator(eh.NewOrderedUUID)
+	defer eh.SetUUIDGenerator(nil)
+
+	store := NewEventStore()
+	if store == nil {
+		t.Fatal("there should be a store")
+	}
+
+	t.Log("event store with ordered ids")
+	testutil.EventStoreCommonTests(t, context.Background(), store)
+}
+
+func TestEventStoreTimestamps(t *testing.T) {
+	now := time.Date(2009, time.November, 10, 23, 0, 0, 0, time.UTC)
+	store := NewEventStore(WithStoreTimestamps(func() time.Time { return now }))
+	if store == nil {
+		t.Fatal("there should be a store")
+	}
+
+	t.Log("store timestamps with default namespace")
+	testutil.StoreTimestampCommonTests(t, context.Background(), store, now)
+
+	t.Log("store timestamps with other namespace")
+	ctx := eh.WithNamespace(context.Background(), "ns")
+	testutil.StoreTimestampCommonTests(t, ctx, store, now)
+}
+
+func TestEventStoreMaxEventsPerSave(t *testing.T) {
+	store := NewEventStore(WithMaxEventsPerSave(3))
+	if store == nil {
+		t.Fatal("there should be a store")
+	}
+
+	t.Log("max events per save with default namespace")
+	testutil.MaxEventsPerSaveCommonTests(t, context.Background(), store, 3)
+
+	t.Log("max events per save with other namespace")
+	ctx := eh.WithNamespace(context.Background(), "ns")
+	testutil.MaxEventsPerSaveCommonTests(t, ctx, store, 3)
+
+	t.Log("max events per aggregate in a batch")
+	agg1 := mocks.NewAggregate(eh.NewUUID())
+	agg2 := mocks.NewAggregate(eh.NewUUID())
+	batch := map[eh.UUID][]eh.Event{}
+	for i := 0; i < 3; i++ {
+		event := agg1.NewEvent(mocks.EventType, &mocks.EventData{"event"})
+		agg1.ApplyEvent(ctx, event)
+		batch[agg1.AggregateID()] = append(batch[agg1.AggregateID()], event)
+	}
+	for i := 0; i < 4; i++ {
+		event := agg2.NewEvent(mocks.EventType, &mocks.EventData{"event"})
+		agg2.ApplyEvent(ctx, event)
+		batch[agg2.AggregateID()] = append(batch[agg2.AggregateID()], event)
+	}
+	if err := store.SaveBatch(ctx, batch, nil); !errors.Is(err, eh.ErrTooManyEvents) {
+		t.Error("there should be a ErrTooManyEvents error:", err)
+	}
+	if events, err := store.Load(ctx, mocks.AggregateType, agg1.AggregateID()); err != nil || len(events) != 0 {
+		t.Error("there should be no events saved:", events, err)
+	}
+	batch[agg2.AggregateID()] = batch[agg2.AggregateID()][:3]
+	if err := store.SaveBatch(ctx, batch, nil); err != nil {
+		t.Error("there should be no error:", err)
+	}
+
+	t.Log("unlimited by default")
+	agg3 := mocks.NewAggregate(eh.NewUUID())
+	var events []eh.Event
+	for i := 0; i < 1000; i++ {
+		event := agg3.NewEvent(mocks.EventType, &mocks.EventData{"event"})
+		agg3.ApplyEvent(ctx, event)
+		events = append(events, event)
+	}
+	if err := NewEventStore().Save(ctx, events, 0); err != nil {
+		t.Error("there should be no error:", err)
+	}
+}
+
+func TestSnapshotStore(t *testing.T) {
+	store := NewEventStore()
+	if store == nil {
+		t.Fatal("there should be a store")
+	}
+
+	t.Log("snapshot store with default namespace")
+	testutil.SnapshotStoreCommonTests(t, context.Background(), store)
+
+	t.Log("snapshot store with other namespace")
+	ctx := eh.WithNamespace(context.Background(), "ns")
+	testutil.SnapshotStoreCommonTests(t, ctx, store)
+}
+
+func TestEventStreamer(t *testing.T) {
+	store := NewEventStore()
+	if store == nil {
+		t.Fatal("there should be a store")
+	}
+
+	t.Log("event streamer with default namespace")
+	testutil.EventStreamerCommonTests(t, context.Background(), store)
+
+	t.Log("event streamer with other namespace")
+	ctx := eh.WithNamespace(context.Background(), "ns")
+	testutil.EventStreamerCommonTests(t, ctx, store)
+
+	t.Log("filtered event streamer with default namespace")
+	testutil.FilteredEventStreamerCommonTests(t, context.Background(), store)
+
+	t.Log("filtered event streamer with other namespace")
+	testutil.FilteredEventStreamerCommonTests(t, ctx, store)
+
+	t.Log("global positions with default namespace")
+	testutil.GlobalPositionCommonTests(t, context.Background(), store)
+
+	t.Log("global positions with other namespace")
+	testutil.GlobalPositionCommonTests(t, ctx, store)
+
+	t.Log("expected versions with default namespace")
+	testutil.ExpectedVersionCommonTests(t, context.Background(), store)
+
+	t.Log("expected versions with other namespace")
+	testutil.ExpectedVersionCommonTests(t, ctx, store)
+
+	t.Log("reverse loading with default namespace")
+	testutil.ReverseLoaderCommonTests(t, context.Background(), store)
+
+	t.Log("reverse loading with other namespace")
+	testutil.ReverseLoaderCommonTests(t, ctx, store)
+
+	t.Log("loading with max events with default namespace")
+	testutil.MaxEventsCommonTests(t, context.Background(), store)
+
+	t.Log("loading with max events with other namespace")
+	testutil.MaxEventsCommonTests(t, ctx, store)
+
+	t.Log("loading a time range with default namespace")
+	testutil.TimeLoaderCommonTests(t, context.Background(), store)
+
+	t.Log("loading a time range with other namespace")
+	testutil.TimeLoaderCommonTests(t, ctx, store)
+
+	t.Log("loading by correlation ID with default namespace")
+	testutil.CorrelationLoaderCommonTests(t, context.Background(), store)
+
+	t.Log("loading by correlation ID with other namespace")
+	testutil.CorrelationLoaderCommonTests(t, ctx, store)
+}
+
+func TestUpcaster(t *testing.T) {
+	store := NewEventStore()
+	if store == nil {
+		t.Fatal("there should be a store")
+	}
+
+	testutil.UpcasterCommonTests(t, context.Background(), store)
+}
+
+func TestAggregateTypeAlias(t *testing.T) {
+	store := NewEventStore()
+	if store == nil {
+		t.Fatal("there should be a store")
+	}
+
+	testutil.AggregateTypeAliasCommonTests(t, context.Background(), store)
+}
+
+func TestEventStoreBatchSaver(t *testing.T) {
+	store := NewEventStore()
+	if store == nil {
+		t.Fatal("there should be a store")
+	}
+
+	t.Log("batch saver with default namespace")
+	testutil.EventStoreBatchSaverCommonTests(t, context.Background(), store)
+
+	t.Log("batch saver with other namespace")
+	ctx := eh.WithNamespace(context.Background(), "ns")
+	testutil.EventStoreBatchSaverCommonTests(t, ctx, store)
+}
+
+func TestTransactionalEventStore(t *testing.T) {
+	store := NewEventStore()
+	if store == nil {
+		t.Fatal("there should be a store")
+	}
+
+	t.Log("transactions with default namespace")
+	testutil.TransactionalEventStoreCommonTests(t, context.Background(), store)
+
+	t.Log("transactions with other namespace")
+	ctx := eh.WithNamespace(context.Background(), "ns")
+	testutil.TransactionalEventStoreCommonTests(t, ctx, store)
+}
+
+func TestEventStoreCompacter(t *testing.T) {
+	store := NewEventStore()
+	if store == nil {
+		t.Fatal("there should be a store")
+	}
+
+	t.Log("compacter with default namespace")
+	testutil.EventStoreCompacterCommonTests(t, context.Background(), store)
+
+	t.Log("compacter with other namespace")
+	ctx := eh.WithNamespace(context.Background(), "ns")
+	testutil.EventStoreCompacterCommonTests(t, ctx, store)
+}
+
+func TestEventStoreOutbox(t *testing.T) {
+	store := NewEventStore(WithOutbox())
+	if store == nil {
+		t.Fatal("there should be a store")
+	}
+
+	t.Log("outbox with default namespace")
+	testutil.OutboxCommonTests(t, context.Background(), store)
+
+	t.Log("outbox with other namespace")
+	ctx := eh.WithNamespace(context.Background(), "ns")
+	testutil.OutboxCommonTests(t, ctx, store)
+
+	t.Log("outbox with batch saves")
+	id := eh.NewUUID()
+	agg := mocks.NewAggregate(id)
+	event := agg.NewEvent(mocks.EventType, &mocks.EventData{"event1"})
+	agg.ApplyEvent(ctx, event) // Apply event to increment the aggregate version.
+	if err := store.SaveBatch(ctx, map[eh.UUID][]eh.Event{id: {event}}, nil); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	entries, err := store.ClaimOutbox(ctx, 10, time.Minute)
+	if err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if len(entries) != 1 {
+		t.Fatal("there should be one entry:", entries)
+	}
+	if err := mocks.CompareEvents(entries[0].Event, event); err != nil {
+		t.Error("the event was incorrect:", err)
+	}
+
+	t.Log("outbox without enabling it")
+	store = NewEventStore()
+	if _, err := store.ClaimOutbox(ctx, 10, time.Minute); err != eh.ErrOutboxNotSupported {
+		t.Error("there should be a ErrOutboxNotSupported error:", err)
+	}
+	if err := store.MarkPublished(ctx, []string{"1"}); err != eh.ErrOutboxNotSupported {
+		t.Error("there should be a ErrOutboxNotSupported error:", err)
+	}
+}
+
+func TestEventStoreTTL(t *testing.T) {
+	now := time.Date(2009, time.November, 10, 23, 0, 0, 0, time.UTC)
+	clock := func() time.Time { return now }
+	store := NewEventStore(WithTTL(time.Minute, clock))
+	ctx := context.Background()
+
+	t.Log("run the common tests with a TTL")
+	testutil.EventStoreCommonTests(t, ctx, store)
+
+	id1 := eh.NewUUID()
+	agg1 := mocks.NewAggregate(id1)
+	event1 := agg1.NewEvent(mocks.EventType, &mocks.EventData{"event1"})
+	agg1.ApplyEvent(ctx, event1) // Apply event to increment the aggregate version.
+	if err := store.Save(ctx, []eh.Event{event1}, 0); err != nil {
+		t.Error("there should be no error:", err)
+	}
+
+	t.Log("keep an aggregate before the TTL")
+	now = now.Add(30 * time.Second)
+	id2 := eh.NewUUID()
+	agg2 := mocks.NewAggregate(id2)
+	event2 := agg2.NewEvent(mocks.EventType, &mocks.EventData{"event2"})
+	agg2.ApplyEvent(ctx, event2) // Apply event to increment the aggregate version.
+	if err := store.Save(ctx, []eh.Event{event2}, 0); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	now = now.Add(29 * time.Second)
+	if events, err := store.Load(ctx, mocks.AggregateType, id1); err != nil || len(events) != 1 {
+		t.Error("the aggregate should not be evicted:", events, err)
+	}
+
+	t.Log("evict an aggregate after the TTL")
+	now = now.Add(time.Second)
+	if events, err := store.Load(ctx, mocks.AggregateType, id1); err != nil || len(events) != 0 {
+		t.Error("the aggregate should be evicted:", events, err)
+	}
+	if events, err := store.Load(ctx, mocks.AggregateType, id2); err != nil || len(events) != 1 {
+		t.Error("the later aggregate should not be evicted:", events, err)
+	}
+
+	t.Log("keep an aggregate that is saved to")
+	event3 := agg2.NewEvent(mocks.EventType, &mocks.EventData{"event3"})
+	agg2.ApplyEvent(ctx, event3) // Apply event to increment the aggregate version.
+	if err := store.Save(ctx, []eh.Event{event3}, 1); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	now = now.Add(59 * time.Second)
+	if events, err := store.Load(ctx, mocks.AggregateType, id2); err != nil || len(events) != 2 {
+		t.Error("the aggregate should not be evicted:", events, err)
+	}
+	now = now.Add(time.Second)
+	if events, err := store.Load(ctx, mocks.AggregateType, id2); err != nil || len(events) != 0 {
+		t.Error("the aggregate should be evicted:", events, err)
+	}
+
+	t.Log("keep aggregates without a TTL")
+	store = NewEventStore()
+	if err := store.Save(ctx, []eh.Event{event1}, 0); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	now = now.Add(time.Hour)
+	if events, err := store.Load(ctx, mocks.AggregateType, id1); err != nil || len(events) != 1 {
+		t.Error("the aggregate should not be evicted:", events, err)
+	}
+}
+
+func TestEventStoreStrictLoad(t *testing.T) {
+	ctx := context.Background()
+	agg := mocks.NewAggregate(eh.NewUUID())
+	event := agg.NewEvent(unregisteredEventType, &unregisteredEventData{"data"})
+
+	store := NewEventStore()
+	if err := store.Save(ctx, []eh.Event{event}, 0); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	events, err := store.Load(ctx, mocks.AggregateType, agg.AggregateID())
+	if err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if len(events) != 1 {
+		t.Error("there should be one event:", events)
+	}
+
+	t.Log("strict load of unregistered event data")
+	store = NewEventStore(WithStrictLoad())
+	if err := store.Save(ctx, []eh.Event{event}, 0); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	events, err = store.Load(ctx, mocks.AggregateType, agg.AggregateID())
+	if !errors.Is(err, eh.ErrUnregisteredEventType) {
+		t.Error("there should be a unregistered event type error:", err)
+	}
+	if events != nil {
+		t.Error("there should be no events:", events)
+	}
+
+	t.Log("strict load of events without data")
+	agg2 := mocks.NewAggregate(eh.NewUUID())
+	event2 := agg2.NewEvent(unregisteredEventType, nil)
+	if err := store.Save(ctx, []eh.Event{event2}, 0); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	if _, err := store.Load(ctx, mocks.AggregateType, agg2.AggregateID()); err != nil {
+		t.Error("there should be no error:", err)
+	}
+}
+
+const unregisteredEventType eh.EventType = "UnregisteredEvent"
+
+type unregisteredEventData struct {
+	Content string
+}
+
+func TestEventStoreHealthCheck(t *testing.T) {
+	store := NewEventStore()
+	if err := store.HealthCheck(context.Background()); err != nil {
+		t.Error("there should be no error:", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := store.HealthCheck(ctx); !errors.Is(err, context.Canceled) {
+		t.Error("there should be a context canceled error:", err)
+	}
+}
+
+func TestEventStoreDuplicateEvents(t *testing.T) {
+	ctx := context.Background()
+
+	t.Log("reject duplicate events")
+	testutil.DuplicateEventsCommonTests(t, ctx, NewEventStore(WithDuplicateEvents(eh.DuplicateEventsRejected)), eh.DuplicateEventsRejected)
+
+	t.Log("skip duplicate events")
+	testutil.DuplicateEventsCommonTests(t, ctx, NewEventStore(WithDuplicateEvents(eh.DuplicateEventsSkipped)), eh.DuplicateEventsSkipped)
+
+	t.Log("skip duplicate events saved with any version")
+	store := NewEventStore(WithDuplicateEvents(eh.DuplicateEventsSkipped))
+	agg := mocks.NewAggregate(eh.NewUUID())
+	withID := eh.WithEventID(eh.NamedEventIDs(eh.NewUUID()))
+	event1 := agg.NewEvent(mocks.EventType, &mocks.EventData{"event1"}, withID)
+	agg.ApplyEvent(ctx, event1)
+	event2 := agg.NewEvent(mocks.EventType, &mocks.EventData{"event2"}, withID)
+	agg.ApplyEvent(ctx, event2)
+	if err := store.Save(ctx, []eh.Event{event1}, 0); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	if err := store.Save(ctx, []eh.Event{event1, event2}, eh.ExpectedVersionAny); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	events, err := store.Load(ctx, mocks.AggregateType, agg.AggregateID())
+	if err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	if len(events) != 2 || events[1].Version() != 2 {
+		t.Error("only the new event should be saved:", events)
+	}
+}
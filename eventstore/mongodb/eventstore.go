@@ -15,15 +15,21 @@
 package mongodb
 
 import (
+	"bytes"
+	"compress/gzip"
 	"context"
 	"errors"
 	"fmt"
+	"io/ioutil"
+	"sort"
+	"strconv"
 	"time"
 
 	"gopkg.in/mgo.v2"
 	"gopkg.in/mgo.v2/bson"
 
 	eh "github.com/looplab/eventhorizon"
+	"github.com/looplab/eventhorizon/eventstore/codec"
 )
 
 // ErrCouldNotDialDB is when the database could not be dialed.
@@ -35,26 +41,145 @@ var ErrNoDBSession = errors.New("no database session")
 // ErrCouldNotClearDB is when the database could not be cleared.
 var ErrCouldNotClearDB = errors.New("could not clear database")
 
+// ErrCouldNotPingDB is when the database could not be reached by a health
+// check.
+var ErrCouldNotPingDB = errors.New("could not ping database")
+
 // ErrCouldNotMarshalEvent is when an event could not be marshaled into BSON.
 var ErrCouldNotMarshalEvent = errors.New("could not marshal event")
 
 // ErrCouldNotUnmarshalEvent is when an event could not be unmarshaled into a concrete type.
 var ErrCouldNotUnmarshalEvent = errors.New("could not unmarshal event")
 
+// ErrIncorrectCodec is when the event data was marshaled with another codec
+// than the one of the store, or by a store with a codec when there is none.
+var ErrIncorrectCodec = errors.New("incorrect codec")
+
 // ErrCouldNotLoadAggregate is when an aggregate could not be loaded.
 var ErrCouldNotLoadAggregate = errors.New("could not load aggregate")
 
 // ErrCouldNotSaveAggregate is when an aggregate could not be saved.
 var ErrCouldNotSaveAggregate = errors.New("could not save aggregate")
 
-// EventStore implements an EventStore for MongoDB.
+// ErrCouldNotCreateIndex is when an index could not be created.
+var ErrCouldNotCreateIndex = errors.New("could not create index")
+
+// ErrCouldNotRevertBatch is when the aggregates written by a failed batch save
+// could not be reverted.
+var ErrCouldNotRevertBatch = errors.New("could not revert batch")
+
+// EventStore implements an EventStore for MongoDB. The event data is stored
+// as BSON documents, which keeps the BSON types of values such as dates and
+// binary data, and is unmarshaled into the data registered for the event type
+// when loading. Dates are stored with millisecond precision.
+//
+// The global positions of the events are reserved from a sequence before the
+// events are written, as the driver has no transactions. Concurrent saves can
+// therefore make events visible out of position order, and saves that fail
+// leave gaps. Consumers that resume after the position of the last event they
+// handled must re-read a window of positions behind it to not skip events.
 type EventStore struct {
-	session  *mgo.Session
-	dbPrefix string
+	session   *mgo.Session
+	dbPrefix  string
+	codec     codec.Codec
+	clock     eh.Clock
+	strict    bool
+	maxEvents int
+	outbox    bool
+	compress  bool
+	minSize   int
+	// duplicates is how events with ids that are already saved are saved.
+	duplicates eh.DuplicateEvents
+}
+
+// Option is an option setter used to configure creation.
+type Option func(*EventStore) error
+
+// WithCodec uses a codec to marshal the event data, instead of storing it as
+// BSON documents. Events saved with a codec must be loaded with the same codec,
+// the name of the codec is saved with the data and loading it with another
+// codec, or without one, returns ErrIncorrectCodec. Events saved as BSON
+// documents can still be loaded.
+func WithCodec(c codec.Codec) Option {
+	return func(s *EventStore) error {
+		s.codec = c
+		return nil
+	}
+}
+
+// WithStoreTimestamps sets the timestamps of events to the time of the clock
+// when they are saved, instead of the time when they were created, to keep the
+// order of the events consistent when they are created on different machines.
+// A nil clock uses time.Now.
+func WithStoreTimestamps(clock eh.Clock) Option {
+	return func(s *EventStore) error {
+		if clock == nil {
+			clock = time.Now
+		}
+		s.clock = clock
+		return nil
+	}
+}
+
+// WithStrictLoad returns ErrUnregisteredEventType when loading events with data
+// that has not been registered for their type and version, instead of loading
+// the data as raw BSON.
+func WithStrictLoad() Option {
+	return func(s *EventStore) error {
+		s.strict = true
+		return nil
+	}
+}
+
+// WithMaxEventsPerSave limits the number of events that can be saved at once,
+// returning ErrTooManyEvents for more events before writing to the database.
+// The limit is for the events of each aggregate in SaveBatch. A limit of 0 or
+// less is unlimited, which is the default.
+func WithMaxEventsPerSave(n int) Option {
+	return func(s *EventStore) error {
+		s.maxEvents = n
+		return nil
+	}
+}
+
+// WithCompression compresses the marshaled event data with gzip before it is
+// saved, for data of at least minSize bytes, to not spend time compressing
+// small payloads. The compression is recorded for each event, so that events
+// are decompressed when loaded, also by stores without the option. Compressed
+// data can not be used in queries of the database.
+func WithCompression(minSize int) Option {
+	return func(s *EventStore) error {
+		s.compress = true
+		s.minSize = minSize
+		return nil
+	}
+}
+
+// WithDuplicateEvents sets how Save handles events with the id of an event
+// that is already in the stream of the aggregate, by rejecting or skipping
+// them. The default is to save them. The ids are checked in the document of
+// the aggregate, as a unique index in MongoDB does not apply within the array
+// of events of a document. The version check of the save keeps concurrent
+// saves of the same events from both being saved.
+func WithDuplicateEvents(d eh.DuplicateEvents) Option {
+	return func(s *EventStore) error {
+		s.duplicates = d
+		return nil
+	}
+}
+
+// WithOutbox records all saved events in an outbox in the aggregate document,
+// written atomically with the events, to be published by a relay using the
+// eventhorizon.EventStoreOutbox interface.
+func WithOutbox() Option {
+	return func(s *EventStore) error {
+		s.outbox = true
+		return nil
+	}
 }
 
 // NewEventStore creates a new EventStore.
-func NewEventStore(url, dbPrefix string) (*EventStore, error) {
+func NewEventStore(url, dbPrefix string, opts ...Option) (*EventStore, error) {
 	session, err := mgo.Dial(url)
 	if err != nil {
 		return nil, ErrCouldNotDialDB
@@ -63,11 +188,11 @@ func NewEventStore(url, dbPrefix string) (*EventStore, error) {
 	session.SetMode(mgo.Strong, true)
 	session.SetSafe(&mgo.Safe{W: 1})
 
-	return NewEventStoreWithSession(session, dbPrefix)
+	return NewEventStoreWithSession(session, dbPrefix, opts...)
 }
 
 // NewEventStoreWithSession creates a new EventStore with a session.
-func NewEventStoreWithSession(session *mgo.Session, dbPrefix string) (*EventStore, error) {
+func NewEventStoreWithSession(session *mgo.Session, dbPrefix string, opts ...Option) (*EventStore, error) {
 	if session == nil {
 		return nil, ErrNoDBSession
 	}
@@ -77,6 +202,12 @@ func NewEventStoreWithSession(session *mgo.Session, dbPrefix string) (*EventStor
 		dbPrefix: dbPrefix,
 	}
 
+	for _, opt := range opts {
+		if err := opt(s); err != nil {
+			return nil, err
+		}
+	}
+
 	return s, nil
 }
 
@@ -88,54 +219,70 @@ func (s *EventStore) Save(ctx context.Context, events []eh.Event, originalVersio
 			Namespace: eh.Namespace(ctx),
 		}
 	}
+	if s.maxEvents > 0 && len(events) > s.maxEvents {
+		return eh.EventStoreError{
+			Err:       eh.ErrTooManyEvents,
+			BaseErr:   fmt.Errorf("%d events, the limit is %d", len(events), s.maxEvents),
+			Namespace: eh.Namespace(ctx),
+		}
+	}
 
 	sess := s.session.Copy()
 	defer sess.Close()
 
-	// Build all event records, with incrementing versions starting from the
-	// original aggregate version.
-	dbEvents := make([]dbEvent, len(events))
+	// Events saved with any version only need consecutive versions, they are
+	// renumbered after the current version below.
+	buildVersion := originalVersion
+	switch originalVersion {
+	case eh.ExpectedVersionAny:
+		buildVersion = events[0].Version() - 1
+	case eh.ExpectedVersionNoStream:
+		buildVersion = 0
+	}
+
+	dbEvents, err := s.buildDBEvents(ctx, events, buildVersion)
+	if err != nil {
+		return err
+	}
 	aggregateID := events[0].AggregateID()
-	version := originalVersion
-	for i, event := range events {
-		// Only accept events belonging to the same aggregate.
-		if event.AggregateID() != aggregateID {
-			return eh.EventStoreError{
-				Err:       eh.ErrInvalidEvent,
-				Namespace: eh.Namespace(ctx),
-			}
-		}
 
-		// Only accept events that apply to the correct aggregate version.
-		if event.Version() != version+1 {
-			return eh.EventStoreError{
-				Err:       eh.ErrIncorrectEventVersion,
-				Namespace: eh.Namespace(ctx),
-			}
+	// Remove the duplicates before checking the version, as the saved events
+	// have advanced the version of the aggregate.
+	if s.duplicates != eh.DuplicateEventsAllowed {
+		skipped, err := s.skipDuplicates(ctx, sess, aggregateID, dbEvents)
+		if err != nil {
+			return err
 		}
-
-		// Create the event record with timestamp.
-		dbEvents[i] = dbEvent{
-			EventType:     event.EventType(),
-			Timestamp:     event.Timestamp(),
-			AggregateType: event.AggregateType(),
-			AggregateID:   event.AggregateID(),
-			Version:       event.Version(),
+		if dbEvents = dbEvents[skipped:]; len(dbEvents) == 0 {
+			return nil
 		}
+		if originalVersion >= 0 {
+			originalVersion += skipped
+		}
+	}
 
-		// Marshal event data if there is any.
-		if event.Data() != nil {
-			rawData, err := bson.Marshal(event.Data())
-			if err != nil {
-				return eh.EventStoreError{
-					Err:       ErrCouldNotMarshalEvent,
-					Namespace: eh.Namespace(ctx),
-				}
-			}
-			dbEvents[i].RawData = bson.Raw{Kind: 3, Data: rawData}
+	// The current version is read before appending, a concurrent save of the
+	// same aggregate will still fail the version check of the update.
+	noStream := originalVersion == eh.ExpectedVersionNoStream
+	if noStream {
+		originalVersion = 0
+	} else if originalVersion == eh.ExpectedVersionAny {
+		version, err := s.aggregateVersion(ctx, sess, aggregateID)
+		if err != nil {
+			return err
+		}
+		originalVersion = version
+		for i := range dbEvents {
+			dbEvents[i].Version = originalVersion + i + 1
 		}
+	}
 
-		version++
+	position, err := s.reservePositions(ctx, sess, len(dbEvents))
+	if err != nil {
+		return err
+	}
+	for i := range dbEvents {
+		dbEvents[i].Position = position + int64(i)
 	}
 
 	// Either insert a new aggregate or append to an existing.
@@ -144,9 +291,19 @@ func (s *EventStore) Save(ctx context.Context, events []eh.Event, originalVersio
 			AggregateID: aggregateID.String(),
 			Version:     len(dbEvents),
 			Events:      dbEvents,
+			Outbox:      s.outboxRecords(dbEvents),
 		}
 
 		if err := sess.DB(s.dbName(ctx)).C("events").Insert(aggregate); err != nil {
+			if noStream && mgo.IsDup(err) {
+				return eh.EventStoreError{
+					Err:       eh.ErrStreamAlreadyExists,
+					Namespace: eh.Namespace(ctx),
+				}
+			}
+			if mgo.IsDup(err) {
+				return s.versionConflict(ctx, sess, aggregateID, originalVersion)
+			}
 			return eh.EventStoreError{
 				Err:       ErrCouldNotSaveAggregate,
 				Namespace: eh.Namespace(ctx),
@@ -162,10 +319,13 @@ func (s *EventStore) Save(ctx context.Context, events []eh.Event, originalVersio
 				"version": originalVersion,
 			},
 			bson.M{
-				"$push": bson.M{"events": bson.M{"$each": dbEvents}},
+				"$push": s.pushEvents(dbEvents),
 				"$inc":  bson.M{"version": len(dbEvents)},
 			},
 		); err != nil {
+			if err == mgo.ErrNotFound {
+				return s.versionConflict(ctx, sess, aggregateID, originalVersion)
+			}
 			return eh.EventStoreError{
 				Err:       ErrCouldNotSaveAggregate,
 				Namespace: eh.Namespace(ctx),
@@ -176,44 +336,910 @@ func (s *EventStore) Save(ctx context.Context, events []eh.Event, originalVersio
 	return nil
 }
 
+// SaveBatch implements the SaveBatch method of the
+// eventhorizon.EventStoreBatchSaver interface. All aggregates are written in
+// one ordered bulk write. As the driver has no transactions the batch is not
+// atomic: the aggregates that were written are reverted if any of them could
+// not be, but their events can be loaded, replayed and claimed from the outbox
+// until they are reverted, and they are kept if the process stops before
+// that. Aggregates that were changed after the batch wrote them are not
+// reverted.
+func (s *EventStore) SaveBatch(ctx context.Context, events map[eh.UUID][]eh.Event, expectedVersions map[eh.UUID]int) error {
+	if len(events) == 0 {
+		return eh.EventStoreError{
+			Err:       eh.ErrNoEventsToAppend,
+			Namespace: eh.Namespace(ctx),
+		}
+	}
+
+	// Write the aggregates in a deterministic order.
+	ids := make([]string, 0, len(events))
+	records := make(map[string][]dbEvent, len(events))
+	for id, aggregateEvents := range events {
+		if len(aggregateEvents) == 0 {
+			return eh.EventStoreError{
+				Err:       eh.ErrNoEventsToAppend,
+				Namespace: eh.Namespace(ctx),
+			}
+		}
+		if s.maxEvents > 0 && len(aggregateEvents) > s.maxEvents {
+			return eh.EventStoreError{
+				Err:       eh.ErrTooManyEvents,
+				BaseErr:   fmt.Errorf("%d events for %s, the limit is %d", len(aggregateEvents), id, s.maxEvents),
+				Namespace: eh.Namespace(ctx),
+			}
+		}
+		if aggregateEvents[0].AggregateID() != id {
+			return eh.EventStoreError{
+				Err:       eh.ErrInvalidEvent,
+				Namespace: eh.Namespace(ctx),
+			}
+		}
+
+		dbEvents, err := s.buildDBEvents(ctx, aggregateEvents, expectedVersions[id])
+		if err != nil {
+			return err
+		}
+		ids = append(ids, id.String())
+		records[id.String()] = dbEvents
+	}
+	sort.Strings(ids)
+
+	sess := s.session.Copy()
+	defer sess.Close()
+
+	// Reserve the global positions for all events at once, in the order the
+	// aggregates are written.
+	numEvents := 0
+	for _, dbEvents := range records {
+		numEvents += len(dbEvents)
+	}
+	position, err := s.reservePositions(ctx, sess, numEvents)
+	if err != nil {
+		return err
+	}
+	for _, id := range ids {
+		for i := range records[id] {
+			records[id][i].Position = position
+			position++
+		}
+	}
+
+	// Mark all written aggregates with the batch, to only revert those.
+	batch := eh.NewUUID().String()
+	bulk := sess.DB(s.dbName(ctx)).C("events").Bulk()
+	numUpdates := 0
+	for _, id := range ids {
+		dbEvents := records[id]
+		version := expectedVersions[eh.UUID(id)]
+		if version == 0 {
+			bulk.Insert(aggregateRecord{
+				AggregateID: id,
+				Version:     len(dbEvents),
+				Events:      dbEvents,
+				Outbox:      s.outboxRecords(dbEvents),
+				Batch:       batch,
+			})
+			continue
+		}
+		bulk.Update(
+			bson.M{
+				"_id":     id,
+				"version": version,
+			},
+			bson.M{
+				"$push": s.pushEvents(dbEvents),
+				"$inc":  bson.M{"version": len(dbEvents)},
+				"$set":  bson.M{"batch": batch},
+			},
+		)
+		numUpdates++
+	}
+
+	res, err := bulk.Run()
+	if err == nil && res.Matched == numUpdates {
+		return nil
+	}
+
+	if rollbackErr := s.revertBatch(ctx, sess, batch, ids, records, expectedVersions); rollbackErr != nil {
+		return eh.EventStoreError{
+			Err:       ErrCouldNotRevertBatch,
+			BaseErr:   rollbackErr,
+			Namespace: eh.Namespace(ctx),
+		}
+	}
+
+	// A duplicate new aggregate or an unmatched update is a version conflict,
+	// of the first aggregate that has another version than expected.
+	if err == nil || mgo.IsDup(err) {
+		for _, id := range ids {
+			version, err := s.aggregateVersion(ctx, sess, eh.UUID(id))
+			if err != nil {
+				return err
+			}
+			if version != expectedVersions[eh.UUID(id)] {
+				return eh.EventStoreError{
+					Err:             eh.ErrIncorrectEventVersion,
+					Namespace:       eh.Namespace(ctx),
+					ExpectedVersion: expectedVersions[eh.UUID(id)],
+					ActualVersion:   version,
+				}
+			}
+		}
+		return eh.EventStoreError{
+			Err:       eh.ErrIncorrectEventVersion,
+			Namespace: eh.Namespace(ctx),
+		}
+	}
+	return eh.EventStoreError{
+		Err:       ErrCouldNotSaveAggregate,
+		BaseErr:   err,
+		Namespace: eh.Namespace(ctx),
+	}
+}
+
+// revertBatch reverts the aggregates that were written by a batch, by removing
+// new aggregates and the events appended to existing aggregates. Aggregates
+// that were changed by another save after the batch are kept, to not remove
+// its events.
+func (s *EventStore) revertBatch(ctx context.Context, sess *mgo.Session, batch string, ids []string, records map[string][]dbEvent, expectedVersions map[eh.UUID]int) error {
+	bulk := sess.DB(s.dbName(ctx)).C("events").Bulk()
+	bulk.Unordered()
+	for _, id := range ids {
+		version := expectedVersions[eh.UUID(id)]
+		if version == 0 {
+			bulk.Remove(bson.M{
+				"_id":     id,
+				"batch":   batch,
+				"version": len(records[id]),
+			})
+			continue
+		}
+		bulk.Update(
+			bson.M{
+				"_id":     id,
+				"batch":   batch,
+				"version": version + len(records[id]),
+			},
+			bson.M{
+				"$pull": bson.M{
+					"events": bson.M{"version": bson.M{"$gt": version}},
+					"outbox": bson.M{"event.version": bson.M{"$gt": version}},
+				},
+				"$inc":   bson.M{"version": -len(records[id])},
+				"$unset": bson.M{"batch": ""},
+			},
+		)
+	}
+
+	if _, err := bulk.Run(); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// pushEvents returns the fields to push to append events to an aggregate, with
+// the outbox records if the outbox is enabled.
+func (s *EventStore) pushEvents(dbEvents []dbEvent) bson.M {
+	push := bson.M{"events": bson.M{"$each": dbEvents}}
+	if s.outbox {
+		push["outbox"] = bson.M{"$each": s.outboxRecords(dbEvents)}
+	}
+
+	return push
+}
+
+// outboxRecords returns the outbox records for events if the outbox is
+// enabled, with the global positions as IDs.
+func (s *EventStore) outboxRecords(dbEvents []dbEvent) []outboxRecord {
+	if !s.outbox {
+		return nil
+	}
+
+	records := make([]outboxRecord, len(dbEvents))
+	for i, e := range dbEvents {
+		records[i] = outboxRecord{
+			ID:    strconv.FormatInt(e.Position, 10),
+			Event: e,
+		}
+	}
+
+	return records
+}
+
+// ClaimOutbox implements the ClaimOutbox method of the
+// eventhorizon.EventStoreOutbox interface. The entries are claimed for all
+// unpublished events of an aggregate at once, the entries of an aggregate that
+// has more than limit entries are claimed again when the first of them have
+// been marked as published. Returns ErrOutboxNotSupported if the store was not
+// created with WithOutbox.
+func (s *EventStore) ClaimOutbox(ctx context.Context, limit int, lease time.Duration) ([]eh.OutboxEntry, error) {
+	if !s.outbox {
+		return nil, eh.ErrOutboxNotSupported
+	}
+
+	sess := s.session.Copy()
+	defer sess.Close()
+	c := sess.DB(s.dbName(ctx)).C("events")
+
+	now := time.Now()
+	var aggregates []aggregateRecord
+	if err := c.Find(bson.M{
+		"outbox.0": bson.M{"$exists": true},
+		"$or": []bson.M{
+			{"outbox_claimed_until": bson.M{"$exists": false}},
+			{"outbox_claimed_until": bson.M{"$lt": now}},
+		},
+	}).Select(bson.M{
+		"outbox":               1,
+		"outbox_claimed_until": 1,
+	}).Sort("outbox.0.event.position").Limit(limit).All(&aggregates); err != nil {
+		return nil, eh.EventStoreError{
+			Err:       err,
+			Namespace: eh.Namespace(ctx),
+		}
+	}
+
+	var records []outboxRecord
+	for _, a := range aggregates {
+		// Only claim the entries of another aggregate if they all fit.
+		if len(records) > 0 && len(records)+len(a.Outbox) > limit {
+			break
+		}
+
+		// Claim the aggregate only if it was not claimed by another relay
+		// after finding it.
+		claim := bson.M{"_id": a.AggregateID}
+		if a.OutboxClaimedUntil.IsZero() {
+			claim["outbox_claimed_until"] = bson.M{"$exists": false}
+		} else {
+			claim["outbox_claimed_until"] = a.OutboxClaimedUntil
+		}
+		err := c.Update(claim, bson.M{"$set": bson.M{"outbox_claimed_until": now.Add(lease)}})
+		if err == mgo.ErrNotFound {
+			continue
+		} else if err != nil {
+			return nil, eh.EventStoreError{
+				Err:       err,
+				Namespace: eh.Namespace(ctx),
+			}
+		}
+
+		records = append(records, a.Outbox...)
+	}
+	if len(records) > limit {
+		records = records[:limit]
+	}
+
+	// Return the entries of all aggregates in the order they were saved.
+	sort.Slice(records, func(i, j int) bool {
+		return records[i].Event.Position < records[j].Event.Position
+	})
+	entries := make([]eh.OutboxEntry, len(records))
+	for i, r := range records {
+		e, err := s.buildEvent(ctx, r.Event)
+		if err != nil {
+			return nil, err
+		}
+		entries[i] = eh.OutboxEntry{ID: r.ID, Event: e}
+	}
+
+	return entries, nil
+}
+
+// MarkPublished implements the MarkPublished method of the
+// eventhorizon.EventStoreOutbox interface. The claims of the aggregates are
+// released, to let the rest of their entries be claimed. Returns
+// ErrOutboxNotSupported if the store was not created with WithOutbox.
+func (s *EventStore) MarkPublished(ctx context.Context, ids []string) error {
+	if !s.outbox {
+		return eh.ErrOutboxNotSupported
+	}
+
+	sess := s.session.Copy()
+	defer sess.Close()
+
+	if _, err := sess.DB(s.dbName(ctx)).C("events").UpdateAll(
+		bson.M{"outbox.id": bson.M{"$in": ids}},
+		bson.M{
+			"$pull":  bson.M{"outbox": bson.M{"id": bson.M{"$in": ids}}},
+			"$unset": bson.M{"outbox_claimed_until": ""},
+		},
+	); err != nil {
+		return eh.EventStoreError{
+			Err:       err,
+			Namespace: eh.Namespace(ctx),
+		}
+	}
+
+	return nil
+}
+
 // Load loads all events for the aggregate id from the database.
-// Returns ErrNoEventsFound if no events can be found.
-func (s *EventStore) Load(ctx context.Context, aggregateType eh.AggregateType, id eh.UUID) ([]eh.Event, error) {
+// Returns ErrNoEventsFound if no events can be found. The events are read with
+// a cursor, which is closed and the context error returned if the context is
+// done before all events are read. The events are limited in the DB if
+// loaded with a max number of events.
+func (s *EventStore) Load(ctx context.Context, aggregateType eh.AggregateType, id eh.UUID, opts ...eh.LoadOption) ([]eh.Event, error) {
+	pipeline := []bson.M{
+		{"$match": bson.M{"_id": id.String()}},
+		{"$unwind": "$events"},
+	}
+	if max := eh.NewLoadOptions(opts...).MaxEvents; max > 0 {
+		pipeline = append(pipeline, bson.M{"$limit": max})
+	}
+	pipeline = append(pipeline, bson.M{"$project": bson.M{"event": "$events"}})
+
+	return s.loadEvents(ctx, pipeline)
+}
+
+// LoadFrom implements the LoadFrom method of the
+// eventhorizon.EventStoreVersionLoader interface. The version is used to
+// filter the events in the DB, only the matching events are returned. The
+// context is honored while reading the events, as in Load.
+func (s *EventStore) LoadFrom(ctx context.Context, aggregateType eh.AggregateType, id eh.UUID, fromVersion int) ([]eh.Event, error) {
+	return s.loadEvents(ctx, []bson.M{
+		{"$match": bson.M{"_id": id.String()}},
+		{"$unwind": "$events"},
+		{"$match": bson.M{"events.version": bson.M{"$gte": fromVersion}}},
+		{"$project": bson.M{"event": "$events"}},
+	})
+}
+
+// LoadReverse implements the LoadReverse method of the
+// eventhorizon.EventStoreReverseLoader interface. The events are sorted and
+// limited in the DB.
+func (s *EventStore) LoadReverse(ctx context.Context, aggregateType eh.AggregateType, id eh.UUID, limit int) ([]eh.Event, error) {
+	pipeline := []bson.M{
+		{"$match": bson.M{"_id": id.String()}},
+		{"$unwind": "$events"},
+		{"$sort": bson.M{"events.version": -1}},
+	}
+	if limit > 0 {
+		pipeline = append(pipeline, bson.M{"$limit": limit})
+	}
+	pipeline = append(pipeline, bson.M{"$project": bson.M{"event": "$events"}})
+
+	return s.loadEvents(ctx, pipeline)
+}
+
+// LoadBetween implements the LoadBetween method of the
+// eventhorizon.EventStoreTimeLoader interface. The timestamps are matched in
+// the DB, with the millisecond precision of the stored timestamps.
+func (s *EventStore) LoadBetween(ctx context.Context, aggregateType eh.AggregateType, id eh.UUID, from, to time.Time) ([]eh.Event, error) {
+	pipeline := []bson.M{
+		{"$match": bson.M{"_id": id.String()}},
+		{"$unwind": "$events"},
+	}
+	timestamp := bson.M{}
+	if !from.IsZero() {
+		timestamp["$gte"] = from
+	}
+	if !to.IsZero() {
+		timestamp["$lt"] = to
+	}
+	if len(timestamp) > 0 {
+		pipeline = append(pipeline, bson.M{"$match": bson.M{"events.timestamp": timestamp}})
+	}
+	pipeline = append(pipeline, bson.M{"$project": bson.M{"event": "$events"}})
+
+	return s.loadEvents(ctx, pipeline)
+}
+
+// LoadByCorrelation implements the LoadByCorrelation method of the
+// eventhorizon.EventStoreCorrelationLoader interface. The aggregates are
+// matched with an index on the correlation ID of the events, which is created
+// on the first load in each namespace.
+func (s *EventStore) LoadByCorrelation(ctx context.Context, correlationID string) ([]eh.Event, error) {
 	sess := s.session.Copy()
 	defer sess.Close()
 
-	var aggregate aggregateRecord
-	err := sess.DB(s.dbName(ctx)).C("events").FindId(id.String()).One(&aggregate)
+	field := "events.metadata." + eh.CorrelationIDKey
+	if err := sess.DB(s.dbName(ctx)).C("events").EnsureIndex(mgo.Index{
+		Key:        []string{field},
+		Background: true,
+	}); err != nil {
+		return nil, eh.EventStoreError{
+			Err:       ErrCouldNotCreateIndex,
+			BaseErr:   err,
+			Namespace: eh.Namespace(ctx),
+		}
+	}
+
+	return s.loadEvents(ctx, []bson.M{
+		{"$match": bson.M{field: correlationID}},
+		{"$unwind": "$events"},
+		{"$match": bson.M{field: correlationID}},
+		{"$sort": bson.M{"events.timestamp": 1}},
+		{"$project": bson.M{"event": "$events"}},
+	})
+}
+
+// loadEvents loads the events projected by an aggregation pipeline with a
+// cursor, checking the context before reading each event.
+func (s *EventStore) loadEvents(ctx context.Context, pipeline []bson.M) ([]eh.Event, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	sess := s.session.Copy()
+	defer sess.Close()
+
+	iter := sess.DB(s.dbName(ctx)).C("events").Pipe(pipeline).Iter()
+
+	events := []eh.Event{}
+	var record struct {
+		Event dbEvent `bson:"event"`
+	}
+	for iter.Next(&record) {
+		if err := ctx.Err(); err != nil {
+			iter.Close()
+			return nil, err
+		}
+
+		event, err := s.buildEvent(ctx, record.Event)
+		if err != nil {
+			iter.Close()
+			return nil, err
+		}
+		events = append(events, event)
+
+		record.Event = dbEvent{}
+	}
+	if err := iter.Close(); err != nil {
+		return nil, eh.EventStoreError{
+			Err:       err,
+			Namespace: eh.Namespace(ctx),
+		}
+	}
+
+	return events, nil
+}
+
+// Delete implements the Delete method of the
+// eventhorizon.EventStoreDeleter interface.
+func (s *EventStore) Delete(ctx context.Context, aggregateType eh.AggregateType, id eh.UUID) error {
+	sess := s.session.Copy()
+	defer sess.Close()
+
+	err := sess.DB(s.dbName(ctx)).C("events").RemoveId(id.String())
 	if err == mgo.ErrNotFound {
-		return []eh.Event{}, nil
+		return eh.EventStoreError{
+			Err:       eh.ErrAggregateNotFound,
+			Namespace: eh.Namespace(ctx),
+		}
 	} else if err != nil {
-		return nil, eh.EventStoreError{
+		return eh.EventStoreError{
 			Err:       err,
 			Namespace: eh.Namespace(ctx),
 		}
 	}
 
-	events := make([]eh.Event, len(aggregate.Events))
-	for i, dbEvent := range aggregate.Events {
-		// Create an event of the correct type.
-		if data, err := eh.CreateEventData(dbEvent.EventType); err == nil {
-			// Manually decode the raw BSON event.
-			if err := dbEvent.RawData.Unmarshal(data); err != nil {
+	return nil
+}
+
+// HeadPosition implements the HeadPosition method of the
+// eventhorizon.HeadPositioner interface. It is the last reserved position,
+// which the events of saves that are still being written can have.
+func (s *EventStore) HeadPosition(ctx context.Context) (int64, error) {
+	sess := s.session.Copy()
+	defer sess.Close()
+
+	var sequence struct {
+		Position int64 `bson:"position"`
+	}
+	if err := sess.DB(s.dbName(ctx)).C("sequences").FindId("events").One(&sequence); err != nil && err != mgo.ErrNotFound {
+		return 0, eh.EventStoreError{
+			Err:       ErrCouldNotLoadAggregate,
+			BaseErr:   err,
+			Namespace: eh.Namespace(ctx),
+		}
+	}
+
+	return sequence.Position, nil
+}
+
+// ReplayAll implements the ReplayAll method of the eventhorizon.EventStreamer
+// interface. The events are sorted by the DB and streamed using a cursor.
+func (s *EventStore) ReplayAll(ctx context.Context) (<-chan eh.Event, <-chan error) {
+	return s.Replay(ctx, eh.ReplayFilter{})
+}
+
+// Replay implements the Replay method of the eventhorizon.FilteredEventStreamer
+// interface. The events are filtered and sorted by the DB and streamed using
+// a cursor.
+func (s *EventStore) Replay(ctx context.Context, filter eh.ReplayFilter) (<-chan eh.Event, <-chan error) {
+	events := make(chan eh.Event)
+	errs := make(chan error, 1)
+
+	go func() {
+		defer close(errs)
+		defer close(events)
+
+		sess := s.session.Copy()
+		defer sess.Close()
+
+		pipeline := []bson.M{{"$unwind": "$events"}}
+		if match := replayMatch(filter); len(match) > 0 {
+			pipeline = append(pipeline, bson.M{"$match": match})
+		}
+		pipeline = append(pipeline,
+			bson.M{"$sort": bson.M{"events.timestamp": 1, "_id": 1, "events.version": 1}},
+			bson.M{"$project": bson.M{"event": "$events"}},
+		)
+
+		iter := sess.DB(s.dbName(ctx)).C("events").Pipe(pipeline).AllowDiskUse().Iter()
+
+		var record struct {
+			Event dbEvent `bson:"event"`
+		}
+		for iter.Next(&record) {
+			event, err := s.buildEvent(ctx, record.Event)
+			if err != nil {
+				iter.Close()
+				errs <- err
+				return
+			}
+
+			select {
+			case events <- event:
+			case <-ctx.Done():
+				iter.Close()
+				errs <- ctx.Err()
+				return
+			}
+
+			record.Event = dbEvent{}
+		}
+		if err := iter.Close(); err != nil {
+			errs <- eh.EventStoreError{
+				Err:       err,
+				Namespace: eh.Namespace(ctx),
+			}
+		}
+	}()
+
+	return events, errs
+}
+
+// buildEvent creates an event from a record, with concrete event data if the
+// event type is registered. Event data saved with an older schema version is
+// upcasted to the current version, and old aggregate types are resolved to
+// their current name.
+func (s *EventStore) buildEvent(ctx context.Context, dbEvent dbEvent) (eh.Event, error) {
+	// Decompress the event data before it is decoded.
+	if dbEvent.Compression != "" {
+		if err := decompressData(&dbEvent); err != nil {
+			return nil, eh.EventStoreError{
+				Err:       ErrCouldNotUnmarshalEvent,
+				BaseErr:   err,
+				Namespace: eh.Namespace(ctx),
+			}
+		}
+	}
+
+	// Events saved before schema versions were stored are version 1.
+	if dbEvent.DataVersion == 0 {
+		dbEvent.DataVersion = 1
+	}
+
+	// Create an event of the correct type and version, for events with data.
+	hasData := dbEvent.RawData.Kind != 0 || dbEvent.EncodedData != nil
+	data, err := eh.CreateVersionedEventData(dbEvent.EventType, dbEvent.DataVersion)
+	if err != nil && hasData && s.strict {
+		return nil, eh.EventStoreError{
+			Err:       eh.ErrUnregisteredEventType,
+			BaseErr:   fmt.Errorf("%s version %d", dbEvent.EventType, dbEvent.DataVersion),
+			Namespace: eh.Namespace(ctx),
+		}
+	}
+	if err == nil && hasData {
+		if dbEvent.EncodedData != nil {
+			// Decode the event data with the codec, which must be the one
+			// that it was marshaled with. Data saved before the name of the
+			// codec was saved is decoded with the codec of the store.
+			if s.codec == nil {
+				return nil, eh.EventStoreError{
+					Err:       ErrIncorrectCodec,
+					BaseErr:   fmt.Errorf("marshaled with codec %q, the store has none", dbEvent.Codec),
+					Namespace: eh.Namespace(ctx),
+				}
+			}
+			if dbEvent.Codec != "" && dbEvent.Codec != s.codec.Name() {
+				return nil, eh.EventStoreError{
+					Err:       ErrIncorrectCodec,
+					BaseErr:   fmt.Errorf("marshaled with codec %q, not %q", dbEvent.Codec, s.codec.Name()),
+					Namespace: eh.Namespace(ctx),
+				}
+			}
+			if err := s.codec.Unmarshal(dbEvent.EncodedData, data); err != nil {
 				return nil, eh.EventStoreError{
 					Err:       ErrCouldNotUnmarshalEvent,
+					BaseErr:   err,
 					Namespace: eh.Namespace(ctx),
 				}
 			}
+		} else if err := dbEvent.RawData.Unmarshal(data); err != nil {
+			// Manually decode the raw BSON event.
+			return nil, eh.EventStoreError{
+				Err:       ErrCouldNotUnmarshalEvent,
+				Namespace: eh.Namespace(ctx),
+			}
+		}
 
-			// Set conrcete event and zero out the decoded event.
-			dbEvent.data = data
-			dbEvent.RawData = bson.Raw{}
+		// Upcast the event data to the current version.
+		if data, err = eh.UpcastEventData(dbEvent.EventType, dbEvent.DataVersion, data); err != nil {
+			return nil, eh.EventStoreError{
+				Err:       ErrCouldNotUnmarshalEvent,
+				BaseErr:   err,
+				Namespace: eh.Namespace(ctx),
+			}
 		}
 
-		events[i] = event{dbEvent: dbEvent}
+		// Set conrcete event and zero out the decoded event.
+		dbEvent.data = data
+		dbEvent.DataVersion = eh.EventDataVersion(dbEvent.EventType)
+		dbEvent.RawData = bson.Raw{}
+		dbEvent.EncodedData = nil
 	}
 
-	return events, nil
+	// Use the current name for events saved with an old aggregate type.
+	dbEvent.AggregateType = eh.ResolveAggregateType(dbEvent.AggregateType)
+
+	return event{dbEvent: dbEvent}, nil
+}
+
+// replayMatch creates the query for the unwound events matching a filter.
+func replayMatch(filter eh.ReplayFilter) bson.M {
+	match := bson.M{}
+	if filter.AggregateType != eh.AggregateType("") {
+		aggregateTypes := append([]eh.AggregateType{filter.AggregateType},
+			eh.AggregateTypeAliases(filter.AggregateType)...)
+		match["events.aggregate_type"] = bson.M{"$in": aggregateTypes}
+	}
+	if len(filter.EventTypes) > 0 {
+		match["events.event_type"] = bson.M{"$in": filter.EventTypes}
+	}
+	timestamp := bson.M{}
+	if !filter.From.IsZero() {
+		timestamp["$gte"] = filter.From
+	}
+	if !filter.To.IsZero() {
+		timestamp["$lt"] = filter.To
+	}
+	if len(timestamp) > 0 {
+		match["events.timestamp"] = timestamp
+	}
+	if filter.AfterPosition > 0 {
+		match["events.position"] = bson.M{"$gt": filter.AfterPosition}
+	}
+	return match
+}
+
+// reservePositions reserves global positions for a number of events that are
+// saved, by incrementing the sequence doc of the namespace. The first of the
+// positions is returned. The positions are reserved before the events are
+// written, so they are not visible in order for concurrent saves.
+func (s *EventStore) reservePositions(ctx context.Context, sess *mgo.Session, n int) (int64, error) {
+	var sequence struct {
+		Position int64 `bson:"position"`
+	}
+	if _, err := sess.DB(s.dbName(ctx)).C("sequences").FindId("events").Apply(mgo.Change{
+		Update:    bson.M{"$inc": bson.M{"position": n}},
+		Upsert:    true,
+		ReturnNew: true,
+	}, &sequence); err != nil {
+		return 0, eh.EventStoreError{
+			Err:       ErrCouldNotSaveAggregate,
+			BaseErr:   err,
+			Namespace: eh.Namespace(ctx),
+		}
+	}
+
+	return sequence.Position - int64(n) + 1, nil
+}
+
+// aggregateVersion returns the version of an aggregate, or 0 if it has no
+// events.
+func (s *EventStore) aggregateVersion(ctx context.Context, sess *mgo.Session, id eh.UUID) (int, error) {
+	var aggregate aggregateRecord
+	err := sess.DB(s.dbName(ctx)).C("events").FindId(id.String()).
+		Select(bson.M{"version": 1}).One(&aggregate)
+	if err != nil && err != mgo.ErrNotFound {
+		return 0, eh.EventStoreError{
+			Err:       ErrCouldNotSaveAggregate,
+			BaseErr:   err,
+			Namespace: eh.Namespace(ctx),
+		}
+	}
+	return aggregate.Version, nil
+}
+
+// skipDuplicates returns the number of duplicates at the start of the events,
+// which are in the stream of the aggregate, see eh.SkipDuplicateEvents.
+func (s *EventStore) skipDuplicates(ctx context.Context, sess *mgo.Session, id eh.UUID, dbEvents []dbEvent) (int, error) {
+	var aggregate struct {
+		Events []struct {
+			Metadata map[string]interface{} `bson:"metadata"`
+		} `bson:"events"`
+	}
+	err := sess.DB(s.dbName(ctx)).C("events").FindId(id.String()).
+		Select(bson.M{"events.metadata." + eh.EventIDKey: 1}).One(&aggregate)
+	if err != nil && err != mgo.ErrNotFound {
+		return 0, eh.EventStoreError{
+			Err:       ErrCouldNotSaveAggregate,
+			BaseErr:   err,
+			Namespace: eh.Namespace(ctx),
+		}
+	}
+
+	stored := map[string]bool{}
+	for _, e := range aggregate.Events {
+		if id, ok := e.Metadata[eh.EventIDKey].(string); ok {
+			stored[id] = true
+		}
+	}
+
+	ids := make([]string, len(dbEvents))
+	for i, e := range dbEvents {
+		ids[i], _ = e.Metadata[eh.EventIDKey].(string)
+	}
+
+	return eh.SkipDuplicateEvents(ctx, s.duplicates, stored, ids)
+}
+
+// versionConflict creates the error for a save that conflicted with the
+// version of the aggregate in the database.
+func (s *EventStore) versionConflict(ctx context.Context, sess *mgo.Session, id eh.UUID, expectedVersion int) error {
+	actualVersion, err := s.aggregateVersion(ctx, sess, id)
+	if err != nil {
+		return err
+	}
+	return eh.EventStoreError{
+		Err:             eh.ErrIncorrectEventVersion,
+		Namespace:       eh.Namespace(ctx),
+		ExpectedVersion: expectedVersion,
+		ActualVersion:   actualVersion,
+	}
+}
+
+// buildDBEvents creates the records for the events of an aggregate, with
+// incrementing versions starting from the original aggregate version.
+func (s *EventStore) buildDBEvents(ctx context.Context, events []eh.Event, originalVersion int) ([]dbEvent, error) {
+	dbEvents := make([]dbEvent, len(events))
+	aggregateID := events[0].AggregateID()
+	version := originalVersion
+	for i, event := range events {
+		// Only accept events belonging to the same aggregate.
+		if event.AggregateID() != aggregateID {
+			return nil, eh.EventStoreError{
+				Err:       eh.ErrInvalidEvent,
+				Namespace: eh.Namespace(ctx),
+			}
+		}
+
+		// Only accept events that apply to the correct aggregate version.
+		if event.Version() != version+1 {
+			return nil, eh.EventStoreError{
+				Err:       eh.ErrIncorrectEventVersion,
+				Namespace: eh.Namespace(ctx),
+			}
+		}
+
+		// Create the event record with timestamp.
+		dbEvents[i] = dbEvent{
+			EventType:     event.EventType(),
+			DataVersion:   eh.EventDataVersion(event.EventType()),
+			Timestamp:     event.Timestamp(),
+			AggregateType: event.AggregateType(),
+			AggregateID:   event.AggregateID(),
+			Version:       event.Version(),
+			Metadata:      event.Metadata(),
+		}
+
+		// Use the time of the store if set.
+		if s.clock != nil {
+			dbEvents[i].Timestamp = s.clock()
+		}
+
+		// Marshal event data if there is any, with the codec if set.
+		if event.Data() != nil && s.codec != nil {
+			encodedData, err := s.codec.Marshal(event.Data())
+			if err != nil {
+				return nil, eh.EventStoreError{
+					Err:       ErrCouldNotMarshalEvent,
+					BaseErr:   err,
+					Namespace: eh.Namespace(ctx),
+				}
+			}
+			dbEvents[i].EncodedData = encodedData
+			dbEvents[i].Codec = s.codec.Name()
+		} else if event.Data() != nil {
+			rawData, err := bson.Marshal(event.Data())
+			if err != nil {
+				return nil, eh.EventStoreError{
+					Err:       ErrCouldNotMarshalEvent,
+					Namespace: eh.Namespace(ctx),
+				}
+			}
+			dbEvents[i].RawData = bson.Raw{Kind: 3, Data: rawData}
+		}
+
+		// Compress the marshaled event data if it is large enough.
+		if event.Data() != nil && s.compress {
+			if err := compressData(&dbEvents[i], s.minSize); err != nil {
+				return nil, eh.EventStoreError{
+					Err:       ErrCouldNotMarshalEvent,
+					BaseErr:   err,
+					Namespace: eh.Namespace(ctx),
+				}
+			}
+		}
+
+		version++
+	}
+
+	return dbEvents, nil
+}
+
+// gzipCompression is the compression of event data compressed with gzip.
+const gzipCompression = "gzip"
+
+// compressData compresses the marshaled data of an event with gzip, if it is
+// at least minSize bytes. The compressed data is kept as the encoded data of
+// the event, for both data marshaled with a codec and as BSON.
+func compressData(e *dbEvent, minSize int) error {
+	data := e.EncodedData
+	if e.Codec == "" {
+		data = e.RawData.Data
+	}
+	if len(data) < minSize {
+		return nil
+	}
+
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+	if _, err := w.Write(data); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+
+	e.EncodedData = buf.Bytes()
+	e.RawData = bson.Raw{}
+	e.Compression = gzipCompression
+
+	return nil
+}
+
+// decompressData decompresses the data of an event compressed by
+// compressData, restoring the data marshaled with a codec or as BSON.
+func decompressData(e *dbEvent) error {
+	if e.Compression != gzipCompression {
+		return fmt.Errorf("unknown compression %q", e.Compression)
+	}
+
+	r, err := gzip.NewReader(bytes.NewReader(e.EncodedData))
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return err
+	}
+
+	if e.Codec == "" {
+		e.RawData = bson.Raw{Kind: 3, Data: data}
+		e.EncodedData = nil
+	} else {
+		e.EncodedData = data
+	}
+	e.Compression = ""
+
+	return nil
 }
 
 // Clear clears the event storge.
@@ -224,6 +1250,42 @@ func (s *EventStore) Clear(ctx context.Context) error {
 			Namespace: eh.Namespace(ctx),
 		}
 	}
+	// The dropped indexes must be created again.
+	s.session.ResetIndexCache()
+	return nil
+}
+
+// HealthCheck implements the HealthCheck method of the
+// eventhorizon.HealthChecker interface by pinging the database. The ping is
+// abandoned when the context is done, as the driver does not take a context.
+func (s *EventStore) HealthCheck(ctx context.Context) error {
+	err := ctx.Err()
+	if err == nil {
+		sess := s.session.Copy()
+		if deadline, ok := ctx.Deadline(); ok {
+			sess.SetSocketTimeout(time.Until(deadline))
+		}
+
+		errCh := make(chan error, 1)
+		go func() {
+			defer sess.Close()
+			errCh <- sess.Ping()
+		}()
+
+		select {
+		case err = <-errCh:
+		case <-ctx.Done():
+			err = ctx.Err()
+		}
+	}
+	if err != nil {
+		return eh.EventStoreError{
+			Err:       ErrCouldNotPingDB,
+			BaseErr:   err,
+			Namespace: eh.Namespace(ctx),
+		}
+	}
+
 	return nil
 }
 
@@ -233,7 +1295,8 @@ func (s *EventStore) Close() {
 }
 
 // dbName appends the namespace, if one is set, to the DB prefix to
-// get the name of the DB to use.
+// get the name of the DB to use. All namespaces share the session, with the
+// events of each namespace in a separate DB.
 func (s *EventStore) dbName(ctx context.Context) string {
 	ns := eh.Namespace(ctx)
 	return s.dbPrefix + "_" + ns
@@ -244,20 +1307,37 @@ type aggregateRecord struct {
 	AggregateID string    `bson:"_id"`
 	Version     int       `bson:"version"`
 	Events      []dbEvent `bson:"events"`
+	Batch       string    `bson:"batch,omitempty"`
+	// Outbox has the events that are not published, if the outbox is enabled,
+	// claimed by a relay until OutboxClaimedUntil.
+	Outbox             []outboxRecord `bson:"outbox,omitempty"`
+	OutboxClaimedUntil time.Time      `bson:"outbox_claimed_until,omitempty"`
 	// Type        string        `bson:"type"`
 	// Snapshot    bson.Raw      `bson:"snapshot"`
 }
 
+// outboxRecord is an event in the outbox of an aggregate.
+type outboxRecord struct {
+	ID    string  `bson:"id"`
+	Event dbEvent `bson:"event"`
+}
+
 // dbEvent is the internal event record for the MongoDB event store used
 // to save and load events from the DB.
 type dbEvent struct {
-	EventType     eh.EventType     `bson:"event_type"`
-	RawData       bson.Raw         `bson:"data,omitempty"`
-	data          eh.EventData     `bson:"-"`
-	Timestamp     time.Time        `bson:"timestamp"`
-	AggregateType eh.AggregateType `bson:"aggregate_type"`
-	AggregateID   eh.UUID          `bson:"_id"`
-	Version       int              `bson:"version"`
+	EventType     eh.EventType           `bson:"event_type"`
+	RawData       bson.Raw               `bson:"data,omitempty"`
+	EncodedData   []byte                 `bson:"encoded_data,omitempty"`
+	Codec         string                 `bson:"codec,omitempty"`
+	Compression   string                 `bson:"compression,omitempty"`
+	DataVersion   int                    `bson:"data_version,omitempty"`
+	data          eh.EventData           `bson:"-"`
+	Timestamp     time.Time              `bson:"timestamp"`
+	AggregateType eh.AggregateType       `bson:"aggregate_type"`
+	AggregateID   eh.UUID                `bson:"_id"`
+	Version       int                    `bson:"version"`
+	Metadata      map[string]interface{} `bson:"metadata,omitempty"`
+	Position      int64                  `bson:"position,omitempty"`
 }
 
 // event is the private implementation of the eventhorizon.Event interface
@@ -296,6 +1376,17 @@ func (e event) Timestamp() time.Time {
 	return e.dbEvent.Timestamp
 }
 
+// Metadata implements the Metadata method of the eventhorizon.Event interface.
+func (e event) Metadata() map[string]interface{} {
+	return e.dbEvent.Metadata
+}
+
+// GlobalPosition implements the GlobalPosition method of the
+// eventhorizon.PositionedEvent interface.
+func (e event) GlobalPosition() int64 {
+	return e.dbEvent.Position
+}
+
 // String implements the String method of the eventhorizon.Event interface.
 func (e event) String() string {
 	return fmt.Sprintf("%s@%d", e.dbEvent.EventType, e.dbEvent.Version)
@@ -15,25 +15,35 @@
 package mongodb
 
 import (
+	"bytes"
 	"context"
+	"errors"
+	"fmt"
 	"os"
+	"reflect"
+	"strings"
 	"testing"
+	"time"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
 
 	eh "github.com/looplab/eventhorizon"
+	"github.com/looplab/eventhorizon/eventstore/codec"
+	protocodec "github.com/looplab/eventhorizon/eventstore/codec/proto"
 	"github.com/looplab/eventhorizon/eventstore/testutil"
+	"github.com/looplab/eventhorizon/mocks"
 )
 
-func TestEventStore(t *testing.T) {
-	// Support Wercker testing with MongoDB.
-	host := os.Getenv("MONGO_PORT_27017_TCP_ADDR")
-	port := os.Getenv("MONGO_PORT_27017_TCP_PORT")
-
-	url := "localhost"
-	if host != "" && port != "" {
-		url = host + ":" + port
-	}
+func init() {
+	eh.RegisterEventData(ProtoEventType, func() eh.EventData { return &wrapperspb.StringValue{} })
+	eh.RegisterEventData(BSONEventType, func() eh.EventData { return &BSONEventData{} })
+}
 
-	store, err := NewEventStore(url, "test")
+func TestEventStore(t *testing.T) {
+	store, err := NewEventStore(mongoURL(), "test")
 	if err != nil {
 		t.Fatal("there should be no error:", err)
 	}
@@ -61,4 +71,717 @@ func TestEventStore(t *testing.T) {
 
 	t.Log("event store with other namespace")
 	testutil.EventStoreCommonTests(t, ctx, store)
+
+	t.Log("event streamer with default namespace")
+	testutil.EventStreamerCommonTests(t, context.Background(), store)
+
+	t.Log("event streamer with other namespace")
+	testutil.EventStreamerCommonTests(t, ctx, store)
+
+	t.Log("filtered event streamer with default namespace")
+	testutil.FilteredEventStreamerCommonTests(t, context.Background(), store)
+
+	t.Log("filtered event streamer with other namespace")
+	testutil.FilteredEventStreamerCommonTests(t, ctx, store)
+
+	t.Log("global positions with default namespace")
+	testutil.GlobalPositionCommonTests(t, context.Background(), store)
+
+	t.Log("global positions with other namespace")
+	testutil.GlobalPositionCommonTests(t, ctx, store)
+
+	t.Log("expected versions with default namespace")
+	testutil.ExpectedVersionCommonTests(t, context.Background(), store)
+
+	t.Log("expected versions with other namespace")
+	testutil.ExpectedVersionCommonTests(t, ctx, store)
+
+	t.Log("reverse loading with default namespace")
+	testutil.ReverseLoaderCommonTests(t, context.Background(), store)
+
+	t.Log("reverse loading with other namespace")
+	testutil.ReverseLoaderCommonTests(t, ctx, store)
+
+	t.Log("loading with max events with default namespace")
+	testutil.MaxEventsCommonTests(t, context.Background(), store)
+
+	t.Log("loading with max events with other namespace")
+	testutil.MaxEventsCommonTests(t, ctx, store)
+
+	t.Log("loading a time range with default namespace")
+	testutil.TimeLoaderCommonTests(t, context.Background(), store)
+
+	t.Log("loading a time range with other namespace")
+	testutil.TimeLoaderCommonTests(t, ctx, store)
+
+	t.Log("loading by correlation ID with default namespace")
+	testutil.CorrelationLoaderCommonTests(t, context.Background(), store)
+
+	t.Log("loading by correlation ID with other namespace")
+	testutil.CorrelationLoaderCommonTests(t, ctx, store)
+
+	t.Log("batch saver with default namespace")
+	testutil.EventStoreBatchSaverCommonTests(t, context.Background(), store)
+
+	t.Log("batch saver with other namespace")
+	testutil.EventStoreBatchSaverCommonTests(t, ctx, store)
+
+	t.Log("no transactions without support in the driver")
+	if _, ok := interface{}(store).(eh.TransactionalEventStore); ok {
+		t.Error("the store should not be a TransactionalEventStore")
+	}
+
+	t.Log("upcasting of event data")
+	testutil.UpcasterCommonTests(t, context.Background(), store)
+
+	t.Log("aliases of aggregate types")
+	testutil.AggregateTypeAliasCommonTests(t, context.Background(), store)
+}
+
+func TestEventStoreNamespaces(t *testing.T) {
+	store, err := NewEventStore(mongoURL(), "test")
+	if err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+
+	tenant1 := eh.WithNamespace(context.Background(), "tenant1")
+	tenant2 := eh.WithNamespace(context.Background(), "tenant2")
+
+	defer store.Close()
+	defer func() {
+		t.Log("clearing db")
+		for _, ctx := range []context.Context{context.Background(), tenant1, tenant2} {
+			if err = store.Clear(ctx); err != nil {
+				t.Fatal("there should be no error:", err)
+			}
+		}
+	}()
+
+	t.Log("events of different tenants")
+	testutil.NamespaceCommonTests(t, tenant1, tenant2, store)
+
+	t.Log("events of a tenant and the default namespace")
+	testutil.NamespaceCommonTests(t, context.Background(), tenant1, store)
+}
+
+func TestEventStoreOutbox(t *testing.T) {
+	store, err := NewEventStore(mongoURL(), "test", WithOutbox())
+	if err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	if store == nil {
+		t.Fatal("there should be a store")
+	}
+
+	ctx := eh.WithNamespace(context.Background(), "ns")
+
+	defer store.Close()
+	defer func() {
+		t.Log("clearing db")
+		if err = store.Clear(context.Background()); err != nil {
+			t.Fatal("there should be no error:", err)
+		}
+		if err = store.Clear(ctx); err != nil {
+			t.Fatal("there should be no error:", err)
+		}
+	}()
+
+	t.Log("outbox with default namespace")
+	testutil.OutboxCommonTests(t, context.Background(), store)
+
+	t.Log("outbox with other namespace")
+	testutil.OutboxCommonTests(t, ctx, store)
+}
+
+func TestEventStoreOrderedUUID(t *testing.T) {
+	eh.SetUUIDGenerator(eh.NewOrderedUUID)
+	defer eh.SetUUIDGenerator(nil)
+
+	store, err := NewEventStore(mongoURL(), "test")
+	if err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	if store == nil {
+		t.Fatal("there should be a store")
+	}
+
+	ctx := context.Background()
+
+	defer store.Close()
+	defer func() {
+		t.Log("clearing db")
+		if err = store.Clear(ctx); err != nil {
+			t.Fatal("there should be no error:", err)
+		}
+	}()
+
+	t.Log("event store with ordered ids")
+	testutil.EventStoreCommonTests(t, ctx, store)
+}
+
+func TestEventStoreTimestamps(t *testing.T) {
+	now := time.Date(2009, time.November, 10, 23, 0, 0, 0, time.UTC)
+	store, err := NewEventStore(mongoURL(), "test", WithStoreTimestamps(func() time.Time { return now }))
+	if err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	if store == nil {
+		t.Fatal("there should be a store")
+	}
+
+	ctx := context.Background()
+
+	defer store.Close()
+	defer func() {
+		t.Log("clearing db")
+		if err = store.Clear(ctx); err != nil {
+			t.Fatal("there should be no error:", err)
+		}
+	}()
+
+	testutil.StoreTimestampCommonTests(t, ctx, store, now)
+}
+
+func TestEventStoreMaxEventsPerSave(t *testing.T) {
+	store, err := NewEventStore(mongoURL(), "test", WithMaxEventsPerSave(3))
+	if err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	if store == nil {
+		t.Fatal("there should be a store")
+	}
+
+	ctx := context.Background()
+
+	defer store.Close()
+	defer func() {
+		t.Log("clearing db")
+		if err = store.Clear(ctx); err != nil {
+			t.Fatal("there should be no error:", err)
+		}
+	}()
+
+	testutil.MaxEventsPerSaveCommonTests(t, ctx, store, 3)
+}
+
+func TestEventStoreWithCodec(t *testing.T) {
+	store, err := NewEventStore(mongoURL(), "test", WithCodec(protocodec.Codec{}))
+	if err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	if store == nil {
+		t.Fatal("there should be a store")
+	}
+
+	ctx := context.Background()
+
+	defer store.Close()
+	defer func() {
+		t.Log("clearing db")
+		if err = store.Clear(ctx); err != nil {
+			t.Fatal("there should be no error:", err)
+		}
+	}()
+
+	t.Log("event store with codec")
+	testutil.EventStoreCommonTests(t, ctx, store)
+
+	t.Log("save and load proto event data")
+	id := eh.NewUUID()
+	agg := mocks.NewAggregate(id)
+	original := wrapperspb.String("event1")
+	event1 := agg.NewEvent(ProtoEventType, original)
+	agg.ApplyEvent(ctx, event1)
+	if err := store.Save(ctx, []eh.Event{event1}, 0); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	events, err := store.Load(ctx, mocks.AggregateType, id)
+	if err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	if len(events) != 1 {
+		t.Fatal("there should be one event:", events)
+	}
+	data, ok := events[0].Data().(*wrapperspb.StringValue)
+	if !ok || !proto.Equal(data, original) {
+		t.Error("the event data should be correct:", events[0].Data())
+	}
+	expected, _ := proto.Marshal(original)
+	b, err := proto.Marshal(data)
+	if err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	if !bytes.Equal(b, expected) {
+		t.Error("the event data should be byte-identical:", b, expected)
+	}
+}
+
+func TestEventStoreIncorrectCodec(t *testing.T) {
+	store, err := NewEventStore(mongoURL(), "test", WithCodec(codec.JSONCodec{}))
+	if err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	defer store.Close()
+
+	ctx := context.Background()
+	defer func() {
+		t.Log("clearing db")
+		if err = store.Clear(ctx); err != nil {
+			t.Fatal("there should be no error:", err)
+		}
+	}()
+
+	t.Log("save events with one codec")
+	id := eh.NewUUID()
+	agg := mocks.NewAggregate(id)
+	event1 := agg.NewEvent(mocks.EventType, &mocks.EventData{"event1"})
+	agg.ApplyEvent(ctx, event1)
+	if err := store.Save(ctx, []eh.Event{event1}, 0); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	events, err := store.Load(ctx, mocks.AggregateType, id)
+	if err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	if len(events) != 1 || !reflect.DeepEqual(events[0].Data(), event1.Data()) {
+		t.Error("the events should be loaded with the same codec:", events)
+	}
+
+	t.Log("load events with another codec")
+	protoStore, err := NewEventStore(mongoURL(), "test", WithCodec(protocodec.Codec{}))
+	if err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	defer protoStore.Close()
+	_, err = protoStore.Load(ctx, mocks.AggregateType, id)
+	if !errors.Is(err, ErrIncorrectCodec) {
+		t.Error("there should be a ErrIncorrectCodec error:", err)
+	}
+	if err == nil || !strings.Contains(err.Error(), `marshaled with codec "json", not "proto"`) {
+		t.Error("the error message should name the codecs:", err)
+	}
+
+	t.Log("load events without a codec")
+	bsonStore, err := NewEventStore(mongoURL(), "test")
+	if err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	defer bsonStore.Close()
+	if _, err := bsonStore.Load(ctx, mocks.AggregateType, id); !errors.Is(err, ErrIncorrectCodec) {
+		t.Error("there should be a ErrIncorrectCodec error:", err)
+	}
+}
+
+func TestEventStoreBSONData(t *testing.T) {
+	store, err := NewEventStore(mongoURL(), "test")
+	if err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	if store == nil {
+		t.Fatal("there should be a store")
+	}
+
+	ctx := context.Background()
+
+	defer store.Close()
+	defer func() {
+		t.Log("clearing db")
+		if err = store.Clear(ctx); err != nil {
+			t.Fatal("there should be no error:", err)
+		}
+	}()
+
+	t.Log("save and load event data with BSON types")
+	id := eh.NewUUID()
+	agg := mocks.NewAggregate(id)
+	original := &BSONEventData{
+		// BSON dates have millisecond precision.
+		Time:   time.Date(2026, 10, 14, 12, 30, 15, 123000000, time.UTC),
+		Binary: []byte{0, 1, 2, 255},
+		Count:  1 << 40,
+	}
+	event1 := agg.NewEvent(BSONEventType, original)
+	agg.ApplyEvent(ctx, event1)
+	if err := store.Save(ctx, []eh.Event{event1}, 0); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	events, err := store.Load(ctx, mocks.AggregateType, id)
+	if err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	if len(events) != 1 {
+		t.Fatal("there should be one event:", events)
+	}
+	data, ok := events[0].Data().(*BSONEventData)
+	if !ok {
+		t.Fatal("the event data should be of the registered type:", events[0].Data())
+	}
+	if !data.Time.Equal(original.Time) {
+		t.Error("the time should be correct:", data.Time)
+	}
+	if !bytes.Equal(data.Binary, original.Binary) || data.Count != original.Count {
+		t.Error("the event data should be correct:", data)
+	}
+
+	t.Log("event data is stored as a BSON document")
+	var record struct {
+		Events []struct {
+			Data bson.M `bson:"data"`
+		} `bson:"events"`
+	}
+	if err := store.session.DB(store.dbName(ctx)).C("events").FindId(id.String()).One(&record); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	if len(record.Events) != 1 {
+		t.Fatal("there should be one stored event:", record)
+	}
+	if _, ok := record.Events[0].Data["time"].(time.Time); !ok {
+		t.Error("the time should be stored as a BSON date:", record.Events[0].Data["time"])
+	}
+	if _, ok := record.Events[0].Data["binary"].([]byte); !ok {
+		t.Error("the bytes should be stored as BSON binary:", record.Events[0].Data["binary"])
+	}
+	if _, ok := record.Events[0].Data["count"].(int64); !ok {
+		t.Error("the count should be stored as a BSON int64:", record.Events[0].Data["count"])
+	}
+}
+
+func TestEventStoreCompression(t *testing.T) {
+	store, err := NewEventStore(mongoURL(), "test", WithCompression(1024))
+	if err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	if store == nil {
+		t.Fatal("there should be a store")
+	}
+
+	ctx := context.Background()
+
+	defer store.Close()
+	defer func() {
+		t.Log("clearing db")
+		if err = store.Clear(ctx); err != nil {
+			t.Fatal("there should be no error:", err)
+		}
+	}()
+
+	t.Log("event store with compression")
+	testutil.EventStoreCommonTests(t, ctx, store)
+
+	plainStore, err := NewEventStore(mongoURL(), "test")
+	if err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	defer plainStore.Close()
+
+	t.Log("save a small event without compression and a large one with")
+	id := eh.NewUUID()
+	agg := mocks.NewAggregate(id)
+	event1 := agg.NewEvent(mocks.EventType, &mocks.EventData{"event1"})
+	agg.ApplyEvent(ctx, event1)
+	if err := plainStore.Save(ctx, []eh.Event{event1}, 0); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	large := &mocks.EventData{strings.Repeat("event2", 1000)}
+	event2 := agg.NewEvent(mocks.EventType, large)
+	agg.ApplyEvent(ctx, event2)
+	event3 := agg.NewEvent(mocks.EventType, &mocks.EventData{"event3"})
+	agg.ApplyEvent(ctx, event3)
+	if err := store.Save(ctx, []eh.Event{event2, event3}, 1); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+
+	t.Log("only the large event data is stored compressed")
+	var record struct {
+		Events []struct {
+			Compression string `bson:"compression"`
+			EncodedData []byte `bson:"encoded_data"`
+		} `bson:"events"`
+	}
+	if err := store.session.DB(store.dbName(ctx)).C("events").FindId(id.String()).One(&record); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	if len(record.Events) != 3 {
+		t.Fatal("there should be three stored events:", record)
+	}
+	if record.Events[0].Compression != "" || record.Events[2].Compression != "" {
+		t.Error("the small event data should not be compressed:", record.Events)
+	}
+	if record.Events[1].Compression != "gzip" {
+		t.Error("the large event data should be compressed:", record.Events[1].Compression)
+	}
+	if n := len(record.Events[1].EncodedData); n == 0 || n >= len(large.Content) {
+		t.Error("the large event data should be smaller when compressed:", n)
+	}
+
+	t.Log("load the mixed events with and without compression")
+	for _, s := range []*EventStore{store, plainStore} {
+		events, err := s.Load(ctx, mocks.AggregateType, id)
+		if err != nil {
+			t.Fatal("there should be no error:", err)
+		}
+		if len(events) != 3 {
+			t.Fatal("there should be three events:", events)
+		}
+		for i, e := range []eh.Event{event1, event2, event3} {
+			if !reflect.DeepEqual(events[i].Data(), e.Data()) {
+				t.Error("the event data should be identical:", i, events[i].Data())
+			}
+		}
+	}
+}
+
+func TestCompressData(t *testing.T) {
+	data := bytes.Repeat([]byte("data"), 100)
+
+	t.Log("data smaller than the min size")
+	e := dbEvent{EncodedData: data, Codec: "json"}
+	if err := compressData(&e, 1000); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	if e.Compression != "" || !bytes.Equal(e.EncodedData, data) {
+		t.Error("the data should not be compressed:", e.Compression)
+	}
+
+	t.Log("data marshaled with a codec")
+	if err := compressData(&e, 100); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	if e.Compression != gzipCompression || len(e.EncodedData) >= len(data) {
+		t.Error("the data should be compressed:", e.Compression, len(e.EncodedData))
+	}
+	if err := decompressData(&e); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	if e.Compression != "" || !bytes.Equal(e.EncodedData, data) {
+		t.Error("the data should be decompressed:", e.Compression, e.EncodedData)
+	}
+
+	t.Log("data marshaled as BSON")
+	e = dbEvent{RawData: bson.Raw{Kind: 3, Data: data}}
+	if err := compressData(&e, 100); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	if e.Compression != gzipCompression || e.RawData.Kind != 0 {
+		t.Error("the data should be compressed:", e.Compression, e.RawData)
+	}
+	if err := decompressData(&e); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	if e.RawData.Kind != 3 || !bytes.Equal(e.RawData.Data, data) || e.EncodedData != nil {
+		t.Error("the data should be decompressed:", e.RawData, e.EncodedData)
+	}
+
+	t.Log("unknown compression")
+	e = dbEvent{EncodedData: data, Compression: "zstd"}
+	if err := decompressData(&e); err == nil {
+		t.Error("there should be an error")
+	}
+}
+
+func TestEventStoreLoadCancel(t *testing.T) {
+	mgo.SetStats(true)
+	defer mgo.SetStats(false)
+
+	store, err := NewEventStore(mongoURL(), "test")
+	if err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	defer store.Close()
+
+	ctx := context.Background()
+	defer func() {
+		t.Log("clearing db")
+		if err = store.Clear(ctx); err != nil {
+			t.Fatal("there should be no error:", err)
+		}
+	}()
+
+	t.Log("save a large number of events")
+	id := eh.NewUUID()
+	agg := mocks.NewAggregate(id)
+	events := make([]eh.Event, 1000)
+	for i := range events {
+		events[i] = agg.NewEvent(mocks.EventType, &mocks.EventData{fmt.Sprintf("event%d", i+1)})
+		agg.ApplyEvent(ctx, events[i])
+	}
+	if err := store.Save(ctx, events, 0); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	socketsInUse := mgo.GetStats().SocketsInUse
+
+	t.Log("load with a cancelled context")
+	cancelledCtx, cancel := context.WithCancel(ctx)
+	cancel()
+	if _, err := store.Load(cancelledCtx, mocks.AggregateType, id); err != context.Canceled {
+		t.Error("there should be a context.Canceled error:", err)
+	}
+
+	t.Log("cancel the context while loading")
+	start := time.Now()
+	loaded, err := store.Load(newCancelAfterContext(ctx, 10), mocks.AggregateType, id)
+	if err != context.Canceled {
+		t.Error("there should be a context.Canceled error:", err)
+	}
+	if loaded != nil {
+		t.Error("there should be no events:", len(loaded))
+	}
+	if d := time.Since(start); d > time.Second {
+		t.Error("the load should return quickly:", d)
+	}
+
+	t.Log("cancel the context while loading from a version")
+	if _, err := store.LoadFrom(newCancelAfterContext(ctx, 10), mocks.AggregateType, id, 2); err != context.Canceled {
+		t.Error("there should be a context.Canceled error:", err)
+	}
+	if n := mgo.GetStats().SocketsInUse; n != socketsInUse {
+		t.Error("the cursor sockets should be released:", n, socketsInUse)
+	}
+
+	t.Log("load without cancelling the context")
+	loaded, err = store.Load(ctx, mocks.AggregateType, id)
+	if err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if len(loaded) != len(events) {
+		t.Error("all events should be loaded:", len(loaded))
+	}
+}
+
+// cancelAfterContext is a context that is cancelled when its error has been
+// checked a number of times, to cancel it while events are read.
+type cancelAfterContext struct {
+	context.Context
+	cancel func()
+	n      int
+}
+
+func newCancelAfterContext(ctx context.Context, n int) *cancelAfterContext {
+	ctx, cancel := context.WithCancel(ctx)
+	return &cancelAfterContext{ctx, cancel, n}
+}
+
+func (c *cancelAfterContext) Err() error {
+	if c.n--; c.n < 0 {
+		c.cancel()
+	}
+	return c.Context.Err()
+}
+
+func mongoURL() string {
+	// Support Wercker testing with MongoDB.
+	host := os.Getenv("MONGO_PORT_27017_TCP_ADDR")
+	port := os.Getenv("MONGO_PORT_27017_TCP_PORT")
+
+	url := "localhost"
+	if host != "" && port != "" {
+		url = host + ":" + port
+	}
+	return url
+}
+
+// ProtoEventType is the event type for the protobuf event data, a generated
+// message of the well-known types.
+const ProtoEventType eh.EventType = "ProtoEvent"
+
+// BSONEventType is the event type for BSONEventData.
+const BSONEventType eh.EventType = "BSONEvent"
+
+// BSONEventData is event data with values that have their own BSON types.
+type BSONEventData struct {
+	Time   time.Time `bson:"time"`
+	Binary []byte    `bson:"binary"`
+	Count  int64     `bson:"count"`
+}
+
+func TestEventStoreHealthCheck(t *testing.T) {
+	store, err := NewEventStore(mongoURL(), "test")
+	if err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	defer store.Close()
+
+	if err := store.HealthCheck(context.Background()); err != nil {
+		t.Error("there should be no error:", err)
+	}
+
+	t.Log("health check with a context that is done")
+	ctx, cancel := context.WithTimeout(context.Background(), time.Nanosecond)
+	defer cancel()
+	<-ctx.Done()
+	err = store.HealthCheck(ctx)
+	if !errors.Is(err, ErrCouldNotPingDB) {
+		t.Error("there should be a could not ping error:", err)
+	}
+}
+
+func TestEventStoreDuplicateEvents(t *testing.T) {
+	for _, d := range []eh.DuplicateEvents{eh.DuplicateEventsRejected, eh.DuplicateEventsSkipped} {
+		store, err := NewEventStore(mongoURL(), "test", WithDuplicateEvents(d))
+		if err != nil {
+			t.Fatal("there should be no error:", err)
+		}
+		defer store.Close()
+
+		ctx := context.Background()
+		defer func() {
+			t.Log("clearing db")
+			if err = store.Clear(ctx); err != nil {
+				t.Fatal("there should be no error:", err)
+			}
+		}()
+
+		t.Log("duplicate events with option", d)
+		testutil.DuplicateEventsCommonTests(t, ctx, store, d)
+	}
+}
+
+func TestEventStoreRevertBatch(t *testing.T) {
+	store, err := NewEventStore(mongoURL(), "test")
+	if err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	defer store.Close()
+
+	ctx := context.Background()
+	defer func() {
+		t.Log("clearing db")
+		if err = store.Clear(ctx); err != nil {
+			t.Fatal("there should be no error:", err)
+		}
+	}()
+
+	id := eh.NewUUID()
+	agg := mocks.NewAggregate(id)
+	event1 := agg.NewEvent(mocks.EventType, &mocks.EventData{"event1"})
+	agg.ApplyEvent(ctx, event1)
+	if err := store.SaveBatch(ctx, map[eh.UUID][]eh.Event{id: {event1}}, nil); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	var record struct {
+		Batch string `bson:"batch"`
+	}
+	if err := store.session.DB(store.dbName(ctx)).C("events").FindId(id.String()).One(&record); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+
+	t.Log("keep an aggregate that was changed after the batch")
+	event2 := agg.NewEvent(mocks.EventType, &mocks.EventData{"event2"})
+	agg.ApplyEvent(ctx, event2)
+	if err := store.Save(ctx, []eh.Event{event2}, 1); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	sess := store.session.Copy()
+	defer sess.Close()
+	records := map[string][]dbEvent{id.String(): make([]dbEvent, 1)}
+	if err := store.revertBatch(ctx, sess, record.Batch, []string{id.String()}, records, map[eh.UUID]int{}); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	events, err := store.Load(ctx, mocks.AggregateType, id)
+	if err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if len(events) != 2 {
+		t.Error("the events of the other save should be kept:", events)
+	}
 }
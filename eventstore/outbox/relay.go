@@ -0,0 +1,142 @@
+// Copyright (c) 2016 - Max Ekman <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package outbox
+
+import (
+	"context"
+	"time"
+
+	eh "github.com/looplab/eventhorizon"
+)
+
+// Relay publishes the events in the outbox of an event store on an event bus,
+// used with event stores that record saved events in an outbox instead of
+// publishing them directly. Events are published at least once, in the order
+// that they were saved, as an entry is only removed from the outbox after it
+// has been published.
+type Relay struct {
+	outbox    eh.EventStoreOutbox
+	publisher eh.EventPublisher
+	batchSize int
+	lease     time.Duration
+	interval  time.Duration
+	logger    eh.Logger
+}
+
+// Option is an option setter used to configure creation.
+type Option func(*Relay)
+
+// WithBatchSize sets the max number of entries to claim at a time, the
+// default is 100.
+func WithBatchSize(n int) Option {
+	return func(r *Relay) {
+		r.batchSize = n
+	}
+}
+
+// WithLease sets how long claimed entries are kept from other relays, which
+// should be longer than it takes to publish a batch. The default is 30s.
+func WithLease(d time.Duration) Option {
+	return func(r *Relay) {
+		r.lease = d
+	}
+}
+
+// WithPollInterval sets how long to wait before claiming again when the
+// outbox is empty or an error occurred, the default is 1s.
+func WithPollInterval(d time.Duration) Option {
+	return func(r *Relay) {
+		r.interval = d
+	}
+}
+
+// WithLogger sets the logger used to log errors when running.
+func WithLogger(logger eh.Logger) Option {
+	return func(r *Relay) {
+		r.logger = logger
+	}
+}
+
+// NewRelay creates a relay that publishes the outbox entries with a publisher.
+func NewRelay(outbox eh.EventStoreOutbox, publisher eh.EventPublisher, opts ...Option) *Relay {
+	r := &Relay{
+		outbox:    outbox,
+		publisher: publisher,
+		batchSize: 100,
+		lease:     30 * time.Second,
+		interval:  time.Second,
+	}
+
+	for _, opt := range opts {
+		opt(r)
+	}
+
+	if r.logger == nil {
+		r.logger = eh.NopLogger{}
+	}
+
+	return r
+}
+
+// RelayOnce claims a batch of entries and publishes them in order, returning
+// the number of published entries. Publishing stops at the first error, the
+// entries published before it are still marked as published.
+func (r *Relay) RelayOnce(ctx context.Context) (int, error) {
+	entries, err := r.outbox.ClaimOutbox(ctx, r.batchSize, r.lease)
+	if err != nil {
+		return 0, err
+	}
+
+	var publishErr error
+	ids := make([]string, 0, len(entries))
+	for _, e := range entries {
+		if publishErr = r.publisher.PublishEvent(ctx, e.Event); publishErr != nil {
+			break
+		}
+		ids = append(ids, e.ID)
+	}
+
+	if len(ids) > 0 {
+		if err := r.outbox.MarkPublished(ctx, ids); err != nil {
+			return 0, err
+		}
+	}
+
+	return len(ids), publishErr
+}
+
+// Run relays the outbox until the context is cancelled, waiting the poll
+// interval when the outbox is empty. Errors are logged and retried after the
+// poll interval. Returns the error of the context when done.
+func (r *Relay) Run(ctx context.Context) error {
+	for {
+		n, err := r.RelayOnce(ctx)
+		if err != nil {
+			r.logger.Error("outbox: could not relay events",
+				"error", err,
+			)
+		}
+
+		if n == 0 || err != nil {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(r.interval):
+			}
+		} else if ctx.Err() != nil {
+			return ctx.Err()
+		}
+	}
+}
@@ -0,0 +1,143 @@
+// Copyright (c) 2016 - Max Ekman <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package outbox
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	eh "github.com/looplab/eventhorizon"
+	"github.com/looplab/eventhorizon/eventstore/memory"
+	"github.com/looplab/eventhorizon/mocks"
+)
+
+func TestRelayOnce(t *testing.T) {
+	ctx := context.Background()
+	store := memory.NewEventStore(memory.WithOutbox())
+	publisher := &failingPublisher{failAt: 2}
+	relay := NewRelay(store, publisher, WithBatchSize(2), WithLease(0))
+
+	id := eh.NewUUID()
+	agg := mocks.NewAggregate(id)
+	var events []eh.Event
+	for i := 0; i < 3; i++ {
+		event := agg.NewEvent(mocks.EventType, &mocks.EventData{"event"})
+		agg.ApplyEvent(ctx, event) // Apply event to increment the aggregate version.
+		events = append(events, event)
+	}
+	if err := store.Save(ctx, events, 0); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+
+	t.Log("relay a batch, failing on the second event")
+	n, err := relay.RelayOnce(ctx)
+	if !errors.Is(err, errPublish) {
+		t.Error("there should be a publish error:", err)
+	}
+	if n != 1 || len(publisher.events) != 1 {
+		t.Fatal("there should be one published event:", n, publisher.events)
+	}
+
+	t.Log("relay the rest of the events")
+	publisher.failAt = 0
+	if n, err = relay.RelayOnce(ctx); err != nil || n != 2 {
+		t.Error("there should be two published events:", n, err)
+	}
+	if n, err = relay.RelayOnce(ctx); err != nil || n != 0 {
+		t.Error("there should be no published events:", n, err)
+	}
+	if len(publisher.events) != 3 {
+		t.Fatal("there should be three published events:", publisher.events)
+	}
+	for i, e := range publisher.events {
+		if err := mocks.CompareEvents(e, events[i]); err != nil {
+			t.Error("the event was incorrect:", err)
+		}
+		if e.Version() != i+1 {
+			t.Error("the events should be published in order:", e.Version())
+		}
+	}
+
+	t.Log("relay with a store without an outbox")
+	relay = NewRelay(memory.NewEventStore(), publisher)
+	if _, err := relay.RelayOnce(ctx); err != eh.ErrOutboxNotSupported {
+		t.Error("there should be a ErrOutboxNotSupported error:", err)
+	}
+}
+
+func TestRelayRun(t *testing.T) {
+	store := memory.NewEventStore(memory.WithOutbox())
+	publisher := &mocks.EventBus{}
+	relay := NewRelay(store, publisher, WithPollInterval(time.Millisecond))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- relay.Run(ctx) }()
+
+	id := eh.NewUUID()
+	agg := mocks.NewAggregate(id)
+	event := agg.NewEvent(mocks.EventType, &mocks.EventData{"event"})
+	agg.ApplyEvent(ctx, event) // Apply event to increment the aggregate version.
+	if err := store.Save(ctx, []eh.Event{event}, 0); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+
+	t.Log("wait for the event to be relayed")
+	deadline := time.Now().Add(time.Second)
+	for {
+		entries, err := store.ClaimOutbox(context.Background(), 10, 0)
+		if err != nil {
+			t.Fatal("there should be no error:", err)
+		}
+		if len(entries) == 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("the event should be relayed")
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	cancel()
+	if err := <-done; err != context.Canceled {
+		t.Error("there should be a context.Canceled error:", err)
+	}
+	if len(publisher.Events) != 1 {
+		t.Fatal("there should be one published event:", publisher.Events)
+	}
+	if err := mocks.CompareEvents(publisher.Events[0], event); err != nil {
+		t.Error("the event was incorrect:", err)
+	}
+}
+
+var errPublish = errors.New("publish error")
+
+// failingPublisher is a publisher that fails to publish its failAt:th event.
+type failingPublisher struct {
+	events []eh.Event
+	calls  int
+	failAt int
+}
+
+func (p *failingPublisher) PublishEvent(ctx context.Context, event eh.Event) error {
+	p.calls++
+	if p.calls == p.failAt {
+		return errPublish
+	}
+	p.events = append(p.events, event)
+	return nil
+}
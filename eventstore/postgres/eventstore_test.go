@@ -0,0 +1,176 @@
+// Copyright (c) 2016 - Max Ekman <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"os"
+	"testing"
+
+	eh "github.com/looplab/eventhorizon"
+	"github.com/looplab/eventhorizon/eventstore/testutil"
+)
+
+func TestEventStore(t *testing.T) {
+	db, err := sql.Open("postgres", "postgres://postgres@"+postgresAddr()+"/postgres?sslmode=disable")
+	if err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	defer db.Close()
+
+	store, err := NewEventStore(db, WithTableName("test_events"))
+	if err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	if store == nil {
+		t.Fatal("there should be a store")
+	}
+
+	if err := store.Migrate(context.Background()); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+
+	ctx := eh.WithNamespace(context.Background(), "ns")
+
+	defer func() {
+		t.Log("clearing db")
+		if err = store.Clear(context.Background()); err != nil {
+			t.Fatal("there should be no error:", err)
+		}
+		if err = store.Clear(ctx); err != nil {
+			t.Fatal("there should be no error:", err)
+		}
+	}()
+
+	// Run the actual test suite.
+
+	t.Log("event store with default namespace")
+	testutil.EventStoreCommonTests(t, context.Background(), store)
+
+	t.Log("event store with other namespace")
+	testutil.EventStoreCommonTests(t, ctx, store)
+
+	t.Log("event streamer with default namespace")
+	testutil.EventStreamerCommonTests(t, context.Background(), store)
+
+	t.Log("event streamer with other namespace")
+	testutil.EventStreamerCommonTests(t, ctx, store)
+
+	t.Log("filtered event streamer with default namespace")
+	testutil.FilteredEventStreamerCommonTests(t, context.Background(), store)
+
+	t.Log("filtered event streamer with other namespace")
+	testutil.FilteredEventStreamerCommonTests(t, ctx, store)
+
+	t.Log("global positions with default namespace")
+	testutil.GlobalPositionCommonTests(t, context.Background(), store)
+
+	t.Log("global positions with other namespace")
+	testutil.GlobalPositionCommonTests(t, ctx, store)
+
+	t.Log("expected versions with default namespace")
+	testutil.ExpectedVersionCommonTests(t, context.Background(), store)
+
+	t.Log("expected versions with other namespace")
+	testutil.ExpectedVersionCommonTests(t, ctx, store)
+
+	t.Log("reverse loading with default namespace")
+	testutil.ReverseLoaderCommonTests(t, context.Background(), store)
+
+	t.Log("reverse loading with other namespace")
+	testutil.ReverseLoaderCommonTests(t, ctx, store)
+
+	t.Log("loading with max events with default namespace")
+	testutil.MaxEventsCommonTests(t, context.Background(), store)
+
+	t.Log("loading with max events with other namespace")
+	testutil.MaxEventsCommonTests(t, ctx, store)
+
+	t.Log("loading a time range with default namespace")
+	testutil.TimeLoaderCommonTests(t, context.Background(), store)
+
+	t.Log("loading a time range with other namespace")
+	testutil.TimeLoaderCommonTests(t, ctx, store)
+
+	t.Log("upcasting of event data")
+	testutil.UpcasterCommonTests(t, context.Background(), store)
+}
+
+func TestEventStoreMaxEventsPerSave(t *testing.T) {
+	db, err := sql.Open("postgres", "postgres://postgres@"+postgresAddr()+"/postgres?sslmode=disable")
+	if err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	defer db.Close()
+
+	store, err := NewEventStore(db, WithTableName("test_events"), WithMaxEventsPerSave(3))
+	if err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	if err := store.Migrate(context.Background()); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+
+	ctx := context.Background()
+
+	defer func() {
+		t.Log("clearing db")
+		if err = store.Clear(ctx); err != nil {
+			t.Fatal("there should be no error:", err)
+		}
+	}()
+
+	testutil.MaxEventsPerSaveCommonTests(t, ctx, store, 3)
+}
+
+// postgresAddr returns the address of the database to test with.
+func postgresAddr() string {
+	// Support Wercker testing with PostgreSQL.
+	host := os.Getenv("POSTGRES_PORT_5432_TCP_ADDR")
+	port := os.Getenv("POSTGRES_PORT_5432_TCP_PORT")
+
+	if host != "" && port != "" {
+		return host + ":" + port
+	}
+	return "localhost:5432"
+}
+
+func TestNewEventStore(t *testing.T) {
+	store, err := NewEventStore(nil)
+	if err != ErrNoDB {
+		t.Error("there should be a ErrNoDB error:", err)
+	}
+	if store != nil {
+		t.Error("there should be no store:", store)
+	}
+
+	db := &sql.DB{}
+	store, err = NewEventStore(db, WithTableName("drop table events;"))
+	if err != ErrInvalidTableName {
+		t.Error("there should be a ErrInvalidTableName error:", err)
+	}
+	if store != nil {
+		t.Error("there should be no store:", store)
+	}
+
+	store, err = NewEventStore(db, WithTableName("my_events"))
+	if err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if store == nil || store.table != "my_events" {
+		t.Error("the table name should be set:", store)
+	}
+}
@@ -0,0 +1,227 @@
+// Copyright (c) 2016 - Max Ekman <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package readonly contains an event store that rejects all writes, for
+// example for analytics replicas and archival access.
+package readonly
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	eh "github.com/looplab/eventhorizon"
+)
+
+// ErrNoEventStoreDefined is if no event store has been defined.
+var ErrNoEventStoreDefined = errors.New("no event store defined")
+
+// ErrReadOnly is when events or snapshots are saved in a read-only store.
+var ErrReadOnly = errors.New("event store is read-only")
+
+// EventStore wraps an EventStore and rejects all saves with ErrReadOnly, while
+// loads and replays are passed through to the base store. Saving events by
+// mistake, for example in a misconfigured service, fails instead of writing to
+// the store. Deleting, compacting and the outbox are not supported.
+type EventStore struct {
+	eventStore eh.EventStore
+}
+
+// NewEventStore creates a new EventStore.
+func NewEventStore(eventStore eh.EventStore) (*EventStore, error) {
+	if eventStore == nil {
+		return nil, ErrNoEventStoreDefined
+	}
+
+	s := &EventStore{
+		eventStore: eventStore,
+	}
+	return s, nil
+}
+
+// Save implements the Save method of the eventhorizon.EventStore interface.
+// It always returns ErrReadOnly.
+func (s *EventStore) Save(ctx context.Context, events []eh.Event, originalVersion int) error {
+	return eh.EventStoreError{
+		Err:       ErrReadOnly,
+		Namespace: eh.Namespace(ctx),
+	}
+}
+
+// SaveBatch implements the SaveBatch method of the
+// eventhorizon.EventStoreBatchSaver interface. It always returns ErrReadOnly.
+func (s *EventStore) SaveBatch(ctx context.Context, events map[eh.UUID][]eh.Event, expectedVersions map[eh.UUID]int) error {
+	return eh.EventStoreError{
+		Err:       ErrReadOnly,
+		Namespace: eh.Namespace(ctx),
+	}
+}
+
+// Load loads all events for the aggregate id from the base store.
+func (s *EventStore) Load(ctx context.Context, aggregateType eh.AggregateType, id eh.UUID, opts ...eh.LoadOption) ([]eh.Event, error) {
+	return s.eventStore.Load(ctx, aggregateType, id, opts...)
+}
+
+// LoadFrom loads the events from a version for the aggregate id from the base
+// store. If the base store can not load from a version all events are loaded
+// and filtered instead.
+func (s *EventStore) LoadFrom(ctx context.Context, aggregateType eh.AggregateType, id eh.UUID, fromVersion int) ([]eh.Event, error) {
+	if loader, ok := s.eventStore.(eh.EventStoreVersionLoader); ok {
+		return loader.LoadFrom(ctx, aggregateType, id, fromVersion)
+	}
+
+	events, err := s.eventStore.Load(ctx, aggregateType, id)
+	if err != nil {
+		return nil, err
+	}
+
+	filtered := []eh.Event{}
+	for _, event := range events {
+		if event.Version() >= fromVersion {
+			filtered = append(filtered, event)
+		}
+	}
+
+	return filtered, nil
+}
+
+// LoadReverse loads up to limit events for the aggregate id from the base
+// store, newest first. If the base store can not load events in reverse all
+// events are loaded and reversed instead.
+func (s *EventStore) LoadReverse(ctx context.Context, aggregateType eh.AggregateType, id eh.UUID, limit int) ([]eh.Event, error) {
+	if loader, ok := s.eventStore.(eh.EventStoreReverseLoader); ok {
+		return loader.LoadReverse(ctx, aggregateType, id, limit)
+	}
+
+	events, err := s.eventStore.Load(ctx, aggregateType, id)
+	if err != nil {
+		return nil, err
+	}
+
+	reversed := []eh.Event{}
+	for i := len(events) - 1; i >= 0 && (limit <= 0 || len(reversed) < limit); i-- {
+		reversed = append(reversed, events[i])
+	}
+
+	return reversed, nil
+}
+
+// LoadBetween loads the events within a time range for the aggregate id from
+// the base store. If the base store can not load a time range all events are
+// loaded and filtered instead.
+func (s *EventStore) LoadBetween(ctx context.Context, aggregateType eh.AggregateType, id eh.UUID, from, to time.Time) ([]eh.Event, error) {
+	if loader, ok := s.eventStore.(eh.EventStoreTimeLoader); ok {
+		return loader.LoadBetween(ctx, aggregateType, id, from, to)
+	}
+
+	events, err := s.eventStore.Load(ctx, aggregateType, id)
+	if err != nil {
+		return nil, err
+	}
+
+	filter := eh.ReplayFilter{From: from, To: to}
+	filtered := []eh.Event{}
+	for _, e := range events {
+		if filter.Match(e) {
+			filtered = append(filtered, e)
+		}
+	}
+
+	return filtered, nil
+}
+
+// LoadByCorrelation loads the events with a correlation ID from the base store
+// if it supports it. Returns ErrCorrelationLoadNotSupported if the base store
+// does not support it.
+func (s *EventStore) LoadByCorrelation(ctx context.Context, correlationID string) ([]eh.Event, error) {
+	loader, ok := s.eventStore.(eh.EventStoreCorrelationLoader)
+	if !ok {
+		return nil, eh.ErrCorrelationLoadNotSupported
+	}
+
+	return loader.LoadByCorrelation(ctx, correlationID)
+}
+
+// ReplayAll replays all events from the base store if it supports it.
+// Sends ErrReplayNotSupported on the error channel if the base store does not
+// support it.
+func (s *EventStore) ReplayAll(ctx context.Context) (<-chan eh.Event, <-chan error) {
+	if streamer, ok := s.eventStore.(eh.EventStreamer); ok {
+		return streamer.ReplayAll(ctx)
+	}
+
+	return replayNotSupported()
+}
+
+// HeadPosition returns the head position of the base store if it supports it.
+// Returns ErrHeadPositionNotSupported if the base store does not support it.
+func (s *EventStore) HeadPosition(ctx context.Context) (int64, error) {
+	positioner, ok := s.eventStore.(eh.HeadPositioner)
+	if !ok {
+		return 0, eh.ErrHeadPositionNotSupported
+	}
+
+	return positioner.HeadPosition(ctx)
+}
+
+// Replay replays the events matching the filter from the base store if it
+// supports it. Sends ErrReplayNotSupported on the error channel if the base
+// store does not support it.
+func (s *EventStore) Replay(ctx context.Context, filter eh.ReplayFilter) (<-chan eh.Event, <-chan error) {
+	if streamer, ok := s.eventStore.(eh.FilteredEventStreamer); ok {
+		return streamer.Replay(ctx, filter)
+	}
+
+	return replayNotSupported()
+}
+
+// SaveSnapshot implements the SaveSnapshot method of the
+// eventhorizon.SnapshotStore interface. It always returns ErrReadOnly.
+func (s *EventStore) SaveSnapshot(ctx context.Context, aggregateType eh.AggregateType, id eh.UUID, version int, state interface{}) error {
+	return eh.EventStoreError{
+		Err:       ErrReadOnly,
+		Namespace: eh.Namespace(ctx),
+	}
+}
+
+// LoadSnapshot loads a snapshot from the base store if it supports snapshots.
+// Returns ErrSnapshotsNotSupported if the base store does not support it.
+func (s *EventStore) LoadSnapshot(ctx context.Context, aggregateType eh.AggregateType, id eh.UUID) (interface{}, int, error) {
+	snapshotStore, ok := s.eventStore.(eh.SnapshotStore)
+	if !ok {
+		return nil, 0, eh.ErrSnapshotsNotSupported
+	}
+
+	return snapshotStore.LoadSnapshot(ctx, aggregateType, id)
+}
+
+// HealthCheck checks the base store if it supports health checks.
+func (s *EventStore) HealthCheck(ctx context.Context) error {
+	if checker, ok := s.eventStore.(eh.HealthChecker); ok {
+		return checker.HealthCheck(ctx)
+	}
+
+	return nil
+}
+
+// replayNotSupported returns closed channels with ErrReplayNotSupported.
+func replayNotSupported() (<-chan eh.Event, <-chan error) {
+	events := make(chan eh.Event)
+	errs := make(chan error, 1)
+	errs <- eh.ErrReplayNotSupported
+	close(events)
+	close(errs)
+
+	return events, errs
+}
@@ -0,0 +1,187 @@
+// Copyright (c) 2016 - Max Ekman <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package readonly
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	eh "github.com/looplab/eventhorizon"
+	"github.com/looplab/eventhorizon/eventstore/memory"
+	"github.com/looplab/eventhorizon/mocks"
+)
+
+func TestNewEventStore(t *testing.T) {
+	store, err := NewEventStore(nil)
+	if !errors.Is(err, ErrNoEventStoreDefined) {
+		t.Error("there should be a ErrNoEventStoreDefined error:", err)
+	}
+	if store != nil {
+		t.Error("there should be no store:", store)
+	}
+}
+
+func TestEventStore(t *testing.T) {
+	ctx := context.Background()
+
+	baseStore := memory.NewEventStore()
+	store, err := NewEventStore(baseStore)
+	if err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+
+	id := eh.NewUUID()
+	agg := mocks.NewAggregate(id)
+	event1 := agg.NewEvent(mocks.EventType, &mocks.EventData{Content: "event1"})
+	agg.ApplyEvent(ctx, event1)
+	event2 := agg.NewEvent(mocks.EventType, &mocks.EventData{Content: "event2"})
+	agg.ApplyEvent(ctx, event2)
+	if err := baseStore.Save(ctx, []eh.Event{event1, event2}, 0); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	if err := baseStore.SaveSnapshot(ctx, mocks.AggregateType, id, 2, &mocks.EventData{Content: "snapshot"}); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+
+	t.Log("load events from the base store")
+	events, err := store.Load(ctx, mocks.AggregateType, id)
+	if err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if err := compareEvents(events, []eh.Event{event1, event2}); err != nil {
+		t.Error("the events should be correct:", err)
+	}
+
+	t.Log("load events from a version")
+	events, err = store.LoadFrom(ctx, mocks.AggregateType, id, 2)
+	if err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if err := compareEvents(events, []eh.Event{event2}); err != nil {
+		t.Error("the events should be correct:", err)
+	}
+
+	t.Log("load events in reverse")
+	events, err = store.LoadReverse(ctx, mocks.AggregateType, id, 1)
+	if err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if err := compareEvents(events, []eh.Event{event2}); err != nil {
+		t.Error("the events should be correct:", err)
+	}
+
+	t.Log("load events in a time range")
+	events, err = store.LoadBetween(ctx, mocks.AggregateType, id, time.Time{}, time.Now().Add(time.Hour))
+	if err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if err := compareEvents(events, []eh.Event{event1, event2}); err != nil {
+		t.Error("the events should be correct:", err)
+	}
+
+	t.Log("replay all events")
+	replayed, errs := store.ReplayAll(ctx)
+	events = nil
+	for e := range replayed {
+		events = append(events, e)
+	}
+	if err := <-errs; err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if err := compareEvents(events, []eh.Event{event1, event2}); err != nil {
+		t.Error("the events should be correct:", err)
+	}
+
+	t.Log("load a snapshot")
+	state, version, err := store.LoadSnapshot(ctx, mocks.AggregateType, id)
+	if err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if version != 2 || state == nil {
+		t.Error("the snapshot should be loaded:", state, version)
+	}
+
+	t.Log("reject saving events")
+	event3 := agg.NewEvent(mocks.EventType, &mocks.EventData{Content: "event3"})
+	if err := store.Save(ctx, []eh.Event{event3}, 2); !errors.Is(err, ErrReadOnly) {
+		t.Error("there should be a ErrReadOnly error:", err)
+	}
+	err = store.SaveBatch(ctx,
+		map[eh.UUID][]eh.Event{id: {event3}},
+		map[eh.UUID]int{id: 2},
+	)
+	if !errors.Is(err, ErrReadOnly) {
+		t.Error("there should be a ErrReadOnly error:", err)
+	}
+	if err := store.SaveSnapshot(ctx, mocks.AggregateType, id, 3, &mocks.EventData{Content: "snapshot"}); !errors.Is(err, ErrReadOnly) {
+		t.Error("there should be a ErrReadOnly error:", err)
+	}
+	events, err = baseStore.Load(ctx, mocks.AggregateType, id)
+	if err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if len(events) != 2 {
+		t.Error("the base store should not be changed:", events)
+	}
+	if _, version, _ := baseStore.LoadSnapshot(ctx, mocks.AggregateType, id); version != 2 {
+		t.Error("the snapshot should not be changed:", version)
+	}
+}
+
+func TestEventStoreNotSupported(t *testing.T) {
+	ctx := context.Background()
+
+	// Only the methods of the EventStore interface.
+	store, err := NewEventStore(struct{ eh.EventStore }{memory.NewEventStore()})
+	if err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+
+	if _, err := store.LoadByCorrelation(ctx, "id"); !errors.Is(err, eh.ErrCorrelationLoadNotSupported) {
+		t.Error("there should be a ErrCorrelationLoadNotSupported error:", err)
+	}
+	if _, _, err := store.LoadSnapshot(ctx, mocks.AggregateType, eh.NewUUID()); !errors.Is(err, eh.ErrSnapshotsNotSupported) {
+		t.Error("there should be a ErrSnapshotsNotSupported error:", err)
+	}
+	_, errs := store.ReplayAll(ctx)
+	if err := <-errs; !errors.Is(err, eh.ErrReplayNotSupported) {
+		t.Error("there should be a ErrReplayNotSupported error:", err)
+	}
+	_, errs = store.Replay(ctx, eh.ReplayFilter{})
+	if err := <-errs; !errors.Is(err, eh.ErrReplayNotSupported) {
+		t.Error("there should be a ErrReplayNotSupported error:", err)
+	}
+	if _, err := store.HeadPosition(ctx); !errors.Is(err, eh.ErrHeadPositionNotSupported) {
+		t.Error("there should be a ErrHeadPositionNotSupported error:", err)
+	}
+	if err := store.Save(ctx, nil, 0); !errors.Is(err, ErrReadOnly) {
+		t.Error("there should be a ErrReadOnly error:", err)
+	}
+}
+
+func compareEvents(events, expected []eh.Event) error {
+	if len(events) != len(expected) {
+		return fmt.Errorf("incorrect number of events: %d", len(events))
+	}
+	for i, e := range events {
+		if err := mocks.CompareEvents(e, expected[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,173 @@
+// Copyright (c) 2016 - Max Ekman <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package schema contains an event store that validates the event data with
+// JSON Schemas before it is saved.
+package schema
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+
+	eh "github.com/looplab/eventhorizon"
+)
+
+// ErrNoEventStoreDefined is if no event store has been defined.
+var ErrNoEventStoreDefined = errors.New("no event store defined")
+
+// ErrEventValidation is when the data of an event does not match the schema
+// registered for its type.
+var ErrEventValidation = errors.New("event validation failed")
+
+// ErrInvalidSchema is when a schema could not be parsed.
+var ErrInvalidSchema = errors.New("invalid schema")
+
+// ErrCouldNotMarshalEvent is when the event data could not be marshaled into
+// JSON to be validated.
+var ErrCouldNotMarshalEvent = errors.New("could not marshal event")
+
+// ValidationError is the errors of the data of an event that does not match
+// the schema, used as the base error of ErrEventValidation.
+type ValidationError struct {
+	// EventType is the type of the invalid event.
+	EventType eh.EventType
+	// Version is the version of the invalid event.
+	Version int
+	// Errors are the schema errors, prefixed with the JSON pointer of the
+	// invalid values.
+	Errors []string
+}
+
+// Error implements the Error method of the errors.Error interface.
+func (e ValidationError) Error() string {
+	return string(e.EventType) + "@" + strconv.Itoa(e.Version) + ": " + strings.Join(e.Errors, ", ")
+}
+
+// EventStore wraps an EventStore and validates the data of events against
+// the JSON Schema registered for their type before they are saved. The data
+// is validated as it is marshaled into JSON; events with no registered schema
+// are saved without validation. The events are loaded from the base store
+// without validation.
+type EventStore struct {
+	eh.EventStore
+
+	schemas   map[eh.EventType]*Schema
+	schemasMu sync.RWMutex
+}
+
+// NewEventStore creates a new EventStore.
+func NewEventStore(eventStore eh.EventStore) (*EventStore, error) {
+	if eventStore == nil {
+		return nil, ErrNoEventStoreDefined
+	}
+
+	s := &EventStore{
+		EventStore: eventStore,
+		schemas:    map[eh.EventType]*Schema{},
+	}
+	return s, nil
+}
+
+// RegisterSchema registers a JSON Schema to validate the data of the events of
+// a type, replacing any schema already registered for the type. Returns
+// ErrInvalidSchema if the schema could not be parsed.
+func (s *EventStore) RegisterSchema(eventType eh.EventType, schema []byte) error {
+	compiled, err := ParseSchema(schema)
+	if err != nil {
+		return fmt.Errorf("%w: %s: %w", ErrInvalidSchema, eventType, err)
+	}
+
+	s.schemasMu.Lock()
+	defer s.schemasMu.Unlock()
+	s.schemas[eventType] = compiled
+
+	return nil
+}
+
+// Save validates the events and saves them in the base store. Returns
+// ErrEventValidation, with a ValidationError as the base error, without saving
+// any events if one is invalid.
+func (s *EventStore) Save(ctx context.Context, events []eh.Event, originalVersion int) error {
+	if err := s.validate(ctx, events); err != nil {
+		return err
+	}
+
+	return s.EventStore.Save(ctx, events, originalVersion)
+}
+
+// SaveBatch validates the events of the batch and saves it in the base store
+// if it supports it, as Save.
+// Returns ErrBatchSaveNotSupported if the base store does not support it.
+func (s *EventStore) SaveBatch(ctx context.Context, events map[eh.UUID][]eh.Event, expectedVersions map[eh.UUID]int) error {
+	saver, ok := s.EventStore.(eh.EventStoreBatchSaver)
+	if !ok {
+		return eh.ErrBatchSaveNotSupported
+	}
+
+	for _, aggregateEvents := range events {
+		if err := s.validate(ctx, aggregateEvents); err != nil {
+			return err
+		}
+	}
+
+	return saver.SaveBatch(ctx, events, expectedVersions)
+}
+
+// validate validates the data of events with a registered schema.
+func (s *EventStore) validate(ctx context.Context, events []eh.Event) error {
+	s.schemasMu.RLock()
+	defer s.schemasMu.RUnlock()
+
+	for _, e := range events {
+		schema, ok := s.schemas[e.EventType()]
+		if !ok {
+			continue
+		}
+
+		data, err := json.Marshal(e.Data())
+		if err != nil {
+			return eh.EventStoreError{
+				Err:       ErrCouldNotMarshalEvent,
+				BaseErr:   err,
+				Namespace: eh.Namespace(ctx),
+			}
+		}
+		errs, err := schema.Validate(data)
+		if err != nil {
+			return eh.EventStoreError{
+				Err:       ErrCouldNotMarshalEvent,
+				BaseErr:   err,
+				Namespace: eh.Namespace(ctx),
+			}
+		}
+		if len(errs) > 0 {
+			return eh.EventStoreError{
+				Err: ErrEventValidation,
+				BaseErr: ValidationError{
+					EventType: e.EventType(),
+					Version:   e.Version(),
+					Errors:    errs,
+				},
+				Namespace: eh.Namespace(ctx),
+			}
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,153 @@
+// Copyright (c) 2016 - Max Ekman <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package schema
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	eh "github.com/looplab/eventhorizon"
+	"github.com/looplab/eventhorizon/eventstore/memory"
+	"github.com/looplab/eventhorizon/eventstore/testutil"
+	"github.com/looplab/eventhorizon/mocks"
+)
+
+func TestEventStore(t *testing.T) {
+	store, err := NewEventStore(memory.NewEventStore())
+	if err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	if store == nil {
+		t.Fatal("there should be a store")
+	}
+
+	t.Log("event store without schemas with default namespace")
+	testutil.EventStoreCommonTests(t, context.Background(), store)
+
+	t.Log("event store without schemas with other namespace")
+	ctx := eh.WithNamespace(context.Background(), "ns")
+	testutil.EventStoreCommonTests(t, ctx, store)
+
+	t.Log("batch saver without schemas")
+	testutil.EventStoreBatchSaverCommonTests(t, context.Background(), store)
+}
+
+func TestEventStoreValidation(t *testing.T) {
+	base := memory.NewEventStore()
+	store, err := NewEventStore(base)
+	if err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	if err := store.RegisterSchema(mocks.EventType, []byte(`{
+		"type": "object",
+		"properties": {
+			"Content": {"type": "string", "minLength": 1, "pattern": "^event"}
+		},
+		"required": ["Content"]
+	}`)); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+
+	ctx := context.Background()
+	id := eh.NewUUID()
+	agg := mocks.NewAggregate(id)
+
+	t.Log("save a valid event")
+	event1 := agg.NewEvent(mocks.EventType, &mocks.EventData{"event1"})
+	agg.ApplyEvent(ctx, event1) // Apply event to increment the aggregate version.
+	if err := store.Save(ctx, []eh.Event{event1}, 0); err != nil {
+		t.Error("there should be no error:", err)
+	}
+
+	t.Log("save an invalid event")
+	event2 := agg.NewEvent(mocks.EventType, &mocks.EventData{"invalid"})
+	err = store.Save(ctx, []eh.Event{event2}, 1)
+	if !errors.Is(err, ErrEventValidation) {
+		t.Error("there should be a ErrEventValidation error:", err)
+	}
+	var validationErr ValidationError
+	if !errors.As(err, &validationErr) {
+		t.Fatal("there should be a validation error:", err)
+	}
+	expected := ValidationError{
+		EventType: mocks.EventType,
+		Version:   2,
+		Errors:    []string{`/Content: should match the pattern "^event"`},
+	}
+	if !reflect.DeepEqual(validationErr, expected) {
+		t.Error("the validation error should be correct:", validationErr)
+	}
+	if err.Error() != `event validation failed: Event@2: /Content: should match the pattern "^event" (default)` {
+		t.Error("the error message should be correct:", err.Error())
+	}
+	events, err := base.Load(ctx, mocks.AggregateType, id)
+	if err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if len(events) != 1 {
+		t.Error("the invalid event should not be saved:", events)
+	}
+
+	t.Log("save no events of a batch with an invalid event")
+	otherID := eh.NewUUID()
+	otherAgg := mocks.NewAggregate(otherID)
+	event3 := otherAgg.NewEvent(mocks.EventType, &mocks.EventData{"event1"})
+	err = store.SaveBatch(ctx, map[eh.UUID][]eh.Event{
+		id:      {event2},
+		otherID: {event3},
+	}, map[eh.UUID]int{id: 1, otherID: 0})
+	if !errors.Is(err, ErrEventValidation) {
+		t.Error("there should be a ErrEventValidation error:", err)
+	}
+	if events, _ := base.Load(ctx, mocks.AggregateType, otherID); len(events) != 0 {
+		t.Error("the valid events of the batch should not be saved:", events)
+	}
+
+	t.Log("save an event without a schema")
+	event4 := agg.NewEvent(mocks.EventOtherType, nil)
+	if err := store.Save(ctx, []eh.Event{event4}, 1); err != nil {
+		t.Error("there should be no error:", err)
+	}
+}
+
+func TestEventStoreErrors(t *testing.T) {
+	if _, err := NewEventStore(nil); err != ErrNoEventStoreDefined {
+		t.Error("there should be a ErrNoEventStoreDefined error:", err)
+	}
+
+	store, err := NewEventStore(&mocks.EventStore{})
+	if err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+
+	t.Log("register an invalid schema")
+	err = store.RegisterSchema(mocks.EventType, []byte(`{"type": 1}`))
+	if !errors.Is(err, ErrInvalidSchema) {
+		t.Error("there should be a ErrInvalidSchema error:", err)
+	}
+	if err.Error() != "invalid schema: Event: /: type should be a string or an array" {
+		t.Error("the error message should be correct:", err.Error())
+	}
+	if err := store.RegisterSchema(mocks.EventType, []byte(`{`)); !errors.Is(err, ErrInvalidSchema) {
+		t.Error("there should be a ErrInvalidSchema error:", err)
+	}
+
+	t.Log("save a batch with a base store without batch support")
+	if err := store.SaveBatch(context.Background(), map[eh.UUID][]eh.Event{}, nil); err != eh.ErrBatchSaveNotSupported {
+		t.Error("there should be a ErrBatchSaveNotSupported error:", err)
+	}
+}
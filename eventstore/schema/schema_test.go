@@ -0,0 +1,200 @@
+// Copyright (c) 2016 - Max Ekman <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package schema
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestSchemaValidate(t *testing.T) {
+	testCases := map[string]struct {
+		schema string
+		doc    string
+		errs   []string
+	}{
+		"valid object": {
+			`{"type": "object", "properties": {"name": {"type": "string"}}, "required": ["name"]}`,
+			`{"name": "a"}`,
+			[]string{},
+		},
+		"annotations": {
+			`{"$schema": "http://json-schema.org/draft-07/schema#", "title": "a", "description": "b", "type": "string"}`,
+			`"a"`,
+			[]string{},
+		},
+		"missing required property": {
+			`{"type": "object", "required": ["name"]}`,
+			`{}`,
+			[]string{`/: missing required property "name"`},
+		},
+		"wrong type": {
+			`{"type": "object", "properties": {"name": {"type": "string"}}}`,
+			`{"name": 1}`,
+			[]string{`/name: should be string`},
+		},
+		"several types": {
+			`{"type": ["string", "null"]}`,
+			`null`,
+			[]string{},
+		},
+		"integer": {
+			`{"type": "integer"}`,
+			`1.5`,
+			[]string{`/: should be integer`},
+		},
+		"no additional properties": {
+			`{"type": "object", "properties": {"a": true}, "additionalProperties": false}`,
+			`{"a": 1, "b": 2}`,
+			[]string{`/b: no value is allowed`},
+		},
+		"additional properties schema": {
+			`{"type": "object", "additionalProperties": {"type": "number"}}`,
+			`{"a": 1, "b": "2"}`,
+			[]string{`/b: should be number`},
+		},
+		"items": {
+			`{"type": "array", "items": {"type": "string"}, "minItems": 1, "maxItems": 2}`,
+			`["a", 1, "c"]`,
+			[]string{`/: should have at most 2 items`, `/1: should be string`},
+		},
+		"string length and pattern": {
+			`{"type": "string", "minLength": 2, "maxLength": 3, "pattern": "^[a-z]+$"}`,
+			`"ABCD"`,
+			[]string{`/: should be at most 3 characters`, `/: should match the pattern "^[a-z]+$"`},
+		},
+		"string length in characters": {
+			`{"type": "string", "maxLength": 2}`,
+			`"åä"`,
+			[]string{},
+		},
+		"number range": {
+			`{"type": "number", "minimum": 1, "exclusiveMaximum": 10}`,
+			`10`,
+			[]string{`/: should be less than 10`},
+		},
+		"number below minimum": {
+			`{"minimum": 1, "exclusiveMinimum": 0}`,
+			`0`,
+			[]string{`/: should be at least 1`, `/: should be more than 0`},
+		},
+		"enum": {
+			`{"enum": ["a", "b", 1]}`,
+			`"c"`,
+			[]string{`/: should be one of the enum values`},
+		},
+		"enum number": {
+			`{"enum": ["a", "b", 1]}`,
+			`1`,
+			[]string{},
+		},
+		"const": {
+			`{"const": {"a": 1}}`,
+			`{"a": 2}`,
+			[]string{`/: should be the const value`},
+		},
+		"nested errors": {
+			`{"properties": {"a": {"properties": {"b": {"type": "boolean"}}}}}`,
+			`{"a": {"b": "true"}}`,
+			[]string{`/a/b: should be boolean`},
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			schema, err := ParseSchema([]byte(tc.schema))
+			if err != nil {
+				t.Fatal("there should be no error:", err)
+			}
+			errs, err := schema.Validate([]byte(tc.doc))
+			if err != nil {
+				t.Fatal("there should be no error:", err)
+			}
+			if !reflect.DeepEqual(errs, tc.errs) {
+				t.Error("the errors should be correct:", errs)
+			}
+		})
+	}
+}
+
+func TestParseSchemaErrors(t *testing.T) {
+	testCases := map[string]struct {
+		schema string
+		err    string
+	}{
+		"not an object": {
+			`"string"`,
+			"/: schema should be an object or a boolean",
+		},
+		"invalid type": {
+			`{"properties": {"a": {"type": [1]}}}`,
+			"/properties/a: type should be a string",
+		},
+		"invalid length": {
+			`{"minLength": -1}`,
+			"/: minLength should be a non-negative integer",
+		},
+		"invalid minimum": {
+			`{"minimum": "1"}`,
+			"/: minimum should be a number",
+		},
+		"invalid pattern": {
+			`{"pattern": "("}`,
+			"/: invalid pattern: error parsing regexp: missing closing ): `(`",
+		},
+		"invalid required": {
+			`{"required": "a"}`,
+			"/: required should be an array",
+		},
+		"unsupported ref": {
+			`{"$ref": "#/definitions/a"}`,
+			"invalid schema: /: unsupported keyword $ref",
+		},
+		"unsupported anyOf": {
+			`{"properties": {"a": {"anyOf": [{"type": "string"}]}}}`,
+			"invalid schema: /properties/a: unsupported keyword anyOf",
+		},
+		"unsupported oneOf": {
+			`{"items": {"oneOf": [{"type": "string"}]}}`,
+			"invalid schema: /items: unsupported keyword oneOf",
+		},
+		"unsupported allOf": {
+			`{"allOf": [{"type": "string"}]}`,
+			"invalid schema: /: unsupported keyword allOf",
+		},
+		"unsupported not": {
+			`{"not": {"type": "string"}}`,
+			"invalid schema: /: unsupported keyword not",
+		},
+		"unsupported format": {
+			`{"type": "string", "format": "email"}`,
+			"invalid schema: /: unsupported keyword format",
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			_, err := ParseSchema([]byte(tc.schema))
+			if err == nil || err.Error() != tc.err {
+				t.Error("there should be an error:", err)
+			}
+			if strings.HasPrefix(tc.err, "invalid schema: ") && !errors.Is(err, ErrInvalidSchema) {
+				t.Error("there should be a ErrInvalidSchema error:", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,723 @@
+// Copyright (c) 2016 - Max Ekman <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/mattn/go-sqlite3"
+
+	eh "github.com/looplab/eventhorizon"
+)
+
+// ErrNoDB is when no database is set.
+var ErrNoDB = errors.New("no database")
+
+// ErrInvalidTableName is when a table name is not a valid identifier.
+var ErrInvalidTableName = errors.New("invalid table name")
+
+// ErrCouldNotMigrateDB is when the database tables could not be created.
+var ErrCouldNotMigrateDB = errors.New("could not migrate database")
+
+// ErrCouldNotClearDB is when the database could not be cleared.
+var ErrCouldNotClearDB = errors.New("could not clear database")
+
+// ErrCouldNotMarshalEvent is when an event could not be marshaled into JSON.
+var ErrCouldNotMarshalEvent = errors.New("could not marshal event")
+
+// ErrCouldNotUnmarshalEvent is when an event could not be unmarshaled into a concrete type.
+var ErrCouldNotUnmarshalEvent = errors.New("could not unmarshal event")
+
+// ErrCouldNotLoadAggregate is when an aggregate could not be loaded.
+var ErrCouldNotLoadAggregate = errors.New("could not load aggregate")
+
+// ErrCouldNotSaveAggregate is when an aggregate could not be saved.
+var ErrCouldNotSaveAggregate = errors.New("could not save aggregate")
+
+// ErrCouldNotDeleteAggregate is when an aggregate could not be deleted.
+var ErrCouldNotDeleteAggregate = errors.New("could not delete aggregate")
+
+// validTableName matches the table names that are safe to use unquoted.
+var validTableName = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+
+// Option is an option setter used to configure creation.
+type Option func(*EventStore) error
+
+// WithTableName uses a custom table name for the events, the default is
+// "events".
+func WithTableName(table string) Option {
+	return func(s *EventStore) error {
+		if !validTableName.MatchString(table) {
+			return ErrInvalidTableName
+		}
+		s.table = table
+		return nil
+	}
+}
+
+// WithStrictLoad returns ErrUnregisteredEventType when loading events with data
+// that has not been registered for their type and version, instead of loading
+// them without data.
+func WithStrictLoad() Option {
+	return func(s *EventStore) error {
+		s.strict = true
+		return nil
+	}
+}
+
+// EventStore implements an EventStore for SQLite, for single binary apps and
+// tests that need a persistent store without a database server.
+type EventStore struct {
+	db     *sql.DB
+	table  string
+	strict bool
+}
+
+// NewEventStore creates a new EventStore using a database handle opened with
+// the "sqlite3" driver, for a file or an in-memory database. As every
+// connection to ":memory:" has its own database, an in-memory database should
+// be opened with a shared cache, for example "file::memory:?cache=shared".
+// The events table can be created with Migrate.
+func NewEventStore(db *sql.DB, opts ...Option) (*EventStore, error) {
+	if db == nil {
+		return nil, ErrNoDB
+	}
+
+	s := &EventStore{
+		db:    db,
+		table: "events",
+	}
+
+	for _, opt := range opts {
+		if err := opt(s); err != nil {
+			return nil, err
+		}
+	}
+
+	return s, nil
+}
+
+// Migrate creates the events table and its indexes if they don't exist. The
+// global position is an autoincrement column, which is never reused for
+// deleted events.
+func (s *EventStore) Migrate(ctx context.Context) error {
+	if _, err := s.db.ExecContext(ctx, fmt.Sprintf(`
+		CREATE TABLE IF NOT EXISTS %[1]s (
+			global_position INTEGER PRIMARY KEY AUTOINCREMENT,
+			namespace       TEXT    NOT NULL,
+			aggregate_id    TEXT    NOT NULL,
+			aggregate_type  TEXT    NOT NULL,
+			event_type      TEXT    NOT NULL,
+			data            TEXT,
+			data_version    INTEGER NOT NULL DEFAULT 1,
+			timestamp       INTEGER NOT NULL,
+			version         INTEGER NOT NULL,
+			metadata        TEXT,
+			UNIQUE (namespace, aggregate_id, version)
+		);
+		CREATE INDEX IF NOT EXISTS %[1]s_event_type_idx ON %[1]s (event_type);
+		CREATE INDEX IF NOT EXISTS %[1]s_timestamp_idx ON %[1]s (timestamp);`,
+		s.table,
+	)); err != nil {
+		return eh.EventStoreError{
+			Err:       ErrCouldNotMigrateDB,
+			BaseErr:   err,
+			Namespace: eh.Namespace(ctx),
+		}
+	}
+	return nil
+}
+
+// Save appends all events in the event stream to the database.
+func (s *EventStore) Save(ctx context.Context, events []eh.Event, originalVersion int) error {
+	if len(events) == 0 {
+		return eh.EventStoreError{
+			Err:       eh.ErrNoEventsToAppend,
+			Namespace: eh.Namespace(ctx),
+		}
+	}
+
+	// Build all event records, with incrementing versions starting from the
+	// original aggregate version. Events saved with any version only need
+	// consecutive versions, they are renumbered after the current version.
+	dbEvents := make([]dbEvent, len(events))
+	aggregateID := events[0].AggregateID()
+	version := originalVersion
+	switch originalVersion {
+	case eh.ExpectedVersionAny:
+		version = events[0].Version() - 1
+	case eh.ExpectedVersionNoStream:
+		version = 0
+	}
+	for i, event := range events {
+		// Only accept events belonging to the same aggregate.
+		if event.AggregateID() != aggregateID {
+			return eh.EventStoreError{
+				Err:       eh.ErrInvalidEvent,
+				Namespace: eh.Namespace(ctx),
+			}
+		}
+
+		// Only accept events that apply to the correct aggregate version.
+		if event.Version() != version+1 {
+			return eh.EventStoreError{
+				Err:       eh.ErrIncorrectEventVersion,
+				Namespace: eh.Namespace(ctx),
+			}
+		}
+
+		// Create the event record with timestamp.
+		dbEvents[i] = dbEvent{
+			EventType:     event.EventType(),
+			DataVersion:   eh.EventDataVersion(event.EventType()),
+			Timestamp:     event.Timestamp(),
+			AggregateType: event.AggregateType(),
+			AggregateID:   event.AggregateID(),
+			Version:       event.Version(),
+			Metadata:      event.Metadata(),
+		}
+
+		// Marshal event data if there is any.
+		if event.Data() != nil {
+			rawData, err := json.Marshal(event.Data())
+			if err != nil {
+				return eh.EventStoreError{
+					Err:       ErrCouldNotMarshalEvent,
+					BaseErr:   err,
+					Namespace: eh.Namespace(ctx),
+				}
+			}
+			dbEvents[i].RawData = rawData
+		}
+
+		// Marshal the metadata if there is any.
+		if event.Metadata() != nil {
+			rawMetadata, err := json.Marshal(event.Metadata())
+			if err != nil {
+				return eh.EventStoreError{
+					Err:       ErrCouldNotMarshalEvent,
+					BaseErr:   err,
+					Namespace: eh.Namespace(ctx),
+				}
+			}
+			dbEvents[i].RawMetadata = rawMetadata
+		}
+
+		version++
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return eh.EventStoreError{
+			Err:       ErrCouldNotSaveAggregate,
+			BaseErr:   err,
+			Namespace: eh.Namespace(ctx),
+		}
+	}
+	defer tx.Rollback()
+
+	// Only append if the version of the aggregate is matching (ie not changed
+	// since loading the aggregate). Concurrent appends are caught by the
+	// unique constraint on the version when inserting.
+	var currentVersion int
+	if err := tx.QueryRowContext(ctx, fmt.Sprintf(
+		`SELECT COALESCE(MAX(version), 0) FROM %s WHERE namespace = ? AND aggregate_id = ?`,
+		s.table,
+	), eh.Namespace(ctx), aggregateID.String()).Scan(&currentVersion); err != nil {
+		return eh.EventStoreError{
+			Err:       ErrCouldNotSaveAggregate,
+			BaseErr:   err,
+			Namespace: eh.Namespace(ctx),
+		}
+	}
+	switch originalVersion {
+	case eh.ExpectedVersionAny:
+		for i := range dbEvents {
+			dbEvents[i].Version = currentVersion + i + 1
+		}
+	case eh.ExpectedVersionNoStream:
+		if currentVersion != 0 {
+			return eh.EventStoreError{
+				Err:       eh.ErrStreamAlreadyExists,
+				Namespace: eh.Namespace(ctx),
+			}
+		}
+	default:
+		if currentVersion != originalVersion {
+			return eh.EventStoreError{
+				Err:             eh.ErrIncorrectEventVersion,
+				Namespace:       eh.Namespace(ctx),
+				ExpectedVersion: originalVersion,
+				ActualVersion:   currentVersion,
+			}
+		}
+	}
+
+	insert := fmt.Sprintf(
+		`INSERT INTO %s (namespace, aggregate_id, aggregate_type, event_type, data, data_version, timestamp, version, metadata)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		s.table,
+	)
+	for _, e := range dbEvents {
+		// Use a NULL value for events without data.
+		var data, metadata interface{}
+		if e.RawData != nil {
+			data = string(e.RawData)
+		}
+		if e.RawMetadata != nil {
+			metadata = string(e.RawMetadata)
+		}
+
+		if _, err := tx.ExecContext(ctx, insert,
+			eh.Namespace(ctx),
+			e.AggregateID.String(),
+			string(e.AggregateType),
+			string(e.EventType),
+			data,
+			e.DataVersion,
+			e.Timestamp.UnixNano(),
+			e.Version,
+			metadata,
+		); err != nil {
+			if isUniqueViolation(err) {
+				if originalVersion == eh.ExpectedVersionNoStream {
+					return eh.EventStoreError{
+						Err:       eh.ErrStreamAlreadyExists,
+						BaseErr:   err,
+						Namespace: eh.Namespace(ctx),
+					}
+				}
+				return s.versionConflict(ctx, err, aggregateID, dbEvents[0].Version-1)
+			}
+			return eh.EventStoreError{
+				Err:       ErrCouldNotSaveAggregate,
+				BaseErr:   err,
+				Namespace: eh.Namespace(ctx),
+			}
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return eh.EventStoreError{
+			Err:       ErrCouldNotSaveAggregate,
+			BaseErr:   err,
+			Namespace: eh.Namespace(ctx),
+		}
+	}
+
+	return nil
+}
+
+// isUniqueViolation reports whether an error is from a unique constraint,
+// which for the events is a version that is already taken.
+func isUniqueViolation(err error) bool {
+	var sqliteErr sqlite3.Error
+	return errors.As(err, &sqliteErr) &&
+		(sqliteErr.ExtendedCode == sqlite3.ErrConstraintUnique ||
+			sqliteErr.ExtendedCode == sqlite3.ErrConstraintPrimaryKey)
+}
+
+// versionConflict creates the error for a save that conflicted with a
+// concurrent save of the aggregate, with the version it has after that save.
+func (s *EventStore) versionConflict(ctx context.Context, baseErr error, id eh.UUID, expectedVersion int) error {
+	var actualVersion int
+	if err := s.db.QueryRowContext(ctx, fmt.Sprintf(
+		`SELECT COALESCE(MAX(version), 0) FROM %s WHERE namespace = ? AND aggregate_id = ?`,
+		s.table,
+	), eh.Namespace(ctx), id.String()).Scan(&actualVersion); err != nil {
+		return eh.EventStoreError{
+			Err:       ErrCouldNotSaveAggregate,
+			BaseErr:   err,
+			Namespace: eh.Namespace(ctx),
+		}
+	}
+
+	return eh.EventStoreError{
+		Err:             eh.ErrIncorrectEventVersion,
+		BaseErr:         baseErr,
+		Namespace:       eh.Namespace(ctx),
+		ExpectedVersion: expectedVersion,
+		ActualVersion:   actualVersion,
+	}
+}
+
+// Load loads all events for the aggregate id from the database.
+func (s *EventStore) Load(ctx context.Context, aggregateType eh.AggregateType, id eh.UUID, opts ...eh.LoadOption) ([]eh.Event, error) {
+	// A negative limit is the same as no limit.
+	limit := -1
+	if max := eh.NewLoadOptions(opts...).MaxEvents; max > 0 {
+		limit = max
+	}
+
+	return s.loadEvents(ctx, fmt.Sprintf(
+		`SELECT aggregate_id, aggregate_type, event_type, data, data_version, timestamp, version, metadata, global_position
+		FROM %s WHERE namespace = ? AND aggregate_id = ?
+		ORDER BY version LIMIT ?`,
+		s.table,
+	), eh.Namespace(ctx), id.String(), limit)
+}
+
+// LoadFrom implements the LoadFrom method of the
+// eventhorizon.EventStoreVersionLoader interface.
+func (s *EventStore) LoadFrom(ctx context.Context, aggregateType eh.AggregateType, id eh.UUID, fromVersion int) ([]eh.Event, error) {
+	return s.loadEvents(ctx, fmt.Sprintf(
+		`SELECT aggregate_id, aggregate_type, event_type, data, data_version, timestamp, version, metadata, global_position
+		FROM %s WHERE namespace = ? AND aggregate_id = ? AND version >= ?
+		ORDER BY version`,
+		s.table,
+	), eh.Namespace(ctx), id.String(), fromVersion)
+}
+
+// loadEvents loads the events of an aggregate selected by a query.
+func (s *EventStore) loadEvents(ctx context.Context, query string, args ...interface{}) ([]eh.Event, error) {
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, eh.EventStoreError{
+			Err:       ErrCouldNotLoadAggregate,
+			BaseErr:   err,
+			Namespace: eh.Namespace(ctx),
+		}
+	}
+	defer rows.Close()
+
+	events := []eh.Event{}
+	for rows.Next() {
+		event, err := s.scanEvent(ctx, rows)
+		if err != nil {
+			return nil, err
+		}
+		events = append(events, event)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, eh.EventStoreError{
+			Err:       ErrCouldNotLoadAggregate,
+			BaseErr:   err,
+			Namespace: eh.Namespace(ctx),
+		}
+	}
+
+	return events, nil
+}
+
+// Delete implements the Delete method of the
+// eventhorizon.EventStoreDeleter interface.
+func (s *EventStore) Delete(ctx context.Context, aggregateType eh.AggregateType, id eh.UUID) error {
+	res, err := s.db.ExecContext(ctx, fmt.Sprintf(
+		`DELETE FROM %s WHERE namespace = ? AND aggregate_id = ?`,
+		s.table,
+	), eh.Namespace(ctx), id.String())
+	if err != nil {
+		return eh.EventStoreError{
+			Err:       ErrCouldNotDeleteAggregate,
+			BaseErr:   err,
+			Namespace: eh.Namespace(ctx),
+		}
+	}
+
+	if n, err := res.RowsAffected(); err != nil {
+		return eh.EventStoreError{
+			Err:       ErrCouldNotDeleteAggregate,
+			BaseErr:   err,
+			Namespace: eh.Namespace(ctx),
+		}
+	} else if n == 0 {
+		return eh.EventStoreError{
+			Err:       eh.ErrAggregateNotFound,
+			Namespace: eh.Namespace(ctx),
+		}
+	}
+
+	return nil
+}
+
+// HeadPosition implements the HeadPosition method of the
+// eventhorizon.HeadPositioner interface.
+func (s *EventStore) HeadPosition(ctx context.Context) (int64, error) {
+	var position int64
+	if err := s.db.QueryRowContext(ctx, fmt.Sprintf(
+		`SELECT COALESCE(MAX(global_position), 0) FROM %s WHERE namespace = ?`,
+		s.table,
+	), eh.Namespace(ctx)).Scan(&position); err != nil {
+		return 0, eh.EventStoreError{
+			Err:       ErrCouldNotLoadAggregate,
+			BaseErr:   err,
+			Namespace: eh.Namespace(ctx),
+		}
+	}
+
+	return position, nil
+}
+
+// ReplayAll implements the ReplayAll method of the eventhorizon.EventStreamer
+// interface. The events are streamed from the DB in the order of their global
+// position.
+func (s *EventStore) ReplayAll(ctx context.Context) (<-chan eh.Event, <-chan error) {
+	return s.Replay(ctx, eh.ReplayFilter{})
+}
+
+// Replay implements the Replay method of the eventhorizon.FilteredEventStreamer
+// interface. The events are filtered by the DB and streamed in the order of
+// their global position.
+func (s *EventStore) Replay(ctx context.Context, filter eh.ReplayFilter) (<-chan eh.Event, <-chan error) {
+	events := make(chan eh.Event)
+	errs := make(chan error, 1)
+
+	go func() {
+		defer close(errs)
+		defer close(events)
+
+		where, args := replayWhere(filter, eh.Namespace(ctx))
+		rows, err := s.db.QueryContext(ctx, fmt.Sprintf(
+			`SELECT aggregate_id, aggregate_type, event_type, data, data_version, timestamp, version, metadata, global_position
+			FROM %s WHERE %s
+			ORDER BY global_position`,
+			s.table, where,
+		), args...)
+		if err != nil {
+			errs <- eh.EventStoreError{
+				Err:       ErrCouldNotLoadAggregate,
+				BaseErr:   err,
+				Namespace: eh.Namespace(ctx),
+			}
+			return
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			event, err := s.scanEvent(ctx, rows)
+			if err != nil {
+				errs <- err
+				return
+			}
+
+			select {
+			case events <- event:
+			case <-ctx.Done():
+				errs <- ctx.Err()
+				return
+			}
+		}
+		if err := rows.Err(); err != nil {
+			errs <- eh.EventStoreError{
+				Err:       ErrCouldNotLoadAggregate,
+				BaseErr:   err,
+				Namespace: eh.Namespace(ctx),
+			}
+		}
+	}()
+
+	return events, errs
+}
+
+// replayWhere creates the conditions and arguments for the events matching a
+// filter in a namespace.
+func replayWhere(filter eh.ReplayFilter, ns string) (string, []interface{}) {
+	conds := []string{"namespace = ?"}
+	args := []interface{}{ns}
+
+	// in adds a condition for a column matching any of the values.
+	in := func(column string, values []string) {
+		params := make([]string, len(values))
+		for i, v := range values {
+			args = append(args, v)
+			params[i] = "?"
+		}
+		conds = append(conds, fmt.Sprintf("%s IN (%s)", column, strings.Join(params, ", ")))
+	}
+
+	if filter.AggregateType != eh.AggregateType("") {
+		aggregateTypes := []string{string(filter.AggregateType)}
+		for _, alias := range eh.AggregateTypeAliases(filter.AggregateType) {
+			aggregateTypes = append(aggregateTypes, string(alias))
+		}
+		in("aggregate_type", aggregateTypes)
+	}
+	if len(filter.EventTypes) > 0 {
+		eventTypes := make([]string, len(filter.EventTypes))
+		for i, eventType := range filter.EventTypes {
+			eventTypes[i] = string(eventType)
+		}
+		in("event_type", eventTypes)
+	}
+	if !filter.From.IsZero() {
+		args = append(args, filter.From.UnixNano())
+		conds = append(conds, "timestamp >= ?")
+	}
+	if !filter.To.IsZero() {
+		args = append(args, filter.To.UnixNano())
+		conds = append(conds, "timestamp < ?")
+	}
+	if filter.AfterPosition > 0 {
+		args = append(args, filter.AfterPosition)
+		conds = append(conds, "global_position > ?")
+	}
+
+	return strings.Join(conds, " AND "), args
+}
+
+// scanEvent creates an event from the current row, with concrete event data
+// if the event type is registered. Event data saved with an older schema
+// version is upcasted to the current version.
+func (s *EventStore) scanEvent(ctx context.Context, rows *sql.Rows) (eh.Event, error) {
+	var e dbEvent
+	var aggregateID, aggregateType, eventType string
+	var rawData, rawMetadata []byte
+	var timestamp int64
+	if err := rows.Scan(&aggregateID, &aggregateType, &eventType, &rawData, &e.DataVersion, &timestamp, &e.Version, &rawMetadata, &e.Position); err != nil {
+		return nil, eh.EventStoreError{
+			Err:       ErrCouldNotLoadAggregate,
+			BaseErr:   err,
+			Namespace: eh.Namespace(ctx),
+		}
+	}
+	e.AggregateID = eh.UUID(aggregateID)
+	e.AggregateType = eh.AggregateType(aggregateType)
+	e.EventType = eh.EventType(eventType)
+	e.Timestamp = time.Unix(0, timestamp)
+
+	// Decode the metadata if there is any.
+	if rawMetadata != nil {
+		if err := json.Unmarshal(rawMetadata, &e.Metadata); err != nil {
+			return nil, eh.EventStoreError{
+				Err:       ErrCouldNotUnmarshalEvent,
+				BaseErr:   err,
+				Namespace: eh.Namespace(ctx),
+			}
+		}
+	}
+
+	// Create an event of the correct type and version, decode the JSON data
+	// and upcast it to the current version.
+	if rawData != nil {
+		data, err := eh.CreateVersionedEventData(e.EventType, e.DataVersion)
+		if err != nil && s.strict {
+			return nil, eh.EventStoreError{
+				Err:       eh.ErrUnregisteredEventType,
+				BaseErr:   fmt.Errorf("%s version %d", e.EventType, e.DataVersion),
+				Namespace: eh.Namespace(ctx),
+			}
+		}
+		if err == nil {
+			if err := json.Unmarshal(rawData, data); err != nil {
+				return nil, eh.EventStoreError{
+					Err:       ErrCouldNotUnmarshalEvent,
+					BaseErr:   err,
+					Namespace: eh.Namespace(ctx),
+				}
+			}
+			if data, err = eh.UpcastEventData(e.EventType, e.DataVersion, data); err != nil {
+				return nil, eh.EventStoreError{
+					Err:       ErrCouldNotUnmarshalEvent,
+					BaseErr:   err,
+					Namespace: eh.Namespace(ctx),
+				}
+			}
+			e.data = data
+			e.DataVersion = eh.EventDataVersion(e.EventType)
+		}
+	}
+
+	return event{dbEvent: e}, nil
+}
+
+// Clear clears the event storage for the namespace.
+func (s *EventStore) Clear(ctx context.Context) error {
+	if _, err := s.db.ExecContext(ctx, fmt.Sprintf(
+		`DELETE FROM %s WHERE namespace = ?`,
+		s.table,
+	), eh.Namespace(ctx)); err != nil {
+		return eh.EventStoreError{
+			Err:       ErrCouldNotClearDB,
+			BaseErr:   err,
+			Namespace: eh.Namespace(ctx),
+		}
+	}
+	return nil
+}
+
+// dbEvent is the internal event record for the SQLite event store used to
+// save and load events from the DB.
+type dbEvent struct {
+	EventType     eh.EventType
+	RawData       json.RawMessage
+	data          eh.EventData
+	DataVersion   int
+	Timestamp     time.Time
+	AggregateType eh.AggregateType
+	AggregateID   eh.UUID
+	Version       int
+	Metadata      map[string]interface{}
+	RawMetadata   json.RawMessage
+	Position      int64
+}
+
+// event is the private implementation of the eventhorizon.Event interface
+// for a SQLite event store.
+type event struct {
+	dbEvent
+}
+
+// AggrgateID implements the AggrgateID method of the eventhorizon.Event interface.
+func (e event) AggregateID() eh.UUID {
+	return e.dbEvent.AggregateID
+}
+
+// AggregateType implements the AggregateType method of the eventhorizon.Event interface.
+func (e event) AggregateType() eh.AggregateType {
+	return e.dbEvent.AggregateType
+}
+
+// EventType implements the EventType method of the eventhorizon.Event interface.
+func (e event) EventType() eh.EventType {
+	return e.dbEvent.EventType
+}
+
+// Data implements the Data method of the eventhorizon.Event interface.
+func (e event) Data() eh.EventData {
+	return e.dbEvent.data
+}
+
+// Version implements the Version method of the eventhorizon.Event interface.
+func (e event) Version() int {
+	return e.dbEvent.Version
+}
+
+// Timestamp implements the Timestamp method of the eventhorizon.Event interface.
+func (e event) Timestamp() time.Time {
+	return e.dbEvent.Timestamp
+}
+
+// Metadata implements the Metadata method of the eventhorizon.Event interface.
+func (e event) Metadata() map[string]interface{} {
+	return e.dbEvent.Metadata
+}
+
+// GlobalPosition implements the GlobalPosition method of the
+// eventhorizon.PositionedEvent interface.
+func (e event) GlobalPosition() int64 {
+	return e.dbEvent.Position
+}
+
+// String implements the String method of the eventhorizon.Event interface.
+func (e event) String() string {
+	return fmt.Sprintf("%s@%d", e.dbEvent.EventType, e.dbEvent.Version)
+}
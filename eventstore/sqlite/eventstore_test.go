@@ -0,0 +1,195 @@
+// Copyright (c) 2016 - Max Ekman <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	_ "github.com/mattn/go-sqlite3"
+
+	eh "github.com/looplab/eventhorizon"
+	"github.com/looplab/eventhorizon/eventstore/testutil"
+	"github.com/looplab/eventhorizon/mocks"
+)
+
+func TestEventStore(t *testing.T) {
+	db, closeDB := openDB(t)
+	defer closeDB()
+
+	store, err := NewEventStore(db, WithTableName("test_events"))
+	if err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	if store == nil {
+		t.Fatal("there should be a store")
+	}
+
+	if err := store.Migrate(context.Background()); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+
+	t.Log("migrate an already migrated database")
+	if err := store.Migrate(context.Background()); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+
+	ctx := eh.WithNamespace(context.Background(), "ns")
+
+	// Run the actual test suite.
+
+	t.Log("event store with default namespace")
+	testutil.EventStoreCommonTests(t, context.Background(), store)
+
+	t.Log("event store with other namespace")
+	testutil.EventStoreCommonTests(t, ctx, store)
+
+	t.Log("event streamer with default namespace")
+	testutil.EventStreamerCommonTests(t, context.Background(), store)
+
+	t.Log("event streamer with other namespace")
+	testutil.EventStreamerCommonTests(t, ctx, store)
+
+	t.Log("filtered event streamer with default namespace")
+	testutil.FilteredEventStreamerCommonTests(t, context.Background(), store)
+
+	t.Log("filtered event streamer with other namespace")
+	testutil.FilteredEventStreamerCommonTests(t, ctx, store)
+
+	t.Log("global positions with default namespace")
+	testutil.GlobalPositionCommonTests(t, context.Background(), store)
+
+	t.Log("global positions with other namespace")
+	testutil.GlobalPositionCommonTests(t, ctx, store)
+
+	t.Log("expected versions with default namespace")
+	testutil.ExpectedVersionCommonTests(t, context.Background(), store)
+
+	t.Log("expected versions with other namespace")
+	testutil.ExpectedVersionCommonTests(t, ctx, store)
+
+	t.Log("loading with max events with default namespace")
+	testutil.MaxEventsCommonTests(t, context.Background(), store)
+
+	t.Log("loading with max events with other namespace")
+	testutil.MaxEventsCommonTests(t, ctx, store)
+
+	t.Log("upcasting of event data")
+	testutil.UpcasterCommonTests(t, context.Background(), store)
+}
+
+func TestEventStoreInMemory(t *testing.T) {
+	db, err := sql.Open("sqlite3", "file::memory:?cache=shared")
+	if err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	defer db.Close()
+
+	store, err := NewEventStore(db)
+	if err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	if err := store.Migrate(context.Background()); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+
+	testutil.EventStoreCommonTests(t, context.Background(), store)
+}
+
+func TestEventStoreUniqueVersion(t *testing.T) {
+	db, closeDB := openDB(t)
+	defer closeDB()
+
+	store, err := NewEventStore(db)
+	if err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	if err := store.Migrate(context.Background()); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+
+	ctx := context.Background()
+	id := eh.NewUUID()
+	agg := mocks.NewAggregate(id)
+	event1 := agg.NewEvent(mocks.EventType, &mocks.EventData{"event1"})
+	if err := store.Save(ctx, []eh.Event{event1}, 0); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+
+	t.Log("insert a version that is already taken")
+	_, err = db.ExecContext(ctx, `INSERT INTO events (namespace, aggregate_id, aggregate_type, event_type, timestamp, version)
+		VALUES (?, ?, ?, ?, 0, 1)`,
+		eh.Namespace(ctx), id.String(), string(mocks.AggregateType), string(mocks.EventType))
+	if !isUniqueViolation(err) {
+		t.Error("there should be a unique constraint error:", err)
+	}
+
+	t.Log("the conflict should have the version of the aggregate")
+	err = store.versionConflict(ctx, err, id, 0)
+	if esErr, ok := err.(eh.EventStoreError); !ok || esErr.Err != eh.ErrIncorrectEventVersion ||
+		esErr.ExpectedVersion != 0 || esErr.ActualVersion != 1 {
+		t.Error("there should be a ErrIncorrectEventVersion error with the versions:", err)
+	}
+}
+
+func TestNewEventStore(t *testing.T) {
+	store, err := NewEventStore(nil)
+	if err != ErrNoDB {
+		t.Error("there should be a ErrNoDB error:", err)
+	}
+	if store != nil {
+		t.Error("there should be no store:", store)
+	}
+
+	db := &sql.DB{}
+	store, err = NewEventStore(db, WithTableName("drop table events;"))
+	if err != ErrInvalidTableName {
+		t.Error("there should be a ErrInvalidTableName error:", err)
+	}
+	if store != nil {
+		t.Error("there should be no store:", store)
+	}
+
+	store, err = NewEventStore(db, WithTableName("my_events"))
+	if err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if store == nil || store.table != "my_events" {
+		t.Error("the table name should be set:", store)
+	}
+}
+
+// openDB opens a database in a temporary file, which is removed when closed.
+func openDB(t *testing.T) (*sql.DB, func()) {
+	dir, err := ioutil.TempDir("", "eventhorizon-sqlite")
+	if err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+
+	db, err := sql.Open("sqlite3", filepath.Join(dir, "events.db"))
+	if err != nil {
+		os.RemoveAll(dir)
+		t.Fatal("there should be no error:", err)
+	}
+
+	return db, func() {
+		db.Close()
+		os.RemoveAll(dir)
+	}
+}
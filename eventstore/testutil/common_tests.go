@@ -16,8 +16,13 @@ package testutil
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"reflect"
 	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	eh "github.com/looplab/eventhorizon"
 	"github.com/looplab/eventhorizon/mocks"
@@ -32,7 +37,7 @@ func EventStoreCommonTests(t *testing.T, ctx context.Context, store eh.EventStor
 
 	t.Log("save no events")
 	err := store.Save(ctx, []eh.Event{}, 0)
-	if esErr, ok := err.(eh.EventStoreError); !ok || esErr.Err != eh.ErrNoEventsToAppend {
+	if !errors.Is(err, eh.ErrNoEventsToAppend) {
 		t.Error("there shoud be a ErrNoEventsToAppend error:", err)
 	}
 
@@ -52,12 +57,17 @@ func EventStoreCommonTests(t *testing.T, ctx context.Context, store eh.EventStor
 
 	t.Log("try to save same event twice")
 	err = store.Save(ctx, []eh.Event{event1}, 1)
-	if esErr, ok := err.(eh.EventStoreError); !ok || esErr.Err != eh.ErrIncorrectEventVersion {
+	if !errors.Is(err, eh.ErrIncorrectEventVersion) {
 		t.Error("there should be a ErrIncerrectEventVersion error:", err)
 	}
 
-	t.Log("save event, version 2")
-	event2 := agg.NewEvent(mocks.EventType, &mocks.EventData{"event2"})
+	t.Log("save event with metadata, version 2")
+	event2 := agg.NewEvent(mocks.EventType, &mocks.EventData{"event2"},
+		eh.WithMetadata(map[string]interface{}{
+			"correlation_id": "correlation1",
+			"causation_id":   "causation1",
+		}),
+	)
 	agg.ApplyEvent(ctx, event2) // Apply event to increment the aggregate version.
 	err = store.Save(ctx, []eh.Event{event2}, 1)
 	if err != nil {
@@ -128,6 +138,71 @@ func EventStoreCommonTests(t *testing.T, ctx context.Context, store eh.EventStor
 	}
 	t.Log(events)
 
+	t.Log("load events with and without metadata")
+	if len(events) != len(expectedEvents) {
+		t.Fatal("there should be all events:", eventsToString(events))
+	}
+	if events[0].Metadata() != nil {
+		t.Error("there should be no metadata:", events[0].Metadata())
+	}
+	if val, ok := events[1].Metadata()["correlation_id"]; !ok || val != "correlation1" {
+		t.Error("the metadata should be correct:", events[1].Metadata())
+	}
+
+	if loader, ok := store.(eh.EventStoreVersionLoader); ok {
+		t.Log("load events from version 1")
+		events, err = loader.LoadFrom(ctx, mocks.AggregateType, id, 1)
+		if err != nil {
+			t.Error("there should be no error:", err)
+		}
+		if len(events) != len(expectedEvents) {
+			t.Error("there should be all events:", eventsToString(events))
+		}
+		for i, event := range events {
+			if err := mocks.CompareEvents(event, expectedEvents[i]); err != nil {
+				t.Error("the event was incorrect:", err)
+			}
+			if event.Version() != i+1 {
+				t.Error("the event version should be correct:", event, event.Version())
+			}
+		}
+
+		t.Log("load events from version 4")
+		events, err = loader.LoadFrom(ctx, mocks.AggregateType, id, 4)
+		if err != nil {
+			t.Error("there should be no error:", err)
+		}
+		if len(events) != 3 {
+			t.Error("there should be 3 events:", eventsToString(events))
+		}
+		for i, event := range events {
+			if err := mocks.CompareEvents(event, expectedEvents[i+3]); err != nil {
+				t.Error("the event was incorrect:", err)
+			}
+			if event.Version() != i+4 {
+				t.Error("the event version should be correct:", event, event.Version())
+			}
+		}
+
+		t.Log("load events from a version past the end")
+		events, err = loader.LoadFrom(ctx, mocks.AggregateType, id, 7)
+		if err != nil {
+			t.Error("there should be no error:", err)
+		}
+		if events == nil || len(events) != 0 {
+			t.Error("there should be no loaded events:", eventsToString(events))
+		}
+
+		t.Log("load events from version 1 for non-existing aggregate")
+		events, err = loader.LoadFrom(ctx, mocks.AggregateType, eh.NewUUID(), 1)
+		if err != nil {
+			t.Error("there should be no error:", err)
+		}
+		if len(events) != 0 {
+			t.Error("there should be no loaded events:", eventsToString(events))
+		}
+	}
+
 	t.Log("load events for another aggregate")
 	events, err = store.Load(ctx, mocks.AggregateType, id2)
 	if err != nil {
@@ -143,15 +218,1565 @@ func EventStoreCommonTests(t *testing.T, ctx context.Context, store eh.EventStor
 		}
 	}
 
+	if deleter, ok := store.(eh.EventStoreDeleter); ok {
+		t.Log("save event for an aggregate to delete")
+		id3 := eh.NewUUID()
+		agg3 := mocks.NewAggregate(id3)
+		event8 := agg3.NewEvent(mocks.EventType, &mocks.EventData{"event8"})
+		agg3.ApplyEvent(ctx, event8) // Apply event to increment the aggregate version.
+		if err := store.Save(ctx, []eh.Event{event8}, 0); err != nil {
+			t.Error("there should be no error:", err)
+		}
+		savedEvents = append(savedEvents, event8)
+
+		t.Log("delete events for aggregate")
+		if err := deleter.Delete(ctx, mocks.AggregateType, id3); err != nil {
+			t.Error("there should be no error:", err)
+		}
+		events, err = store.Load(ctx, mocks.AggregateType, id3)
+		if err != nil {
+			t.Error("there should be no error:", err)
+		}
+		if len(events) != 0 {
+			t.Error("there should be no loaded events:", eventsToString(events))
+		}
+
+		t.Log("delete events for non-existing aggregate")
+		err = deleter.Delete(ctx, mocks.AggregateType, id3)
+		if !errors.Is(err, eh.ErrAggregateNotFound) {
+			t.Error("there should be a ErrAggregateNotFound error:", err)
+		}
+
+		t.Log("load events for other aggregates after deleting")
+		events, err = store.Load(ctx, mocks.AggregateType, id2)
+		if err != nil {
+			t.Error("there should be no error:", err)
+		}
+		if len(events) != 1 {
+			t.Error("there should be 1 event:", eventsToString(events))
+		}
+	}
+
 	return savedEvents
 }
 
-func eventsToString(events []eh.Event) string {
-	parts := make([]string, len(events))
-	for i, e := range events {
-		parts[i] = string(e.AggregateType()) +
-			":" + string(e.EventType()) +
-			" (" + e.AggregateID().String() + ")"
+// SnapshotStoreCommonTests are test cases that are common to all
+// implementations of event stores that supports snapshots.
+func SnapshotStoreCommonTests(t *testing.T, ctx context.Context, store eh.EventStore) {
+	snapshotStore, ok := store.(eh.SnapshotStore)
+	if !ok {
+		t.Fatal("the store should be a snapshot store")
+	}
+
+	ctx = context.WithValue(ctx, "testkey", "testval")
+
+	t.Log("load snapshot for non-existing aggregate")
+	state, version, err := snapshotStore.LoadSnapshot(ctx, mocks.AggregateType, eh.NewUUID())
+	if err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if state != nil || version != 0 {
+		t.Error("there should be no snapshot:", state, version)
+	}
+
+	t.Log("save events, version 1, 2 and 3")
+	id := eh.NewUUID()
+	agg := mocks.NewAggregate(id)
+	event1 := agg.NewEvent(mocks.EventType, &mocks.EventData{"event1"})
+	agg.ApplyEvent(ctx, event1) // Apply event to increment the aggregate version.
+	event2 := agg.NewEvent(mocks.EventType, &mocks.EventData{"event2"})
+	agg.ApplyEvent(ctx, event2) // Apply event to increment the aggregate version.
+	event3 := agg.NewEvent(mocks.EventType, &mocks.EventData{"event3"})
+	agg.ApplyEvent(ctx, event3) // Apply event to increment the aggregate version.
+	if err := store.Save(ctx, []eh.Event{event1, event2, event3}, 0); err != nil {
+		t.Error("there should be no error:", err)
+	}
+
+	t.Log("load snapshot for aggregate without snapshot")
+	state, version, err = snapshotStore.LoadSnapshot(ctx, mocks.AggregateType, id)
+	if err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if state != nil || version != 0 {
+		t.Error("there should be no snapshot:", state, version)
+	}
+
+	t.Log("save snapshot, version 2")
+	state2 := &mocks.EventData{"state2"}
+	if err := snapshotStore.SaveSnapshot(ctx, mocks.AggregateType, id, 2, state2); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	state, version, err = snapshotStore.LoadSnapshot(ctx, mocks.AggregateType, id)
+	if err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if !reflect.DeepEqual(state, state2) {
+		t.Error("the snapshot state should be correct:", state)
+	}
+	if version != 2 {
+		t.Error("the snapshot version should be correct:", version)
+	}
+
+	t.Log("save snapshot, latest version 3")
+	state3 := &mocks.EventData{"state3"}
+	if err := snapshotStore.SaveSnapshot(ctx, mocks.AggregateType, id, 3, state3); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	state, version, err = snapshotStore.LoadSnapshot(ctx, mocks.AggregateType, id)
+	if err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if !reflect.DeepEqual(state, state3) {
+		t.Error("the snapshot state should be correct:", state)
+	}
+	if version != 3 {
+		t.Error("the snapshot version should be correct:", version)
+	}
+
+	t.Log("save snapshot, past the latest version")
+	err = snapshotStore.SaveSnapshot(ctx, mocks.AggregateType, id, 4, &mocks.EventData{"state4"})
+	if !errors.Is(err, eh.ErrIncorrectSnapshotVersion) {
+		t.Error("there should be a ErrIncorrectSnapshotVersion error:", err)
+	}
+
+	t.Log("save snapshot, version 0")
+	err = snapshotStore.SaveSnapshot(ctx, mocks.AggregateType, id, 0, &mocks.EventData{"state0"})
+	if !errors.Is(err, eh.ErrIncorrectSnapshotVersion) {
+		t.Error("there should be a ErrIncorrectSnapshotVersion error:", err)
+	}
+
+	t.Log("save snapshot for non-existing aggregate")
+	err = snapshotStore.SaveSnapshot(ctx, mocks.AggregateType, eh.NewUUID(), 1, &mocks.EventData{"state1"})
+	if !errors.Is(err, eh.ErrIncorrectSnapshotVersion) {
+		t.Error("there should be a ErrIncorrectSnapshotVersion error:", err)
+	}
+
+	t.Log("load snapshot after failed saves")
+	state, version, err = snapshotStore.LoadSnapshot(ctx, mocks.AggregateType, id)
+	if err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if !reflect.DeepEqual(state, state3) || version != 3 {
+		t.Error("the snapshot should be unchanged:", state, version)
+	}
+}
+
+// EventStreamerCommonTests are test cases that are common to all
+// implementations of event stores that can replay all events.
+func EventStreamerCommonTests(t *testing.T, ctx context.Context, store eh.EventStore) {
+	streamer, ok := store.(eh.EventStreamer)
+	if !ok {
+		t.Fatal("the store should be an event streamer")
+	}
+
+	ctx = context.WithValue(ctx, "testkey", "testval")
+
+	t.Log("save events for two aggregates, interleaved in time")
+	id1 := eh.NewUUID()
+	agg1 := mocks.NewAggregate(id1)
+	id2 := eh.NewUUID()
+	agg2 := mocks.NewAggregate(id2)
+	event1 := agg1.NewEvent(mocks.EventType, &mocks.EventData{"event1"})
+	agg1.ApplyEvent(ctx, event1) // Apply event to increment the aggregate version.
+	time.Sleep(10 * time.Millisecond)
+	event2 := agg2.NewEvent(mocks.EventType, &mocks.EventData{"event2"})
+	agg2.ApplyEvent(ctx, event2) // Apply event to increment the aggregate version.
+	time.Sleep(10 * time.Millisecond)
+	event3 := agg1.NewEvent(mocks.EventOtherType, nil)
+	agg1.ApplyEvent(ctx, event3) // Apply event to increment the aggregate version.
+	time.Sleep(10 * time.Millisecond)
+	event4 := agg2.NewEvent(mocks.EventType, &mocks.EventData{"event4"})
+	agg2.ApplyEvent(ctx, event4) // Apply event to increment the aggregate version.
+	if err := store.Save(ctx, []eh.Event{event1, event3}, 0); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if err := store.Save(ctx, []eh.Event{event2, event4}, 0); err != nil {
+		t.Error("there should be no error:", err)
+	}
+
+	t.Log("replay all events")
+	events, errs := streamer.ReplayAll(ctx)
+	replayed := []eh.Event{}
+	for event := range events {
+		// Only check the events saved by this test.
+		if event.AggregateID() == id1 || event.AggregateID() == id2 {
+			replayed = append(replayed, event)
+		}
+	}
+	if err := <-errs; err != nil {
+		t.Error("there should be no error:", err)
+	}
+	expectedEvents := []eh.Event{event1, event2, event3, event4}
+	if len(replayed) != len(expectedEvents) {
+		t.Fatal("there should be all events:", eventsToString(replayed))
+	}
+	for i, event := range replayed {
+		if err := mocks.CompareEvents(event, expectedEvents[i]); err != nil {
+			t.Error("the event was incorrect:", err)
+		}
+		if event.Version() != expectedEvents[i].Version() {
+			t.Error("the event version should be correct:", event, event.Version())
+		}
+	}
+
+	t.Log("stop consuming before all events are replayed")
+	cancelCtx, cancel := context.WithCancel(ctx)
+	events, errs = streamer.ReplayAll(cancelCtx)
+	if _, ok := <-events; !ok {
+		t.Error("there should be an event")
+	}
+	cancel()
+	timeout := time.After(time.Second)
+	for done := false; !done; {
+		select {
+		case _, ok := <-events:
+			done = !ok
+		case <-timeout:
+			t.Fatal("the event channel should be closed")
+		}
+	}
+	if err := <-errs; err != nil && err != context.Canceled {
+		t.Error("there should be no error or a canceled error:", err)
+	}
+}
+
+// FilteredEventStreamerCommonTests are test cases that are common to all
+// implementations of event stores that can replay events matching a filter.
+func FilteredEventStreamerCommonTests(t *testing.T, ctx context.Context, store eh.EventStore) {
+	streamer, ok := store.(eh.FilteredEventStreamer)
+	if !ok {
+		t.Fatal("the store should be a filtered event streamer")
+	}
+
+	t.Log("save events for two aggregate types, interleaved in time")
+	id1 := eh.NewUUID()
+	agg1 := mocks.NewAggregate(id1)
+	id2 := eh.NewUUID()
+	agg2 := eh.NewAggregateBase(FilteredAggregateType, id2)
+	event1 := agg1.NewEvent(mocks.EventType, &mocks.EventData{"event1"})
+	agg1.ApplyEvent(ctx, event1) // Apply event to increment the aggregate version.
+	time.Sleep(10 * time.Millisecond)
+	from := time.Now()
+	time.Sleep(10 * time.Millisecond)
+	event2 := agg2.NewEvent(mocks.EventType, &mocks.EventData{"event2"})
+	agg2.IncrementVersion()
+	time.Sleep(10 * time.Millisecond)
+	event3 := agg1.NewEvent(mocks.EventOtherType, nil)
+	agg1.ApplyEvent(ctx, event3) // Apply event to increment the aggregate version.
+	time.Sleep(10 * time.Millisecond)
+	to := time.Now()
+	time.Sleep(10 * time.Millisecond)
+	event4 := agg2.NewEvent(mocks.EventOtherType, nil)
+	agg2.IncrementVersion()
+	if err := store.Save(ctx, []eh.Event{event1, event3}, 0); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if err := store.Save(ctx, []eh.Event{event2, event4}, 0); err != nil {
+		t.Error("there should be no error:", err)
+	}
+
+	testCases := map[string]struct {
+		filter   eh.ReplayFilter
+		expected []eh.Event
+	}{
+		"no filter": {
+			eh.ReplayFilter{},
+			[]eh.Event{event1, event2, event3, event4},
+		},
+		"aggregate type": {
+			eh.ReplayFilter{AggregateType: FilteredAggregateType},
+			[]eh.Event{event2, event4},
+		},
+		"event types": {
+			eh.ReplayFilter{EventTypes: []eh.EventType{mocks.EventOtherType}},
+			[]eh.Event{event3, event4},
+		},
+		"time range": {
+			eh.ReplayFilter{From: from, To: to},
+			[]eh.Event{event2, event3},
+		},
+		"from time": {
+			eh.ReplayFilter{From: to},
+			[]eh.Event{event4},
+		},
+		"combined": {
+			eh.ReplayFilter{
+				AggregateType: mocks.AggregateType,
+				EventTypes:    []eh.EventType{mocks.EventType, mocks.EventOtherType},
+				To:            to,
+			},
+			[]eh.Event{event1, event3},
+		},
+		"no matches": {
+			eh.ReplayFilter{AggregateType: FilteredAggregateType, To: from},
+			[]eh.Event{},
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Log("replay with filter:", name)
+		events, errs := streamer.Replay(ctx, tc.filter)
+		replayed := []eh.Event{}
+		for event := range events {
+			// Only check the events saved by this test.
+			if event.AggregateID() == id1 || event.AggregateID() == id2 {
+				replayed = append(replayed, event)
+			}
+		}
+		if err := <-errs; err != nil {
+			t.Error("there should be no error:", err)
+		}
+		if len(replayed) != len(tc.expected) {
+			t.Error("there should be only the matching events:", eventsToString(replayed))
+			continue
+		}
+		for i, event := range replayed {
+			if err := mocks.CompareEvents(event, tc.expected[i]); err != nil {
+				t.Error("the event was incorrect:", err)
+			}
+			if event.Version() != tc.expected[i].Version() {
+				t.Error("the event version should be correct:", event, event.Version())
+			}
+		}
+	}
+}
+
+// GlobalPositionCommonTests are test cases that are common to all
+// implementations of event stores that assign global positions to events.
+func GlobalPositionCommonTests(t *testing.T, ctx context.Context, store eh.EventStore) {
+	t.Log("save events to different aggregates")
+	id1 := eh.NewUUID()
+	agg1 := mocks.NewAggregate(id1)
+	id2 := eh.NewUUID()
+	agg2 := mocks.NewAggregate(id2)
+	event1 := agg1.NewEvent(mocks.EventType, &mocks.EventData{"event1"})
+	agg1.ApplyEvent(ctx, event1) // Apply event to increment the aggregate version.
+	event2 := agg1.NewEvent(mocks.EventType, &mocks.EventData{"event2"})
+	agg1.ApplyEvent(ctx, event2) // Apply event to increment the aggregate version.
+	event3 := agg2.NewEvent(mocks.EventType, &mocks.EventData{"event3"})
+	agg2.ApplyEvent(ctx, event3) // Apply event to increment the aggregate version.
+	event4 := agg1.NewEvent(mocks.EventType, &mocks.EventData{"event4"})
+	agg1.ApplyEvent(ctx, event4) // Apply event to increment the aggregate version.
+	if err := store.Save(ctx, []eh.Event{event1, event2}, 0); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if err := store.Save(ctx, []eh.Event{event3}, 0); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if err := store.Save(ctx, []eh.Event{event4}, 2); err != nil {
+		t.Error("there should be no error:", err)
+	}
+
+	t.Log("load events with strictly increasing positions")
+	events1, err := store.Load(ctx, mocks.AggregateType, id1)
+	if err != nil {
+		t.Error("there should be no error:", err)
+	}
+	events2, err := store.Load(ctx, mocks.AggregateType, id2)
+	if err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if len(events1) != 3 || len(events2) != 1 {
+		t.Fatal("there should be all events:", eventsToString(events1), eventsToString(events2))
+	}
+	var positions []int64
+	for _, event := range []eh.Event{events1[0], events1[1], events2[0], events1[2]} {
+		positioned, ok := event.(eh.PositionedEvent)
+		if !ok {
+			t.Fatal("the event should have a global position:", event)
+		}
+		positions = append(positions, positioned.GlobalPosition())
+	}
+	for i := 1; i < len(positions); i++ {
+		if positions[i] <= positions[i-1] {
+			t.Error("the positions should be strictly increasing in save order:", positions)
+		}
+	}
+
+	t.Log("save events concurrently")
+	var wg sync.WaitGroup
+	concurrent := make([]eh.Event, 10)
+	for i := range concurrent {
+		agg := mocks.NewAggregate(eh.NewUUID())
+		concurrent[i] = agg.NewEvent(mocks.EventType, &mocks.EventData{fmt.Sprintf("concurrent%d", i)})
+		agg.ApplyEvent(ctx, concurrent[i]) // Apply event to increment the aggregate version.
+		wg.Add(1)
+		go func(event eh.Event) {
+			defer wg.Done()
+			if err := store.Save(ctx, []eh.Event{event}, 0); err != nil {
+				t.Error("there should be no error:", err)
+			}
+		}(concurrent[i])
+	}
+	wg.Wait()
+	seen := map[int64]bool{}
+	for _, event := range concurrent {
+		loaded, err := store.Load(ctx, mocks.AggregateType, event.AggregateID())
+		if err != nil {
+			t.Error("there should be no error:", err)
+		}
+		if len(loaded) != 1 {
+			t.Fatal("there should be one event:", eventsToString(loaded))
+		}
+		positioned, ok := loaded[0].(eh.PositionedEvent)
+		if !ok {
+			t.Fatal("the event should have a global position:", loaded[0])
+		}
+		position := positioned.GlobalPosition()
+		if seen[position] || position <= positions[len(positions)-1] {
+			t.Error("the position should be unique and after the earlier saves:", position)
+		}
+		seen[position] = true
+	}
+
+	if positioner, ok := store.(eh.HeadPositioner); ok {
+		t.Log("head position after the saves")
+		head, err := positioner.HeadPosition(ctx)
+		if err != nil {
+			t.Error("there should be no error:", err)
+		}
+		for position := range seen {
+			if position > head {
+				t.Error("the head position should be the last position:", head, position)
+			}
+		}
+		if !seen[head] {
+			t.Error("the head position should be the last saved event:", head)
+		}
+	}
+
+	streamer, ok := store.(eh.FilteredEventStreamer)
+	if !ok {
+		return
+	}
+
+	t.Log("replay events after a position")
+	events, errs := streamer.Replay(ctx, eh.ReplayFilter{AfterPosition: positions[1]})
+	replayed := []eh.Event{}
+	for event := range events {
+		// Only check the events saved by this test.
+		if event.AggregateID() == id1 || event.AggregateID() == id2 {
+			replayed = append(replayed, event)
+		}
+	}
+	if err := <-errs; err != nil {
+		t.Error("there should be no error:", err)
+	}
+	expectedEvents := []eh.Event{event3, event4}
+	if len(replayed) != len(expectedEvents) {
+		t.Fatal("there should be the events after the position:", eventsToString(replayed))
+	}
+	for i, event := range replayed {
+		if err := mocks.CompareEvents(event, expectedEvents[i]); err != nil {
+			t.Error("the event was incorrect:", err)
+		}
+	}
+}
+
+// ExpectedVersionCommonTests are test cases that are common to all
+// implementations of event stores that support saving with
+// ExpectedVersionAny and ExpectedVersionNoStream.
+func ExpectedVersionCommonTests(t *testing.T, ctx context.Context, store eh.EventStore) {
+	t.Log("save event to a new aggregate, expecting no stream")
+	id1 := eh.NewUUID()
+	agg1 := mocks.NewAggregate(id1)
+	event1 := agg1.NewEvent(mocks.EventType, &mocks.EventData{"event1"})
+	agg1.ApplyEvent(ctx, event1) // Apply event to increment the aggregate version.
+	if err := store.Save(ctx, []eh.Event{event1}, eh.ExpectedVersionNoStream); err != nil {
+		t.Error("there should be no error:", err)
+	}
+
+	t.Log("try to save event to an existing aggregate, expecting no stream")
+	other := mocks.NewAggregate(id1)
+	otherEvent := other.NewEvent(mocks.EventType, &mocks.EventData{"other"})
+	err := store.Save(ctx, []eh.Event{otherEvent}, eh.ExpectedVersionNoStream)
+	if !errors.Is(err, eh.ErrStreamAlreadyExists) {
+		t.Error("there should be a stream already exists error:", err)
+	}
+
+	t.Log("save events to an existing aggregate, expecting any version")
+	stale := mocks.NewAggregate(id1)
+	staleEvent1 := stale.NewEvent(mocks.EventType, &mocks.EventData{"stale1"})
+	stale.ApplyEvent(ctx, staleEvent1) // Apply event to increment the aggregate version.
+	staleEvent2 := stale.NewEvent(mocks.EventType, &mocks.EventData{"stale2"})
+	stale.ApplyEvent(ctx, staleEvent2) // Apply event to increment the aggregate version.
+	if err := store.Save(ctx, []eh.Event{staleEvent1, staleEvent2}, eh.ExpectedVersionAny); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	events, err := store.Load(ctx, mocks.AggregateType, id1)
+	if err != nil {
+		t.Error("there should be no error:", err)
+	}
+	expectedContent := []string{"event1", "stale1", "stale2"}
+	if len(events) != len(expectedContent) {
+		t.Fatal("there should be all events:", eventsToString(events))
+	}
+	for i, event := range events {
+		if event.Version() != i+1 {
+			t.Error("the event should be renumbered after the current version:", event.Version())
+		}
+		if data, ok := event.Data().(*mocks.EventData); !ok || data.Content != expectedContent[i] {
+			t.Error("the event data should be correct:", event.Data())
+		}
+	}
+
+	t.Log("save event to a new aggregate, expecting any version")
+	id2 := eh.NewUUID()
+	agg2 := mocks.NewAggregate(id2)
+	event2 := agg2.NewEvent(mocks.EventType, &mocks.EventData{"event2"})
+	agg2.ApplyEvent(ctx, event2) // Apply event to increment the aggregate version.
+	if err := store.Save(ctx, []eh.Event{event2}, eh.ExpectedVersionAny); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	loadAndCompare(t, ctx, store, id2, []eh.Event{event2})
+
+	t.Log("try to save events with non consecutive versions, expecting any version")
+	event3 := agg2.NewEvent(mocks.EventType, &mocks.EventData{"event3"})
+	agg2.ApplyEvent(ctx, event3) // Apply event to increment the aggregate version.
+	event4 := agg2.NewEvent(mocks.EventType, &mocks.EventData{"event4"})
+	agg2.ApplyEvent(ctx, event4) // Apply event to increment the aggregate version.
+	err = store.Save(ctx, []eh.Event{event2, event4}, eh.ExpectedVersionAny)
+	if !errors.Is(err, eh.ErrIncorrectEventVersion) {
+		t.Error("there should be an incorrect event version error:", err)
+	}
+	loadAndCompare(t, ctx, store, id2, []eh.Event{event2})
+
+	t.Log("try to save event with a stale version")
+	err = store.Save(ctx, []eh.Event{staleEvent2}, 1)
+	if !errors.Is(err, eh.ErrIncorrectEventVersion) {
+		t.Error("there should be a ErrIncorrectEventVersion error:", err)
+	}
+	var esErr eh.EventStoreError
+	if !errors.As(err, &esErr) || esErr.ExpectedVersion != 1 || esErr.ActualVersion != 3 {
+		t.Error("the conflicting versions should be correct:", esErr.ExpectedVersion, esErr.ActualVersion)
+	}
+	if events, _ := store.Load(ctx, mocks.AggregateType, id1); len(events) != 3 {
+		t.Error("there should be no new events:", eventsToString(events))
+	}
+}
+
+// ReverseLoaderCommonTests are test cases that are common to all
+// implementations of event stores that can load events newest first.
+func ReverseLoaderCommonTests(t *testing.T, ctx context.Context, store eh.EventStore) {
+	loader, ok := store.(eh.EventStoreReverseLoader)
+	if !ok {
+		t.Fatal("the store should be a reverse loader")
+	}
+
+	t.Log("save events")
+	id := eh.NewUUID()
+	agg := mocks.NewAggregate(id)
+	var saved []eh.Event
+	for i := 0; i < 4; i++ {
+		event := agg.NewEvent(mocks.EventType, &mocks.EventData{fmt.Sprintf("event%d", i+1)})
+		agg.ApplyEvent(ctx, event) // Apply event to increment the aggregate version.
+		saved = append(saved, event)
+	}
+	if err := store.Save(ctx, saved, 0); err != nil {
+		t.Error("there should be no error:", err)
+	}
+
+	cases := []struct {
+		name     string
+		limit    int
+		expected []eh.Event
+	}{
+		{"limit", 2, []eh.Event{saved[3], saved[2]}},
+		{"limit larger than the stream", 10, []eh.Event{saved[3], saved[2], saved[1], saved[0]}},
+		{"no limit", 0, []eh.Event{saved[3], saved[2], saved[1], saved[0]}},
+	}
+	for _, tc := range cases {
+		t.Log("load events in reverse with", tc.name)
+		events, err := loader.LoadReverse(ctx, mocks.AggregateType, id, tc.limit)
+		if err != nil {
+			t.Error("there should be no error:", err)
+		}
+		if len(events) != len(tc.expected) {
+			t.Errorf("there should be %d events: %s", len(tc.expected), eventsToString(events))
+			continue
+		}
+		for i, event := range events {
+			if err := mocks.CompareEvents(event, tc.expected[i]); err != nil {
+				t.Error("the event was incorrect:", err)
+			}
+			if event.Version() != tc.expected[i].Version() {
+				t.Error("the events should be newest first:", eventsToString(events))
+			}
+		}
+	}
+
+	t.Log("load events in reverse for a non existing aggregate")
+	events, err := loader.LoadReverse(ctx, mocks.AggregateType, eh.NewUUID(), 2)
+	if err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if len(events) != 0 {
+		t.Error("there should be no events:", eventsToString(events))
+	}
+}
+
+// UpcasterCommonTests are test cases that are common to all implementations
+// of event stores that store the schema version of the event data. It
+// registers the event data of the test event type, and can therefore only be
+// run once per test binary.
+func UpcasterCommonTests(t *testing.T, ctx context.Context, store eh.EventStore) {
+	eh.RegisterEventData(UpcastEventType, func() eh.EventData {
+		return &UpcastEventDataV1{}
+	})
+
+	t.Log("save event with version 1 of the event data")
+	id := eh.NewUUID()
+	agg := mocks.NewAggregate(id)
+	event1 := agg.NewEvent(UpcastEventType, &UpcastEventDataV1{"event1"})
+	agg.ApplyEvent(ctx, event1) // Apply event to increment the aggregate version.
+	if err := store.Save(ctx, []eh.Event{event1}, 0); err != nil {
+		t.Error("there should be no error:", err)
+	}
+
+	t.Log("load event without an upcaster for version 1")
+	eh.RegisterVersionedEventData(UpcastEventType, 2, func() eh.EventData {
+		return &UpcastEventDataV2{}
+	})
+	_, err := store.Load(ctx, mocks.AggregateType, id)
+	if !errors.Is(err, eh.ErrUpcasterNotRegistered) {
+		t.Error("there should be a ErrUpcasterNotRegistered error:", err)
+	}
+
+	t.Log("load event with an upcaster for version 1")
+	eh.RegisterUpcaster(UpcastEventType, 1, func(data eh.EventData) (eh.EventData, error) {
+		v1, ok := data.(*UpcastEventDataV1)
+		if !ok {
+			t.Errorf("the event data should be version 1: %T", data)
+		}
+		return &UpcastEventDataV2{Content: v1.Content, Length: len(v1.Content)}, nil
+	})
+	events, err := store.Load(ctx, mocks.AggregateType, id)
+	if err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if len(events) != 1 {
+		t.Fatal("there should be one event:", eventsToString(events))
+	}
+	if !reflect.DeepEqual(events[0].Data(), &UpcastEventDataV2{"event1", 6}) {
+		t.Error("the event data should be upcasted:", events[0].Data())
+	}
+
+	t.Log("save and load event with version 2 of the event data")
+	event2 := agg.NewEvent(UpcastEventType, &UpcastEventDataV2{"event2", 6})
+	agg.ApplyEvent(ctx, event2) // Apply event to increment the aggregate version.
+	if err := store.Save(ctx, []eh.Event{event2}, 1); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	events, err = store.Load(ctx, mocks.AggregateType, id)
+	if err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if len(events) != 2 {
+		t.Fatal("there should be two events:", eventsToString(events))
+	}
+	if !reflect.DeepEqual(events[1].Data(), &UpcastEventDataV2{"event2", 6}) {
+		t.Error("the event data should be correct:", events[1].Data())
+	}
+}
+
+// AggregateTypeAliasCommonTests are test cases that are common to all
+// implementations of event stores that resolve aliased aggregate types. It
+// registers an alias for the mock aggregate type, and can therefore only be
+// run once per test binary.
+func AggregateTypeAliasCommonTests(t *testing.T, ctx context.Context, store eh.EventStore) {
+	t.Log("save events with the old aggregate type")
+	id := eh.NewUUID()
+	agg := eh.NewAggregateBase(AliasedAggregateType, id)
+	event1 := agg.NewEvent(mocks.EventType, &mocks.EventData{"event1"})
+	agg.IncrementVersion()
+	event2 := agg.NewEvent(mocks.EventType, &mocks.EventData{"event2"})
+	if err := store.Save(ctx, []eh.Event{event1, event2}, 0); err != nil {
+		t.Error("there should be no error:", err)
+	}
+
+	t.Log("load events with the new aggregate type")
+	eh.AliasAggregateType(AliasedAggregateType, mocks.AggregateType)
+	events, err := store.Load(ctx, mocks.AggregateType, id)
+	if err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if len(events) != 2 {
+		t.Fatal("there should be two events:", eventsToString(events))
+	}
+	for i, event := range events {
+		if event.AggregateType() != mocks.AggregateType {
+			t.Error("the aggregate type should be resolved:", event.AggregateType())
+		}
+		if event.AggregateID() != id || event.Version() != i+1 {
+			t.Error("the event aggregate ID and version should be correct:", event)
+		}
+	}
+	if !reflect.DeepEqual(events[1].Data(), &mocks.EventData{"event2"}) {
+		t.Error("the event data should be correct:", events[1].Data())
+	}
+}
+
+// EventStoreBatchSaverCommonTests are test cases that are common to all
+// implementations of event stores that can save batches of events.
+func EventStoreBatchSaverCommonTests(t *testing.T, ctx context.Context, store eh.EventStore) {
+	saver, ok := store.(eh.EventStoreBatchSaver)
+	if !ok {
+		t.Fatal("the store should be a batch saver")
+	}
+
+	t.Log("save batch without events")
+	err := saver.SaveBatch(ctx, map[eh.UUID][]eh.Event{}, nil)
+	if !errors.Is(err, eh.ErrNoEventsToAppend) {
+		t.Error("there should be a ErrNoEventsToAppend error:", err)
+	}
+
+	t.Log("save batch for two new aggregates")
+	id1 := eh.NewUUID()
+	agg1 := mocks.NewAggregate(id1)
+	event1 := agg1.NewEvent(mocks.EventType, &mocks.EventData{"event1"})
+	agg1.ApplyEvent(ctx, event1) // Apply event to increment the aggregate version.
+	id2 := eh.NewUUID()
+	agg2 := mocks.NewAggregate(id2)
+	event2 := agg2.NewEvent(mocks.EventType, &mocks.EventData{"event2"})
+	agg2.ApplyEvent(ctx, event2) // Apply event to increment the aggregate version.
+	event3 := agg2.NewEvent(mocks.EventOtherType, nil)
+	agg2.ApplyEvent(ctx, event3) // Apply event to increment the aggregate version.
+	err = saver.SaveBatch(ctx, map[eh.UUID][]eh.Event{
+		id1: {event1},
+		id2: {event2, event3},
+	}, nil)
+	if err != nil {
+		t.Error("there should be no error:", err)
+	}
+	loadAndCompare(t, ctx, store, id1, []eh.Event{event1})
+	loadAndCompare(t, ctx, store, id2, []eh.Event{event2, event3})
+
+	t.Log("save batch for existing and new aggregates")
+	event4 := agg1.NewEvent(mocks.EventType, &mocks.EventData{"event4"})
+	agg1.ApplyEvent(ctx, event4) // Apply event to increment the aggregate version.
+	id3 := eh.NewUUID()
+	agg3 := mocks.NewAggregate(id3)
+	event5 := agg3.NewEvent(mocks.EventType, &mocks.EventData{"event5"})
+	agg3.ApplyEvent(ctx, event5) // Apply event to increment the aggregate version.
+	err = saver.SaveBatch(ctx, map[eh.UUID][]eh.Event{
+		id1: {event4},
+		id3: {event5},
+	}, map[eh.UUID]int{id1: 1})
+	if err != nil {
+		t.Error("there should be no error:", err)
+	}
+	loadAndCompare(t, ctx, store, id1, []eh.Event{event1, event4})
+	loadAndCompare(t, ctx, store, id3, []eh.Event{event5})
+
+	t.Log("save batch with an incorrect version for one aggregate")
+	event6 := agg1.NewEvent(mocks.EventType, &mocks.EventData{"event6"})
+	agg1.ApplyEvent(ctx, event6) // Apply event to increment the aggregate version.
+	event7 := agg3.NewEvent(mocks.EventType, &mocks.EventData{"event7"})
+	agg3.ApplyEvent(ctx, event7) // Apply event to increment the aggregate version.
+	id4 := eh.NewUUID()
+	agg4 := mocks.NewAggregate(id4)
+	event8 := agg4.NewEvent(mocks.EventType, &mocks.EventData{"event8"})
+	agg4.ApplyEvent(ctx, event8) // Apply event to increment the aggregate version.
+	if err := store.Save(ctx, []eh.Event{event7}, 1); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	err = saver.SaveBatch(ctx, map[eh.UUID][]eh.Event{
+		id1: {event6},
+		id3: {event7},
+		id4: {event8},
+	}, map[eh.UUID]int{id1: 2, id3: 1})
+	if !errors.Is(err, eh.ErrIncorrectEventVersion) {
+		t.Error("there should be a ErrIncorrectEventVersion error:", err)
+	}
+	var esErr eh.EventStoreError
+	if !errors.As(err, &esErr) || esErr.ExpectedVersion != 1 || esErr.ActualVersion != 2 {
+		t.Error("the conflicting versions should be correct:", esErr.ExpectedVersion, esErr.ActualVersion)
+	}
+
+	t.Log("no events should be saved from the failed batch")
+	loadAndCompare(t, ctx, store, id1, []eh.Event{event1, event4})
+	loadAndCompare(t, ctx, store, id3, []eh.Event{event5, event7})
+	loadAndCompare(t, ctx, store, id4, []eh.Event{})
+}
+
+// TransactionalEventStoreCommonTests are test cases that are common to all
+// implementations of event stores that can save events in transactions.
+func TransactionalEventStoreCommonTests(t *testing.T, ctx context.Context, store eh.EventStore) {
+	transactional, ok := store.(eh.TransactionalEventStore)
+	if !ok {
+		t.Fatal("the store should be transactional")
+	}
+
+	t.Log("save a transaction for two aggregates")
+	id1 := eh.NewUUID()
+	agg1 := mocks.NewAggregate(id1)
+	event1 := agg1.NewEvent(mocks.EventType, &mocks.EventData{"event1"})
+	agg1.ApplyEvent(ctx, event1) // Apply event to increment the aggregate version.
+	event2 := agg1.NewEvent(mocks.EventType, &mocks.EventData{"event2"})
+	agg1.ApplyEvent(ctx, event2) // Apply event to increment the aggregate version.
+	id2 := eh.NewUUID()
+	agg2 := mocks.NewAggregate(id2)
+	event3 := agg2.NewEvent(mocks.EventType, &mocks.EventData{"event3"})
+	agg2.ApplyEvent(ctx, event3) // Apply event to increment the aggregate version.
+	err := transactional.SaveInTransaction(ctx, func(tx eh.EventStoreTx) error {
+		if err := tx.Save([]eh.Event{event1}, 0); err != nil {
+			return err
+		}
+		if err := tx.Save([]eh.Event{event3}, 0); err != nil {
+			return err
+		}
+		// Save more events for the first aggregate.
+		return tx.Save([]eh.Event{event2}, 1)
+	})
+	if err != nil {
+		t.Error("there should be no error:", err)
+	}
+	loadAndCompare(t, ctx, store, id1, []eh.Event{event1, event2})
+	loadAndCompare(t, ctx, store, id2, []eh.Event{event3})
+
+	t.Log("roll back a transaction with a version conflict for one aggregate")
+	event4 := agg1.NewEvent(mocks.EventType, &mocks.EventData{"event4"})
+	agg1.ApplyEvent(ctx, event4) // Apply event to increment the aggregate version.
+	event5 := agg2.NewEvent(mocks.EventType, &mocks.EventData{"event5"})
+	agg2.ApplyEvent(ctx, event5) // Apply event to increment the aggregate version.
+	id3 := eh.NewUUID()
+	agg3 := mocks.NewAggregate(id3)
+	event6 := agg3.NewEvent(mocks.EventType, &mocks.EventData{"event6"})
+	agg3.ApplyEvent(ctx, event6) // Apply event to increment the aggregate version.
+	err = transactional.SaveInTransaction(ctx, func(tx eh.EventStoreTx) error {
+		if err := tx.Save([]eh.Event{event4}, 2); err != nil {
+			return err
+		}
+		if err := tx.Save([]eh.Event{event6}, 0); err != nil {
+			return err
+		}
+		// The second aggregate is at version 1.
+		return tx.Save([]eh.Event{event5}, 0)
+	})
+	if !errors.Is(err, eh.ErrIncorrectEventVersion) {
+		t.Error("there should be a ErrIncorrectEventVersion error:", err)
+	}
+	loadAndCompare(t, ctx, store, id1, []eh.Event{event1, event2})
+	loadAndCompare(t, ctx, store, id2, []eh.Event{event3})
+	loadAndCompare(t, ctx, store, id3, []eh.Event{})
+
+	t.Log("roll back a transaction when the function fails")
+	txErr := errors.New("transaction error")
+	err = transactional.SaveInTransaction(ctx, func(tx eh.EventStoreTx) error {
+		if err := tx.Save([]eh.Event{event4}, 2); err != nil {
+			return err
+		}
+		return txErr
+	})
+	if err != txErr {
+		t.Error("there should be a transaction error:", err)
+	}
+	loadAndCompare(t, ctx, store, id1, []eh.Event{event1, event2})
+
+	t.Log("return an error for events that do not follow the transaction")
+	err = transactional.SaveInTransaction(ctx, func(tx eh.EventStoreTx) error {
+		if err := tx.Save([]eh.Event{event4}, 2); err != nil {
+			return err
+		}
+		if err := tx.Save([]eh.Event{event4}, 2); !errors.Is(err, eh.ErrIncorrectEventVersion) {
+			t.Error("there should be a ErrIncorrectEventVersion error:", err)
+		}
+		if err := tx.Save([]eh.Event{}, 0); !errors.Is(err, eh.ErrNoEventsToAppend) {
+			t.Error("there should be a ErrNoEventsToAppend error:", err)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Error("there should be no error:", err)
+	}
+	loadAndCompare(t, ctx, store, id1, []eh.Event{event1, event2, event4})
+
+	t.Log("save an empty transaction")
+	if err := transactional.SaveInTransaction(ctx, func(tx eh.EventStoreTx) error {
+		return nil
+	}); err != nil {
+		t.Error("there should be no error:", err)
+	}
+}
+
+// EventStoreCompacterCommonTests are test cases that are common to all
+// implementations of event stores that can compact aggregates.
+func EventStoreCompacterCommonTests(t *testing.T, ctx context.Context, store eh.EventStore) {
+	compacter, ok := store.(eh.EventStoreCompacter)
+	if !ok {
+		t.Fatal("the store should be a compacter")
+	}
+
+	t.Log("compact a non existing aggregate")
+	err := compacter.Compact(ctx, mocks.AggregateType, eh.NewUUID(), 1)
+	if !errors.Is(err, eh.ErrAggregateNotFound) {
+		t.Error("there should be a ErrAggregateNotFound error:", err)
+	}
+
+	id := eh.NewUUID()
+	agg := mocks.NewAggregate(id)
+	events := []eh.Event{}
+	for i := 0; i < 4; i++ {
+		event := agg.NewEvent(mocks.EventType, &mocks.EventData{fmt.Sprintf("event%d", i+1)})
+		agg.ApplyEvent(ctx, event) // Apply event to increment the aggregate version.
+		events = append(events, event)
+	}
+	if err := store.Save(ctx, events, 0); err != nil {
+		t.Error("there should be no error:", err)
+	}
+
+	t.Log("compact past the latest version")
+	err = compacter.Compact(ctx, mocks.AggregateType, id, 5)
+	if !errors.Is(err, eh.ErrIncorrectCompactVersion) {
+		t.Error("there should be a ErrIncorrectCompactVersion error:", err)
+	}
+	loadAndCompare(t, ctx, store, id, events)
+
+	t.Log("compact to an earlier version")
+	if err := compacter.Compact(ctx, mocks.AggregateType, id, 3); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	loadAndCompare(t, ctx, store, id, events[2:])
+
+	if loader, ok := store.(eh.EventStoreVersionLoader); ok {
+		tail, err := loader.LoadFrom(ctx, mocks.AggregateType, id, 1)
+		if err != nil {
+			t.Error("there should be no error:", err)
+		}
+		if len(tail) != 2 || tail[0].Version() != 3 {
+			t.Error("only the remaining events should be loaded:", eventsToString(tail))
+		}
+	}
+
+	t.Log("save after compacting")
+	event5 := agg.NewEvent(mocks.EventType, &mocks.EventData{"event5"})
+	agg.ApplyEvent(ctx, event5) // Apply event to increment the aggregate version.
+	if err := store.Save(ctx, []eh.Event{event5}, 4); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	loadAndCompare(t, ctx, store, id, append(events[2:], event5))
+
+	t.Log("compact to the latest version")
+	if err := compacter.Compact(ctx, mocks.AggregateType, id, 5); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	loadAndCompare(t, ctx, store, id, []eh.Event{event5})
+}
+
+// StoreTimestampCommonTests are test cases that are common to all
+// implementations of event stores that set the timestamps of saved events,
+// where the store must use a clock that always returns now.
+func StoreTimestampCommonTests(t *testing.T, ctx context.Context, store eh.EventStore, now time.Time) {
+	id := eh.NewUUID()
+	agg := mocks.NewAggregate(id)
+	event1 := agg.NewEvent(mocks.EventType, &mocks.EventData{"event1"})
+	agg.ApplyEvent(ctx, event1) // Apply event to increment the aggregate version.
+	event2 := agg.NewEvent(mocks.EventType, &mocks.EventData{"event2"})
+	agg.ApplyEvent(ctx, event2) // Apply event to increment the aggregate version.
+	if event1.Timestamp().Equal(now) {
+		t.Fatal("the event should be created at another time:", event1.Timestamp())
+	}
+
+	t.Log("save events with the time of the store")
+	if err := store.Save(ctx, []eh.Event{event1, event2}, 0); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	events, err := store.Load(ctx, mocks.AggregateType, id)
+	if err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if len(events) != 2 {
+		t.Fatal("there should be two events:", events)
+	}
+	for _, e := range events {
+		if !e.Timestamp().Equal(now) {
+			t.Error("the timestamp should be from the store:", e.Timestamp())
+		}
+	}
+}
+
+// MaxEventsPerSaveCommonTests are test cases that are common to all
+// implementations of event stores that limit the number of events per save,
+// where the store must be configured with a limit of max events.
+func MaxEventsPerSaveCommonTests(t *testing.T, ctx context.Context, store eh.EventStore, max int) {
+	id := eh.NewUUID()
+	agg := mocks.NewAggregate(id)
+	var events []eh.Event
+	for i := 0; i <= max; i++ {
+		event := agg.NewEvent(mocks.EventType, &mocks.EventData{fmt.Sprint("event", i)})
+		agg.ApplyEvent(ctx, event) // Apply event to increment the aggregate version.
+		events = append(events, event)
+	}
+
+	t.Log("save more events than the limit")
+	err := store.Save(ctx, events, 0)
+	if !errors.Is(err, eh.ErrTooManyEvents) {
+		t.Error("there should be a ErrTooManyEvents error:", err)
+	}
+	if events, err := store.Load(ctx, mocks.AggregateType, id); err != nil || len(events) != 0 {
+		t.Error("there should be no events saved:", events, err)
+	}
+
+	t.Log("save events up to the limit")
+	if err := store.Save(ctx, events[:max], 0); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	loaded, err := store.Load(ctx, mocks.AggregateType, id)
+	if err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if len(loaded) != max {
+		t.Error("the events should be saved:", loaded)
+	}
+}
+
+// DuplicateEventsCommonTests are test cases that are common to all
+// implementations of event stores that reject or skip events with the id of
+// an event that is already saved, as set by d.
+func DuplicateEventsCommonTests(t *testing.T, ctx context.Context, store eh.EventStore, d eh.DuplicateEvents) {
+	withID := eh.WithEventID(eh.NamedEventIDs(eh.NewUUID()))
+	id := eh.NewUUID()
+	agg := mocks.NewAggregate(id)
+	var events []eh.Event
+	for i := 1; i <= 3; i++ {
+		event := agg.NewEvent(mocks.EventType, &mocks.EventData{fmt.Sprint("event", i)}, withID)
+		agg.ApplyEvent(ctx, event) // Apply event to increment the aggregate version.
+		events = append(events, event)
+	}
+	if err := store.Save(ctx, events[:2], 0); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+
+	t.Log("save events that were already saved")
+	err := store.Save(ctx, events[:2], 0)
+	switch d {
+	case eh.DuplicateEventsRejected:
+		if !errors.Is(err, eh.ErrDuplicateEvent) {
+			t.Error("there should be a ErrDuplicateEvent error:", err)
+		}
+	case eh.DuplicateEventsSkipped:
+		if err != nil {
+			t.Error("there should be no error:", err)
+		}
+	}
+	loadAndCompare(t, ctx, store, id, events[:2])
+
+	t.Log("save a duplicate with a new event")
+	err = store.Save(ctx, events[1:], 1)
+	switch d {
+	case eh.DuplicateEventsRejected:
+		if !errors.Is(err, eh.ErrDuplicateEvent) {
+			t.Error("there should be a ErrDuplicateEvent error:", err)
+		}
+		loadAndCompare(t, ctx, store, id, events[:2])
+		if err := store.Save(ctx, events[2:], 2); err != nil {
+			t.Error("there should be no error:", err)
+		}
+	case eh.DuplicateEventsSkipped:
+		if err != nil {
+			t.Error("there should be no error:", err)
+		}
+	}
+	loadAndCompare(t, ctx, store, id, events)
+
+	t.Log("save a duplicate after a new event, from an outdated version")
+	staleAgg := mocks.NewAggregate(id)
+	for _, event := range events[:2] {
+		staleAgg.ApplyEvent(ctx, event)
+	}
+	otherID := eh.WithEventID(eh.NamedEventIDs(eh.NewUUID()))
+	var staleEvents []eh.Event
+	for _, opt := range []eh.EventOption{
+		otherID,
+		eh.WithMetadata(map[string]interface{}{eh.EventIDKey: eh.EventID(events[2]).String()}),
+		otherID,
+	} {
+		event := staleAgg.NewEvent(mocks.EventType, &mocks.EventData{"stale"}, opt)
+		staleAgg.ApplyEvent(ctx, event)
+		staleEvents = append(staleEvents, event)
+	}
+	err = store.Save(ctx, staleEvents, 2)
+	switch d {
+	case eh.DuplicateEventsRejected:
+		if !errors.Is(err, eh.ErrDuplicateEvent) {
+			t.Error("there should be a ErrDuplicateEvent error:", err)
+		}
+	case eh.DuplicateEventsSkipped:
+		if !errors.Is(err, eh.ErrIncorrectEventVersion) {
+			t.Error("there should be a ErrIncorrectEventVersion error:", err)
+		}
+	}
+	loadAndCompare(t, ctx, store, id, events)
+
+	t.Log("save events with the same id")
+	sameID := eh.WithEventID(func(eh.UUID, int) eh.UUID { return eh.NewNamedUUID(id, "same") })
+	event4 := agg.NewEvent(mocks.EventType, &mocks.EventData{"event4"}, sameID)
+	agg.ApplyEvent(ctx, event4)
+	event5 := agg.NewEvent(mocks.EventType, &mocks.EventData{"event5"}, sameID)
+	agg.ApplyEvent(ctx, event5)
+	if err := store.Save(ctx, []eh.Event{event4, event5}, 3); !errors.Is(err, eh.ErrDuplicateEvent) {
+		t.Error("there should be a ErrDuplicateEvent error:", err)
+	}
+	loadAndCompare(t, ctx, store, id, events)
+
+	t.Log("save events without ids")
+	otherAgg := mocks.NewAggregate(eh.NewUUID())
+	event6 := otherAgg.NewEvent(mocks.EventType, &mocks.EventData{"event6"})
+	otherAgg.ApplyEvent(ctx, event6)
+	event7 := otherAgg.NewEvent(mocks.EventType, &mocks.EventData{"event6"})
+	otherAgg.ApplyEvent(ctx, event7)
+	if err := store.Save(ctx, []eh.Event{event6, event7}, 0); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	loadAndCompare(t, ctx, store, otherAgg.AggregateID(), []eh.Event{event6, event7})
+}
+
+// TimeLoaderCommonTests are test cases that are common to all implementations
+// of event stores that can load the events within a time range.
+func TimeLoaderCommonTests(t *testing.T, ctx context.Context, store eh.EventStore) {
+	loader, ok := store.(eh.EventStoreTimeLoader)
+	if !ok {
+		t.Fatal("the store should be a time loader")
+	}
+
+	// Use timestamps with millisecond precision, as stored by some DBs.
+	start := time.Date(2020, time.January, 1, 12, 0, 0, 0, time.UTC)
+	id := eh.NewUUID()
+	agg := mocks.NewAggregate(id)
+	events := []eh.Event{}
+	for i := 0; i < 4; i++ {
+		event := agg.NewEvent(mocks.EventType, &mocks.EventData{fmt.Sprintf("event%d", i+1)})
+		agg.ApplyEvent(ctx, event) // Apply event to increment the aggregate version.
+		events = append(events, timedEvent{Event: event, timestamp: start.Add(time.Duration(i) * time.Minute)})
+	}
+	if err := store.Save(ctx, events, 0); err != nil {
+		t.Error("there should be no error:", err)
+	}
+
+	t.Log("load with an inclusive start and an exclusive end")
+	loaded, err := loader.LoadBetween(ctx, mocks.AggregateType, id, start.Add(time.Minute), start.Add(3*time.Minute))
+	if err != nil {
+		t.Error("there should be no error:", err)
+	}
+	compareEvents(t, loaded, events[1:3])
+
+	t.Log("load with an open start")
+	loaded, err = loader.LoadBetween(ctx, mocks.AggregateType, id, time.Time{}, start.Add(time.Minute))
+	if err != nil {
+		t.Error("there should be no error:", err)
+	}
+	compareEvents(t, loaded, events[:1])
+
+	t.Log("load with an open end")
+	loaded, err = loader.LoadBetween(ctx, mocks.AggregateType, id, start.Add(2*time.Minute+time.Millisecond), time.Time{})
+	if err != nil {
+		t.Error("there should be no error:", err)
+	}
+	compareEvents(t, loaded, events[3:])
+
+	t.Log("load with an open range")
+	loaded, err = loader.LoadBetween(ctx, mocks.AggregateType, id, time.Time{}, time.Time{})
+	if err != nil {
+		t.Error("there should be no error:", err)
+	}
+	compareEvents(t, loaded, events)
+
+	t.Log("load with an empty range")
+	loaded, err = loader.LoadBetween(ctx, mocks.AggregateType, id, start.Add(time.Minute), start.Add(time.Minute))
+	if err != nil {
+		t.Error("there should be no error:", err)
+	}
+	compareEvents(t, loaded, []eh.Event{})
+
+	t.Log("load from a non existing aggregate")
+	loaded, err = loader.LoadBetween(ctx, mocks.AggregateType, eh.NewUUID(), time.Time{}, time.Time{})
+	if err != nil {
+		t.Error("there should be no error:", err)
+	}
+	compareEvents(t, loaded, []eh.Event{})
+}
+
+// CorrelationLoaderCommonTests are test cases that are common to all
+// implementations of event stores that can load events by correlation ID.
+func CorrelationLoaderCommonTests(t *testing.T, ctx context.Context, store eh.EventStore) {
+	loader, ok := store.(eh.EventStoreCorrelationLoader)
+	if !ok {
+		t.Fatal("the store should be a correlation loader")
+	}
+
+	// Use timestamps with millisecond precision, as stored by some DBs.
+	start := time.Date(2020, time.January, 1, 12, 0, 0, 0, time.UTC)
+	correlationID := eh.NewUUID().String()
+	otherCorrelationID := eh.NewUUID().String()
+	agg1 := mocks.NewAggregate(eh.NewUUID())
+	agg2 := mocks.NewAggregate(eh.NewUUID())
+	newEvent := func(agg *mocks.Aggregate, minute int, correlationID string) eh.Event {
+		opts := []eh.EventOption{}
+		if correlationID != "" {
+			opts = append(opts, eh.WithMetadata(map[string]interface{}{
+				eh.CorrelationIDKey: correlationID,
+			}))
+		}
+		event := agg.NewEvent(mocks.EventType, &mocks.EventData{fmt.Sprintf("event%d", minute)}, opts...)
+		agg.ApplyEvent(ctx, event) // Apply event to increment the aggregate version.
+		return timedEvent{Event: event, timestamp: start.Add(time.Duration(minute) * time.Minute)}
+	}
+
+	t.Log("save events of two aggregates, interleaved in time")
+	events1 := []eh.Event{
+		newEvent(agg1, 0, correlationID),
+		newEvent(agg1, 2, otherCorrelationID),
+		newEvent(agg1, 4, correlationID),
+		newEvent(agg1, 5, ""),
+	}
+	events2 := []eh.Event{
+		newEvent(agg2, 1, correlationID),
+		newEvent(agg2, 3, correlationID),
+	}
+	if err := store.Save(ctx, events1, 0); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if err := store.Save(ctx, events2, 0); err != nil {
+		t.Error("there should be no error:", err)
+	}
+
+	t.Log("load the events of a correlation ID, ordered by timestamp")
+	loaded, err := loader.LoadByCorrelation(ctx, correlationID)
+	if err != nil {
+		t.Error("there should be no error:", err)
+	}
+	compareEvents(t, loaded, []eh.Event{events1[0], events2[0], events2[1], events1[2]})
+
+	t.Log("load the events of another correlation ID")
+	loaded, err = loader.LoadByCorrelation(ctx, otherCorrelationID)
+	if err != nil {
+		t.Error("there should be no error:", err)
+	}
+	compareEvents(t, loaded, events1[1:2])
+
+	t.Log("load the events of a non existing correlation ID")
+	loaded, err = loader.LoadByCorrelation(ctx, eh.NewUUID().String())
+	if err != nil {
+		t.Error("there should be no error:", err)
+	}
+	compareEvents(t, loaded, []eh.Event{})
+}
+
+// timedEvent is an event with another timestamp.
+type timedEvent struct {
+	eh.Event
+	timestamp time.Time
+}
+
+// Timestamp implements the Timestamp method of the eventhorizon.Event interface.
+func (e timedEvent) Timestamp() time.Time {
+	return e.timestamp
+}
+
+// MaxEventsCommonTests are test cases that are common to all implementations
+// of event stores, for loading events with WithMaxEvents.
+func MaxEventsCommonTests(t *testing.T, ctx context.Context, store eh.EventStore) {
+	id := eh.NewUUID()
+	agg := mocks.NewAggregate(id)
+	events := []eh.Event{}
+	for i := 0; i < 4; i++ {
+		event := agg.NewEvent(mocks.EventType, &mocks.EventData{fmt.Sprintf("event%d", i+1)})
+		agg.ApplyEvent(ctx, event) // Apply event to increment the aggregate version.
+		events = append(events, event)
+	}
+	if err := store.Save(ctx, events, 0); err != nil {
+		t.Error("there should be no error:", err)
+	}
+
+	t.Log("load the first events")
+	loaded, err := store.Load(ctx, mocks.AggregateType, id, eh.WithMaxEvents(2))
+	if err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if len(loaded) != 2 {
+		t.Fatal("there should be two events:", eventsToString(loaded))
+	}
+	for i, event := range loaded {
+		if err := mocks.CompareEvents(event, events[i]); err != nil {
+			t.Error("the event was incorrect:", err)
+		}
+		if event.Version() != i+1 {
+			t.Error("the event version should be correct:", event.Version())
+		}
+	}
+
+	t.Log("load with a max of more events than saved")
+	loaded, err = store.Load(ctx, mocks.AggregateType, id, eh.WithMaxEvents(10))
+	if err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if len(loaded) != 4 || loaded[3].Version() != 4 {
+		t.Error("all events should be loaded:", eventsToString(loaded))
+	}
+
+	t.Log("load with no max")
+	loaded, err = store.Load(ctx, mocks.AggregateType, id, eh.WithMaxEvents(0))
+	if err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if len(loaded) != 4 {
+		t.Error("all events should be loaded:", eventsToString(loaded))
+	}
+
+	t.Log("load with a max from a non existing aggregate")
+	loaded, err = store.Load(ctx, mocks.AggregateType, eh.NewUUID(), eh.WithMaxEvents(2))
+	if err != nil && !errors.Is(err, eh.ErrAggregateNotFound) {
+		t.Error("there should be no error:", err)
+	}
+	if len(loaded) != 0 {
+		t.Error("there should be no events:", eventsToString(loaded))
+	}
+}
+
+// OutboxCommonTests are test cases that are common to all implementations of
+// event stores that record the saved events in an outbox.
+func OutboxCommonTests(t *testing.T, ctx context.Context, store eh.EventStore) {
+	outbox, ok := store.(eh.EventStoreOutbox)
+	if !ok {
+		t.Fatal("the store should have an outbox")
+	}
+
+	t.Log("publish earlier entries")
+	entries, err := outbox.ClaimOutbox(ctx, 1000, time.Minute)
+	if err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if err := outbox.MarkPublished(ctx, outboxIDs(entries)); err != nil {
+		t.Error("there should be no error:", err)
+	}
+
+	id := eh.NewUUID()
+	agg := mocks.NewAggregate(id)
+	event1 := agg.NewEvent(mocks.EventType, &mocks.EventData{"event1"})
+	agg.ApplyEvent(ctx, event1) // Apply event to increment the aggregate version.
+	event2 := agg.NewEvent(mocks.EventType, &mocks.EventData{"event2"})
+	agg.ApplyEvent(ctx, event2) // Apply event to increment the aggregate version.
+	event3 := agg.NewEvent(mocks.EventType, &mocks.EventData{"event3"})
+	agg.ApplyEvent(ctx, event3) // Apply event to increment the aggregate version.
+
+	t.Log("save events with outbox entries")
+	if err := store.Save(ctx, []eh.Event{event1, event2}, 0); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if err := store.Save(ctx, []eh.Event{event3}, 2); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	loadAndCompare(t, ctx, store, id, []eh.Event{event1, event2, event3})
+
+	t.Log("claim the entries in order")
+	entries, err = outbox.ClaimOutbox(ctx, 2, time.Minute)
+	if err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if len(entries) != 2 {
+		t.Fatal("there should be two entries:", entries)
+	}
+	for i, expected := range []eh.Event{event1, event2} {
+		if err := mocks.CompareEvents(entries[i].Event, expected); err != nil {
+			t.Error("the event was incorrect:", err)
+		}
+		if entries[i].Event.Version() != expected.Version() {
+			t.Error("the event version should be correct:", entries[i].Event.Version())
+		}
+	}
+
+	t.Log("claim the rest of the entries while leased")
+	rest, err := outbox.ClaimOutbox(ctx, 10, time.Minute)
+	if err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if len(rest) != 1 {
+		t.Fatal("there should be one entry:", rest)
+	}
+	if err := mocks.CompareEvents(rest[0].Event, event3); err != nil {
+		t.Error("the event was incorrect:", err)
+	}
+
+	t.Log("claim again while leased")
+	leased, err := outbox.ClaimOutbox(ctx, 10, time.Minute)
+	if err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if len(leased) != 0 {
+		t.Error("there should be no entries:", leased)
+	}
+
+	t.Log("mark the entries published")
+	if err := outbox.MarkPublished(ctx, outboxIDs(append(entries, rest...))); err != nil {
+		t.Error("there should be no error:", err)
+	}
+
+	t.Log("failed save writes no events or entries")
+	event4 := agg.NewEvent(mocks.EventType, &mocks.EventData{"event4"})
+	agg.ApplyEvent(ctx, event4) // Apply event to increment the aggregate version.
+	other := mocks.NewAggregate(id)
+	other.ApplyEvent(ctx, event1) // Apply events to get the version of event3.
+	other.ApplyEvent(ctx, event2)
+	conflict := other.NewEvent(mocks.EventType, &mocks.EventData{"conflict"})
+	if err := store.Save(ctx, []eh.Event{conflict}, 2); err == nil {
+		t.Error("there should be an error")
+	}
+	loadAndCompare(t, ctx, store, id, []eh.Event{event1, event2, event3})
+	entries, err = outbox.ClaimOutbox(ctx, 10, time.Minute)
+	if err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if len(entries) != 0 {
+		t.Error("there should be no entries:", entries)
+	}
+
+	t.Log("claim again after the lease has expired")
+	if err := store.Save(ctx, []eh.Event{event4}, 3); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if _, err := outbox.ClaimOutbox(ctx, 10, 0); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	entries, err = outbox.ClaimOutbox(ctx, 10, time.Minute)
+	if err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if len(entries) != 1 {
+		t.Fatal("there should be one entry:", entries)
+	}
+	if err := mocks.CompareEvents(entries[0].Event, event4); err != nil {
+		t.Error("the event was incorrect:", err)
+	}
+	if err := outbox.MarkPublished(ctx, outboxIDs(entries)); err != nil {
+		t.Error("there should be no error:", err)
+	}
+}
+
+// AliasedAggregateType is the old aggregate type used in the alias tests.
+const AliasedAggregateType eh.AggregateType = "AliasedAggregate"
+
+// FilteredAggregateType is the other aggregate type used in the filtered
+// replay tests.
+const FilteredAggregateType eh.AggregateType = "FilteredAggregate"
+
+// UpcastEventType is the event type used in the upcaster tests.
+const UpcastEventType eh.EventType = "UpcastEvent"
+
+// UpcastEventDataV1 is version 1 of the event data used in the upcaster tests.
+type UpcastEventDataV1 struct {
+	Content string
+}
+
+// UpcastEventDataV2 is version 2 of the event data used in the upcaster tests,
+// which adds the length of the content.
+type UpcastEventDataV2 struct {
+	Content string
+	Length  int
+}
+
+// loadAndCompare loads the events of an aggregate and compares them to the
+// expected events.
+func loadAndCompare(t *testing.T, ctx context.Context, store eh.EventStore, id eh.UUID, expected []eh.Event) {
+	events, err := store.Load(ctx, mocks.AggregateType, id)
+	if err != nil {
+		t.Error("there should be no error:", err)
+	}
+	compareEvents(t, events, expected)
+}
+
+// compareEvents compares events to the expected events, including versions.
+func compareEvents(t *testing.T, events, expected []eh.Event) {
+	if len(events) != len(expected) {
+		t.Errorf("there should be %d events: %s", len(expected), eventsToString(events))
+		return
+	}
+	for i, event := range events {
+		if err := mocks.CompareEvents(event, expected[i]); err != nil {
+			t.Error("the event was incorrect:", err)
+		}
+		if event.Version() != expected[i].Version() {
+			t.Error("the event version should be correct:", event, event.Version())
+		}
+	}
+}
+
+// outboxIDs returns the IDs of outbox entries.
+func outboxIDs(entries []eh.OutboxEntry) []string {
+	ids := make([]string, len(entries))
+	for i, e := range entries {
+		ids[i] = e.ID
+	}
+	return ids
+}
+
+func eventsToString(events []eh.Event) string {
+	parts := make([]string, len(events))
+	for i, e := range events {
+		parts[i] = string(e.AggregateType()) +
+			":" + string(e.EventType()) +
+			" (" + e.AggregateID().String() + ")"
+	}
+	return strings.Join(parts, ", ")
+}
+
+// NamespaceCommonTests are test cases that are common to all implementations
+// of event stores that keep the events of each namespace, for example each
+// tenant, separate. The contexts must have different namespaces.
+func NamespaceCommonTests(t *testing.T, ctx, otherCtx context.Context, store eh.EventStore) {
+	id := eh.NewUUID()
+	agg := mocks.NewAggregate(id)
+	event := agg.NewEvent(mocks.EventType, &mocks.EventData{"event1"})
+	agg.ApplyEvent(ctx, event) // Apply event to increment the aggregate version.
+	if err := store.Save(ctx, []eh.Event{event}, 0); err != nil {
+		t.Error("there should be no error:", err)
+	}
+
+	t.Log("load the events of the namespace")
+	loaded, err := store.Load(ctx, mocks.AggregateType, id)
+	if err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if len(loaded) != 1 {
+		t.Fatal("there should be one event:", eventsToString(loaded))
+	}
+	if err := mocks.CompareEvents(loaded[0], event); err != nil {
+		t.Error("the event was incorrect:", err)
+	}
+
+	t.Log("load the aggregate from the other namespace")
+	loaded, err = store.Load(otherCtx, mocks.AggregateType, id)
+	if err != nil && !errors.Is(err, eh.ErrAggregateNotFound) {
+		t.Error("there should be no error:", err)
+	}
+	if len(loaded) != 0 {
+		t.Error("there should be no events:", eventsToString(loaded))
+	}
+
+	t.Log("save the same aggregate in the other namespace")
+	otherAgg := mocks.NewAggregate(id)
+	otherEvent := otherAgg.NewEvent(mocks.EventType, &mocks.EventData{"other"})
+	otherAgg.ApplyEvent(otherCtx, otherEvent)
+	if err := store.Save(otherCtx, []eh.Event{otherEvent}, 0); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	loaded, err = store.Load(otherCtx, mocks.AggregateType, id)
+	if err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if len(loaded) != 1 {
+		t.Fatal("there should be one event:", eventsToString(loaded))
+	}
+	if err := mocks.CompareEvents(loaded[0], otherEvent); err != nil {
+		t.Error("the event was incorrect:", err)
+	}
+	loaded, err = store.Load(ctx, mocks.AggregateType, id)
+	if err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if len(loaded) != 1 {
+		t.Fatal("there should be one event:", eventsToString(loaded))
+	}
+	if err := mocks.CompareEvents(loaded[0], event); err != nil {
+		t.Error("the event should not be changed:", err)
 	}
-	return strings.Join(parts, ", ")
 }
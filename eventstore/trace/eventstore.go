@@ -18,6 +18,7 @@ import (
 	"context"
 	"errors"
 	"sync"
+	"time"
 
 	eh "github.com/looplab/eventhorizon"
 )
@@ -62,16 +63,337 @@ func (s *EventStore) Save(ctx context.Context, events []eh.Event, originalVersio
 	return nil
 }
 
+// SaveInTransaction saves the events of the transaction in a transaction of
+// the base store, and traces the events if enabled.
+// Returns ErrTransactionsNotSupported if the base store does not support
+// transactions.
+func (s *EventStore) SaveInTransaction(ctx context.Context, fn func(tx eh.EventStoreTx) error) error {
+	store, ok := s.eventStore.(eh.TransactionalEventStore)
+	if !ok {
+		return eh.ErrTransactionsNotSupported
+	}
+
+	var traced *tracedTx
+	if err := store.SaveInTransaction(ctx, func(tx eh.EventStoreTx) error {
+		traced = &tracedTx{tx: tx}
+		return fn(traced)
+	}); err != nil {
+		return err
+	}
+
+	// Only trace events that are successfully saved.
+	s.traceMu.Lock()
+	defer s.traceMu.Unlock()
+	if s.tracing && traced != nil {
+		s.trace = append(s.trace, traced.events...)
+	}
+
+	return nil
+}
+
+// tracedTx records the events added to a transaction of the base store, to
+// trace them when it is committed.
+type tracedTx struct {
+	tx     eh.EventStoreTx
+	events []eh.Event
+}
+
+// Save implements the Save method of the eventhorizon.EventStoreTx interface.
+func (t *tracedTx) Save(events []eh.Event, originalVersion int) error {
+	if err := t.tx.Save(events, originalVersion); err != nil {
+		return err
+	}
+	t.events = append(t.events, events...)
+
+	return nil
+}
+
+// SaveBatch saves the batch in the base store if it supports it, and traces
+// the events if enabled.
+// Returns ErrBatchSaveNotSupported if the base store does not support it.
+func (s *EventStore) SaveBatch(ctx context.Context, events map[eh.UUID][]eh.Event, expectedVersions map[eh.UUID]int) error {
+	if s.eventStore == nil {
+		return ErrNoEventStoreDefined
+	}
+
+	saver, ok := s.eventStore.(eh.EventStoreBatchSaver)
+	if !ok {
+		return eh.ErrBatchSaveNotSupported
+	}
+
+	if err := saver.SaveBatch(ctx, events, expectedVersions); err != nil {
+		return err
+	}
+
+	// Only trace events that are successfully saved.
+	s.traceMu.Lock()
+	defer s.traceMu.Unlock()
+	if s.tracing {
+		for _, aggregateEvents := range events {
+			s.trace = append(s.trace, aggregateEvents...)
+		}
+	}
+
+	return nil
+}
+
 // Load loads all events for the aggregate id from the base store.
 // Returns ErrNoEventStoreDefined if no event store could be found.
-func (s *EventStore) Load(ctx context.Context, aggregateType eh.AggregateType, id eh.UUID) ([]eh.Event, error) {
+func (s *EventStore) Load(ctx context.Context, aggregateType eh.AggregateType, id eh.UUID, opts ...eh.LoadOption) ([]eh.Event, error) {
 	if s.eventStore != nil {
-		return s.eventStore.Load(ctx, aggregateType, id)
+		return s.eventStore.Load(ctx, aggregateType, id, opts...)
 	}
 
 	return nil, ErrNoEventStoreDefined
 }
 
+// LoadFrom loads the events from a version for the aggregate id from the base
+// store. If the base store can not load from a version all events are loaded
+// and filtered instead.
+// Returns ErrNoEventStoreDefined if no event store could be found.
+func (s *EventStore) LoadFrom(ctx context.Context, aggregateType eh.AggregateType, id eh.UUID, fromVersion int) ([]eh.Event, error) {
+	if s.eventStore == nil {
+		return nil, ErrNoEventStoreDefined
+	}
+
+	if loader, ok := s.eventStore.(eh.EventStoreVersionLoader); ok {
+		return loader.LoadFrom(ctx, aggregateType, id, fromVersion)
+	}
+
+	events, err := s.eventStore.Load(ctx, aggregateType, id)
+	if err != nil {
+		return nil, err
+	}
+
+	filtered := []eh.Event{}
+	for _, event := range events {
+		if event.Version() >= fromVersion {
+			filtered = append(filtered, event)
+		}
+	}
+
+	return filtered, nil
+}
+
+// LoadReverse loads up to limit events for the aggregate id from the base
+// store, newest first. If the base store can not load events in reverse all
+// events are loaded and reversed instead.
+// Returns ErrNoEventStoreDefined if no event store could be found.
+func (s *EventStore) LoadReverse(ctx context.Context, aggregateType eh.AggregateType, id eh.UUID, limit int) ([]eh.Event, error) {
+	if s.eventStore == nil {
+		return nil, ErrNoEventStoreDefined
+	}
+
+	if loader, ok := s.eventStore.(eh.EventStoreReverseLoader); ok {
+		return loader.LoadReverse(ctx, aggregateType, id, limit)
+	}
+
+	events, err := s.eventStore.Load(ctx, aggregateType, id)
+	if err != nil {
+		return nil, err
+	}
+
+	reversed := []eh.Event{}
+	for i := len(events) - 1; i >= 0 && (limit <= 0 || len(reversed) < limit); i-- {
+		reversed = append(reversed, events[i])
+	}
+
+	return reversed, nil
+}
+
+// LoadBetween loads the events within a time range for the aggregate id from
+// the base store. If the base store can not load a time range all events are
+// loaded and filtered instead.
+// Returns ErrNoEventStoreDefined if no event store could be found.
+func (s *EventStore) LoadBetween(ctx context.Context, aggregateType eh.AggregateType, id eh.UUID, from, to time.Time) ([]eh.Event, error) {
+	if s.eventStore == nil {
+		return nil, ErrNoEventStoreDefined
+	}
+
+	if loader, ok := s.eventStore.(eh.EventStoreTimeLoader); ok {
+		return loader.LoadBetween(ctx, aggregateType, id, from, to)
+	}
+
+	events, err := s.eventStore.Load(ctx, aggregateType, id)
+	if err != nil {
+		return nil, err
+	}
+
+	filter := eh.ReplayFilter{From: from, To: to}
+	filtered := []eh.Event{}
+	for _, e := range events {
+		if filter.Match(e) {
+			filtered = append(filtered, e)
+		}
+	}
+
+	return filtered, nil
+}
+
+// LoadByCorrelation loads the events with a correlation ID from the base store
+// if it supports it. Returns ErrCorrelationLoadNotSupported if the base store
+// does not support it.
+func (s *EventStore) LoadByCorrelation(ctx context.Context, correlationID string) ([]eh.Event, error) {
+	if s.eventStore == nil {
+		return nil, ErrNoEventStoreDefined
+	}
+
+	loader, ok := s.eventStore.(eh.EventStoreCorrelationLoader)
+	if !ok {
+		return nil, eh.ErrCorrelationLoadNotSupported
+	}
+
+	return loader.LoadByCorrelation(ctx, correlationID)
+}
+
+// Delete deletes the aggregate from the base store if it supports it.
+// Returns ErrDeleteNotSupported if the base store does not support it.
+func (s *EventStore) Delete(ctx context.Context, aggregateType eh.AggregateType, id eh.UUID) error {
+	if s.eventStore == nil {
+		return ErrNoEventStoreDefined
+	}
+
+	deleter, ok := s.eventStore.(eh.EventStoreDeleter)
+	if !ok {
+		return eh.ErrDeleteNotSupported
+	}
+
+	return deleter.Delete(ctx, aggregateType, id)
+}
+
+// Compact compacts the aggregate in the base store if it supports it.
+// Returns ErrCompactNotSupported if the base store does not support it.
+func (s *EventStore) Compact(ctx context.Context, aggregateType eh.AggregateType, id eh.UUID, upToVersion int) error {
+	if s.eventStore == nil {
+		return ErrNoEventStoreDefined
+	}
+
+	compacter, ok := s.eventStore.(eh.EventStoreCompacter)
+	if !ok {
+		return eh.ErrCompactNotSupported
+	}
+
+	return compacter.Compact(ctx, aggregateType, id, upToVersion)
+}
+
+// ClaimOutbox claims entries in the outbox of the base store if it supports
+// it. Returns ErrOutboxNotSupported if the base store does not support it.
+func (s *EventStore) ClaimOutbox(ctx context.Context, limit int, lease time.Duration) ([]eh.OutboxEntry, error) {
+	if s.eventStore == nil {
+		return nil, ErrNoEventStoreDefined
+	}
+
+	outbox, ok := s.eventStore.(eh.EventStoreOutbox)
+	if !ok {
+		return nil, eh.ErrOutboxNotSupported
+	}
+
+	return outbox.ClaimOutbox(ctx, limit, lease)
+}
+
+// MarkPublished marks entries in the outbox of the base store as published if
+// it supports it. Returns ErrOutboxNotSupported if the base store does not
+// support it.
+func (s *EventStore) MarkPublished(ctx context.Context, ids []string) error {
+	if s.eventStore == nil {
+		return ErrNoEventStoreDefined
+	}
+
+	outbox, ok := s.eventStore.(eh.EventStoreOutbox)
+	if !ok {
+		return eh.ErrOutboxNotSupported
+	}
+
+	return outbox.MarkPublished(ctx, ids)
+}
+
+// ReplayAll replays all events from the base store if it supports it.
+// Sends ErrReplayNotSupported on the error channel if the base store does not
+// support it.
+func (s *EventStore) ReplayAll(ctx context.Context) (<-chan eh.Event, <-chan error) {
+	if streamer, ok := s.eventStore.(eh.EventStreamer); ok {
+		return streamer.ReplayAll(ctx)
+	}
+
+	events := make(chan eh.Event)
+	errs := make(chan error, 1)
+	if s.eventStore == nil {
+		errs <- ErrNoEventStoreDefined
+	} else {
+		errs <- eh.ErrReplayNotSupported
+	}
+	close(events)
+	close(errs)
+
+	return events, errs
+}
+
+// HeadPosition returns the head position of the base store if it supports it.
+// Returns ErrHeadPositionNotSupported if the base store does not support it.
+func (s *EventStore) HeadPosition(ctx context.Context) (int64, error) {
+	if s.eventStore == nil {
+		return 0, ErrNoEventStoreDefined
+	}
+
+	positioner, ok := s.eventStore.(eh.HeadPositioner)
+	if !ok {
+		return 0, eh.ErrHeadPositionNotSupported
+	}
+
+	return positioner.HeadPosition(ctx)
+}
+
+// Replay replays the events matching the filter from the base store if it
+// supports it. Sends ErrReplayNotSupported on the error channel if the base
+// store does not support it.
+func (s *EventStore) Replay(ctx context.Context, filter eh.ReplayFilter) (<-chan eh.Event, <-chan error) {
+	if streamer, ok := s.eventStore.(eh.FilteredEventStreamer); ok {
+		return streamer.Replay(ctx, filter)
+	}
+
+	events := make(chan eh.Event)
+	errs := make(chan error, 1)
+	if s.eventStore == nil {
+		errs <- ErrNoEventStoreDefined
+	} else {
+		errs <- eh.ErrReplayNotSupported
+	}
+	close(events)
+	close(errs)
+
+	return events, errs
+}
+
+// SaveSnapshot saves a snapshot in the base store if it supports snapshots.
+// Returns ErrSnapshotsNotSupported if the base store does not support it.
+func (s *EventStore) SaveSnapshot(ctx context.Context, aggregateType eh.AggregateType, id eh.UUID, version int, state interface{}) error {
+	if s.eventStore == nil {
+		return ErrNoEventStoreDefined
+	}
+
+	snapshotStore, ok := s.eventStore.(eh.SnapshotStore)
+	if !ok {
+		return eh.ErrSnapshotsNotSupported
+	}
+
+	return snapshotStore.SaveSnapshot(ctx, aggregateType, id, version, state)
+}
+
+// LoadSnapshot loads a snapshot from the base store if it supports snapshots.
+// Returns ErrSnapshotsNotSupported if the base store does not support it.
+func (s *EventStore) LoadSnapshot(ctx context.Context, aggregateType eh.AggregateType, id eh.UUID) (interface{}, int, error) {
+	if s.eventStore == nil {
+		return nil, 0, ErrNoEventStoreDefined
+	}
+
+	snapshotStore, ok := s.eventStore.(eh.SnapshotStore)
+	if !ok {
+		return nil, 0, eh.ErrSnapshotsNotSupported
+	}
+
+	return snapshotStore.LoadSnapshot(ctx, aggregateType, id)
+}
+
 // StartTracing starts the tracing of events.
 func (s *EventStore) StartTracing() {
 	s.traceMu.Lock()
@@ -16,8 +16,10 @@ package trace
 
 import (
 	"context"
+	"errors"
 	"reflect"
 	"testing"
+	"time"
 
 	eh "github.com/looplab/eventhorizon"
 	"github.com/looplab/eventhorizon/eventstore/memory"
@@ -37,6 +39,9 @@ func TestEventStore(t *testing.T) {
 	savedEvents := testutil.EventStoreCommonTests(t, context.Background(), store)
 	store.StopTracing()
 
+	t.Log("loading with max events")
+	testutil.MaxEventsCommonTests(t, context.Background(), store)
+
 	trace := store.GetTrace()
 	if !reflect.DeepEqual(trace, savedEvents) {
 		t.Error("there should be events traced:", trace)
@@ -91,3 +96,270 @@ func TestEventStore(t *testing.T) {
 		}
 	}
 }
+
+func TestSnapshotStore(t *testing.T) {
+	store := NewEventStore(memory.NewEventStore())
+	if store == nil {
+		t.Fatal("there should be a store")
+	}
+
+	testutil.SnapshotStoreCommonTests(t, context.Background(), store)
+
+	t.Log("snapshots with a base store without snapshot support")
+	store = NewEventStore(&mocks.EventStore{})
+	ctx := context.Background()
+	id := eh.NewUUID()
+	err := store.SaveSnapshot(ctx, mocks.AggregateType, id, 1, &mocks.EventData{"state"})
+	if err != eh.ErrSnapshotsNotSupported {
+		t.Error("there should be a ErrSnapshotsNotSupported error:", err)
+	}
+	if _, _, err = store.LoadSnapshot(ctx, mocks.AggregateType, id); err != eh.ErrSnapshotsNotSupported {
+		t.Error("there should be a ErrSnapshotsNotSupported error:", err)
+	}
+}
+
+func TestEventStreamer(t *testing.T) {
+	store := NewEventStore(memory.NewEventStore())
+	if store == nil {
+		t.Fatal("there should be a store")
+	}
+
+	testutil.EventStreamerCommonTests(t, context.Background(), store)
+
+	t.Log("replay with a base store without replay support")
+	store = NewEventStore(&mocks.EventStore{})
+	events, errs := store.ReplayAll(context.Background())
+	if _, ok := <-events; ok {
+		t.Error("the event channel should be closed")
+	}
+	if err := <-errs; err != eh.ErrReplayNotSupported {
+		t.Error("there should be a ErrReplayNotSupported error:", err)
+	}
+}
+
+func TestFilteredEventStreamer(t *testing.T) {
+	store := NewEventStore(memory.NewEventStore())
+	if store == nil {
+		t.Fatal("there should be a store")
+	}
+
+	testutil.FilteredEventStreamerCommonTests(t, context.Background(), store)
+
+	t.Log("replay with a base store without filtered replay support")
+	store = NewEventStore(&mocks.EventStore{})
+	events, errs := store.Replay(context.Background(), eh.ReplayFilter{})
+	if _, ok := <-events; ok {
+		t.Error("the event channel should be closed")
+	}
+	if err := <-errs; err != eh.ErrReplayNotSupported {
+		t.Error("there should be a ErrReplayNotSupported error:", err)
+	}
+}
+
+func TestHeadPositioner(t *testing.T) {
+	ctx := context.Background()
+	store := NewEventStore(memory.NewEventStore())
+	if store == nil {
+		t.Fatal("there should be a store")
+	}
+
+	testutil.GlobalPositionCommonTests(t, ctx, store)
+
+	t.Log("head position with a base store without head position support")
+	store = NewEventStore(&mocks.EventStore{})
+	if _, err := store.HeadPosition(ctx); err != eh.ErrHeadPositionNotSupported {
+		t.Error("there should be a ErrHeadPositionNotSupported error:", err)
+	}
+}
+
+func TestReverseLoader(t *testing.T) {
+	store := NewEventStore(memory.NewEventStore())
+	if store == nil {
+		t.Fatal("there should be a store")
+	}
+
+	testutil.ReverseLoaderCommonTests(t, context.Background(), store)
+
+	t.Log("load in reverse with a base store without reverse loading")
+	store = NewEventStore(&mocks.EventStore{})
+	ctx := context.Background()
+	id := eh.NewUUID()
+	agg := mocks.NewAggregate(id)
+	var saved []eh.Event
+	for i := 0; i < 3; i++ {
+		event := agg.NewEvent(mocks.EventType, &mocks.EventData{"event"})
+		agg.ApplyEvent(ctx, event) // Apply event to increment the aggregate version.
+		saved = append(saved, event)
+	}
+	if err := store.Save(ctx, saved, 0); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	events, err := store.LoadReverse(ctx, mocks.AggregateType, id, 2)
+	if err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if len(events) != 2 || events[0] != saved[2] || events[1] != saved[1] {
+		t.Error("the latest events should be loaded newest first:", events)
+	}
+
+	t.Log("load in reverse without a base store")
+	store = NewEventStore(nil)
+	if _, err := store.LoadReverse(ctx, mocks.AggregateType, id, 2); err != ErrNoEventStoreDefined {
+		t.Error("there should be a ErrNoEventStoreDefined error:", err)
+	}
+}
+
+func TestTimeLoader(t *testing.T) {
+	store := NewEventStore(memory.NewEventStore())
+	if store == nil {
+		t.Fatal("there should be a store")
+	}
+
+	testutil.TimeLoaderCommonTests(t, context.Background(), store)
+
+	t.Log("load a time range with a base store without time ranges")
+	store = NewEventStore(&mocks.EventStore{})
+	ctx := context.Background()
+	id := eh.NewUUID()
+	agg := mocks.NewAggregate(id)
+	event1 := agg.NewEvent(mocks.EventType, &mocks.EventData{"event1"})
+	agg.ApplyEvent(ctx, event1) // Apply event to increment the aggregate version.
+	if err := store.Save(ctx, []eh.Event{event1}, 0); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	events, err := store.LoadBetween(ctx, mocks.AggregateType, id, event1.Timestamp(), time.Time{})
+	if err != nil || len(events) != 1 || events[0] != event1 {
+		t.Error("the event should be loaded:", events, err)
+	}
+	events, err = store.LoadBetween(ctx, mocks.AggregateType, id, time.Time{}, event1.Timestamp())
+	if err != nil || len(events) != 0 {
+		t.Error("there should be no events:", events, err)
+	}
+
+	t.Log("load a time range without a base store")
+	store = NewEventStore(nil)
+	if _, err := store.LoadBetween(context.Background(), mocks.AggregateType, eh.NewUUID(), time.Time{}, time.Time{}); err != ErrNoEventStoreDefined {
+		t.Error("there should be a ErrNoEventStoreDefined error:", err)
+	}
+}
+
+func TestCorrelationLoader(t *testing.T) {
+	store := NewEventStore(memory.NewEventStore())
+	if store == nil {
+		t.Fatal("there should be a store")
+	}
+
+	testutil.CorrelationLoaderCommonTests(t, context.Background(), store)
+
+	t.Log("load by correlation ID with a base store without support")
+	store = NewEventStore(&mocks.EventStore{})
+	if _, err := store.LoadByCorrelation(context.Background(), "correlation1"); err != eh.ErrCorrelationLoadNotSupported {
+		t.Error("there should be a ErrCorrelationLoadNotSupported error:", err)
+	}
+
+	t.Log("load by correlation ID without a base store")
+	store = NewEventStore(nil)
+	if _, err := store.LoadByCorrelation(context.Background(), "correlation1"); err != ErrNoEventStoreDefined {
+		t.Error("there should be a ErrNoEventStoreDefined error:", err)
+	}
+}
+
+func TestEventStoreBatchSaver(t *testing.T) {
+	store := NewEventStore(memory.NewEventStore())
+	if store == nil {
+		t.Fatal("there should be a store")
+	}
+
+	testutil.EventStoreBatchSaverCommonTests(t, context.Background(), store)
+
+	t.Log("save batch with a base store without batch support")
+	store = NewEventStore(&mocks.EventStore{})
+	err := store.SaveBatch(context.Background(), map[eh.UUID][]eh.Event{}, nil)
+	if err != eh.ErrBatchSaveNotSupported {
+		t.Error("there should be a ErrBatchSaveNotSupported error:", err)
+	}
+}
+
+func TestTransactionalEventStore(t *testing.T) {
+	store := NewEventStore(memory.NewEventStore())
+	if store == nil {
+		t.Fatal("there should be a store")
+	}
+
+	testutil.TransactionalEventStoreCommonTests(t, context.Background(), store)
+
+	t.Log("trace the events of a transaction")
+	store.StartTracing()
+	id := eh.NewUUID()
+	agg := mocks.NewAggregate(id)
+	event1 := agg.NewEvent(mocks.EventType, &mocks.EventData{"event1"})
+	agg.ApplyEvent(context.Background(), event1) // Apply event to increment the aggregate version.
+	if err := store.SaveInTransaction(context.Background(), func(tx eh.EventStoreTx) error {
+		return tx.Save([]eh.Event{event1}, 0)
+	}); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if trace := store.GetTrace(); len(trace) != 1 || trace[0] != event1 {
+		t.Error("the event should be traced:", trace)
+	}
+
+	t.Log("don't trace the events of a failed transaction")
+	if err := store.SaveInTransaction(context.Background(), func(tx eh.EventStoreTx) error {
+		return tx.Save([]eh.Event{event1}, 0)
+	}); !errors.Is(err, eh.ErrIncorrectEventVersion) {
+		t.Error("there should be a ErrIncorrectEventVersion error:", err)
+	}
+	store.StopTracing()
+	if trace := store.GetTrace(); len(trace) != 1 || trace[0] != event1 {
+		t.Error("the event should not be traced again:", trace)
+	}
+
+	t.Log("save a transaction with a base store without transactions")
+	store = NewEventStore(&mocks.EventStore{})
+	if err := store.SaveInTransaction(context.Background(), func(tx eh.EventStoreTx) error {
+		return tx.Save([]eh.Event{event1}, 0)
+	}); err != eh.ErrTransactionsNotSupported {
+		t.Error("there should be a ErrTransactionsNotSupported error:", err)
+	}
+}
+
+func TestEventStoreDeleter(t *testing.T) {
+	t.Log("delete with a base store without delete support")
+	store := NewEventStore(&mocks.EventStore{})
+	if err := store.Delete(context.Background(), mocks.AggregateType, eh.NewUUID()); err != eh.ErrDeleteNotSupported {
+		t.Error("there should be a ErrDeleteNotSupported error:", err)
+	}
+}
+
+func TestEventStoreCompacter(t *testing.T) {
+	store := NewEventStore(memory.NewEventStore())
+	if store == nil {
+		t.Fatal("there should be a store")
+	}
+
+	testutil.EventStoreCompacterCommonTests(t, context.Background(), store)
+
+	t.Log("compact with a base store without compact support")
+	store = NewEventStore(&mocks.EventStore{})
+	if err := store.Compact(context.Background(), mocks.AggregateType, eh.NewUUID(), 1); err != eh.ErrCompactNotSupported {
+		t.Error("there should be a ErrCompactNotSupported error:", err)
+	}
+}
+
+func TestEventStoreOutbox(t *testing.T) {
+	store := NewEventStore(memory.NewEventStore(memory.WithOutbox()))
+	if store == nil {
+		t.Fatal("there should be a store")
+	}
+
+	testutil.OutboxCommonTests(t, context.Background(), store)
+
+	t.Log("outbox with a base store without an outbox")
+	store = NewEventStore(&mocks.EventStore{})
+	if _, err := store.ClaimOutbox(context.Background(), 10, time.Minute); err != eh.ErrOutboxNotSupported {
+		t.Error("there should be a ErrOutboxNotSupported error:", err)
+	}
+	if err := store.MarkPublished(context.Background(), nil); err != eh.ErrOutboxNotSupported {
+		t.Error("there should be a ErrOutboxNotSupported error:", err)
+	}
+}
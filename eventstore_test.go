@@ -0,0 +1,127 @@
+// Copyright (c) 2016 - Max Ekman <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package eventhorizon
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestEventStoreError(t *testing.T) {
+	baseErr := TestBaseError{"base"}
+	var err error = EventStoreError{
+		Err:       ErrIncorrectEventVersion,
+		BaseErr:   baseErr,
+		Namespace: "ns",
+	}
+	if err.Error() != "mismatching event version: base error (ns)" {
+		t.Error("the error string should be correct:", err.Error())
+	}
+
+	t.Log("match with a type assertion")
+	if esErr, ok := err.(EventStoreError); !ok || esErr.Err != ErrIncorrectEventVersion {
+		t.Error("there should be a ErrIncorrectEventVersion error:", err)
+	}
+
+	t.Log("match with errors.Is and errors.As")
+	if !errors.Is(err, ErrIncorrectEventVersion) {
+		t.Error("there should be a ErrIncorrectEventVersion error:", err)
+	}
+	if !errors.Is(err, baseErr) {
+		t.Error("there should be a base error:", err)
+	}
+	if errors.Is(err, ErrInvalidEvent) {
+		t.Error("there should not be a ErrInvalidEvent error:", err)
+	}
+	var tbErr TestBaseError
+	if !errors.As(err, &tbErr) || tbErr != baseErr {
+		t.Error("the base error should be found:", err)
+	}
+	var esErr EventStoreError
+	if !errors.As(err, &esErr) || esErr.Namespace != "ns" {
+		t.Error("the event store error should be found:", err)
+	}
+
+	t.Log("match without a base error")
+	err = EventStoreError{Err: ErrInvalidEvent}
+	if errors.Is(err, baseErr) {
+		t.Error("there should not be a base error:", err)
+	}
+	if errors.As(err, &TestBaseError{}) {
+		t.Error("the base error should not be found:", err)
+	}
+}
+
+func TestReplayFilterMatch(t *testing.T) {
+	now := time.Now()
+	e := event{
+		eventType:     "TestEvent",
+		timestamp:     now,
+		aggregateType: "TestAggregate",
+	}
+
+	testCases := map[string]struct {
+		filter ReplayFilter
+		match  bool
+	}{
+		"no filter": {
+			ReplayFilter{},
+			true,
+		},
+		"aggregate type": {
+			ReplayFilter{AggregateType: "TestAggregate"},
+			true,
+		},
+		"other aggregate type": {
+			ReplayFilter{AggregateType: "OtherAggregate"},
+			false,
+		},
+		"event types": {
+			ReplayFilter{EventTypes: []EventType{"OtherEvent", "TestEvent"}},
+			true,
+		},
+		"other event types": {
+			ReplayFilter{EventTypes: []EventType{"OtherEvent"}},
+			false,
+		},
+		"from inclusive": {
+			ReplayFilter{From: now},
+			true,
+		},
+		"from after": {
+			ReplayFilter{From: now.Add(time.Second)},
+			false,
+		},
+		"to exclusive": {
+			ReplayFilter{To: now},
+			false,
+		},
+		"time range": {
+			ReplayFilter{From: now.Add(-time.Second), To: now.Add(time.Second)},
+			true,
+		},
+		"after position without position": {
+			ReplayFilter{AfterPosition: 1},
+			false,
+		},
+	}
+
+	for name, tc := range testCases {
+		if m := tc.filter.Match(e); m != tc.match {
+			t.Error("the match should be correct:", name, m)
+		}
+	}
+}
@@ -16,12 +16,18 @@ package domain
 
 import (
 	"context"
-	"log"
+	"errors"
 	"sync"
 
 	eh "github.com/looplab/eventhorizon"
 )
 
+// ErrModelOfIncorrectType is when a loaded model has the wrong type.
+var ErrModelOfIncorrectType = errors.New("model is of incorrect type")
+
+// ErrInvalidEventData is when an event has data of the wrong type.
+var ErrInvalidEventData = errors.New("invalid event data type")
+
 // Invitation is a read model object for an invitation.
 type Invitation struct {
 	ID     eh.UUID
@@ -49,14 +55,13 @@ func (p *InvitationProjector) HandlerType() eh.EventHandlerType {
 }
 
 // HandleEvent implements the HandleEvent method of the EventHandler interface.
-func (p *InvitationProjector) HandleEvent(ctx context.Context, event eh.Event) {
+func (p *InvitationProjector) HandleEvent(ctx context.Context, event eh.Event) error {
 	// Load or create the model.
 	var i *Invitation
 	if m, _ := p.repository.Find(ctx, event.AggregateID()); m != nil {
 		var ok bool
 		if i, ok = m.(*Invitation); !ok {
-			log.Println("error: model is of incorrect type")
-			return
+			return ErrModelOfIncorrectType
 		}
 	} else {
 		i = &Invitation{
@@ -72,7 +77,7 @@ func (p *InvitationProjector) HandleEvent(ctx context.Context, event eh.Event) {
 			i.Name = data.Name
 			i.Age = data.Age
 		} else {
-			log.Println("invalid event data type:", event.Data())
+			return ErrInvalidEventData
 		}
 	case InviteAcceptedEvent:
 		// NOTE: Temp fix for events that arrive out of order.
@@ -91,9 +96,7 @@ func (p *InvitationProjector) HandleEvent(ctx context.Context, event eh.Event) {
 	}
 
 	// Save it back, same for new and updated models.
-	if err := p.repository.Save(ctx, event.AggregateID(), i); err != nil {
-		log.Println("error: could not save model: ", err)
-	}
+	return p.repository.Save(ctx, event.AggregateID(), i)
 }
 
 // GuestList is a read model object for the guest list.
@@ -128,7 +131,7 @@ func (p *GuestListProjector) HandlerType() eh.EventHandlerType {
 }
 
 // HandleEvent implements the HandleEvent method of the EventHandler interface.
-func (p *GuestListProjector) HandleEvent(ctx context.Context, event eh.Event) {
+func (p *GuestListProjector) HandleEvent(ctx context.Context, event eh.Event) error {
 	// NOTE: Temp fix because we need to count the guests atomically.
 	p.repositoryMu.Lock()
 	defer p.repositoryMu.Unlock()
@@ -136,7 +139,10 @@ func (p *GuestListProjector) HandleEvent(ctx context.Context, event eh.Event) {
 	// Load or create the guest list.
 	var g *GuestList
 	if m, _ := p.repository.Find(ctx, p.eventID); m != nil {
-		g = m.(*GuestList)
+		var ok bool
+		if g, ok = m.(*GuestList); !ok {
+			return ErrModelOfIncorrectType
+		}
 	} else {
 		g = &GuestList{
 			ID: p.eventID,
@@ -157,5 +163,5 @@ func (p *GuestListProjector) HandleEvent(ctx context.Context, event eh.Event) {
 		g.NumDenied++
 	}
 
-	p.repository.Save(ctx, p.eventID, g)
+	return p.repository.Save(ctx, p.eventID, g)
 }
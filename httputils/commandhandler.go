@@ -0,0 +1,129 @@
+// Copyright (c) 2016 - Max Ekman <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package httputils has HTTP handlers for using eventhorizon from simple
+// integrations, mountable on any mux.
+package httputils
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	eh "github.com/looplab/eventhorizon"
+	"github.com/looplab/eventhorizon/commandhandler/validate"
+)
+
+// ErrUnknownCommandType is when the command type of a request is not
+// registered with eventhorizon.RegisterCommand.
+var ErrUnknownCommandType = errors.New("unknown command type")
+
+// ErrInvalidCommand is when a request or its command payload is not valid JSON.
+var ErrInvalidCommand = errors.New("invalid command")
+
+// CommandRequest is the JSON body of a command posted to a CommandHandler.
+type CommandRequest struct {
+	// CommandType is the type of the command, used to create the command
+	// with the factory registered with eventhorizon.RegisterCommand.
+	CommandType eh.CommandType `json:"command_type"`
+	// Payload is the JSON of the command, unmarshaled into the command.
+	Payload json.RawMessage `json:"payload"`
+}
+
+// ErrorResponse is the JSON body of a failed command.
+type ErrorResponse struct {
+	Error string `json:"error"`
+}
+
+// CommandHandler is a http.Handler that dispatches the commands posted to it
+// to a command handler. It responds with:
+//   - 200 when the command has been handled.
+//   - 400 for unknown command types, invalid JSON, invalid commands and
+//     commands without a handler.
+//   - 405 for other methods than POST.
+//   - 409 for commands that conflict with a concurrent change of the aggregate.
+//   - 500 for other errors, without the error message.
+type CommandHandler struct {
+	handler eh.CommandHandler
+}
+
+// NewCommandHandler creates a new CommandHandler.
+func NewCommandHandler(handler eh.CommandHandler) *CommandHandler {
+	return &CommandHandler{
+		handler: handler,
+	}
+}
+
+// ServeHTTP implements the ServeHTTP method of the http.Handler interface.
+func (h *CommandHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		writeError(w, http.StatusMethodNotAllowed, http.StatusText(http.StatusMethodNotAllowed))
+		return
+	}
+
+	var req CommandRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, ErrInvalidCommand.Error()+": "+err.Error())
+		return
+	}
+
+	cmd, err := eh.CreateCommand(req.CommandType)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, ErrUnknownCommandType.Error()+": "+string(req.CommandType))
+		return
+	}
+
+	if len(req.Payload) > 0 {
+		if err := json.Unmarshal(req.Payload, cmd); err != nil {
+			writeError(w, http.StatusBadRequest, ErrInvalidCommand.Error()+": "+err.Error())
+			return
+		}
+	}
+
+	if err := h.handler.HandleCommand(r.Context(), cmd); err != nil {
+		status := errorStatus(err)
+		msg := err.Error()
+		if status == http.StatusInternalServerError {
+			msg = http.StatusText(status)
+		}
+		writeError(w, status, msg)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+// errorStatus returns the status code for an error from the command handler.
+func errorStatus(err error) int {
+	var fieldErr eh.CommandFieldError
+	switch {
+	case errors.As(err, &fieldErr),
+		errors.Is(err, validate.ErrCommandValidation),
+		errors.Is(err, eh.ErrHandlerNotFound),
+		errors.Is(err, eh.ErrAggregateNotFound):
+		return http.StatusBadRequest
+	case errors.Is(err, eh.ErrIncorrectEventVersion):
+		return http.StatusConflict
+	}
+	return http.StatusInternalServerError
+}
+
+// writeError writes an ErrorResponse with a status code.
+func writeError(w http.ResponseWriter, status int, msg string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	// There is nothing to do if the response could not be written.
+	_ = json.NewEncoder(w).Encode(ErrorResponse{Error: msg})
+}
@@ -0,0 +1,133 @@
+// Copyright (c) 2016 - Max Ekman <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package httputils
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	eh "github.com/looplab/eventhorizon"
+	"github.com/looplab/eventhorizon/commandhandler/validate"
+	"github.com/looplab/eventhorizon/mocks"
+)
+
+func init() {
+	eh.RegisterCommand(func() eh.Command { return &mocks.Command{} })
+}
+
+func TestCommandHandler(t *testing.T) {
+	handler := &commandHandler{}
+	mux := http.NewServeMux()
+	mux.Handle("/commands", NewCommandHandler(handler))
+
+	id := eh.NewUUID()
+	body := `{"command_type": "Command", "payload": {"ID": "` + string(id) + `", "Content": "command1"}}`
+	r := httptest.NewRequest(http.MethodPost, "/commands", strings.NewReader(body))
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, r)
+	if w.Code != http.StatusOK {
+		t.Error("the status should be correct:", w.Code, w.Body.String())
+	}
+	expected := &mocks.Command{ID: id, Content: "command1"}
+	if !reflect.DeepEqual(handler.command, expected) {
+		t.Error("the handled command should be correct:", handler.command)
+	}
+}
+
+func TestCommandHandlerErrors(t *testing.T) {
+	validBody := `{"command_type": "Command", "payload": {"ID": "` + string(eh.NewUUID()) + `"}}`
+
+	testCases := map[string]struct {
+		method string
+		body   string
+		err    error
+		status int
+		msg    string
+	}{
+		"method not allowed": {
+			http.MethodGet, "", nil,
+			http.StatusMethodNotAllowed, "Method Not Allowed",
+		},
+		"invalid json": {
+			http.MethodPost, `{"command_type":`, nil,
+			http.StatusBadRequest, "invalid command: unexpected EOF",
+		},
+		"unknown command type": {
+			http.MethodPost, `{"command_type": "Unknown"}`, nil,
+			http.StatusBadRequest, "unknown command type: Unknown",
+		},
+		"invalid payload": {
+			http.MethodPost, `{"command_type": "Command", "payload": "command"}`, nil,
+			http.StatusBadRequest, "invalid command: json: cannot unmarshal string into Go value of type mocks.Command",
+		},
+		"missing field": {
+			http.MethodPost, validBody, eh.CommandFieldError{Field: "Content"},
+			http.StatusBadRequest, "missing field: Content",
+		},
+		"validation error": {
+			http.MethodPost, validBody, fmt.Errorf("%w: %w", validate.ErrCommandValidation, eh.CommandFieldError{Field: "Content"}),
+			http.StatusBadRequest, "command validation failed: missing field: Content",
+		},
+		"no handler": {
+			http.MethodPost, validBody, eh.ErrHandlerNotFound,
+			http.StatusBadRequest, "no handlers for command",
+		},
+		"version conflict": {
+			http.MethodPost, validBody, eh.EventStoreError{Err: eh.ErrIncorrectEventVersion},
+			http.StatusConflict, "mismatching event version ()",
+		},
+		"other error": {
+			http.MethodPost, validBody, errors.New("db error"),
+			http.StatusInternalServerError, "Internal Server Error",
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			handler := &commandHandler{err: tc.err}
+			r := httptest.NewRequest(tc.method, "/", strings.NewReader(tc.body))
+			w := httptest.NewRecorder()
+			NewCommandHandler(handler).ServeHTTP(w, r)
+			if w.Code != tc.status {
+				t.Error("the status should be correct:", w.Code)
+			}
+			var resp ErrorResponse
+			if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+				t.Fatal("there should be no error:", err)
+			}
+			if resp.Error != tc.msg {
+				t.Error("the error message should be correct:", resp.Error)
+			}
+		})
+	}
+}
+
+// commandHandler is a command handler that records the handled command.
+type commandHandler struct {
+	command eh.Command
+	err     error
+}
+
+func (h *commandHandler) HandleCommand(ctx context.Context, cmd eh.Command) error {
+	h.command = cmd
+	return h.err
+}
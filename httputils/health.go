@@ -0,0 +1,69 @@
+// Copyright (c) 2016 - Max Ekman <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package httputils
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	eh "github.com/looplab/eventhorizon"
+)
+
+// HealthHandler is a http.Handler for health endpoints, such as the readiness
+// probe of a service, that checks that the backends are reachable. It
+// responds with:
+//   - 200 when all checks pass.
+//   - 405 for other methods than GET and HEAD.
+//   - 503 when any check fails, without the error message.
+type HealthHandler struct {
+	checkers []eh.HealthChecker
+	timeout  time.Duration
+}
+
+// NewHealthHandler creates a new HealthHandler that runs the checks with a
+// timeout, in addition to the deadline of the request. A timeout of 0 only
+// uses the deadline of the request.
+func NewHealthHandler(timeout time.Duration, checkers ...eh.HealthChecker) *HealthHandler {
+	return &HealthHandler{
+		checkers: checkers,
+		timeout:  timeout,
+	}
+}
+
+// ServeHTTP implements the ServeHTTP method of the http.Handler interface.
+func (h *HealthHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", http.MethodGet+", "+http.MethodHead)
+		writeError(w, http.StatusMethodNotAllowed, http.StatusText(http.StatusMethodNotAllowed))
+		return
+	}
+
+	ctx := r.Context()
+	if h.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, h.timeout)
+		defer cancel()
+	}
+
+	for _, c := range h.checkers {
+		if err := c.HealthCheck(ctx); err != nil {
+			writeError(w, http.StatusServiceUnavailable, http.StatusText(http.StatusServiceUnavailable))
+			return
+		}
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
@@ -0,0 +1,82 @@
+// Copyright (c) 2016 - Max Ekman <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package httputils
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	eh "github.com/looplab/eventhorizon"
+	"github.com/looplab/eventhorizon/eventstore/memory"
+)
+
+func TestHealthHandler(t *testing.T) {
+	blocking := healthChecker(func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	})
+
+	testCases := map[string]struct {
+		method   string
+		checkers []eh.HealthChecker
+		status   int
+	}{
+		"healthy": {
+			http.MethodGet, []eh.HealthChecker{memory.NewEventStore()},
+			http.StatusOK,
+		},
+		"head": {
+			http.MethodHead, []eh.HealthChecker{memory.NewEventStore()},
+			http.StatusOK,
+		},
+		"broken store": {
+			http.MethodGet, []eh.HealthChecker{
+				memory.NewEventStore(),
+				healthChecker(func(ctx context.Context) error { return errors.New("db error") }),
+			},
+			http.StatusServiceUnavailable,
+		},
+		"timeout": {
+			http.MethodGet, []eh.HealthChecker{blocking},
+			http.StatusServiceUnavailable,
+		},
+		"method not allowed": {
+			http.MethodPost, nil,
+			http.StatusMethodNotAllowed,
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			r := httptest.NewRequest(tc.method, "/health", nil)
+			w := httptest.NewRecorder()
+			NewHealthHandler(10*time.Millisecond, tc.checkers...).ServeHTTP(w, r)
+			if w.Code != tc.status {
+				t.Error("the status should be correct:", w.Code, w.Body.String())
+			}
+		})
+	}
+}
+
+// healthChecker is a func that implements eventhorizon.HealthChecker.
+type healthChecker func(ctx context.Context) error
+
+func (f healthChecker) HealthCheck(ctx context.Context) error {
+	return f(ctx)
+}
@@ -0,0 +1,39 @@
+// Copyright (c) 2016 - Max Ekman <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package eventhorizon
+
+// Logger is a structured logger that the buses and handlers log through, to be
+// able to use any logging library. The fields are pairs of keys and values,
+// for example "event_type", event.EventType().
+type Logger interface {
+	// Debug logs a message about the normal operation, like dispatching.
+	Debug(msg string, fields ...interface{})
+	// Info logs a message about noteworthy operation, like retries.
+	Info(msg string, fields ...interface{})
+	// Error logs a message about a failure, like a failed handler.
+	Error(msg string, fields ...interface{})
+}
+
+// NopLogger is a Logger that discards all messages, used by default.
+type NopLogger struct{}
+
+// Debug implements the Debug method of the Logger interface.
+func (NopLogger) Debug(msg string, fields ...interface{}) {}
+
+// Info implements the Info method of the Logger interface.
+func (NopLogger) Info(msg string, fields ...interface{}) {}
+
+// Error implements the Error method of the Logger interface.
+func (NopLogger) Error(msg string, fields ...interface{}) {}
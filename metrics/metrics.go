@@ -0,0 +1,158 @@
+// Copyright (c) 2016 - Max Ekman <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package metrics
+
+import (
+	"context"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	eh "github.com/looplab/eventhorizon"
+)
+
+// Metrics is a prometheus.Collector with metrics for handled commands and
+// events, which are collected by the handler middleware created from it.
+type Metrics struct {
+	commandsHandled *prometheus.CounterVec
+	commandErrors   *prometheus.CounterVec
+	commandDuration *prometheus.HistogramVec
+	eventsHandled   *prometheus.CounterVec
+	eventErrors     *prometheus.CounterVec
+}
+
+// NewMetrics creates new metrics with the namespace as prefix of the metric
+// names, for example "myapp" for "myapp_commands_handled_total".
+func NewMetrics(namespace string) *Metrics {
+	return &Metrics{
+		commandsHandled: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "commands_handled_total",
+			Help:      "Number of handled commands.",
+		}, []string{"command_type"}),
+		commandErrors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "command_errors_total",
+			Help:      "Number of commands that failed to be handled.",
+		}, []string{"command_type"}),
+		commandDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "command_duration_seconds",
+			Help:      "Duration of handling commands.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"command_type"}),
+		eventsHandled: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "events_handled_total",
+			Help:      "Number of events handled by event handlers.",
+		}, []string{"event_type", "handler_type"}),
+		eventErrors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "event_errors_total",
+			Help:      "Number of events that event handlers failed to handle.",
+		}, []string{"event_type", "handler_type"}),
+	}
+}
+
+// Describe implements the Describe method of the prometheus.Collector interface.
+func (m *Metrics) Describe(ch chan<- *prometheus.Desc) {
+	m.commandsHandled.Describe(ch)
+	m.commandErrors.Describe(ch)
+	m.commandDuration.Describe(ch)
+	m.eventsHandled.Describe(ch)
+	m.eventErrors.Describe(ch)
+}
+
+// Collect implements the Collect method of the prometheus.Collector interface.
+func (m *Metrics) Collect(ch chan<- prometheus.Metric) {
+	m.commandsHandled.Collect(ch)
+	m.commandErrors.Collect(ch)
+	m.commandDuration.Collect(ch)
+	m.eventsHandled.Collect(ch)
+	m.eventErrors.Collect(ch)
+}
+
+// CommandHandlerMiddleware returns a middleware that collects metrics for
+// handled commands.
+func (m *Metrics) CommandHandlerMiddleware() eh.CommandHandlerMiddleware {
+	return func(h eh.CommandHandler) eh.CommandHandler {
+		return NewCommandHandler(h, m)
+	}
+}
+
+// EventHandlerMiddleware returns a middleware that collects metrics for
+// handled events.
+func (m *Metrics) EventHandlerMiddleware() eh.EventHandlerMiddleware {
+	return func(h eh.EventHandler) eh.EventHandler {
+		return NewEventHandler(h, m)
+	}
+}
+
+// CommandHandler is a middleware that counts the handled commands and their
+// errors, and measures the duration of handling them, by command type.
+type CommandHandler struct {
+	eh.CommandHandler
+	metrics *Metrics
+}
+
+// NewCommandHandler creates a new CommandHandler.
+func NewCommandHandler(handler eh.CommandHandler, metrics *Metrics) *CommandHandler {
+	return &CommandHandler{
+		CommandHandler: handler,
+		metrics:        metrics,
+	}
+}
+
+// HandleCommand implements the HandleCommand method of the
+// eventhorizon.CommandHandler interface.
+func (h *CommandHandler) HandleCommand(ctx context.Context, cmd eh.Command) error {
+	commandType := string(cmd.CommandType())
+	start := time.Now()
+	err := h.CommandHandler.HandleCommand(ctx, cmd)
+	h.metrics.commandDuration.WithLabelValues(commandType).Observe(time.Since(start).Seconds())
+	h.metrics.commandsHandled.WithLabelValues(commandType).Inc()
+	if err != nil {
+		h.metrics.commandErrors.WithLabelValues(commandType).Inc()
+	}
+	return err
+}
+
+// EventHandler is a middleware that counts the handled events and their
+// errors, by event type and handler type.
+type EventHandler struct {
+	eh.EventHandler
+	metrics *Metrics
+}
+
+// NewEventHandler creates a new EventHandler.
+func NewEventHandler(handler eh.EventHandler, metrics *Metrics) *EventHandler {
+	return &EventHandler{
+		EventHandler: handler,
+		metrics:      metrics,
+	}
+}
+
+// HandleEvent implements the HandleEvent method of the
+// eventhorizon.EventHandler interface.
+func (h *EventHandler) HandleEvent(ctx context.Context, event eh.Event) error {
+	eventType := string(event.EventType())
+	handlerType := string(h.HandlerType())
+	err := h.EventHandler.HandleEvent(ctx, event)
+	h.metrics.eventsHandled.WithLabelValues(eventType, handlerType).Inc()
+	if err != nil {
+		h.metrics.eventErrors.WithLabelValues(eventType, handlerType).Inc()
+	}
+	return err
+}
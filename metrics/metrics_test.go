@@ -0,0 +1,120 @@
+// Copyright (c) 2016 - Max Ekman <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package metrics
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	eh "github.com/looplab/eventhorizon"
+	"github.com/looplab/eventhorizon/commandbus/local"
+	"github.com/looplab/eventhorizon/mocks"
+)
+
+func TestMetrics(t *testing.T) {
+	m := NewMetrics("test")
+	registry := prometheus.NewPedanticRegistry()
+	if err := registry.Register(m); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	if err := testutil.GatherAndCompare(registry, strings.NewReader("")); err != nil {
+		t.Error("there should be no metrics:", err)
+	}
+}
+
+func TestCommandHandler(t *testing.T) {
+	m := NewMetrics("test")
+	bus := local.NewCommandBus()
+	handler := &mocks.CommandHandler{}
+	bus.SetHandler(eh.UseCommandHandlerMiddleware(handler, m.CommandHandlerMiddleware()), mocks.CommandType)
+	otherErr := errors.New("other error")
+	bus.SetHandler(eh.UseCommandHandlerMiddleware(eh.CommandHandlerFunc(func(ctx context.Context, cmd eh.Command) error {
+		return otherErr
+	}), m.CommandHandlerMiddleware()), mocks.CommandOtherType)
+
+	t.Log("dispatch commands")
+	ctx := context.Background()
+	cmd := mocks.Command{eh.NewUUID(), "command"}
+	if err := bus.HandleCommand(ctx, cmd); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if err := bus.HandleCommand(ctx, cmd); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if handler.Command != cmd {
+		t.Error("the handler should have received the command:", handler.Command)
+	}
+	if val := testutil.ToFloat64(m.commandsHandled.WithLabelValues(string(mocks.CommandType))); val != 2 {
+		t.Error("there should be two handled commands:", val)
+	}
+	if val := testutil.ToFloat64(m.commandErrors.WithLabelValues(string(mocks.CommandType))); val != 0 {
+		t.Error("there should be no command errors:", val)
+	}
+
+	t.Log("dispatch a failing command")
+	if err := bus.HandleCommand(ctx, mocks.CommandOther{eh.NewUUID(), "command"}); err != otherErr {
+		t.Error("there should be an other error:", err)
+	}
+	if val := testutil.ToFloat64(m.commandsHandled.WithLabelValues(string(mocks.CommandOtherType))); val != 1 {
+		t.Error("there should be one handled command:", val)
+	}
+	if val := testutil.ToFloat64(m.commandErrors.WithLabelValues(string(mocks.CommandOtherType))); val != 1 {
+		t.Error("there should be one command error:", val)
+	}
+
+	t.Log("measure the command duration")
+	if count := testutil.CollectAndCount(m.commandDuration); count != 2 {
+		t.Error("there should be two command duration histograms:", count)
+	}
+}
+
+func TestEventHandler(t *testing.T) {
+	m := NewMetrics("test")
+	handler := mocks.NewEventHandler("testHandler")
+	h := eh.UseEventHandlerMiddleware(handler, m.EventHandlerMiddleware())
+	if h.HandlerType() != "testHandler" {
+		t.Error("the handler type should be kept:", h.HandlerType())
+	}
+
+	t.Log("handle event")
+	ctx := context.Background()
+	event := eh.NewEvent(mocks.EventType, &mocks.EventData{"event1"})
+	if err := h.HandleEvent(ctx, event); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if len(handler.Events) != 1 {
+		t.Error("the handler should have received the event:", handler.Events)
+	}
+	if val := testutil.ToFloat64(m.eventsHandled.WithLabelValues(string(mocks.EventType), "testHandler")); val != 1 {
+		t.Error("there should be one handled event:", val)
+	}
+
+	t.Log("handle event with an error")
+	handler.Err = errors.New("handler error")
+	if err := h.HandleEvent(ctx, event); err != handler.Err {
+		t.Error("there should be a handler error:", err)
+	}
+	if val := testutil.ToFloat64(m.eventsHandled.WithLabelValues(string(mocks.EventType), "testHandler")); val != 2 {
+		t.Error("there should be two handled events:", val)
+	}
+	if val := testutil.ToFloat64(m.eventErrors.WithLabelValues(string(mocks.EventType), "testHandler")); val != 1 {
+		t.Error("there should be one event error:", val)
+	}
+}
@@ -16,6 +16,7 @@ package mocks
 
 import (
 	"context"
+	"sync"
 	"testing"
 	"time"
 
@@ -161,6 +162,8 @@ type EventHandler struct {
 	Events  []eh.Event
 	Context context.Context
 	Recv    chan eh.Event
+	// Used to simulate errors in HandleEvent.
+	Err error
 }
 
 // NewEventHandler creates a new EventHandler.
@@ -179,10 +182,14 @@ func (m *EventHandler) HandlerType() eh.EventHandlerType {
 }
 
 // HandleEvent implements the HandleEvent method of the eventhorizon.EventHandler interface.
-func (m *EventHandler) HandleEvent(ctx context.Context, event eh.Event) {
+func (m *EventHandler) HandleEvent(ctx context.Context, event eh.Event) error {
+	if m.Err != nil {
+		return m.Err
+	}
 	m.Events = append(m.Events, event)
 	m.Context = ctx
 	m.Recv <- event
+	return nil
 }
 
 // WaitForEvent is a helper to wait until an event has been handled, it timeouts
@@ -271,12 +278,15 @@ func (m *EventStore) Save(ctx context.Context, events []eh.Event, originalVersio
 }
 
 // Load implements the Load method of the eventhorizon.EventStore interface.
-func (m *EventStore) Load(ctx context.Context, aggregateType eh.AggregateType, id eh.UUID) ([]eh.Event, error) {
+func (m *EventStore) Load(ctx context.Context, aggregateType eh.AggregateType, id eh.UUID, opts ...eh.LoadOption) ([]eh.Event, error) {
 	if m.Err != nil {
 		return nil, m.Err
 	}
 	m.Loaded = id
 	m.Context = ctx
+	if max := eh.NewLoadOptions(opts...).MaxEvents; max > 0 && max < len(m.Events) {
+		return m.Events[:max], nil
+	}
 	return m.Events, nil
 }
 
@@ -301,12 +311,18 @@ func (m *CommandBus) SetHandler(handler eh.CommandHandler, commandType eh.Comman
 type EventBus struct {
 	Events  []eh.Event
 	Context context.Context
+	// Err is the error returned when publishing events.
+	Err error
 }
 
 // PublishEvent implements the PublishEvent method of the eventhorizon.EventBus interface.
-func (m *EventBus) PublishEvent(ctx context.Context, event eh.Event) {
+func (m *EventBus) PublishEvent(ctx context.Context, event eh.Event) error {
+	if m.Err != nil {
+		return m.Err
+	}
 	m.Events = append(m.Events, event)
 	m.Context = ctx
+	return nil
 }
 
 // AddHandler implements the AddHandler method of the eventhorizon.EventBus interface.
@@ -353,6 +369,61 @@ func (r *ReadRepository) Remove(ctx context.Context, id eh.UUID) error {
 	return nil
 }
 
+// Logger is a mocked eventhorizon.Logger, useful in testing.
+type Logger struct {
+	Entries []LogEntry
+	mu      sync.Mutex
+}
+
+// LogEntry is a message logged by Logger.
+type LogEntry struct {
+	Level  string
+	Msg    string
+	Fields map[string]interface{}
+}
+
+// Debug implements the Debug method of the eventhorizon.Logger interface.
+func (l *Logger) Debug(msg string, fields ...interface{}) {
+	l.log("debug", msg, fields)
+}
+
+// Info implements the Info method of the eventhorizon.Logger interface.
+func (l *Logger) Info(msg string, fields ...interface{}) {
+	l.log("info", msg, fields)
+}
+
+// Error implements the Error method of the eventhorizon.Logger interface.
+func (l *Logger) Error(msg string, fields ...interface{}) {
+	l.log("error", msg, fields)
+}
+
+// Find returns the entries with a level and message.
+func (l *Logger) Find(level, msg string) []LogEntry {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	entries := []LogEntry{}
+	for _, e := range l.Entries {
+		if e.Level == level && e.Msg == msg {
+			entries = append(entries, e)
+		}
+	}
+	return entries
+}
+
+func (l *Logger) log(level, msg string, fields []interface{}) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	e := LogEntry{Level: level, Msg: msg, Fields: map[string]interface{}{}}
+	for i := 0; i+1 < len(fields); i += 2 {
+		if k, ok := fields[i].(string); ok {
+			e.Fields[k] = fields[i+1]
+		}
+	}
+	l.Entries = append(l.Entries, e)
+}
+
 type contextKey int
 
 const (
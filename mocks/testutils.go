@@ -35,5 +35,8 @@ func CompareEvents(e1, e2 eh.Event) error {
 	if !reflect.DeepEqual(e1.Data(), e2.Data()) {
 		return fmt.Errorf("incorrect event data: %s (should be %s)", e1.Data(), e2.Data())
 	}
+	if !reflect.DeepEqual(e1.Metadata(), e2.Metadata()) {
+		return fmt.Errorf("incorrect event metadata: %v (should be %v)", e1.Metadata(), e2.Metadata())
+	}
 	return nil
 }
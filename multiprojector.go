@@ -0,0 +1,114 @@
+// Copyright (c) 2016 - Max Ekman <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package eventhorizon
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+)
+
+// MultiProjector is an interface for projecting events onto the read models in
+// many read repositories, for read models that are built from the same events
+// with the projection logic in one place.
+type MultiProjector interface {
+	// ProjectorType returns the type of the projector.
+	ProjectorType() ProjectorType
+
+	// Project projects an event onto the read models of the aggregate, keyed
+	// by the names of their read repositories. A model is nil if there is
+	// none yet in the repository. The returned models are saved in the
+	// repository with the same name, where a nil model removes it. Models
+	// that are not returned are left as they are.
+	Project(ctx context.Context, event Event, models map[string]interface{}) (map[string]interface{}, error)
+}
+
+// MultiProjectorHandler is an event handler that runs a MultiProjector
+// implementation, keeping the read models of the aggregates in many named
+// read repositories.
+type MultiProjectorHandler struct {
+	projector    MultiProjector
+	repositories map[string]ReadRepository
+}
+
+// NewMultiProjectorHandler creates a new MultiProjectorHandler for the read
+// repositories keyed by name.
+func NewMultiProjectorHandler(projector MultiProjector, repositories map[string]ReadRepository) *MultiProjectorHandler {
+	return &MultiProjectorHandler{
+		projector:    projector,
+		repositories: repositories,
+	}
+}
+
+// HandleEvent implements the HandleEvent method of the EventHandler interface.
+// The read models of the aggregate are loaded from all repositories and
+// projected at once. All returned models are then saved or removed, as in
+// ProjectorHandler, also if some of them fail. The errors for the
+// repositories are prefixed with their names and joined with errors.Join.
+func (h *MultiProjectorHandler) HandleEvent(ctx context.Context, event Event) error {
+	id := event.AggregateID()
+	projections := make(map[string]*projection, len(h.repositories))
+	models := make(map[string]interface{}, len(h.repositories))
+	var errs []error
+	for name, repo := range h.repositories {
+		p, err := loadProjection(ctx, repo, id)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", name, err))
+			continue
+		}
+		projections[name] = p
+		models[name] = p.model
+	}
+	if len(errs) > 0 {
+		return joinErrors(errs)
+	}
+
+	updated, err := h.projector.Project(ctx, event, models)
+	if err != nil {
+		return ReadRepositoryError{
+			Err:       ErrCouldNotProjectEvent,
+			BaseErr:   err,
+			Namespace: Namespace(ctx),
+		}
+	}
+
+	for name, model := range updated {
+		p, ok := projections[name]
+		if !ok {
+			errs = append(errs, fmt.Errorf("%s: %w", name, ErrUnknownReadRepository))
+			continue
+		}
+		p.model = model
+		if err := saveProjection(ctx, h.repositories[name], id, p); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", name, err))
+		}
+	}
+
+	return joinErrors(errs)
+}
+
+// HandlerType implements the HandlerType method of the EventHandler interface.
+func (h *MultiProjectorHandler) HandlerType() EventHandlerType {
+	return EventHandlerType(h.projector.ProjectorType())
+}
+
+// joinErrors joins the errors with errors.Join, sorted by their messages for a
+// stable order of errors that are prefixed with a name. Returns nil for no
+// errors.
+func joinErrors(errs []error) error {
+	sort.Slice(errs, func(i, j int) bool { return errs[i].Error() < errs[j].Error() })
+	return errors.Join(errs...)
+}
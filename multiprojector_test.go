@@ -0,0 +1,190 @@
+// Copyright (c) 2016 - Max Ekman <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package eventhorizon
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestMultiProjectorHandler(t *testing.T) {
+	contents := &MockReadRepository{Models: map[UUID]interface{}{}}
+	versions := &MockReadRepository{Models: map[UUID]interface{}{}}
+	projector := &TestMultiProjector{}
+	handler := NewMultiProjectorHandler(projector, map[string]ReadRepository{
+		"contents": contents,
+		"versions": versions,
+	})
+	if handler.HandlerType() != "TestMultiProjector" {
+		t.Error("the handler type should be correct:", handler.HandlerType())
+	}
+
+	ctx := context.Background()
+
+	t.Log("project event into two repositories")
+	id := NewUUID()
+	agg := NewTestAggregate(id)
+	event1 := agg.NewEvent(TestEventType, &TestEventData{"event1"})
+	agg.ApplyEvent(ctx, event1)
+	if err := handler.HandleEvent(ctx, event1); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if !reflect.DeepEqual(projector.models, map[string]interface{}{"contents": nil, "versions": nil}) {
+		t.Error("the projected models should be nil:", projector.models)
+	}
+	if m := contents.Models[id]; !reflect.DeepEqual(m, &TestModel{Content: "event1"}) {
+		t.Error("the contents model should be correct:", m)
+	}
+	if m := versions.Models[id]; !reflect.DeepEqual(m, &TestModel{Version: 1}) {
+		t.Error("the versions model should be correct:", m)
+	}
+
+	t.Log("project event for existing models")
+	event2 := agg.NewEvent(TestEventType, &TestEventData{"event2"})
+	agg.ApplyEvent(ctx, event2)
+	if err := handler.HandleEvent(ctx, event2); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if m := projector.models["versions"]; !reflect.DeepEqual(m, &TestModel{Version: 1}) {
+		t.Error("the projected model should be loaded:", m)
+	}
+	if m := contents.Models[id]; !reflect.DeepEqual(m, &TestModel{Content: "event2"}) {
+		t.Error("the contents model should be correct:", m)
+	}
+	if m := versions.Models[id]; !reflect.DeepEqual(m, &TestModel{Version: 2}) {
+		t.Error("the versions model should be correct:", m)
+	}
+
+	t.Log("project event removing a model")
+	event3 := agg.NewEvent(TestEvent2Type, nil)
+	agg.ApplyEvent(ctx, event3)
+	if err := handler.HandleEvent(ctx, event3); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if _, ok := contents.Models[id]; ok {
+		t.Error("the contents model should be removed")
+	}
+	if m := versions.Models[id]; !reflect.DeepEqual(m, &TestModel{Version: 3}) {
+		t.Error("the versions model should be correct:", m)
+	}
+}
+
+func TestMultiProjectorHandlerErrors(t *testing.T) {
+	repoErr := errors.New("repo error")
+	working := &MockReadRepository{Models: map[UUID]interface{}{}}
+	failing := &MockReadRepository{Models: map[UUID]interface{}{}}
+	projector := &TestMultiProjector{}
+	handler := NewMultiProjectorHandler(projector, map[string]ReadRepository{
+		"contents": working,
+		"versions": failing,
+	})
+
+	ctx := context.Background()
+	id := NewUUID()
+	agg := NewTestAggregate(id)
+	event := agg.NewEvent(TestEventType, &TestEventData{"event"})
+	agg.ApplyEvent(ctx, event)
+
+	t.Log("load error")
+	failing.Err = repoErr
+	err := handler.HandleEvent(ctx, event)
+	joined, ok := err.(interface{ Unwrap() []error })
+	if !ok || len(joined.Unwrap()) != 1 || !errors.Is(err, ErrCouldNotLoadModel) || !strings.HasPrefix(err.Error(), "versions: ") {
+		t.Error("there should be a load error for the failing repository:", err)
+	}
+	if !errors.Is(err, repoErr) {
+		t.Error("the error should match the repository error:", err)
+	}
+	if len(working.Models) != 0 {
+		t.Error("no models should be saved:", working.Models)
+	}
+
+	t.Log("save error")
+	handler = NewMultiProjectorHandler(projector, map[string]ReadRepository{
+		"contents": working,
+		"versions": &saveFailingReadRepository{MockReadRepository{Models: map[UUID]interface{}{}}, repoErr},
+	})
+	err = handler.HandleEvent(ctx, event)
+	joined, ok = err.(interface{ Unwrap() []error })
+	if !ok || len(joined.Unwrap()) != 1 || !errors.Is(err, ErrCouldNotSaveModel) || !strings.HasPrefix(err.Error(), "versions: ") {
+		t.Error("there should be a save error for the failing repository:", err)
+	}
+	if m := working.Models[id]; !reflect.DeepEqual(m, &TestModel{Content: "event"}) {
+		t.Error("the other model should still be saved:", m)
+	}
+
+	t.Log("projector error")
+	projector.err = errors.New("projector error")
+	err = handler.HandleEvent(ctx, event)
+	if !errors.Is(err, ErrCouldNotProjectEvent) {
+		t.Error("there should be a could not project event error:", err)
+	}
+	projector.err = nil
+
+	t.Log("unknown repository")
+	projector.extra = true
+	err = handler.HandleEvent(ctx, event)
+	if !errors.Is(err, ErrUnknownReadRepository) {
+		t.Error("there should be an unknown read repository error:", err)
+	}
+}
+
+// saveFailingReadRepository is a read repository that can not save models.
+type saveFailingReadRepository struct {
+	MockReadRepository
+	err error
+}
+
+func (m *saveFailingReadRepository) Save(ctx context.Context, id UUID, model interface{}) error {
+	return m.err
+}
+
+// TestMultiProjector projects the content of the events into the "contents"
+// repository and the version into the "versions" repository.
+type TestMultiProjector struct {
+	models map[string]interface{}
+	err    error
+	extra  bool
+}
+
+func (p *TestMultiProjector) ProjectorType() ProjectorType {
+	return "TestMultiProjector"
+}
+
+func (p *TestMultiProjector) Project(ctx context.Context, event Event, models map[string]interface{}) (map[string]interface{}, error) {
+	p.models = models
+	if p.err != nil {
+		return nil, p.err
+	}
+
+	updated := map[string]interface{}{
+		"versions": &TestModel{Version: event.Version()},
+	}
+	switch event.EventType() {
+	case TestEventType:
+		data, _ := event.Data().(*TestEventData)
+		updated["contents"] = &TestModel{Content: data.Content}
+	case TestEvent2Type:
+		// Remove the contents model.
+		updated["contents"] = nil
+	}
+	if p.extra {
+		updated["unknown"] = &TestModel{}
+	}
+	return updated, nil
+}
@@ -21,10 +21,22 @@ func init() {
 		if ns, ok := ctx.Value(namespaceKey).(string); ok {
 			vals[namespaceKeyStr] = ns
 		}
+		if id, ok := ctx.Value(correlationIDKey).(string); ok {
+			vals[correlationIDKeyStr] = id
+		}
+		if id, ok := ctx.Value(causationIDKey).(string); ok {
+			vals[causationIDKeyStr] = id
+		}
 	})
 	RegisterContextUnmarshaler(func(ctx context.Context, vals map[string]interface{}) context.Context {
 		if ns, ok := vals[namespaceKeyStr].(string); ok {
-			return WithNamespace(ctx, ns)
+			ctx = WithNamespace(ctx, ns)
+		}
+		if id, ok := vals[correlationIDKeyStr].(string); ok {
+			ctx = WithCorrelationID(ctx, id)
+		}
+		if id, ok := vals[causationIDKeyStr].(string); ok {
+			ctx = WithCausationID(ctx, id)
 		}
 		return ctx
 	})
@@ -38,11 +50,22 @@ type contextKey int
 const (
 	// namespaceKey is the context key for the namespace value.
 	namespaceKey contextKey = iota
+	// dryRunKey is the context key for the events of a dry run.
+	dryRunKey
+	// commandResultKey is the context key for the result of a command.
+	commandResultKey
+	// correlationIDKey is the context key for the correlation ID.
+	correlationIDKey
+	// causationIDKey is the context key for the causation ID.
+	causationIDKey
 )
 
 const (
 	// The string key used to marshal namespaceKey.
 	namespaceKeyStr = "eh_namespace"
+	// The string keys used to marshal correlationIDKey and causationIDKey.
+	correlationIDKeyStr = "eh_correlation_id"
+	causationIDKeyStr   = "eh_causation_id"
 )
 
 // Namespace returns the namespace from the context, or the default namespace.
@@ -54,7 +77,8 @@ func Namespace(ctx context.Context) string {
 }
 
 // WithNamespace sets the namespace to use in the context. The namespace is
-// used to determine which database
+// used to determine which database, or which part of it, the stores use, for
+// example to keep the data of each tenant separate.
 func WithNamespace(ctx context.Context, namespace string) context.Context {
 	return context.WithValue(ctx, namespaceKey, namespace)
 }
@@ -0,0 +1,418 @@
+// Copyright (c) 2016 - Max Ekman <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package eventhorizon
+
+import (
+	"context"
+	"errors"
+	"strconv"
+)
+
+// ErrCouldNotLoadModel is when a read model could not be loaded for projection.
+var ErrCouldNotLoadModel = errors.New("could not load model")
+
+// ErrCouldNotProjectEvent is when an event could not be projected.
+var ErrCouldNotProjectEvent = errors.New("could not project event")
+
+// ErrCouldNotRemoveModel is when a projected read model could not be removed.
+var ErrCouldNotRemoveModel = errors.New("could not remove model")
+
+// ErrUnknownReadRepository is when a multi projector returns a model for a read
+// repository that the handler does not have.
+var ErrUnknownReadRepository = errors.New("unknown read repository")
+
+// ErrCouldNotClearModels is when the read models could not be cleared before
+// rebuilding a projection.
+var ErrCouldNotClearModels = errors.New("could not clear models")
+
+// ErrCouldNotSaveCheckpoint is when the checkpoint of a projection could not be
+// saved after projecting events.
+var ErrCouldNotSaveCheckpoint = errors.New("could not save checkpoint")
+
+// ErrCouldNotLoadCheckpoint is when the checkpoint of a projection could not be
+// loaded.
+var ErrCouldNotLoadCheckpoint = errors.New("could not load checkpoint")
+
+// Projector is an interface for projecting events onto read models, used to
+// build and keep the read models up to date.
+type Projector interface {
+	// ProjectorType returns the type of the projector.
+	ProjectorType() ProjectorType
+
+	// Project projects an event onto a read model, returning the new read
+	// model. The model is nil if there is none yet for the aggregate, and
+	// returning a nil model removes it from the read repository, for example
+	// to handle a deleted event.
+	Project(ctx context.Context, event Event, model interface{}) (interface{}, error)
+}
+
+// ProjectorType is the type of a projector, used as its unique identifier.
+type ProjectorType string
+
+// ProjectorHandler is an event handler that runs a Projector implementation,
+// keeping the read models of the aggregates in a read repository.
+type ProjectorHandler struct {
+	projector   Projector
+	repository  ReadRepository
+	checkpoints CheckpointStore
+}
+
+// ProjectorHandlerOption is an option for NewProjectorHandler.
+type ProjectorHandlerOption func(*ProjectorHandler)
+
+// WithProjectorCheckpoints saves the global position of the last projected
+// event in the store after the events have been projected, with the projector
+// type as consumer, to monitor the lag of the projection with ProjectionLag.
+// Only events from an event store that implement PositionedEvent advance the
+// checkpoint. The positions are those of the event store, the store should not
+// be shared with an event bus that commits its own positions for the same
+// handler type. Events can be handled out of position order, see
+// PositionedEvent, so a projection that resumes from the checkpoint should
+// replay a window of positions behind it.
+func WithProjectorCheckpoints(store CheckpointStore) ProjectorHandlerOption {
+	return func(h *ProjectorHandler) {
+		h.checkpoints = store
+	}
+}
+
+// NewProjectorHandler creates a new ProjectorHandler.
+func NewProjectorHandler(projector Projector, repository ReadRepository, opts ...ProjectorHandlerOption) *ProjectorHandler {
+	h := &ProjectorHandler{
+		projector:  projector,
+		repository: repository,
+	}
+	for _, opt := range opts {
+		opt(h)
+	}
+	return h
+}
+
+// HandleEvent implements the HandleEvent method of the EventHandler interface.
+// The read model of the aggregate is loaded, projected and then saved, or
+// removed if the projector returns no model. Versionable models are saved with
+// SaveVersioned if the repository supports it, with the version of the loaded
+// model as expected version. Events that a Versionable model already has, by
+// its version, are skipped, so that events can be handled again when resuming
+// a projection.
+func (h *ProjectorHandler) HandleEvent(ctx context.Context, event Event) error {
+	return h.HandleEvents(ctx, []Event{event})
+}
+
+// HandleEvents handles a batch of events in order, for example buffered by the
+// middleware in the eventhandler/batch package. The read model of each
+// aggregate is loaded once, projected with all its events and then saved or
+// removed once, the same way as in HandleEvent.
+func (h *ProjectorHandler) HandleEvents(ctx context.Context, events []Event) error {
+	projections := map[UUID]*projection{}
+	ids := []UUID{}
+	for _, event := range events {
+		id := event.AggregateID()
+		p, ok := projections[id]
+		if !ok {
+			var err error
+			if p, err = loadProjection(ctx, h.repository, id); err != nil {
+				return err
+			}
+			projections[id] = p
+			ids = append(ids, id)
+		}
+
+		// Skip events that have already been projected.
+		if m, ok := p.model.(Versionable); ok && event.Version() <= m.AggregateVersion() {
+			continue
+		}
+
+		model, err := h.projector.Project(ctx, event, p.model)
+		if err != nil {
+			return ReadRepositoryError{
+				Err:       ErrCouldNotProjectEvent,
+				BaseErr:   err,
+				Namespace: Namespace(ctx),
+			}
+		}
+		p.model = model
+	}
+
+	for _, id := range ids {
+		if err := saveProjection(ctx, h.repository, id, projections[id]); err != nil {
+			return err
+		}
+	}
+
+	return h.saveCheckpoint(ctx, events)
+}
+
+// saveCheckpoint saves the highest global position of the projected events, if
+// the handler has a checkpoint store and any of the events has a position.
+func (h *ProjectorHandler) saveCheckpoint(ctx context.Context, events []Event) error {
+	if h.checkpoints == nil {
+		return nil
+	}
+
+	var position int64
+	for _, event := range events {
+		if positioned, ok := event.(PositionedEvent); ok && positioned.GlobalPosition() > position {
+			position = positioned.GlobalPosition()
+		}
+	}
+	if position == 0 {
+		return nil
+	}
+
+	consumer := string(h.projector.ProjectorType())
+	if err := h.checkpoints.SaveCheckpoint(ctx, consumer, strconv.FormatInt(position, 10)); err != nil {
+		return ReadRepositoryError{
+			Err:       ErrCouldNotSaveCheckpoint,
+			BaseErr:   err,
+			Namespace: Namespace(ctx),
+		}
+	}
+
+	return nil
+}
+
+// ProjectionLag returns the number of global positions in the store after the
+// checkpoint saved for a projector by a ProjectorHandler with
+// WithProjectorCheckpoints, which is zero when the projection is up to date.
+// As positions can have gaps it is at most the number of events that have not
+// been projected. The lag is the head position of the store if the projector
+// has no checkpoint yet.
+func ProjectionLag(ctx context.Context, checkpoints CheckpointStore, store HeadPositioner, projectorType ProjectorType) (int64, error) {
+	checkpoint, err := checkpoints.LoadCheckpoint(ctx, string(projectorType))
+	if err != nil {
+		return 0, ReadRepositoryError{
+			Err:       ErrCouldNotLoadCheckpoint,
+			BaseErr:   err,
+			Namespace: Namespace(ctx),
+		}
+	}
+
+	var position int64
+	if checkpoint != "" {
+		if position, err = strconv.ParseInt(checkpoint, 10, 64); err != nil {
+			return 0, ReadRepositoryError{
+				Err:       ErrInvalidPosition,
+				BaseErr:   err,
+				Namespace: Namespace(ctx),
+			}
+		}
+	}
+
+	head, err := store.HeadPosition(ctx)
+	if err != nil {
+		return 0, err
+	}
+	if head < position {
+		return 0, nil
+	}
+
+	return head - position, nil
+}
+
+// projection is a read model that is being projected, with the state of the
+// model when it was loaded.
+type projection struct {
+	model   interface{}
+	exists  bool
+	version int
+}
+
+// loadProjection loads the read model of an aggregate from a repository, to be
+// projected. The model is nil if there is none yet.
+func loadProjection(ctx context.Context, repo ReadRepository, id UUID) (*projection, error) {
+	model, err := repo.Find(ctx, id)
+	if errors.Is(err, ErrModelNotFound) {
+		model = nil
+	} else if err != nil {
+		return nil, ReadRepositoryError{
+			Err:       ErrCouldNotLoadModel,
+			BaseErr:   err,
+			Namespace: Namespace(ctx),
+		}
+	}
+	p := &projection{model: model, exists: model != nil}
+
+	// Keep the version before projecting, the model can be changed in place.
+	if v, ok := model.(Versionable); ok {
+		p.version = v.AggregateVersion()
+	}
+
+	return p, nil
+}
+
+// saveProjection saves a projected model in a repository, or removes it if the
+// projector returned none.
+func saveProjection(ctx context.Context, repo ReadRepository, id UUID, p *projection) error {
+	// Remove the model if the projector returned none.
+	if p.model == nil {
+		if !p.exists {
+			return nil
+		}
+		if err := repo.Remove(ctx, id); err != nil && !errors.Is(err, ErrModelNotFound) {
+			return ReadRepositoryError{
+				Err:       ErrCouldNotRemoveModel,
+				BaseErr:   err,
+				Namespace: Namespace(ctx),
+			}
+		}
+		return nil
+	}
+
+	// Save versioned models only if they were not changed concurrently.
+	if saver, ok := repo.(ReadRepositoryVersionedSaver); ok {
+		if m, ok := p.model.(Versionable); ok {
+			if err := saver.SaveVersioned(ctx, id, m, p.version); err != nil {
+				return ReadRepositoryError{
+					Err:       ErrCouldNotSaveModel,
+					BaseErr:   err,
+					Namespace: Namespace(ctx),
+				}
+			}
+			return nil
+		}
+	}
+
+	if err := repo.Save(ctx, id, p.model); err != nil {
+		return ReadRepositoryError{
+			Err:       ErrCouldNotSaveModel,
+			BaseErr:   err,
+			Namespace: Namespace(ctx),
+		}
+	}
+
+	return nil
+}
+
+// HandlerType implements the HandlerType method of the EventHandler interface.
+func (h *ProjectorHandler) HandlerType() EventHandlerType {
+	return EventHandlerType(h.projector.ProjectorType())
+}
+
+// RebuildOption is an option for RebuildProjection.
+type RebuildOption func(*rebuild)
+
+// WithRebuildProgress calls the progress func with the position of each event
+// after it has been projected, where the first event is at position 1.
+func WithRebuildProgress(progress func(position int, event Event)) RebuildOption {
+	return func(r *rebuild) {
+		r.progress = progress
+	}
+}
+
+// WithRebuildResume resumes a rebuild after the event at a position returned
+// by an earlier, interrupted, call to RebuildProjection. The read models are
+// not cleared when resuming.
+func WithRebuildResume(position int) RebuildOption {
+	return func(r *rebuild) {
+		r.resume = position
+	}
+}
+
+// WithRebuildFilter only replays the events matching the filter, for
+// projectors that only use some of the events. Stores that implement
+// FilteredEventStreamer filter the events themselves, for other stores all
+// events are replayed and filtered during the rebuild. Positions only count
+// the matching events.
+func WithRebuildFilter(filter ReplayFilter) RebuildOption {
+	return func(r *rebuild) {
+		r.filter = &filter
+	}
+}
+
+// rebuild is the configuration of a projection rebuild.
+type rebuild struct {
+	progress func(position int, event Event)
+	resume   int
+	filter   *ReplayFilter
+}
+
+// RebuildProjection rebuilds the read models of a projector from all events in
+// the store. The read repository, or the first of its parents that implements
+// ReadRepositoryClearer, is cleared before all events are replayed through the
+// projector in order. The position of the last projected event is returned,
+// also when an error occurs, which can be used with WithRebuildResume to
+// continue the rebuild.
+func RebuildProjection(ctx context.Context, store EventStreamer, projector Projector, repo ReadRepository, opts ...RebuildOption) (int, error) {
+	r := &rebuild{}
+	for _, opt := range opts {
+		opt(r)
+	}
+
+	if r.resume == 0 {
+		if err := clearReadRepository(ctx, repo); err != nil {
+			return 0, ReadRepositoryError{
+				Err:       ErrCouldNotClearModels,
+				BaseErr:   err,
+				Namespace: Namespace(ctx),
+			}
+		}
+	}
+
+	// Stop the replay if the rebuild ends early.
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	handler := NewProjectorHandler(projector, repo)
+	events, errs := replay(ctx, store, r.filter)
+	position := 0
+	for event := range events {
+		if r.filter != nil && !r.filter.Match(event) {
+			continue
+		}
+		if position < r.resume {
+			position++
+			continue
+		}
+
+		if err := handler.HandleEvent(ctx, event); err != nil {
+			return position, err
+		}
+		position++
+
+		if r.progress != nil {
+			r.progress(position, event)
+		}
+	}
+
+	if err := <-errs; err != nil {
+		return position, err
+	}
+
+	return position, nil
+}
+
+// replay replays the events matching the filter, or all events if there is
+// no filter.
+func replay(ctx context.Context, store EventStreamer, filter *ReplayFilter) (<-chan Event, <-chan error) {
+	if filter != nil {
+		if streamer, ok := store.(FilteredEventStreamer); ok {
+			return streamer.Replay(ctx, *filter)
+		}
+	}
+
+	return store.ReplayAll(ctx)
+}
+
+// clearReadRepository clears the first repository in the chain of parents
+// that can be cleared.
+func clearReadRepository(ctx context.Context, repo ReadRepository) error {
+	for r := repo; r != nil; r = r.Parent() {
+		if clearer, ok := r.(ReadRepositoryClearer); ok {
+			return clearer.Clear(ctx)
+		}
+	}
+
+	return ErrClearNotSupported
+}
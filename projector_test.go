@@ -0,0 +1,589 @@
+// Copyright (c) 2016 - Max Ekman <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package eventhorizon
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestProjectorHandler(t *testing.T) {
+	repo := &MockReadRepository{
+		Models: map[UUID]interface{}{},
+	}
+	projector := &TestProjector{}
+	handler := NewProjectorHandler(projector, repo)
+	if handler.HandlerType() != "TestProjector" {
+		t.Error("the handler type should be correct:", handler.HandlerType())
+	}
+
+	ctx := context.Background()
+
+	t.Log("project event for a new model")
+	id := NewUUID()
+	agg := NewTestAggregate(id)
+	event1 := agg.NewEvent(TestEventType, &TestEventData{"event1"})
+	agg.ApplyEvent(ctx, event1)
+	if err := handler.HandleEvent(ctx, event1); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if projector.model != nil {
+		t.Error("there should be no model to project onto:", projector.model)
+	}
+	if !reflect.DeepEqual(repo.Models[id], &TestModel{"event1", 1}) {
+		t.Error("the model should be saved:", repo.Models[id])
+	}
+
+	t.Log("project event for an existing model")
+	event2 := agg.NewEvent(TestEventType, &TestEventData{"event2"})
+	agg.ApplyEvent(ctx, event2)
+	if err := handler.HandleEvent(ctx, event2); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if !reflect.DeepEqual(repo.Models[id], &TestModel{"event2", 2}) {
+		t.Error("the model should be updated:", repo.Models[id])
+	}
+
+	t.Log("project delete event")
+	event3 := agg.NewEvent(TestEvent2Type, &TestEvent2Data{"deleted"})
+	agg.ApplyEvent(ctx, event3)
+	if err := handler.HandleEvent(ctx, event3); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if _, err := repo.Find(ctx, id); !errors.Is(err, ErrModelNotFound) {
+		t.Error("there should be a ErrModelNotFound error:", err)
+	}
+
+	t.Log("project delete event without a model")
+	if err := handler.HandleEvent(ctx, event3); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if len(repo.Models) != 0 {
+		t.Error("there should be no models:", repo.Models)
+	}
+}
+
+func TestProjectorHandlerBatch(t *testing.T) {
+	repo := &countingReadRepository{
+		MockReadRepository: MockReadRepository{
+			Models: map[UUID]interface{}{},
+		},
+	}
+	projector := &TestProjector{}
+	handler := NewProjectorHandler(projector, repo)
+
+	ctx := context.Background()
+
+	t.Log("project a batch of events for two aggregates")
+	id1 := NewUUID()
+	agg1 := NewTestAggregate(id1)
+	event1 := agg1.NewEvent(TestEventType, &TestEventData{"event1"})
+	agg1.ApplyEvent(ctx, event1)
+	id2 := NewUUID()
+	agg2 := NewTestAggregate(id2)
+	event2 := agg2.NewEvent(TestEventType, &TestEventData{"event2"})
+	agg2.ApplyEvent(ctx, event2)
+	event3 := agg1.NewEvent(TestEventType, &TestEventData{"event3"})
+	agg1.ApplyEvent(ctx, event3)
+	if err := handler.HandleEvents(ctx, []Event{event1, event2, event3}); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	expected := map[UUID]interface{}{
+		id1: &TestModel{"event3", 2},
+		id2: &TestModel{"event2", 1},
+	}
+	if !reflect.DeepEqual(repo.Models, expected) {
+		t.Error("the models should be correct:", repo.Models)
+	}
+	if repo.saves != 2 {
+		t.Error("each model should be saved once:", repo.saves)
+	}
+
+	t.Log("project a batch that creates and removes a model")
+	id3 := NewUUID()
+	agg3 := NewTestAggregate(id3)
+	event4 := agg3.NewEvent(TestEventType, &TestEventData{"event4"})
+	agg3.ApplyEvent(ctx, event4)
+	event5 := agg3.NewEvent(TestEvent2Type, &TestEvent2Data{"deleted"})
+	agg3.ApplyEvent(ctx, event5)
+	if err := handler.HandleEvents(ctx, []Event{event4, event5}); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if _, ok := repo.Models[id3]; ok || repo.saves != 2 {
+		t.Error("the model should not be saved:", repo.Models, repo.saves)
+	}
+}
+
+// countingReadRepository counts the saved models.
+type countingReadRepository struct {
+	MockReadRepository
+	saves int
+}
+
+func (m *countingReadRepository) Save(ctx context.Context, id UUID, model interface{}) error {
+	m.saves++
+	return m.MockReadRepository.Save(ctx, id, model)
+}
+
+func TestProjectorHandlerErrors(t *testing.T) {
+	repo := &MockReadRepository{
+		Models: map[UUID]interface{}{},
+	}
+	projector := &TestProjector{}
+	handler := NewProjectorHandler(projector, repo)
+	ctx := context.Background()
+	event := NewEvent(TestEventType, &TestEventData{"event1"})
+
+	t.Log("fail to project event")
+	projector.err = errors.New("projector error")
+	err := handler.HandleEvent(ctx, event)
+	if rrErr, ok := err.(ReadRepositoryError); !ok || rrErr.Err != ErrCouldNotProjectEvent || rrErr.BaseErr != projector.err {
+		t.Error("there should be a ErrCouldNotProjectEvent error:", err)
+	}
+	if len(repo.Models) != 0 {
+		t.Error("there should be no models:", repo.Models)
+	}
+
+	t.Log("fail to load model")
+	projector.err = nil
+	repo.Err = errors.New("repository error")
+	err = handler.HandleEvent(ctx, event)
+	if !errors.Is(err, ErrCouldNotLoadModel) || !errors.Is(err, repo.Err) {
+		t.Error("there should be a ErrCouldNotLoadModel error:", err)
+	}
+}
+
+func TestProjectorHandlerVersioned(t *testing.T) {
+	repo := &MockVersionedReadRepository{
+		MockReadRepository: MockReadRepository{
+			Models: map[UUID]interface{}{},
+		},
+	}
+	projector := &TestProjector{}
+	handler := NewProjectorHandler(projector, repo)
+
+	ctx := context.Background()
+
+	t.Log("project event for a new model")
+	id := NewUUID()
+	agg := NewTestAggregate(id)
+	event1 := agg.NewEvent(TestEventType, &TestEventData{"event1"})
+	agg.ApplyEvent(ctx, event1)
+	if err := handler.HandleEvent(ctx, event1); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if !reflect.DeepEqual(repo.Models[id], &TestModel{"event1", 1}) {
+		t.Error("the model should be saved:", repo.Models[id])
+	}
+
+	t.Log("project event for an existing model")
+	event2 := agg.NewEvent(TestEventType, &TestEventData{"event2"})
+	agg.ApplyEvent(ctx, event2)
+	if err := handler.HandleEvent(ctx, event2); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if !reflect.DeepEqual(repo.expectedVersions, []int{0, 1}) {
+		t.Error("the expected versions should be correct:", repo.expectedVersions)
+	}
+
+	t.Log("skip an event that has already been projected")
+	if err := handler.HandleEvent(ctx, event1); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if !reflect.DeepEqual(repo.Models[id], &TestModel{"event2", 2}) {
+		t.Error("the model should not be changed:", repo.Models[id])
+	}
+
+	t.Log("fail to save a concurrently changed model")
+	repo.mismatch = true
+	event3 := agg.NewEvent(TestEventType, &TestEventData{"event3"})
+	agg.ApplyEvent(ctx, event3)
+	err := handler.HandleEvent(ctx, event3)
+	if !errors.Is(err, ErrCouldNotSaveModel) || !errors.Is(err, ErrModelVersionMismatch) {
+		t.Error("there should be a ErrModelVersionMismatch error:", err)
+	}
+	if !reflect.DeepEqual(repo.Models[id], &TestModel{"event2", 2}) {
+		t.Error("the model should not be saved:", repo.Models[id])
+	}
+}
+
+func TestRebuildProjection(t *testing.T) {
+	ctx := context.Background()
+
+	id1 := NewUUID()
+	agg1 := NewTestAggregate(id1)
+	event1 := agg1.NewEvent(TestEventType, &TestEventData{"event1"})
+	agg1.ApplyEvent(ctx, event1)
+	id2 := NewUUID()
+	agg2 := NewTestAggregate(id2)
+	event2 := agg2.NewEvent(TestEventType, &TestEventData{"event2"})
+	agg2.ApplyEvent(ctx, event2)
+	event3 := agg1.NewEvent(TestEventType, &TestEventData{"event3"})
+	agg1.ApplyEvent(ctx, event3)
+	id3 := NewUUID()
+	agg3 := NewTestAggregate(id3)
+	event4 := agg3.NewEvent(TestEventType, &TestEventData{"event4"})
+	agg3.ApplyEvent(ctx, event4)
+	event5 := agg3.NewEvent(TestEvent2Type, &TestEvent2Data{"deleted"})
+	agg3.ApplyEvent(ctx, event5)
+
+	t.Log("rebuild a projection with stale models")
+	store := &MockEventStore{
+		Events: []Event{event1, event2, event3, event4, event5},
+	}
+	staleID := NewUUID()
+	repo := &MockReadRepository{
+		Models: map[UUID]interface{}{
+			staleID: &TestModel{"stale", 1},
+		},
+	}
+	projector := &TestProjector{}
+	var positions []int
+	position, err := RebuildProjection(ctx, store, projector, repo,
+		WithRebuildProgress(func(position int, event Event) {
+			positions = append(positions, position)
+		}),
+	)
+	if err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if position != 5 {
+		t.Error("the position should be correct:", position)
+	}
+	if !reflect.DeepEqual(positions, []int{1, 2, 3, 4, 5}) {
+		t.Error("the progress should be reported for each event:", positions)
+	}
+	expected := map[UUID]interface{}{
+		id1: &TestModel{"event3", 2},
+		id2: &TestModel{"event2", 1},
+	}
+	if !reflect.DeepEqual(repo.Models, expected) {
+		t.Error("the models should be correct:", repo.Models)
+	}
+
+	t.Log("resume an interrupted rebuild")
+	store = &MockEventStore{
+		Events: []Event{event1, event2},
+	}
+	repo = &MockReadRepository{
+		Models: map[UUID]interface{}{},
+	}
+	position, err = RebuildProjection(ctx, store, projector, repo)
+	if err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if position != 2 {
+		t.Error("the position should be correct:", position)
+	}
+	store.Events = append(store.Events, event3, event4, event5)
+	positions = nil
+	position, err = RebuildProjection(ctx, store, projector, repo,
+		WithRebuildResume(position),
+		WithRebuildProgress(func(position int, event Event) {
+			positions = append(positions, position)
+		}),
+	)
+	if err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if position != 5 {
+		t.Error("the position should be correct:", position)
+	}
+	if !reflect.DeepEqual(positions, []int{3, 4, 5}) {
+		t.Error("only the remaining events should be projected:", positions)
+	}
+	if !reflect.DeepEqual(repo.Models, expected) {
+		t.Error("the models should be correct:", repo.Models)
+	}
+
+	t.Log("rebuild a projection from filtered events")
+	repo = &MockReadRepository{
+		Models: map[UUID]interface{}{},
+	}
+	position, err = RebuildProjection(ctx, store, projector, repo,
+		WithRebuildFilter(ReplayFilter{EventTypes: []EventType{TestEventType}}),
+	)
+	if err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if position != 4 {
+		t.Error("only the matching events should be projected:", position)
+	}
+	expected = map[UUID]interface{}{
+		id1: &TestModel{"event3", 2},
+		id2: &TestModel{"event2", 1},
+		id3: &TestModel{"event4", 1},
+	}
+	if !reflect.DeepEqual(repo.Models, expected) {
+		t.Error("the models should be correct:", repo.Models)
+	}
+}
+
+func TestRebuildProjectionErrors(t *testing.T) {
+	ctx := context.Background()
+	event := NewEvent(TestEventType, &TestEventData{"event1"})
+
+	t.Log("fail to clear models")
+	store := &MockEventStore{
+		Events: []Event{event},
+	}
+	repo := &MockReadRepository{
+		Models: map[UUID]interface{}{},
+		Err:    errors.New("repository error"),
+	}
+	projector := &TestProjector{}
+	_, err := RebuildProjection(ctx, store, projector, repo)
+	if !errors.Is(err, ErrCouldNotClearModels) || !errors.Is(err, repo.Err) {
+		t.Error("there should be a ErrCouldNotClearModels error:", err)
+	}
+
+	t.Log("fail to project event")
+	repo.Err = nil
+	projector.err = errors.New("projector error")
+	position, err := RebuildProjection(ctx, store, projector, repo)
+	if !errors.Is(err, ErrCouldNotProjectEvent) || !errors.Is(err, projector.err) {
+		t.Error("there should be a ErrCouldNotProjectEvent error:", err)
+	}
+	if position != 0 {
+		t.Error("the position should be correct:", position)
+	}
+
+	t.Log("fail to get the head position")
+	projector.err = nil
+	store.err = errors.New("store error")
+	if _, err := RebuildProjection(ctx, store, projector, repo); err != store.err {
+		t.Error("there should be a store error:", err)
+	}
+}
+
+func TestProjectorHandlerCheckpoint(t *testing.T) {
+	ctx := context.Background()
+
+	repo := &MockReadRepository{
+		Models: map[UUID]interface{}{},
+	}
+	checkpoints := &MockCheckpointStore{
+		positions: map[string]string{},
+	}
+	projector := &TestProjector{}
+	handler := NewProjectorHandler(projector, repo, WithProjectorCheckpoints(checkpoints))
+
+	id := NewUUID()
+	agg := NewTestAggregate(id)
+	event1 := agg.NewEvent(TestEventType, &TestEventData{"event1"})
+	agg.ApplyEvent(ctx, event1)
+	event2 := agg.NewEvent(TestEventType, &TestEventData{"event2"})
+	agg.ApplyEvent(ctx, event2)
+	event3 := agg.NewEvent(TestEventType, &TestEventData{"event3"})
+	agg.ApplyEvent(ctx, event3)
+	store := &MockEventStore{
+		Events: []Event{
+			positionedEvent{event1, 3},
+			positionedEvent{event2, 5},
+			positionedEvent{event3, 8},
+		},
+	}
+
+	head := &MockHeadPositioner{position: 8}
+
+	t.Log("lag of a projection without a checkpoint")
+	lag, err := ProjectionLag(ctx, checkpoints, head, projector.ProjectorType())
+	if err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if lag != 8 {
+		t.Error("the lag should be the head position:", lag)
+	}
+
+	t.Log("advance the checkpoint")
+	if err := handler.HandleEvent(ctx, store.Events[0]); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if checkpoints.positions["TestProjector"] != "3" {
+		t.Error("the checkpoint should be saved:", checkpoints.positions)
+	}
+	if lag, err = ProjectionLag(ctx, checkpoints, head, projector.ProjectorType()); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if lag != 5 {
+		t.Error("the lag should be correct:", lag)
+	}
+
+	t.Log("advance the checkpoint with a batch")
+	if err := handler.HandleEvents(ctx, store.Events[1:]); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if checkpoints.positions["TestProjector"] != "8" {
+		t.Error("the checkpoint should be the last position:", checkpoints.positions)
+	}
+	if lag, err = ProjectionLag(ctx, checkpoints, head, projector.ProjectorType()); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if lag != 0 {
+		t.Error("the projection should be up to date:", lag)
+	}
+
+	t.Log("events without a position keep the checkpoint")
+	event4 := agg.NewEvent(TestEventType, &TestEventData{"event4"})
+	agg.ApplyEvent(ctx, event4)
+	if err := handler.HandleEvent(ctx, event4); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if checkpoints.positions["TestProjector"] != "8" {
+		t.Error("the checkpoint should not change:", checkpoints.positions)
+	}
+
+	t.Log("keep the checkpoint when projecting fails")
+	projector.err = errors.New("projector error")
+	event5 := agg.NewEvent(TestEventType, &TestEventData{"event5"})
+	agg.ApplyEvent(ctx, event5)
+	if err := handler.HandleEvent(ctx, positionedEvent{event5, 9}); !errors.Is(err, ErrCouldNotProjectEvent) {
+		t.Error("there should be a project error:", err)
+	}
+	if checkpoints.positions["TestProjector"] != "8" {
+		t.Error("the checkpoint should not change:", checkpoints.positions)
+	}
+
+	t.Log("fail to save the checkpoint")
+	projector.err = nil
+	checkpoints.err = errors.New("checkpoint error")
+	if err := handler.HandleEvent(ctx, positionedEvent{event5, 9}); !errors.Is(err, ErrCouldNotSaveCheckpoint) {
+		t.Error("there should be a save checkpoint error:", err)
+	}
+}
+
+func TestProjectionLagErrors(t *testing.T) {
+	ctx := context.Background()
+
+	checkpoints := &MockCheckpointStore{
+		positions: map[string]string{},
+	}
+	store := &MockHeadPositioner{}
+
+	t.Log("fail to load the checkpoint")
+	checkpoints.err = errors.New("checkpoint error")
+	if _, err := ProjectionLag(ctx, checkpoints, store, "TestProjector"); !errors.Is(err, ErrCouldNotLoadCheckpoint) {
+		t.Error("there should be a load checkpoint error:", err)
+	}
+
+	t.Log("invalid checkpoint")
+	checkpoints.err = nil
+	checkpoints.positions["TestProjector"] = "invalid"
+	if _, err := ProjectionLag(ctx, checkpoints, store, "TestProjector"); !errors.Is(err, ErrInvalidPosition) {
+		t.Error("there should be an invalid position error:", err)
+	}
+
+	t.Log("fail to replay events")
+	checkpoints.positions["TestProjector"] = "1"
+	store.err = errors.New("store error")
+	if _, err := ProjectionLag(ctx, checkpoints, store, "TestProjector"); err != store.err {
+		t.Error("there should be a store error:", err)
+	}
+}
+
+// MockHeadPositioner is a mocked HeadPositioner.
+type MockHeadPositioner struct {
+	position int64
+	err      error
+}
+
+func (m *MockHeadPositioner) HeadPosition(ctx context.Context) (int64, error) {
+	return m.position, m.err
+}
+
+// positionedEvent is an event with a global position, as loaded from a store.
+type positionedEvent struct {
+	Event
+	position int64
+}
+
+func (e positionedEvent) GlobalPosition() int64 {
+	return e.position
+}
+
+// MockCheckpointStore is a checkpoint store that keeps the positions in a map.
+type MockCheckpointStore struct {
+	positions map[string]string
+	// Used to simulate errors in the store.
+	err error
+}
+
+func (m *MockCheckpointStore) LoadCheckpoint(ctx context.Context, consumer string) (string, error) {
+	if m.err != nil {
+		return "", m.err
+	}
+	return m.positions[consumer], nil
+}
+
+func (m *MockCheckpointStore) SaveCheckpoint(ctx context.Context, consumer, position string) error {
+	if m.err != nil {
+		return m.err
+	}
+	m.positions[consumer] = position
+	return nil
+}
+
+type TestModel struct {
+	Content string
+	Version int
+}
+
+func (m *TestModel) AggregateVersion() int {
+	return m.Version
+}
+
+// MockVersionedReadRepository is a read repository that supports versioned
+// saves, recording the expected versions.
+type MockVersionedReadRepository struct {
+	MockReadRepository
+	expectedVersions []int
+	mismatch         bool
+}
+
+func (m *MockVersionedReadRepository) SaveVersioned(ctx context.Context, id UUID, model Versionable, expectedVersion int) error {
+	m.expectedVersions = append(m.expectedVersions, expectedVersion)
+	if m.mismatch {
+		return ReadRepositoryError{Err: ErrModelVersionMismatch}
+	}
+	return m.MockReadRepository.Save(ctx, id, model)
+}
+
+type TestProjector struct {
+	model interface{}
+	err   error
+}
+
+func (p *TestProjector) ProjectorType() ProjectorType {
+	return "TestProjector"
+}
+
+func (p *TestProjector) Project(ctx context.Context, event Event, model interface{}) (interface{}, error) {
+	p.model = model
+	if p.err != nil {
+		return nil, p.err
+	}
+
+	switch event.EventType() {
+	case TestEventType:
+		data, _ := event.Data().(*TestEventData)
+		return &TestModel{data.Content, event.Version()}, nil
+	case TestEvent2Type:
+		// Remove the model.
+		return nil, nil
+	}
+	return model, nil
+}
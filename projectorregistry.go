@@ -0,0 +1,179 @@
+// Copyright (c) 2016 - Max Ekman <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package eventhorizon
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// ErrProjectorAlreadyRegistered is when a projector is registered twice.
+var ErrProjectorAlreadyRegistered = errors.New("projector already registered")
+
+// ErrProjectorNotRegistered is when a projector is not registered.
+var ErrProjectorNotRegistered = errors.New("projector not registered")
+
+// ProjectorRegistry is an event handler that dispatches events to many
+// registered projectors, each keeping the read models in its own repository,
+// to add all projectors to an event bus at once. Projectors are registered
+// with the event types that they project and can be disabled and enabled
+// again while events are handled.
+type ProjectorRegistry struct {
+	handlerType EventHandlerType
+
+	mu         sync.RWMutex
+	projectors []*registeredProjector
+}
+
+// registeredProjector is a projector with its settings in a registry.
+type registeredProjector struct {
+	handler    *ProjectorHandler
+	eventTypes map[EventType]bool
+	enabled    bool
+}
+
+// NewProjectorRegistry creates a new ProjectorRegistry, handling events as the
+// handler type.
+func NewProjectorRegistry(handlerType EventHandlerType) *ProjectorRegistry {
+	return &ProjectorRegistry{
+		handlerType: handlerType,
+	}
+}
+
+// Register registers an enabled projector with the read repository of its
+// models, to project the events of the event types, or all events if there
+// are no event types. Returns ErrProjectorAlreadyRegistered if a projector of
+// the same type is already registered.
+func (r *ProjectorRegistry) Register(projector Projector, repository ReadRepository, eventTypes ...EventType) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.find(projector.ProjectorType()) != nil {
+		return ErrProjectorAlreadyRegistered
+	}
+
+	p := &registeredProjector{
+		handler: NewProjectorHandler(projector, repository),
+		enabled: true,
+	}
+	if len(eventTypes) > 0 {
+		p.eventTypes = make(map[EventType]bool, len(eventTypes))
+		for _, t := range eventTypes {
+			p.eventTypes[t] = true
+		}
+	}
+	r.projectors = append(r.projectors, p)
+
+	return nil
+}
+
+// Enable enables a projector to project events again after being disabled.
+// Returns ErrProjectorNotRegistered if the projector is not registered.
+func (r *ProjectorRegistry) Enable(projectorType ProjectorType) error {
+	return r.setEnabled(projectorType, true)
+}
+
+// Disable disables a projector, which then skips all events until it is
+// enabled again. Events that are already being handled are still projected.
+// Returns ErrProjectorNotRegistered if the projector is not registered.
+func (r *ProjectorRegistry) Disable(projectorType ProjectorType) error {
+	return r.setEnabled(projectorType, false)
+}
+
+// IsEnabled returns if a projector is registered and enabled.
+func (r *ProjectorRegistry) IsEnabled(projectorType ProjectorType) bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	p := r.find(projectorType)
+	return p != nil && p.enabled
+}
+
+// Matcher returns a matcher for the events that any enabled projector
+// projects, to add the registry to an event bus. The matcher follows the
+// projectors that are registered, enabled or disabled later.
+func (r *ProjectorRegistry) Matcher() EventMatcher {
+	return func(e Event) bool {
+		r.mu.RLock()
+		defer r.mu.RUnlock()
+
+		for _, p := range r.projectors {
+			if p.matches(e) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// HandlerType implements the HandlerType method of the EventHandler interface.
+func (r *ProjectorRegistry) HandlerType() EventHandlerType {
+	return r.handlerType
+}
+
+// HandleEvent implements the HandleEvent method of the EventHandler interface.
+// The event is projected by all enabled projectors of its event type, in the
+// order they were registered, also if some of them fail. The errors for the
+// projectors are prefixed with their types and joined with errors.Join.
+func (r *ProjectorRegistry) HandleEvent(ctx context.Context, event Event) error {
+	r.mu.RLock()
+	handlers := []*ProjectorHandler{}
+	for _, p := range r.projectors {
+		if p.matches(event) {
+			handlers = append(handlers, p.handler)
+		}
+	}
+	r.mu.RUnlock()
+
+	var errs []error
+	for _, h := range handlers {
+		if err := h.HandleEvent(ctx, event); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", h.projector.ProjectorType(), err))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+func (r *ProjectorRegistry) setEnabled(projectorType ProjectorType, enabled bool) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	p := r.find(projectorType)
+	if p == nil {
+		return ErrProjectorNotRegistered
+	}
+	p.enabled = enabled
+
+	return nil
+}
+
+// find returns the registered projector of a type, or nil. The lock must be
+// held.
+func (r *ProjectorRegistry) find(projectorType ProjectorType) *registeredProjector {
+	for _, p := range r.projectors {
+		if p.handler.projector.ProjectorType() == projectorType {
+			return p
+		}
+	}
+	return nil
+}
+
+// matches returns if the projector is enabled and projects the event.
+func (p *registeredProjector) matches(e Event) bool {
+	return p.enabled && (p.eventTypes == nil || p.eventTypes[e.EventType()])
+}
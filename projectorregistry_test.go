@@ -0,0 +1,204 @@
+// Copyright (c) 2016 - Max Ekman <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package eventhorizon
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestProjectorRegistry(t *testing.T) {
+	registry := NewProjectorRegistry("projectors")
+	if registry.HandlerType() != "projectors" {
+		t.Error("the handler type should be correct:", registry.HandlerType())
+	}
+
+	repo1 := &MockReadRepository{Models: map[UUID]interface{}{}}
+	repo2 := &MockReadRepository{Models: map[UUID]interface{}{}}
+	projector1 := &namedTestProjector{name: "projector1"}
+	projector2 := &namedTestProjector{name: "projector2"}
+	if err := registry.Register(projector1, repo1, TestEventType, TestEvent2Type); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if err := registry.Register(projector2, repo2, TestEventType); err != nil {
+		t.Error("there should be no error:", err)
+	}
+
+	ctx := context.Background()
+	id := NewUUID()
+	agg := NewTestAggregate(id)
+	matcher := registry.Matcher()
+
+	t.Log("project an event of both projectors")
+	event1 := agg.NewEvent(TestEventType, &TestEventData{"event1"})
+	agg.ApplyEvent(ctx, event1)
+	if !matcher(event1) {
+		t.Error("the matcher should match the event")
+	}
+	if err := registry.HandleEvent(ctx, event1); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if !reflect.DeepEqual(repo1.Models[id], &TestModel{"event1", 1}) {
+		t.Error("the model should be projected by the first projector:", repo1.Models[id])
+	}
+	if !reflect.DeepEqual(repo2.Models[id], &TestModel{"event1", 1}) {
+		t.Error("the model should be projected by the second projector:", repo2.Models[id])
+	}
+
+	t.Log("project an event of one projector")
+	event2 := agg.NewEvent(TestEvent2Type, &TestEvent2Data{"deleted"})
+	agg.ApplyEvent(ctx, event2)
+	if !matcher(event2) {
+		t.Error("the matcher should match the event")
+	}
+	if err := registry.HandleEvent(ctx, event2); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if _, ok := repo1.Models[id]; ok {
+		t.Error("the model should be removed by the first projector:", repo1.Models[id])
+	}
+	if !reflect.DeepEqual(repo2.Models[id], &TestModel{"event1", 1}) {
+		t.Error("the model should be kept by the second projector:", repo2.Models[id])
+	}
+
+	t.Log("skip the events of a disabled projector")
+	if err := registry.Disable("projector1"); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if registry.IsEnabled("projector1") {
+		t.Error("the projector should be disabled")
+	}
+	if matcher(event2) {
+		t.Error("the matcher should not match the event")
+	}
+	event3 := agg.NewEvent(TestEventType, &TestEventData{"event3"})
+	agg.ApplyEvent(ctx, event3)
+	if err := registry.HandleEvent(ctx, event3); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if _, ok := repo1.Models[id]; ok {
+		t.Error("the model should not be projected by the disabled projector:", repo1.Models[id])
+	}
+	if !reflect.DeepEqual(repo2.Models[id], &TestModel{"event3", 3}) {
+		t.Error("the model should be projected by the second projector:", repo2.Models[id])
+	}
+
+	t.Log("project events again when enabled")
+	if err := registry.Enable("projector1"); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if !registry.IsEnabled("projector1") {
+		t.Error("the projector should be enabled")
+	}
+	if !matcher(event2) {
+		t.Error("the matcher should match the event")
+	}
+	event4 := agg.NewEvent(TestEventType, &TestEventData{"event4"})
+	agg.ApplyEvent(ctx, event4)
+	if err := registry.HandleEvent(ctx, event4); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if !reflect.DeepEqual(repo1.Models[id], &TestModel{"event4", 4}) {
+		t.Error("the model should be projected by the first projector:", repo1.Models[id])
+	}
+
+	t.Log("match no events of unregistered event types")
+	event5 := NewEvent("OtherEvent", nil)
+	if matcher(event5) {
+		t.Error("the matcher should not match the event")
+	}
+	if err := registry.HandleEvent(ctx, event5); err != nil {
+		t.Error("there should be no error:", err)
+	}
+}
+
+func TestProjectorRegistryAllEvents(t *testing.T) {
+	registry := NewProjectorRegistry("projectors")
+	repo := &MockReadRepository{Models: map[UUID]interface{}{}}
+	if err := registry.Register(&namedTestProjector{name: "projector"}, repo); err != nil {
+		t.Error("there should be no error:", err)
+	}
+
+	t.Log("project all events without event types")
+	agg := NewTestAggregate(NewUUID())
+	event := agg.NewEvent("OtherEvent", nil)
+	if !registry.Matcher()(event) {
+		t.Error("the matcher should match the event")
+	}
+	if err := registry.HandleEvent(context.Background(), event); err != nil {
+		t.Error("there should be no error:", err)
+	}
+}
+
+func TestProjectorRegistryErrors(t *testing.T) {
+	registry := NewProjectorRegistry("projectors")
+	repoErr := errors.New("repo error")
+	repo1 := &MockReadRepository{Models: map[UUID]interface{}{}, Err: repoErr}
+	repo2 := &MockReadRepository{Models: map[UUID]interface{}{}}
+	if err := registry.Register(&namedTestProjector{name: "projector1"}, repo1, TestEventType); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if err := registry.Register(&namedTestProjector{name: "projector2"}, repo2, TestEventType); err != nil {
+		t.Error("there should be no error:", err)
+	}
+
+	t.Log("register a projector twice")
+	if err := registry.Register(&namedTestProjector{name: "projector1"}, repo2); err != ErrProjectorAlreadyRegistered {
+		t.Error("there should be a ErrProjectorAlreadyRegistered error:", err)
+	}
+
+	t.Log("enable and disable a projector that is not registered")
+	if err := registry.Enable("other"); err != ErrProjectorNotRegistered {
+		t.Error("there should be a ErrProjectorNotRegistered error:", err)
+	}
+	if err := registry.Disable("other"); err != ErrProjectorNotRegistered {
+		t.Error("there should be a ErrProjectorNotRegistered error:", err)
+	}
+	if registry.IsEnabled("other") {
+		t.Error("the projector should not be enabled")
+	}
+
+	t.Log("project with the other projectors when one fails")
+	ctx := context.Background()
+	id := NewUUID()
+	event := NewTestAggregate(id).NewEvent(TestEventType, &TestEventData{"event1"})
+	err := registry.HandleEvent(ctx, event)
+	joined, ok := err.(interface{ Unwrap() []error })
+	if !ok {
+		t.Fatal("there should be joined projector errors:", err)
+	}
+	if len(joined.Unwrap()) != 1 || !strings.HasPrefix(err.Error(), "projector1: ") {
+		t.Error("the error should be for the failing projector:", err)
+	}
+	if !errors.Is(err, repoErr) {
+		t.Error("the error should match the repo error:", err)
+	}
+	if !reflect.DeepEqual(repo2.Models[id], &TestModel{"event1", 1}) {
+		t.Error("the model should be projected by the other projector:", repo2.Models[id])
+	}
+}
+
+// namedTestProjector is a TestProjector with another projector type.
+type namedTestProjector struct {
+	TestProjector
+	name ProjectorType
+}
+
+func (p *namedTestProjector) ProjectorType() ProjectorType {
+	return p.name
+}
@@ -16,6 +16,7 @@ package eventhorizon
 
 import (
 	"context"
+	"encoding/base64"
 	"errors"
 )
 
@@ -38,12 +39,62 @@ func (e ReadRepositoryError) Error() string {
 	return errStr + " (" + e.Namespace + ")"
 }
 
+// Unwrap returns the error, so that it can be matched with errors.Is and
+// errors.As.
+func (e ReadRepositoryError) Unwrap() error {
+	return e.Err
+}
+
+// Is reports whether the base error matches the target, as errors.Is only
+// follows the error returned by Unwrap.
+func (e ReadRepositoryError) Is(target error) bool {
+	return e.BaseErr != nil && errors.Is(e.BaseErr, target)
+}
+
+// As finds the first error in the base error that matches the target.
+func (e ReadRepositoryError) As(target interface{}) bool {
+	return e.BaseErr != nil && errors.As(e.BaseErr, target)
+}
+
 // ErrCouldNotSaveModel is when a model could not be found.
 var ErrCouldNotSaveModel = errors.New("could not save model")
 
 // ErrModelNotFound is when a model could not be found.
 var ErrModelNotFound = errors.New("could not find model")
 
+// ErrInvalidPage is when the offset or limit for a page of models is invalid.
+var ErrInvalidPage = errors.New("invalid page")
+
+// ErrClearNotSupported is when a read repository can not be cleared.
+var ErrClearNotSupported = errors.New("clear not supported")
+
+// ErrModelVersionMismatch is when a read model was not saved because the saved
+// model does not have the expected version.
+var ErrModelVersionMismatch = errors.New("model version mismatch")
+
+// ErrInvalidCursor is when a cursor for a page of models is invalid.
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// EncodeCursor encodes the id of the last model on a page as an opaque cursor,
+// used to find the models after it.
+func EncodeCursor(id UUID) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(id))
+}
+
+// DecodeCursor decodes the id of the last model on a page from a cursor
+// created by EncodeCursor. Returns ErrInvalidCursor if the cursor is not valid.
+func DecodeCursor(cursor string) (UUID, error) {
+	b, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return UUID(""), ErrInvalidCursor
+	}
+	id, err := ParseUUID(string(b))
+	if err != nil {
+		return UUID(""), ErrInvalidCursor
+	}
+	return id, nil
+}
+
 // ReadRepository is a storage for read models.
 type ReadRepository interface {
 	// Parent returns the parent read repository, if there is one.
@@ -62,3 +113,28 @@ type ReadRepository interface {
 	// Remove removes a read model with id from the repository.
 	Remove(context.Context, UUID) error
 }
+
+// ReadRepositoryClearer is an optional interface for read repositories that
+// can remove all read models, for example before rebuilding a projection.
+type ReadRepositoryClearer interface {
+	// Clear removes all read models in the namespace of the context.
+	Clear(context.Context) error
+}
+
+// Versionable is a read model that has a version number saved, usually the
+// version of the aggregate that it represents.
+type Versionable interface {
+	// AggregateVersion returns the aggregate version that a read model represents.
+	AggregateVersion() int
+}
+
+// ReadRepositoryVersionedSaver is an optional interface for read repositories
+// that can save read models with optimistic concurrency, to not overwrite the
+// changes of concurrent writers.
+type ReadRepositoryVersionedSaver interface {
+	// SaveVersioned saves a read model with id to the repository if the saved
+	// model has the expected version, where 0 is used for a new model. Returns
+	// ErrModelVersionMismatch if the saved model has another version, for
+	// example after a concurrent save.
+	SaveVersioned(ctx context.Context, id UUID, model Versionable, expectedVersion int) error
+}
@@ -0,0 +1,233 @@
+// Copyright (c) 2016 - Max Ekman <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cache
+
+import (
+	"container/list"
+	"context"
+	"sync"
+	"time"
+
+	eh "github.com/looplab/eventhorizon"
+)
+
+// ReadRepository is a middleware that caches the models found in a read
+// repository in memory, evicting the least recently used models when the
+// cache is full. Models are removed from the cache when they are saved or
+// removed through the repository. Cached models are returned as is, and should
+// not be modified by the caller.
+type ReadRepository struct {
+	eh.ReadRepository
+
+	size int
+	ttl  time.Duration
+	now  func() time.Time
+
+	mu      sync.Mutex
+	entries map[key]*list.Element
+	lru     *list.List
+	// generation is incremented on every invalidation, so that models loaded
+	// concurrently with a save are not cached.
+	generation uint64
+	hits       uint64
+	misses     uint64
+}
+
+// Option is an option setter used to configure creation.
+type Option func(*ReadRepository)
+
+// WithTTL sets a time after which cached models are loaded again from the
+// wrapped repository. By default models are cached until evicted.
+func WithTTL(ttl time.Duration) Option {
+	return func(r *ReadRepository) {
+		r.ttl = ttl
+	}
+}
+
+// NewReadRepository creates a new ReadRepository that caches at most size
+// models, a size of 0 or less does not limit the number of cached models.
+func NewReadRepository(repo eh.ReadRepository, size int, opts ...Option) *ReadRepository {
+	r := &ReadRepository{
+		ReadRepository: repo,
+		size:           size,
+		now:            time.Now,
+		entries:        map[key]*list.Element{},
+		lru:            list.New(),
+	}
+
+	for _, opt := range opts {
+		opt(r)
+	}
+
+	return r
+}
+
+// Parent implements the Parent method of the eventhorizon.ReadRepository interface.
+func (r *ReadRepository) Parent() eh.ReadRepository {
+	return r.ReadRepository
+}
+
+// Find implements the Find method of the eventhorizon.ReadRepository
+// interface. Models are returned from the cache if they are there, otherwise
+// they are found in the wrapped repository and cached. Errors are not cached.
+func (r *ReadRepository) Find(ctx context.Context, id eh.UUID) (interface{}, error) {
+	k := key{namespace: eh.Namespace(ctx), id: id}
+
+	r.mu.Lock()
+	if elem, ok := r.entries[k]; ok {
+		e := elem.Value.(*entry)
+		if r.ttl <= 0 || r.now().Before(e.expires) {
+			r.lru.MoveToFront(elem)
+			r.hits++
+			r.mu.Unlock()
+			return e.model, nil
+		}
+		r.remove(elem)
+	}
+	r.misses++
+	generation := r.generation
+	r.mu.Unlock()
+
+	model, err := r.ReadRepository.Find(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	// Don't cache a model that may have been changed while finding it.
+	if r.generation != generation {
+		return model, nil
+	}
+	if elem, ok := r.entries[k]; ok {
+		r.remove(elem)
+	}
+	e := &entry{key: k, model: model}
+	if r.ttl > 0 {
+		e.expires = r.now().Add(r.ttl)
+	}
+	r.entries[k] = r.lru.PushFront(e)
+	if r.size > 0 && r.lru.Len() > r.size {
+		r.remove(r.lru.Back())
+	}
+
+	return model, nil
+}
+
+// Save implements the Save method of the eventhorizon.ReadRepository
+// interface, removing the model from the cache.
+func (r *ReadRepository) Save(ctx context.Context, id eh.UUID, model interface{}) error {
+	defer r.invalidate(ctx, id)
+	return r.ReadRepository.Save(ctx, id, model)
+}
+
+// Remove implements the Remove method of the eventhorizon.ReadRepository
+// interface, removing the model from the cache.
+func (r *ReadRepository) Remove(ctx context.Context, id eh.UUID) error {
+	defer r.invalidate(ctx, id)
+	return r.ReadRepository.Remove(ctx, id)
+}
+
+// Clear implements the Clear method of the eventhorizon.ReadRepositoryClearer
+// interface, by clearing the first wrapped repository that can be cleared and
+// all cached models. Returns ErrClearNotSupported if no wrapped repository
+// can be cleared.
+func (r *ReadRepository) Clear(ctx context.Context) error {
+	for repo := r.ReadRepository; repo != nil; repo = repo.Parent() {
+		if clearer, ok := repo.(eh.ReadRepositoryClearer); ok {
+			defer r.purge()
+			return clearer.Clear(ctx)
+		}
+	}
+
+	return eh.ErrClearNotSupported
+}
+
+// Hits returns the number of models found in the cache.
+func (r *ReadRepository) Hits() uint64 {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.hits
+}
+
+// Misses returns the number of models not found in the cache.
+func (r *ReadRepository) Misses() uint64 {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.misses
+}
+
+// Len returns the number of cached models.
+func (r *ReadRepository) Len() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.lru.Len()
+}
+
+// invalidate removes a model from the cache.
+func (r *ReadRepository) invalidate(ctx context.Context, id eh.UUID) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.generation++
+	if elem, ok := r.entries[key{namespace: eh.Namespace(ctx), id: id}]; ok {
+		r.remove(elem)
+	}
+}
+
+// purge removes all models from the cache.
+func (r *ReadRepository) purge() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.generation++
+	r.entries = map[key]*list.Element{}
+	r.lru.Init()
+}
+
+// remove removes an element from the cache, the lock must be held.
+func (r *ReadRepository) remove(elem *list.Element) {
+	r.lru.Remove(elem)
+	delete(r.entries, elem.Value.(*entry).key)
+}
+
+// Repository returns a parent ReadRepository if there is one.
+func Repository(repo eh.ReadRepository) *ReadRepository {
+	if repo == nil {
+		return nil
+	}
+
+	if r, ok := repo.(*ReadRepository); ok {
+		return r
+	}
+
+	return Repository(repo.Parent())
+}
+
+// key is the key of a cached model, as ids are only unique per namespace.
+type key struct {
+	namespace string
+	id        eh.UUID
+}
+
+type entry struct {
+	key     key
+	model   interface{}
+	expires time.Time
+}
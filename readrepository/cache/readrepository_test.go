@@ -0,0 +1,222 @@
+// Copyright (c) 2016 - Max Ekman <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cache
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	eh "github.com/looplab/eventhorizon"
+	"github.com/looplab/eventhorizon/mocks"
+	"github.com/looplab/eventhorizon/readrepository/memory"
+	"github.com/looplab/eventhorizon/readrepository/testutil"
+)
+
+func TestReadRepository(t *testing.T) {
+	memoryRepo := memory.NewReadRepository()
+	repo := NewReadRepository(memoryRepo, 10)
+	if repo == nil {
+		t.Error("there should be a repository")
+	}
+
+	// Run the actual test suite.
+
+	t.Log("read repository with default namespace")
+	testutil.ReadRepositoryCommonTests(t, context.Background(), repo)
+
+	t.Log("read repository with other namespace")
+	ctx := eh.WithNamespace(context.Background(), "ns")
+	testutil.ReadRepositoryCommonTests(t, ctx, repo)
+
+	if parent := repo.Parent(); parent != memoryRepo {
+		t.Error("the parent repo should be correct:", parent)
+	}
+	if r := Repository(repo); r != repo {
+		t.Error("the cache repository should be found:", r)
+	}
+}
+
+func TestReadRepositoryCaching(t *testing.T) {
+	base := &countingRepository{ReadRepository: memory.NewReadRepository()}
+	repo := NewReadRepository(base, 2)
+	ctx := context.Background()
+
+	model := &mocks.Model{ID: eh.NewUUID(), Content: "model"}
+	if err := repo.Save(ctx, model.ID, model); err != nil {
+		t.Error("there should be no error:", err)
+	}
+
+	t.Log("find a model twice")
+	for i := 0; i < 2; i++ {
+		m, err := repo.Find(ctx, model.ID)
+		if err != nil {
+			t.Error("there should be no error:", err)
+		}
+		if m != model {
+			t.Error("the model should be correct:", m)
+		}
+	}
+	if base.finds != 1 {
+		t.Error("the second find should hit the cache:", base.finds)
+	}
+	if repo.Hits() != 1 || repo.Misses() != 1 {
+		t.Error("there should be one hit and one miss:", repo.Hits(), repo.Misses())
+	}
+
+	t.Log("find a model in another namespace")
+	if _, err := repo.Find(eh.WithNamespace(ctx, "ns"), model.ID); err == nil {
+		t.Error("there should be an error")
+	}
+	if base.finds != 2 {
+		t.Error("the model should not be cached for another namespace:", base.finds)
+	}
+
+	t.Log("find a model after saving it")
+	updated := &mocks.Model{ID: model.ID, Content: "updated"}
+	if err := repo.Save(ctx, model.ID, updated); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	m, err := repo.Find(ctx, model.ID)
+	if err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if m != updated || base.finds != 3 {
+		t.Error("the saved model should be found in the base repository:", m, base.finds)
+	}
+
+	t.Log("find a model after removing it")
+	if err := repo.Remove(ctx, model.ID); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if _, err := repo.Find(ctx, model.ID); err == nil {
+		t.Error("there should be an error")
+	}
+
+	t.Log("evict the least recently used model")
+	ids := []eh.UUID{eh.NewUUID(), eh.NewUUID(), eh.NewUUID()}
+	for _, id := range ids {
+		if err := repo.Save(ctx, id, &mocks.Model{ID: id}); err != nil {
+			t.Error("there should be no error:", err)
+		}
+		if _, err := repo.Find(ctx, id); err != nil {
+			t.Error("there should be no error:", err)
+		}
+	}
+	if repo.Len() != 2 {
+		t.Error("there should be two cached models:", repo.Len())
+	}
+	finds := base.finds
+	if _, err := repo.Find(ctx, ids[2]); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if _, err := repo.Find(ctx, ids[0]); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if base.finds != finds+1 {
+		t.Error("only the first model should be evicted:", base.finds-finds)
+	}
+
+	t.Log("clear the cache with the base repository")
+	if err := repo.Clear(ctx); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if repo.Len() != 0 {
+		t.Error("there should be no cached models:", repo.Len())
+	}
+}
+
+func TestReadRepositoryTTL(t *testing.T) {
+	base := &countingRepository{ReadRepository: memory.NewReadRepository()}
+	repo := NewReadRepository(base, 0, WithTTL(time.Minute))
+	now := time.Now()
+	repo.now = func() time.Time { return now }
+	ctx := context.Background()
+
+	model := &mocks.Model{ID: eh.NewUUID(), Content: "model"}
+	if err := repo.Save(ctx, model.ID, model); err != nil {
+		t.Error("there should be no error:", err)
+	}
+
+	t.Log("find a model before it expires")
+	repo.Find(ctx, model.ID)
+	now = now.Add(30 * time.Second)
+	repo.Find(ctx, model.ID)
+	if base.finds != 1 {
+		t.Error("the model should be cached:", base.finds)
+	}
+
+	t.Log("find a model after it expires")
+	now = now.Add(time.Minute)
+	repo.Find(ctx, model.ID)
+	if base.finds != 2 {
+		t.Error("the model should be found again:", base.finds)
+	}
+}
+
+func TestReadRepositoryConcurrency(t *testing.T) {
+	repo := NewReadRepository(memory.NewReadRepository(), 8)
+	ctx := context.Background()
+
+	ids := make([]eh.UUID, 16)
+	for i := range ids {
+		ids[i] = eh.NewUUID()
+		if err := repo.Save(ctx, ids[i], &mocks.Model{ID: ids[i]}); err != nil {
+			t.Error("there should be no error:", err)
+		}
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				id := ids[(i+j)%len(ids)]
+				if j%10 == 0 {
+					repo.Save(ctx, id, &mocks.Model{ID: id, Content: "updated"})
+					continue
+				}
+				if _, err := repo.Find(ctx, id); err != nil {
+					t.Error("there should be no error:", err)
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	if repo.Len() > 8 {
+		t.Error("there should be at most 8 cached models:", repo.Len())
+	}
+	if repo.Hits()+repo.Misses() != 8*90 {
+		t.Error("all finds should be counted:", repo.Hits(), repo.Misses())
+	}
+}
+
+// countingRepository counts the finds of the wrapped repository.
+type countingRepository struct {
+	eh.ReadRepository
+	finds int
+}
+
+func (r *countingRepository) Find(ctx context.Context, id eh.UUID) (interface{}, error) {
+	r.finds++
+	return r.ReadRepository.Find(ctx, id)
+}
+
+func (r *countingRepository) Parent() eh.ReadRepository {
+	return r.ReadRepository
+}
@@ -16,6 +16,7 @@ package memory
 
 import (
 	"context"
+	"sort"
 	"sync"
 
 	eh "github.com/looplab/eventhorizon"
@@ -62,6 +63,36 @@ func (r *ReadRepository) Save(ctx context.Context, id eh.UUID, model interface{}
 	return nil
 }
 
+// SaveVersioned implements the SaveVersioned method of the
+// eventhorizon.ReadRepositoryVersionedSaver interface. A saved model without
+// a version has version 0.
+func (r *ReadRepository) SaveVersioned(ctx context.Context, id eh.UUID, model eh.Versionable, expectedVersion int) error {
+	ns := r.namespace(ctx)
+
+	r.dbMu.Lock()
+	defer r.dbMu.Unlock()
+
+	saved, exists := r.db[ns][id]
+	version := 0
+	if v, ok := saved.(eh.Versionable); ok {
+		version = v.AggregateVersion()
+	}
+	if version != expectedVersion {
+		return eh.ReadRepositoryError{
+			Err:       eh.ErrModelVersionMismatch,
+			Namespace: eh.Namespace(ctx),
+		}
+	}
+
+	if !exists {
+		r.ids[ns] = append(r.ids[ns], id)
+	}
+
+	r.db[ns][id] = model
+
+	return nil
+}
+
 // Find returns one read model with using an id. Returns
 // ErrModelNotFound if no model could be found.
 func (r *ReadRepository) Find(ctx context.Context, id eh.UUID) (interface{}, error) {
@@ -98,6 +129,105 @@ func (r *ReadRepository) FindAll(ctx context.Context) ([]interface{}, error) {
 	return all, nil
 }
 
+// FindAllPaged returns a page of read models in the repository, ordered by id
+// to not overlap between pages, and the total number of models. Returns
+// ErrInvalidPage if the offset is negative or the limit is not positive.
+func (r *ReadRepository) FindAllPaged(ctx context.Context, offset, limit int) ([]interface{}, int, error) {
+	if offset < 0 || limit < 1 {
+		return nil, 0, eh.ReadRepositoryError{
+			Err:       eh.ErrInvalidPage,
+			Namespace: eh.Namespace(ctx),
+		}
+	}
+
+	ns := r.namespace(ctx)
+
+	r.dbMu.RLock()
+	defer r.dbMu.RUnlock()
+
+	ids := make([]string, 0, len(r.db[ns]))
+	for id := range r.db[ns] {
+		ids = append(ids, string(id))
+	}
+	sort.Strings(ids)
+
+	page := []interface{}{}
+	for i := offset; i < len(ids) && i < offset+limit; i++ {
+		page = append(page, r.db[ns][eh.UUID(ids[i])])
+	}
+
+	return page, len(ids), nil
+}
+
+// FindAfter returns a page of read models in the repository after the model
+// in the cursor, ordered by id, and the cursor of the next page. The next
+// cursor is empty after the last page, and an empty cursor finds the first
+// page. Returns ErrInvalidPage if the limit is not positive and
+// ErrInvalidCursor if the cursor is not valid.
+func (r *ReadRepository) FindAfter(ctx context.Context, cursor string, limit int) ([]interface{}, string, error) {
+	if limit < 1 {
+		return nil, "", eh.ReadRepositoryError{
+			Err:       eh.ErrInvalidPage,
+			Namespace: eh.Namespace(ctx),
+		}
+	}
+
+	var after eh.UUID
+	if cursor != "" {
+		var err error
+		if after, err = eh.DecodeCursor(cursor); err != nil {
+			return nil, "", eh.ReadRepositoryError{
+				Err:       err,
+				Namespace: eh.Namespace(ctx),
+			}
+		}
+	}
+
+	ns := r.namespace(ctx)
+
+	r.dbMu.RLock()
+	defer r.dbMu.RUnlock()
+
+	ids := make([]string, 0, len(r.db[ns]))
+	for id := range r.db[ns] {
+		if id > after {
+			ids = append(ids, string(id))
+		}
+	}
+	sort.Strings(ids)
+
+	page := []interface{}{}
+	for i := 0; i < len(ids) && i < limit; i++ {
+		page = append(page, r.db[ns][eh.UUID(ids[i])])
+	}
+
+	// Only return a cursor if there are more models after the page.
+	next := ""
+	if len(ids) > limit {
+		next = eh.EncodeCursor(eh.UUID(ids[limit-1]))
+	}
+
+	return page, next, nil
+}
+
+// FindBy returns all read models in the repository that match the filter,
+// in the order they were first saved. No matching models is not an error.
+func (r *ReadRepository) FindBy(ctx context.Context, filter func(interface{}) bool) ([]interface{}, error) {
+	ns := r.namespace(ctx)
+
+	r.dbMu.RLock()
+	defer r.dbMu.RUnlock()
+
+	result := []interface{}{}
+	for _, id := range r.ids[ns] {
+		if m, ok := r.db[ns][id]; ok && filter(m) {
+			result = append(result, m)
+		}
+	}
+
+	return result, nil
+}
+
 // Remove removes a read model with id from the repository. Returns
 // ErrModelNotFound if no model could be found.
 func (r *ReadRepository) Remove(ctx context.Context, id eh.UUID) error {
@@ -127,6 +257,48 @@ func (r *ReadRepository) Remove(ctx context.Context, id eh.UUID) error {
 	}
 }
 
+// RemoveBy removes all read models in the repository that match the filter.
+// The models are removed at once, so concurrent finds see either all or none
+// of them. No matching models is not an error.
+func (r *ReadRepository) RemoveBy(ctx context.Context, filter func(interface{}) bool) error {
+	ns := r.namespace(ctx)
+
+	r.dbMu.Lock()
+	defer r.dbMu.Unlock()
+
+	ids := r.ids[ns][:0]
+	for _, id := range r.ids[ns] {
+		if filter(r.db[ns][id]) {
+			delete(r.db[ns], id)
+		} else {
+			ids = append(ids, id)
+		}
+	}
+	r.ids[ns] = ids
+
+	return nil
+}
+
+// RemoveAll removes all read models in the repository, for example before
+// rebuilding a projection. It is the same as Clear.
+func (r *ReadRepository) RemoveAll(ctx context.Context) error {
+	return r.Clear(ctx)
+}
+
+// Clear implements the Clear method of the
+// eventhorizon.ReadRepositoryClearer interface.
+func (r *ReadRepository) Clear(ctx context.Context) error {
+	ns := r.namespace(ctx)
+
+	r.dbMu.Lock()
+	defer r.dbMu.Unlock()
+
+	r.db[ns] = map[eh.UUID]interface{}{}
+	r.ids[ns] = []eh.UUID{}
+
+	return nil
+}
+
 // Helper to get the namespace and ensure that its data exists.
 func (r *ReadRepository) namespace(ctx context.Context) string {
 	r.dbMu.Lock()
@@ -16,6 +16,7 @@ package memory
 
 import (
 	"context"
+	"reflect"
 	"testing"
 
 	eh "github.com/looplab/eventhorizon"
@@ -43,6 +44,87 @@ func TestReadRepository(t *testing.T) {
 	}
 }
 
+func TestReadRepositoryPaged(t *testing.T) {
+	repo := NewReadRepository()
+	if repo == nil {
+		t.Fatal("there should be a repository")
+	}
+
+	t.Log("paged read repository with default namespace")
+	testutil.PagedReadRepositoryCommonTests(t, context.Background(), repo)
+
+	t.Log("paged read repository with other namespace")
+	ctx := eh.WithNamespace(context.Background(), "ns")
+	testutil.PagedReadRepositoryCommonTests(t, ctx, repo)
+}
+
+func TestReadRepositoryCursor(t *testing.T) {
+	repo := NewReadRepository()
+	if repo == nil {
+		t.Fatal("there should be a repository")
+	}
+
+	t.Log("cursor read repository with default namespace")
+	testutil.CursorReadRepositoryCommonTests(t, context.Background(), repo)
+
+	t.Log("cursor read repository with other namespace")
+	ctx := eh.WithNamespace(context.Background(), "ns")
+	testutil.CursorReadRepositoryCommonTests(t, ctx, repo)
+}
+
+func TestReadRepositoryVersioned(t *testing.T) {
+	repo := NewReadRepository()
+	if repo == nil {
+		t.Fatal("there should be a repository")
+	}
+
+	t.Log("versioned read repository with default namespace")
+	testutil.VersionedReadRepositoryCommonTests(t, context.Background(), repo)
+
+	t.Log("versioned read repository with other namespace")
+	ctx := eh.WithNamespace(context.Background(), "ns")
+	testutil.VersionedReadRepositoryCommonTests(t, ctx, repo)
+}
+
+func TestReadRepositoryClear(t *testing.T) {
+	repo := NewReadRepository()
+	if repo == nil {
+		t.Fatal("there should be a repository")
+	}
+
+	ctx := context.Background()
+	otherCtx := eh.WithNamespace(context.Background(), "ns")
+	id := eh.NewUUID()
+	model := &mocks.Model{ID: id, Content: "model"}
+	if err := repo.Save(ctx, id, model); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if err := repo.Save(otherCtx, id, model); err != nil {
+		t.Error("there should be no error:", err)
+	}
+
+	t.Log("clear the default namespace")
+	if err := repo.Clear(ctx); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	models, err := repo.FindAll(ctx)
+	if err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if len(models) != 0 {
+		t.Error("there should be no models:", models)
+	}
+
+	t.Log("keep the models in other namespaces")
+	models, err = repo.FindAll(otherCtx)
+	if err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if !reflect.DeepEqual(models, []interface{}{model}) {
+		t.Error("the models should be correct:", models)
+	}
+}
+
 func TestRepository(t *testing.T) {
 	if r := Repository(nil); r != nil {
 		t.Error("the parent repository should be nil:", r)
@@ -59,3 +141,157 @@ func TestRepository(t *testing.T) {
 		t.Error("the parent repository should be correct:", r)
 	}
 }
+
+func TestReadRepositoryFindBy(t *testing.T) {
+	repo := NewReadRepository()
+	if repo == nil {
+		t.Fatal("there should be a repository")
+	}
+
+	ctx := context.Background()
+
+	t.Log("save models")
+	model1 := &mocks.Model{ID: eh.NewUUID(), Content: "model1"}
+	model2 := &mocks.Model{ID: eh.NewUUID(), Content: "model2"}
+	model3 := &mocks.Model{ID: eh.NewUUID(), Content: "model1"}
+	for _, m := range []*mocks.Model{model1, model2, model3} {
+		if err := repo.Save(ctx, m.ID, m); err != nil {
+			t.Error("there should be no error:", err)
+		}
+	}
+
+	t.Log("find matching models")
+	result, err := repo.FindBy(ctx, func(m interface{}) bool {
+		model, ok := m.(*mocks.Model)
+		return ok && model.Content == "model1"
+	})
+	if err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if !reflect.DeepEqual(result, []interface{}{model1, model3}) {
+		t.Error("the models should be correct:", result)
+	}
+
+	t.Log("find no matching models")
+	result, err = repo.FindBy(ctx, func(m interface{}) bool {
+		return false
+	})
+	if err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if result == nil || len(result) != 0 {
+		t.Error("there should be no models:", result)
+	}
+
+	t.Log("find models in other namespace")
+	result, err = repo.FindBy(eh.WithNamespace(ctx, "other"), func(m interface{}) bool {
+		return true
+	})
+	if err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if len(result) != 0 {
+		t.Error("there should be no models:", result)
+	}
+}
+
+func TestReadRepositoryRemoveBy(t *testing.T) {
+	repo := NewReadRepository()
+	if repo == nil {
+		t.Fatal("there should be a repository")
+	}
+
+	ctx := context.Background()
+	otherCtx := eh.WithNamespace(context.Background(), "ns")
+
+	t.Log("save models")
+	model1 := &mocks.Model{ID: eh.NewUUID(), Content: "model1"}
+	model2 := &mocks.Model{ID: eh.NewUUID(), Content: "model2"}
+	model3 := &mocks.Model{ID: eh.NewUUID(), Content: "model1"}
+	for _, m := range []*mocks.Model{model1, model2, model3} {
+		if err := repo.Save(ctx, m.ID, m); err != nil {
+			t.Error("there should be no error:", err)
+		}
+	}
+	if err := repo.Save(otherCtx, model1.ID, model1); err != nil {
+		t.Error("there should be no error:", err)
+	}
+
+	t.Log("remove matching models")
+	if err := repo.RemoveBy(ctx, func(m interface{}) bool {
+		model, ok := m.(*mocks.Model)
+		return ok && model.Content == "model1"
+	}); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	models, err := repo.FindAll(ctx)
+	if err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if !reflect.DeepEqual(models, []interface{}{model2}) {
+		t.Error("the models should be correct:", models)
+	}
+
+	t.Log("remove all models")
+	if err := repo.RemoveAll(ctx); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	models, err = repo.FindAll(ctx)
+	if err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if len(models) != 0 {
+		t.Error("there should be no models:", models)
+	}
+
+	t.Log("keep the models in other namespaces")
+	models, err = repo.FindAll(otherCtx)
+	if err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if !reflect.DeepEqual(models, []interface{}{model1}) {
+		t.Error("the models should be correct:", models)
+	}
+}
+
+func TestReadRepositoryRemoveAllConcurrentFind(t *testing.T) {
+	repo := NewReadRepository()
+	if repo == nil {
+		t.Fatal("there should be a repository")
+	}
+
+	ctx := context.Background()
+	for i := 0; i < 100; i++ {
+		id := eh.NewUUID()
+		if err := repo.Save(ctx, id, &mocks.Model{ID: id, Content: "model"}); err != nil {
+			t.Error("there should be no error:", err)
+		}
+	}
+
+	t.Log("find all models while removing them")
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		if err := repo.RemoveAll(ctx); err != nil {
+			t.Error("there should be no error:", err)
+		}
+	}()
+	for i := 0; i < 10; i++ {
+		models, err := repo.FindAll(ctx)
+		if err != nil {
+			t.Error("there should be no error:", err)
+		}
+		if len(models) != 0 && len(models) != 100 {
+			t.Error("there should be all or no models:", len(models))
+		}
+	}
+	<-done
+
+	models, err := repo.FindAll(ctx)
+	if err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if len(models) != 0 {
+		t.Error("there should be no models:", models)
+	}
+}
@@ -19,6 +19,7 @@ import (
 	"errors"
 
 	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
 
 	eh "github.com/looplab/eventhorizon"
 )
@@ -32,6 +33,9 @@ var ErrNoDBSession = errors.New("no database session")
 // ErrCouldNotClearDB is when the database could not be cleared.
 var ErrCouldNotClearDB = errors.New("could not clear database")
 
+// ErrCouldNotRemoveModels is when read models could not be removed.
+var ErrCouldNotRemoveModels = errors.New("could not remove models")
+
 // ErrModelNotSet is when an model is not set on a read repository.
 var ErrModelNotSet = errors.New("model not set")
 
@@ -40,10 +44,11 @@ var ErrInvalidQuery = errors.New("invalid query")
 
 // ReadRepository implements an MongoDB repository of read models.
 type ReadRepository struct {
-	session    *mgo.Session
-	dbPrefix   string
-	collection string
-	factory    func() interface{}
+	session      *mgo.Session
+	dbPrefix     string
+	collection   string
+	factory      func() interface{}
+	versionField string
 }
 
 // NewReadRepository creates a new ReadRepository.
@@ -66,9 +71,10 @@ func NewReadRepositoryWithSession(session *mgo.Session, dbPrefix, collection str
 	}
 
 	r := &ReadRepository{
-		session:    session,
-		dbPrefix:   dbPrefix,
-		collection: collection,
+		session:      session,
+		dbPrefix:     dbPrefix,
+		collection:   collection,
+		versionField: "version",
 	}
 
 	return r, nil
@@ -94,6 +100,45 @@ func (r *ReadRepository) Save(ctx context.Context, id eh.UUID, model interface{}
 	return nil
 }
 
+// SaveVersioned implements the SaveVersioned method of the
+// eventhorizon.ReadRepositoryVersionedSaver interface. The model is replaced
+// with a conditional update on the version field of the saved model, set with
+// SetVersionField, or inserted for the expected version 0. A saved model
+// without the version field has version 0.
+func (r *ReadRepository) SaveVersioned(ctx context.Context, id eh.UUID, model eh.Versionable, expectedVersion int) error {
+	sess := r.session.Copy()
+	defer sess.Close()
+
+	c := sess.DB(r.dbName(ctx)).C(r.collection)
+
+	var err error
+	if expectedVersion == 0 {
+		// Only replace a model without a version, otherwise the insert of a
+		// new model is a duplicate.
+		_, err = c.Upsert(bson.M{"_id": id, r.versionField: bson.M{"$in": []interface{}{nil, 0}}}, model)
+		if mgo.IsDup(err) {
+			err = mgo.ErrNotFound
+		}
+	} else {
+		err = c.Update(bson.M{"_id": id, r.versionField: expectedVersion}, model)
+	}
+
+	if err == mgo.ErrNotFound {
+		return eh.ReadRepositoryError{
+			Err:       eh.ErrModelVersionMismatch,
+			Namespace: eh.Namespace(ctx),
+		}
+	} else if err != nil {
+		return eh.ReadRepositoryError{
+			Err:       eh.ErrCouldNotSaveModel,
+			BaseErr:   err,
+			Namespace: eh.Namespace(ctx),
+		}
+	}
+
+	return nil
+}
+
 // Find returns one read model with using an id. Returns
 // ErrModelNotFound if no model could be found.
 func (r *ReadRepository) Find(ctx context.Context, id eh.UUID) (interface{}, error) {
@@ -164,6 +209,142 @@ func (r *ReadRepository) FindCustom(ctx context.Context, callback func(*mgo.Coll
 
 // FindAll returns all read models in the repository.
 func (r *ReadRepository) FindAll(ctx context.Context) ([]interface{}, error) {
+	return r.FindBy(ctx, nil)
+}
+
+// FindAllPaged returns a page of read models in the repository, ordered by id
+// to not overlap between pages, and the total number of models. Returns
+// ErrInvalidPage if the offset is negative or the limit is not positive.
+func (r *ReadRepository) FindAllPaged(ctx context.Context, offset, limit int) ([]interface{}, int, error) {
+	if offset < 0 || limit < 1 {
+		return nil, 0, eh.ReadRepositoryError{
+			Err:       eh.ErrInvalidPage,
+			Namespace: eh.Namespace(ctx),
+		}
+	}
+
+	sess := r.session.Copy()
+	defer sess.Close()
+
+	if r.factory == nil {
+		return nil, 0, eh.ReadRepositoryError{
+			Err:       ErrModelNotSet,
+			Namespace: eh.Namespace(ctx),
+		}
+	}
+
+	collection := sess.DB(r.dbName(ctx)).C(r.collection)
+	total, err := collection.Count()
+	if err != nil {
+		return nil, 0, eh.ReadRepositoryError{
+			Err:       err,
+			Namespace: eh.Namespace(ctx),
+		}
+	}
+
+	iter := collection.Find(nil).Sort("_id").Skip(offset).Limit(limit).Iter()
+	result := []interface{}{}
+	model := r.factory()
+	for iter.Next(model) {
+		result = append(result, model)
+		model = r.factory()
+	}
+	if err := iter.Close(); err != nil {
+		return nil, 0, eh.ReadRepositoryError{
+			Err:       err,
+			Namespace: eh.Namespace(ctx),
+		}
+	}
+
+	return result, total, nil
+}
+
+// FindAfter returns a page of read models in the repository after the model
+// in the cursor, ordered by id, and the cursor of the next page. The next
+// cursor is empty after the last page, and an empty cursor finds the first
+// page. The page is queried by id to not skip or repeat models saved between
+// pages. Returns ErrInvalidPage if the limit is not positive and
+// ErrInvalidCursor if the cursor is not valid.
+func (r *ReadRepository) FindAfter(ctx context.Context, cursor string, limit int) ([]interface{}, string, error) {
+	if limit < 1 {
+		return nil, "", eh.ReadRepositoryError{
+			Err:       eh.ErrInvalidPage,
+			Namespace: eh.Namespace(ctx),
+		}
+	}
+
+	query := bson.M{}
+	if cursor != "" {
+		after, err := eh.DecodeCursor(cursor)
+		if err != nil {
+			return nil, "", eh.ReadRepositoryError{
+				Err:       err,
+				Namespace: eh.Namespace(ctx),
+			}
+		}
+		query["_id"] = bson.M{"$gt": after}
+	}
+
+	sess := r.session.Copy()
+	defer sess.Close()
+
+	if r.factory == nil {
+		return nil, "", eh.ReadRepositoryError{
+			Err:       ErrModelNotSet,
+			Namespace: eh.Namespace(ctx),
+		}
+	}
+
+	// Get one more model than the limit to know if there is a next page. The
+	// models are decoded from the raw documents to also get their ids.
+	iter := sess.DB(r.dbName(ctx)).C(r.collection).Find(query).Sort("_id").Limit(limit + 1).Iter()
+	result := []interface{}{}
+	ids := []eh.UUID{}
+	var raw bson.Raw
+	for iter.Next(&raw) {
+		var doc struct {
+			ID eh.UUID `bson:"_id"`
+		}
+		model := r.factory()
+		if err := raw.Unmarshal(&doc); err != nil {
+			iter.Close()
+			return nil, "", eh.ReadRepositoryError{
+				Err:       err,
+				Namespace: eh.Namespace(ctx),
+			}
+		}
+		if err := raw.Unmarshal(model); err != nil {
+			iter.Close()
+			return nil, "", eh.ReadRepositoryError{
+				Err:       err,
+				Namespace: eh.Namespace(ctx),
+			}
+		}
+		result = append(result, model)
+		ids = append(ids, doc.ID)
+	}
+	if err := iter.Close(); err != nil {
+		return nil, "", eh.ReadRepositoryError{
+			Err:       err,
+			Namespace: eh.Namespace(ctx),
+		}
+	}
+
+	// Only return a cursor if there are more models after the page.
+	next := ""
+	if len(result) > limit {
+		result = result[:limit]
+		next = eh.EncodeCursor(ids[limit-1])
+	}
+
+	return result, next, nil
+}
+
+// FindBy returns all read models in the repository that match the filter. The
+// filter is used as the query document and can be a bson.M or a struct with
+// bson tags for the fields to match, a nil filter matches all models. No
+// matching models is not an error.
+func (r *ReadRepository) FindBy(ctx context.Context, filter interface{}) ([]interface{}, error) {
 	sess := r.session.Copy()
 	defer sess.Close()
 
@@ -174,7 +355,7 @@ func (r *ReadRepository) FindAll(ctx context.Context) ([]interface{}, error) {
 		}
 	}
 
-	iter := sess.DB(r.dbName(ctx)).C(r.collection).Find(nil).Iter()
+	iter := sess.DB(r.dbName(ctx)).C(r.collection).Find(filter).Iter()
 	result := []interface{}{}
 	model := r.factory()
 	for iter.Next(model) {
@@ -209,11 +390,43 @@ func (r *ReadRepository) Remove(ctx context.Context, id eh.UUID) error {
 	return nil
 }
 
+// RemoveBy removes all read models that match a selector, with one delete of
+// the matching documents in the DB. No matching models is not an error.
+// Concurrent finds can see some of the models being removed, as the documents
+// are not removed atomically.
+func (r *ReadRepository) RemoveBy(ctx context.Context, selector bson.M) error {
+	sess := r.session.Copy()
+	defer sess.Close()
+
+	if _, err := sess.DB(r.dbName(ctx)).C(r.collection).RemoveAll(selector); err != nil {
+		return eh.ReadRepositoryError{
+			Err:       ErrCouldNotRemoveModels,
+			BaseErr:   err,
+			Namespace: eh.Namespace(ctx),
+		}
+	}
+
+	return nil
+}
+
+// RemoveAll removes all read models in the repository, for example before
+// rebuilding a projection. Unlike Clear the collection and its indexes are
+// kept.
+func (r *ReadRepository) RemoveAll(ctx context.Context) error {
+	return r.RemoveBy(ctx, bson.M{})
+}
+
 // SetModel sets a factory function that creates concrete model types.
 func (r *ReadRepository) SetModel(factory func() interface{}) {
 	r.factory = factory
 }
 
+// SetVersionField sets the BSON field that the version of the models is saved
+// in, used by SaveVersioned. The default is "version".
+func (r *ReadRepository) SetVersionField(field string) {
+	r.versionField = field
+}
+
 // Clear clears the read model database.
 func (r *ReadRepository) Clear(ctx context.Context) error {
 	if err := r.session.DB(r.dbName(ctx)).C(r.collection).DropCollection(); err != nil {
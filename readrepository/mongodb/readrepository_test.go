@@ -127,6 +127,203 @@ func TestReadRepository(t *testing.T) {
 	if count != 2 {
 		t.Error("the count should be correct:", count)
 	}
+
+	t.Log("FindBy with a bson.M filter")
+	result, err = repo.FindBy(ctx, bson.M{"content": "modelCustom"})
+	if err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if len(result) != 1 || !reflect.DeepEqual(result[0], modelCustom) {
+		t.Error("the items should be correct:", result)
+	}
+
+	t.Log("FindBy with a typed filter")
+	result, err = repo.FindBy(ctx, struct {
+		Content string `bson:"content"`
+	}{"modelCustom"})
+	if err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if len(result) != 1 || !reflect.DeepEqual(result[0], modelCustom) {
+		t.Error("the items should be correct:", result)
+	}
+
+	t.Log("FindBy with no matching models")
+	result, err = repo.FindBy(ctx, bson.M{"content": "missing"})
+	if err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if result == nil || len(result) != 0 {
+		t.Error("there should be no items:", result)
+	}
+}
+
+func TestReadRepositoryPaged(t *testing.T) {
+	// Support Wercker testing with MongoDB.
+	host := os.Getenv("MONGO_PORT_27017_TCP_ADDR")
+	port := os.Getenv("MONGO_PORT_27017_TCP_PORT")
+
+	url := "localhost"
+	if host != "" && port != "" {
+		url = host + ":" + port
+	}
+
+	repo, err := NewReadRepository(url, "test", "mocks.Model")
+	if err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if repo == nil {
+		t.Fatal("there should be a repository")
+	}
+	defer repo.Close()
+	repo.SetModel(func() interface{} {
+		return &mocks.Model{}
+	})
+
+	ctx := eh.WithNamespace(context.Background(), "paged")
+
+	defer func() {
+		t.Log("clearing db")
+		if err = repo.Clear(ctx); err != nil {
+			t.Fatal("there should be no error:", err)
+		}
+	}()
+
+	testutil.PagedReadRepositoryCommonTests(t, ctx, repo)
+}
+
+func TestReadRepositoryCursor(t *testing.T) {
+	// Support Wercker testing with MongoDB.
+	host := os.Getenv("MONGO_PORT_27017_TCP_ADDR")
+	port := os.Getenv("MONGO_PORT_27017_TCP_PORT")
+
+	url := "localhost"
+	if host != "" && port != "" {
+		url = host + ":" + port
+	}
+
+	repo, err := NewReadRepository(url, "test", "mocks.Model")
+	if err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if repo == nil {
+		t.Fatal("there should be a repository")
+	}
+	defer repo.Close()
+	repo.SetModel(func() interface{} {
+		return &mocks.Model{}
+	})
+
+	ctx := eh.WithNamespace(context.Background(), "cursor")
+
+	defer func() {
+		t.Log("clearing db")
+		if err = repo.Clear(ctx); err != nil {
+			t.Fatal("there should be no error:", err)
+		}
+	}()
+
+	testutil.CursorReadRepositoryCommonTests(t, ctx, repo)
+}
+
+func TestReadRepositoryVersioned(t *testing.T) {
+	// Support Wercker testing with MongoDB.
+	host := os.Getenv("MONGO_PORT_27017_TCP_ADDR")
+	port := os.Getenv("MONGO_PORT_27017_TCP_PORT")
+
+	url := "localhost"
+	if host != "" && port != "" {
+		url = host + ":" + port
+	}
+
+	repo, err := NewReadRepository(url, "test", "mocks.Model")
+	if err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if repo == nil {
+		t.Fatal("there should be a repository")
+	}
+	defer repo.Close()
+	repo.SetModel(func() interface{} {
+		return &mocks.Model{}
+	})
+
+	ctx := eh.WithNamespace(context.Background(), "versioned")
+
+	defer func() {
+		t.Log("clearing db")
+		if err = repo.Clear(ctx); err != nil {
+			t.Fatal("there should be no error:", err)
+		}
+	}()
+
+	testutil.VersionedReadRepositoryCommonTests(t, ctx, repo)
+}
+
+func TestReadRepositoryRemoveBy(t *testing.T) {
+	// Support Wercker testing with MongoDB.
+	host := os.Getenv("MONGO_PORT_27017_TCP_ADDR")
+	port := os.Getenv("MONGO_PORT_27017_TCP_PORT")
+
+	url := "localhost"
+	if host != "" && port != "" {
+		url = host + ":" + port
+	}
+
+	repo, err := NewReadRepository(url, "test", "mocks.Model")
+	if err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if repo == nil {
+		t.Fatal("there should be a repository")
+	}
+	defer repo.Close()
+	repo.SetModel(func() interface{} {
+		return &mocks.Model{}
+	})
+
+	ctx := eh.WithNamespace(context.Background(), "remove")
+
+	defer func() {
+		t.Log("clearing db")
+		if err = repo.Clear(ctx); err != nil {
+			t.Fatal("there should be no error:", err)
+		}
+	}()
+
+	t.Log("save models")
+	model1 := &mocks.Model{ID: eh.NewUUID(), Content: "model1", CreatedAt: time.Now().Round(time.Millisecond)}
+	model2 := &mocks.Model{ID: eh.NewUUID(), Content: "model2", CreatedAt: time.Now().Round(time.Millisecond)}
+	model3 := &mocks.Model{ID: eh.NewUUID(), Content: "model1", CreatedAt: time.Now().Round(time.Millisecond)}
+	for _, m := range []*mocks.Model{model1, model2, model3} {
+		if err := repo.Save(ctx, m.ID, m); err != nil {
+			t.Error("there should be no error:", err)
+		}
+	}
+
+	t.Log("remove matching models")
+	if err := repo.RemoveBy(ctx, bson.M{"content": "model1"}); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	models, err := repo.FindAll(ctx)
+	if err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if !reflect.DeepEqual(models, []interface{}{model2}) {
+		t.Error("the models should be correct:", models)
+	}
+
+	t.Log("remove all models")
+	if err := repo.RemoveAll(ctx); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	models, err = repo.FindAll(ctx)
+	if err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if len(models) != 0 {
+		t.Error("there should be no models:", models)
+	}
 }
 
 func TestRepository(t *testing.T) {
@@ -0,0 +1,112 @@
+// Copyright (c) 2016 - Max Ekman <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package readthrough
+
+import (
+	"context"
+	"errors"
+
+	eh "github.com/looplab/eventhorizon"
+)
+
+// ReadRepository is a middleware that rebuilds missing read models from the
+// events of their aggregates when they are found, for read models that are
+// rarely used and not kept up to date by a projector handler. The rebuilt
+// model is saved in the wrapped repository, so that it is found there the
+// next time.
+type ReadRepository struct {
+	eh.ReadRepository
+
+	store         eh.EventStore
+	aggregateType eh.AggregateType
+	projector     eh.Projector
+}
+
+// NewReadRepository creates a new ReadRepository that rebuilds the models of
+// an aggregate type by projecting its events from a store.
+func NewReadRepository(repo eh.ReadRepository, store eh.EventStore, aggregateType eh.AggregateType, projector eh.Projector) *ReadRepository {
+	return &ReadRepository{
+		ReadRepository: repo,
+		store:          store,
+		aggregateType:  aggregateType,
+		projector:      projector,
+	}
+}
+
+// Parent implements the Parent method of the eventhorizon.ReadRepository interface.
+func (r *ReadRepository) Parent() eh.ReadRepository {
+	return r.ReadRepository
+}
+
+// Find implements the Find method of the eventhorizon.ReadRepository
+// interface. If the model is not found in the wrapped repository it is rebuilt
+// by projecting all events of the aggregate, and saved. Returns
+// ErrModelNotFound only if the aggregate has no events, or if the projector
+// returns no model.
+func (r *ReadRepository) Find(ctx context.Context, id eh.UUID) (interface{}, error) {
+	model, err := r.ReadRepository.Find(ctx, id)
+	if !errors.Is(err, eh.ErrModelNotFound) {
+		return model, err
+	}
+	notFoundErr := err
+
+	events, err := r.store.Load(ctx, r.aggregateType, id)
+	if errors.Is(err, eh.ErrAggregateNotFound) || (err == nil && len(events) == 0) {
+		return nil, notFoundErr
+	} else if err != nil {
+		return nil, eh.ReadRepositoryError{
+			Err:       eh.ErrCouldNotLoadModel,
+			BaseErr:   err,
+			Namespace: eh.Namespace(ctx),
+		}
+	}
+
+	model = nil
+	for _, event := range events {
+		if model, err = r.projector.Project(ctx, event, model); err != nil {
+			return nil, eh.ReadRepositoryError{
+				Err:       eh.ErrCouldNotProjectEvent,
+				BaseErr:   err,
+				Namespace: eh.Namespace(ctx),
+			}
+		}
+	}
+	if model == nil {
+		return nil, notFoundErr
+	}
+
+	if err := r.ReadRepository.Save(ctx, id, model); err != nil {
+		return nil, eh.ReadRepositoryError{
+			Err:       eh.ErrCouldNotSaveModel,
+			BaseErr:   err,
+			Namespace: eh.Namespace(ctx),
+		}
+	}
+
+	return model, nil
+}
+
+// Repository returns a parent ReadRepository if there is one.
+func Repository(repo eh.ReadRepository) *ReadRepository {
+	if repo == nil {
+		return nil
+	}
+
+	if r, ok := repo.(*ReadRepository); ok {
+		return r
+	}
+
+	return Repository(repo.Parent())
+}
@@ -0,0 +1,152 @@
+// Copyright (c) 2016 - Max Ekman <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package readthrough
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	eh "github.com/looplab/eventhorizon"
+	"github.com/looplab/eventhorizon/eventstore/memory"
+	"github.com/looplab/eventhorizon/mocks"
+	repomemory "github.com/looplab/eventhorizon/readrepository/memory"
+	"github.com/looplab/eventhorizon/readrepository/testutil"
+)
+
+func TestReadRepository(t *testing.T) {
+	memoryRepo := repomemory.NewReadRepository()
+	repo := NewReadRepository(memoryRepo, memory.NewEventStore(), mocks.AggregateType, &contentProjector{})
+	if repo == nil {
+		t.Error("there should be a repository")
+	}
+
+	// Run the actual test suite.
+
+	t.Log("read repository with default namespace")
+	testutil.ReadRepositoryCommonTests(t, context.Background(), repo)
+
+	t.Log("read repository with other namespace")
+	ctx := eh.WithNamespace(context.Background(), "ns")
+	testutil.ReadRepositoryCommonTests(t, ctx, repo)
+
+	if parent := repo.Parent(); parent != memoryRepo {
+		t.Error("the parent repo should be correct:", parent)
+	}
+	if r := Repository(repo); r != repo {
+		t.Error("the read-through repository should be found:", r)
+	}
+}
+
+func TestReadRepositoryRebuild(t *testing.T) {
+	ctx := context.Background()
+	store := memory.NewEventStore()
+	projector := &contentProjector{}
+	baseRepo := repomemory.NewReadRepository()
+	repo := NewReadRepository(baseRepo, store, mocks.AggregateType, projector)
+
+	t.Log("find a model that is in the repository")
+	warm := &mocks.Model{ID: eh.NewUUID(), Content: "warm"}
+	if err := baseRepo.Save(ctx, warm.ID, warm); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	model, err := repo.Find(ctx, warm.ID)
+	if err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if model != warm {
+		t.Error("the model should be correct:", model)
+	}
+	if projector.calls != 0 {
+		t.Error("no events should be projected:", projector.calls)
+	}
+
+	t.Log("rebuild a missing model from its events")
+	id := eh.NewUUID()
+	agg := mocks.NewAggregate(id)
+	event1 := agg.NewEvent(mocks.EventType, &mocks.EventData{"event1"})
+	agg.ApplyEvent(ctx, event1) // Apply event to increment the aggregate version.
+	event2 := agg.NewEvent(mocks.EventType, &mocks.EventData{"event2"})
+	agg.ApplyEvent(ctx, event2) // Apply event to increment the aggregate version.
+	if err := store.Save(ctx, []eh.Event{event1, event2}, 0); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	model, err = repo.Find(ctx, id)
+	if err != nil {
+		t.Error("there should be no error:", err)
+	}
+	m, ok := model.(*mocks.Model)
+	if !ok || m.ID != id || m.Version != 2 || m.Content != "event1event2" {
+		t.Error("the model should be rebuilt:", model)
+	}
+	if projector.calls != 2 {
+		t.Error("the events should be projected:", projector.calls)
+	}
+
+	t.Log("find the rebuilt model in the repository")
+	if saved, err := baseRepo.Find(ctx, id); err != nil || saved != model {
+		t.Error("the rebuilt model should be saved:", saved, err)
+	}
+	if _, err := repo.Find(ctx, id); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if projector.calls != 2 {
+		t.Error("no more events should be projected:", projector.calls)
+	}
+
+	t.Log("find a model without events")
+	if _, err := repo.Find(ctx, eh.NewUUID()); !errors.Is(err, eh.ErrModelNotFound) {
+		t.Error("there should be a ErrModelNotFound error:", err)
+	}
+
+	t.Log("rebuild with a projector error")
+	projector.err = errors.New("projector error")
+	if err := baseRepo.Remove(ctx, id); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if _, err := repo.Find(ctx, id); !errors.Is(err, eh.ErrCouldNotProjectEvent) ||
+		!errors.Is(err, projector.err) {
+		t.Error("there should be a ErrCouldNotProjectEvent error:", err)
+	}
+	if _, err := baseRepo.Find(ctx, id); !errors.Is(err, eh.ErrModelNotFound) {
+		t.Error("no model should be saved:", err)
+	}
+}
+
+// contentProjector projects the content of mocked events onto mocked models.
+type contentProjector struct {
+	calls int
+	err   error
+}
+
+func (p *contentProjector) ProjectorType() eh.ProjectorType {
+	return eh.ProjectorType("ContentProjector")
+}
+
+func (p *contentProjector) Project(ctx context.Context, event eh.Event, model interface{}) (interface{}, error) {
+	p.calls++
+	if p.err != nil {
+		return nil, p.err
+	}
+	m, ok := model.(*mocks.Model)
+	if !ok {
+		m = &mocks.Model{ID: event.AggregateID()}
+	}
+	if data, ok := event.Data().(*mocks.EventData); ok {
+		m.Content += data.Content
+	}
+	m.Version = event.Version()
+	return m, nil
+}
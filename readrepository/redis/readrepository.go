@@ -0,0 +1,339 @@
+// Copyright (c) 2016 - Max Ekman <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package redis
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sort"
+	"time"
+
+	"github.com/garyburd/redigo/redis"
+
+	eh "github.com/looplab/eventhorizon"
+)
+
+// ErrModelNotSet is when an model is not set on a read repository.
+var ErrModelNotSet = errors.New("model not set")
+
+// ErrCouldNotUnmarshalModel is when a model could not be unmarshaled from JSON.
+var ErrCouldNotUnmarshalModel = errors.New("could not unmarshal model")
+
+// ErrCouldNotClearDB is when the database could not be cleared.
+var ErrCouldNotClearDB = errors.New("could not clear database")
+
+// ReadRepository implements a Redis repository of read models. The models are
+// stored as JSON under a key with the model type, the namespace and the id.
+type ReadRepository struct {
+	pool       *redis.Pool
+	modelType  string
+	factory    func() interface{}
+	expiration time.Duration
+}
+
+// Option is an option setter used to configure creation.
+type Option func(*ReadRepository) error
+
+// WithExpiration sets an expiration for the saved models, after which they are
+// removed by Redis. The expiration is reset every time a model is saved.
+func WithExpiration(expiration time.Duration) Option {
+	return func(r *ReadRepository) error {
+		r.expiration = expiration
+		return nil
+	}
+}
+
+// NewReadRepository creates a new ReadRepository for a model type.
+func NewReadRepository(server, password, modelType string, opts ...Option) (*ReadRepository, error) {
+	pool := &redis.Pool{
+		MaxIdle:     3,
+		IdleTimeout: 240 * time.Second,
+		Dial: func() (redis.Conn, error) {
+			c, err := redis.Dial("tcp", server)
+			if err != nil {
+				return nil, err
+			}
+			if password != "" {
+				if _, err := c.Do("AUTH", password); err != nil {
+					c.Close()
+					return nil, err
+				}
+			}
+			return c, err
+		},
+		TestOnBorrow: func(c redis.Conn, t time.Time) error {
+			_, err := c.Do("PING")
+			return err
+		},
+	}
+
+	return NewReadRepositoryWithPool(pool, modelType, opts...)
+}
+
+// NewReadRepositoryWithPool creates a new ReadRepository with a pool.
+func NewReadRepositoryWithPool(pool *redis.Pool, modelType string, opts ...Option) (*ReadRepository, error) {
+	r := &ReadRepository{
+		pool:      pool,
+		modelType: modelType,
+	}
+
+	for _, opt := range opts {
+		if err := opt(r); err != nil {
+			return nil, err
+		}
+	}
+
+	return r, nil
+}
+
+// Parent implements the Parent method of the eventhorizon.ReadRepository interface.
+func (r *ReadRepository) Parent() eh.ReadRepository {
+	return nil
+}
+
+// Save saves a read model with id to the repository.
+func (r *ReadRepository) Save(ctx context.Context, id eh.UUID, model interface{}) error {
+	data, err := json.Marshal(model)
+	if err != nil {
+		return eh.ReadRepositoryError{
+			Err:       eh.ErrCouldNotSaveModel,
+			BaseErr:   err,
+			Namespace: eh.Namespace(ctx),
+		}
+	}
+
+	conn := r.pool.Get()
+	defer conn.Close()
+
+	args := redis.Args{r.key(ctx, id), data}
+	if r.expiration > 0 {
+		args = args.Add("PX", int64(r.expiration/time.Millisecond))
+	}
+	if _, err := conn.Do("SET", args...); err != nil {
+		return eh.ReadRepositoryError{
+			Err:       eh.ErrCouldNotSaveModel,
+			BaseErr:   err,
+			Namespace: eh.Namespace(ctx),
+		}
+	}
+
+	return nil
+}
+
+// Find returns one read model with using an id. Returns
+// ErrModelNotFound if no model could be found, also if it has expired.
+func (r *ReadRepository) Find(ctx context.Context, id eh.UUID) (interface{}, error) {
+	if r.factory == nil {
+		return nil, eh.ReadRepositoryError{
+			Err:       ErrModelNotSet,
+			Namespace: eh.Namespace(ctx),
+		}
+	}
+
+	conn := r.pool.Get()
+	defer conn.Close()
+
+	data, err := redis.Bytes(conn.Do("GET", r.key(ctx, id)))
+	if err == redis.ErrNil {
+		return nil, eh.ReadRepositoryError{
+			Err:       eh.ErrModelNotFound,
+			Namespace: eh.Namespace(ctx),
+		}
+	} else if err != nil {
+		return nil, eh.ReadRepositoryError{
+			Err:       eh.ErrModelNotFound,
+			BaseErr:   err,
+			Namespace: eh.Namespace(ctx),
+		}
+	}
+
+	return r.unmarshalModel(ctx, data)
+}
+
+// FindAll returns all read models in the repository, ordered by id. The keys
+// are found with SCAN, models that are saved or removed during the call may
+// or may not be returned.
+func (r *ReadRepository) FindAll(ctx context.Context) ([]interface{}, error) {
+	if r.factory == nil {
+		return nil, eh.ReadRepositoryError{
+			Err:       ErrModelNotSet,
+			Namespace: eh.Namespace(ctx),
+		}
+	}
+
+	conn := r.pool.Get()
+	defer conn.Close()
+
+	keys, err := r.scan(ctx, conn)
+	if err != nil {
+		return nil, eh.ReadRepositoryError{
+			Err:       err,
+			Namespace: eh.Namespace(ctx),
+		}
+	}
+
+	result := []interface{}{}
+	if len(keys) == 0 {
+		return result, nil
+	}
+
+	values, err := redis.ByteSlices(conn.Do("MGET", redis.Args{}.AddFlat(keys)...))
+	if err != nil {
+		return nil, eh.ReadRepositoryError{
+			Err:       err,
+			Namespace: eh.Namespace(ctx),
+		}
+	}
+	for _, data := range values {
+		// Skip models that were removed or expired after the scan.
+		if data == nil {
+			continue
+		}
+
+		model, err := r.unmarshalModel(ctx, data)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, model)
+	}
+
+	return result, nil
+}
+
+// Remove removes a read model with id from the repository. Returns
+// ErrModelNotFound if no model could be found.
+func (r *ReadRepository) Remove(ctx context.Context, id eh.UUID) error {
+	conn := r.pool.Get()
+	defer conn.Close()
+
+	n, err := redis.Int(conn.Do("DEL", r.key(ctx, id)))
+	if err != nil {
+		return eh.ReadRepositoryError{
+			Err:       eh.ErrModelNotFound,
+			BaseErr:   err,
+			Namespace: eh.Namespace(ctx),
+		}
+	}
+	if n == 0 {
+		return eh.ReadRepositoryError{
+			Err:       eh.ErrModelNotFound,
+			Namespace: eh.Namespace(ctx),
+		}
+	}
+
+	return nil
+}
+
+// SetModel sets a factory function that creates concrete model types.
+func (r *ReadRepository) SetModel(factory func() interface{}) {
+	r.factory = factory
+}
+
+// Clear clears the read models in the namespace.
+func (r *ReadRepository) Clear(ctx context.Context) error {
+	conn := r.pool.Get()
+	defer conn.Close()
+
+	keys, err := r.scan(ctx, conn)
+	if err != nil {
+		return eh.ReadRepositoryError{
+			Err:       ErrCouldNotClearDB,
+			BaseErr:   err,
+			Namespace: eh.Namespace(ctx),
+		}
+	}
+	if len(keys) == 0 {
+		return nil
+	}
+
+	if _, err := conn.Do("DEL", redis.Args{}.AddFlat(keys)...); err != nil {
+		return eh.ReadRepositoryError{
+			Err:       ErrCouldNotClearDB,
+			BaseErr:   err,
+			Namespace: eh.Namespace(ctx),
+		}
+	}
+	return nil
+}
+
+// Close closes the connection pool.
+func (r *ReadRepository) Close() error {
+	return r.pool.Close()
+}
+
+// scan returns the sorted keys of all models in the namespace.
+func (r *ReadRepository) scan(ctx context.Context, conn redis.Conn) ([]string, error) {
+	pattern := r.key(ctx, "*")
+	keys := []string{}
+	cursor := 0
+	for {
+		values, err := redis.Values(conn.Do("SCAN", cursor, "MATCH", pattern, "COUNT", 100))
+		if err != nil {
+			return nil, err
+		}
+		var batch []string
+		if _, err := redis.Scan(values, &cursor, &batch); err != nil {
+			return nil, err
+		}
+		keys = append(keys, batch...)
+
+		if cursor == 0 {
+			break
+		}
+	}
+
+	// SCAN can return the same key more than once.
+	sort.Strings(keys)
+	unique := keys[:0]
+	for i, key := range keys {
+		if i == 0 || key != keys[i-1] {
+			unique = append(unique, key)
+		}
+	}
+
+	return unique, nil
+}
+
+// unmarshalModel creates a concrete model from JSON.
+func (r *ReadRepository) unmarshalModel(ctx context.Context, data []byte) (interface{}, error) {
+	model := r.factory()
+	if err := json.Unmarshal(data, model); err != nil {
+		return nil, eh.ReadRepositoryError{
+			Err:       ErrCouldNotUnmarshalModel,
+			BaseErr:   err,
+			Namespace: eh.Namespace(ctx),
+		}
+	}
+	return model, nil
+}
+
+// key returns the key for a model id, with the model type and namespace.
+func (r *ReadRepository) key(ctx context.Context, id eh.UUID) string {
+	return r.modelType + ":" + eh.Namespace(ctx) + ":" + string(id)
+}
+
+// Repository returns a parent ReadRepository if there is one.
+func Repository(repo eh.ReadRepository) *ReadRepository {
+	if repo == nil {
+		return nil
+	}
+
+	if r, ok := repo.(*ReadRepository); ok {
+		return r
+	}
+
+	return Repository(repo.Parent())
+}
@@ -0,0 +1,282 @@
+// Copyright (c) 2016 - Max Ekman <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package redis
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+
+	eh "github.com/looplab/eventhorizon"
+	"github.com/looplab/eventhorizon/mocks"
+)
+
+func TestReadRepository(t *testing.T) {
+	s, err := miniredis.Run()
+	if err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	defer s.Close()
+
+	repo, err := NewReadRepository(s.Addr(), "", "mocks.Model")
+	if err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	if repo == nil {
+		t.Fatal("there should be a repository")
+	}
+	defer repo.Close()
+	repo.SetModel(func() interface{} {
+		return &mocks.Model{}
+	})
+
+	ctx := eh.WithNamespace(context.Background(), "ns")
+
+	t.Log("read repository with default namespace")
+	testReadRepository(t, context.Background(), repo)
+
+	t.Log("read repository with other namespace")
+	testReadRepository(t, ctx, repo)
+
+	if repo.Parent() != nil {
+		t.Error("the parent repo should be nil")
+	}
+
+	t.Log("clear namespace")
+	if err := repo.Clear(ctx); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	result, err := repo.FindAll(ctx)
+	if err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if len(result) != 0 {
+		t.Error("there should be no items:", len(result))
+	}
+	result, err = repo.FindAll(context.Background())
+	if err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if len(result) != 1 {
+		t.Error("there should be one item in the default namespace:", len(result))
+	}
+}
+
+func TestReadRepositoryExpiration(t *testing.T) {
+	s, err := miniredis.Run()
+	if err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	defer s.Close()
+
+	repo, err := NewReadRepository(s.Addr(), "", "mocks.Model", WithExpiration(time.Minute))
+	if err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	defer repo.Close()
+	repo.SetModel(func() interface{} {
+		return &mocks.Model{}
+	})
+
+	ctx := context.Background()
+
+	t.Log("save item with expiration")
+	model1 := &mocks.Model{
+		ID:        eh.NewUUID(),
+		Content:   "model1",
+		CreatedAt: time.Now().Round(time.Millisecond),
+	}
+	if err := repo.Save(ctx, model1.ID, model1); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	model, err := repo.Find(ctx, model1.ID)
+	if err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if !reflect.DeepEqual(model, model1) {
+		t.Error("the item should be correct:", model)
+	}
+
+	t.Log("find item before expiration")
+	s.FastForward(30 * time.Second)
+	if _, err := repo.Find(ctx, model1.ID); err != nil {
+		t.Error("there should be no error:", err)
+	}
+
+	t.Log("reset expiration on save")
+	if err := repo.Save(ctx, model1.ID, model1); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	s.FastForward(45 * time.Second)
+	if _, err := repo.Find(ctx, model1.ID); err != nil {
+		t.Error("there should be no error:", err)
+	}
+
+	t.Log("find expired item")
+	s.FastForward(30 * time.Second)
+	_, err = repo.Find(ctx, model1.ID)
+	if rrErr, ok := err.(eh.ReadRepositoryError); !ok || rrErr.Err != eh.ErrModelNotFound {
+		t.Error("there should be a ErrModelNotFound error:", err)
+	}
+	result, err := repo.FindAll(ctx)
+	if err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if len(result) != 0 {
+		t.Error("there should be no items:", len(result))
+	}
+}
+
+func TestReadRepositoryModelNotSet(t *testing.T) {
+	s, err := miniredis.Run()
+	if err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	defer s.Close()
+
+	repo, err := NewReadRepository(s.Addr(), "", "mocks.Model")
+	if err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	defer repo.Close()
+
+	_, err = repo.Find(context.Background(), eh.NewUUID())
+	if rrErr, ok := err.(eh.ReadRepositoryError); !ok || rrErr.Err != ErrModelNotSet {
+		t.Error("there should be a ErrModelNotSet error:", err)
+	}
+	_, err = repo.FindAll(context.Background())
+	if rrErr, ok := err.(eh.ReadRepositoryError); !ok || rrErr.Err != ErrModelNotSet {
+		t.Error("there should be a ErrModelNotSet error:", err)
+	}
+}
+
+func TestRepository(t *testing.T) {
+	if r := Repository(nil); r != nil {
+		t.Error("the parent repository should be nil:", r)
+	}
+
+	inner := &mocks.ReadRepository{}
+	if r := Repository(inner); r != nil {
+		t.Error("the parent repository should be nil:", r)
+	}
+
+	repo, err := NewReadRepository("localhost:6379", "", "mocks.Model")
+	if err != nil {
+		t.Error("there should be no error:", err)
+	}
+	defer repo.Close()
+
+	outer := &mocks.ReadRepository{ParentRepo: repo}
+	if r := Repository(outer); r != repo {
+		t.Error("the parent repository should be correct:", r)
+	}
+}
+
+// testReadRepository tests saving, finding and removing models, with the
+// models from FindAll ordered by id instead of by insert.
+func testReadRepository(t *testing.T, ctx context.Context, repo *ReadRepository) {
+	t.Log("FindAll with no items")
+	result, err := repo.FindAll(ctx)
+	if err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if len(result) != 0 {
+		t.Error("there should be no items:", len(result))
+	}
+
+	t.Log("Find non-existing item")
+	_, err = repo.Find(ctx, eh.NewUUID())
+	if rrErr, ok := err.(eh.ReadRepositoryError); !ok || rrErr.Err != eh.ErrModelNotFound {
+		t.Error("there should be a ErrModelNotFound error:", err)
+	}
+
+	t.Log("Save one item")
+	model1 := &mocks.Model{
+		ID:        eh.NewUUID(),
+		Content:   "model1",
+		CreatedAt: time.Now().Round(time.Millisecond),
+	}
+	if err = repo.Save(ctx, model1.ID, model1); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	model, err := repo.Find(ctx, model1.ID)
+	if err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if !reflect.DeepEqual(model, model1) {
+		t.Error("the item should be correct:", model)
+	}
+
+	t.Log("Save and overwrite with same ID")
+	model1Alt := &mocks.Model{
+		ID:        model1.ID,
+		Content:   "model1Alt",
+		CreatedAt: time.Now().Round(time.Millisecond),
+	}
+	if err = repo.Save(ctx, model1Alt.ID, model1Alt); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	model, err = repo.Find(ctx, model1Alt.ID)
+	if err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if !reflect.DeepEqual(model, model1Alt) {
+		t.Error("the item should be correct:", model)
+	}
+
+	t.Log("Save with another ID")
+	model2 := &mocks.Model{
+		ID:        eh.NewUUID(),
+		Content:   "model2",
+		CreatedAt: time.Now().Round(time.Millisecond),
+	}
+	if err = repo.Save(ctx, model2.ID, model2); err != nil {
+		t.Error("there should be no error:", err)
+	}
+
+	t.Log("FindAll with two items, ordered by id")
+	result, err = repo.FindAll(ctx)
+	if err != nil {
+		t.Error("there should be no error:", err)
+	}
+	expected := []interface{}{model1Alt, model2}
+	if model2.ID < model1Alt.ID {
+		expected = []interface{}{model2, model1Alt}
+	}
+	if !reflect.DeepEqual(result, expected) {
+		t.Error("the items should be correct:", result)
+	}
+
+	t.Log("Remove one item")
+	if err = repo.Remove(ctx, model1Alt.ID); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	result, err = repo.FindAll(ctx)
+	if err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if !reflect.DeepEqual(result, []interface{}{model2}) {
+		t.Error("the item should be correct:", result)
+	}
+
+	t.Log("Remove non-existing item")
+	err = repo.Remove(ctx, model1Alt.ID)
+	if rrErr, ok := err.(eh.ReadRepositoryError); !ok || rrErr.Err != eh.ErrModelNotFound {
+		t.Error("there should be a ErrModelNotFound error:", err)
+	}
+}
@@ -16,7 +16,10 @@ package testutil
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"reflect"
+	"sync"
 	"testing"
 	"time"
 
@@ -129,7 +132,294 @@ func ReadRepositoryCommonTests(t *testing.T, ctx context.Context, repo eh.ReadRe
 
 	t.Log("Remove non-existing item")
 	err = repo.Remove(ctx, model1Alt.ID)
-	if rrErr, ok := err.(eh.ReadRepositoryError); !ok || rrErr.Err != eh.ErrModelNotFound {
+	if !errors.Is(err, eh.ErrModelNotFound) {
 		t.Error("there should be a ErrModelNotFound error:", err)
 	}
 }
+
+// PagedReadRepositoryCommonTests are test cases that are common to all
+// implementations of read repositories that can find models in pages. It
+// expects the repository to be empty for the namespace.
+func PagedReadRepositoryCommonTests(t *testing.T, ctx context.Context, repo eh.ReadRepository) {
+	pagedRepo, ok := repo.(interface {
+		FindAllPaged(context.Context, int, int) ([]interface{}, int, error)
+	})
+	if !ok {
+		t.Fatal("the repository should support paging")
+	}
+
+	t.Log("FindAllPaged with no items")
+	result, total, err := pagedRepo.FindAllPaged(ctx, 0, 3)
+	if err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if len(result) != 0 || total != 0 {
+		t.Error("there should be no items:", len(result), total)
+	}
+
+	t.Log("Save items")
+	saved := map[eh.UUID]interface{}{}
+	for i := 0; i < 7; i++ {
+		model := &mocks.Model{
+			ID:        eh.NewUUID(),
+			Content:   "model",
+			CreatedAt: time.Now().Round(time.Millisecond),
+		}
+		if err = repo.Save(ctx, model.ID, model); err != nil {
+			t.Error("there should be no error:", err)
+		}
+		saved[model.ID] = model
+	}
+
+	t.Log("FindAllPaged through all pages")
+	found := map[eh.UUID]bool{}
+	var lastID eh.UUID
+	for offset := 0; offset < 7; offset += 3 {
+		result, total, err = pagedRepo.FindAllPaged(ctx, offset, 3)
+		if err != nil {
+			t.Error("there should be no error:", err)
+		}
+		if total != 7 {
+			t.Error("the total should be correct:", total)
+		}
+		if expected := 7 - offset; len(result) != 3 && len(result) != expected {
+			t.Error("the page should be full or the last page:", len(result))
+		}
+		for _, m := range result {
+			model, ok := m.(*mocks.Model)
+			if !ok {
+				t.Fatalf("the item should be a model: %T", m)
+			}
+			if found[model.ID] {
+				t.Error("the item should only be on one page:", model.ID)
+			}
+			if model.ID <= lastID {
+				t.Error("the items should be ordered by id:", model.ID, lastID)
+			}
+			if !reflect.DeepEqual(model, saved[model.ID]) {
+				t.Error("the item should be correct:", model)
+			}
+			found[model.ID] = true
+			lastID = model.ID
+		}
+	}
+	if len(found) != len(saved) {
+		t.Error("all items should be on a page:", len(found))
+	}
+
+	t.Log("FindAllPaged after the last page")
+	result, total, err = pagedRepo.FindAllPaged(ctx, 7, 3)
+	if err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if len(result) != 0 || total != 7 {
+		t.Error("there should be no items:", len(result), total)
+	}
+
+	t.Log("FindAllPaged with invalid page")
+	_, _, err = pagedRepo.FindAllPaged(ctx, -1, 3)
+	if !errors.Is(err, eh.ErrInvalidPage) {
+		t.Error("there should be a ErrInvalidPage error:", err)
+	}
+	_, _, err = pagedRepo.FindAllPaged(ctx, 0, 0)
+	if !errors.Is(err, eh.ErrInvalidPage) {
+		t.Error("there should be a ErrInvalidPage error:", err)
+	}
+}
+
+// CursorReadRepositoryCommonTests are test cases that are common to all
+// implementations of read repositories that can find models in pages after a
+// cursor. It expects the repository to be empty for the namespace.
+func CursorReadRepositoryCommonTests(t *testing.T, ctx context.Context, repo eh.ReadRepository) {
+	cursorRepo, ok := repo.(interface {
+		FindAfter(context.Context, string, int) ([]interface{}, string, error)
+	})
+	if !ok {
+		t.Fatal("the repository should support cursors")
+	}
+
+	t.Log("FindAfter with no items")
+	result, next, err := cursorRepo.FindAfter(ctx, "", 3)
+	if err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if len(result) != 0 || next != "" {
+		t.Error("there should be no items:", len(result), next)
+	}
+
+	t.Log("Save items")
+	saved := map[eh.UUID]interface{}{}
+	for i := 0; i < 7; i++ {
+		model := &mocks.Model{
+			ID:        eh.NewUUID(),
+			Content:   "model",
+			CreatedAt: time.Now().Round(time.Millisecond),
+		}
+		if err = repo.Save(ctx, model.ID, model); err != nil {
+			t.Error("there should be no error:", err)
+		}
+		saved[model.ID] = model
+	}
+
+	t.Log("FindAfter through all pages")
+	found := map[eh.UUID]bool{}
+	var lastID eh.UUID
+	cursor := ""
+	pages := 0
+	for {
+		result, next, err = cursorRepo.FindAfter(ctx, cursor, 3)
+		if err != nil {
+			t.Fatal("there should be no error:", err)
+		}
+		if pages++; pages > 3 {
+			t.Fatal("there should be three pages")
+		}
+		if next != "" && len(result) != 3 {
+			t.Error("the page should be full if there is a next page:", len(result))
+		}
+		for _, m := range result {
+			model, ok := m.(*mocks.Model)
+			if !ok {
+				t.Fatalf("the item should be a model: %T", m)
+			}
+			if found[model.ID] {
+				t.Error("the item should only be on one page:", model.ID)
+			}
+			if model.ID <= lastID {
+				t.Error("the items should be ordered by id:", model.ID, lastID)
+			}
+			if !reflect.DeepEqual(model, saved[model.ID]) {
+				t.Error("the item should be correct:", model)
+			}
+			found[model.ID] = true
+			lastID = model.ID
+		}
+		if next == "" {
+			break
+		}
+		cursor = next
+	}
+	if pages != 3 {
+		t.Error("there should be three pages:", pages)
+	}
+	if len(found) != len(saved) {
+		t.Error("all items should be on a page:", len(found))
+	}
+
+	t.Log("FindAfter with a page of all items")
+	result, next, err = cursorRepo.FindAfter(ctx, "", 7)
+	if err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if len(result) != 7 || next != "" {
+		t.Error("there should be all items and no next page:", len(result), next)
+	}
+
+	t.Log("FindAfter the last item")
+	result, next, err = cursorRepo.FindAfter(ctx, eh.EncodeCursor(lastID), 3)
+	if err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if len(result) != 0 || next != "" {
+		t.Error("there should be no items:", len(result), next)
+	}
+
+	t.Log("FindAfter with invalid page")
+	_, _, err = cursorRepo.FindAfter(ctx, "", 0)
+	if !errors.Is(err, eh.ErrInvalidPage) {
+		t.Error("there should be a ErrInvalidPage error:", err)
+	}
+	_, _, err = cursorRepo.FindAfter(ctx, "not a cursor", 3)
+	if !errors.Is(err, eh.ErrInvalidCursor) {
+		t.Error("there should be a ErrInvalidCursor error:", err)
+	}
+}
+
+// VersionedReadRepositoryCommonTests are test cases that are common to all
+// implementations of read repositories that can save models with an expected
+// version.
+func VersionedReadRepositoryCommonTests(t *testing.T, ctx context.Context, repo eh.ReadRepository) {
+	saver, ok := repo.(eh.ReadRepositoryVersionedSaver)
+	if !ok {
+		t.Fatal("the repository should support versioned saves")
+	}
+
+	t.Log("save a new model")
+	id := eh.NewUUID()
+	model1 := &mocks.Model{ID: id, Version: 1, Content: "model1"}
+	if err := saver.SaveVersioned(ctx, id, model1, 0); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	model, err := repo.Find(ctx, id)
+	if err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if !reflect.DeepEqual(model, model1) {
+		t.Error("the item should be correct:", model)
+	}
+
+	t.Log("save a new model that is already saved")
+	err = saver.SaveVersioned(ctx, id, &mocks.Model{ID: id, Version: 1, Content: "other"}, 0)
+	if !errors.Is(err, eh.ErrModelVersionMismatch) {
+		t.Error("there should be a ErrModelVersionMismatch error:", err)
+	}
+
+	t.Log("save with the expected version")
+	model2 := &mocks.Model{ID: id, Version: 2, Content: "model2"}
+	if err := saver.SaveVersioned(ctx, id, model2, 1); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	model, err = repo.Find(ctx, id)
+	if err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if !reflect.DeepEqual(model, model2) {
+		t.Error("the item should be correct:", model)
+	}
+
+	t.Log("save with an old expected version")
+	err = saver.SaveVersioned(ctx, id, &mocks.Model{ID: id, Version: 2, Content: "other"}, 1)
+	if !errors.Is(err, eh.ErrModelVersionMismatch) {
+		t.Error("there should be a ErrModelVersionMismatch error:", err)
+	}
+	model, err = repo.Find(ctx, id)
+	if err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if !reflect.DeepEqual(model, model2) {
+		t.Error("the item should not be changed:", model)
+	}
+
+	t.Log("race saves with the same expected version")
+	for _, expectedVersion := range []int{2, 0} {
+		raceID := id
+		if expectedVersion == 0 {
+			raceID = eh.NewUUID()
+		}
+		const writers = 10
+		var wg sync.WaitGroup
+		errs := make(chan error, writers)
+		for i := 0; i < writers; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				m := &mocks.Model{ID: raceID, Version: expectedVersion + 1, Content: fmt.Sprint("writer", i)}
+				errs <- saver.SaveVersioned(ctx, raceID, m, expectedVersion)
+			}(i)
+		}
+		wg.Wait()
+		close(errs)
+
+		saved := 0
+		for err := range errs {
+			if err == nil {
+				saved++
+			} else if !errors.Is(err, eh.ErrModelVersionMismatch) {
+				t.Error("there should be a ErrModelVersionMismatch error:", err)
+			}
+		}
+		if saved != 1 {
+			t.Error("exactly one save should succeed:", expectedVersion, saved)
+		}
+	}
+}
@@ -0,0 +1,105 @@
+// Copyright (c) 2016 - Max Ekman <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package typed
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+
+	eh "github.com/looplab/eventhorizon"
+)
+
+// ErrIncorrectModelType is when a model is not of the type of the repository.
+var ErrIncorrectModelType = errors.New("incorrect model type")
+
+// ReadRepository is a wrapper of a read repository that returns models of the
+// type T, instead of models that have to be cast by the caller.
+type ReadRepository[T any] struct {
+	repo eh.ReadRepository
+}
+
+// NewReadRepository creates a new ReadRepository.
+func NewReadRepository[T any](repo eh.ReadRepository) *ReadRepository[T] {
+	return &ReadRepository[T]{
+		repo: repo,
+	}
+}
+
+// Parent returns the wrapped read repository.
+func (r *ReadRepository[T]) Parent() eh.ReadRepository {
+	return r.repo
+}
+
+// Save saves a read model with id to the wrapped repository.
+func (r *ReadRepository[T]) Save(ctx context.Context, id eh.UUID, model T) error {
+	return r.repo.Save(ctx, id, model)
+}
+
+// Find returns a read model with an id. If the model is not of the type T an
+// error with ErrIncorrectModelType is returned.
+func (r *ReadRepository[T]) Find(ctx context.Context, id eh.UUID) (T, error) {
+	var zero T
+
+	m, err := r.repo.Find(ctx, id)
+	if err != nil {
+		return zero, err
+	}
+
+	model, ok := m.(T)
+	if !ok {
+		return zero, incorrectModelTypeError(ctx, m, zero)
+	}
+
+	return model, nil
+}
+
+// FindAll returns all read models in the repository. If any of the models is
+// not of the type T an error with ErrIncorrectModelType is returned.
+func (r *ReadRepository[T]) FindAll(ctx context.Context) ([]T, error) {
+	var zero T
+
+	ms, err := r.repo.FindAll(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	models := make([]T, len(ms))
+	for i, m := range ms {
+		model, ok := m.(T)
+		if !ok {
+			return nil, incorrectModelTypeError(ctx, m, zero)
+		}
+		models[i] = model
+	}
+
+	return models, nil
+}
+
+// Remove removes a read model with id from the wrapped repository.
+func (r *ReadRepository[T]) Remove(ctx context.Context, id eh.UUID) error {
+	return r.repo.Remove(ctx, id)
+}
+
+// incorrectModelTypeError returns an error with the type of the model and the
+// type of the repository.
+func incorrectModelTypeError[T any](ctx context.Context, model interface{}, _ T) error {
+	return eh.ReadRepositoryError{
+		Err:       ErrIncorrectModelType,
+		BaseErr:   fmt.Errorf("%T is not %s", model, reflect.TypeOf((*T)(nil)).Elem()),
+		Namespace: eh.Namespace(ctx),
+	}
+}
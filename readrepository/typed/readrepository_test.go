@@ -0,0 +1,109 @@
+// Copyright (c) 2016 - Max Ekman <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package typed
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	eh "github.com/looplab/eventhorizon"
+	"github.com/looplab/eventhorizon/mocks"
+	"github.com/looplab/eventhorizon/readrepository/memory"
+)
+
+func TestReadRepository(t *testing.T) {
+	memoryRepo := memory.NewReadRepository()
+	repo := NewReadRepository[*mocks.Model](memoryRepo)
+	if repo == nil {
+		t.Fatal("there should be a repository")
+	}
+
+	if parent := repo.Parent(); parent != memoryRepo {
+		t.Error("the parent repo should be correct:", parent)
+	}
+
+	ctx := context.Background()
+
+	t.Log("FindAll with no items")
+	models, err := repo.FindAll(ctx)
+	if err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if len(models) != 0 {
+		t.Error("there should be no items:", len(models))
+	}
+
+	t.Log("Save and Find one item")
+	id1 := eh.NewUUID()
+	model1 := &mocks.Model{ID: id1, Content: "model1"}
+	if err := repo.Save(ctx, id1, model1); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	model, err := repo.Find(ctx, id1)
+	if err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if model != model1 || model.Content != "model1" {
+		t.Error("the item should be correct:", model)
+	}
+
+	t.Log("Save and FindAll with more items")
+	id2 := eh.NewUUID()
+	model2 := &mocks.Model{ID: id2, Content: "model2"}
+	if err := repo.Save(ctx, id2, model2); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	models, err = repo.FindAll(ctx)
+	if err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if len(models) != 2 {
+		t.Error("there should be two items:", len(models))
+	}
+
+	t.Log("Find with incorrect model type")
+	id3 := eh.NewUUID()
+	if err := memoryRepo.Save(ctx, id3, &mocks.SimpleModel{ID: id3}); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	model, err = repo.Find(ctx, id3)
+	if !errors.Is(err, ErrIncorrectModelType) {
+		t.Error("there should be a ErrIncorrectModelType error:", err)
+	}
+	if err.Error() != "incorrect model type: *mocks.SimpleModel is not *mocks.Model (default)" {
+		t.Error("the error should be correct:", err)
+	}
+	if model != nil {
+		t.Error("there should be no model:", model)
+	}
+
+	t.Log("FindAll with incorrect model type")
+	models, err = repo.FindAll(ctx)
+	if !errors.Is(err, ErrIncorrectModelType) {
+		t.Error("there should be a ErrIncorrectModelType error:", err)
+	}
+	if models != nil {
+		t.Error("there should be no models:", models)
+	}
+
+	t.Log("Remove one item")
+	if err := repo.Remove(ctx, id1); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if _, err := repo.Find(ctx, id1); !errors.Is(err, eh.ErrModelNotFound) {
+		t.Error("there should be a ErrModelNotFound error:", err)
+	}
+}
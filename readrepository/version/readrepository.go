@@ -124,10 +124,7 @@ func (r *ReadRepository) findMinVersion(ctx context.Context, id eh.UUID, minVers
 
 // Versionable is a read model that has a version number saved, used by
 // ReadRepository.FindMinVersion().
-type Versionable interface {
-	// AggregateVersion returns the aggregate version that a read model represents.
-	AggregateVersion() int
-}
+type Versionable = eh.Versionable
 
 type contextKey int
 
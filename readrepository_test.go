@@ -0,0 +1,68 @@
+// Copyright (c) 2016 - Max Ekman <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package eventhorizon
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestReadRepositoryError(t *testing.T) {
+	baseErr := TestBaseError{"base"}
+	var err error = ReadRepositoryError{
+		Err:       ErrModelNotFound,
+		BaseErr:   baseErr,
+		Namespace: "ns",
+	}
+
+	t.Log("match with a type assertion")
+	if rrErr, ok := err.(ReadRepositoryError); !ok || rrErr.Err != ErrModelNotFound {
+		t.Error("there should be a ErrModelNotFound error:", err)
+	}
+
+	t.Log("match with errors.Is and errors.As")
+	if !errors.Is(err, ErrModelNotFound) {
+		t.Error("there should be a ErrModelNotFound error:", err)
+	}
+	if !errors.Is(err, baseErr) {
+		t.Error("there should be a base error:", err)
+	}
+	var tbErr TestBaseError
+	if !errors.As(err, &tbErr) || tbErr != baseErr {
+		t.Error("the base error should be found:", err)
+	}
+}
+
+func TestCursor(t *testing.T) {
+	id := NewUUID()
+	cursor := EncodeCursor(id)
+	if cursor == string(id) {
+		t.Error("the cursor should be encoded:", cursor)
+	}
+	decoded, err := DecodeCursor(cursor)
+	if err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if decoded != id {
+		t.Error("the id should be correct:", decoded)
+	}
+
+	if _, err := DecodeCursor("not a cursor"); err != ErrInvalidCursor {
+		t.Error("there should be a ErrInvalidCursor error:", err)
+	}
+	if _, err := DecodeCursor(EncodeCursor("not an id")); err != ErrInvalidCursor {
+		t.Error("there should be a ErrInvalidCursor error:", err)
+	}
+}
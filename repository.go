@@ -28,6 +28,50 @@ var ErrInvalidEventBus = errors.New("invalid event bus")
 // ErrMismatchedEventType occurs when loaded events from ID does not match aggregate type.
 var ErrMismatchedEventType = errors.New("mismatched event type and aggregate type")
 
+// ErrCouldNotPublishEvents is when the events of an aggregate were saved, but
+// could not be published.
+var ErrCouldNotPublishEvents = errors.New("could not publish events")
+
+// ErrCouldNotSaveSnapshot is when the events of an aggregate were saved and
+// published, but the snapshot of the aggregate could not be saved.
+var ErrCouldNotSaveSnapshot = errors.New("could not save snapshot")
+
+// RepositoryError is an error in the repository, with the namespace.
+type RepositoryError struct {
+	// Err is the error.
+	Err error
+	// BaseErr is an optional underlying error, for example from the event bus.
+	BaseErr error
+	// Namespace is the namespace for the error.
+	Namespace string
+}
+
+// Error implements the Error method of the errors.Error interface.
+func (e RepositoryError) Error() string {
+	errStr := e.Err.Error()
+	if e.BaseErr != nil {
+		errStr += ": " + e.BaseErr.Error()
+	}
+	return errStr + " (" + e.Namespace + ")"
+}
+
+// Unwrap returns the error, so that it can be matched with errors.Is and
+// errors.As.
+func (e RepositoryError) Unwrap() error {
+	return e.Err
+}
+
+// Is reports whether the base error matches the target, as errors.Is only
+// follows the error returned by Unwrap.
+func (e RepositoryError) Is(target error) bool {
+	return e.BaseErr != nil && errors.Is(e.BaseErr, target)
+}
+
+// As finds the first error in the base error that matches the target.
+func (e RepositoryError) As(target interface{}) bool {
+	return e.BaseErr != nil && errors.As(e.BaseErr, target)
+}
+
 // Repository is a repository responsible for loading and saving aggregates.
 type Repository interface {
 	// Load loads the most recent version of an aggregate with a type and id.
@@ -40,25 +84,45 @@ type Repository interface {
 // EventSourcingRepository is an aggregate repository using event sourcing. It
 // uses an event store for loading and saving events used to build the aggregate.
 type EventSourcingRepository struct {
-	eventStore EventStore
-	eventBus   EventBus
+	eventStore     EventStore
+	eventPublisher EventPublisher
+	snapshotEvery  int
+}
+
+// EventSourcingRepositoryOption is an option setter used to configure a
+// EventSourcingRepository.
+type EventSourcingRepositoryOption func(*EventSourcingRepository)
+
+// WithSnapshotEvery saves a snapshot of an aggregate when its version passes a
+// multiple of n events when it is saved. Snapshots are only saved for
+// aggregates implementing SnapshotAggregate, if the event store is a
+// SnapshotStore.
+func WithSnapshotEvery(n int) EventSourcingRepositoryOption {
+	return func(r *EventSourcingRepository) {
+		r.snapshotEvery = n
+	}
 }
 
 // NewEventSourcingRepository creates a repository that will use an event store
-// and bus.
-func NewEventSourcingRepository(eventStore EventStore, eventBus EventBus) (*EventSourcingRepository, error) {
+// and a publisher, usually an event bus, for the saved events.
+func NewEventSourcingRepository(eventStore EventStore, eventPublisher EventPublisher, opts ...EventSourcingRepositoryOption) (*EventSourcingRepository, error) {
 	if eventStore == nil {
 		return nil, ErrInvalidEventStore
 	}
 
-	if eventBus == nil {
+	if eventPublisher == nil {
 		return nil, ErrInvalidEventBus
 	}
 
 	d := &EventSourcingRepository{
-		eventStore: eventStore,
-		eventBus:   eventBus,
+		eventStore:     eventStore,
+		eventPublisher: eventPublisher,
+	}
+
+	for _, opt := range opts {
+		opt(d)
 	}
+
 	return d, nil
 }
 
@@ -72,30 +136,114 @@ func (r *EventSourcingRepository) Load(ctx context.Context, aggregateType Aggreg
 		return nil, err
 	}
 
-	// Load aggregate events.
-	events, err := r.eventStore.Load(ctx, aggregate.AggregateType(), aggregate.AggregateID())
+	// Restore the aggregate from a snapshot if possible.
+	snapshotVersion, err := r.applySnapshot(ctx, aggregate)
+	if err != nil {
+		return nil, err
+	}
+
+	// Load aggregate events, only the ones after the snapshot if possible.
+	var events []Event
+	if loader, ok := r.eventStore.(EventStoreVersionLoader); ok && snapshotVersion > 0 {
+		events, err = loader.LoadFrom(ctx, aggregate.AggregateType(), aggregate.AggregateID(), snapshotVersion+1)
+	} else {
+		events, err = r.eventStore.Load(ctx, aggregate.AggregateType(), aggregate.AggregateID())
+	}
 	if err != nil {
 		return nil, err
 	}
 
 	// Apply the events.
 	for _, event := range events {
-		if event.AggregateType() != aggregateType {
+		if ResolveAggregateType(event.AggregateType()) != aggregateType {
 			return nil, ErrMismatchedEventType
 		}
 
+		// Skip events that are already part of the snapshot.
+		if event.Version() <= snapshotVersion {
+			continue
+		}
+
 		aggregate.ApplyEvent(ctx, event)
 	}
 
 	return aggregate, nil
 }
 
-// Save saves all uncommitted events from an aggregate to the event store.
+// LoadVersion loads an aggregate as it was at a version, by only loading and
+// applying the events up to the version with WithMaxEvents. Snapshots are not
+// used, as they can be of a later version. The loaded aggregate is of an
+// earlier state and should not be saved.
+func (r *EventSourcingRepository) LoadVersion(ctx context.Context, aggregateType AggregateType, id UUID, version int) (Aggregate, error) {
+	aggregate, err := CreateAggregate(aggregateType, id)
+	if err != nil {
+		return nil, err
+	}
+	if version <= 0 {
+		return aggregate, nil
+	}
+
+	events, err := r.eventStore.Load(ctx, aggregate.AggregateType(), aggregate.AggregateID(), WithMaxEvents(version))
+	if err != nil {
+		return nil, err
+	}
+
+	for _, event := range events {
+		if ResolveAggregateType(event.AggregateType()) != aggregateType {
+			return nil, ErrMismatchedEventType
+		}
+
+		// Skip events after the version, for stores that compact or
+		// renumber events.
+		if event.Version() > version {
+			break
+		}
+
+		aggregate.ApplyEvent(ctx, event)
+	}
+
+	return aggregate, nil
+}
+
+// applySnapshot applies the latest snapshot to the aggregate if both the
+// aggregate and the event store supports snapshots. It returns the version of
+// the applied snapshot, or 0 if none was applied.
+func (r *EventSourcingRepository) applySnapshot(ctx context.Context, aggregate Aggregate) (int, error) {
+	snapshotAggregate, ok := aggregate.(SnapshotAggregate)
+	if !ok {
+		return 0, nil
+	}
+	snapshotStore, ok := r.eventStore.(SnapshotStore)
+	if !ok {
+		return 0, nil
+	}
+
+	state, version, err := snapshotStore.LoadSnapshot(ctx, aggregate.AggregateType(), aggregate.AggregateID())
+	if errors.Is(err, ErrSnapshotsNotSupported) {
+		return 0, nil
+	} else if err != nil {
+		return 0, err
+	}
+	if state == nil {
+		return 0, nil
+	}
+
+	snapshotAggregate.ApplySnapshot(ctx, version, state)
+
+	return version, nil
+}
+
+// Save saves all uncommitted events from an aggregate to the event store, and
+// then publishes them in order. The events are only published if they could be
+// saved. If publishing fails the events are still saved, and a RepositoryError
+// with ErrCouldNotPublishEvents is returned. A snapshot is saved after the
+// events are published if configured with WithSnapshotEvery.
 func (r *EventSourcingRepository) Save(ctx context.Context, aggregate Aggregate) error {
 	uncommittedEvents := aggregate.UncommittedEvents()
 	if len(uncommittedEvents) < 1 {
 		return nil
 	}
+	originalVersion := aggregate.Version()
 
 	// Store events, check for error after publishing on the bus.
 	if err := r.eventStore.Save(ctx, uncommittedEvents, aggregate.Version()); err != nil {
@@ -112,12 +260,52 @@ func (r *EventSourcingRepository) Save(ctx context.Context, aggregate Aggregate)
 		aggregate.ApplyEvent(ctx, event)
 	}
 
-	// Publish all events on the bus.
+	// The events are saved, don't save them again even if publishing fails.
+	aggregate.ClearUncommittedEvents()
+
+	// Publish all events on the bus, stop at the first failure to not publish
+	// the later events out of order.
 	for _, event := range uncommittedEvents {
-		r.eventBus.PublishEvent(ctx, event)
+		if err := r.eventPublisher.PublishEvent(ctx, event); err != nil {
+			return RepositoryError{
+				Err:       ErrCouldNotPublishEvents,
+				BaseErr:   err,
+				Namespace: Namespace(ctx),
+			}
+		}
 	}
 
-	aggregate.ClearUncommittedEvents()
+	if err := r.saveSnapshot(ctx, aggregate, originalVersion); err != nil {
+		return RepositoryError{
+			Err:       ErrCouldNotSaveSnapshot,
+			BaseErr:   err,
+			Namespace: Namespace(ctx),
+		}
+	}
 
 	return nil
 }
+
+// saveSnapshot saves a snapshot of the aggregate if the version passed a
+// multiple of the snapshot frequency since the original version, and if both
+// the aggregate and the event store supports snapshots.
+func (r *EventSourcingRepository) saveSnapshot(ctx context.Context, aggregate Aggregate, originalVersion int) error {
+	if r.snapshotEvery < 1 || aggregate.Version()/r.snapshotEvery == originalVersion/r.snapshotEvery {
+		return nil
+	}
+	snapshotAggregate, ok := aggregate.(SnapshotAggregate)
+	if !ok {
+		return nil
+	}
+	snapshotStore, ok := r.eventStore.(SnapshotStore)
+	if !ok {
+		return nil
+	}
+
+	err := snapshotStore.SaveSnapshot(ctx, aggregate.AggregateType(), aggregate.AggregateID(),
+		aggregate.Version(), snapshotAggregate.SnapshotState())
+	if errors.Is(err, ErrSnapshotsNotSupported) {
+		return nil
+	}
+	return err
+}
@@ -17,6 +17,7 @@ package eventhorizon
 import (
 	"context"
 	"errors"
+	"fmt"
 	"reflect"
 	"testing"
 )
@@ -102,6 +103,41 @@ func TestEventSourcingRepositoryLoadEvents(t *testing.T) {
 	}
 }
 
+func TestEventSourcingRepositoryLoadVersion(t *testing.T) {
+	repo, store, _ := createRepoAndStore(t)
+
+	ctx := context.Background()
+
+	id := NewUUID()
+	agg := NewTestAggregate(id)
+	event1 := agg.NewEvent(TestEventType, &TestEventData{"event1"})
+	agg.ApplyEvent(ctx, event1) // Apply event to increment the aggregate version.
+	event2 := agg.NewEvent(TestEventType, &TestEventData{"event2"})
+	agg.ApplyEvent(ctx, event2) // Apply event to increment the aggregate version.
+	event3 := agg.NewEvent(TestEventType, &TestEventData{"event3"})
+	store.Save(ctx, []Event{event1, event2, event3}, 0)
+
+	t.Log("load an earlier version")
+	loadedAgg, err := repo.LoadVersion(ctx, TestAggregateType, id, 2)
+	if err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	if loadedAgg.Version() != 2 {
+		t.Error("the version should be 2:", loadedAgg.Version())
+	}
+	if loadedAgg.(*TestAggregate).appliedEvent != event2 {
+		t.Error("the last applied event should be correct:", loadedAgg.(*TestAggregate).appliedEvent)
+	}
+
+	t.Log("load version 0")
+	if loadedAgg, err = repo.LoadVersion(ctx, TestAggregateType, id, 0); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	if loadedAgg.Version() != 0 {
+		t.Error("the version should be 0:", loadedAgg.Version())
+	}
+}
+
 func TestEventSourcingRepositoryLoadEventsMismatchedEventType(t *testing.T) {
 	repo, store, _ := createRepoAndStore(t)
 
@@ -126,6 +162,108 @@ func TestEventSourcingRepositoryLoadEventsMismatchedEventType(t *testing.T) {
 	}
 }
 
+func TestEventSourcingRepositoryLoadAliasedAggregateType(t *testing.T) {
+	repo, store, _ := createRepoAndStore(t)
+
+	ctx := context.Background()
+
+	id := NewUUID()
+	oldAgg := NewAggregateBase("TestAggregateOldName", id)
+	event1 := oldAgg.NewEvent(TestEventType, &TestEventData{"event1"})
+	store.Save(ctx, []Event{event1}, 0)
+
+	AliasAggregateType("TestAggregateOldName", TestAggregateType)
+	loadedAgg, err := repo.Load(ctx, TestAggregateType, id)
+	if err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	if loadedAgg.(*TestAggregate).appliedEvent != event1 {
+		t.Error("the event should be correct:", loadedAgg.(*TestAggregate).appliedEvent)
+	}
+}
+
+func TestEventSourcingRepositoryLoadSnapshot(t *testing.T) {
+	repo, store, _ := createRepoAndStore(t)
+
+	ctx := context.Background()
+
+	id := NewUUID()
+	agg := NewTestSnapshotAggregate(id)
+	event1 := agg.NewEvent(TestEventType, &TestEventData{"event1"})
+	agg.ApplyEvent(ctx, event1)
+	event2 := agg.NewEvent(TestEventType, &TestEventData{"event2"})
+	agg.ApplyEvent(ctx, event2)
+	event3 := agg.NewEvent(TestEventType, &TestEventData{"event3"})
+	agg.ApplyEvent(ctx, event3)
+	store.Save(ctx, []Event{event1, event2, event3}, 0)
+
+	t.Log("load without snapshot")
+	loadedAgg, err := repo.Load(ctx, TestSnapshotAggregateType, id)
+	if err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	if loadedAgg.Version() != 3 {
+		t.Error("the version should be 3:", loadedAgg.Version())
+	}
+	if events := loadedAgg.(*TestSnapshotAggregate).appliedEvents; len(events) != 3 {
+		t.Error("there should be 3 applied events:", events)
+	}
+
+	t.Log("load with snapshot")
+	store.Snapshot = "snapshot2"
+	store.SnapshotVersion = 2
+	loadedAgg, err = repo.Load(ctx, TestSnapshotAggregateType, id)
+	if err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	if loadedAgg.Version() != 3 {
+		t.Error("the version should be 3:", loadedAgg.Version())
+	}
+	if store.LoadedFrom != 3 {
+		t.Error("the events should be loaded from version 3:", store.LoadedFrom)
+	}
+	events := loadedAgg.(*TestSnapshotAggregate).appliedEvents
+	if !reflect.DeepEqual(events, []Event{event3}) {
+		t.Error("only the event after the snapshot should be applied:", events)
+	}
+	if state := loadedAgg.(*TestSnapshotAggregate).state; state != "event3" {
+		t.Error("the state should be correct:", state)
+	}
+
+	t.Log("load with snapshot of the latest version")
+	store.Snapshot = "snapshot3"
+	store.SnapshotVersion = 3
+	loadedAgg, err = repo.Load(ctx, TestSnapshotAggregateType, id)
+	if err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	if loadedAgg.Version() != 3 {
+		t.Error("the version should be 3:", loadedAgg.Version())
+	}
+	if events := loadedAgg.(*TestSnapshotAggregate).appliedEvents; len(events) != 0 {
+		t.Error("there should be no applied events:", events)
+	}
+	if state := loadedAgg.(*TestSnapshotAggregate).state; state != "snapshot3" {
+		t.Error("the state should be correct:", state)
+	}
+
+	t.Log("load with a wrapped snapshots not supported error")
+	store.snapshotErr = fmt.Errorf("%w: %w", ErrSnapshotsNotSupported, errors.New("base error"))
+	loadedAgg, err = repo.Load(ctx, TestSnapshotAggregateType, id)
+	if err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	if events := loadedAgg.(*TestSnapshotAggregate).appliedEvents; len(events) != 3 {
+		t.Error("all events should be applied:", events)
+	}
+	store.snapshotErr = nil
+
+	store.err = errors.New("error")
+	if _, err = repo.Load(ctx, TestSnapshotAggregateType, id); err == nil || err.Error() != "error" {
+		t.Error("there should be an error named 'error':", err)
+	}
+}
+
 func TestEventSourcingRepositorySaveEvents(t *testing.T) {
 	repo, store, bus := createRepoAndStore(t)
 
@@ -168,6 +306,57 @@ func TestEventSourcingRepositorySaveEvents(t *testing.T) {
 	}
 }
 
+func TestEventSourcingRepositorySaveEventsVersionConflict(t *testing.T) {
+	repo, store, bus := createRepoAndStore(t)
+
+	ctx := context.Background()
+
+	id := NewUUID()
+	agg := NewTestAggregate(id)
+	event1 := agg.NewEvent(TestEventType, &TestEventData{"event"})
+	agg.StoreEvent(event1)
+	store.err = EventStoreError{
+		Err:       ErrIncorrectEventVersion,
+		Namespace: Namespace(ctx),
+	}
+	err := repo.Save(ctx, agg)
+	if esErr, ok := err.(EventStoreError); !ok || esErr.Err != ErrIncorrectEventVersion {
+		t.Error("there should be a ErrIncorrectEventVersion error:", err)
+	}
+	if len(bus.Events) != 0 {
+		t.Error("there should be no events on the bus:", bus.Events)
+	}
+	if len(agg.UncommittedEvents()) != 1 {
+		t.Error("there should be an uncommitted event:", agg.UncommittedEvents())
+	}
+}
+
+func TestEventSourcingRepositorySavePublishError(t *testing.T) {
+	repo, store, bus := createRepoAndStore(t)
+
+	ctx := context.Background()
+
+	id := NewUUID()
+	agg := NewTestAggregate(id)
+	event1 := agg.NewEvent(TestEventType, &TestEventData{"event"})
+	agg.StoreEvent(event1)
+	publishErr := errors.New("publish error")
+	bus.err = publishErr
+	err := repo.Save(ctx, agg)
+	if rErr, ok := err.(RepositoryError); !ok || rErr.Err != ErrCouldNotPublishEvents || rErr.BaseErr != publishErr {
+		t.Error("there should be a ErrCouldNotPublishEvents error:", err)
+	}
+	if !errors.Is(err, ErrCouldNotPublishEvents) || !errors.Is(err, publishErr) {
+		t.Error("the errors should match with errors.Is:", err)
+	}
+	if !reflect.DeepEqual(store.Events, []Event{event1}) {
+		t.Error("the event should be stored:", store.Events)
+	}
+	if len(agg.UncommittedEvents()) != 0 {
+		t.Error("there should be no uncommitted events:", agg.UncommittedEvents())
+	}
+}
+
 func TestEventSourcingRepositoryAggregateNotRegistered(t *testing.T) {
 	repo, _, _ := createRepoAndStore(t)
 
@@ -183,6 +372,74 @@ func TestEventSourcingRepositoryAggregateNotRegistered(t *testing.T) {
 	}
 }
 
+func TestEventSourcingRepositorySaveSnapshotEvery(t *testing.T) {
+	store := &MockEventStore{
+		Events: make([]Event, 0),
+	}
+	bus := &MockEventBus{
+		Events: make([]Event, 0),
+	}
+	repo, err := NewEventSourcingRepository(store, bus, WithSnapshotEvery(2))
+	if err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+
+	ctx := context.Background()
+
+	t.Log("save 2N+1 events")
+	id := NewUUID()
+	agg := NewTestSnapshotAggregate(id)
+	for i := 1; i <= 5; i++ {
+		agg.StoreEvent(agg.NewEvent(TestEventType, &TestEventData{fmt.Sprintf("event%d", i)}))
+		if err := repo.Save(ctx, agg); err != nil {
+			t.Fatal("there should be no error:", err)
+		}
+	}
+	if !reflect.DeepEqual(store.SavedSnapshots, []int{2, 4}) {
+		t.Error("there should be snapshots at version 2 and 4:", store.SavedSnapshots)
+	}
+	if store.Snapshot != "event4" {
+		t.Error("the snapshot state should be correct:", store.Snapshot)
+	}
+
+	t.Log("save with a wrapped snapshots not supported error")
+	store.snapshotErr = fmt.Errorf("%w: %w", ErrSnapshotsNotSupported, errors.New("base error"))
+	agg.StoreEvent(agg.NewEvent(TestEventType, &TestEventData{"event6"}))
+	if err := repo.Save(ctx, agg); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	store.snapshotErr = nil
+
+	t.Log("save aggregate without snapshot support")
+	store.SavedSnapshots = nil
+	agg2 := NewTestAggregate(NewUUID())
+	for i := 1; i <= 2; i++ {
+		agg2.StoreEvent(agg2.NewEvent(TestEventType, &TestEventData{"event"}))
+		if err := repo.Save(ctx, agg2); err != nil {
+			t.Fatal("there should be no error:", err)
+		}
+	}
+	if len(store.SavedSnapshots) != 0 {
+		t.Error("there should be no snapshots:", store.SavedSnapshots)
+	}
+
+	t.Log("save without snapshot frequency")
+	repo, err = NewEventSourcingRepository(store, bus)
+	if err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	agg3 := NewTestSnapshotAggregate(NewUUID())
+	for i := 1; i <= 2; i++ {
+		agg3.StoreEvent(agg3.NewEvent(TestEventType, &TestEventData{"event"}))
+		if err := repo.Save(ctx, agg3); err != nil {
+			t.Fatal("there should be no error:", err)
+		}
+	}
+	if len(store.SavedSnapshots) != 0 {
+		t.Error("there should be no snapshots:", store.SavedSnapshots)
+	}
+}
+
 func createRepoAndStore(t *testing.T) (*EventSourcingRepository, *MockEventStore, *MockEventBus) {
 	store := &MockEventStore{
 		Events: make([]Event, 0),
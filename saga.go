@@ -16,7 +16,9 @@ package eventhorizon
 
 import (
 	"context"
-	"log"
+	"errors"
+	"sync"
+	"time"
 )
 
 // Saga is an interface for a CQRS saga that listens to events and generate
@@ -33,36 +35,236 @@ type Saga interface {
 // SagaType is the type of a saga, used as its unique identifier.
 type SagaType string
 
+// StatefulSaga is a saga that keeps state per saga instance, for example per
+// order in an order process. The state is loaded from a SagaRepository before
+// every event and saved after it, so that in-flight sagas continue where they
+// were after a restart.
+type StatefulSaga interface {
+	// SagaType returns the type of the saga.
+	SagaType() SagaType
+
+	// SagaID returns the id of the saga instance that handles an event. Events
+	// with an empty id are not handled by the saga.
+	SagaID(Event) UUID
+
+	// NewSagaState creates the empty state of a new saga instance, as a
+	// pointer that the saved state can be loaded into.
+	NewSagaState() interface{}
+
+	// RunSagaWithState handles an event in the saga instance that can return
+	// commands. Changes to the state are saved after the event is handled.
+	RunSagaWithState(ctx context.Context, state interface{}, event Event) []Command
+}
+
 // SagaHandler is a CQRS saga handler to run a Saga implementation.
 type SagaHandler struct {
+	sagaType   SagaType
 	saga       Saga
 	commandBus CommandBus
+
+	stateful StatefulSaga
+	repo     SagaRepository
+	stateMu  sync.Mutex
+
+	attempts   int
+	minBackoff time.Duration
+	maxBackoff time.Duration
+	onFailure  func(context.Context, Command, error)
+
+	queue   chan queuedCommand
+	queueWg sync.WaitGroup
+}
+
+// SagaHandlerOption is an option setter used to configure a SagaHandler.
+type SagaHandlerOption func(*SagaHandler)
+
+// WithCommandRetries retries commands that fail to be dispatched, up to a
+// number of attempts in total. The wait between attempts starts at minBackoff
+// and is doubled for every attempt, up to maxBackoff.
+func WithCommandRetries(attempts int, minBackoff, maxBackoff time.Duration) SagaHandlerOption {
+	return func(s *SagaHandler) {
+		s.attempts = attempts
+		s.minBackoff = minBackoff
+		s.maxBackoff = maxBackoff
+	}
+}
+
+// WithCommandQueue dispatches the commands asynchronously from a queue with
+// a size, HandleEvent blocks only when the queue is full. Commands that fail
+// are not returned from HandleEvent, use WithCommandFailureHandler to get
+// notified about them.
+func WithCommandQueue(size int) SagaHandlerOption {
+	return func(s *SagaHandler) {
+		s.queue = make(chan queuedCommand, size)
+	}
+}
+
+// WithCommandFailureHandler sets a callback that is called for every command
+// that could not be dispatched, after all attempts.
+func WithCommandFailureHandler(f func(context.Context, Command, error)) SagaHandlerOption {
+	return func(s *SagaHandler) {
+		s.onFailure = f
+	}
+}
+
+// queuedCommand is a command with its context in the command queue.
+type queuedCommand struct {
+	ctx     context.Context
+	command Command
 }
 
 // NewSagaHandler creates a new SagaHandler.
-func NewSagaHandler(saga Saga, commandBus CommandBus) *SagaHandler {
-	return &SagaHandler{
-		saga:       saga,
+func NewSagaHandler(saga Saga, commandBus CommandBus, opts ...SagaHandlerOption) *SagaHandler {
+	s := newSagaHandler(saga.SagaType(), commandBus, opts...)
+	s.saga = saga
+	return s
+}
+
+// NewStatefulSagaHandler creates a new SagaHandler for a saga with the state
+// of its instances saved in a repository.
+func NewStatefulSagaHandler(saga StatefulSaga, repo SagaRepository, commandBus CommandBus, opts ...SagaHandlerOption) *SagaHandler {
+	s := newSagaHandler(saga.SagaType(), commandBus, opts...)
+	s.stateful = saga
+	s.repo = repo
+	return s
+}
+
+func newSagaHandler(sagaType SagaType, commandBus CommandBus, opts ...SagaHandlerOption) *SagaHandler {
+	s := &SagaHandler{
+		sagaType:   sagaType,
 		commandBus: commandBus,
+		attempts:   1,
+	}
+
+	for _, opt := range opts {
+		opt(s)
+	}
+
+	if s.attempts < 1 {
+		s.attempts = 1
+	}
+	if s.maxBackoff < s.minBackoff {
+		s.maxBackoff = s.minBackoff
+	}
+
+	if s.queue != nil {
+		s.queueWg.Add(1)
+		go func() {
+			defer s.queueWg.Done()
+			for c := range s.queue {
+				s.dispatch(c.ctx, c.command)
+			}
+		}()
 	}
+
+	return s
 }
 
 // HandleEvent implements the HandleEvent method of the EventHandler interface.
-func (s *SagaHandler) HandleEvent(ctx context.Context, event Event) {
+// All commands are dispatched even if some of them fail, the first error is
+// returned. With a command queue the commands are only queued. For stateful
+// sagas the state is saved before the commands are dispatched, an error to
+// load or save it is returned without dispatching any commands.
+func (s *SagaHandler) HandleEvent(ctx context.Context, event Event) error {
 	// Run the saga and collect commands.
-	commands := s.saga.RunSaga(ctx, event)
+	commands, err := s.runSaga(ctx, event)
+	if err != nil {
+		return err
+	}
+
+	// Queue the commands to be dispatched in order.
+	if s.queue != nil {
+		for _, command := range commands {
+			s.queue <- queuedCommand{ctx, command}
+		}
+		return nil
+	}
 
 	// Dispatch commands back on the command bus.
+	var firstErr error
 	for _, command := range commands {
-		if err := s.commandBus.HandleCommand(ctx, command); err != nil {
-			// TODO: Better error handling.
-			log.Println("could not handle command in saga:", err)
+		if err := s.dispatch(ctx, command); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+
+	return firstErr
+}
+
+// Close stops the command queue, if there is one, after all queued commands
+// have been dispatched. No events can be handled after closing.
+func (s *SagaHandler) Close() {
+	if s.queue != nil {
+		close(s.queue)
+		s.queueWg.Wait()
+	}
+}
+
+// runSaga runs the saga for an event, with the state of the saga instance
+// for stateful sagas. The instances are run one at a time so that the state
+// of an instance is never loaded before the previous event has saved it.
+func (s *SagaHandler) runSaga(ctx context.Context, event Event) ([]Command, error) {
+	if s.stateful == nil {
+		return s.saga.RunSaga(ctx, event), nil
+	}
+
+	id := s.stateful.SagaID(event)
+	if id == "" {
+		return nil, nil
+	}
+
+	s.stateMu.Lock()
+	defer s.stateMu.Unlock()
+
+	state := s.stateful.NewSagaState()
+	if err := s.repo.Load(ctx, s.sagaType, id, state); err != nil && !errors.Is(err, ErrSagaNotFound) {
+		return nil, err
+	}
+
+	commands := s.stateful.RunSagaWithState(ctx, state, event)
+
+	if err := s.repo.Save(ctx, s.sagaType, id, state); err != nil {
+		return nil, err
+	}
+
+	return commands, nil
+}
+
+// dispatch dispatches a command on the command bus, retrying it if it fails.
+// The failure handler is called if all attempts fail.
+func (s *SagaHandler) dispatch(ctx context.Context, command Command) error {
+	backoff := s.minBackoff
+
+	var err error
+attempts:
+	for i := 0; i < s.attempts; i++ {
+		// Wait before retrying, if there is a backoff.
+		if i > 0 && backoff > 0 {
+			select {
+			case <-time.After(backoff):
+			case <-ctx.Done():
+				err = ctx.Err()
+				break attempts
+			}
+			if backoff *= 2; backoff > s.maxBackoff {
+				backoff = s.maxBackoff
+			}
+		}
+
+		if err = s.commandBus.HandleCommand(ctx, command); err == nil {
+			return nil
 		}
 	}
+
+	if s.onFailure != nil {
+		s.onFailure(ctx, command, err)
+	}
+
+	return err
 }
 
 // HandlerType implements the HandlerType method of the EventHandler
 // interface.
 func (s *SagaHandler) HandlerType() EventHandlerType {
-	return EventHandlerType(s.saga.SagaType())
+	return EventHandlerType(s.sagaType)
 }
@@ -16,8 +16,11 @@ package eventhorizon
 
 import (
 	"context"
+	"errors"
 	"reflect"
+	"sync"
 	"testing"
+	"time"
 )
 
 func TestSagaHandler(t *testing.T) {
@@ -33,7 +36,9 @@ func TestSagaHandler(t *testing.T) {
 	agg := NewTestAggregate(id)
 	event := agg.NewEvent(TestEventType, &TestEventData{"event1"})
 	saga.commands = []Command{&TestCommand{NewUUID(), "content"}}
-	sagaHandler.HandleEvent(ctx, event)
+	if err := sagaHandler.HandleEvent(ctx, event); err != nil {
+		t.Error("there should be no error:", err)
+	}
 	if saga.event != event {
 		t.Error("the handled event should be correct:", saga.event)
 	}
@@ -42,6 +47,185 @@ func TestSagaHandler(t *testing.T) {
 	}
 }
 
+func TestSagaHandlerMultipleCommands(t *testing.T) {
+	commandBus := &MockCommandBus{
+		Commands: []Command{},
+	}
+	saga := &TestSaga{}
+	sagaHandler := NewSagaHandler(saga, commandBus)
+
+	id := NewUUID()
+	agg := NewTestAggregate(id)
+	event := agg.NewEvent(TestEventType, &TestEventData{"event1"})
+	saga.commands = []Command{
+		&TestCommand{NewUUID(), "content1"},
+		&TestCommand{NewUUID(), "content2"},
+	}
+	if err := sagaHandler.HandleEvent(context.Background(), event); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if !reflect.DeepEqual(commandBus.Commands, saga.commands) {
+		t.Error("the produced commands should be correct:", commandBus.Commands)
+	}
+}
+
+func TestSagaHandlerRetries(t *testing.T) {
+	commandBus := &FailingCommandBus{failures: 2}
+	saga := &TestSaga{}
+	var failures []error
+	sagaHandler := NewSagaHandler(saga, commandBus,
+		WithCommandRetries(3, time.Millisecond, 10*time.Millisecond),
+		WithCommandFailureHandler(func(ctx context.Context, cmd Command, err error) {
+			failures = append(failures, err)
+		}),
+	)
+
+	id := NewUUID()
+	agg := NewTestAggregate(id)
+	event := agg.NewEvent(TestEventType, &TestEventData{"event1"})
+
+	t.Log("succeed after failing dispatches")
+	saga.commands = []Command{&TestCommand{NewUUID(), "content"}}
+	if err := sagaHandler.HandleEvent(context.Background(), event); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if commandBus.attempts != 3 {
+		t.Error("the command should be dispatched 3 times:", commandBus.attempts)
+	}
+	if !reflect.DeepEqual(commandBus.Commands, saga.commands) {
+		t.Error("the produced commands should be correct:", commandBus.Commands)
+	}
+	if len(failures) != 0 {
+		t.Error("there should be no failures:", failures)
+	}
+
+	t.Log("give up after all attempts")
+	commandBus.failures = 5
+	commandBus.attempts = 0
+	commandBus.Commands = nil
+	if err := sagaHandler.HandleEvent(context.Background(), event); err != errDispatchFailed {
+		t.Error("there should be a dispatch error:", err)
+	}
+	if commandBus.attempts != 3 {
+		t.Error("the command should be dispatched 3 times:", commandBus.attempts)
+	}
+	if len(commandBus.Commands) != 0 {
+		t.Error("there should be no commands:", commandBus.Commands)
+	}
+	if !reflect.DeepEqual(failures, []error{errDispatchFailed}) {
+		t.Error("the failure should be reported:", failures)
+	}
+}
+
+func TestSagaHandlerQueue(t *testing.T) {
+	commandBus := &FailingCommandBus{failures: 2}
+	saga := &TestSaga{}
+	var failuresMu sync.Mutex
+	var failures []error
+	sagaHandler := NewSagaHandler(saga, commandBus,
+		WithCommandQueue(10),
+		WithCommandRetries(3, time.Millisecond, 10*time.Millisecond),
+		WithCommandFailureHandler(func(ctx context.Context, cmd Command, err error) {
+			failuresMu.Lock()
+			defer failuresMu.Unlock()
+			failures = append(failures, err)
+		}),
+	)
+
+	id := NewUUID()
+	agg := NewTestAggregate(id)
+	event := agg.NewEvent(TestEventType, &TestEventData{"event1"})
+	saga.commands = []Command{
+		&TestCommand{NewUUID(), "content1"},
+		&TestCommand{NewUUID(), "content2"},
+	}
+	if err := sagaHandler.HandleEvent(context.Background(), event); err != nil {
+		t.Error("there should be no error:", err)
+	}
+
+	t.Log("dispatch queued commands before closing")
+	sagaHandler.Close()
+	if commandBus.attempts != 4 {
+		t.Error("the commands should be dispatched 4 times:", commandBus.attempts)
+	}
+	if !reflect.DeepEqual(commandBus.Commands, saga.commands) {
+		t.Error("the produced commands should be correct:", commandBus.Commands)
+	}
+	if len(failures) != 0 {
+		t.Error("there should be no failures:", failures)
+	}
+}
+
+func TestStatefulSagaHandler(t *testing.T) {
+	commandBus := &MockCommandBus{
+		Commands: []Command{},
+	}
+	repo := &MockSagaRepository{states: map[UUID]interface{}{}}
+	saga := &TestStatefulSaga{}
+	sagaHandler := NewStatefulSagaHandler(saga, repo, commandBus)
+	if sagaHandler.HandlerType() != EventHandlerType(TestStatefulSagaType) {
+		t.Error("the handler type should be correct:", sagaHandler.HandlerType())
+	}
+
+	ctx := context.Background()
+
+	id := NewUUID()
+	agg := NewTestAggregate(id)
+	event := agg.NewEvent(TestEventType, &TestEventData{"event1"})
+	if err := sagaHandler.HandleEvent(ctx, event); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if !reflect.DeepEqual(repo.states[id], &TestSagaState{Count: 1}) {
+		t.Error("the state should be saved:", repo.states[id])
+	}
+	if err := sagaHandler.HandleEvent(ctx, event); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if !reflect.DeepEqual(repo.states[id], &TestSagaState{Count: 2}) {
+		t.Error("the state should be loaded and saved:", repo.states[id])
+	}
+	if len(commandBus.Commands) != 2 {
+		t.Error("there should be two commands:", commandBus.Commands)
+	}
+
+	t.Log("load error")
+	repo.loadErr = errors.New("load error")
+	if err := sagaHandler.HandleEvent(ctx, event); err != repo.loadErr {
+		t.Error("there should be a load error:", err)
+	}
+	if len(commandBus.Commands) != 2 {
+		t.Error("there should be no new commands:", commandBus.Commands)
+	}
+	repo.loadErr = nil
+
+	t.Log("save error")
+	repo.saveErr = errors.New("save error")
+	if err := sagaHandler.HandleEvent(ctx, event); err != repo.saveErr {
+		t.Error("there should be a save error:", err)
+	}
+	if len(commandBus.Commands) != 2 {
+		t.Error("there should be no new commands:", commandBus.Commands)
+	}
+}
+
+var errDispatchFailed = errors.New("dispatch failed")
+
+// FailingCommandBus is a command bus that fails the first dispatches.
+type FailingCommandBus struct {
+	MockCommandBus
+	failures int
+	attempts int
+}
+
+func (m *FailingCommandBus) HandleCommand(ctx context.Context, command Command) error {
+	m.attempts++
+	if m.failures > 0 {
+		m.failures--
+		return errDispatchFailed
+	}
+	return m.MockCommandBus.HandleCommand(ctx, command)
+}
+
 const (
 	TestSagaType SagaType = "TestSaga"
 )
@@ -61,3 +245,63 @@ func (m *TestSaga) RunSaga(ctx context.Context, event Event) []Command {
 	m.context = ctx
 	return m.commands
 }
+
+const (
+	TestStatefulSagaType SagaType = "TestStatefulSaga"
+)
+
+type TestSagaState struct {
+	Count int
+}
+
+type TestStatefulSaga struct{}
+
+func (m *TestStatefulSaga) SagaType() SagaType {
+	return TestStatefulSagaType
+}
+
+func (m *TestStatefulSaga) SagaID(event Event) UUID {
+	return event.AggregateID()
+}
+
+func (m *TestStatefulSaga) NewSagaState() interface{} {
+	return &TestSagaState{}
+}
+
+func (m *TestStatefulSaga) RunSagaWithState(ctx context.Context, state interface{}, event Event) []Command {
+	state.(*TestSagaState).Count++
+	return []Command{&TestCommand{event.AggregateID(), "content"}}
+}
+
+// MockSagaRepository is a saga repository that keeps copies of the state.
+type MockSagaRepository struct {
+	states  map[UUID]interface{}
+	loadErr error
+	saveErr error
+}
+
+func (m *MockSagaRepository) Save(ctx context.Context, sagaType SagaType, id UUID, state interface{}) error {
+	if m.saveErr != nil {
+		return m.saveErr
+	}
+	s := *state.(*TestSagaState)
+	m.states[id] = &s
+	return nil
+}
+
+func (m *MockSagaRepository) Load(ctx context.Context, sagaType SagaType, id UUID, state interface{}) error {
+	if m.loadErr != nil {
+		return m.loadErr
+	}
+	s, ok := m.states[id]
+	if !ok {
+		return ReadRepositoryError{Err: ErrSagaNotFound}
+	}
+	*state.(*TestSagaState) = *s.(*TestSagaState)
+	return nil
+}
+
+func (m *MockSagaRepository) Remove(ctx context.Context, sagaType SagaType, id UUID) error {
+	delete(m.states, id)
+	return nil
+}
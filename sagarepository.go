@@ -0,0 +1,46 @@
+// Copyright (c) 2016 - Max Ekman <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package eventhorizon
+
+import (
+	"context"
+	"errors"
+)
+
+// ErrSagaNotFound is when no state has been saved for a saga instance.
+var ErrSagaNotFound = errors.New("could not find saga")
+
+// ErrCouldNotSaveSaga is when the state of a saga instance could not be saved.
+var ErrCouldNotSaveSaga = errors.New("could not save saga")
+
+// ErrCouldNotLoadSaga is when the state of a saga instance could not be loaded.
+var ErrCouldNotLoadSaga = errors.New("could not load saga")
+
+// SagaRepository is a repository for the state of saga instances, keyed by
+// the saga type and the id of the instance. Errors are returned as a
+// ReadRepositoryError with the namespace.
+type SagaRepository interface {
+	// Save saves the state of a saga instance, replacing any earlier state.
+	Save(ctx context.Context, sagaType SagaType, id UUID, state interface{}) error
+
+	// Load loads the state of a saga instance into state, which should be a
+	// pointer to the same type that was saved. Returns ErrSagaNotFound if no
+	// state has been saved for the instance.
+	Load(ctx context.Context, sagaType SagaType, id UUID, state interface{}) error
+
+	// Remove removes the state of a saga instance, for example when the saga
+	// has completed. Returns ErrSagaNotFound if there is no saved state.
+	Remove(ctx context.Context, sagaType SagaType, id UUID) error
+}
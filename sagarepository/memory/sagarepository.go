@@ -0,0 +1,112 @@
+// Copyright (c) 2016 - Max Ekman <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package memory
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+
+	eh "github.com/looplab/eventhorizon"
+)
+
+// SagaRepository implements an in memory repository of saga state. The state
+// is saved as JSON, so that loaded state never shares memory with the saved
+// state, the same way as with a DB.
+type SagaRepository struct {
+	// The outer map is with namespace as key, the inner with the saga key.
+	db   map[string]map[sagaKey][]byte
+	dbMu sync.RWMutex
+}
+
+// sagaKey is the key of a saga instance.
+type sagaKey struct {
+	sagaType eh.SagaType
+	id       eh.UUID
+}
+
+// NewSagaRepository creates a new SagaRepository.
+func NewSagaRepository() *SagaRepository {
+	return &SagaRepository{
+		db: map[string]map[sagaKey][]byte{},
+	}
+}
+
+// Save implements the Save method of the eventhorizon.SagaRepository interface.
+func (r *SagaRepository) Save(ctx context.Context, sagaType eh.SagaType, id eh.UUID, state interface{}) error {
+	data, err := json.Marshal(state)
+	if err != nil {
+		return eh.ReadRepositoryError{
+			Err:       eh.ErrCouldNotSaveSaga,
+			BaseErr:   err,
+			Namespace: eh.Namespace(ctx),
+		}
+	}
+
+	ns := eh.Namespace(ctx)
+
+	r.dbMu.Lock()
+	defer r.dbMu.Unlock()
+
+	if _, ok := r.db[ns]; !ok {
+		r.db[ns] = map[sagaKey][]byte{}
+	}
+	r.db[ns][sagaKey{sagaType, id}] = data
+
+	return nil
+}
+
+// Load implements the Load method of the eventhorizon.SagaRepository interface.
+func (r *SagaRepository) Load(ctx context.Context, sagaType eh.SagaType, id eh.UUID, state interface{}) error {
+	r.dbMu.RLock()
+	data, ok := r.db[eh.Namespace(ctx)][sagaKey{sagaType, id}]
+	r.dbMu.RUnlock()
+
+	if !ok {
+		return eh.ReadRepositoryError{
+			Err:       eh.ErrSagaNotFound,
+			Namespace: eh.Namespace(ctx),
+		}
+	}
+
+	if err := json.Unmarshal(data, state); err != nil {
+		return eh.ReadRepositoryError{
+			Err:       eh.ErrCouldNotLoadSaga,
+			BaseErr:   err,
+			Namespace: eh.Namespace(ctx),
+		}
+	}
+
+	return nil
+}
+
+// Remove implements the Remove method of the eventhorizon.SagaRepository interface.
+func (r *SagaRepository) Remove(ctx context.Context, sagaType eh.SagaType, id eh.UUID) error {
+	ns := eh.Namespace(ctx)
+
+	r.dbMu.Lock()
+	defer r.dbMu.Unlock()
+
+	key := sagaKey{sagaType, id}
+	if _, ok := r.db[ns][key]; !ok {
+		return eh.ReadRepositoryError{
+			Err:       eh.ErrSagaNotFound,
+			Namespace: eh.Namespace(ctx),
+		}
+	}
+	delete(r.db[ns], key)
+
+	return nil
+}
@@ -0,0 +1,46 @@
+// Copyright (c) 2016 - Max Ekman <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package memory
+
+import (
+	"context"
+	"testing"
+
+	eh "github.com/looplab/eventhorizon"
+	"github.com/looplab/eventhorizon/sagarepository/testutil"
+)
+
+func TestSagaRepository(t *testing.T) {
+	repo := NewSagaRepository()
+	if repo == nil {
+		t.Fatal("there should be a repository")
+	}
+
+	t.Log("saga repository with default namespace")
+	testutil.SagaRepositoryCommonTests(t, context.Background(), repo)
+
+	t.Log("saga repository with other namespace")
+	ctx := eh.WithNamespace(context.Background(), "ns")
+	testutil.SagaRepositoryCommonTests(t, ctx, repo)
+}
+
+func TestSagaRestart(t *testing.T) {
+	repo := NewSagaRepository()
+	if repo == nil {
+		t.Fatal("there should be a repository")
+	}
+
+	testutil.SagaRestartCommonTests(t, context.Background(), repo)
+}
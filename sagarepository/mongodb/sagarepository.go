@@ -0,0 +1,175 @@
+// Copyright (c) 2016 - Max Ekman <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mongodb
+
+import (
+	"context"
+	"errors"
+
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+
+	eh "github.com/looplab/eventhorizon"
+)
+
+// ErrCouldNotDialDB is when the database could not be dialed.
+var ErrCouldNotDialDB = errors.New("could not dial database")
+
+// ErrNoDBSession is when no database session is set.
+var ErrNoDBSession = errors.New("no database session")
+
+// ErrCouldNotClearDB is when the database could not be cleared.
+var ErrCouldNotClearDB = errors.New("could not clear database")
+
+// SagaRepository implements a MongoDB repository of saga state, with one
+// document per saga instance.
+type SagaRepository struct {
+	session    *mgo.Session
+	dbPrefix   string
+	collection string
+}
+
+// NewSagaRepository creates a new SagaRepository.
+func NewSagaRepository(url, dbPrefix, collection string) (*SagaRepository, error) {
+	session, err := mgo.Dial(url)
+	if err != nil {
+		return nil, ErrCouldNotDialDB
+	}
+
+	session.SetMode(mgo.Strong, true)
+	session.SetSafe(&mgo.Safe{W: 1})
+
+	return NewSagaRepositoryWithSession(session, dbPrefix, collection)
+}
+
+// NewSagaRepositoryWithSession creates a new SagaRepository with a session.
+func NewSagaRepositoryWithSession(session *mgo.Session, dbPrefix, collection string) (*SagaRepository, error) {
+	if session == nil {
+		return nil, ErrNoDBSession
+	}
+
+	r := &SagaRepository{
+		session:    session,
+		dbPrefix:   dbPrefix,
+		collection: collection,
+	}
+
+	return r, nil
+}
+
+// dbSaga is the document of a saga instance.
+type dbSaga struct {
+	ID       string      `bson:"_id"`
+	SagaType eh.SagaType `bson:"saga_type"`
+	SagaID   eh.UUID     `bson:"saga_id"`
+	State    bson.Raw    `bson:"state"`
+}
+
+// Save implements the Save method of the eventhorizon.SagaRepository interface.
+func (r *SagaRepository) Save(ctx context.Context, sagaType eh.SagaType, id eh.UUID, state interface{}) error {
+	sess := r.session.Copy()
+	defer sess.Close()
+
+	doc := bson.M{
+		"_id":       docID(sagaType, id),
+		"saga_type": sagaType,
+		"saga_id":   id,
+		"state":     state,
+	}
+	if _, err := sess.DB(r.dbName(ctx)).C(r.collection).UpsertId(doc["_id"], doc); err != nil {
+		return eh.ReadRepositoryError{
+			Err:       eh.ErrCouldNotSaveSaga,
+			BaseErr:   err,
+			Namespace: eh.Namespace(ctx),
+		}
+	}
+
+	return nil
+}
+
+// Load implements the Load method of the eventhorizon.SagaRepository interface.
+func (r *SagaRepository) Load(ctx context.Context, sagaType eh.SagaType, id eh.UUID, state interface{}) error {
+	sess := r.session.Copy()
+	defer sess.Close()
+
+	var saga dbSaga
+	if err := sess.DB(r.dbName(ctx)).C(r.collection).FindId(docID(sagaType, id)).One(&saga); err == mgo.ErrNotFound {
+		return eh.ReadRepositoryError{
+			Err:       eh.ErrSagaNotFound,
+			Namespace: eh.Namespace(ctx),
+		}
+	} else if err != nil {
+		return eh.ReadRepositoryError{
+			Err:       eh.ErrCouldNotLoadSaga,
+			BaseErr:   err,
+			Namespace: eh.Namespace(ctx),
+		}
+	}
+
+	if err := saga.State.Unmarshal(state); err != nil {
+		return eh.ReadRepositoryError{
+			Err:       eh.ErrCouldNotLoadSaga,
+			BaseErr:   err,
+			Namespace: eh.Namespace(ctx),
+		}
+	}
+
+	return nil
+}
+
+// Remove implements the Remove method of the eventhorizon.SagaRepository interface.
+func (r *SagaRepository) Remove(ctx context.Context, sagaType eh.SagaType, id eh.UUID) error {
+	sess := r.session.Copy()
+	defer sess.Close()
+
+	if err := sess.DB(r.dbName(ctx)).C(r.collection).RemoveId(docID(sagaType, id)); err != nil {
+		return eh.ReadRepositoryError{
+			Err:       eh.ErrSagaNotFound,
+			BaseErr:   err,
+			Namespace: eh.Namespace(ctx),
+		}
+	}
+
+	return nil
+}
+
+// Clear clears the saga database.
+func (r *SagaRepository) Clear(ctx context.Context) error {
+	if err := r.session.DB(r.dbName(ctx)).C(r.collection).DropCollection(); err != nil {
+		return eh.ReadRepositoryError{
+			Err:       ErrCouldNotClearDB,
+			BaseErr:   err,
+			Namespace: eh.Namespace(ctx),
+		}
+	}
+	return nil
+}
+
+// Close closes a database session.
+func (r *SagaRepository) Close() {
+	r.session.Close()
+}
+
+// dbName appends the namespace, if one is set, to the DB prefix to
+// get the name of the DB to use.
+func (r *SagaRepository) dbName(ctx context.Context) string {
+	ns := eh.Namespace(ctx)
+	return r.dbPrefix + "_" + ns
+}
+
+// docID is the document id of a saga instance, unique for all saga types.
+func docID(sagaType eh.SagaType, id eh.UUID) string {
+	return string(sagaType) + ":" + string(id)
+}
@@ -0,0 +1,75 @@
+// Copyright (c) 2016 - Max Ekman <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mongodb
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	eh "github.com/looplab/eventhorizon"
+	"github.com/looplab/eventhorizon/sagarepository/testutil"
+)
+
+func TestSagaRepository(t *testing.T) {
+	// Support Wercker testing with MongoDB.
+	host := os.Getenv("MONGO_PORT_27017_TCP_ADDR")
+	port := os.Getenv("MONGO_PORT_27017_TCP_PORT")
+
+	url := "localhost"
+	if host != "" && port != "" {
+		url = host + ":" + port
+	}
+
+	repo, err := NewSagaRepository(url, "test", "sagas")
+	if err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	if repo == nil {
+		t.Fatal("there should be a repository")
+	}
+	defer repo.Close()
+
+	ctx := eh.WithNamespace(context.Background(), "ns")
+
+	defer func() {
+		t.Log("clearing db")
+		if err = repo.Clear(context.Background()); err != nil {
+			t.Fatal("there should be no error:", err)
+		}
+		if err = repo.Clear(ctx); err != nil {
+			t.Fatal("there should be no error:", err)
+		}
+	}()
+
+	t.Log("saga repository with default namespace")
+	testutil.SagaRepositoryCommonTests(t, context.Background(), repo)
+
+	t.Log("saga repository with other namespace")
+	testutil.SagaRepositoryCommonTests(t, ctx, repo)
+
+	t.Log("restart of a stateful saga")
+	testutil.SagaRestartCommonTests(t, ctx, repo)
+}
+
+func TestNewSagaRepositoryWithSession(t *testing.T) {
+	repo, err := NewSagaRepositoryWithSession(nil, "test", "sagas")
+	if err != ErrNoDBSession {
+		t.Error("there should be a ErrNoDBSession error:", err)
+	}
+	if repo != nil {
+		t.Error("there should be no repository:", repo)
+	}
+}
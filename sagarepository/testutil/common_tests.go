@@ -0,0 +1,222 @@
+// Copyright (c) 2016 - Max Ekman <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package testutil
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strconv"
+	"testing"
+
+	eh "github.com/looplab/eventhorizon"
+	"github.com/looplab/eventhorizon/mocks"
+)
+
+// SagaRepositoryCommonTests are test cases that are common to all
+// implementations of saga repositories.
+func SagaRepositoryCommonTests(t *testing.T, ctx context.Context, repo eh.SagaRepository) {
+	id := eh.NewUUID()
+
+	t.Log("load state that is not saved")
+	state := &SagaState{}
+	err := repo.Load(ctx, SagaType, id, state)
+	if !errors.Is(err, eh.ErrSagaNotFound) {
+		t.Error("there should be a saga not found error:", err)
+	}
+
+	t.Log("save and load state")
+	state1 := &SagaState{Count: 1, Events: []string{"event1"}}
+	if err := repo.Save(ctx, SagaType, id, state1); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	state = &SagaState{}
+	if err := repo.Load(ctx, SagaType, id, state); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if !reflect.DeepEqual(state, state1) {
+		t.Error("the state should be correct:", state)
+	}
+
+	t.Log("loaded state should not change the saved state")
+	state.Events[0] = "changed"
+	state = &SagaState{}
+	if err := repo.Load(ctx, SagaType, id, state); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if !reflect.DeepEqual(state, &SagaState{Count: 1, Events: []string{"event1"}}) {
+		t.Error("the state should be correct:", state)
+	}
+
+	t.Log("save and overwrite state")
+	state2 := &SagaState{Count: 2, Events: []string{"event1", "event2"}}
+	if err := repo.Save(ctx, SagaType, id, state2); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	state = &SagaState{}
+	if err := repo.Load(ctx, SagaType, id, state); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if !reflect.DeepEqual(state, state2) {
+		t.Error("the state should be correct:", state)
+	}
+
+	t.Log("load state of other saga type with same id")
+	err = repo.Load(ctx, OtherSagaType, id, &SagaState{})
+	if !errors.Is(err, eh.ErrSagaNotFound) {
+		t.Error("there should be a saga not found error:", err)
+	}
+
+	t.Log("remove state")
+	if err := repo.Remove(ctx, SagaType, id); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	err = repo.Load(ctx, SagaType, id, &SagaState{})
+	if !errors.Is(err, eh.ErrSagaNotFound) {
+		t.Error("there should be a saga not found error:", err)
+	}
+	err = repo.Remove(ctx, SagaType, id)
+	if !errors.Is(err, eh.ErrSagaNotFound) {
+		t.Error("there should be a saga not found error:", err)
+	}
+	var repoErr eh.ReadRepositoryError
+	if !errors.As(err, &repoErr) || repoErr.Namespace != eh.Namespace(ctx) {
+		t.Error("the error should have the namespace:", err)
+	}
+}
+
+// SagaRestartCommonTests tests that a stateful saga continues with its saved
+// state when the saga handler is restarted in the middle of the saga.
+func SagaRestartCommonTests(t *testing.T, ctx context.Context, repo eh.SagaRepository) {
+	commandBus := &commandBus{}
+	id := eh.NewUUID()
+	agg := mocks.NewAggregate(id)
+
+	t.Log("handle the first events of a saga")
+	saga := &Saga{}
+	handler := eh.NewStatefulSagaHandler(saga, repo, commandBus)
+	for _, content := range []string{"event1", "event2"} {
+		event := agg.NewEvent(mocks.EventType, &mocks.EventData{Content: content})
+		agg.ApplyEvent(ctx, event)
+		if err := handler.HandleEvent(ctx, event); err != nil {
+			t.Error("there should be no error:", err)
+		}
+	}
+
+	t.Log("restore the state after a restart")
+	saga = &Saga{}
+	handler = eh.NewStatefulSagaHandler(saga, repo, commandBus)
+	event := agg.NewEvent(mocks.EventType, &mocks.EventData{Content: "event3"})
+	agg.ApplyEvent(ctx, event)
+	if err := handler.HandleEvent(ctx, event); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	expected := &SagaState{Count: 3, Events: []string{"event1", "event2", "event3"}}
+	if !reflect.DeepEqual(saga.state, expected) {
+		t.Error("the state should be restored before the event:", saga.state)
+	}
+	state := &SagaState{}
+	if err := repo.Load(ctx, SagaType, id, state); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if !reflect.DeepEqual(state, expected) {
+		t.Error("the state should be saved after the event:", state)
+	}
+	if len(commandBus.commands) != 3 {
+		t.Error("there should be three commands:", commandBus.commands)
+	}
+	if cmd, ok := commandBus.commands[2].(*mocks.Command); !ok || cmd.Content != "3" {
+		t.Error("the command should use the restored state:", commandBus.commands[2])
+	}
+
+	t.Log("ignore events without a saga instance")
+	event = agg.NewEvent(mocks.EventOtherType, nil)
+	if err := handler.HandleEvent(ctx, event); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if len(commandBus.commands) != 3 {
+		t.Error("there should be no new commands:", commandBus.commands)
+	}
+
+	if err := repo.Remove(ctx, SagaType, id); err != nil {
+		t.Error("there should be no error:", err)
+	}
+}
+
+const (
+	// SagaType is the saga type used in the tests.
+	SagaType eh.SagaType = "TestSaga"
+	// OtherSagaType is another saga type used in the tests.
+	OtherSagaType eh.SagaType = "OtherTestSaga"
+)
+
+// SagaState is the state of a saga instance used in the tests.
+type SagaState struct {
+	Count  int      `json:"count" bson:"count"`
+	Events []string `json:"events" bson:"events"`
+}
+
+// Saga is a stateful saga that counts the events of an aggregate, with the
+// aggregate ID as saga ID. Only events of mocks.EventType are handled.
+type Saga struct {
+	state *SagaState
+}
+
+// SagaType implements the SagaType method of the eventhorizon.StatefulSaga interface.
+func (s *Saga) SagaType() eh.SagaType {
+	return SagaType
+}
+
+// SagaID implements the SagaID method of the eventhorizon.StatefulSaga interface.
+func (s *Saga) SagaID(event eh.Event) eh.UUID {
+	if event.EventType() != mocks.EventType {
+		return ""
+	}
+	return event.AggregateID()
+}
+
+// NewSagaState implements the NewSagaState method of the
+// eventhorizon.StatefulSaga interface.
+func (s *Saga) NewSagaState() interface{} {
+	return &SagaState{}
+}
+
+// RunSagaWithState implements the RunSagaWithState method of the
+// eventhorizon.StatefulSaga interface.
+func (s *Saga) RunSagaWithState(ctx context.Context, state interface{}, event eh.Event) []eh.Command {
+	s.state = state.(*SagaState)
+	s.state.Count++
+	if data, ok := event.Data().(*mocks.EventData); ok {
+		s.state.Events = append(s.state.Events, data.Content)
+	}
+	return []eh.Command{&mocks.Command{
+		ID:      event.AggregateID(),
+		Content: strconv.Itoa(s.state.Count),
+	}}
+}
+
+// commandBus collects the commands from the saga.
+type commandBus struct {
+	commands []eh.Command
+}
+
+func (b *commandBus) HandleCommand(ctx context.Context, command eh.Command) error {
+	b.commands = append(b.commands, command)
+	return nil
+}
+
+func (b *commandBus) SetHandler(handler eh.CommandHandler, commandType eh.CommandType) error {
+	return nil
+}
@@ -0,0 +1,160 @@
+// Copyright (c) 2016 - Max Ekman <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package eventhorizon
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+)
+
+// ErrNotSnapshotAggregate is when the snapshots of an aggregate type are
+// verified, but the aggregate does not implement SnapshotAggregate.
+var ErrNotSnapshotAggregate = errors.New("aggregate does not support snapshots")
+
+// SnapshotMismatch is an aggregate with a snapshot that does not restore the
+// same state as replaying all of its events, found by VerifySnapshots.
+type SnapshotMismatch struct {
+	// AggregateType is the type of the aggregate.
+	AggregateType AggregateType
+	// AggregateID is the id of the aggregate.
+	AggregateID UUID
+	// SnapshotVersion is the version of the snapshot.
+	SnapshotVersion int
+
+	// SnapshotState and SnapshotStateVersion are the state and version of the
+	// aggregate restored from the snapshot and the events after it.
+	SnapshotState        interface{}
+	SnapshotStateVersion int
+	// ReplayedState and ReplayedVersion are the state and version of the
+	// aggregate replayed from all events.
+	ReplayedState   interface{}
+	ReplayedVersion int
+}
+
+// String returns a description of the mismatch.
+func (m SnapshotMismatch) String() string {
+	return fmt.Sprintf("%s(%s) snapshot@%d: %v@%d, replayed: %v@%d",
+		m.AggregateType, m.AggregateID, m.SnapshotVersion,
+		m.SnapshotState, m.SnapshotStateVersion,
+		m.ReplayedState, m.ReplayedVersion,
+	)
+}
+
+// VerifySnapshots checks the snapshots of all aggregates of a type in the
+// namespace of the context, to find snapshots that have drifted from the
+// events, for example in a maintenance job. Each aggregate with a snapshot is
+// restored from the snapshot and the events after it, and replayed from all
+// events, and the states and versions are compared. The aggregates are found
+// by replaying the events of the type, which requires the event store to be an
+// EventStreamer, and ErrReplayNotSupported is returned otherwise. The
+// aggregates must implement SnapshotAggregate. Returns the aggregates with
+// mismatching snapshots, in the order that they were created.
+func VerifySnapshots(ctx context.Context, store EventStore, snapshotStore SnapshotStore, aggregateType AggregateType) ([]SnapshotMismatch, error) {
+	streamer, ok := store.(EventStreamer)
+	if !ok {
+		return nil, ErrReplayNotSupported
+	}
+
+	ids, err := aggregateIDs(ctx, streamer, aggregateType)
+	if err != nil {
+		return nil, err
+	}
+
+	var mismatches []SnapshotMismatch
+	for _, id := range ids {
+		state, version, err := snapshotStore.LoadSnapshot(ctx, aggregateType, id)
+		if err != nil {
+			return nil, err
+		}
+		if state == nil {
+			continue
+		}
+
+		restored, err := createSnapshotAggregate(aggregateType, id)
+		if err != nil {
+			return nil, err
+		}
+		replayed, err := createSnapshotAggregate(aggregateType, id)
+		if err != nil {
+			return nil, err
+		}
+
+		events, err := store.Load(ctx, aggregateType, id)
+		if err != nil {
+			return nil, err
+		}
+
+		restored.ApplySnapshot(ctx, version, state)
+		for _, event := range events {
+			if event.Version() > version {
+				restored.ApplyEvent(ctx, event)
+			}
+			replayed.ApplyEvent(ctx, event)
+		}
+
+		if restored.Version() != replayed.Version() ||
+			!reflect.DeepEqual(restored.SnapshotState(), replayed.SnapshotState()) {
+			mismatches = append(mismatches, SnapshotMismatch{
+				AggregateType:        aggregateType,
+				AggregateID:          id,
+				SnapshotVersion:      version,
+				SnapshotState:        restored.SnapshotState(),
+				SnapshotStateVersion: restored.Version(),
+				ReplayedState:        replayed.SnapshotState(),
+				ReplayedVersion:      replayed.Version(),
+			})
+		}
+	}
+
+	return mismatches, nil
+}
+
+// aggregateIDs returns the ids of the aggregates of a type with events, in the
+// order of their first events.
+func aggregateIDs(ctx context.Context, store EventStreamer, aggregateType AggregateType) ([]UUID, error) {
+	filter := &ReplayFilter{AggregateType: aggregateType}
+	events, errs := replay(ctx, store, filter)
+	var ids []UUID
+	seen := map[UUID]bool{}
+	for event := range events {
+		if !filter.Match(event) || seen[event.AggregateID()] {
+			continue
+		}
+		seen[event.AggregateID()] = true
+		ids = append(ids, event.AggregateID())
+	}
+
+	if err := <-errs; err != nil {
+		return nil, err
+	}
+
+	return ids, nil
+}
+
+// createSnapshotAggregate creates an aggregate that supports snapshots.
+func createSnapshotAggregate(aggregateType AggregateType, id UUID) (SnapshotAggregate, error) {
+	aggregate, err := CreateAggregate(aggregateType, id)
+	if err != nil {
+		return nil, err
+	}
+	snapshotAggregate, ok := aggregate.(SnapshotAggregate)
+	if !ok {
+		return nil, ErrNotSnapshotAggregate
+	}
+
+	return snapshotAggregate, nil
+}
@@ -0,0 +1,128 @@
+// Copyright (c) 2016 - Max Ekman <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package eventhorizon
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestVerifySnapshots(t *testing.T) {
+	store := &MockEventStore{
+		Events: make([]Event, 0),
+	}
+	ctx := context.Background()
+
+	id := NewUUID()
+	agg := NewTestSnapshotAggregate(id)
+	for _, content := range []string{"event1", "event2", "event3"} {
+		event := agg.NewEvent(TestEventType, &TestEventData{content})
+		agg.ApplyEvent(ctx, event)
+		store.Save(ctx, []Event{event}, event.Version()-1)
+	}
+
+	t.Log("verify aggregates without snapshots")
+	mismatches, err := VerifySnapshots(ctx, store, store, TestSnapshotAggregateType)
+	if err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if len(mismatches) != 0 {
+		t.Error("there should be no mismatches:", mismatches)
+	}
+
+	t.Log("verify a snapshot that is correct")
+	store.Snapshot = "event2"
+	store.SnapshotVersion = 2
+	mismatches, err = VerifySnapshots(ctx, store, store, TestSnapshotAggregateType)
+	if err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if len(mismatches) != 0 {
+		t.Error("there should be no mismatches:", mismatches)
+	}
+
+	t.Log("verify a corrupt snapshot")
+	store.Snapshot = "corrupt"
+	store.SnapshotVersion = 3
+	mismatches, err = VerifySnapshots(ctx, store, store, TestSnapshotAggregateType)
+	if err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if len(mismatches) != 1 {
+		t.Fatal("there should be a mismatch:", mismatches)
+	}
+	expected := SnapshotMismatch{
+		AggregateType:        TestSnapshotAggregateType,
+		AggregateID:          id,
+		SnapshotVersion:      3,
+		SnapshotState:        "corrupt",
+		SnapshotStateVersion: 3,
+		ReplayedState:        "event3",
+		ReplayedVersion:      3,
+	}
+	if mismatches[0] != expected {
+		t.Error("the mismatch should be correct:", mismatches[0])
+	}
+	if s := mismatches[0].String(); s != "TestSnapshotAggregate("+id.String()+") snapshot@3: corrupt@3, replayed: event3@3" {
+		t.Error("the string representation should be correct:", s)
+	}
+
+	t.Log("verify a snapshot of a version without events")
+	store.Snapshot = "event3"
+	store.SnapshotVersion = 4
+	mismatches, err = VerifySnapshots(ctx, store, store, TestSnapshotAggregateType)
+	if err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if len(mismatches) != 1 || mismatches[0].SnapshotStateVersion != 4 || mismatches[0].ReplayedVersion != 3 {
+		t.Error("there should be a version mismatch:", mismatches)
+	}
+
+	t.Log("verify aggregates of another type")
+	mismatches, err = VerifySnapshots(ctx, store, store, TestAggregateType)
+	if err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if len(mismatches) != 0 {
+		t.Error("there should be no mismatches:", mismatches)
+	}
+
+	t.Log("verify with a failing store")
+	store.err = errors.New("error")
+	if _, err := VerifySnapshots(ctx, store, store, TestSnapshotAggregateType); err == nil || err.Error() != "error" {
+		t.Error("there should be an error:", err)
+	}
+}
+
+func TestVerifySnapshotsErrors(t *testing.T) {
+	ctx := context.Background()
+
+	t.Log("verify with a store that can't replay events")
+	store := &MockEventStore{}
+	if _, err := VerifySnapshots(ctx, struct{ EventStore }{store}, store, TestSnapshotAggregateType); err != ErrReplayNotSupported {
+		t.Error("there should be a ErrReplayNotSupported error:", err)
+	}
+
+	t.Log("verify aggregates without snapshot support")
+	agg := NewTestAggregate(NewUUID())
+	event := agg.NewEvent(TestEventType, &TestEventData{"event1"})
+	store.Save(ctx, []Event{event}, 0)
+	store.Snapshot = "snapshot"
+	store.SnapshotVersion = 1
+	if _, err := VerifySnapshots(ctx, store, store, TestAggregateType); err != ErrNotSnapshotAggregate {
+		t.Error("there should be a ErrNotSnapshotAggregate error:", err)
+	}
+}
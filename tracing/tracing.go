@@ -0,0 +1,150 @@
+// Copyright (c) 2016 - Max Ekman <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tracing
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+
+	eh "github.com/looplab/eventhorizon"
+)
+
+// propagator is used to inject and extract the trace context in the event
+// metadata, using the W3C trace context format.
+var propagator = propagation.TraceContext{}
+
+// NewCommandHandlerMiddleware returns a middleware that starts a span, named
+// after the command type, around handling each command.
+func NewCommandHandlerMiddleware(tracer trace.Tracer) eh.CommandHandlerMiddleware {
+	return func(h eh.CommandHandler) eh.CommandHandler {
+		return NewCommandHandler(h, tracer)
+	}
+}
+
+// NewEventHandlerMiddleware returns a middleware that starts a span, named
+// after the event type, around handling each event.
+func NewEventHandlerMiddleware(tracer trace.Tracer) eh.EventHandlerMiddleware {
+	return func(h eh.EventHandler) eh.EventHandler {
+		return NewEventHandler(h, tracer)
+	}
+}
+
+// CommandHandler is a middleware that traces the handling of commands.
+type CommandHandler struct {
+	eh.CommandHandler
+	tracer trace.Tracer
+}
+
+// NewCommandHandler creates a new CommandHandler.
+func NewCommandHandler(handler eh.CommandHandler, tracer trace.Tracer) *CommandHandler {
+	return &CommandHandler{
+		CommandHandler: handler,
+		tracer:         tracer,
+	}
+}
+
+// HandleCommand implements the HandleCommand method of the
+// eventhorizon.CommandHandler interface. The span is passed on in the context,
+// for example to be injected in the events created by the command.
+func (h *CommandHandler) HandleCommand(ctx context.Context, cmd eh.Command) error {
+	ctx, span := h.tracer.Start(ctx, string(cmd.CommandType()),
+		trace.WithSpanKind(trace.SpanKindInternal),
+	)
+	defer span.End()
+
+	err := h.CommandHandler.HandleCommand(ctx, cmd)
+	recordError(span, err)
+	return err
+}
+
+// EventHandler is a middleware that traces the handling of events. The trace
+// context in the event metadata, if any, is used as parent of the span to
+// link it to the span that created the event.
+type EventHandler struct {
+	eh.EventHandler
+	tracer trace.Tracer
+}
+
+// NewEventHandler creates a new EventHandler.
+func NewEventHandler(handler eh.EventHandler, tracer trace.Tracer) *EventHandler {
+	return &EventHandler{
+		EventHandler: handler,
+		tracer:       tracer,
+	}
+}
+
+// HandleEvent implements the HandleEvent method of the
+// eventhorizon.EventHandler interface.
+func (h *EventHandler) HandleEvent(ctx context.Context, event eh.Event) error {
+	if metadata := event.Metadata(); metadata != nil {
+		ctx = propagator.Extract(ctx, metadataCarrier(metadata))
+	}
+	ctx, span := h.tracer.Start(ctx, string(event.EventType()),
+		trace.WithSpanKind(trace.SpanKindConsumer),
+	)
+	defer span.End()
+
+	err := h.EventHandler.HandleEvent(ctx, event)
+	recordError(span, err)
+	return err
+}
+
+// WithTraceContext is an event option that injects the trace context of the
+// span in the context into the event metadata, to be used as parent by the
+// event handlers. Nothing is set if there is no span in the context.
+//
+// An example would be:
+//
+//	a.StoreEvent(a.NewEvent(MyEventType, data, tracing.WithTraceContext(ctx)))
+func WithTraceContext(ctx context.Context) eh.EventOption {
+	metadata := map[string]interface{}{}
+	propagator.Inject(ctx, metadataCarrier(metadata))
+	return eh.WithMetadata(metadata)
+}
+
+// recordError records an error on the span and sets the span status.
+func recordError(span trace.Span, err error) {
+	if err == nil {
+		return
+	}
+	span.RecordError(err)
+	span.SetStatus(codes.Error, err.Error())
+}
+
+// metadataCarrier is a propagation.TextMapCarrier for event metadata.
+type metadataCarrier map[string]interface{}
+
+// Get implements the Get method of the propagation.TextMapCarrier interface.
+func (c metadataCarrier) Get(key string) string {
+	value, _ := c[key].(string)
+	return value
+}
+
+// Set implements the Set method of the propagation.TextMapCarrier interface.
+func (c metadataCarrier) Set(key, value string) {
+	c[key] = value
+}
+
+// Keys implements the Keys method of the propagation.TextMapCarrier interface.
+func (c metadataCarrier) Keys() []string {
+	keys := make([]string, 0, len(c))
+	for k := range c {
+		keys = append(keys, k)
+	}
+	return keys
+}
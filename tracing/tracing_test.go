@@ -0,0 +1,151 @@
+// Copyright (c) 2016 - Max Ekman <max@looplab.se>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tracing
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+
+	eh "github.com/looplab/eventhorizon"
+	"github.com/looplab/eventhorizon/mocks"
+)
+
+func TestCommandHandler(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	tracer := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)).Tracer("test")
+
+	t.Log("handle command")
+	var event eh.Event
+	h := eh.UseCommandHandlerMiddleware(eh.CommandHandlerFunc(func(ctx context.Context, cmd eh.Command) error {
+		event = eh.NewEvent(mocks.EventType, &mocks.EventData{"event1"}, WithTraceContext(ctx))
+		return nil
+	}), NewCommandHandlerMiddleware(tracer))
+	if err := h.HandleCommand(context.Background(), mocks.Command{eh.NewUUID(), "cmd"}); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	spans := recorder.Ended()
+	if len(spans) != 1 {
+		t.Fatal("there should be one span:", spans)
+	}
+	if spans[0].Name() != string(mocks.CommandType) {
+		t.Error("the span should be named after the command type:", spans[0].Name())
+	}
+	if spans[0].Status().Code == codes.Error {
+		t.Error("the span should not have an error status:", spans[0].Status())
+	}
+	if _, ok := event.Metadata()["traceparent"]; !ok {
+		t.Error("the trace context should be injected in the event:", event.Metadata())
+	}
+
+	t.Log("handle command with an error")
+	cmdErr := errors.New("command error")
+	h = eh.UseCommandHandlerMiddleware(eh.CommandHandlerFunc(func(ctx context.Context, cmd eh.Command) error {
+		return cmdErr
+	}), NewCommandHandlerMiddleware(tracer))
+	if err := h.HandleCommand(context.Background(), mocks.Command{eh.NewUUID(), "cmd"}); err != cmdErr {
+		t.Error("there should be a command error:", err)
+	}
+	spans = recorder.Ended()
+	if len(spans) != 2 {
+		t.Fatal("there should be two spans:", spans)
+	}
+	if spans[1].Status().Code != codes.Error || spans[1].Status().Description != "command error" {
+		t.Error("the span should have an error status:", spans[1].Status())
+	}
+	if len(spans[1].Events()) != 1 || spans[1].Events()[0].Name != "exception" {
+		t.Error("the error should be recorded on the span:", spans[1].Events())
+	}
+}
+
+func TestEventHandler(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	tracer := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)).Tracer("test")
+
+	handler := mocks.NewEventHandler("testHandler")
+	h := eh.UseEventHandlerMiddleware(handler, NewEventHandlerMiddleware(tracer))
+	if h.HandlerType() != "testHandler" {
+		t.Error("the handler type should be kept:", h.HandlerType())
+	}
+
+	t.Log("handle event without trace context")
+	event := eh.NewEvent(mocks.EventType, &mocks.EventData{"event1"})
+	if err := h.HandleEvent(context.Background(), event); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	spans := recorder.Ended()
+	if len(spans) != 1 {
+		t.Fatal("there should be one span:", spans)
+	}
+	if spans[0].Name() != string(mocks.EventType) {
+		t.Error("the span should be named after the event type:", spans[0].Name())
+	}
+	if spans[0].Parent().IsValid() {
+		t.Error("the span should have no parent:", spans[0].Parent())
+	}
+
+	t.Log("handle event with the trace context of a command")
+	cmdHandler := eh.UseCommandHandlerMiddleware(eh.CommandHandlerFunc(func(ctx context.Context, cmd eh.Command) error {
+		event = eh.NewEvent(mocks.EventType, &mocks.EventData{"event2"}, WithTraceContext(ctx))
+		return nil
+	}), NewCommandHandlerMiddleware(tracer))
+	if err := cmdHandler.HandleCommand(context.Background(), mocks.Command{eh.NewUUID(), "cmd"}); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	// Handle the event without the context of the command, like in another
+	// service that receives the event.
+	if err := h.HandleEvent(context.Background(), event); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	spans = recorder.Ended()
+	if len(spans) != 3 {
+		t.Fatal("there should be three spans:", spans)
+	}
+	cmdSpan, eventSpan := spans[1], spans[2]
+	if eventSpan.Parent().SpanID() != cmdSpan.SpanContext().SpanID() {
+		t.Error("the event span should have the command span as parent:", eventSpan.Parent())
+	}
+	if eventSpan.SpanContext().TraceID() != cmdSpan.SpanContext().TraceID() {
+		t.Error("the spans should be in the same trace:", eventSpan.SpanContext().TraceID())
+	}
+	if !eventSpan.Parent().IsRemote() {
+		t.Error("the parent should be remote:", eventSpan.Parent())
+	}
+
+	t.Log("handle event with an error")
+	handler.Err = errors.New("handler error")
+	if err := h.HandleEvent(context.Background(), event); err != handler.Err {
+		t.Error("there should be a handler error:", err)
+	}
+	spans = recorder.Ended()
+	if len(spans) != 4 {
+		t.Fatal("there should be four spans:", spans)
+	}
+	if spans[3].Status().Code != codes.Error {
+		t.Error("the span should have an error status:", spans[3].Status())
+	}
+}
+
+func TestWithTraceContext(t *testing.T) {
+	t.Log("create event without a span in the context")
+	event := eh.NewEvent(mocks.EventType, nil, WithTraceContext(context.Background()))
+	if event.Metadata() != nil {
+		t.Error("there should be no metadata:", event.Metadata())
+	}
+}
@@ -16,9 +16,15 @@ package eventhorizon
 
 import (
 	"crypto/rand"
+	"crypto/sha1"
+	"encoding/binary"
+	"encoding/hex"
 	"errors"
 	"fmt"
 	"regexp"
+	"strings"
+	"sync"
+	"time"
 )
 
 // Pattern used to parse hex string representation of the UUID.
@@ -26,7 +32,7 @@ import (
 // current one allows to parse string with only one opening
 // or closing bracket.
 const hexPattern = "^(urn\\:uuid\\:)?\\{?([a-f0-9]{8})-([a-f0-9]{4})-" +
-	"([1-5][a-f0-9]{3})-([a-f0-9]{4})-([a-f0-9]{12})\\}?$"
+	"([1-8][a-f0-9]{3})-([a-f0-9]{4})-([a-f0-9]{12})\\}?$"
 
 var re = regexp.MustCompile(hexPattern)
 
@@ -34,8 +40,86 @@ var re = regexp.MustCompile(hexPattern)
 // bytes long.
 type UUID string
 
-// NewUUID creates a new UUID of type v4.
+// NewUUID creates a new UUID with the generator set by SetUUIDGenerator, which
+// by default creates UUIDs of type v4.
 func NewUUID() UUID {
+	uuidGeneratorMu.RLock()
+	defer uuidGeneratorMu.RUnlock()
+	return uuidGenerator()
+}
+
+// SetUUIDGenerator sets the generator used by NewUUID, for example
+// NewOrderedUUID to create time ordered ids. The generated ids must be in the
+// format accepted by ParseUUID. A nil generator restores the default v4
+// generator.
+func SetUUIDGenerator(generator func() UUID) {
+	uuidGeneratorMu.Lock()
+	defer uuidGeneratorMu.Unlock()
+	if generator == nil {
+		generator = newUUIDv4
+	}
+	uuidGenerator = generator
+}
+
+var (
+	uuidGenerator   = newUUIDv4
+	uuidGeneratorMu sync.RWMutex
+)
+
+// NewOrderedUUID creates a new UUID of type v7, which starts with the creation
+// time in milliseconds. The ids created by one process are strictly increasing,
+// also when compared as strings, which keeps database indexes from fragmenting.
+func NewOrderedUUID() UUID {
+	var u [16]byte
+
+	// Set the random bits first, the time and sequence overwrite some of them.
+	_, err := rand.Read(u[:])
+	if err != nil {
+		panic(err)
+	}
+
+	orderedMu.Lock()
+	ms := uint64(time.Now().UnixNano() / int64(time.Millisecond))
+	if ms > orderedLastMs {
+		orderedLastMs = ms
+		orderedSeq = 0
+	} else {
+		// Use a 12 bit sequence for ids created in the same millisecond, or
+		// if the clock went backwards, and borrow the next millisecond when
+		// it runs out.
+		orderedSeq++
+		if orderedSeq > 0xFFF {
+			orderedLastMs++
+			orderedSeq = 0
+		}
+	}
+	ms, seq := orderedLastMs, orderedSeq
+	orderedMu.Unlock()
+
+	// Set the 48 bit timestamp, big endian.
+	var ts [8]byte
+	binary.BigEndian.PutUint64(ts[:], ms)
+	copy(u[0:6], ts[2:])
+
+	// Set the version to 7 and the sequence.
+	u[6] = 0x70 | byte(seq>>8)
+	u[7] = byte(seq)
+
+	// Set the RFC4122 flag.
+	u[8] = (u[8] & 0xBF) | 0x80
+
+	return UUID(fmt.Sprintf("%x-%x-%x-%x-%x", u[0:4], u[4:6], u[6:8], u[8:10], u[10:]))
+}
+
+// The time and sequence of the last ordered UUID.
+var (
+	orderedLastMs uint64
+	orderedSeq    uint16
+	orderedMu     sync.Mutex
+)
+
+// newUUIDv4 creates a new UUID of type v4.
+func newUUIDv4() UUID {
 	var u [16]byte
 
 	// Set all bits to randomly (or pseudo-randomly) chosen values.
@@ -53,9 +137,35 @@ func NewUUID() UUID {
 	return UUID(fmt.Sprintf("%x-%x-%x-%x-%x", u[0:4], u[4:6], u[6:8], u[8:10], u[10:]))
 }
 
+// NewNamedUUID creates a UUID of type v5, from the SHA-1 hash of a namespace
+// and a name. The same namespace and name always gives the same id, which can
+// be used to derive ids from other values. It panics if the namespace is not
+// a valid UUID.
+func NewNamedUUID(namespace UUID, name string) UUID {
+	ns, err := hex.DecodeString(strings.Replace(string(namespace), "-", "", -1))
+	if err != nil || len(ns) != 16 {
+		panic("eventhorizon: invalid UUID namespace: " + string(namespace))
+	}
+
+	h := sha1.New()
+	h.Write(ns)
+	h.Write([]byte(name))
+	var u [16]byte
+	copy(u[:], h.Sum(nil))
+
+	// Set the RFC4122 flag.
+	u[8] = (u[8] & 0xBF) | 0x80
+
+	// Set the version to 5.
+	u[6] = (u[6] & 0xF) | 0x50
+
+	return UUID(fmt.Sprintf("%x-%x-%x-%x-%x", u[0:4], u[4:6], u[6:8], u[8:10], u[10:]))
+}
+
 // ParseUUID parses a UUID from a string representation.
-// ParseUUID creates a UUID object from given hex string representation.
-// The function accepts UUID string in following formats:
+// ParseUUID creates a UUID object from given hex string representation, of
+// any of the versions 1 to 8, which includes the ids from both NewUUID and
+// NewOrderedUUID. The function accepts UUID string in following formats:
 //
 //     ParseUUID("6ba7b814-9dad-11d1-80b4-00c04fd430c8")
 //     ParseUUID("{6ba7b814-9dad-11d1-80b4-00c04fd430c8}")
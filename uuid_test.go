@@ -53,6 +53,111 @@ func TestNewUUID(t *testing.T) {
 	}
 }
 
+func TestNewOrderedUUID(t *testing.T) {
+	id := NewOrderedUUID()
+	b, err := hex.DecodeString(strings.Replace(string(id), "-", "", -1))
+	if err != nil {
+		t.Error(err)
+	}
+
+	if (b[8]&0xC0)|0x80 != uint8(0x80) {
+		t.Error("the variant should be correct")
+	}
+
+	if b[6]>>4 != uint8(7) {
+		t.Error("the version should be correct")
+	}
+
+	re := regexp.MustCompile("^[a-z0-9]{8}-[a-z0-9]{4}-7[a-z0-9]{3}-[a-z0-9]{4}-[a-z0-9]{12}$")
+	if !re.MatchString(string(id)) {
+		t.Error("the string format should be correct:", id)
+	}
+
+	t.Log("ids should be ordered")
+	prev := id
+	for i := 0; i < 10000; i++ {
+		id := NewOrderedUUID()
+		if id <= prev {
+			t.Fatalf("the ID should be after the previous: %s <= %s", id, prev)
+		}
+		prev = id
+
+		parsed, err := ParseUUID(string(id))
+		if err != nil {
+			t.Fatal("there should be no error:", err)
+		}
+		if parsed != id {
+			t.Fatal("the ID should be correct:", parsed)
+		}
+	}
+}
+
+func TestNewNamedUUID(t *testing.T) {
+	t.Log("create an id from the DNS namespace of RFC4122")
+	ns := UUID("6ba7b810-9dad-11d1-80b4-00c04fd430c8")
+	if id := NewNamedUUID(ns, "www.example.com"); id != UUID("2ed6657d-e927-568b-95e1-2665a8aea6a2") {
+		t.Error("the id should be correct:", id)
+	}
+
+	t.Log("create the same id for the same name")
+	id := NewNamedUUID(ns, "name")
+	if other := NewNamedUUID(ns, "name"); other != id {
+		t.Error("the ids should be the same:", id, other)
+	}
+	if _, err := ParseUUID(string(id)); err != nil {
+		t.Error("the id should be valid:", err)
+	}
+
+	t.Log("create other ids for other names and namespaces")
+	if other := NewNamedUUID(ns, "other"); other == id {
+		t.Error("the ids should not be the same:", other)
+	}
+	if other := NewNamedUUID(NewUUID(), "name"); other == id {
+		t.Error("the ids should not be the same:", other)
+	}
+
+	t.Log("panic with an invalid namespace")
+	defer func() {
+		if r := recover(); r == nil {
+			t.Error("there should be a panic")
+		}
+	}()
+	NewNamedUUID(UUID("invalid"), "name")
+}
+
+func TestSetUUIDGenerator(t *testing.T) {
+	SetUUIDGenerator(NewOrderedUUID)
+	defer SetUUIDGenerator(nil)
+
+	id1 := NewUUID()
+	id2 := NewUUID()
+	if id2 <= id1 {
+		t.Error("the IDs should be ordered:", id1, id2)
+	}
+	if string(id1)[14] != '7' {
+		t.Error("the ID should be from the generator:", id1)
+	}
+
+	t.Log("ids should round trip through JSON")
+	b, err := json.Marshal(&jsonType{ID: &id1})
+	if err != nil {
+		t.Error("there should be no error:", err)
+	}
+	var value jsonType
+	if err := json.Unmarshal(b, &value); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if value.ID == nil || *value.ID != id1 {
+		t.Error("the ID should be correct:", value.ID)
+	}
+
+	t.Log("restore the default generator")
+	SetUUIDGenerator(nil)
+	if id := NewUUID(); string(id)[14] != '4' {
+		t.Error("the ID should be a v4 UUID:", id)
+	}
+}
+
 func TestParseUUID(t *testing.T) {
 	id := UUID("a4da289d-466d-4a56-4521-1dbd455aa0cd")
 
@@ -80,6 +185,14 @@ func TestParseUUID(t *testing.T) {
 		t.Error("the ID should be correct:", parsed)
 	}
 
+	parsed, err = ParseUUID("017f22e2-79b0-7cc3-98c4-dc0c0c07398f")
+	if err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if parsed != UUID("017f22e2-79b0-7cc3-98c4-dc0c0c07398f") {
+		t.Error("the ID should be correct:", parsed)
+	}
+
 	parsed, err = ParseUUID("not-a-uuid")
 	if err == nil || err.Error() != "Invalid UUID string" {
 		t.Error("there should be a 'Invalid UUID string' error:", err)